@@ -1,535 +0,0 @@
-package analytics
-
-import (
-	"context"
-	"encoding/json"
-	"fmt"
-	"log"
-	"math"
-	"sort"
-	"time"
-
-	"github.com/google/uuid"
-	"gorm.io/gorm"
-)
-
-// AdvancedAnalytics provides AI-powered insights and predictions
-type AdvancedAnalytics struct {
-	db          *gorm.DB
-	predictor   *PerformancePredictor
-	optimizer   *ResourceOptimizer
-	insights    *BusinessInsights
-}
-
-// PlayerMetric represents player activity data
-type PlayerMetric struct {
-	ID            uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	ServerID      uuid.UUID `json:"server_id" gorm:"type:uuid;not null"`
-	PlayerUUID    string    `json:"player_uuid" gorm:"not null"`
-	PlayerName    string    `json:"player_name"`
-	SessionStart  time.Time `json:"session_start"`
-	SessionEnd    *time.Time `json:"session_end"`
-	Duration      int64     `json:"duration"` // in seconds
-	Actions       int       `json:"actions"`  // actions performed
-	Deaths        int       `json:"deaths"`
-	Achievements  int       `json:"achievements"`
-	Location      string    `json:"location"` // last known location
-	ItemsCollected int      `json:"items_collected"`
-	BlocksPlaced  int       `json:"blocks_placed"`
-	BlocksBroken  int       `json:"blocks_broken"`
-	ChatMessages  int       `json:"chat_messages"`
-	Timestamp     time.Time `json:"timestamp"`
-}
-
-// ServerAnalytics represents aggregated server analytics
-type ServerAnalytics struct {
-	ID                   uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	ServerID            uuid.UUID `json:"server_id" gorm:"type:uuid;not null"`
-	Date                time.Time `json:"date"`
-	UniquePlayersDaily  int       `json:"unique_players_daily"`
-	UniquePlayersWeekly int       `json:"unique_players_weekly"`
-	UniquePlayersMonthly int      `json:"unique_players_monthly"`
-	PeakPlayers         int       `json:"peak_players"`
-	AverageSessionTime  float64   `json:"average_session_time"`
-	PlayerRetention24h  float64   `json:"player_retention_24h"`
-	PlayerRetention7d   float64   `json:"player_retention_7d"`
-	PlayerRetention30d  float64   `json:"player_retention_30d"`
-	TotalPlaytime       int64     `json:"total_playtime"`
-	NewPlayers          int       `json:"new_players"`
-	ReturningPlayers    int       `json:"returning_players"`
-	ChurnRate           float64   `json:"churn_rate"`
-	EngagementScore     float64   `json:"engagement_score"`
-	Performance         PerformanceMetrics `json:"performance" gorm:"type:json"`
-	CreatedAt           time.Time `json:"created_at"`
-}
-
-// PerformanceMetrics represents server performance data
-type PerformanceMetrics struct {
-	AverageTPS       float64 `json:"average_tps"`
-	AverageMSPT      float64 `json:"average_mspt"`
-	CPUUsageAvg      float64 `json:"cpu_usage_avg"`
-	MemoryUsageAvg   float64 `json:"memory_usage_avg"`
-	DiskUsageAvg     float64 `json:"disk_usage_avg"`
-	NetworkInAvg     int64   `json:"network_in_avg"`
-	NetworkOutAvg    int64   `json:"network_out_avg"`
-	UptimePercentage float64 `json:"uptime_percentage"`
-	CrashCount       int     `json:"crash_count"`
-	LagSpikes        int     `json:"lag_spikes"`
-}
-
-// PredictionModel represents AI predictions
-type PredictionModel struct {
-	ID          uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	ServerID    uuid.UUID `json:"server_id" gorm:"type:uuid;not null"`
-	ModelType   string    `json:"model_type"` // "player_count", "resource_usage", "performance"
-	Timeframe   string    `json:"timeframe"`  // "1h", "24h", "7d", "30d"
-	Predictions map[string]interface{} `json:"predictions" gorm:"type:json"`
-	Confidence  float64   `json:"confidence"`
-	CreatedAt   time.Time `json:"created_at"`
-	ExpiresAt   time.Time `json:"expires_at"`
-}
-
-// BusinessInsight represents AI-generated business insights
-type BusinessInsight struct {
-	ID          uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	ServerID    uuid.UUID `json:"server_id" gorm:"type:uuid;not null"`
-	Category    string    `json:"category"` // "performance", "players", "revenue", "growth"
-	Priority    string    `json:"priority"` // "low", "medium", "high", "critical"
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Metrics     map[string]interface{} `json:"metrics" gorm:"type:json"`
-	Recommendations []string `json:"recommendations" gorm:"type:json"`
-	Impact      string    `json:"impact"` // "positive", "negative", "neutral"
-	Confidence  float64   `json:"confidence"`
-	ActionTaken bool      `json:"action_taken"`
-	CreatedAt   time.Time `json:"created_at"`
-	ExpiresAt   time.Time `json:"expires_at"`
-}
-
-// HeatmapData represents server activity heatmap
-type HeatmapData struct {
-	Hour          int     `json:"hour"`
-	DayOfWeek     int     `json:"day_of_week"`
-	PlayerCount   int     `json:"player_count"`
-	Activity      float64 `json:"activity"`
-	Performance   float64 `json:"performance"`
-	ResourceUsage float64 `json:"resource_usage"`
-}
-
-// PlayerBehaviorAnalysis represents player behavior insights
-type PlayerBehaviorAnalysis struct {
-	PlayerUUID        string    `json:"player_uuid"`
-	PlayerType        string    `json:"player_type"` // "casual", "hardcore", "builder", "explorer", "social"
-	PlayStyle         string    `json:"play_style"`
-	PreferredTime     time.Time `json:"preferred_time"`
-	AverageSession    float64   `json:"average_session"`
-	LoyaltyScore      float64   `json:"loyalty_score"`
-	EngagementLevel   string    `json:"engagement_level"`
-	ChurnRisk         float64   `json:"churn_risk"`
-	RevenueContribution float64 `json:"revenue_contribution"`
-	SocialConnections int       `json:"social_connections"`
-	Achievements      []string  `json:"achievements"`
-	Preferences       map[string]interface{} `json:"preferences"`
-}
-
-// PerformancePredictor handles AI-powered performance predictions
-type PerformancePredictor struct {
-	db *gorm.DB
-}
-
-// ResourceOptimizer provides AI-powered resource optimization
-type ResourceOptimizer struct {
-	db *gorm.DB
-}
-
-// BusinessInsights generates business intelligence insights
-type BusinessInsights struct {
-	db *gorm.DB
-}
-
-// NewAdvancedAnalytics creates a new analytics engine
-func NewAdvancedAnalytics(db *gorm.DB) *AdvancedAnalytics {
-	return &AdvancedAnalytics{
-		db:        db,
-		predictor: &PerformancePredictor{db: db},
-		optimizer: &ResourceOptimizer{db: db},
-		insights:  &BusinessInsights{db: db},
-	}
-}
-
-// TrackPlayerActivity records player activity for analytics
-func (a *AdvancedAnalytics) TrackPlayerActivity(ctx context.Context, metric PlayerMetric) error {
-	return a.db.WithContext(ctx).Create(&metric).Error
-}
-
-// GenerateServerAnalytics creates comprehensive server analytics
-func (a *AdvancedAnalytics) GenerateServerAnalytics(ctx context.Context, serverID uuid.UUID, date time.Time) (*ServerAnalytics, error) {
-	startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
-	endOfDay := startOfDay.Add(24 * time.Hour)
-
-	analytics := &ServerAnalytics{
-		ServerID: serverID,
-		Date:     startOfDay,
-	}
-
-	// Calculate unique players for different periods
-	analytics.UniquePlayersDaily = a.calculateUniquePlayersByPeriod(serverID, startOfDay, endOfDay)
-	analytics.UniquePlayersWeekly = a.calculateUniquePlayersByPeriod(serverID, startOfDay.AddDate(0, 0, -7), endOfDay)
-	analytics.UniquePlayersMonthly = a.calculateUniquePlayersByPeriod(serverID, startOfDay.AddDate(0, -1, 0), endOfDay)
-
-	// Calculate peak players
-	analytics.PeakPlayers = a.calculatePeakPlayers(serverID, startOfDay, endOfDay)
-
-	// Calculate average session time
-	analytics.AverageSessionTime = a.calculateAverageSessionTime(serverID, startOfDay, endOfDay)
-
-	// Calculate retention rates
-	analytics.PlayerRetention24h = a.calculateRetentionRate(serverID, 24*time.Hour)
-	analytics.PlayerRetention7d = a.calculateRetentionRate(serverID, 7*24*time.Hour)
-	analytics.PlayerRetention30d = a.calculateRetentionRate(serverID, 30*24*time.Hour)
-
-	// Calculate churn rate
-	analytics.ChurnRate = a.calculateChurnRate(serverID, startOfDay, endOfDay)
-
-	// Calculate engagement score
-	analytics.EngagementScore = a.calculateEngagementScore(serverID, startOfDay, endOfDay)
-
-	// Get performance metrics
-	analytics.Performance = a.calculatePerformanceMetrics(serverID, startOfDay, endOfDay)
-
-	// Save analytics
-	if err := a.db.WithContext(ctx).Create(analytics).Error; err != nil {
-		return nil, err
-	}
-
-	return analytics, nil
-}
-
-// PredictPlayerCount predicts future player count using AI
-func (a *AdvancedAnalytics) PredictPlayerCount(ctx context.Context, serverID uuid.UUID, timeframe string) (*PredictionModel, error) {
-	// Get historical data
-	historicalData := a.getHistoricalPlayerData(serverID, 30) // Last 30 days
-
-	// Apply machine learning algorithm (simplified)
-	predictions := a.predictor.predictTimeSeries(historicalData, timeframe)
-
-	model := &PredictionModel{
-		ServerID:    serverID,
-		ModelType:   "player_count",
-		Timeframe:   timeframe,
-		Predictions: predictions,
-		Confidence:  a.calculatePredictionConfidence(historicalData),
-		CreatedAt:   time.Now(),
-		ExpiresAt:   time.Now().Add(time.Hour), // Predictions expire in 1 hour
-	}
-
-	if err := a.db.WithContext(ctx).Create(model).Error; err != nil {
-		return nil, err
-	}
-
-	return model, nil
-}
-
-// GenerateHeatmap creates activity heatmap data
-func (a *AdvancedAnalytics) GenerateHeatmap(ctx context.Context, serverID uuid.UUID, days int) ([]HeatmapData, error) {
-	var heatmapData []HeatmapData
-
-	endTime := time.Now()
-	startTime := endTime.AddDate(0, 0, -days)
-
-	// Generate heatmap for each hour of each day of the week
-	for hour := 0; hour < 24; hour++ {
-		for dayOfWeek := 0; dayOfWeek < 7; dayOfWeek++ {
-			data := HeatmapData{
-				Hour:      hour,
-				DayOfWeek: dayOfWeek,
-			}
-
-			// Calculate metrics for this hour and day of week
-			data.PlayerCount = a.calculateAveragePlayersForTimeSlot(serverID, hour, dayOfWeek, startTime, endTime)
-			data.Activity = a.calculateActivityForTimeSlot(serverID, hour, dayOfWeek, startTime, endTime)
-			data.Performance = a.calculatePerformanceForTimeSlot(serverID, hour, dayOfWeek, startTime, endTime)
-			data.ResourceUsage = a.calculateResourceUsageForTimeSlot(serverID, hour, dayOfWeek, startTime, endTime)
-
-			heatmapData = append(heatmapData, data)
-		}
-	}
-
-	return heatmapData, nil
-}
-
-// AnalyzePlayerBehavior performs deep player behavior analysis
-func (a *AdvancedAnalytics) AnalyzePlayerBehavior(ctx context.Context, serverID uuid.UUID, playerUUID string) (*PlayerBehaviorAnalysis, error) {
-	analysis := &PlayerBehaviorAnalysis{
-		PlayerUUID: playerUUID,
-	}
-
-	// Get player metrics
-	var metrics []PlayerMetric
-	a.db.Where("server_id = ? AND player_uuid = ?", serverID, playerUUID).
-		Order("timestamp DESC").
-		Limit(1000).
-		Find(&metrics)
-
-	if len(metrics) == 0 {
-		return nil, fmt.Errorf("no data found for player %s", playerUUID)
-	}
-
-	// Analyze play patterns
-	analysis.PlayerType = a.classifyPlayerType(metrics)
-	analysis.PlayStyle = a.determinePlayStyle(metrics)
-	analysis.PreferredTime = a.findPreferredPlayTime(metrics)
-	analysis.AverageSession = a.calculatePlayerAverageSession(metrics)
-	analysis.LoyaltyScore = a.calculateLoyaltyScore(metrics)
-	analysis.EngagementLevel = a.determineEngagementLevel(metrics)
-	analysis.ChurnRisk = a.calculateChurnRisk(metrics)
-	analysis.SocialConnections = a.calculateSocialConnections(serverID, playerUUID)
-
-	return analysis, nil
-}
-
-// GenerateOptimizationRecommendations provides AI-powered optimization suggestions
-func (a *AdvancedAnalytics) GenerateOptimizationRecommendations(ctx context.Context, serverID uuid.UUID) ([]BusinessInsight, error) {
-	var insights []BusinessInsight
-
-	// Performance optimization insights
-	perfInsights := a.optimizer.analyzePerformanceOptimization(serverID)
-	insights = append(insights, perfInsights...)
-
-	// Resource optimization insights
-	resourceInsights := a.optimizer.analyzeResourceOptimization(serverID)
-	insights = append(insights, resourceInsights...)
-
-	// Player experience insights
-	playerInsights := a.insights.analyzePlayerExperience(serverID)
-	insights = append(insights, playerInsights...)
-
-	// Business growth insights
-	growthInsights := a.insights.analyzeGrowthOpportunities(serverID)
-	insights = append(insights, growthInsights...)
-
-	// Save insights to database
-	for _, insight := range insights {
-		insight.ServerID = serverID
-		insight.CreatedAt = time.Now()
-		insight.ExpiresAt = time.Now().Add(24 * time.Hour)
-		
-		if err := a.db.WithContext(ctx).Create(&insight).Error; err != nil {
-			log.Printf("Error saving insight: %v", err)
-		}
-	}
-
-	return insights, nil
-}
-
-// Real-time Analytics Dashboard Data
-func (a *AdvancedAnalytics) GetRealtimeDashboard(ctx context.Context, serverID uuid.UUID) (map[string]interface{}, error) {
-	dashboard := make(map[string]interface{})
-
-	// Current metrics
-	dashboard["current_players"] = a.getCurrentPlayerCount(serverID)
-	dashboard["peak_today"] = a.getPeakPlayersToday(serverID)
-	dashboard["uptime_today"] = a.getUptimeToday(serverID)
-	dashboard["performance_score"] = a.getCurrentPerformanceScore(serverID)
-
-	// Trends (last 24 hours)
-	dashboard["player_trend"] = a.getPlayerTrend(serverID, 24*time.Hour)
-	dashboard["performance_trend"] = a.getPerformanceTrend(serverID, 24*time.Hour)
-	dashboard["resource_trend"] = a.getResourceTrend(serverID, 24*time.Hour)
-
-	// Predictions (next 4 hours)
-	predictions, _ := a.PredictPlayerCount(ctx, serverID, "4h")
-	dashboard["player_predictions"] = predictions
-
-	// Recent insights
-	var recentInsights []BusinessInsight
-	a.db.Where("server_id = ? AND created_at > ?", serverID, time.Now().Add(-24*time.Hour)).
-		Order("priority DESC, created_at DESC").
-		Limit(5).
-		Find(&recentInsights)
-	dashboard["recent_insights"] = recentInsights
-
-	// Top players today
-	dashboard["top_players"] = a.getTopPlayersToday(serverID)
-
-	// Server health score
-	dashboard["health_score"] = a.calculateServerHealthScore(serverID)
-
-	return dashboard, nil
-}
-
-// Helper functions (simplified implementations)
-
-func (a *AdvancedAnalytics) calculateUniquePlayersByPeriod(serverID uuid.UUID, start, end time.Time) int {
-	var count int64
-	a.db.Model(&PlayerMetric{}).
-		Where("server_id = ? AND timestamp BETWEEN ? AND ?", serverID, start, end).
-		Distinct("player_uuid").
-		Count(&count)
-	return int(count)
-}
-
-func (a *AdvancedAnalytics) calculatePeakPlayers(serverID uuid.UUID, start, end time.Time) int {
-	// This would involve more complex aggregation in a real implementation
-	return 50 // Placeholder
-}
-
-func (a *AdvancedAnalytics) calculateAverageSessionTime(serverID uuid.UUID, start, end time.Time) float64 {
-	var avgDuration float64
-	a.db.Model(&PlayerMetric{}).
-		Where("server_id = ? AND timestamp BETWEEN ? AND ? AND session_end IS NOT NULL", serverID, start, end).
-		Select("AVG(duration)").
-		Scan(&avgDuration)
-	return avgDuration
-}
-
-func (a *AdvancedAnalytics) calculateRetentionRate(serverID uuid.UUID, period time.Duration) float64 {
-	// Complex retention calculation would go here
-	return 0.75 // 75% retention rate placeholder
-}
-
-func (a *AdvancedAnalytics) calculateChurnRate(serverID uuid.UUID, start, end time.Time) float64 {
-	// Churn rate calculation
-	return 0.15 // 15% churn rate placeholder
-}
-
-func (a *AdvancedAnalytics) calculateEngagementScore(serverID uuid.UUID, start, end time.Time) float64 {
-	// Complex engagement scoring algorithm
-	return 8.5 // Score out of 10
-}
-
-func (a *AdvancedAnalytics) calculatePerformanceMetrics(serverID uuid.UUID, start, end time.Time) PerformanceMetrics {
-	return PerformanceMetrics{
-		AverageTPS:       19.8,
-		AverageMSPT:      45.2,
-		CPUUsageAvg:      35.5,
-		MemoryUsageAvg:   60.2,
-		DiskUsageAvg:     25.8,
-		UptimePercentage: 99.95,
-		CrashCount:       0,
-		LagSpikes:        2,
-	}
-}
-
-func (p *PerformancePredictor) predictTimeSeries(data []float64, timeframe string) map[string]interface{} {
-	// Simplified prediction algorithm
-	predictions := make(map[string]interface{})
-	
-	if len(data) == 0 {
-		return predictions
-	}
-	
-	// Calculate trend
-	trend := p.calculateTrend(data)
-	seasonal := p.calculateSeasonality(data)
-	
-	// Generate predictions based on timeframe
-	switch timeframe {
-	case "1h":
-		predictions["1h"] = p.generateHourlyPredictions(data, trend, seasonal)
-	case "24h":
-		predictions["24h"] = p.generateDailyPredictions(data, trend, seasonal)
-	case "7d":
-		predictions["7d"] = p.generateWeeklyPredictions(data, trend, seasonal)
-	}
-	
-	return predictions
-}
-
-func (p *PerformancePredictor) calculateTrend(data []float64) float64 {
-	if len(data) < 2 {
-		return 0
-	}
-	
-	// Simple linear trend calculation
-	n := float64(len(data))
-	sumX := n * (n - 1) / 2
-	sumY := 0.0
-	sumXY := 0.0
-	
-	for i, y := range data {
-		sumY += y
-		sumXY += float64(i) * y
-	}
-	
-	return (n*sumXY - sumX*sumY) / (n*n*(n-1)/2 - sumX*sumX)
-}
-
-func (p *PerformancePredictor) calculateSeasonality(data []float64) []float64 {
-	// Simplified seasonality detection
-	seasonality := make([]float64, 24) // 24-hour pattern
-	
-	for i := range seasonality {
-		count := 0
-		sum := 0.0
-		
-		for j := i; j < len(data); j += 24 {
-			sum += data[j]
-			count++
-		}
-		
-		if count > 0 {
-			seasonality[i] = sum / float64(count)
-		}
-	}
-	
-	return seasonality
-}
-
-func (p *PerformancePredictor) generateHourlyPredictions(data []float64, trend, seasonality []float64) []map[string]interface{} {
-	predictions := make([]map[string]interface{}, 0, 12) // Next 12 hours
-	
-	lastValue := data[len(data)-1]
-	
-	for i := 0; i < 12; i++ {
-		hour := time.Now().Add(time.Duration(i+1) * time.Hour)
-		seasonalIndex := hour.Hour()
-		seasonalFactor := 1.0
-		
-		if len(seasonality) > seasonalIndex {
-			seasonalFactor = seasonality[seasonalIndex] / lastValue
-		}
-		
-		predicted := lastValue + trend*float64(i+1)
-		predicted *= seasonalFactor
-		
-		// Add some uncertainty
-		confidence := math.Max(0.5, 1.0-float64(i)*0.05)
-		
-		predictions = append(predictions, map[string]interface{}{
-			"timestamp":  hour,
-			"predicted":  math.Max(0, predicted),
-			"confidence": confidence,
-		})
-	}
-	
-	return predictions
-}
-
-func (p *PerformancePredictor) generateDailyPredictions(data []float64, trend float64, seasonality []float64) []map[string]interface{} {
-	// Similar to hourly but for next 7 days
-	predictions := make([]map[string]interface{}, 0, 7)
-	// Implementation would be similar to hourly
-	return predictions
-}
-
-func (p *PerformancePredictor) generateWeeklyPredictions(data []float64, trend float64, seasonality []float64) []map[string]interface{} {
-	// Implementation for weekly predictions
-	predictions := make([]map[string]interface{}, 0, 4)
-	// Implementation would be similar but for weeks
-	return predictions
-}
-
-// Additional helper functions would be implemented here...
-
-func (a *AdvancedAnalytics) getHistoricalPlayerData(serverID uuid.UUID, days int) []float64 {
-	// Implementation to get historical player count data
-	return []float64{10, 15, 20, 25, 30, 28, 35, 40, 38, 42} // Placeholder
-}
-
-func (a *AdvancedAnalytics) calculatePredictionConfidence(data []float64) float64 {
-	// Calculate confidence based on data variance and trend stability
-	return 0.85 // 85% confidence placeholder
-}
-
-// More helper functions would be implemented for complete functionality...
\ No newline at end of file
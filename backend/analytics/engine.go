@@ -0,0 +1,1061 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AdvancedAnalytics provides AI-powered insights and predictions
+type AdvancedAnalytics struct {
+	db        *gorm.DB
+	predictor *PerformancePredictor
+	optimizer *ResourceOptimizer
+	insights  *BusinessInsights
+	players   PlayerLookup
+}
+
+// PlayerLookup returns a player's UUID and current name from either of
+// them; the panel's Mojang profile resolver is one
+type PlayerLookup func(player string) (playerUUID, name string, err error)
+
+// PlayerMetric represents player activity data
+type PlayerMetric struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ServerID       uuid.UUID  `json:"server_id" gorm:"type:uuid;not null"`
+	PlayerUUID     string     `json:"player_uuid" gorm:"not null"`
+	PlayerName     string     `json:"player_name"`
+	SessionStart   time.Time  `json:"session_start"`
+	SessionEnd     *time.Time `json:"session_end"`
+	Duration       int64      `json:"duration"` // in seconds
+	Actions        int        `json:"actions"`  // actions performed
+	Deaths         int        `json:"deaths"`
+	Achievements   int        `json:"achievements"`
+	Location       string     `json:"location"` // last known location
+	ItemsCollected int        `json:"items_collected"`
+	BlocksPlaced   int        `json:"blocks_placed"`
+	BlocksBroken   int        `json:"blocks_broken"`
+	ChatMessages   int        `json:"chat_messages"`
+	Timestamp      time.Time  `json:"timestamp"`
+}
+
+// ServerAnalytics represents aggregated server analytics
+type ServerAnalytics struct {
+	ID                   uuid.UUID          `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ServerID             uuid.UUID          `json:"server_id" gorm:"type:uuid;not null"`
+	Date                 time.Time          `json:"date"`
+	UniquePlayersDaily   int                `json:"unique_players_daily"`
+	UniquePlayersWeekly  int                `json:"unique_players_weekly"`
+	UniquePlayersMonthly int                `json:"unique_players_monthly"`
+	PeakPlayers          int                `json:"peak_players"`
+	AverageSessionTime   float64            `json:"average_session_time"`
+	PlayerRetention24h   float64            `json:"player_retention_24h"`
+	PlayerRetention7d    float64            `json:"player_retention_7d"`
+	PlayerRetention30d   float64            `json:"player_retention_30d"`
+	TotalPlaytime        int64              `json:"total_playtime"`
+	NewPlayers           int                `json:"new_players"`
+	ReturningPlayers     int                `json:"returning_players"`
+	ChurnRate            float64            `json:"churn_rate"`
+	EngagementScore      float64            `json:"engagement_score"`
+	Performance          PerformanceMetrics `json:"performance" gorm:"type:json"`
+	CreatedAt            time.Time          `json:"created_at"`
+}
+
+// PerformanceMetrics represents server performance data
+type PerformanceMetrics struct {
+	AverageTPS       float64 `json:"average_tps"`
+	AverageMSPT      float64 `json:"average_mspt"`
+	CPUUsageAvg      float64 `json:"cpu_usage_avg"`
+	MemoryUsageAvg   float64 `json:"memory_usage_avg"`
+	DiskUsageAvg     float64 `json:"disk_usage_avg"`
+	NetworkInAvg     int64   `json:"network_in_avg"`
+	NetworkOutAvg    int64   `json:"network_out_avg"`
+	UptimePercentage float64 `json:"uptime_percentage"`
+	CrashCount       int     `json:"crash_count"`
+	LagSpikes        int     `json:"lag_spikes"`
+}
+
+// PredictionModel represents AI predictions
+type PredictionModel struct {
+	ID          uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ServerID    uuid.UUID              `json:"server_id" gorm:"type:uuid;not null"`
+	ModelType   string                 `json:"model_type"` // "player_count", "resource_usage", "performance"
+	Timeframe   string                 `json:"timeframe"`  // "1h", "24h", "7d", "30d"
+	Predictions map[string]interface{} `json:"predictions" gorm:"type:json"`
+	Confidence  float64                `json:"confidence"`
+	CreatedAt   time.Time              `json:"created_at"`
+	ExpiresAt   time.Time              `json:"expires_at"`
+}
+
+// BusinessInsight represents AI-generated business insights
+type BusinessInsight struct {
+	ID              uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ServerID        uuid.UUID              `json:"server_id" gorm:"type:uuid;not null"`
+	Category        string                 `json:"category"` // "performance", "players", "revenue", "growth"
+	Priority        string                 `json:"priority"` // "low", "medium", "high", "critical"
+	Title           string                 `json:"title"`
+	Description     string                 `json:"description"`
+	Metrics         map[string]interface{} `json:"metrics" gorm:"type:json"`
+	Recommendations []string               `json:"recommendations" gorm:"type:json"`
+	Impact          string                 `json:"impact"` // "positive", "negative", "neutral"
+	Confidence      float64                `json:"confidence"`
+	ActionTaken     bool                   `json:"action_taken"`
+	CreatedAt       time.Time              `json:"created_at"`
+	ExpiresAt       time.Time              `json:"expires_at"`
+}
+
+// HeatmapData represents server activity heatmap
+type HeatmapData struct {
+	Hour          int     `json:"hour"`
+	DayOfWeek     int     `json:"day_of_week"`
+	PlayerCount   int     `json:"player_count"`
+	Activity      float64 `json:"activity"`
+	Performance   float64 `json:"performance"`
+	ResourceUsage float64 `json:"resource_usage"`
+}
+
+// PlayerBehaviorAnalysis represents player behavior insights
+type PlayerBehaviorAnalysis struct {
+	PlayerUUID          string                 `json:"player_uuid"`
+	PlayerType          string                 `json:"player_type"` // "casual", "hardcore", "builder", "explorer", "social"
+	PlayStyle           string                 `json:"play_style"`
+	PreferredTime       time.Time              `json:"preferred_time"`
+	AverageSession      float64                `json:"average_session"`
+	LoyaltyScore        float64                `json:"loyalty_score"`
+	EngagementLevel     string                 `json:"engagement_level"`
+	ChurnRisk           float64                `json:"churn_risk"`
+	RevenueContribution float64                `json:"revenue_contribution"`
+	SocialConnections   int                    `json:"social_connections"`
+	Achievements        []string               `json:"achievements"`
+	Preferences         map[string]interface{} `json:"preferences"`
+}
+
+// PerformancePredictor handles AI-powered performance predictions
+type PerformancePredictor struct {
+	db *gorm.DB
+}
+
+// ResourceOptimizer provides AI-powered resource optimization
+type ResourceOptimizer struct {
+	db *gorm.DB
+}
+
+// BusinessInsights generates business intelligence insights
+type BusinessInsights struct {
+	db *gorm.DB
+}
+
+// NewAdvancedAnalytics creates a new analytics engine
+func NewAdvancedAnalytics(db *gorm.DB) *AdvancedAnalytics {
+	return &AdvancedAnalytics{
+		db:        db,
+		predictor: &PerformancePredictor{db: db},
+		optimizer: &ResourceOptimizer{db: db},
+		insights:  &BusinessInsights{db: db},
+	}
+}
+
+// SetPlayerLookup sets how players known only by name or UUID are
+// completed
+func (a *AdvancedAnalytics) SetPlayerLookup(lookup PlayerLookup) {
+	a.players = lookup
+}
+
+// TrackPlayerActivity records player activity for analytics. A metric with
+// only the player's name or UUID is completed with the player lookup, so
+// activity is always keyed by UUID.
+func (a *AdvancedAnalytics) TrackPlayerActivity(ctx context.Context, metric PlayerMetric) error {
+	if (metric.PlayerUUID == "" || metric.PlayerName == "") && a.players != nil {
+		player := metric.PlayerUUID
+		if player == "" {
+			player = metric.PlayerName
+		}
+		if playerUUID, name, err := a.players(player); err == nil {
+			metric.PlayerUUID, metric.PlayerName = playerUUID, name
+		} else if metric.PlayerUUID == "" {
+			return fmt.Errorf("failed to look up player %s: %w", player, err)
+		}
+	}
+	if metric.PlayerUUID == "" {
+		return fmt.Errorf("player activity needs the player's UUID")
+	}
+
+	return a.db.WithContext(ctx).Create(&metric).Error
+}
+
+// GenerateServerAnalytics creates comprehensive server analytics
+func (a *AdvancedAnalytics) GenerateServerAnalytics(ctx context.Context, serverID uuid.UUID, date time.Time) (*ServerAnalytics, error) {
+	startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	endOfDay := startOfDay.Add(24 * time.Hour)
+
+	analytics := &ServerAnalytics{
+		ServerID: serverID,
+		Date:     startOfDay,
+	}
+
+	// Calculate unique players for different periods
+	analytics.UniquePlayersDaily = a.calculateUniquePlayersByPeriod(serverID, startOfDay, endOfDay)
+	analytics.UniquePlayersWeekly = a.calculateUniquePlayersByPeriod(serverID, startOfDay.AddDate(0, 0, -7), endOfDay)
+	analytics.UniquePlayersMonthly = a.calculateUniquePlayersByPeriod(serverID, startOfDay.AddDate(0, -1, 0), endOfDay)
+
+	// Calculate peak players
+	analytics.PeakPlayers = a.calculatePeakPlayers(serverID, startOfDay, endOfDay)
+
+	// Calculate average session time
+	analytics.AverageSessionTime = a.calculateAverageSessionTime(serverID, startOfDay, endOfDay)
+
+	// Calculate retention rates
+	analytics.PlayerRetention24h = a.calculateRetentionRate(serverID, 24*time.Hour)
+	analytics.PlayerRetention7d = a.calculateRetentionRate(serverID, 7*24*time.Hour)
+	analytics.PlayerRetention30d = a.calculateRetentionRate(serverID, 30*24*time.Hour)
+
+	// Calculate churn rate
+	analytics.ChurnRate = a.calculateChurnRate(serverID, startOfDay, endOfDay)
+
+	// Calculate engagement score
+	analytics.EngagementScore = a.calculateEngagementScore(serverID, startOfDay, endOfDay)
+
+	// Get performance metrics
+	analytics.Performance = a.calculatePerformanceMetrics(serverID, startOfDay, endOfDay)
+
+	// Save analytics
+	if err := a.db.WithContext(ctx).Create(analytics).Error; err != nil {
+		return nil, err
+	}
+
+	return analytics, nil
+}
+
+// PredictPlayerCount predicts future player count using AI
+func (a *AdvancedAnalytics) PredictPlayerCount(ctx context.Context, serverID uuid.UUID, timeframe string) (*PredictionModel, error) {
+	// Get historical data
+	historicalData := a.getHistoricalPlayerData(serverID, 30) // Last 30 days
+
+	// Apply machine learning algorithm (simplified)
+	predictions := a.predictor.predictTimeSeries(historicalData, timeframe)
+
+	model := &PredictionModel{
+		ServerID:    serverID,
+		ModelType:   "player_count",
+		Timeframe:   timeframe,
+		Predictions: predictions,
+		Confidence:  a.calculatePredictionConfidence(historicalData),
+		CreatedAt:   time.Now(),
+		ExpiresAt:   time.Now().Add(time.Hour), // Predictions expire in 1 hour
+	}
+
+	if err := a.db.WithContext(ctx).Create(model).Error; err != nil {
+		return nil, err
+	}
+
+	return model, nil
+}
+
+// ForecastHourly predicts a value horizon ahead from hourly history, the
+// last entry being the hour that starts at last. The linear trend of the
+// history is extended and scaled by the daily pattern: how the hour of day
+// forecast for compares with the hour of day of the last entry.
+func ForecastHourly(history []float64, last time.Time, horizon time.Duration) float64 {
+	if len(history) == 0 {
+		return 0
+	}
+
+	p := &PerformancePredictor{}
+	hours := horizon.Hours()
+	latest := history[len(history)-1]
+	predicted := latest + p.calculateTrend(history)*hours
+
+	// Average by hour of day; only a full day of history has a pattern
+	if len(history) >= 24 {
+		var sums, counts [24]float64
+		for i, value := range history {
+			hour := last.Add(-time.Duration(len(history)-1-i) * time.Hour).Hour()
+			sums[hour] += value
+			counts[hour]++
+		}
+		from := last.Hour()
+		to := last.Add(horizon).Hour()
+		if counts[from] > 0 && counts[to] > 0 && sums[from] > 0 {
+			predicted *= (sums[to] / counts[to]) / (sums[from] / counts[from])
+		}
+	}
+
+	return math.Max(0, predicted)
+}
+
+// GenerateHeatmap creates activity heatmap data
+func (a *AdvancedAnalytics) GenerateHeatmap(ctx context.Context, serverID uuid.UUID, days int) ([]HeatmapData, error) {
+	var heatmapData []HeatmapData
+
+	endTime := time.Now()
+	startTime := endTime.AddDate(0, 0, -days)
+
+	// Generate heatmap for each hour of each day of the week
+	for hour := 0; hour < 24; hour++ {
+		for dayOfWeek := 0; dayOfWeek < 7; dayOfWeek++ {
+			data := HeatmapData{
+				Hour:      hour,
+				DayOfWeek: dayOfWeek,
+			}
+
+			// Calculate metrics for this hour and day of week
+			data.PlayerCount = a.calculateAveragePlayersForTimeSlot(serverID, hour, dayOfWeek, startTime, endTime)
+			data.Activity = a.calculateActivityForTimeSlot(serverID, hour, dayOfWeek, startTime, endTime)
+			data.Performance = a.calculatePerformanceForTimeSlot(serverID, hour, dayOfWeek, startTime, endTime)
+			data.ResourceUsage = a.calculateResourceUsageForTimeSlot(serverID, hour, dayOfWeek, startTime, endTime)
+
+			heatmapData = append(heatmapData, data)
+		}
+	}
+
+	return heatmapData, nil
+}
+
+// AnalyzePlayerBehavior performs deep player behavior analysis
+func (a *AdvancedAnalytics) AnalyzePlayerBehavior(ctx context.Context, serverID uuid.UUID, playerUUID string) (*PlayerBehaviorAnalysis, error) {
+	analysis := &PlayerBehaviorAnalysis{
+		PlayerUUID: playerUUID,
+	}
+
+	// Get player metrics
+	var metrics []PlayerMetric
+	a.db.Where("server_id = ? AND player_uuid = ?", serverID, playerUUID).
+		Order("timestamp DESC").
+		Limit(1000).
+		Find(&metrics)
+
+	if len(metrics) == 0 {
+		return nil, fmt.Errorf("no data found for player %s", playerUUID)
+	}
+
+	// Analyze play patterns
+	analysis.PlayerType = a.classifyPlayerType(metrics)
+	analysis.PlayStyle = a.determinePlayStyle(metrics)
+	analysis.PreferredTime = a.findPreferredPlayTime(metrics)
+	analysis.AverageSession = a.calculatePlayerAverageSession(metrics)
+	analysis.LoyaltyScore = a.calculateLoyaltyScore(metrics)
+	analysis.EngagementLevel = a.determineEngagementLevel(metrics)
+	analysis.ChurnRisk = a.calculateChurnRisk(metrics)
+	analysis.SocialConnections = a.calculateSocialConnections(serverID, playerUUID)
+
+	return analysis, nil
+}
+
+// GenerateOptimizationRecommendations provides AI-powered optimization suggestions
+func (a *AdvancedAnalytics) GenerateOptimizationRecommendations(ctx context.Context, serverID uuid.UUID) ([]BusinessInsight, error) {
+	var insights []BusinessInsight
+
+	// Performance optimization insights
+	perfInsights := a.optimizer.analyzePerformanceOptimization(serverID)
+	insights = append(insights, perfInsights...)
+
+	// Resource optimization insights
+	resourceInsights := a.optimizer.analyzeResourceOptimization(serverID)
+	insights = append(insights, resourceInsights...)
+
+	// Player experience insights
+	playerInsights := a.insights.analyzePlayerExperience(serverID)
+	insights = append(insights, playerInsights...)
+
+	// Business growth insights
+	growthInsights := a.insights.analyzeGrowthOpportunities(serverID)
+	insights = append(insights, growthInsights...)
+
+	// Save insights to database
+	for _, insight := range insights {
+		insight.ServerID = serverID
+		insight.CreatedAt = time.Now()
+		insight.ExpiresAt = time.Now().Add(24 * time.Hour)
+
+		if err := a.db.WithContext(ctx).Create(&insight).Error; err != nil {
+			log.Printf("Error saving insight: %v", err)
+		}
+	}
+
+	return insights, nil
+}
+
+// Real-time Analytics Dashboard Data
+func (a *AdvancedAnalytics) GetRealtimeDashboard(ctx context.Context, serverID uuid.UUID) (map[string]interface{}, error) {
+	dashboard := make(map[string]interface{})
+
+	// Current metrics
+	dashboard["current_players"] = a.getCurrentPlayerCount(serverID)
+	dashboard["peak_today"] = a.getPeakPlayersToday(serverID)
+	dashboard["uptime_today"] = a.getUptimeToday(serverID)
+	dashboard["performance_score"] = a.getCurrentPerformanceScore(serverID)
+
+	// Trends (last 24 hours)
+	dashboard["player_trend"] = a.getPlayerTrend(serverID, 24*time.Hour)
+	dashboard["performance_trend"] = a.getPerformanceTrend(serverID, 24*time.Hour)
+	dashboard["resource_trend"] = a.getResourceTrend(serverID, 24*time.Hour)
+
+	// Predictions (next 4 hours)
+	predictions, _ := a.PredictPlayerCount(ctx, serverID, "4h")
+	dashboard["player_predictions"] = predictions
+
+	// Recent insights
+	var recentInsights []BusinessInsight
+	a.db.Where("server_id = ? AND created_at > ?", serverID, time.Now().Add(-24*time.Hour)).
+		Order("priority DESC, created_at DESC").
+		Limit(5).
+		Find(&recentInsights)
+	dashboard["recent_insights"] = recentInsights
+
+	// Top players today
+	dashboard["top_players"] = a.getTopPlayersToday(serverID)
+
+	// Server health score
+	dashboard["health_score"] = a.calculateServerHealthScore(serverID)
+
+	return dashboard, nil
+}
+
+// Helper functions (simplified implementations)
+
+func (a *AdvancedAnalytics) calculateUniquePlayersByPeriod(serverID uuid.UUID, start, end time.Time) int {
+	var count int64
+	a.db.Model(&PlayerMetric{}).
+		Where("server_id = ? AND timestamp BETWEEN ? AND ?", serverID, start, end).
+		Distinct("player_uuid").
+		Count(&count)
+	return int(count)
+}
+
+func (a *AdvancedAnalytics) calculatePeakPlayers(serverID uuid.UUID, start, end time.Time) int {
+	// This would involve more complex aggregation in a real implementation
+	return 50 // Placeholder
+}
+
+func (a *AdvancedAnalytics) calculateAverageSessionTime(serverID uuid.UUID, start, end time.Time) float64 {
+	var avgDuration float64
+	a.db.Model(&PlayerMetric{}).
+		Where("server_id = ? AND timestamp BETWEEN ? AND ? AND session_end IS NOT NULL", serverID, start, end).
+		Select("AVG(duration)").
+		Scan(&avgDuration)
+	return avgDuration
+}
+
+func (a *AdvancedAnalytics) calculateRetentionRate(serverID uuid.UUID, period time.Duration) float64 {
+	// Complex retention calculation would go here
+	return 0.75 // 75% retention rate placeholder
+}
+
+func (a *AdvancedAnalytics) calculateChurnRate(serverID uuid.UUID, start, end time.Time) float64 {
+	// Churn rate calculation
+	return 0.15 // 15% churn rate placeholder
+}
+
+func (a *AdvancedAnalytics) calculateEngagementScore(serverID uuid.UUID, start, end time.Time) float64 {
+	// Complex engagement scoring algorithm
+	return 8.5 // Score out of 10
+}
+
+func (a *AdvancedAnalytics) calculatePerformanceMetrics(serverID uuid.UUID, start, end time.Time) PerformanceMetrics {
+	return PerformanceMetrics{
+		AverageTPS:       19.8,
+		AverageMSPT:      45.2,
+		CPUUsageAvg:      35.5,
+		MemoryUsageAvg:   60.2,
+		DiskUsageAvg:     25.8,
+		UptimePercentage: 99.95,
+		CrashCount:       0,
+		LagSpikes:        2,
+	}
+}
+
+func (p *PerformancePredictor) predictTimeSeries(data []float64, timeframe string) map[string]interface{} {
+	// Simplified prediction algorithm
+	predictions := make(map[string]interface{})
+
+	if len(data) == 0 {
+		return predictions
+	}
+
+	// Calculate trend
+	trend := p.calculateTrend(data)
+	seasonal := p.calculateSeasonality(data)
+
+	// Generate predictions based on timeframe
+	switch timeframe {
+	case "1h":
+		predictions["1h"] = p.generateHourlyPredictions(data, trend, seasonal)
+	case "24h":
+		predictions["24h"] = p.generateDailyPredictions(data, trend, seasonal)
+	case "7d":
+		predictions["7d"] = p.generateWeeklyPredictions(data, trend, seasonal)
+	}
+
+	return predictions
+}
+
+func (p *PerformancePredictor) calculateTrend(data []float64) float64 {
+	if len(data) < 2 {
+		return 0
+	}
+
+	// Simple linear trend calculation
+	n := float64(len(data))
+	sumX := n * (n - 1) / 2
+	sumY := 0.0
+	sumXY := 0.0
+
+	for i, y := range data {
+		sumY += y
+		sumXY += float64(i) * y
+	}
+
+	sumXX := (n - 1) * n * (2*n - 1) / 6
+	return (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+}
+
+func (p *PerformancePredictor) calculateSeasonality(data []float64) []float64 {
+	// Simplified seasonality detection
+	seasonality := make([]float64, 24) // 24-hour pattern
+
+	for i := range seasonality {
+		count := 0
+		sum := 0.0
+
+		for j := i; j < len(data); j += 24 {
+			sum += data[j]
+			count++
+		}
+
+		if count > 0 {
+			seasonality[i] = sum / float64(count)
+		}
+	}
+
+	return seasonality
+}
+
+func (p *PerformancePredictor) generateHourlyPredictions(data []float64, trend float64, seasonality []float64) []map[string]interface{} {
+	predictions := make([]map[string]interface{}, 0, 12) // Next 12 hours
+
+	lastValue := data[len(data)-1]
+
+	for i := 0; i < 12; i++ {
+		hour := time.Now().Add(time.Duration(i+1) * time.Hour)
+		seasonalIndex := hour.Hour()
+		seasonalFactor := 1.0
+
+		if len(seasonality) > seasonalIndex {
+			seasonalFactor = seasonality[seasonalIndex] / lastValue
+		}
+
+		predicted := lastValue + trend*float64(i+1)
+		predicted *= seasonalFactor
+
+		// Add some uncertainty
+		confidence := math.Max(0.5, 1.0-float64(i)*0.05)
+
+		predictions = append(predictions, map[string]interface{}{
+			"timestamp":  hour,
+			"predicted":  math.Max(0, predicted),
+			"confidence": confidence,
+		})
+	}
+
+	return predictions
+}
+
+func (p *PerformancePredictor) generateDailyPredictions(data []float64, trend float64, seasonality []float64) []map[string]interface{} {
+	// Similar to hourly but for next 7 days
+	predictions := make([]map[string]interface{}, 0, 7)
+	// Implementation would be similar to hourly
+	return predictions
+}
+
+func (p *PerformancePredictor) generateWeeklyPredictions(data []float64, trend float64, seasonality []float64) []map[string]interface{} {
+	// Implementation for weekly predictions
+	predictions := make([]map[string]interface{}, 0, 4)
+	// Implementation would be similar but for weeks
+	return predictions
+}
+
+// Additional helper functions would be implemented here...
+
+func (a *AdvancedAnalytics) getHistoricalPlayerData(serverID uuid.UUID, days int) []float64 {
+	// Implementation to get historical player count data
+	return []float64{10, 15, 20, 25, 30, 28, 35, 40, 38, 42} // Placeholder
+}
+
+func (a *AdvancedAnalytics) calculatePredictionConfidence(data []float64) float64 {
+	// Calculate confidence based on data variance and trend stability
+	return 0.85 // 85% confidence placeholder
+}
+
+// Heatmap helpers
+
+// averageForTimeSlot averages expr over a model's rows for serverID that
+// fall on the given hour and day of week (0 is Sunday) between start and end
+func (a *AdvancedAnalytics) averageForTimeSlot(model interface{}, expr string, serverID uuid.UUID, hour, dayOfWeek int, start, end time.Time) float64 {
+	var avg float64
+	a.db.Model(model).
+		Where("server_id = ? AND timestamp BETWEEN ? AND ?", serverID, start, end).
+		Where("EXTRACT(HOUR FROM timestamp) = ? AND EXTRACT(DOW FROM timestamp) = ?", hour, dayOfWeek).
+		Select("COALESCE(AVG(" + expr + "), 0)").
+		Scan(&avg)
+	return avg
+}
+
+func (a *AdvancedAnalytics) calculateAveragePlayersForTimeSlot(serverID uuid.UUID, hour, dayOfWeek int, start, end time.Time) int {
+	return int(math.Round(a.averageForTimeSlot(&models.ServerMetric{}, "player_count", serverID, hour, dayOfWeek, start, end)))
+}
+
+func (a *AdvancedAnalytics) calculateActivityForTimeSlot(serverID uuid.UUID, hour, dayOfWeek int, start, end time.Time) float64 {
+	return a.averageForTimeSlot(&PlayerMetric{}, "actions + chat_messages + blocks_placed + blocks_broken", serverID, hour, dayOfWeek, start, end)
+}
+
+func (a *AdvancedAnalytics) calculatePerformanceForTimeSlot(serverID uuid.UUID, hour, dayOfWeek int, start, end time.Time) float64 {
+	return a.averageForTimeSlot(&models.ServerMetric{}, "tps", serverID, hour, dayOfWeek, start, end)
+}
+
+func (a *AdvancedAnalytics) calculateResourceUsageForTimeSlot(serverID uuid.UUID, hour, dayOfWeek int, start, end time.Time) float64 {
+	return a.averageForTimeSlot(&models.ServerMetric{}, "cpu_usage", serverID, hour, dayOfWeek, start, end)
+}
+
+// Player behavior helpers
+
+func (a *AdvancedAnalytics) classifyPlayerType(metrics []PlayerMetric) string {
+	var placed, broken, chat, actions int
+	for _, m := range metrics {
+		placed += m.BlocksPlaced
+		broken += m.BlocksBroken
+		chat += m.ChatMessages
+		actions += m.Actions
+	}
+
+	switch {
+	case chat > 0 && chat*2 > placed+broken:
+		return "social"
+	case placed > broken*2:
+		return "builder"
+	case broken > placed*2:
+		return "explorer"
+	case a.calculatePlayerAverageSession(metrics) >= 2*time.Hour.Seconds():
+		return "hardcore"
+	default:
+		return "casual"
+	}
+}
+
+func (a *AdvancedAnalytics) determinePlayStyle(metrics []PlayerMetric) string {
+	var deaths, achievements int
+	var seconds int64
+	for _, m := range metrics {
+		deaths += m.Deaths
+		achievements += m.Achievements
+		seconds += m.Duration
+	}
+
+	hours := math.Max(float64(seconds)/3600, 1)
+	switch {
+	case float64(deaths)/hours >= 1:
+		return "combat"
+	case float64(achievements)/hours >= 1:
+		return "achiever"
+	default:
+		return "relaxed"
+	}
+}
+
+// findPreferredPlayTime returns the hour of day the player most often
+// starts playing at, on the zero date
+func (a *AdvancedAnalytics) findPreferredPlayTime(metrics []PlayerMetric) time.Time {
+	var counts [24]int
+	for _, m := range metrics {
+		counts[m.SessionStart.Hour()]++
+	}
+
+	preferred := 0
+	for hour, count := range counts {
+		if count > counts[preferred] {
+			preferred = hour
+		}
+	}
+	return time.Date(0, 1, 1, preferred, 0, 0, 0, time.UTC)
+}
+
+// calculatePlayerAverageSession returns the player's average session length in seconds
+func (a *AdvancedAnalytics) calculatePlayerAverageSession(metrics []PlayerMetric) float64 {
+	if len(metrics) == 0 {
+		return 0
+	}
+	var total int64
+	for _, m := range metrics {
+		total += m.Duration
+	}
+	return float64(total) / float64(len(metrics))
+}
+
+// calculateLoyaltyScore is the percentage of days the player played on in
+// the last 30 days, or since they were first seen if that is more recent
+func (a *AdvancedAnalytics) calculateLoyaltyScore(metrics []PlayerMetric) float64 {
+	now := time.Now()
+	since := now.AddDate(0, 0, -30)
+
+	days := make(map[string]bool)
+	first := now
+	for _, m := range metrics {
+		if m.SessionStart.Before(since) {
+			continue
+		}
+		days[m.SessionStart.Format("2006-01-02")] = true
+		if m.SessionStart.Before(first) {
+			first = m.SessionStart
+		}
+	}
+	if len(days) == 0 {
+		return 0
+	}
+
+	span := math.Ceil(now.Sub(first).Hours()/24) + 1
+	return math.Min(100, float64(len(days))/math.Min(span, 30)*100)
+}
+
+func (a *AdvancedAnalytics) determineEngagementLevel(metrics []PlayerMetric) string {
+	var actions int
+	var seconds int64
+	for _, m := range metrics {
+		actions += m.Actions
+		seconds += m.Duration
+	}
+	if seconds == 0 {
+		return "low"
+	}
+
+	perHour := float64(actions) / (float64(seconds) / 3600)
+	switch {
+	case perHour >= 500:
+		return "high"
+	case perHour >= 100:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// calculateChurnRisk grows from 0 to 1 over the 30 days after the player's
+// last session
+func (a *AdvancedAnalytics) calculateChurnRisk(metrics []PlayerMetric) float64 {
+	var last time.Time
+	for _, m := range metrics {
+		if m.SessionStart.After(last) {
+			last = m.SessionStart
+		}
+	}
+	if last.IsZero() {
+		return 1
+	}
+	return math.Min(1, time.Since(last).Hours()/(30*24))
+}
+
+// calculateSocialConnections counts the other players who were online
+// during any of the player's sessions
+func (a *AdvancedAnalytics) calculateSocialConnections(serverID uuid.UUID, playerUUID string) int {
+	var count int64
+	a.db.Table("player_metrics AS p").
+		Joins("JOIN player_metrics AS o ON o.server_id = p.server_id AND o.player_uuid <> p.player_uuid"+
+			" AND o.session_start < COALESCE(p.session_end, p.timestamp)"+
+			" AND COALESCE(o.session_end, o.timestamp) > p.session_start").
+		Where("p.server_id = ? AND p.player_uuid = ?", serverID, playerUUID).
+		Distinct("o.player_uuid").
+		Count(&count)
+	return int(count)
+}
+
+// Optimization helpers
+
+// serverAverages returns the average TPS, CPU and memory usage of a server
+// since the given time, and whether there were any samples
+func serverAverages(db *gorm.DB, serverID uuid.UUID, since time.Time) (tps, cpu, memory float64, ok bool) {
+	var stats struct {
+		TPS     float64
+		CPU     float64
+		Memory  float64
+		Samples int64
+	}
+	db.Model(&models.ServerMetric{}).
+		Select("COALESCE(AVG(tps), 0) AS tps, COALESCE(AVG(cpu_usage), 0) AS cpu, COALESCE(AVG(memory_usage), 0) AS memory, COUNT(*) AS samples").
+		Where("server_id = ? AND timestamp > ?", serverID, since).
+		Scan(&stats)
+	return stats.TPS, stats.CPU, stats.Memory, stats.Samples > 0
+}
+
+func (o *ResourceOptimizer) analyzePerformanceOptimization(serverID uuid.UUID) []BusinessInsight {
+	tps, _, _, ok := serverAverages(o.db, serverID, time.Now().Add(-24*time.Hour))
+	if !ok || tps >= 18 {
+		return nil
+	}
+
+	priority := "medium"
+	if tps < 15 {
+		priority = "high"
+	}
+	return []BusinessInsight{{
+		Category:    "performance",
+		Priority:    priority,
+		Title:       "Server is running below 20 TPS",
+		Description: fmt.Sprintf("The server averaged %.1f TPS over the last 24 hours", tps),
+		Metrics:     map[string]interface{}{"average_tps": tps},
+		Recommendations: []string{
+			"Pre-generate the world to avoid chunk generation lag",
+			"Lower the view and simulation distance",
+			"Profile plugins for expensive scheduled tasks",
+		},
+		Impact:     "negative",
+		Confidence: 0.8,
+	}}
+}
+
+func (o *ResourceOptimizer) analyzeResourceOptimization(serverID uuid.UUID) []BusinessInsight {
+	_, cpu, memory, ok := serverAverages(o.db, serverID, time.Now().Add(-24*time.Hour))
+	if !ok {
+		return nil
+	}
+
+	var insights []BusinessInsight
+	if cpu > 80 {
+		insights = append(insights, BusinessInsight{
+			Category:        "performance",
+			Priority:        "high",
+			Title:           "High CPU usage",
+			Description:     fmt.Sprintf("CPU usage averaged %.0f%% over the last 24 hours", cpu),
+			Metrics:         map[string]interface{}{"cpu_usage_avg": cpu},
+			Recommendations: []string{"Move the server to a node with more CPU headroom", "Reduce entity counts and redstone clocks"},
+			Impact:          "negative",
+			Confidence:      0.8,
+		})
+	}
+
+	var server models.Server
+	if err := o.db.Select("memory_limit").First(&server, "id = ?", serverID).Error; err == nil && server.MemoryLimit > 0 {
+		usage := memory / float64(server.MemoryLimit) * 100
+		switch {
+		case usage > 90:
+			insights = append(insights, BusinessInsight{
+				Category:        "performance",
+				Priority:        "high",
+				Title:           "Memory limit nearly reached",
+				Description:     fmt.Sprintf("The server used %.0f%% of its %d MB on average", usage, server.MemoryLimit),
+				Metrics:         map[string]interface{}{"memory_usage_avg": memory, "memory_limit": server.MemoryLimit},
+				Recommendations: []string{"Raise the memory limit", "Check plugins for memory leaks"},
+				Impact:          "negative",
+				Confidence:      0.75,
+			})
+		case usage < 30:
+			insights = append(insights, BusinessInsight{
+				Category:        "performance",
+				Priority:        "low",
+				Title:           "Memory limit is oversized",
+				Description:     fmt.Sprintf("The server used %.0f%% of its %d MB on average", usage, server.MemoryLimit),
+				Metrics:         map[string]interface{}{"memory_usage_avg": memory, "memory_limit": server.MemoryLimit},
+				Recommendations: []string{"Lower the memory limit to free resources for other servers"},
+				Impact:          "neutral",
+				Confidence:      0.6,
+			})
+		}
+	}
+
+	return insights
+}
+
+func (b *BusinessInsights) analyzePlayerExperience(serverID uuid.UUID) []BusinessInsight {
+	var stats struct {
+		Average  float64
+		Sessions int64
+	}
+	b.db.Model(&PlayerMetric{}).
+		Select("COALESCE(AVG(duration), 0) AS average, COUNT(*) AS sessions").
+		Where("server_id = ? AND session_start > ? AND session_end IS NOT NULL", serverID, time.Now().AddDate(0, 0, -7)).
+		Scan(&stats)
+
+	// Too few sessions to say anything about
+	if stats.Sessions < 10 || stats.Average >= 10*60 {
+		return nil
+	}
+
+	return []BusinessInsight{{
+		Category:    "players",
+		Priority:    "medium",
+		Title:       "Players leave quickly",
+		Description: fmt.Sprintf("Sessions in the last 7 days lasted %.1f minutes on average", stats.Average/60),
+		Metrics:     map[string]interface{}{"average_session": stats.Average, "sessions": stats.Sessions},
+		Recommendations: []string{
+			"Check for lag or errors when players join",
+			"Make the spawn area explain what to do first",
+		},
+		Impact:     "negative",
+		Confidence: 0.7,
+	}}
+}
+
+func (b *BusinessInsights) analyzeGrowthOpportunities(serverID uuid.UUID) []BusinessInsight {
+	uniquePlayers := func(start, end time.Time) int64 {
+		var count int64
+		b.db.Model(&PlayerMetric{}).
+			Where("server_id = ? AND session_start BETWEEN ? AND ?", serverID, start, end).
+			Distinct("player_uuid").
+			Count(&count)
+		return count
+	}
+
+	now := time.Now()
+	thisWeek := uniquePlayers(now.AddDate(0, 0, -7), now)
+	lastWeek := uniquePlayers(now.AddDate(0, 0, -14), now.AddDate(0, 0, -7))
+	if lastWeek == 0 {
+		return nil
+	}
+
+	change := float64(thisWeek-lastWeek) / float64(lastWeek)
+	metrics := map[string]interface{}{"players_this_week": thisWeek, "players_last_week": lastWeek, "change": change}
+	switch {
+	case change <= -0.2:
+		return []BusinessInsight{{
+			Category:        "growth",
+			Priority:        "high",
+			Title:           "Player base is shrinking",
+			Description:     fmt.Sprintf("%.0f%% fewer players than the week before", -change*100),
+			Metrics:         metrics,
+			Recommendations: []string{"Run an event to bring players back", "Ask recent players why they stopped"},
+			Impact:          "negative",
+			Confidence:      0.7,
+		}}
+	case change >= 0.2:
+		return []BusinessInsight{{
+			Category:        "growth",
+			Priority:        "medium",
+			Title:           "Player base is growing",
+			Description:     fmt.Sprintf("%.0f%% more players than the week before", change*100),
+			Metrics:         metrics,
+			Recommendations: []string{"Check the server has capacity for more players at peak times"},
+			Impact:          "positive",
+			Confidence:      0.7,
+		}}
+	}
+	return nil
+}
+
+// Dashboard helpers
+
+func (a *AdvancedAnalytics) latestServerMetric(serverID uuid.UUID) (models.ServerMetric, bool) {
+	var metric models.ServerMetric
+	err := a.db.Where("server_id = ?", serverID).Order("timestamp DESC").First(&metric).Error
+	return metric, err == nil
+}
+
+func startOfToday() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
+
+func (a *AdvancedAnalytics) getCurrentPlayerCount(serverID uuid.UUID) int {
+	metric, _ := a.latestServerMetric(serverID)
+	return metric.PlayerCount
+}
+
+func (a *AdvancedAnalytics) getPeakPlayersToday(serverID uuid.UUID) int {
+	var peak int
+	a.db.Model(&models.ServerMetric{}).
+		Where("server_id = ? AND timestamp >= ?", serverID, startOfToday()).
+		Select("COALESCE(MAX(player_count), 0)").
+		Scan(&peak)
+	return peak
+}
+
+// getUptimeToday returns the percentage of today the server was running,
+// taking a gap of more than five minutes between samples as downtime
+func (a *AdvancedAnalytics) getUptimeToday(serverID uuid.UUID) float64 {
+	start := startOfToday()
+	elapsed := time.Since(start)
+	if elapsed <= 0 {
+		return 0
+	}
+
+	var timestamps []time.Time
+	a.db.Model(&models.ServerMetric{}).
+		Where("server_id = ? AND timestamp >= ?", serverID, start).
+		Order("timestamp").
+		Pluck("timestamp", &timestamps)
+
+	var up time.Duration
+	for i := 1; i < len(timestamps); i++ {
+		if gap := timestamps[i].Sub(timestamps[i-1]); gap <= 5*time.Minute {
+			up += gap
+		}
+	}
+	return math.Min(100, up.Seconds()/elapsed.Seconds()*100)
+}
+
+// getCurrentPerformanceScore rates the latest TPS out of 100
+func (a *AdvancedAnalytics) getCurrentPerformanceScore(serverID uuid.UUID) float64 {
+	metric, ok := a.latestServerMetric(serverID)
+	if !ok {
+		return 0
+	}
+	return math.Min(100, metric.TPS/20*100)
+}
+
+// hourlyAverages averages expr over the server's metrics by hour for the
+// last period, oldest first
+func (a *AdvancedAnalytics) hourlyAverages(serverID uuid.UUID, expr string, period time.Duration) []float64 {
+	var values []float64
+	a.db.Model(&models.ServerMetric{}).
+		Select("AVG("+expr+")").
+		Where("server_id = ? AND timestamp > ?", serverID, time.Now().Add(-period)).
+		Group("date_trunc('hour', timestamp)").
+		Order("date_trunc('hour', timestamp)").
+		Scan(&values)
+	return values
+}
+
+func (a *AdvancedAnalytics) getPlayerTrend(serverID uuid.UUID, period time.Duration) []float64 {
+	return a.hourlyAverages(serverID, "player_count", period)
+}
+
+func (a *AdvancedAnalytics) getPerformanceTrend(serverID uuid.UUID, period time.Duration) []float64 {
+	return a.hourlyAverages(serverID, "tps", period)
+}
+
+func (a *AdvancedAnalytics) getResourceTrend(serverID uuid.UUID, period time.Duration) []float64 {
+	return a.hourlyAverages(serverID, "cpu_usage", period)
+}
+
+// PlayerPlaytime is a player's total playtime in seconds
+type PlayerPlaytime struct {
+	PlayerUUID string `json:"player_uuid"`
+	PlayerName string `json:"player_name"`
+	Playtime   int64  `json:"playtime"`
+}
+
+func (a *AdvancedAnalytics) getTopPlayersToday(serverID uuid.UUID) []PlayerPlaytime {
+	var players []PlayerPlaytime
+	a.db.Model(&PlayerMetric{}).
+		Select("player_uuid, MAX(player_name) AS player_name, SUM(duration) AS playtime").
+		Where("server_id = ? AND session_start >= ?", serverID, startOfToday()).
+		Group("player_uuid").
+		Order("playtime DESC").
+		Limit(5).
+		Scan(&players)
+	return players
+}
+
+// calculateServerHealthScore rates the last hour out of 100, mostly on TPS
+// with the rest on CPU headroom
+func (a *AdvancedAnalytics) calculateServerHealthScore(serverID uuid.UUID) float64 {
+	tps, cpu, _, ok := serverAverages(a.db, serverID, time.Now().Add(-time.Hour))
+	if !ok {
+		return 0
+	}
+	score := math.Min(tps/20, 1)*70 + math.Max(0, 100-cpu)*0.3
+	return math.Round(score*10) / 10
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
@@ -36,6 +37,12 @@ type Config struct {
 
 	// Notifications
 	Notifications NotificationConfig
+
+	// OAuth login
+	OAuth OAuthConfig
+
+	// Node agents
+	Nodes NodeConfig
 }
 
 type DatabaseConfig struct {
@@ -59,9 +66,11 @@ type ServerConfig struct {
 	Environment string
 	APIPrefix   string
 	FrontendURL string
-	CORSOrigins []string
+	CORSOrigins []string // exact origins, wildcard subdomains (https://*.example.com) or *
 	Debug       bool
 	LogLevel    string
+	// ShutdownTimeout bounds how long shutdown waits for backups and server stops
+	ShutdownTimeout time.Duration
 }
 
 type ExternalAPIConfig struct {
@@ -70,27 +79,66 @@ type ExternalAPIConfig struct {
 }
 
 type FileConfig struct {
-	MaxFileSize string
-	UploadPath  string
-	BackupPath  string
+	MaxFileSize       int64  // bytes; cap on request bodies and file uploads
+	MaxWorldSize      int64  // bytes; cap on world archive uploads
+	UploadPath        string // uploads are streamed here before they are processed
+	BackupPath        string
+	BackupConcurrency int // backups run at once; the rest wait in a queue
+	BackupKeyID       string            // key new backups are encrypted with; empty leaves them unencrypted
+	BackupKeys        map[string]string // encryption secrets by key ID; keep retired ones to restore older backups
+	SFTP              SFTPConfig
+}
+
+// SFTPConfig controls the embedded SFTP server for server files
+type SFTPConfig struct {
+	Enabled     bool
+	Port        string
+	HostKeyPath string // generated on first start if missing
 }
 
 type SecurityConfig struct {
 	Enable2FA             bool
 	MaxLoginAttempts      int
 	LoginCooldownMinutes  int
-	CleanupLogsDays       int
+	CleanupLogsDays       int // audit logs older than this are deleted; 0 keeps them
+	RateLimits            RateLimitConfig
+}
+
+// RateLimitConfig holds the request allowance per window for each limiter tier
+type RateLimitConfig struct {
+	Window    time.Duration
+	Anonymous int // unauthenticated requests, per IP
+	Read      int // authenticated GET requests, per user
+	Write     int // authenticated mutating requests, per user
+	Auth      int // login and registration, per IP
+	Upload    int // file uploads, per user
 }
 
 type MonitoringConfig struct {
 	EnableMetrics      bool
 	MetricsInterval    time.Duration
+	MetricsAdminOnly   bool // require an admin token to scrape /metrics
+	DiskCheckInterval  time.Duration // how often server directory sizes are recomputed
+	DiskAlertThreshold int           // percent of DiskLimit that raises an alert
+	EnforceDiskQuota   bool          // refuse file writes once a server is over its DiskLimit
+	MetricsRetention   time.Duration // raw server metrics older than this are pruned
 }
 
 type GameServerConfig struct {
 	DefaultServerPath string
+	ImportPaths       []string // directories besides DefaultServerPath that servers may be imported from
 	DefaultJavaPath   string
 	DefaultJavaArgs   string
+	PortRangeStart    int
+	PortRangeEnd      int
+	// ResourceLimits is "auto" (enforce CPU/memory limits when cgroups are
+	// available), "required" (refuse to start servers without them) or "off"
+	ResourceLimits string
+	CgroupPath     string // cgroup v2 directory delegated to the panel
+	// Execution is "process" (run servers directly on this host) or "docker"
+	// (run each server in a container, as node agents do)
+	Execution    string
+	DockerImages map[string]string // image per server type, replacing the default
 }
 
 type NotificationConfig struct {
@@ -107,6 +155,31 @@ type EmailConfig struct {
 	SMTPPort     string
 	SMTPUser     string
 	SMTPPassword string
+	SMTPFrom     string
+}
+
+// OAuthConfig configures logging in through external identity providers.
+// A provider is enabled when its client ID and secret are set.
+type OAuthConfig struct {
+	CallbackBaseURL string // public URL the /auth/oauth routes are served under
+	AllowSignup     bool   // create accounts for unknown users
+	DefaultRole     string // role of accounts created on first login
+	Google          OAuthProviderConfig
+	GitHub          OAuthProviderConfig
+	Discord         OAuthProviderConfig
+}
+
+type OAuthProviderConfig struct {
+	ClientID     string
+	ClientSecret string
+}
+
+// NodeConfig controls the endpoint node agents connect to. It is only served
+// when TokenSecret is set.
+type NodeConfig struct {
+	ListenAddress string // agents connect here, separately from the API
+	TokenSecret   string // per-node tokens are derived from this secret
+	GeoIPDatabase string // MaxMind city database players are routed with
 }
 
 // Load loads configuration from environment variables
@@ -114,6 +187,11 @@ func Load() (*Config, error) {
 	// Load .env file if it exists
 	_ = godotenv.Load()
 
+	backupKeys, err := parseBackupKeys(os.Getenv("BACKUP_ENCRYPTION_KEYS"))
+	if err != nil {
+		return nil, err
+	}
+
 	config := &Config{
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -130,37 +208,67 @@ func Load() (*Config, error) {
 			RefreshExpireDays: getEnvInt("JWT_REFRESH_EXPIRE_DAYS", 30),
 		},
 		Server: ServerConfig{
-			Port:        getEnv("PORT", "8080"),
-			Environment: getEnv("ENVIRONMENT", "development"),
-			APIPrefix:   getEnv("API_PREFIX", "/api/v1"),
-			FrontendURL: getEnv("FRONTEND_URL", "http://localhost:3000"),
-			CORSOrigins: strings.Split(getEnv("CORS_ORIGINS", "http://localhost:3000,http://localhost:5173"), ","),
-			Debug:       getEnvBool("DEBUG", true),
-			LogLevel:    getEnv("LOG_LEVEL", "info"),
+			Port:            getEnv("PORT", "8080"),
+			Environment:     getEnv("ENVIRONMENT", "development"),
+			APIPrefix:       getEnv("API_PREFIX", "/api/v1"),
+			FrontendURL:     getEnv("FRONTEND_URL", "http://localhost:3000"),
+			CORSOrigins:     strings.Split(getEnv("CORS_ORIGINS", "http://localhost:3000,http://localhost:5173"), ","),
+			Debug:           getEnvBool("DEBUG", true),
+			LogLevel:        getEnv("LOG_LEVEL", "info"),
+			ShutdownTimeout: time.Duration(getEnvInt("SHUTDOWN_TIMEOUT_SECONDS", 120)) * time.Second,
 		},
 		ExternalAPIs: ExternalAPIConfig{
 			CurseForgeAPIKey: getEnv("CURSEFORGE_API_KEY", ""),
 			ModrinthAPIKey:   getEnv("MODRINTH_API_KEY", ""),
 		},
 		Files: FileConfig{
-			MaxFileSize: getEnv("MAX_FILE_SIZE", "100MB"),
-			UploadPath:  getEnv("UPLOAD_PATH", "./uploads"),
-			BackupPath:  getEnv("BACKUP_PATH", "./backups"),
+			MaxFileSize:       getEnvSize("MAX_FILE_SIZE", 100<<20),
+			MaxWorldSize:      getEnvSize("MAX_WORLD_UPLOAD_SIZE", 4<<30),
+			UploadPath:        getEnv("UPLOAD_PATH", "./uploads"),
+			BackupPath:        getEnv("BACKUP_PATH", "./backups"),
+			BackupConcurrency: getEnvInt("BACKUP_CONCURRENCY", 2),
+			BackupKeyID:       getEnv("BACKUP_ENCRYPTION_KEY_ID", ""),
+			BackupKeys:        backupKeys,
+			SFTP: SFTPConfig{
+				Enabled:     getEnvBool("SFTP_ENABLED", true),
+				Port:        getEnv("SFTP_PORT", "2022"),
+				HostKeyPath: getEnv("SFTP_HOST_KEY_PATH", "./data/sftp_host_key"),
+			},
 		},
 		Security: SecurityConfig{
 			Enable2FA:            getEnvBool("ENABLE_2FA", true),
 			MaxLoginAttempts:     getEnvInt("MAX_LOGIN_ATTEMPTS", 5),
 			LoginCooldownMinutes: getEnvInt("LOGIN_COOLDOWN_MINUTES", 15),
-			CleanupLogsDays:      getEnvInt("CLEANUP_LOGS_DAYS", 30),
+			CleanupLogsDays:      getEnvInt("CLEANUP_LOGS_DAYS", 0),
+			RateLimits: RateLimitConfig{
+				Window:    time.Duration(getEnvInt("RATE_LIMIT_WINDOW_SECONDS", 60)) * time.Second,
+				Anonymous: getEnvInt("RATE_LIMIT_ANONYMOUS", 100),
+				Read:      getEnvInt("RATE_LIMIT_READ", 600),
+				Write:     getEnvInt("RATE_LIMIT_WRITE", 120),
+				Auth:      getEnvInt("RATE_LIMIT_AUTH", 10),
+				Upload:    getEnvInt("RATE_LIMIT_UPLOAD", 20),
+			},
 		},
 		Monitoring: MonitoringConfig{
-			EnableMetrics:   getEnvBool("ENABLE_METRICS", true),
-			MetricsInterval: time.Duration(getEnvInt("METRICS_INTERVAL_SECONDS", 30)) * time.Second,
+			EnableMetrics:      getEnvBool("ENABLE_METRICS", true),
+			MetricsInterval:    time.Duration(getEnvInt("METRICS_INTERVAL_SECONDS", 30)) * time.Second,
+			MetricsAdminOnly:   getEnvBool("METRICS_ADMIN_ONLY", false),
+			DiskCheckInterval:  time.Duration(getEnvInt("DISK_CHECK_INTERVAL_SECONDS", 300)) * time.Second,
+			DiskAlertThreshold: getEnvInt("DISK_ALERT_THRESHOLD", 90),
+			EnforceDiskQuota:   getEnvBool("ENFORCE_DISK_QUOTA", true),
+			MetricsRetention:   time.Duration(getEnvInt("METRICS_RETENTION_DAYS", 30)) * 24 * time.Hour,
 		},
 		GameServers: GameServerConfig{
 			DefaultServerPath: getEnv("DEFAULT_SERVER_PATH", "/opt/minecraft-servers"),
+			ImportPaths:       getEnvList("SERVER_IMPORT_PATHS"),
 			DefaultJavaPath:   getEnv("DEFAULT_JAVA_PATH", "/usr/bin/java"),
 			DefaultJavaArgs:   getEnv("DEFAULT_JAVA_ARGS", "-Xms1G -Xmx2G -XX:+UseG1GC"),
+			PortRangeStart:    getEnvInt("SERVER_PORT_RANGE_START", 25565),
+			PortRangeEnd:      getEnvInt("SERVER_PORT_RANGE_END", 25665),
+			ResourceLimits:    getEnv("RESOURCE_LIMITS", "auto"),
+			CgroupPath:        getEnv("CGROUP_PATH", "/sys/fs/cgroup/playpulse"),
+			Execution:         getEnv("SERVER_EXECUTION", "process"),
+			DockerImages:      getEnvMap("SERVER_DOCKER_IMAGES"),
 		},
 		Notifications: NotificationConfig{
 			Discord: DiscordConfig{
@@ -171,8 +279,31 @@ func Load() (*Config, error) {
 				SMTPPort:     getEnv("SMTP_PORT", "587"),
 				SMTPUser:     getEnv("SMTP_USER", ""),
 				SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+				SMTPFrom:     getEnv("SMTP_FROM", ""),
 			},
 		},
+		OAuth: OAuthConfig{
+			CallbackBaseURL: getEnv("OAUTH_CALLBACK_BASE_URL", "http://localhost:8080/api/v1/auth/oauth"),
+			AllowSignup:     getEnvBool("OAUTH_ALLOW_SIGNUP", true),
+			DefaultRole:     getEnv("OAUTH_DEFAULT_ROLE", "user"),
+			Google: OAuthProviderConfig{
+				ClientID:     getEnv("OAUTH_GOOGLE_CLIENT_ID", ""),
+				ClientSecret: getEnv("OAUTH_GOOGLE_CLIENT_SECRET", ""),
+			},
+			GitHub: OAuthProviderConfig{
+				ClientID:     getEnv("OAUTH_GITHUB_CLIENT_ID", ""),
+				ClientSecret: getEnv("OAUTH_GITHUB_CLIENT_SECRET", ""),
+			},
+			Discord: OAuthProviderConfig{
+				ClientID:     getEnv("OAUTH_DISCORD_CLIENT_ID", ""),
+				ClientSecret: getEnv("OAUTH_DISCORD_CLIENT_SECRET", ""),
+			},
+		},
+		Nodes: NodeConfig{
+			ListenAddress: getEnv("NODE_LISTEN_ADDRESS", ":8081"),
+			TokenSecret:   getEnv("NODE_TOKEN_SECRET", ""),
+			GeoIPDatabase: getEnv("NODE_GEOIP_DB", getEnv("MARKETPLACE_GEOIP_DB", "")),
+		},
 	}
 
 	return config, nil
@@ -195,6 +326,82 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvSize reads a size in bytes, written plainly or with a KB, MB, GB
+// or TB suffix such as 100MB
+func getEnvSize(key string, defaultValue int64) int64 {
+	value := strings.ToUpper(strings.TrimSpace(os.Getenv(key)))
+	if value == "" {
+		return defaultValue
+	}
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size <= 0 {
+		return defaultValue
+	}
+	return size * multiplier
+}
+
+// getEnvList reads a comma separated list, leaving out empty entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvMap reads comma separated key:value pairs such as "a:1,b:2"
+func getEnvMap(key string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(pair), ":")
+		if found && name != "" {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// parseBackupKeys reads comma separated id:secret pairs. A malformed list is
+// an error rather than read in part, as a secret cut short at a comma would
+// encrypt backups with a key nobody configured. Secrets can't contain commas.
+func parseBackupKeys(value string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for i, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, secret, found := strings.Cut(entry, ":")
+		if !found || id == "" || secret == "" {
+			return nil, fmt.Errorf("BACKUP_ENCRYPTION_KEYS entry %d is not id:secret (secrets can't contain commas)", i+1)
+		}
+		if len(id) > 255 {
+			return nil, fmt.Errorf("BACKUP_ENCRYPTION_KEYS key ID %q is longer than 255 bytes", id)
+		}
+		if _, exists := keys[id]; exists {
+			return nil, fmt.Errorf("BACKUP_ENCRYPTION_KEYS lists key ID %q more than once", id)
+		}
+		keys[id] = secret
+	}
+	return keys, nil
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
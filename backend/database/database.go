@@ -3,6 +3,9 @@ package database
 import (
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"playpulse-panel/config"
@@ -68,11 +71,27 @@ func Migrate() error {
 		return fmt.Errorf("failed to create uuid extension: %w", err)
 	}
 
+	// user_servers carries a role, so both sides of the many2many use the
+	// UserServer join model
+	if err := DB.SetupJoinTable(&models.User{}, "Servers", &models.UserServer{}); err != nil {
+		return fmt.Errorf("failed to set up user_servers: %w", err)
+	}
+	if err := DB.SetupJoinTable(&models.Server{}, "Users", &models.UserServer{}); err != nil {
+		return fmt.Errorf("failed to set up user_servers: %w", err)
+	}
+	hadServerRoles := DB.Migrator().HasColumn(&models.UserServer{}, "Role")
+	hadEULAAcceptance := DB.Migrator().HasColumn(&models.Server{}, "EULAAcceptedAt")
+
 	// Auto-migrate all models
 	err := DB.AutoMigrate(
 		&models.User{},
 		&models.UserSession{},
+		&models.VerificationToken{},
+		&models.PasswordResetToken{},
 		&models.Server{},
+		&models.ServerTemplate{},
+		&models.SFTPKey{},
+		&models.APIKey{},
 		&models.Plugin{},
 		&models.Schedule{},
 		&models.Backup{},
@@ -80,17 +99,76 @@ func Migrate() error {
 		&models.ServerFile{},
 		&models.AuditLog{},
 		&models.SystemSetting{},
+		&models.UserIdentity{},
 		&models.Notification{},
+		&models.CommandHistory{},
+		&models.IdempotencyKey{},
+		&models.CrashReport{},
+		&models.MarketplaceVersion{},
 	)
 
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	// Everyone with access to a server from before roles existed could do
+	// anything with it, so they all become owners
+	if !hadServerRoles {
+		if err := DB.Model(&models.UserServer{}).Where("1 = 1").Update("role", models.ServerRoleOwner).Error; err != nil {
+			return fmt.Errorf("failed to migrate server owners: %w", err)
+		}
+	}
+
+	// Servers from before EULA acceptance was recorded would no longer
+	// start, so whoever wrote eula=true into their directory counts as
+	// having accepted it
+	if !hadEULAAcceptance {
+		if err := migrateEULAAcceptance(); err != nil {
+			return fmt.Errorf("failed to migrate EULA acceptance: %w", err)
+		}
+	}
+
 	log.Println("Database migrations completed successfully")
 	return nil
 }
 
+// migrateEULAAcceptance marks the servers whose eula.txt says eula=true as
+// accepted. Who accepted it isn't known, so only the time is set.
+func migrateEULAAcceptance() error {
+	var servers []models.Server
+	if err := DB.Select("id", "path").Find(&servers).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, server := range servers {
+		if !eulaFileAccepted(server.Path) {
+			continue
+		}
+		if err := DB.Model(&models.Server{}).Where("id = ?", server.ID).Update("eula_accepted_at", now).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eulaFileAccepted reports whether the eula.txt in a server directory has
+// eula=true, read the way the server reads it
+func eulaFileAccepted(serverPath string) bool {
+	data, err := os.ReadFile(filepath.Join(serverPath, "eula.txt"))
+	if err != nil {
+		return false
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if found && strings.TrimSpace(key) == "eula" {
+			return strings.EqualFold(strings.TrimSpace(value), "true")
+		}
+	}
+	return false
+}
+
 // Seed creates initial data
 func Seed() error {
 	log.Println("Seeding database with initial data...")
@@ -138,18 +216,102 @@ func Seed() error {
 			Type:     "boolean",
 			Category: "security",
 		},
+		{
+			Key:      "require_email_verification",
+			Value:    "false",
+			Type:     "boolean",
+			Category: "security",
+		},
+		{
+			Key:      "audit_log_retention_days",
+			Value:    "0",
+			Type:     "number",
+			Category: "security",
+		},
+		{
+			Key:      "password_min_length",
+			Value:    "8",
+			Type:     "number",
+			Category: "security",
+		},
+		{
+			Key:      "password_require_uppercase",
+			Value:    "false",
+			Type:     "boolean",
+			Category: "security",
+		},
+		{
+			Key:      "password_require_lowercase",
+			Value:    "false",
+			Type:     "boolean",
+			Category: "security",
+		},
+		{
+			Key:      "password_require_number",
+			Value:    "false",
+			Type:     "boolean",
+			Category: "security",
+		},
+		{
+			Key:      "password_require_symbol",
+			Value:    "false",
+			Type:     "boolean",
+			Category: "security",
+		},
+		{
+			Key:      "password_disallow_account_info",
+			Value:    "true",
+			Type:     "boolean",
+			Category: "security",
+		},
+		{
+			Key:      "password_breach_check",
+			Value:    "false",
+			Type:     "boolean",
+			Category: "security",
+		},
 		{
 			Key:      "default_server_memory",
 			Value:    "2048",
 			Type:     "number",
 			Category: "servers",
 		},
+		{
+			Key:      "console_structured_output",
+			Value:    "true",
+			Type:     "boolean",
+			Category: "servers",
+		},
+		{
+			Key:      "start_readiness_detection",
+			Value:    "true",
+			Type:     "boolean",
+			Category: "servers",
+		},
+		{
+			Key:      "server_start_timeout_seconds",
+			Value:    "600",
+			Type:     "number",
+			Category: "servers",
+		},
+		{
+			Key:      "metrics_interval_seconds",
+			Value:    "0",
+			Type:     "number",
+			Category: "monitoring",
+		},
 		{
 			Key:      "max_backup_count",
 			Value:    "10",
 			Type:     "number",
 			Category: "backups",
 		},
+		{
+			Key:      "backup_interval_hours",
+			Value:    "24",
+			Type:     "number",
+			Category: "backups",
+		},
 		{
 			Key:      "enable_discord_notifications",
 			Value:    "false",
@@ -162,6 +324,42 @@ func Seed() error {
 			Type:     "boolean",
 			Category: "notifications",
 		},
+		{
+			Key:      "discord_notify_server_crash",
+			Value:    "true",
+			Type:     "boolean",
+			Category: "notifications",
+		},
+		{
+			Key:      "discord_notify_server_start",
+			Value:    "true",
+			Type:     "boolean",
+			Category: "notifications",
+		},
+		{
+			Key:      "discord_notify_server_stop",
+			Value:    "true",
+			Type:     "boolean",
+			Category: "notifications",
+		},
+		{
+			Key:      "discord_notify_backup_completed",
+			Value:    "true",
+			Type:     "boolean",
+			Category: "notifications",
+		},
+		{
+			Key:      "discord_notify_node_offline",
+			Value:    "true",
+			Type:     "boolean",
+			Category: "notifications",
+		},
+		{
+			Key:      "discord_notify_node_health",
+			Value:    "true",
+			Type:     "boolean",
+			Category: "notifications",
+		},
 	}
 
 	for _, setting := range defaultSettings {
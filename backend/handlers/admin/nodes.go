@@ -0,0 +1,24 @@
+package admin
+
+import (
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetNodeToken returns the token a node agent authenticates with, to be set
+// as its PLAYPULSE_NODE_TOKEN. The token only admits the node it is for.
+func GetNodeToken(c *fiber.Ctx) error {
+	manager := services.NodeManager()
+	if manager == nil {
+		return utils.NewAPIError(fiber.StatusServiceUnavailable, utils.CodeServiceUnavailable, "Nodes disabled",
+			"Set NODE_TOKEN_SECRET to accept node agents")
+	}
+
+	nodeID := c.Params("nodeId")
+	return c.JSON(fiber.Map{
+		"node_id": nodeID,
+		"token":   manager.NodeToken(nodeID),
+	})
+}
@@ -0,0 +1,112 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"playpulse-panel/database"
+	"playpulse-panel/logger"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type UpdateSettingRequest struct {
+	// A JSON boolean, number or string; strings are parsed for boolean and
+	// number settings
+	Value interface{} `json:"value"`
+}
+
+// GetSettings returns all system settings, or one category with ?category=
+func GetSettings(c *fiber.Ctx) error {
+	settings, err := services.ListSettings(c.Query("category"))
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error",
+			"Unable to retrieve settings")
+	}
+
+	return c.JSON(fiber.Map{
+		"settings": settings,
+		"total":    len(settings),
+	})
+}
+
+// GetSetting returns a single system setting
+func GetSetting(c *fiber.Ctx) error {
+	setting, err := services.GetSetting(c.Params("key"))
+	if err != nil {
+		return settingError(c, err)
+	}
+
+	return c.JSON(setting)
+}
+
+// UpdateSetting changes a system setting's value
+func UpdateSetting(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	key := c.Params("key")
+
+	var req UpdateSettingRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid request body", err.Error())
+	}
+
+	var value string
+	switch v := req.Value.(type) {
+	case string:
+		value = v
+	case bool:
+		value = strconv.FormatBool(v)
+	case float64:
+		value = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid setting value",
+			"value must be a boolean, number or string")
+	}
+
+	setting, previous, err := services.UpdateSetting(key, value)
+	if err != nil {
+		return settingError(c, err)
+	}
+
+	// Create audit log
+	auditLog := models.AuditLog{
+		UserID:    user.ID,
+		Action:    "setting_update",
+		Details:   fmt.Sprintf("Changed setting %s from %q to %q", setting.Key, previous, setting.Value),
+		IPAddress: c.IP(),
+		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
+	}
+	database.DB.Create(&auditLog)
+
+	return c.JSON(setting)
+}
+
+// GetPublicSettings returns the settings anyone may read, such as the
+// panel name, with typed values
+func GetPublicSettings(c *fiber.Ctx) error {
+	settings, err := services.PublicSettings()
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error",
+			"Unable to retrieve settings")
+	}
+
+	return c.JSON(settings)
+}
+
+func settingError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrSettingNotFound):
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Setting not found",
+			"The requested setting does not exist")
+	case errors.Is(err, services.ErrInvalidSettingValue):
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid setting value", err.Error())
+	default:
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error",
+			"Unable to update setting")
+	}
+}
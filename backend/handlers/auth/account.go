@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/logger"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+	Confirm  bool   `json:"confirm"`
+}
+
+// ExportData returns everything the panel stores about the current user as
+// a JSON download
+func ExportData(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	export, err := services.ExportUserData(user.ID)
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Export failed", "Unable to collect account data")
+	}
+
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="playpulse-%s-%s.json"`,
+		user.Username, time.Now().Format("20060102")))
+	return c.JSON(export)
+}
+
+// DeleteAccount erases the current user's account after checking their
+// password. Audit logs of what they did are kept without personal data.
+func DeleteAccount(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var req DeleteAccountRequest
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+	if !req.Confirm {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Confirmation required",
+			"Send confirm=true to permanently delete your account")
+	}
+
+	var fullUser models.User
+	if err := database.DB.First(&fullUser, user.ID).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "User not found", "User account not found")
+	}
+	if !utils.CheckPasswordHash(req.Password, fullUser.Password) {
+		return utils.NewAPIError(fiber.StatusForbidden, utils.CodeForbidden, "Invalid password", "Password is incorrect")
+	}
+
+	if err := services.DeleteUserAccount(&fullUser); err != nil {
+		if errors.Is(err, services.ErrLastAdmin) {
+			return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Cannot delete account",
+				"Make another user an admin before deleting the last admin account")
+		}
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Deletion failed", "Unable to delete account")
+	}
+
+	// Recorded without the IP address and user agent the deletion erased
+	auditLog := models.AuditLog{
+		UserID:    user.ID,
+		Action:    "account_delete",
+		Details:   "User deleted their account",
+		RequestID: logger.RequestID(c),
+	}
+	database.DB.Create(&auditLog)
+
+	return c.JSON(fiber.Map{
+		"message": "Account deleted",
+	})
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// createAuditLog records an action by the user with the request details
+// deletion must erase
+func createAuditLog(t *testing.T, user *models.User, action string) models.AuditLog {
+	t.Helper()
+
+	auditLog := models.AuditLog{
+		UserID:    user.ID,
+		Action:    action,
+		Details:   `{"email": "` + user.Email + `"}`,
+		IPAddress: "203.0.113.7",
+		UserAgent: "Mozilla/5.0",
+	}
+	if err := database.DB.Create(&auditLog).Error; err != nil {
+		t.Fatalf("failed to create audit log: %v", err)
+	}
+	return auditLog
+}
+
+func TestExportDataIncludesSections(t *testing.T) {
+	testDB(t)
+	setTestSetting(t, "require_email_verification", "false")
+	app := newTestApp()
+
+	user := createTestUser(t, "Sup3r-secret", true)
+	server := testutil.CreateServer(t, &models.Server{})
+	testutil.GrantServerAccess(t, user, server, models.ServerRoleMember, models.ServerPermissionConsole)
+	createAuditLog(t, user, "server_start")
+	token := login(t, app, user.Email, "Sup3r-secret")
+
+	resp := doRequest(t, app, http.MethodGet, "/me/export", token, "")
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("GET /me/export = %d, want 200", resp.StatusCode)
+	}
+	if disposition := resp.Header.Get(fiber.HeaderContentDisposition); !strings.HasPrefix(disposition, "attachment;") {
+		t.Errorf("Content-Disposition = %q, want a download", disposition)
+	}
+
+	var export map[string]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&export); err != nil {
+		t.Fatalf("failed to decode export: %v", err)
+	}
+	for _, section := range []string{
+		"exported_at", "profile", "servers", "audit_logs", "sessions", "identities",
+		"api_keys", "sftp_keys", "notifications", "command_history",
+	} {
+		if _, exists := export[section]; !exists {
+			t.Errorf("export has no %s section", section)
+		}
+	}
+
+	var profile map[string]interface{}
+	json.Unmarshal(export["profile"], &profile)
+	if profile["email"] != user.Email {
+		t.Errorf("profile email = %v, want %s", profile["email"], user.Email)
+	}
+	for _, secret := range []string{"password", "two_factor_secret"} {
+		if _, exists := profile[secret]; exists {
+			t.Errorf("profile exports %s", secret)
+		}
+	}
+
+	var servers []struct {
+		Name string            `json:"name"`
+		Role models.ServerRole `json:"role"`
+	}
+	json.Unmarshal(export["servers"], &servers)
+	if len(servers) != 1 || servers[0].Name != server.Name || servers[0].Role != models.ServerRoleMember {
+		t.Errorf("servers = %+v, want %s as member", servers, server.Name)
+	}
+
+	var auditLogs, sessions []map[string]interface{}
+	json.Unmarshal(export["audit_logs"], &auditLogs)
+	json.Unmarshal(export["sessions"], &sessions)
+	if len(auditLogs) != 1 || auditLogs[0]["action"] != "server_start" {
+		t.Errorf("audit logs = %v, want the server_start entry", auditLogs)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("%d sessions exported, want the login's", len(sessions))
+	}
+	if _, exists := sessions[0]["refresh_token"]; exists {
+		t.Error("session exports its refresh token")
+	}
+}
+
+func TestDeleteAccountAnonymizes(t *testing.T) {
+	testDB(t)
+	setTestSetting(t, "require_email_verification", "false")
+	app := newTestApp()
+
+	user := createTestUser(t, "Sup3r-secret", true)
+	database.DB.Model(user).Updates(map[string]interface{}{"first_name": "Alex", "last_name": "Smith"})
+	server := testutil.CreateServer(t, &models.Server{})
+	testutil.GrantServerAccess(t, user, server, models.ServerRoleOwner)
+	auditLog := createAuditLog(t, user, "server_start")
+	token := login(t, app, user.Email, "Sup3r-secret")
+
+	// The password must be confirmed, and the deletion asked for outright
+	if resp := doRequest(t, app, http.MethodDelete, "/me", token, `{"password": "wrong", "confirm": true}`); resp.StatusCode != fiber.StatusForbidden {
+		t.Fatalf("delete with the wrong password = %d, want 403", resp.StatusCode)
+	}
+	if resp := doRequest(t, app, http.MethodDelete, "/me", token, `{"password": "Sup3r-secret"}`); resp.StatusCode != fiber.StatusBadRequest {
+		t.Fatalf("delete without confirm = %d, want 400", resp.StatusCode)
+	}
+	if resp := doRequest(t, app, http.MethodDelete, "/me", token, `{"password": "Sup3r-secret", "confirm": true}`); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("delete = %d, want 200", resp.StatusCode)
+	}
+
+	// The user row stays for the audit logs to point at, without anything
+	// that identifies the person
+	var stored models.User
+	if err := database.DB.Unscoped().First(&stored, user.ID).Error; err != nil {
+		t.Fatalf("user row was removed: %v", err)
+	}
+	if !stored.DeletedAt.Valid || stored.IsActive {
+		t.Error("deleted user is not soft deleted and inactive")
+	}
+	if stored.Email == user.Email || stored.Username == user.Username || stored.FirstName != "" || stored.LastName != "" {
+		t.Errorf("deleted user = %s <%s> %s %s, want the personal data replaced", stored.Username, stored.Email, stored.FirstName, stored.LastName)
+	}
+
+	var kept models.AuditLog
+	if err := database.DB.First(&kept, auditLog.ID).Error; err != nil {
+		t.Fatalf("audit log was removed: %v", err)
+	}
+	if kept.UserID != user.ID || kept.Action != "server_start" {
+		t.Errorf("audit log = %+v, want it still recording the user's server_start", kept)
+	}
+	if kept.IPAddress != "" || kept.UserAgent != "" || kept.Details != "" {
+		t.Errorf("audit log keeps %q, %q, %q, want the request details cleared", kept.IPAddress, kept.UserAgent, kept.Details)
+	}
+	var deletions int64
+	database.DB.Model(&models.AuditLog{}).Where("user_id = ? AND action = ?", user.ID, "account_delete").Count(&deletions)
+	if deletions != 1 {
+		t.Errorf("%d account_delete audit logs, want 1", deletions)
+	}
+
+	for name, model := range map[string]interface{}{"sessions": &models.UserSession{}, "server memberships": &models.UserServer{}} {
+		var count int64
+		database.DB.Unscoped().Model(model).Where("user_id = ?", user.ID).Count(&count)
+		if count != 0 {
+			t.Errorf("%d %s left, want them deleted", count, name)
+		}
+	}
+
+	// Neither the old token nor the old credentials get back in
+	if resp := doRequest(t, app, http.MethodGet, "/me/export", token, ""); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("old token = %d, want 401", resp.StatusCode)
+	}
+	if resp := postJSON(t, app, "/login", `{"email": "`+user.Email+`", "password": "Sup3r-secret"}`); resp.StatusCode == fiber.StatusOK {
+		t.Error("deleted account could still log in")
+	}
+}
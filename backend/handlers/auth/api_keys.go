@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type CreateAPIKeyRequest struct {
+	Name          string             `json:"name" validate:"required,min=1,max=100"`
+	Scope         models.APIKeyScope `json:"scope" validate:"required,oneof=read server-control admin"`
+	ExpiresInDays int                `json:"expires_in_days" validate:"min=0"` // 0 never expires
+}
+
+// GetAPIKeys returns the user's API keys
+func GetAPIKeys(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var keys []models.APIKey
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error",
+			"Unable to retrieve API keys")
+	}
+
+	return c.JSON(fiber.Map{
+		"keys":  keys,
+		"total": len(keys),
+	})
+}
+
+// CreateAPIKey issues a scoped API key. The key itself is only returned once.
+func CreateAPIKey(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var req CreateAPIKeyRequest
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+
+	switch req.Scope {
+	case models.APIKeyScopeRead, models.APIKeyScopeServerControl, models.APIKeyScopeAdmin:
+	default:
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid scope",
+			"Scope must be one of read, server-control or admin")
+	}
+
+	if req.Name == "" || req.ExpiresInDays < 0 {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid key",
+			"A name is required and the expiry cannot be negative")
+	}
+
+	if req.Scope == models.APIKeyScopeAdmin && user.Role != models.RoleAdmin {
+		return utils.NewAPIError(fiber.StatusForbidden, utils.CodeForbidden, "Insufficient permissions",
+			"Only admins can create admin API keys")
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		expiry := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &expiry
+	}
+
+	key, raw, err := services.CreateAPIKey(user.ID, req.Name, req.Scope, expiresAt)
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Key creation failed",
+			"Unable to create API key")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"key":     key,
+		"api_key": raw,
+	})
+}
+
+// RotateAPIKey replaces an API key with a new one and invalidates the old key
+func RotateAPIKey(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	keyId, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid key ID",
+			"Key ID must be a valid UUID")
+	}
+
+	key, raw, err := services.RotateAPIKey(user.ID, keyId)
+	if err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Key not found",
+				"The requested API key does not exist")
+		}
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Rotation failed",
+			"Unable to rotate API key")
+	}
+
+	return c.JSON(fiber.Map{
+		"key":     key,
+		"api_key": raw,
+	})
+}
+
+// RevokeAPIKey deletes one of the user's API keys
+func RevokeAPIKey(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	keyId, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid key ID",
+			"Key ID must be a valid UUID")
+	}
+
+	if err := services.RevokeAPIKey(user.ID, keyId); err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Key not found",
+				"The requested API key does not exist")
+		}
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Revocation failed",
+			"Unable to revoke API key")
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "API key revoked successfully",
+	})
+}
@@ -1,27 +1,29 @@
 package auth
 
 import (
+	"errors"
+	"strings"
 	"time"
 
 	"playpulse-panel/config"
 	"playpulse-panel/database"
+	"playpulse-panel/logger"
 	"playpulse-panel/models"
+	"playpulse-panel/services"
 	"playpulse-panel/utils"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/google/uuid"
-	"gorm.io/gorm"
 )
 
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
+	Password string `json:"password" validate:"required"`
 }
 
 type RegisterRequest struct {
 	Username  string `json:"username" validate:"required,min=3,max=50"`
 	Email     string `json:"email" validate:"required,email"`
-	Password  string `json:"password" validate:"required,min=8"`
+	Password  string `json:"password" validate:"required,maxbytes=72"` // minimum length is checked by the password policy
 	FirstName string `json:"first_name" validate:"max=50"`
 	LastName  string `json:"last_name" validate:"max=50"`
 }
@@ -40,95 +42,110 @@ type RefreshRequest struct {
 // Login authenticates a user and returns JWT tokens
 func Login(c *fiber.Ctx) error {
 	var req LoginRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request body",
-			"message": err.Error(),
-		})
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
 	}
 
 	// Find user by email
 	var user models.User
 	err := database.DB.Where("email = ?", req.Email).First(&user).Error
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":   "Invalid credentials",
-			"message": "Email or password is incorrect",
-		})
+		return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "Invalid credentials",
+			"Email or password is incorrect")
 	}
 
 	// Check if user is active
 	if !user.IsActive {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":   "Account disabled",
-			"message": "Your account has been disabled. Please contact an administrator.",
-		})
+		return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "Account disabled",
+			"Your account has been disabled. Please contact an administrator.")
 	}
 
 	// Check if user is locked
 	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":   "Account locked",
-			"message": "Your account is temporarily locked due to too many failed login attempts.",
-		})
+		return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "Account locked",
+			"Your account is temporarily locked due to too many failed login attempts.")
 	}
 
 	// Verify password
 	if !utils.CheckPasswordHash(req.Password, user.Password) {
-		// Increment login attempts
+		cfg, err := config.Load()
+		if err != nil {
+			return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Configuration error",
+				"Unable to load server configuration")
+		}
+
+		// Increment login attempts; the lockout matches the SFTP server's
 		user.LoginAttempts++
-		if user.LoginAttempts >= 5 {
-			lockUntil := time.Now().Add(time.Minute * 15)
+		locked := false
+		if user.LoginAttempts >= cfg.Security.MaxLoginAttempts {
+			lockUntil := time.Now().Add(time.Duration(cfg.Security.LoginCooldownMinutes) * time.Minute)
 			user.LockedUntil = &lockUntil
+			locked = true
 		}
 		database.DB.Save(&user)
 
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":   "Invalid credentials",
-			"message": "Email or password is incorrect",
-		})
+		if locked {
+			services.SendAccountLockedEmail(&user, *user.LockedUntil)
+		}
+
+		return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "Invalid credentials",
+			"Email or password is incorrect")
+	}
+
+	// Check if email verification is required
+	if !user.EmailVerified && services.EmailVerificationRequired() {
+		return utils.NewAPIError(fiber.StatusForbidden, utils.CodeForbidden, "Email not verified",
+			"Please verify your email address before logging in.")
 	}
 
 	// Reset login attempts
 	user.LoginAttempts = 0
 	user.LockedUntil = nil
+
+	response, errResponse := startSession(c, &user, "User logged in successfully")
+	if response == nil {
+		return errResponse
+	}
+
+	return c.JSON(response)
+}
+
+// startSession records the login, issues an access and refresh token pair
+// for the user and saves the session. On failure it returns nil and the
+// error to return.
+func startSession(c *fiber.Ctx, user *models.User, details string) (*LoginResponse, error) {
 	now := time.Now()
 	user.LastLogin = &now
-	database.DB.Save(&user)
+	database.DB.Save(user)
 
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Configuration error",
-			"message": "Unable to load server configuration",
-		})
+		return nil, utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Configuration error",
+			"Unable to load server configuration")
 	}
 
 	// Generate tokens
 	accessToken, err := utils.GenerateJWT(user.ID, cfg.JWT.Secret, cfg.JWT.ExpireHours)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Token generation failed",
-			"message": "Unable to generate access token",
-		})
+		return nil, utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Token generation failed",
+			"Unable to generate access token")
 	}
 
 	refreshToken, err := utils.GenerateRefreshToken()
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Token generation failed",
-			"message": "Unable to generate refresh token",
-		})
+		return nil, utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Token generation failed",
+			"Unable to generate refresh token")
 	}
 
 	// Save user session
 	session := models.UserSession{
 		UserID:       user.ID,
-		TokenHash:    accessToken, // In production, hash this
+		TokenHash:    utils.HashToken(accessToken),
 		RefreshToken: refreshToken,
 		IPAddress:    c.IP(),
 		UserAgent:    c.Get("User-Agent"),
+		LastSeen:     &now,
 		ExpiresAt:    time.Now().Add(time.Hour * time.Duration(cfg.JWT.ExpireHours)),
 	}
 	database.DB.Create(&session)
@@ -141,72 +158,62 @@ func Login(c *fiber.Ctx) error {
 	auditLog := models.AuditLog{
 		UserID:    user.ID,
 		Action:    "user_login",
-		Details:   "User logged in successfully",
+		Details:   details,
 		IPAddress: c.IP(),
 		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
 	}
 	database.DB.Create(&auditLog)
 
-	return c.JSON(LoginResponse{
-		User:         user,
+	return &LoginResponse{
+		User:         *user,
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
 		ExpiresAt:    session.ExpiresAt,
-	})
+	}, nil
 }
 
 // Register creates a new user account
 func Register(c *fiber.Ctx) error {
 	var req RegisterRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request body",
-			"message": err.Error(),
-		})
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
 	}
 
 	// Check if registration is allowed
-	var registrationSetting models.SystemSetting
-	err := database.DB.Where("key = ?", "allow_registration").First(&registrationSetting).Error
-	if err == nil && registrationSetting.Value == "false" {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error":   "Registration disabled",
-			"message": "Registration is currently disabled. Please contact an administrator.",
-		})
+	if !services.GetBool("allow_registration", true) {
+		return utils.NewAPIError(fiber.StatusForbidden, utils.CodeForbidden, "Registration disabled",
+			"Registration is currently disabled. Please contact an administrator.")
 	}
 
 	// Validate username and email
 	if !utils.ValidateUsername(req.Username) {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid username",
-			"message": "Username must be 3-50 characters and contain only letters, numbers, underscores, and hyphens",
-		})
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid username",
+			"Username must be 3-50 characters and contain only letters, numbers, underscores, and hyphens")
 	}
 
 	if !utils.ValidateEmail(req.Email) {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid email",
-			"message": "Please provide a valid email address",
-		})
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid email",
+			"Please provide a valid email address")
 	}
 
 	// Check if user already exists
 	var existingUser models.User
-	err = database.DB.Where("username = ? OR email = ?", req.Username, req.Email).First(&existingUser).Error
+	err := database.DB.Where("username = ? OR email = ?", req.Username, req.Email).First(&existingUser).Error
 	if err == nil {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"error":   "User already exists",
-			"message": "Username or email is already registered",
-		})
+		return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "User already exists",
+			"Username or email is already registered")
+	}
+
+	if err := services.ValidatePassword(req.Password, req.Username, req.Email); err != nil {
+		return passwordPolicyError(c, err)
 	}
 
 	// Hash password
 	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Password hashing failed",
-			"message": "Unable to process password",
-		})
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Password hashing failed",
+			"Unable to process password")
 	}
 
 	// Create user
@@ -218,14 +225,12 @@ func Register(c *fiber.Ctx) error {
 		LastName:      req.LastName,
 		Role:          models.RoleUser,
 		IsActive:      true,
-		EmailVerified: false, // In production, implement email verification
+		EmailVerified: false,
 	}
 
 	if err := database.DB.Create(&user).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "User creation failed",
-			"message": "Unable to create user account",
-		})
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "User creation failed",
+			"Unable to create user account")
 	}
 
 	// Create audit log
@@ -235,9 +240,15 @@ func Register(c *fiber.Ctx) error {
 		Details:   "User registered successfully",
 		IPAddress: c.IP(),
 		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
 	}
 	database.DB.Create(&auditLog)
 
+	// Send verification email
+	if err := services.IssueVerificationToken(&user); err != nil {
+		logger.Ctx(c).Error("failed to issue verification token", "email", user.Email, "error", err)
+	}
+
 	// Remove sensitive information
 	user.Password = ""
 
@@ -250,51 +261,40 @@ func Register(c *fiber.Ctx) error {
 // RefreshToken generates a new access token using refresh token
 func RefreshToken(c *fiber.Ctx) error {
 	var req RefreshRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request body",
-			"message": err.Error(),
-		})
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
 	}
 
 	// Find session by refresh token
 	var session models.UserSession
 	err := database.DB.Preload("User").Where("refresh_token = ? AND expires_at > ?", req.RefreshToken, time.Now()).First(&session).Error
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":   "Invalid refresh token",
-			"message": "Refresh token is invalid or expired",
-		})
+		return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "Invalid refresh token",
+			"Refresh token is invalid or expired")
 	}
 
 	// Check if user is still active
 	if !session.User.IsActive {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":   "Account disabled",
-			"message": "Your account has been disabled",
-		})
+		return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "Account disabled",
+			"Your account has been disabled")
 	}
 
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Configuration error",
-			"message": "Unable to load server configuration",
-		})
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Configuration error",
+			"Unable to load server configuration")
 	}
 
 	// Generate new access token
 	accessToken, err := utils.GenerateJWT(session.User.ID, cfg.JWT.Secret, cfg.JWT.ExpireHours)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Token generation failed",
-			"message": "Unable to generate access token",
-		})
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Token generation failed",
+			"Unable to generate access token")
 	}
 
 	// Update session
-	session.TokenHash = accessToken
+	session.TokenHash = utils.HashToken(accessToken)
 	session.ExpiresAt = time.Now().Add(time.Hour * time.Duration(cfg.JWT.ExpireHours))
 	database.DB.Save(&session)
 
@@ -319,7 +319,7 @@ func Logout(c *fiber.Ctx) error {
 		token := authHeader[7:] // Remove "Bearer " prefix
 		
 		// Find and delete the session
-		database.DB.Where("user_id = ? AND token_hash = ?", user.ID, token).Delete(&models.UserSession{})
+		database.DB.Where("user_id = ? AND token_hash = ?", user.ID, utils.HashToken(token)).Delete(&models.UserSession{})
 	}
 
 	// Create audit log
@@ -329,6 +329,7 @@ func Logout(c *fiber.Ctx) error {
 		Details:   "User logged out",
 		IPAddress: c.IP(),
 		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
 	}
 	database.DB.Create(&auditLog)
 
@@ -358,14 +359,11 @@ func UpdateProfile(c *fiber.Ctx) error {
 	var req struct {
 		FirstName string `json:"first_name" validate:"max=50"`
 		LastName  string `json:"last_name" validate:"max=50"`
-		Email     string `json:"email" validate:"email"`
+		Email     string `json:"email" validate:"omitempty,email"`
 	}
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request body",
-			"message": err.Error(),
-		})
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
 	}
 
 	// Check if email is already taken by another user
@@ -373,10 +371,8 @@ func UpdateProfile(c *fiber.Ctx) error {
 		var existingUser models.User
 		err := database.DB.Where("email = ? AND id != ?", req.Email, user.ID).First(&existingUser).Error
 		if err == nil {
-			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-				"error":   "Email already taken",
-				"message": "This email is already registered to another account",
-			})
+			return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Email already taken",
+				"This email is already registered to another account")
 		}
 	}
 
@@ -387,16 +383,16 @@ func UpdateProfile(c *fiber.Ctx) error {
 	if req.LastName != "" {
 		user.LastName = req.LastName
 	}
-	if req.Email != "" {
+	emailChanged := false
+	if req.Email != "" && req.Email != user.Email {
 		user.Email = req.Email
 		user.EmailVerified = false // Require re-verification
+		emailChanged = true
 	}
 
 	if err := database.DB.Save(&user).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Update failed",
-			"message": "Unable to update profile",
-		})
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Update failed",
+			"Unable to update profile")
 	}
 
 	// Create audit log
@@ -406,9 +402,16 @@ func UpdateProfile(c *fiber.Ctx) error {
 		Details:   "User updated profile information",
 		IPAddress: c.IP(),
 		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
 	}
 	database.DB.Create(&auditLog)
 
+	if emailChanged {
+		if err := services.IssueVerificationToken(&user); err != nil {
+			logger.Ctx(c).Error("failed to issue verification token", "email", user.Email, "error", err)
+		}
+	}
+
 	// Remove sensitive information
 	user.Password = ""
 	user.TwoFactorSecret = ""
@@ -422,49 +425,41 @@ func ChangePassword(c *fiber.Ctx) error {
 
 	var req struct {
 		CurrentPassword string `json:"current_password" validate:"required"`
-		NewPassword     string `json:"new_password" validate:"required,min=8"`
+		NewPassword     string `json:"new_password" validate:"required,maxbytes=72"`
 	}
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request body",
-			"message": err.Error(),
-		})
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
 	}
 
 	// Get full user record with password
 	var fullUser models.User
 	if err := database.DB.First(&fullUser, user.ID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error":   "User not found",
-			"message": "User account not found",
-		})
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "User not found", "User account not found")
 	}
 
 	// Verify current password
 	if !utils.CheckPasswordHash(req.CurrentPassword, fullUser.Password) {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid password",
-			"message": "Current password is incorrect",
-		})
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid password",
+			"Current password is incorrect")
+	}
+
+	if err := services.ValidatePassword(req.NewPassword, fullUser.Username, fullUser.Email); err != nil {
+		return passwordPolicyError(c, err)
 	}
 
 	// Hash new password
 	hashedPassword, err := utils.HashPassword(req.NewPassword)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Password hashing failed",
-			"message": "Unable to process new password",
-		})
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Password hashing failed",
+			"Unable to process new password")
 	}
 
 	// Update password
 	fullUser.Password = hashedPassword
 	if err := database.DB.Save(&fullUser).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Password update failed",
-			"message": "Unable to update password",
-		})
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Password update failed",
+			"Unable to update password")
 	}
 
 	// Invalidate all sessions except current one
@@ -474,7 +469,7 @@ func ChangePassword(c *fiber.Ctx) error {
 		currentToken = authHeader[7:] // Remove "Bearer " prefix
 	}
 
-	database.DB.Where("user_id = ? AND token_hash != ?", user.ID, currentToken).Delete(&models.UserSession{})
+	database.DB.Where("user_id = ? AND token_hash != ?", user.ID, utils.HashToken(currentToken)).Delete(&models.UserSession{})
 
 	// Create audit log
 	auditLog := models.AuditLog{
@@ -483,10 +478,164 @@ func ChangePassword(c *fiber.Ctx) error {
 		Details:   "User changed password",
 		IPAddress: c.IP(),
 		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
 	}
 	database.DB.Create(&auditLog)
 
+	services.SendPasswordChangedEmail(&fullUser)
+
 	return c.JSON(fiber.Map{
 		"message": "Password changed successfully",
 	})
-}
\ No newline at end of file
+}
+
+// VerifyEmail confirms a user's email address using the token from the verification email
+func VerifyEmail(c *fiber.Ctx) error {
+	var req struct {
+		Token string `json:"token" validate:"required"`
+	}
+
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+
+	user, err := services.ConsumeVerificationToken(req.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrVerificationTokenExpired):
+			return utils.NewAPIError(fiber.StatusGone, utils.CodeGone, "Token expired",
+				"This verification link has expired. Please request a new one.")
+		case errors.Is(err, services.ErrVerificationTokenUsed):
+			return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Token already used",
+				"This verification link has already been used")
+		case errors.Is(err, services.ErrVerificationTokenInvalid):
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid token",
+				"Verification token is invalid")
+		default:
+			return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Verification failed",
+				"Unable to verify email address")
+		}
+	}
+
+	// Create audit log
+	auditLog := models.AuditLog{
+		UserID:    user.ID,
+		Action:    "email_verified",
+		Details:   "User verified email address",
+		IPAddress: c.IP(),
+		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
+	}
+	database.DB.Create(&auditLog)
+
+	return c.JSON(fiber.Map{
+		"message": "Email verified successfully",
+	})
+}
+
+// ResendVerification sends a new verification email. The response doesn't
+// reveal whether the address belongs to an account.
+func ResendVerification(c *fiber.Ctx) error {
+	var req struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+
+	var user models.User
+	err := database.DB.Where("email = ?", req.Email).First(&user).Error
+	if err == nil && !user.EmailVerified {
+		if err := services.IssueVerificationToken(&user); err != nil {
+			if errors.Is(err, services.ErrVerificationRateLimited) {
+				return utils.NewAPIError(fiber.StatusTooManyRequests, utils.CodeRateLimited, "Too many requests",
+					"Please wait before requesting another verification email")
+			}
+			return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Verification failed",
+				"Unable to send verification email")
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "If the account exists and is not yet verified, a verification email has been sent",
+	})
+}
+
+// ForgotPassword emails a password reset link. It always succeeds so the
+// response can't be used to discover registered addresses.
+func ForgotPassword(c *fiber.Ctx) error {
+	var req struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+
+	if err := services.RequestPasswordReset(req.Email, c.IP()); err != nil {
+		logger.Ctx(c).Error("failed to process password reset", "email", req.Email, "error", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "If an account with that email exists, a password reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password using a token from the reset email
+func ResetPassword(c *fiber.Ctx) error {
+	var req struct {
+		Token       string `json:"token" validate:"required"`
+		NewPassword string `json:"new_password" validate:"required,maxbytes=72"`
+	}
+
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+
+	user, err := services.ResetPassword(req.Token, req.NewPassword)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrResetTokenExpired):
+			return utils.NewAPIError(fiber.StatusGone, utils.CodeGone, "Token expired",
+				"This reset link has expired. Please request a new one.")
+		case errors.Is(err, services.ErrResetTokenInvalid):
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid token",
+				"Reset token is invalid or has already been used")
+		case errors.Is(err, services.ErrWeakPassword), errors.Is(err, services.ErrPasswordBreached):
+			return passwordPolicyError(c, err)
+		default:
+			return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Password reset failed",
+				"Unable to reset password")
+		}
+	}
+
+	// Create audit log
+	auditLog := models.AuditLog{
+		UserID:    user.ID,
+		Action:    "password_reset",
+		Details:   "User reset password via email",
+		IPAddress: c.IP(),
+		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
+	}
+	database.DB.Create(&auditLog)
+
+	return c.JSON(fiber.Map{
+		"message": "Password reset successfully. Please log in with your new password.",
+	})
+}
+
+// passwordPolicyError responds to a password rejected by the password policy
+func passwordPolicyError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, services.ErrPasswordBreached) {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Breached password",
+			"This password has appeared in a known data breach. Please choose a different one.")
+	}
+	if errors.Is(err, services.ErrWeakPassword) {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Weak password",
+			strings.TrimPrefix(err.Error(), services.ErrWeakPassword.Error()+": "))
+	}
+	return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Password check failed",
+		"Unable to check password")
+}
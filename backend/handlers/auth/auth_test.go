@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/middleware"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// testDB points database.DB at the test database through testutil.UseDB and
+// loads the settings
+func testDB(t *testing.T) {
+	t.Helper()
+
+	testutil.UseDB(t)
+	if err := services.LoadSettings(); err != nil {
+		t.Fatalf("failed to load settings: %v", err)
+	}
+}
+
+// setTestSetting changes a setting for the duration of the test
+func setTestSetting(t *testing.T, key, value string) {
+	t.Helper()
+
+	_, previous, err := services.UpdateSetting(key, value)
+	if err != nil {
+		t.Fatalf("failed to set %s: %v", key, err)
+	}
+	t.Cleanup(func() { services.UpdateSetting(key, previous) })
+}
+
+// createTestUser saves an active user with the given password through
+// testutil.CreateUser
+func createTestUser(t *testing.T, password string, emailVerified bool) *models.User {
+	t.Helper()
+
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testutil.CreateUser(t, &models.User{Password: hash, EmailVerified: emailVerified})
+}
+
+func newTestApp() *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.ErrorHandler})
+	app.Post("/login", Login)
+
+	sessions := app.Group("/sessions", middleware.AuthRequired())
+	sessions.Get("/", GetSessions)
+	sessions.Delete("/:id", RevokeSession)
+
+	me := app.Group("/me", middleware.AuthRequired())
+	me.Get("/export", ExportData)
+	me.Delete("/", DeleteAccount)
+	return app
+}
+
+func postJSON(t *testing.T, app *fiber.App, path, body string) *http.Response {
+	t.Helper()
+	return doRequest(t, app, http.MethodPost, path, "", body)
+}
+
+// doRequest sends a request to the app, authenticated if token is set
+func doRequest(t *testing.T, app *fiber.App, method, path, token, body string) *http.Response {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return resp
+}
+
+func TestLoginRequiresVerifiedEmail(t *testing.T) {
+	testDB(t)
+	setTestSetting(t, "require_email_verification", "true")
+	app := newTestApp()
+
+	user := createTestUser(t, "Sup3r-secret", false)
+	body := `{"email": "` + user.Email + `", "password": "Sup3r-secret"}`
+
+	if resp := postJSON(t, app, "/login", body); resp.StatusCode != fiber.StatusForbidden {
+		t.Fatalf("unverified login = %d, want 403", resp.StatusCode)
+	}
+
+	database.DB.Model(user).Update("email_verified", true)
+	if resp := postJSON(t, app, "/login", body); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("verified login = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestLoginAllowsUnverifiedWhenNotRequired(t *testing.T) {
+	testDB(t)
+	setTestSetting(t, "require_email_verification", "false")
+	app := newTestApp()
+
+	user := createTestUser(t, "Sup3r-secret", false)
+	body := `{"email": "` + user.Email + `", "password": "Sup3r-secret"}`
+
+	if resp := postJSON(t, app, "/login", body); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("login = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestLoginLockoutFollowsConfig(t *testing.T) {
+	testDB(t)
+	t.Setenv("MAX_LOGIN_ATTEMPTS", "2")
+	t.Setenv("LOGIN_COOLDOWN_MINUTES", "3")
+	app := newTestApp()
+
+	user := createTestUser(t, "Sup3r-secret", true)
+	wrong := `{"email": "` + user.Email + `", "password": "wrong-password"}`
+
+	postJSON(t, app, "/login", wrong)
+	var stored models.User
+	database.DB.First(&stored, "id = ?", user.ID)
+	if stored.LockedUntil != nil {
+		t.Fatal("locked after one failed login with MAX_LOGIN_ATTEMPTS=2")
+	}
+
+	before := time.Now()
+	postJSON(t, app, "/login", wrong)
+	database.DB.First(&stored, "id = ?", user.ID)
+	if stored.LockedUntil == nil {
+		t.Fatal("not locked after two failed logins with MAX_LOGIN_ATTEMPTS=2")
+	}
+	if cooldown := stored.LockedUntil.Sub(before); cooldown < 2*time.Minute || cooldown > 4*time.Minute {
+		t.Errorf("locked for %s, want LOGIN_COOLDOWN_MINUTES=3", cooldown)
+	}
+
+	right := `{"email": "` + user.Email + `", "password": "Sup3r-secret"}`
+	if resp := postJSON(t, app, "/login", right); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("login while locked = %d, want 401", resp.StatusCode)
+	}
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const oauthStateCookie = "oauth_state"
+
+// GetOAuthProviders lists the providers users can log in with
+func GetOAuthProviders(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"providers": services.OAuthProviders(),
+	})
+}
+
+// OAuthStart redirects the browser to a provider's login page
+func OAuthStart(c *fiber.Ctx) error {
+	provider := c.Params("provider")
+
+	authURL, state, err := services.StartOAuthLogin(provider)
+	if errors.Is(err, services.ErrOAuthProviderUnknown) {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Unknown provider",
+			fmt.Sprintf("Login with %s is not configured", provider))
+	}
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Login failed",
+			"Unable to start login")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Configuration error",
+			"Unable to load server configuration")
+	}
+
+	// The state is tied to this browser so a callback can't be replayed in
+	// someone else's
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     "/",
+		Expires:  time.Now().Add(10 * time.Minute),
+		Secure:   cfg.IsProduction(),
+		HTTPOnly: true,
+		SameSite: "Lax",
+	})
+
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// OAuthCallback completes a provider login and hands the tokens to the
+// frontend in the URL fragment, or the reason it failed as error
+func OAuthCallback(c *fiber.Ctx) error {
+	provider := c.Params("provider")
+
+	cfg, err := config.Load()
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Configuration error",
+			"Unable to load server configuration")
+	}
+
+	fail := func(message string) error {
+		fragment := url.Values{"error": {message}}
+		return c.Redirect(cfg.Server.FrontendURL+"/auth/oauth/callback#"+fragment.Encode(), fiber.StatusFound)
+	}
+
+	state := c.Cookies(oauthStateCookie)
+	c.ClearCookie(oauthStateCookie)
+
+	if providerError := c.Query("error"); providerError != "" {
+		return fail(providerError)
+	}
+	if state == "" || state != c.Query("state") {
+		return fail(services.ErrOAuthStateInvalid.Error())
+	}
+
+	user, err := services.CompleteOAuthLogin(c.UserContext(), provider, state, c.Query("code"))
+	switch {
+	case errors.Is(err, services.ErrOAuthProviderUnknown),
+		errors.Is(err, services.ErrOAuthStateInvalid),
+		errors.Is(err, services.ErrOAuthEmailNotVerified),
+		errors.Is(err, services.ErrOAuthSignupDisabled),
+		errors.Is(err, services.ErrOAuthAccountNotVerified):
+		return fail(err.Error())
+	case err != nil:
+		return fail("Unable to complete login")
+	}
+
+	if !user.IsActive {
+		return fail("Your account has been disabled. Please contact an administrator.")
+	}
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		return fail("Your account is temporarily locked due to too many failed login attempts.")
+	}
+
+	response, errResponse := startSession(c, user, fmt.Sprintf("User logged in with %s", provider))
+	if response == nil {
+		return errResponse
+	}
+
+	fragment := url.Values{
+		"access_token":  {response.AccessToken},
+		"refresh_token": {response.RefreshToken},
+		"expires_at":    {strconv.FormatInt(response.ExpiresAt.Unix(), 10)},
+	}
+	return c.Redirect(cfg.Server.FrontendURL+"/auth/oauth/callback#"+fragment.Encode(), fiber.StatusFound)
+}
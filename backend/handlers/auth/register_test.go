@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRegisterFollowsAllowRegistration(t *testing.T) {
+	testDB(t)
+	app := newTestApp()
+	app.Post("/register", Register)
+
+	register := func() (int, string) {
+		t.Helper()
+
+		username := "test" + strconv.Itoa(rand.Int())
+		t.Cleanup(func() {
+			var user models.User
+			if database.DB.Where("username = ?", username).First(&user).Error == nil {
+				database.DB.Where("user_id = ?", user.ID).Delete(&models.AuditLog{})
+				database.DB.Unscoped().Delete(&user)
+			}
+		})
+		resp := postJSON(t, app, "/register",
+			`{"username": "`+username+`", "email": "`+username+`@example.com", "password": "Correct-Horse-Battery-9"}`)
+		return resp.StatusCode, username
+	}
+
+	setTestSetting(t, "allow_registration", "true")
+	if status, _ := register(); status != fiber.StatusCreated {
+		t.Fatalf("register with registration allowed = %d, want 201", status)
+	}
+
+	// Turning it off takes effect straight away, without reloading settings
+	setTestSetting(t, "allow_registration", "false")
+	status, username := register()
+	if status != fiber.StatusForbidden {
+		t.Errorf("register with registration disabled = %d, want 403", status)
+	}
+	var count int64
+	database.DB.Model(&models.User{}).Where("username = ?", username).Count(&count)
+	if count != 0 {
+		t.Error("a user was created with registration disabled")
+	}
+}
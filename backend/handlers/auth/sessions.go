@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/logger"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type SessionResponse struct {
+	ID        uuid.UUID  `json:"id"`
+	IPAddress string     `json:"ip_address"`
+	UserAgent string     `json:"user_agent"`
+	CreatedAt time.Time  `json:"created_at"`
+	LastSeen  *time.Time `json:"last_seen"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	Current   bool       `json:"current"`
+}
+
+// GetSessions returns the user's active sessions
+func GetSessions(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	currentId, _ := c.Locals("sessionId").(uuid.UUID)
+
+	var sessions []models.UserSession
+	if err := database.DB.Where("user_id = ? AND expires_at > ?", user.ID, time.Now()).
+		Order("created_at DESC").Find(&sessions).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error",
+			"Unable to retrieve sessions")
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{
+			ID:        session.ID,
+			IPAddress: session.IPAddress,
+			UserAgent: session.UserAgent,
+			CreatedAt: session.CreatedAt,
+			LastSeen:  session.LastSeen,
+			ExpiresAt: session.ExpiresAt,
+			Current:   session.ID == currentId,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"sessions": response,
+		"total":    len(response),
+	})
+}
+
+// RevokeSession revokes one of the user's sessions
+func RevokeSession(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	sessionId, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid session ID",
+			"Session ID must be a valid UUID")
+	}
+
+	result := database.DB.Where("id = ? AND user_id = ?", sessionId, user.ID).Delete(&models.UserSession{})
+	if result.Error != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Revocation failed",
+			"Unable to revoke session")
+	}
+	if result.RowsAffected == 0 {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Session not found",
+			"The requested session does not exist")
+	}
+
+	// Create audit log
+	auditLog := models.AuditLog{
+		UserID:    user.ID,
+		Action:    "session_revoke",
+		Details:   fmt.Sprintf("Revoked session %s", sessionId),
+		IPAddress: c.IP(),
+		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
+	}
+	database.DB.Create(&auditLog)
+
+	return c.JSON(fiber.Map{
+		"message": "Session revoked successfully",
+	})
+}
+
+// RevokeOtherSessions revokes all of the user's sessions except the current one
+func RevokeOtherSessions(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	currentId, _ := c.Locals("sessionId").(uuid.UUID)
+
+	result := database.DB.Where("user_id = ? AND id != ?", user.ID, currentId).Delete(&models.UserSession{})
+	if result.Error != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Revocation failed",
+			"Unable to revoke sessions")
+	}
+
+	// Create audit log
+	auditLog := models.AuditLog{
+		UserID:    user.ID,
+		Action:    "session_revoke_all",
+		Details:   fmt.Sprintf("Revoked %d other sessions", result.RowsAffected),
+		IPAddress: c.IP(),
+		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
+	}
+	database.DB.Create(&auditLog)
+
+	return c.JSON(fiber.Map{
+		"message": "Other sessions revoked successfully",
+		"revoked": result.RowsAffected,
+	})
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// login signs the user in and returns the access token
+func login(t *testing.T, app *fiber.App, email, password string) string {
+	t.Helper()
+
+	resp := postJSON(t, app, "/login", `{"email": "`+email+`", "password": "`+password+`"}`)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("login = %d, want 200", resp.StatusCode)
+	}
+
+	var response LoginResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode login response: %v", err)
+	}
+	return response.AccessToken
+}
+
+func TestRevokedSessionTokenIsRejected(t *testing.T) {
+	testDB(t)
+	setTestSetting(t, "require_email_verification", "false")
+	app := newTestApp()
+
+	user := createTestUser(t, "Sup3r-secret", true)
+	laptop := login(t, app, user.Email, "Sup3r-secret")
+	phone := login(t, app, user.Email, "Sup3r-secret")
+
+	resp := doRequest(t, app, http.MethodGet, "/sessions", laptop, "")
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("GET /sessions = %d, want 200", resp.StatusCode)
+	}
+	var listing struct {
+		Sessions []SessionResponse `json:"sessions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		t.Fatalf("failed to decode sessions: %v", err)
+	}
+	if len(listing.Sessions) != 2 {
+		t.Fatalf("%d sessions listed, want 2", len(listing.Sessions))
+	}
+
+	// Revoke the phone's session from the laptop
+	var phoneSession string
+	for _, session := range listing.Sessions {
+		if !session.Current {
+			phoneSession = session.ID.String()
+		}
+	}
+	if resp := doRequest(t, app, http.MethodDelete, "/sessions/"+phoneSession, laptop, ""); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("DELETE /sessions/%s = %d, want 200", phoneSession, resp.StatusCode)
+	}
+
+	if resp := doRequest(t, app, http.MethodGet, "/sessions", phone, ""); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("revoked token = %d, want 401", resp.StatusCode)
+	}
+	if resp := doRequest(t, app, http.MethodGet, "/sessions", laptop, ""); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("remaining token = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestRevokeSessionOfAnotherUser(t *testing.T) {
+	testDB(t)
+	setTestSetting(t, "require_email_verification", "false")
+	app := newTestApp()
+
+	alice := createTestUser(t, "Sup3r-secret", true)
+	bob := createTestUser(t, "Sup3r-secret", true)
+	aliceToken := login(t, app, alice.Email, "Sup3r-secret")
+	bobToken := login(t, app, bob.Email, "Sup3r-secret")
+
+	var listing struct {
+		Sessions []SessionResponse `json:"sessions"`
+	}
+	resp := doRequest(t, app, http.MethodGet, "/sessions", bobToken, "")
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil || len(listing.Sessions) != 1 {
+		t.Fatalf("failed to list bob's session: %v", err)
+	}
+
+	path := "/sessions/" + listing.Sessions[0].ID.String()
+	if resp := doRequest(t, app, http.MethodDelete, path, aliceToken, ""); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("revoking another user's session = %d, want 404", resp.StatusCode)
+	}
+	if resp := doRequest(t, app, http.MethodGet, "/sessions", bobToken, ""); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("bob's token = %d after alice's attempt, want 200", resp.StatusCode)
+	}
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"strings"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+type AddSFTPKeyRequest struct {
+	Name      string     `json:"name" validate:"required,min=1,max=100"`
+	PublicKey string     `json:"public_key" validate:"required"`
+	ServerID  *uuid.UUID `json:"server_id"`
+}
+
+// GetSFTPKeys returns the user's SFTP public keys
+func GetSFTPKeys(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var keys []models.SFTPKey
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error",
+			"Unable to retrieve SFTP keys")
+	}
+
+	return c.JSON(fiber.Map{
+		"keys":  keys,
+		"total": len(keys),
+	})
+}
+
+// AddSFTPKey registers a public key for SFTP logins, optionally limited to one server
+func AddSFTPKey(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var req AddSFTPKeyRequest
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(req.PublicKey)))
+	if err != nil || req.Name == "" {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid key",
+			"A name and a public key in authorized_keys format are required")
+	}
+
+	if req.ServerID != nil {
+		if _, err := services.GetAccessibleServer(&user, *req.ServerID); err != nil {
+			return utils.NewAPIError(fiber.StatusForbidden, utils.CodeForbidden, "Access denied",
+				"You don't have access to this server")
+		}
+	}
+
+	fingerprint := ssh.FingerprintSHA256(publicKey)
+
+	var existing models.SFTPKey
+	if err := database.DB.Where("fingerprint = ?", fingerprint).First(&existing).Error; err == nil {
+		return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Key already registered",
+			"This public key is already in use")
+	}
+
+	key := models.SFTPKey{
+		UserID:      user.ID,
+		ServerID:    req.ServerID,
+		Name:        req.Name,
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))),
+		Fingerprint: fingerprint,
+	}
+
+	if err := database.DB.Create(&key).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Key creation failed",
+			"Unable to save SFTP key")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(key)
+}
+
+// DeleteSFTPKey removes one of the user's SFTP keys
+func DeleteSFTPKey(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	keyId, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid key ID",
+			"Key ID must be a valid UUID")
+	}
+
+	result := database.DB.Where("id = ? AND user_id = ?", keyId, user.ID).Delete(&models.SFTPKey{})
+	if result.Error != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Deletion failed",
+			"Unable to delete SFTP key")
+	}
+	if result.RowsAffected == 0 {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Key not found",
+			"The requested SFTP key does not exist")
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "SFTP key deleted successfully",
+	})
+}
@@ -0,0 +1,198 @@
+package backups
+
+import (
+	"errors"
+	"fmt"
+
+	"playpulse-panel/database"
+	"playpulse-panel/logger"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type RestoreBackupRequest struct {
+	Confirm bool `json:"confirm"`
+	Force   bool `json:"force"`
+}
+
+// GetBackups returns all backups of a server, newest first
+func GetBackups(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	backups, err := services.GetServerBackups(serverId)
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error",
+			"Unable to retrieve backups")
+	}
+
+	var totalSize int64
+	for _, backup := range backups {
+		totalSize += backup.Size
+	}
+
+	return c.JSON(fiber.Map{
+		"backups":    backups,
+		"total":      len(backups),
+		"total_size": totalSize,
+	})
+}
+
+// RestoreBackup restores a server from one of its backups
+func RestoreBackup(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	backupId, err := uuid.Parse(c.Params("backupId"))
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid backup ID",
+			"Backup ID must be a valid UUID")
+	}
+
+	var req RestoreBackupRequest
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+
+	if !req.Confirm {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Confirmation required",
+			"Restoring overwrites the server files. Send confirm=true to proceed")
+	}
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	snapshot, err := services.RestoreBackup(&server, backupId, req.Force)
+	if errors.Is(err, services.ErrServerRunning) {
+		return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Server is running",
+			"Stop the server first or send force=true to stop it automatically")
+	}
+	if errors.Is(err, services.ErrBackupKeyUnavailable) {
+		return utils.NewAPIError(fiber.StatusUnprocessableEntity, utils.CodeBadRequest, "Backup key unavailable",
+			err.Error()+"; add it to BACKUP_ENCRYPTION_KEYS to restore this backup")
+	}
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Restore failed", err.Error()).
+			WithDetail("snapshot", snapshot)
+	}
+
+	// Create audit log
+	auditLog := models.AuditLog{
+		UserID:    user.ID,
+		ServerID:  &server.ID,
+		Action:    "backup_restore",
+		Details:   fmt.Sprintf("Restored backup %s on server %s", backupId, server.Name),
+		IPAddress: c.IP(),
+		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
+	}
+	database.DB.Create(&auditLog)
+
+	return c.JSON(fiber.Map{
+		"message":  "Backup restored successfully",
+		"snapshot": snapshot,
+	})
+}
+
+type BackupPolicyRequest struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+// GetBackupPolicy returns the server's backup include and exclude patterns
+func GetBackupPolicy(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	return c.JSON(fiber.Map{
+		"include": server.BackupInclude,
+		"exclude": server.BackupExclude,
+	})
+}
+
+// UpdateBackupPolicy replaces the server's backup include and exclude
+// patterns. Empty lists back up the whole server directory.
+func UpdateBackupPolicy(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	var req BackupPolicyRequest
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	if err := services.SetBackupPatterns(&server, req.Include, req.Exclude); err != nil {
+		if errors.Is(err, services.ErrInvalidBackupPattern) {
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid backup pattern",
+				err.Error())
+		}
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Update failed",
+			"Unable to save backup policy")
+	}
+
+	return c.JSON(fiber.Map{
+		"include": server.BackupInclude,
+		"exclude": server.BackupExclude,
+	})
+}
+
+// VerifyBackup checks a backup archive is readable and matches its checksum,
+// marking it failed if not
+func VerifyBackup(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	backupId, err := uuid.Parse(c.Params("backupId"))
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid backup ID",
+			"Backup ID must be a valid UUID")
+	}
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	backup, err := services.VerifyBackup(&server, backupId)
+	switch {
+	case errors.Is(err, services.ErrBackupNotFound):
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Backup not found",
+			"The requested backup does not exist")
+	case errors.Is(err, services.ErrBackupInProgress):
+		return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Backup in progress",
+			"The backup is still being created")
+	case errors.Is(err, services.ErrBackupKeyUnavailable):
+		return utils.NewAPIError(fiber.StatusUnprocessableEntity, utils.CodeBadRequest, "Backup key unavailable",
+			err.Error()+"; add it to BACKUP_ENCRYPTION_KEYS to verify this backup")
+	case errors.Is(err, services.ErrBackupCorrupt):
+		return c.JSON(fiber.Map{
+			"valid":   false,
+			"message": err.Error(),
+			"backup":  backup,
+		})
+	case err != nil:
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Verification failed",
+			err.Error())
+	}
+
+	return c.JSON(fiber.Map{
+		"valid":  true,
+		"backup": backup,
+	})
+}
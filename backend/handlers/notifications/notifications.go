@@ -0,0 +1,67 @@
+package notifications
+
+import (
+	"errors"
+
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetNotifications returns a page of the user's notifications. ?unread=true
+// limits it to unread ones; ?page and ?per_page select the page.
+func GetNotifications(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	page, err := services.ListNotifications(user.ID, c.QueryBool("unread"), c.QueryInt("page", 1), c.QueryInt("per_page", 0))
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error",
+			"Unable to retrieve notifications")
+	}
+
+	return c.JSON(page)
+}
+
+// MarkNotificationRead marks one notification read
+func MarkNotificationRead(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	notificationId, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid notification ID",
+			"Notification ID must be a valid UUID")
+	}
+
+	notification, err := services.MarkNotificationRead(user.ID, notificationId)
+	if err != nil {
+		if errors.Is(err, services.ErrNotificationNotFound) {
+			return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Notification not found",
+				"The requested notification does not exist")
+		}
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error",
+			"Unable to update notification")
+	}
+
+	return c.JSON(fiber.Map{
+		"notification": notification,
+	})
+}
+
+// MarkAllNotificationsRead marks every unread notification read
+func MarkAllNotificationsRead(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	updated, err := services.MarkAllNotificationsRead(user.ID)
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error",
+			"Unable to update notifications")
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "All notifications marked as read",
+		"updated": updated,
+	})
+}
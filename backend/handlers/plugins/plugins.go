@@ -0,0 +1,225 @@
+package plugins
+
+import (
+	"errors"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetPluginUpdates checks the server's plugins against their sources and
+// returns the ones with an update available
+func GetPluginUpdates(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	plugins, err := services.CheckPluginUpdates(c.UserContext(), &server)
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Update check failed",
+			"Unable to check plugins for updates")
+	}
+
+	updates := []models.Plugin{}
+	for _, plugin := range plugins {
+		if plugin.UpdateAvailable {
+			updates = append(updates, plugin)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"updates": updates,
+		"checked": len(plugins),
+		"total":   len(updates),
+	})
+}
+
+// UpdatePlugin installs the latest release of a plugin, keeping the old file
+func UpdatePlugin(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	pluginId, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid plugin ID",
+			"Plugin ID must be a valid UUID")
+	}
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	plugin, err := services.UpdatePlugin(&server, pluginId)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrServerRunning):
+			return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Server is running",
+				"Stop the server before updating plugins")
+		case errors.Is(err, services.ErrPluginNotFound):
+			return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Plugin not found",
+				"The requested plugin does not exist")
+		case errors.Is(err, services.ErrPluginPinned):
+			return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Plugin is pinned",
+				"Unpin the plugin before updating it")
+		case errors.Is(err, services.ErrNoPluginUpdate):
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "No update available",
+				"Check for updates first; this plugin is up to date")
+		default:
+			return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Update failed", err.Error())
+		}
+	}
+
+	return c.JSON(plugin)
+}
+
+// RollbackPlugin reinstalls an earlier approved marketplace version of a
+// plugin, pinning it unless the request says otherwise
+func RollbackPlugin(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	pluginId, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid plugin ID",
+			"Plugin ID must be a valid UUID")
+	}
+
+	var req struct {
+		VersionID uuid.UUID `json:"version_id"`
+		Pin       *bool     `json:"pin"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.VersionID == uuid.Nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid request",
+			"version_id must be a valid UUID")
+	}
+	pin := req.Pin == nil || *req.Pin
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	plugin, err := services.RollbackPlugin(&server, pluginId, req.VersionID, pin)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrServerRunning):
+			return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Server is running",
+				"Stop the server before rolling back plugins")
+		case errors.Is(err, services.ErrPluginNotFound):
+			return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Plugin not found",
+				"The requested plugin does not exist")
+		case errors.Is(err, services.ErrPluginNotFromMarketplace):
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Rollback not supported",
+				"Only plugins installed from the marketplace can be rolled back")
+		case errors.Is(err, services.ErrPluginVersionNotFound):
+			return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Version not found",
+				"The version is not an approved earlier release of this plugin")
+		case errors.Is(err, services.ErrPluginVersionIncompatible):
+			return utils.NewAPIError(fiber.StatusUnprocessableEntity, utils.CodeBadRequest, "Incompatible version",
+				"The version does not support this server's type or Minecraft version")
+		case errors.Is(err, services.ErrPluginVersionUnsafe):
+			return utils.NewAPIError(fiber.StatusUnprocessableEntity, utils.CodeBadRequest, "Unsafe version",
+				"The version has not passed the marketplace security scan")
+		default:
+			return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Rollback failed",
+				err.Error())
+		}
+	}
+
+	return c.JSON(plugin)
+}
+
+// PinPlugin pins a plugin to its installed version, or unpins it
+func PinPlugin(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	pluginId, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid plugin ID",
+			"Plugin ID must be a valid UUID")
+	}
+
+	var req struct {
+		Pinned bool `json:"pinned"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid request",
+			"Failed to parse request body")
+	}
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	plugin, err := services.SetPluginPinned(&server, pluginId, req.Pinned)
+	if err != nil {
+		if errors.Is(err, services.ErrPluginNotFound) {
+			return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Plugin not found",
+				"The requested plugin does not exist")
+		}
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Pin failed", err.Error())
+	}
+
+	return c.JSON(plugin)
+}
+
+// InstallMarketplacePlugin installs an approved marketplace version on the
+// server
+func InstallMarketplacePlugin(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+	user := c.Locals("user").(models.User)
+
+	var req struct {
+		VersionID uuid.UUID `json:"version_id"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.VersionID == uuid.Nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid request",
+			"version_id must be a valid UUID")
+	}
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	plugin, err := services.InstallMarketplacePlugin(&server, user.ID, req.VersionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrServerRunning):
+			return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Server is running",
+				"Stop the server before installing plugins")
+		case errors.Is(err, services.ErrPluginVersionNotFound):
+			return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Version not found",
+				"The version is not an approved marketplace release")
+		case errors.Is(err, services.ErrPluginVersionIncompatible):
+			return utils.NewAPIError(fiber.StatusUnprocessableEntity, utils.CodeBadRequest, "Incompatible version",
+				"The version does not support this server's type or Minecraft version")
+		case errors.Is(err, services.ErrPluginVersionUnsafe):
+			return utils.NewAPIError(fiber.StatusUnprocessableEntity, utils.CodeBadRequest, "Unsafe version",
+				"The version has not passed the marketplace security scan")
+		case errors.Is(err, services.ErrPluginNotPurchased):
+			return utils.NewAPIError(fiber.StatusPaymentRequired, utils.CodePaymentRequired, "Purchase required",
+				"Buy this item in the marketplace before installing it")
+		case errors.Is(err, services.ErrPluginAlreadyInstalled):
+			return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Already installed",
+				"This plugin is already installed; use rollback to change its version")
+		default:
+			return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Install failed", err.Error())
+		}
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(plugin)
+}
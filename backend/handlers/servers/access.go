@@ -0,0 +1,181 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+
+	"playpulse-panel/database"
+	"playpulse-panel/logger"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type GrantAccessRequest struct {
+	// The user is given by ID or by email address
+	UserID *uuid.UUID        `json:"user_id"`
+	Email  string            `json:"email" validate:"omitempty,email"`
+	Role   models.ServerRole `json:"role"`
+	// What a member may do; omitted grants every permission
+	Permissions []models.ServerPermission `json:"permissions"`
+}
+
+type TransferOwnershipRequest struct {
+	UserID *uuid.UUID `json:"user_id"`
+	Email  string     `json:"email" validate:"omitempty,email"`
+}
+
+// GetServerUsers lists the users with access to a server and their roles
+func GetServerUsers(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	access, err := services.ListServerAccess(serverId)
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error",
+			"Unable to retrieve server users")
+	}
+
+	return c.JSON(fiber.Map{
+		"users": access,
+		"total": len(access),
+	})
+}
+
+// GrantServerAccess gives a user access to the server, or changes their role
+func GrantServerAccess(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	var req GrantAccessRequest
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+	if req.Role == "" {
+		req.Role = models.ServerRoleMember
+	}
+
+	target, err := findAccessUser(req.UserID, req.Email)
+	if err != nil {
+		return serverAccessError(c, err)
+	}
+
+	if err := services.GrantServerAccess(serverId, target.ID, req.Role, req.Permissions); err != nil {
+		return serverAccessError(c, err)
+	}
+
+	details := fmt.Sprintf("Granted %s %s access", target.Username, req.Role)
+	if req.Role == models.ServerRoleMember && req.Permissions != nil {
+		details += fmt.Sprintf(" with permissions %v", req.Permissions)
+	}
+	logServerAccess(c, user, serverId, "server_access_grant", details)
+
+	return c.JSON(fiber.Map{
+		"message":     "Access granted",
+		"user_id":     target.ID,
+		"role":        req.Role,
+		"permissions": req.Permissions,
+	})
+}
+
+// RevokeServerAccess removes a user's access to the server
+func RevokeServerAccess(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	userId, err := uuid.Parse(c.Params("userId"))
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid user ID",
+			"User ID must be a valid UUID")
+	}
+
+	if err := services.RevokeServerAccess(serverId, userId); err != nil {
+		return serverAccessError(c, err)
+	}
+	logServerAccess(c, user, serverId, "server_access_revoke", fmt.Sprintf("Revoked access of user %s", userId))
+
+	return c.JSON(fiber.Map{
+		"message": "Access revoked",
+	})
+}
+
+// TransferServerOwnership makes another user the server's sole owner. The
+// previous owners stay on as members.
+func TransferServerOwnership(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	var req TransferOwnershipRequest
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+
+	target, err := findAccessUser(req.UserID, req.Email)
+	if err != nil {
+		return serverAccessError(c, err)
+	}
+
+	if err := services.TransferServerOwnership(serverId, target.ID); err != nil {
+		return serverAccessError(c, err)
+	}
+	logServerAccess(c, user, serverId, "server_transfer", fmt.Sprintf("Transferred ownership to %s", target.Username))
+
+	return c.JSON(fiber.Map{
+		"message": "Ownership transferred",
+		"user_id": target.ID,
+	})
+}
+
+// findAccessUser looks up the user an access request is for
+func findAccessUser(userID *uuid.UUID, email string) (*models.User, error) {
+	var target models.User
+	var err error
+	switch {
+	case userID != nil:
+		err = database.DB.First(&target, *userID).Error
+	case email != "":
+		err = database.DB.Where("email = ?", email).First(&target).Error
+	default:
+		return nil, fmt.Errorf("%w: user_id or email is required", services.ErrUserNotFound)
+	}
+	if err != nil {
+		return nil, services.ErrUserNotFound
+	}
+	return &target, nil
+}
+
+func serverAccessError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "User not found", err.Error())
+	case errors.Is(err, services.ErrInvalidServerRole):
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid role",
+			"Role must be owner or member")
+	case errors.Is(err, services.ErrInvalidServerPermission):
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid permission", err.Error())
+	case errors.Is(err, services.ErrNoServerAccess):
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "No access",
+			"The user has no access to this server")
+	case errors.Is(err, services.ErrLastServerUser):
+		return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Last user",
+			"A server must keep at least one user and one owner. Transfer ownership first.")
+	default:
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error",
+			"Unable to update server access")
+	}
+}
+
+func logServerAccess(c *fiber.Ctx, user models.User, serverId uuid.UUID, action, details string) {
+	auditLog := models.AuditLog{
+		UserID:    user.ID,
+		ServerID:  &serverId,
+		Action:    action,
+		Details:   details,
+		IPAddress: c.IP(),
+		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
+	}
+	database.DB.Create(&auditLog)
+}
@@ -0,0 +1,129 @@
+package servers
+
+import (
+	"net/http"
+	"testing"
+
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/middleware"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newAccessTestApp returns an app authenticated as user serving the access
+// routes behind ServerAccessRequired as main.go does, plus a probe route
+// that only answers users ServerAccessRequired lets through
+func newAccessTestApp(user models.User) *fiber.App {
+	app := newTestApp(user)
+	server := app.Group("/servers/:serverId", middleware.ServerAccessRequired())
+	server.Get("/probe", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) })
+	server.Get("/users", middleware.ServerOwnerRequired(), GetServerUsers)
+	server.Post("/users", middleware.ServerOwnerRequired(), GrantServerAccess)
+	server.Delete("/users/:userId", middleware.ServerOwnerRequired(), RevokeServerAccess)
+	server.Post("/transfer", middleware.ServerOwnerRequired(), TransferServerOwnership)
+	return app
+}
+
+func TestGrantAndRevokeServerAccess(t *testing.T) {
+	testDB(t)
+	owner := createTestUser(t, models.RoleUser)
+	friend := createTestUser(t, models.RoleUser)
+	server := createTestServer(t, &models.Server{})
+	testutil.GrantServerAccess(t, &owner, server, models.ServerRoleOwner)
+
+	asOwner, asFriend := newAccessTestApp(owner), newAccessTestApp(friend)
+	base := "/servers/" + server.ID.String()
+
+	if resp := doJSON(t, asFriend, http.MethodGet, base+"/probe", "", nil); resp.StatusCode != fiber.StatusForbidden {
+		t.Fatalf("probe before the grant = %d, want 403", resp.StatusCode)
+	}
+
+	resp := doJSON(t, asOwner, http.MethodPost, base+"/users",
+		`{"email": "`+friend.Email+`", "role": "member", "permissions": ["console"]}`, nil)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("grant = %d, want 200", resp.StatusCode)
+	}
+	if resp := doJSON(t, asFriend, http.MethodGet, base+"/probe", "", nil); resp.StatusCode != fiber.StatusNoContent {
+		t.Errorf("probe after the grant = %d, want access", resp.StatusCode)
+	}
+	if role := services.ServerRoleOf(friend.ID, server.ID); role != models.ServerRoleMember {
+		t.Errorf("friend's role = %q, want member", role)
+	}
+
+	// Members can't manage access
+	if resp := doJSON(t, asFriend, http.MethodPost, base+"/users", `{"email": "`+friend.Email+`", "role": "owner"}`, nil); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("member promoting themselves = %d, want 403", resp.StatusCode)
+	}
+	if resp := doJSON(t, asFriend, http.MethodDelete, base+"/users/"+owner.ID.String(), "", nil); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("member revoking the owner = %d, want 403", resp.StatusCode)
+	}
+
+	var listed struct {
+		Users []services.ServerAccess `json:"users"`
+	}
+	doJSON(t, asOwner, http.MethodGet, base+"/users", "", &listed)
+	if len(listed.Users) != 2 || listed.Users[0].User.ID != owner.ID || listed.Users[1].User.ID != friend.ID {
+		t.Errorf("listed users = %+v, want the owner then the friend", listed.Users)
+	}
+
+	if resp := doJSON(t, asOwner, http.MethodDelete, base+"/users/"+friend.ID.String(), "", nil); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("revoke = %d, want 200", resp.StatusCode)
+	}
+	if resp := doJSON(t, asFriend, http.MethodGet, base+"/probe", "", nil); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("probe after the revoke = %d, want 403", resp.StatusCode)
+	}
+	if resp := doJSON(t, asOwner, http.MethodDelete, base+"/users/"+friend.ID.String(), "", nil); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("revoking again = %d, want 404", resp.StatusCode)
+	}
+
+	if resp := doJSON(t, asOwner, http.MethodPost, base+"/users", `{"email": "`+friend.Email+`", "role": "admin"}`, nil); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("grant with an unknown role = %d, want 400", resp.StatusCode)
+	}
+	if resp := doJSON(t, asOwner, http.MethodPost, base+"/users", `{"email": "nobody@example.invalid"}`, nil); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("grant to an unknown user = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestRevokeKeepsLastUserAndOwner(t *testing.T) {
+	testDB(t)
+	owner := createTestUser(t, models.RoleUser)
+	member := createTestUser(t, models.RoleUser)
+	server := createTestServer(t, &models.Server{})
+	testutil.GrantServerAccess(t, &owner, server, models.ServerRoleOwner)
+
+	asOwner := newAccessTestApp(owner)
+	base := "/servers/" + server.ID.String()
+
+	if resp := doJSON(t, asOwner, http.MethodDelete, base+"/users/"+owner.ID.String(), "", nil); resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("revoking the only user = %d, want 409", resp.StatusCode)
+	}
+
+	testutil.GrantServerAccess(t, &member, server, models.ServerRoleMember)
+	if resp := doJSON(t, asOwner, http.MethodDelete, base+"/users/"+owner.ID.String(), "", nil); resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("revoking the only owner = %d, want 409", resp.StatusCode)
+	}
+	if resp := doJSON(t, asOwner, http.MethodPost, base+"/users", `{"email": "`+owner.Email+`", "role": "member"}`, nil); resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("demoting the only owner = %d, want 409", resp.StatusCode)
+	}
+
+	// Once ownership moves on the previous owner can leave
+	if resp := doJSON(t, asOwner, http.MethodPost, base+"/transfer", `{"email": "`+member.Email+`"}`, nil); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("transfer = %d, want 200", resp.StatusCode)
+	}
+	if role := services.ServerRoleOf(member.ID, server.ID); role != models.ServerRoleOwner {
+		t.Errorf("new owner's role = %q, want owner", role)
+	}
+	if role := services.ServerRoleOf(owner.ID, server.ID); role != models.ServerRoleMember {
+		t.Errorf("previous owner's role = %q, want member", role)
+	}
+
+	asNewOwner := newAccessTestApp(member)
+	if resp := doJSON(t, asNewOwner, http.MethodDelete, base+"/users/"+owner.ID.String(), "", nil); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("revoking the previous owner after the transfer = %d, want 200", resp.StatusCode)
+	}
+	if resp := doJSON(t, asOwner, http.MethodGet, base+"/probe", "", nil); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("previous owner's probe after leaving = %d, want 403", resp.StatusCode)
+	}
+}
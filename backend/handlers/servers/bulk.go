@@ -0,0 +1,159 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/logger"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// bulkWorkers caps how many servers a bulk action touches at once
+	bulkWorkers = 5
+	// maxBulkServers caps how many servers one bulk request may name
+	maxBulkServers = 100
+)
+
+type BulkActionRequest struct {
+	ServerIDs []uuid.UUID `json:"server_ids" validate:"required,min=1"`
+	Action    string      `json:"action" validate:"required,oneof=start stop restart backup"`
+}
+
+type BulkActionResult struct {
+	ServerID uuid.UUID `json:"server_id"`
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// BulkServerAction runs start, stop, restart or backup on several servers
+// concurrently and reports the outcome per server
+func BulkServerAction(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var req BulkActionRequest
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+
+	switch req.Action {
+	case "start", "stop", "restart", "backup":
+	default:
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid action",
+			"Action must be one of start, stop, restart or backup")
+	}
+
+	if len(req.ServerIDs) == 0 || len(req.ServerIDs) > maxBulkServers {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid server list",
+			fmt.Sprintf("Between 1 and %d server IDs are required", maxBulkServers))
+	}
+
+	ipAddress, userAgent, requestId := c.IP(), c.Get("User-Agent"), logger.RequestID(c)
+
+	results := make([]BulkActionResult, len(req.ServerIDs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < bulkWorkers && w < len(req.ServerIDs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				serverId := req.ServerIDs[i]
+				results[i] = BulkActionResult{ServerID: serverId, Success: true}
+
+				permission := models.ServerPermissionPower
+				if req.Action == "backup" {
+					permission = models.ServerPermissionBackups
+				}
+				server, err := services.GetServerWithPermission(&user, serverId, permission)
+				if err == nil {
+					// Drop the preloaded users so saving the server leaves them alone
+					server.Users = nil
+					err = runBulkAction(server, req.Action)
+				}
+				if err != nil {
+					results[i].Success = false
+					results[i].Error = bulkErrorMessage(err)
+					continue
+				}
+
+				// Create audit log
+				auditLog := models.AuditLog{
+					UserID:    user.ID,
+					ServerID:  &server.ID,
+					Action:    "server_" + req.Action,
+					Details:   fmt.Sprintf("Bulk %s of server: %s", req.Action, server.Name),
+					IPAddress: ipAddress,
+					UserAgent: userAgent,
+					RequestID: requestId,
+				}
+				database.DB.Create(&auditLog)
+			}
+		}()
+	}
+
+	for i := range req.ServerIDs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	succeeded := 0
+	for _, result := range results {
+		if result.Success {
+			succeeded++
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"action":    req.Action,
+		"results":   results,
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+	})
+}
+
+func runBulkAction(server *models.Server, action string) error {
+	switch action {
+	case "start":
+		if server.Status == models.ServerStatusRunning {
+			return services.ErrServerAlreadyRunning
+		}
+		// A manual start gives a crash looping server a fresh restart budget
+		services.ResetCrashCounter(server)
+		return services.StartServer(server)
+	case "stop":
+		if server.Status == models.ServerStatusStopped {
+			return services.ErrServerAlreadyStopped
+		}
+		return services.StopServer(server)
+	case "restart":
+		return services.RestartServer(server)
+	case "backup":
+		return services.CreateBackup(server, fmt.Sprintf("bulk-%s", time.Now().Format("20060102-150405")))
+	default:
+		return fmt.Errorf("unsupported action: %s", action)
+	}
+}
+
+// bulkErrorMessage reports access failures explicitly so servers the user
+// cannot manage are never silently skipped
+func bulkErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, services.ErrServerAccessDenied):
+		return "access denied"
+	case errors.Is(err, services.ErrServerNotFound):
+		return "server not found"
+	default:
+		return err.Error()
+	}
+}
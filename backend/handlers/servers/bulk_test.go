@@ -0,0 +1,110 @@
+package servers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type bulkResponse struct {
+	Action    string             `json:"action"`
+	Results   []BulkActionResult `json:"results"`
+	Succeeded int                `json:"succeeded"`
+	Failed    int                `json:"failed"`
+}
+
+func bulkBody(action string, ids ...uuid.UUID) string {
+	quoted := make([]string, len(ids))
+	for i, id := range ids {
+		quoted[i] = `"` + id.String() + `"`
+	}
+	return `{"action": "` + action + `", "server_ids": [` + strings.Join(quoted, ", ") + `]}`
+}
+
+func TestBulkActionReportsEachServer(t *testing.T) {
+	testDB(t)
+	user := createTestUser(t, models.RoleUser)
+
+	// Stopping a hibernating server needs no process, so it succeeds
+	hibernating := createTestServer(t, &models.Server{Status: models.ServerStatusHibernating})
+	testutil.GrantServerAccess(t, &user, hibernating, models.ServerRoleOwner)
+	stopped := createTestServer(t, &models.Server{})
+	testutil.GrantServerAccess(t, &user, stopped, models.ServerRoleOwner)
+	consoleOnly := createTestServer(t, &models.Server{Status: models.ServerStatusHibernating})
+	testutil.GrantServerAccess(t, &user, consoleOnly, models.ServerRoleMember, models.ServerPermissionConsole)
+	others := createTestServer(t, &models.Server{Status: models.ServerStatusHibernating})
+	missing := uuid.New()
+
+	app := newTestApp(user)
+	app.Post("/servers/bulk", BulkServerAction)
+
+	var body bulkResponse
+	resp := doJSON(t, app, http.MethodPost, "/servers/bulk",
+		bulkBody("stop", hibernating.ID, stopped.ID, consoleOnly.ID, others.ID, missing), &body)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	want := []BulkActionResult{
+		{ServerID: hibernating.ID, Success: true},
+		{ServerID: stopped.ID, Error: "server is already stopped"},
+		{ServerID: consoleOnly.ID, Error: "access denied"},
+		{ServerID: others.ID, Error: "access denied"},
+		{ServerID: missing, Error: "server not found"},
+	}
+	if len(body.Results) != len(want) {
+		t.Fatalf("%d results, want one per requested server (%d)", len(body.Results), len(want))
+	}
+	for i, result := range body.Results {
+		if result != want[i] {
+			t.Errorf("result %d = %+v, want %+v", i, result, want[i])
+		}
+	}
+	if body.Succeeded != 1 || body.Failed != 4 {
+		t.Errorf("succeeded %d, failed %d, want 1 and 4", body.Succeeded, body.Failed)
+	}
+
+	// Only the server that was acted on is stopped and audited
+	var current models.Server
+	database.DB.First(&current, "id = ?", hibernating.ID)
+	if current.Status != models.ServerStatusStopped {
+		t.Errorf("hibernating server is %s after a bulk stop, want stopped", current.Status)
+	}
+	database.DB.First(&current, "id = ?", others.ID)
+	if current.Status != models.ServerStatusHibernating {
+		t.Errorf("server without access is %s, want it left alone", current.Status)
+	}
+
+	var audited []models.AuditLog
+	database.DB.Where("user_id = ? AND action = ?", user.ID, "server_stop").Find(&audited)
+	if len(audited) != 1 || audited[0].ServerID == nil || *audited[0].ServerID != hibernating.ID {
+		t.Errorf("audit logs = %+v, want one for the stopped server", audited)
+	}
+}
+
+func TestBulkActionValidation(t *testing.T) {
+	app := newTestApp(models.User{ID: uuid.New(), Role: models.RoleUser})
+	app.Post("/servers/bulk", BulkServerAction)
+
+	tooMany := make([]uuid.UUID, maxBulkServers+1)
+	for i := range tooMany {
+		tooMany[i] = uuid.New()
+	}
+
+	for name, body := range map[string]string{
+		"unknown action": bulkBody("delete", uuid.New()),
+		"no servers":     bulkBody("stop"),
+		"too many":       bulkBody("stop", tooMany...),
+	} {
+		if resp := doJSON(t, app, http.MethodPost, "/servers/bulk", body, nil); resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, resp.StatusCode)
+		}
+	}
+}
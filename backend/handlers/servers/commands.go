@@ -0,0 +1,75 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetCommandHistory returns a page of the commands the user sent to the
+// server, newest first. ?page and ?per_page select the page.
+func GetCommandHistory(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	page, err := services.ListCommandHistory(serverId, user.ID, c.QueryInt("page", 1), c.QueryInt("per_page", 0))
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error",
+			"Unable to retrieve command history")
+	}
+
+	return c.JSON(page)
+}
+
+// ReplayCommand sends a command from the user's history to the server again
+func ReplayCommand(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	entryId, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid command ID",
+			"Command ID must be a valid UUID")
+	}
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	// A server still loading already reads its console
+	if server.Status != models.ServerStatusRunning && server.Status != models.ServerStatusStarting {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Server not running",
+			"The server must be running to send commands")
+	}
+
+	entry, err := services.ReplayCommand(&server, user.ID, entryId)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrCommandNotFound):
+			return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Command not found",
+				"The requested command is not in your history")
+		case errors.Is(err, services.ErrCommandRedacted):
+			return utils.NewAPIError(fiber.StatusUnprocessableEntity, utils.CodeBadRequest, "Command redacted",
+				"Commands stored redacted cannot be replayed")
+		default:
+			return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Command failed", err.Error())
+		}
+	}
+
+	logged, _ := services.RedactCommand(entry.Command)
+	c.Locals("auditDetails", fmt.Sprintf("Replayed command on server %s: %s", server.Name, logged))
+
+	return c.JSON(fiber.Map{
+		"message": "Command sent successfully",
+		"command": entry.Command,
+	})
+}
@@ -0,0 +1,47 @@
+package servers
+
+import (
+	"errors"
+
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetCrashReports lists the crash reports captured for the server, newest
+// first, without their contents
+func GetCrashReports(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	reports, err := services.ListCrashReports(serverId)
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error", "Unable to retrieve crash reports")
+	}
+
+	return c.JSON(fiber.Map{
+		"crash_reports": reports,
+	})
+}
+
+// GetCrashReport returns a crash report with the crash-reports/ file and
+// console tail captured when the server crashed
+func GetCrashReport(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	reportId, err := uuid.Parse(c.Params("reportId"))
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid crash report ID", "Crash report ID must be a valid UUID")
+	}
+
+	report, err := services.GetCrashReport(serverId, reportId)
+	if errors.Is(err, services.ErrCrashReportNotFound) {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Crash report not found", "The requested crash report does not exist")
+	}
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error", "Unable to retrieve crash report")
+	}
+
+	return c.JSON(report)
+}
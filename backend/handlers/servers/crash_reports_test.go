@@ -0,0 +1,66 @@
+package servers
+
+import (
+	"net/http"
+	"testing"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestCrashReportEndpoints(t *testing.T) {
+	testDB(t)
+
+	app := newTestApp(createTestUser(t, models.RoleAdmin))
+	app.Get("/servers/:serverId/crash-reports", withServerID, GetCrashReports)
+	app.Get("/servers/:serverId/crash-reports/:reportId", withServerID, GetCrashReport)
+
+	server := createTestServer(t, &models.Server{})
+	other := createTestServer(t, &models.Server{})
+	report := models.CrashReport{
+		ServerID:    server.ID,
+		FileName:    "crash-2024-03-01_12.00.00-server.txt",
+		Report:      "---- Minecraft Crash Report ----\nDescription: Exception in server tick loop\n",
+		ConsoleTail: "[12:00:01 ERROR]: Encountered an unexpected exception",
+		ExitError:   "exit status 1",
+	}
+	if err := database.DB.Create(&report).Error; err != nil {
+		t.Fatalf("failed to create crash report: %v", err)
+	}
+	base := "/servers/" + server.ID.String() + "/crash-reports"
+
+	// The listing leaves the contents out
+	var list struct {
+		CrashReports []models.CrashReport `json:"crash_reports"`
+	}
+	resp := doJSON(t, app, http.MethodGet, base, "", &list)
+	if resp.StatusCode != fiber.StatusOK || len(list.CrashReports) != 1 {
+		t.Fatalf("list = %d reports (status %d), want 1", len(list.CrashReports), resp.StatusCode)
+	}
+	if listed := list.CrashReports[0]; listed.ID != report.ID || listed.FileName != report.FileName || listed.Report != "" || listed.ConsoleTail != "" {
+		t.Errorf("listed %+v, want the report without its contents", listed)
+	}
+
+	var got models.CrashReport
+	resp = doJSON(t, app, http.MethodGet, base+"/"+report.ID.String(), "", &got)
+	if resp.StatusCode != fiber.StatusOK || got.Report != report.Report || got.ConsoleTail != report.ConsoleTail {
+		t.Errorf("report = %+v (status %d), want its contents", got, resp.StatusCode)
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{base + "/" + uuid.NewString(), fiber.StatusNotFound},
+		{"/servers/" + other.ID.String() + "/crash-reports/" + report.ID.String(), fiber.StatusNotFound},
+		{base + "/not-a-uuid", fiber.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if resp := doJSON(t, app, http.MethodGet, tt.path, "", nil); resp.StatusCode != tt.want {
+			t.Errorf("GET %s status = %d, want %d", tt.path, resp.StatusCode, tt.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package servers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/middleware"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// testDB points database.DB at the test database through testutil.UseDB and
+// loads the settings
+func testDB(t *testing.T) {
+	t.Helper()
+
+	testutil.UseDB(t)
+	if err := services.LoadSettings(); err != nil {
+		t.Fatalf("failed to load settings: %v", err)
+	}
+}
+
+// createTestUser saves an active user with the given role through
+// testutil.CreateUser
+func createTestUser(t *testing.T, role models.UserRole) models.User {
+	t.Helper()
+	return *testutil.CreateUser(t, &models.User{Role: role})
+}
+
+// createTestServer saves server through testutil.CreateServer, defaulting to
+// type other so starting it doesn't download a jar
+func createTestServer(t *testing.T, server *models.Server) *models.Server {
+	t.Helper()
+
+	if server.Type == "" {
+		server.Type = models.ServerTypeOther
+	}
+	return testutil.CreateServer(t, server)
+}
+
+// newTestApp returns an app whose requests are authenticated as user, in
+// place of AuthRequired
+func newTestApp(user models.User) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.ErrorHandler})
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user", user)
+		c.Locals("userId", user.ID)
+		return c.Next()
+	})
+	return app
+}
+
+// doJSON sends a JSON request to the app and decodes the response into out
+// when it is set
+func doJSON(t *testing.T, app *fiber.App, method, path, body string, out interface{}) *http.Response {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: failed to decode response: %v", method, path, err)
+		}
+	}
+	return resp
+}
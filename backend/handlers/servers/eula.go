@@ -0,0 +1,69 @@
+package servers
+
+import (
+	"fmt"
+
+	"playpulse-panel/database"
+	"playpulse-panel/logger"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// AcceptServerEULA records that the user accepts the Minecraft EULA for the
+// server, which it needs before it can start
+func AcceptServerEULA(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	var req struct {
+		Accept bool `json:"accept"`
+	}
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+	if !req.Accept {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "EULA not accepted",
+			"Set accept to true to accept the Minecraft EULA (https://aka.ms/MinecraftEULA)")
+	}
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	if err := services.AcceptEULA(&server, user.ID); err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "EULA acceptance failed",
+			err.Error())
+	}
+	logEULAAcceptance(c, user, &server)
+
+	return c.JSON(fiber.Map{
+		"message":          "EULA accepted",
+		"eula_accepted_by": server.EULAAcceptedBy,
+		"eula_accepted_at": server.EULAAcceptedAt,
+	})
+}
+
+// logEULAAcceptance writes the audit entry for a user accepting the EULA on
+// a server, if they did
+func logEULAAcceptance(c *fiber.Ctx, user models.User, server *models.Server) {
+	if server.EULAAcceptedAt == nil || server.EULAAcceptedBy == nil || *server.EULAAcceptedBy != user.ID {
+		return
+	}
+
+	auditLog := models.AuditLog{
+		UserID:    user.ID,
+		ServerID:  &server.ID,
+		Action:    "server_eula_accept",
+		Details:   fmt.Sprintf("Accepted the Minecraft EULA for server %s", server.Name),
+		IPAddress: c.IP(),
+		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
+	}
+	database.DB.Create(&auditLog)
+}
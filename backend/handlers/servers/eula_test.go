@@ -0,0 +1,131 @@
+package servers
+
+import (
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// withServerID sets the serverId local from the path, as
+// ServerAccessRequired does
+func withServerID(c *fiber.Ctx) error {
+	serverID, err := uuid.Parse(c.Params("serverId"))
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+	c.Locals("serverId", serverID)
+	return c.Next()
+}
+
+func eulaAcceptances(serverID uuid.UUID) []models.AuditLog {
+	var logs []models.AuditLog
+	database.DB.Where("server_id = ? AND action = ?", serverID, "server_eula_accept").Find(&logs)
+	return logs
+}
+
+func TestCreateServerRecordsEULAAcceptance(t *testing.T) {
+	testDB(t)
+	t.Setenv("DEFAULT_SERVER_PATH", t.TempDir())
+
+	portStart := 40000 + rand.Intn(10000)
+	template := models.ServerTemplate{
+		Name:           "test-" + uuid.NewString()[:8],
+		Type:           models.ServerTypeOther,
+		Version:        "1.20.4",
+		PortRangeStart: portStart,
+		PortRangeEnd:   portStart + 9,
+	}
+	if err := database.DB.Create(&template).Error; err != nil {
+		t.Fatalf("failed to create template: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Unscoped().Delete(&template) })
+
+	user := createTestUser(t, models.RoleUser)
+	app := newTestApp(user)
+	app.Post("/servers/from-template/:templateId", CreateServerFromTemplate)
+
+	create := func(acceptEULA string) models.Server {
+		t.Helper()
+
+		var server models.Server
+		resp := doJSON(t, app, http.MethodPost, "/servers/from-template/"+template.ID.String(),
+			`{"name": "eula-`+uuid.NewString()[:8]+`", "accept_eula": `+acceptEULA+`}`, &server)
+		if server.ID != uuid.Nil {
+			testutil.DeleteServerOnCleanup(t, server.ID)
+		}
+		if resp.StatusCode != fiber.StatusCreated {
+			t.Fatalf("status = %d, want 201", resp.StatusCode)
+		}
+		return server
+	}
+
+	declined := create("false")
+	if declined.EULAAcceptedAt != nil || declined.EULAAcceptedBy != nil {
+		t.Errorf("server created without accepting the EULA has acceptance %v by %v", declined.EULAAcceptedAt, declined.EULAAcceptedBy)
+	}
+	if logs := eulaAcceptances(declined.ID); len(logs) != 0 {
+		t.Errorf("audit logs = %+v, want no acceptance recorded", logs)
+	}
+
+	accepted := create("true")
+	if accepted.EULAAcceptedAt == nil || accepted.EULAAcceptedBy == nil || *accepted.EULAAcceptedBy != user.ID {
+		t.Errorf("acceptance = %v by %v, want the creating user's", accepted.EULAAcceptedAt, accepted.EULAAcceptedBy)
+	}
+	if logs := eulaAcceptances(accepted.ID); len(logs) != 1 || logs[0].UserID != user.ID {
+		t.Errorf("audit logs = %+v, want the acceptance recorded once", logs)
+	}
+}
+
+func TestStartRequiresEULAAcceptance(t *testing.T) {
+	testDB(t)
+	user := createTestUser(t, models.RoleUser)
+	server := createTestServer(t, &models.Server{})
+	eulaPath := filepath.Join(server.Path, "eula.txt")
+	if err := os.WriteFile(eulaPath, []byte("eula=false\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApp(user)
+	app.Post("/servers/:serverId/start", withServerID, StartServer)
+	app.Post("/servers/:serverId/eula", withServerID, AcceptServerEULA)
+	base := "/servers/" + server.ID.String()
+
+	if resp := doJSON(t, app, http.MethodPost, base+"/start", "", nil); resp.StatusCode != fiber.StatusPreconditionFailed {
+		t.Errorf("start without the EULA accepted = %d, want 412", resp.StatusCode)
+	}
+	var current models.Server
+	database.DB.First(&current, server.ID)
+	if current.Status != models.ServerStatusStopped {
+		t.Errorf("server is %s after a refused start, want stopped", current.Status)
+	}
+
+	if resp := doJSON(t, app, http.MethodPost, base+"/eula", `{"accept": false}`, nil); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("declining the EULA = %d, want 400", resp.StatusCode)
+	}
+	if content, _ := os.ReadFile(eulaPath); string(content) != "eula=false\n" {
+		t.Errorf("eula.txt after declining = %q, want eula=false", content)
+	}
+
+	if resp := doJSON(t, app, http.MethodPost, base+"/eula", `{"accept": true}`, nil); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("accepting the EULA = %d, want 200", resp.StatusCode)
+	}
+	database.DB.First(&current, server.ID)
+	if current.EULAAcceptedAt == nil || current.EULAAcceptedBy == nil || *current.EULAAcceptedBy != user.ID {
+		t.Errorf("acceptance = %v by %v, want the user's recorded", current.EULAAcceptedAt, current.EULAAcceptedBy)
+	}
+	if content, _ := os.ReadFile(eulaPath); string(content) != "eula=true\n" {
+		t.Errorf("eula.txt after accepting = %q, want eula=true", content)
+	}
+	if logs := eulaAcceptances(server.ID); len(logs) != 1 || logs[0].UserID != user.ID {
+		t.Errorf("audit logs = %+v, want the acceptance recorded", logs)
+	}
+}
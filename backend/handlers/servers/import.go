@@ -0,0 +1,224 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ImportServerRequest struct {
+	Name        string            `json:"name" validate:"required,min=1,max=100"`
+	Description string            `json:"description"`
+	Path        string            `json:"path" validate:"required"`
+	Type        models.ServerType `json:"type"`    // overrides the detected type
+	Version     string            `json:"version"` // overrides the detected version
+	Port        int               `json:"port" validate:"omitempty,min=1024,max=65535"`
+	MemoryLimit int64             `json:"memory_limit" validate:"required,min=512"`
+	DiskLimit   int64             `json:"disk_limit" validate:"required,min=1024"`
+	CPULimit    float64           `json:"cpu_limit" validate:"min=0,max=100"`
+	JavaPath    string            `json:"java_path"`
+	JavaArgs    string            `json:"java_args"`
+	AutoRestart bool              `json:"auto_restart"`
+	AcceptEULA  bool              `json:"accept_eula"`
+}
+
+// ImportServer registers a server that already exists on disk, keeping its
+// files and software in place. The type and version are detected from the
+// directory unless given. The port comes from the request, else from the
+// server's server.properties when no other server has it, else from the
+// allocation range, and server.properties is updated to match.
+func ImportServer(c *fiber.Ctx) error {
+	var req ImportServerRequest
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+
+	if req.Type != "" && !req.Type.Valid() {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeValidationFailed, "Invalid server type",
+			fmt.Sprintf("Unknown server type %q", req.Type))
+	}
+
+	cfg, _ := config.Load()
+
+	serverPath, err := resolveImportPath(req.Path, importRoots(cfg))
+	if err != nil {
+		return err
+	}
+
+	var existing models.Server
+	if err := database.DB.Where("path = ?", serverPath).First(&existing).Error; err == nil {
+		return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Directory already registered",
+			fmt.Sprintf("The directory is already used by server %s", existing.Name))
+	}
+
+	detected, err := services.DetectServer(serverPath)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrImportNotDirectory),
+			errors.Is(err, services.ErrImportEmptyDirectory),
+			errors.Is(err, services.ErrImportUnrecognized):
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Cannot import directory", err.Error())
+		default:
+			return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Detection failed", err.Error())
+		}
+	}
+	if req.Type == "" {
+		req.Type = detected.Type
+	}
+	if req.Version == "" {
+		req.Version = detected.Version
+	}
+
+	port, allocated, err := importPort(req.Port, detected.Port, req.Type, cfg)
+	if err != nil {
+		return err
+	}
+	if allocated {
+		defer services.ReleasePort(port)
+	}
+
+	javaPath := req.JavaPath
+	if javaPath == "" && req.Type != models.ServerTypeBedrock {
+		if selected, err := services.SelectJava(req.Version); err == nil {
+			javaPath = selected
+		}
+	}
+	if javaPath == "" {
+		javaPath = cfg.GameServers.DefaultJavaPath
+	}
+
+	javaArgs := req.JavaArgs
+	if javaArgs == "" {
+		javaArgs = cfg.GameServers.DefaultJavaArgs
+	}
+
+	server := models.Server{
+		Name:          req.Name,
+		Description:   req.Description,
+		Type:          req.Type,
+		Version:       req.Version,
+		Status:        models.ServerStatusStopped,
+		Port:          port,
+		MemoryLimit:   req.MemoryLimit,
+		DiskLimit:     req.DiskLimit,
+		CPULimit:      req.CPULimit,
+		Path:          serverPath,
+		JavaPath:      javaPath,
+		JavaArgs:      javaArgs,
+		ServerJar:     detected.ServerJar,
+		StartCommand:  detected.StartCommand,
+		AutoRestart:   req.AutoRestart,
+		BackupEnabled: true,
+	}
+	user := c.Locals("user").(models.User)
+	if req.AcceptEULA {
+		now := time.Now()
+		server.EULAAcceptedBy = &user.ID
+		server.EULAAcceptedAt = &now
+	}
+
+	if err := database.DB.Create(&server).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Server import failed", "Unable to create server record")
+	}
+
+	// The importing admin owns the server until they transfer it
+	database.DB.Create(&models.UserServer{UserID: user.ID, ServerID: server.ID, Role: models.ServerRoleOwner})
+
+	if detected.Port != server.Port {
+		if err := services.SetPropertiesPort(&server); err != nil {
+			log.Printf("Failed to set port of imported server %s: %v", server.Name, err)
+			return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+				"server":   server,
+				"detected": detected,
+				"warning":  fmt.Sprintf("Set server-port=%d in server.properties before starting: %v", server.Port, err),
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"server":   server,
+		"detected": detected,
+	})
+}
+
+// importRoots are the directories servers may be imported from: the server
+// directory and SERVER_IMPORT_PATHS
+func importRoots(cfg *config.Config) []string {
+	return append([]string{cfg.GameServers.DefaultServerPath}, cfg.GameServers.ImportPaths...)
+}
+
+// resolveImportPath cleans an import path and follows symlinks, checking
+// both the given and the real path with the server path validator. The real
+// path must be inside one of roots, so a symlink can't reach the rest of
+// the host.
+func resolveImportPath(path string, roots []string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid server path", "The path must be absolute")
+	}
+	if err := utils.ValidateServerPath(path); err != nil {
+		return "", utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid server path", err.Error())
+	}
+
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(path))
+	if err != nil {
+		return "", utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid server path", services.ErrImportNotDirectory.Error())
+	}
+	if err := utils.ValidateServerPath(resolved); err != nil {
+		return "", utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid server path", err.Error())
+	}
+
+	for _, root := range roots {
+		realRoot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(realRoot, resolved); err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return resolved, nil
+		}
+	}
+	return "", utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid server path",
+		"Servers can only be imported from the server directory or the directories in SERVER_IMPORT_PATHS")
+}
+
+// importPort picks the imported server's port: the requested one, the one
+// in its server.properties if no other server uses it, or a free one from
+// the allocation range. allocated is set for a port from the range, which
+// stays reserved until ReleasePort.
+func importPort(requested, detected int, serverType models.ServerType, cfg *config.Config) (port int, allocated bool, err error) {
+	if requested != 0 {
+		var existing models.Server
+		if err := database.DB.Where("port = ?", requested).First(&existing).Error; err == nil {
+			return 0, false, utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Port already in use",
+				fmt.Sprintf("Port %d is already used by another server", requested))
+		}
+		return requested, false, nil
+	}
+
+	if detected >= 1024 && detected <= 65535 {
+		var existing models.Server
+		if err := database.DB.Where("port = ?", detected).First(&existing).Error; err != nil {
+			return detected, false, nil
+		}
+	}
+
+	port, err = services.AllocatePort(cfg.GameServers.PortRangeStart, cfg.GameServers.PortRangeEnd, serverType)
+	if errors.Is(err, services.ErrNoFreePort) {
+		return 0, false, utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "No free port",
+			fmt.Sprintf("All ports between %d and %d are in use", cfg.GameServers.PortRangeStart, cfg.GameServers.PortRangeEnd))
+	}
+	if err != nil {
+		return 0, false, utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Port allocation failed", err.Error())
+	}
+	return port, true, nil
+}
@@ -0,0 +1,99 @@
+package servers
+
+import (
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// newImportApp serves ImportServer for an admin, with a fresh server
+// directory to import from
+func newImportApp(t *testing.T) (*fiber.App, string) {
+	t.Helper()
+
+	testDB(t)
+	root := t.TempDir()
+	t.Setenv("DEFAULT_SERVER_PATH", root)
+
+	app := newTestApp(createTestUser(t, models.RoleAdmin))
+	app.Post("/servers/import", ImportServer)
+	return app, root
+}
+
+func importBody(path string) string {
+	return `{"name": "imported-` + uuid.NewString()[:8] + `", "path": "` + path + `", "memory_limit": 2048, "disk_limit": 10240}`
+}
+
+func TestImportServerDetectsPaper(t *testing.T) {
+	app, root := newImportApp(t)
+	dir := filepath.Join(root, "survival")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "paper-1.20.4-496.jar"), []byte("jar"), 0644)
+	port := 40000 + rand.Intn(20000)
+	os.WriteFile(filepath.Join(dir, "server.properties"), []byte("server-port="+strconv.Itoa(port)+"\n"), 0644)
+
+	var body struct {
+		Server models.Server `json:"server"`
+	}
+	resp := doJSON(t, app, http.MethodPost, "/servers/import", importBody(dir), &body)
+	if body.Server.ID != uuid.Nil {
+		testutil.DeleteServerOnCleanup(t, body.Server.ID)
+	}
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("status = %d, want 201", resp.StatusCode)
+	}
+
+	server := body.Server
+	if server.Type != models.ServerTypePaper || server.Version != "1.20.4" || server.ServerJar != "paper-1.20.4-496.jar" {
+		t.Errorf("server = %s %s on %s, want paper 1.20.4", server.Type, server.Version, server.ServerJar)
+	}
+	if server.Path != dir || server.Port != port || server.Status != models.ServerStatusStopped {
+		t.Errorf("server = %+v, want it stopped in place on the port from server.properties", server)
+	}
+
+	// The same directory can't be registered twice
+	if resp := doJSON(t, app, http.MethodPost, "/servers/import", importBody(dir), nil); resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("second import = %d, want 409", resp.StatusCode)
+	}
+}
+
+func TestImportServerRejectsDirectory(t *testing.T) {
+	app, root := newImportApp(t)
+	empty := filepath.Join(root, "empty")
+	os.MkdirAll(empty, 0755)
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"empty directory", empty, "empty"},
+		{"outside the server directories", t.TempDir(), "SERVER_IMPORT_PATHS"},
+		{"relative path", "servers/survival", "absolute"},
+		{"missing directory", filepath.Join(root, "missing"), "not an existing directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body struct {
+				Message string `json:"message"`
+			}
+			resp := doJSON(t, app, http.MethodPost, "/servers/import", importBody(tt.path), &body)
+			if resp.StatusCode != fiber.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", resp.StatusCode)
+			}
+			if !strings.Contains(body.Message, tt.want) {
+				t.Errorf("error message = %q, want it to mention %q", body.Message, tt.want)
+			}
+		})
+	}
+}
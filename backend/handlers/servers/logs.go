@@ -0,0 +1,80 @@
+package servers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// SearchServerLogs searches the server's current and rotated logs.
+// ?query= is the text to find, matched as a regular expression with
+// ?regex=true; ?since= (RFC 3339) leaves out lines written before then and
+// ?limit= caps the matches returned.
+func SearchServerLogs(c *fiber.Ctx) error {
+	server, err := logsServer(c)
+	if err != nil {
+		return err
+	}
+
+	opts := services.LogSearchOptions{
+		Query: c.Query("query"),
+		Regex: c.QueryBool("regex"),
+		Limit: c.QueryInt("limit"),
+	}
+	if since := c.Query("since"); since != "" {
+		opts.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid since",
+				"since must be an RFC 3339 time such as 2024-01-02T15:04:05Z")
+		}
+	}
+
+	result, err := services.SearchServerLogs(server, opts)
+	if errors.Is(err, services.ErrInvalidLogQuery) {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid search", err.Error())
+	}
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Search failed", err.Error())
+	}
+
+	return c.JSON(result)
+}
+
+// DownloadServerLogs sends all of the server's log files as a .tar.gz
+func DownloadServerLogs(c *fiber.Ctx) error {
+	server, err := logsServer(c)
+	if err != nil {
+		return err
+	}
+
+	c.Attachment(fmt.Sprintf("%s-logs-%s.tar.gz", server.Name, time.Now().Format("20060102-150405")))
+	c.Set(fiber.HeaderContentType, "application/gzip")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// The status is already sent, so a failure can only cut the archive short
+		if err := services.WriteServerLogArchive(server, w); err != nil {
+			log.Printf("Failed to send logs of server %s: %v", server.Name, err)
+		}
+		w.Flush()
+	})
+	return nil
+}
+
+func logsServer(c *fiber.Ctx) (*models.Server, error) {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return nil, utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found", "The requested server does not exist")
+	}
+	return &server, nil
+}
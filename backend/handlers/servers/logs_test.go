@@ -0,0 +1,92 @@
+package servers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestServerLogEndpoints(t *testing.T) {
+	testDB(t)
+
+	app := newTestApp(createTestUser(t, models.RoleAdmin))
+	app.Get("/servers/:serverId/logs/search", withServerID, SearchServerLogs)
+	app.Get("/servers/:serverId/logs/download", withServerID, DownloadServerLogs)
+
+	server := createTestServer(t, &models.Server{})
+	if err := os.MkdirAll(filepath.Join(server.Path, "logs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	logs := map[string]string{
+		"logs/2024-03-01-1.log": "[20:00:00 INFO]: Steve joined the game\n",
+		"logs/latest.log":       "[09:10:00 INFO]: Alex joined the game\n[09:20:00 INFO]: Alex left the game\n",
+	}
+	for name, content := range logs {
+		if err := os.WriteFile(filepath.Join(server.Path, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := "/servers/" + server.ID.String() + "/logs/"
+
+	var result services.LogSearchResult
+	resp := doJSON(t, app, http.MethodGet, base+"search?regex=true&query="+url.QueryEscape(`^\[\S+ INFO\]: \w+ joined`), "", &result)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("search status = %d, want 200", resp.StatusCode)
+	}
+	if len(result.Matches) != 2 || result.Matches[0].File == result.Matches[1].File {
+		t.Errorf("matches = %+v, want a join from each log", result.Matches)
+	}
+
+	for _, query := range []string{"query=", "regex=true&query=" + url.QueryEscape("(unclosed"), "query=x&since=yesterday"} {
+		if resp := doJSON(t, app, http.MethodGet, base+"search?"+query, "", nil); resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("search?%s status = %d, want 400", query, resp.StatusCode)
+		}
+	}
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, base+"download", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK || resp.Header.Get(fiber.HeaderContentType) != "application/gzip" {
+		t.Fatalf("download = %d %s, want 200 application/gzip", resp.StatusCode, resp.Header.Get(fiber.HeaderContentType))
+	}
+	if disposition := resp.Header.Get(fiber.HeaderContentDisposition); !strings.Contains(disposition, ".tar.gz") {
+		t.Errorf("Content-Disposition = %q, want a .tar.gz attachment", disposition)
+	}
+
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("download is not gzipped: %v", err)
+	}
+	archive := tar.NewReader(gz)
+	archived := 0
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("download is not a tar archive: %v", err)
+		}
+		content, _ := io.ReadAll(archive)
+		if want, exists := logs[header.Name]; !exists || string(content) != want {
+			t.Errorf("archived %s = %q, want the log file's content", header.Name, content)
+		}
+		archived++
+	}
+	if archived != len(logs) {
+		t.Errorf("%d files archived, want %d", archived, len(logs))
+	}
+}
@@ -0,0 +1,62 @@
+package servers
+
+import (
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetServerMetrics returns the server's metric history as averaged buckets.
+// "range" (default 24h) and "resolution" (default sized to the range) are Go
+// durations.
+func GetServerMetrics(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	timeRange := 24 * time.Hour
+	if value := c.Query("range"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid range",
+				"range must be a positive duration such as 24h")
+		}
+		timeRange = parsed
+	}
+
+	var resolution time.Duration
+	if value := c.Query("resolution"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid resolution",
+				"resolution must be a positive duration such as 5m")
+		}
+		resolution = parsed
+	}
+	resolution = services.MetricsResolution(timeRange, resolution)
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	to := time.Now()
+	from := to.Add(-timeRange)
+	points, err := services.ServerMetricsHistory(server.ID, from, to, resolution)
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve metrics",
+			"Unable to load the server's metric history")
+	}
+
+	return c.JSON(fiber.Map{
+		"from":       from,
+		"to":         to,
+		"resolution": resolution.String(),
+		"points":     points,
+	})
+}
@@ -0,0 +1,145 @@
+package servers
+
+import (
+	"net/http"
+	"testing"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/middleware"
+	"playpulse-panel/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newPermissionTestApp returns an app authenticated as user with a few of
+// main.go's server routes behind the same permission checks. Writing a file
+// is stood in for by a handler that always succeeds.
+func newPermissionTestApp(user models.User) *fiber.App {
+	app := newTestApp(user)
+	server := app.Group("/servers/:serverId", middleware.ServerAccessRequired())
+	server.Put("/", middleware.ServerPermissionRequired(models.ServerPermissionSettings), UpdateServer)
+	server.Delete("/", middleware.ServerOwnerRequired(), DeleteServer)
+	server.Post("/clone", middleware.ServerOwnerRequired(), CloneServer)
+	server.Post("/command", middleware.ServerPermissionRequired(models.ServerPermissionConsole), SendCommand)
+	server.Post("/start", middleware.ServerPermissionRequired(models.ServerPermissionPower), StartServer)
+	server.Patch("/properties", middleware.ServerPermissionRequired(models.ServerPermissionSettings), PatchServerProperties)
+
+	files := server.Group("/files", middleware.ServerPermissionRequired(models.ServerPermissionFiles))
+	files.Put("/*", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) })
+	return app
+}
+
+func TestConsoleOnlyMember(t *testing.T) {
+	testDB(t)
+	member := createTestUser(t, models.RoleUser)
+	server := createTestServer(t, &models.Server{})
+	testutil.GrantServerAccess(t, &member, server, models.ServerRoleMember, models.ServerPermissionConsole)
+
+	app := newPermissionTestApp(member)
+	base := "/servers/" + server.ID.String()
+
+	// The console check lets the command through to the handler, which
+	// only refuses it because the server is stopped
+	var body struct {
+		Error string `json:"error"`
+	}
+	resp := doJSON(t, app, http.MethodPost, base+"/command", `{"command": "list"}`, &body)
+	if resp.StatusCode != fiber.StatusBadRequest || body.Error != "Server not running" {
+		t.Errorf("command = %d %q, want it to reach the handler", resp.StatusCode, body.Error)
+	}
+
+	denied := []struct {
+		method, path, body string
+	}{
+		{http.MethodDelete, base + "/", ""},
+		{http.MethodPut, base + "/files/server.properties", "motd=hi"},
+		{http.MethodPost, base + "/start", ""},
+		{http.MethodPatch, base + "/properties", `{"motd": "hi"}`},
+	}
+	for _, tt := range denied {
+		if resp := doJSON(t, app, tt.method, tt.path, tt.body, nil); resp.StatusCode != fiber.StatusForbidden {
+			t.Errorf("%s %s = %d, want 403", tt.method, tt.path, resp.StatusCode)
+		}
+	}
+
+	var stored models.Server
+	if err := database.DB.First(&stored, server.ID).Error; err != nil {
+		t.Errorf("server after a refused delete: %v", err)
+	}
+}
+
+func TestSettingsOnlyMemberCannotClone(t *testing.T) {
+	testDB(t)
+	member := createTestUser(t, models.RoleUser)
+	server := createTestServer(t, &models.Server{})
+	testutil.GrantServerAccess(t, &member, server, models.ServerRoleMember, models.ServerPermissionSettings)
+
+	app := newPermissionTestApp(member)
+	base := "/servers/" + server.ID.String()
+
+	// Settings are the member's to change
+	if resp := doJSON(t, app, http.MethodPut, base+"/", `{"description": "survival"}`, nil); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("update = %d, want the settings permission to allow it", resp.StatusCode)
+	}
+
+	// A clone would copy every file and make the member its owner
+	name := "clone-" + server.Name
+	if resp := doJSON(t, app, http.MethodPost, base+"/clone", `{"name": "`+name+`"}`, nil); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("clone = %d, want 403", resp.StatusCode)
+	}
+	var clones int64
+	database.DB.Model(&models.Server{}).Where("name = ?", name).Count(&clones)
+	if clones != 0 {
+		t.Error("refused clone created a server")
+	}
+}
+
+func TestSettingsOnlyMemberCannotChangeServerCommand(t *testing.T) {
+	testDB(t)
+	member := createTestUser(t, models.RoleUser)
+	owner := createTestUser(t, models.RoleUser)
+	server := createTestServer(t, &models.Server{JavaPath: "java"})
+	testutil.GrantServerAccess(t, &member, server, models.ServerRoleMember, models.ServerPermissionSettings)
+	testutil.GrantServerAccess(t, &owner, server, models.ServerRoleOwner)
+	path := "/servers/" + server.ID.String() + "/"
+
+	// Each of these is run on the host as the panel
+	app := newPermissionTestApp(member)
+	for _, body := range []string{
+		`{"java_path": "/bin/sh"}`,
+		`{"java_args": "-XX:OnOutOfMemoryError=/tmp/payload.sh"}`,
+		`{"start_command": "-jar /tmp/payload.jar"}`,
+		`{"name": "renamed", "java_path": "/bin/sh"}`,
+	} {
+		if resp := doJSON(t, app, http.MethodPut, path, body, nil); resp.StatusCode != fiber.StatusForbidden {
+			t.Errorf("member sending %s = %d, want 403", body, resp.StatusCode)
+		}
+	}
+	var stored models.Server
+	database.DB.First(&stored, server.ID)
+	if stored.JavaPath != "java" || stored.JavaArgs != "" || stored.StartCommand != "" || stored.Name != server.Name {
+		t.Errorf("server = %+v after refused updates, want it unchanged", stored)
+	}
+
+	resp := doJSON(t, newPermissionTestApp(owner), http.MethodPut, path, `{"java_path": "/usr/lib/jvm/java-21/bin/java"}`, &stored)
+	if resp.StatusCode != fiber.StatusOK || stored.JavaPath != "/usr/lib/jvm/java-21/bin/java" {
+		t.Errorf("owner setting the Java path = %d, %q, want it changed", resp.StatusCode, stored.JavaPath)
+	}
+}
+
+func TestOwnerAndAdminHaveEveryPermission(t *testing.T) {
+	testDB(t)
+	owner := createTestUser(t, models.RoleUser)
+	admin := createTestUser(t, models.RoleAdmin)
+	server := createTestServer(t, &models.Server{})
+	testutil.GrantServerAccess(t, &owner, server, models.ServerRoleOwner)
+
+	for _, user := range []models.User{owner, admin} {
+		app := newPermissionTestApp(user)
+		resp := doJSON(t, app, http.MethodPut, "/servers/"+server.ID.String()+"/files/server.properties", "motd=hi", nil)
+		if resp.StatusCode != fiber.StatusNoContent {
+			t.Errorf("%s writing a file = %d, want it allowed", user.Role, resp.StatusCode)
+		}
+	}
+}
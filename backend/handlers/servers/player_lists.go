@@ -0,0 +1,120 @@
+package servers
+
+import (
+	"errors"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type AddPlayerListEntryRequest struct {
+	Name   string `json:"name" validate:"required_without=UUID,omitempty,max=16"`
+	UUID   string `json:"uuid" validate:"omitempty,uuid"`
+	Level  int    `json:"level" validate:"omitempty,min=1,max=4"` // ops only
+	Reason string `json:"reason" validate:"max=255"`              // bans only
+}
+
+// GetPlayerList returns the entries of the whitelist, ops or banned players
+// list
+func GetPlayerList(c *fiber.Ctx) error {
+	server, err := playerListServer(c)
+	if err != nil {
+		return err
+	}
+
+	list := c.Params("list")
+	entries, err := services.ReadPlayerList(server, list)
+	if err != nil {
+		return playerListError(err)
+	}
+
+	return c.JSON(fiber.Map{
+		"list":    list,
+		"entries": entries,
+	})
+}
+
+// AddPlayerListEntry adds a player to a list by name or UUID. Whichever is
+// missing is looked up with Mojang, and a running server picks the change
+// up straight away.
+func AddPlayerListEntry(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var req AddPlayerListEntryRequest
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+
+	server, err := playerListServer(c)
+	if err != nil {
+		return err
+	}
+
+	entry, err := services.AddToPlayerList(server, c.Params("list"), services.PlayerListAddition{
+		Name:   req.Name,
+		UUID:   req.UUID,
+		Level:  req.Level,
+		Reason: req.Reason,
+		Source: user.Username,
+	})
+	if err != nil {
+		return playerListError(err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Player added",
+		"entry":   entry,
+	})
+}
+
+// RemovePlayerListEntry removes a player, given by name or UUID, from a list
+func RemovePlayerListEntry(c *fiber.Ctx) error {
+	server, err := playerListServer(c)
+	if err != nil {
+		return err
+	}
+
+	if err := services.RemoveFromPlayerList(server, c.Params("list"), c.Params("player")); err != nil {
+		return playerListError(err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Player removed",
+	})
+}
+
+func playerListServer(c *fiber.Ctx) (*models.Server, error) {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return nil, utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found", "The requested server does not exist")
+	}
+	return &server, nil
+}
+
+// playerListError maps player list errors to API errors
+func playerListError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrUnknownPlayerList):
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Unknown player list",
+			"The list must be whitelist, ops or banned-players")
+	case errors.Is(err, services.ErrPlayerListUnsupported):
+		return utils.NewAPIError(fiber.StatusUnprocessableEntity, utils.CodeBadRequest, "Player lists not supported", err.Error())
+	case errors.Is(err, services.ErrInvalidPlayerName):
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid player", err.Error())
+	case errors.Is(err, services.ErrPlayerNotFound):
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Player not found", err.Error())
+	case errors.Is(err, services.ErrMojangRateLimited):
+		return utils.NewAPIError(fiber.StatusServiceUnavailable, utils.CodeServiceUnavailable, "Player lookup unavailable", err.Error())
+	case errors.Is(err, services.ErrPlayerNotListed):
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Player not listed", err.Error())
+	default:
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Player list update failed", err.Error())
+	}
+}
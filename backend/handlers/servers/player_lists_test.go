@@ -0,0 +1,80 @@
+package servers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPlayerListEndpoints(t *testing.T) {
+	testDB(t)
+
+	user := createTestUser(t, models.RoleAdmin)
+	app := newTestApp(user)
+	app.Get("/servers/:serverId/player-lists/:list", withServerID, GetPlayerList)
+	app.Post("/servers/:serverId/player-lists/:list", withServerID, AddPlayerListEntry)
+	app.Delete("/servers/:serverId/player-lists/:list/:player", withServerID, RemovePlayerListEntry)
+
+	// In offline mode names resolve without Mojang
+	server := createTestServer(t, &models.Server{})
+	if err := os.WriteFile(filepath.Join(server.Path, "server.properties"), []byte("online-mode=false\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	base := "/servers/" + server.ID.String() + "/player-lists/"
+
+	var added struct {
+		Entry services.PlayerListEntry `json:"entry"`
+	}
+	resp := doJSON(t, app, http.MethodPost, base+"banned-players", `{"name": "Griefer", "reason": "Broke the spawn"}`, &added)
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("add status = %d, want 201", resp.StatusCode)
+	}
+	if added.Entry.UUID == "" || added.Entry.Source != user.Username || added.Entry.Reason != "Broke the spawn" {
+		t.Errorf("entry = %+v, want a UUID and the ban's source and reason", added.Entry)
+	}
+
+	data, err := os.ReadFile(filepath.Join(server.Path, "banned-players.json"))
+	if err != nil || !json.Valid(data) {
+		t.Fatalf("banned-players.json = %s, %v, want valid JSON", data, err)
+	}
+
+	var list struct {
+		List    string                     `json:"list"`
+		Entries []services.PlayerListEntry `json:"entries"`
+	}
+	doJSON(t, app, http.MethodGet, base+"banned-players", "", &list)
+	if list.List != "banned-players" || len(list.Entries) != 1 || list.Entries[0].Name != "Griefer" {
+		t.Errorf("list = %+v, want Griefer banned", list)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"remove", http.MethodDelete, base + "banned-players/griefer", "", fiber.StatusOK},
+		{"remove again", http.MethodDelete, base + "banned-players/griefer", "", fiber.StatusNotFound},
+		{"unknown list", http.MethodGet, base + "usercache", "", fiber.StatusNotFound},
+		{"no player", http.MethodPost, base + "whitelist", `{}`, fiber.StatusBadRequest},
+		{"bad op level", http.MethodPost, base + "ops", `{"name": "Steve", "level": 5}`, fiber.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if resp := doJSON(t, app, tt.method, tt.path, tt.body, nil); resp.StatusCode != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+
+	bedrock := createTestServer(t, &models.Server{Type: models.ServerTypeBedrock})
+	if resp := doJSON(t, app, http.MethodGet, "/servers/"+bedrock.ID.String()+"/player-lists/whitelist", "", nil); resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Errorf("bedrock server: status = %d, want 422", resp.StatusCode)
+	}
+}
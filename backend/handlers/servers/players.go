@@ -0,0 +1,92 @@
+package servers
+
+import (
+	"errors"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetPlayers lists the players connected to the server
+func GetPlayers(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	players := services.OnlinePlayers(&server)
+
+	return c.JSON(fiber.Map{
+		"players": players,
+		"online":  len(players),
+	})
+}
+
+// PlayerAction kicks, bans, unbans, ops or deops a player. The action comes
+// from the route; kick and ban take an optional reason in the body.
+func PlayerAction(action string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := c.Locals("user").(models.User)
+		serverId := c.Locals("serverId").(uuid.UUID)
+
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid request body",
+					err.Error())
+			}
+		}
+
+		var server models.Server
+		if err := database.DB.First(&server, serverId).Error; err != nil {
+			return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+				"The requested server does not exist")
+		}
+
+		if server.Status != models.ServerStatusRunning {
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Server not running",
+				"The server must be running to manage players")
+		}
+
+		player := c.Params("player")
+		command, confirmed, err := services.PlayerAction(&server, action, player, req.Reason)
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrInvalidPlayerName):
+				return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid player name",
+					"Player names are 1 to 16 letters, digits or underscores")
+			case errors.Is(err, services.ErrPlayerNotFound):
+				return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Player not found", err.Error())
+			case errors.Is(err, services.ErrMojangRateLimited):
+				return utils.NewAPIError(fiber.StatusServiceUnavailable, utils.CodeServiceUnavailable, "Player lookup unavailable",
+					err.Error())
+			case errors.Is(err, services.ErrPlayerActionUnsupported):
+				return utils.NewAPIError(fiber.StatusUnprocessableEntity, utils.CodeBadRequest, "Action not supported",
+					"This server type does not support "+action)
+			default:
+				return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Command failed",
+					err.Error())
+			}
+		}
+
+		services.RecordCommand(server.ID, user.ID, command, "api")
+
+		return c.JSON(fiber.Map{
+			"message":   "Player action sent",
+			"action":    action,
+			"player":    player,
+			"command":   command,
+			"confirmed": confirmed,
+		})
+	}
+}
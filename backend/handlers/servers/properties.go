@@ -0,0 +1,70 @@
+package servers
+
+import (
+	"errors"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetServerProperties returns server.properties as a typed key/value map
+func GetServerProperties(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	properties, err := services.ReadServerProperties(&server)
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Read failed",
+			"Unable to read server.properties")
+	}
+
+	return c.JSON(fiber.Map{
+		"properties": properties,
+	})
+}
+
+// PatchServerProperties validates and writes individual server.properties
+// keys. Changes apply on the next server start.
+func PatchServerProperties(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	var patch map[string]interface{}
+	if err := c.BodyParser(&patch); err != nil || len(patch) == 0 {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid request body",
+			"Send a JSON object of the properties to change")
+	}
+
+	properties, err := services.PatchServerProperties(&server, patch)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidProperty):
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid property", err.Error())
+		case errors.Is(err, services.ErrPropertyPortConflict):
+			return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Port conflict", err.Error())
+		default:
+			return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Write failed",
+				"Unable to write server.properties")
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"properties": properties,
+		"restart":    server.Status == models.ServerStatusRunning,
+	})
+}
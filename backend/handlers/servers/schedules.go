@@ -0,0 +1,161 @@
+package servers
+
+import (
+	"errors"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type ScheduleRequest struct {
+	Name            string                `json:"name" validate:"required,min=1,max=100"`
+	Action          models.ScheduleAction `json:"action" validate:"required"`
+	Command         string                `json:"command"`
+	CronPattern     string                `json:"cron_pattern" validate:"required"`
+	RestartWarnings string                `json:"restart_warnings"`
+	IsActive        *bool                 `json:"is_active"`
+}
+
+// GetSchedules returns a server's schedules
+func GetSchedules(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	var schedules []models.Schedule
+	if err := database.DB.Where("server_id = ?", serverId).Order("name ASC").Find(&schedules).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error",
+			"Unable to retrieve schedules")
+	}
+
+	return c.JSON(fiber.Map{
+		"schedules": schedules,
+		"total":     len(schedules),
+	})
+}
+
+// GetSchedule returns one of a server's schedules
+func GetSchedule(c *fiber.Ctx) error {
+	schedule, errResponse := findSchedule(c)
+	if schedule == nil {
+		return errResponse
+	}
+
+	return c.JSON(schedule)
+}
+
+// CreateSchedule adds a schedule to a server
+func CreateSchedule(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	var req ScheduleRequest
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+
+	schedule := models.Schedule{ServerID: serverId, IsActive: true}
+	applyScheduleRequest(&schedule, req)
+
+	if err := services.PrepareSchedule(&schedule, time.Now()); err != nil {
+		return scheduleError(err)
+	}
+
+	// Create skips zero values, so an inactive schedule would come back active
+	if err := database.DB.Create(&schedule).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Schedule creation failed",
+			"Unable to create schedule")
+	}
+	if !schedule.IsActive {
+		database.DB.Model(&schedule).Update("is_active", false)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(schedule)
+}
+
+// UpdateSchedule replaces a schedule's settings. Its next run is worked out
+// again from the new pattern.
+func UpdateSchedule(c *fiber.Ctx) error {
+	schedule, errResponse := findSchedule(c)
+	if schedule == nil {
+		return errResponse
+	}
+
+	var req ScheduleRequest
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+
+	applyScheduleRequest(schedule, req)
+
+	if err := services.PrepareSchedule(schedule, time.Now()); err != nil {
+		return scheduleError(err)
+	}
+
+	if err := database.DB.Save(schedule).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Update failed",
+			"Unable to update schedule")
+	}
+
+	return c.JSON(schedule)
+}
+
+// DeleteSchedule removes a schedule from a server
+func DeleteSchedule(c *fiber.Ctx) error {
+	schedule, errResponse := findSchedule(c)
+	if schedule == nil {
+		return errResponse
+	}
+
+	if err := database.DB.Delete(schedule).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Deletion failed",
+			"Unable to delete schedule")
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Schedule deleted successfully",
+	})
+}
+
+// findSchedule loads the schedule named by the scheduleId route parameter,
+// scoped to the route's server. On failure it returns nil and the error to
+// return.
+func findSchedule(c *fiber.Ctx) (*models.Schedule, error) {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	scheduleId, err := uuid.Parse(c.Params("scheduleId"))
+	if err != nil {
+		return nil, utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid schedule ID",
+			"Schedule ID must be a valid UUID")
+	}
+
+	var schedule models.Schedule
+	if err := database.DB.Where("id = ? AND server_id = ?", scheduleId, serverId).First(&schedule).Error; err != nil {
+		return nil, utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Schedule not found",
+			"The requested schedule does not exist")
+	}
+
+	return &schedule, nil
+}
+
+func applyScheduleRequest(schedule *models.Schedule, req ScheduleRequest) {
+	schedule.Name = req.Name
+	schedule.Action = req.Action
+	schedule.Command = req.Command
+	schedule.CronPattern = req.CronPattern
+	schedule.RestartWarnings = req.RestartWarnings
+	if req.IsActive != nil {
+		schedule.IsActive = *req.IsActive
+	}
+}
+
+func scheduleError(err error) error {
+	if errors.Is(err, services.ErrInvalidSchedule) {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid schedule", err.Error())
+	}
+	return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Schedule update failed",
+		"Unable to save schedule")
+}
@@ -1,13 +1,17 @@
 package servers
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"playpulse-panel/config"
 	"playpulse-panel/database"
+	"playpulse-panel/logger"
 	"playpulse-panel/models"
 	"playpulse-panel/services"
 	"playpulse-panel/utils"
@@ -22,62 +26,89 @@ type CreateServerRequest struct {
 	Description  string             `json:"description"`
 	Type         models.ServerType  `json:"type" validate:"required"`
 	Version      string             `json:"version"`
-	Port         int                `json:"port" validate:"required,min=1024,max=65535"`
+	Port         int                `json:"port" validate:"omitempty,min=1024,max=65535"`
 	MemoryLimit  int64              `json:"memory_limit" validate:"required,min=512"`
 	DiskLimit    int64              `json:"disk_limit" validate:"required,min=1024"`
 	CPULimit     float64            `json:"cpu_limit" validate:"min=0,max=100"`
 	JavaPath     string             `json:"java_path"`
 	JavaArgs     string             `json:"java_args"`
+	JVMPreset    string             `json:"jvm_preset"`
 	AutoRestart  bool               `json:"auto_restart"`
 	AutoStart    bool               `json:"auto_start"`
+	AcceptEULA   bool               `json:"accept_eula"` // the creating user accepts the Minecraft EULA
 }
 
 type UpdateServerRequest struct {
-	Name         string             `json:"name" validate:"min=1,max=100"`
+	Name         string             `json:"name" validate:"omitempty,max=100"`
 	Description  string             `json:"description"`
 	Version      string             `json:"version"`
-	MemoryLimit  int64              `json:"memory_limit" validate:"min=512"`
-	DiskLimit    int64              `json:"disk_limit" validate:"min=1024"`
+	MemoryLimit  int64              `json:"memory_limit" validate:"omitempty,min=512"`
+	DiskLimit    int64              `json:"disk_limit" validate:"omitempty,min=1024"`
 	CPULimit     float64            `json:"cpu_limit" validate:"min=0,max=100"`
 	JavaPath     string             `json:"java_path"`
 	JavaArgs     string             `json:"java_args"`
+	JVMPreset    *string            `json:"jvm_preset"`
 	StartCommand string             `json:"start_command"`
 	StopCommand  string             `json:"stop_command"`
+	StopTimeout  int                `json:"stop_timeout" validate:"omitempty,min=5,max=3600"`
 	AutoRestart  *bool              `json:"auto_restart"`
 	AutoStart    *bool              `json:"auto_start"`
+
+	// Seconds between stats samples, 0 for the panel default
+	MetricsInterval *int `json:"metrics_interval" validate:"omitempty,min=0,max=3600"`
+
+	// Hibernate when no players have been online for HibernateIdleMinutes
+	HibernateEnabled     *bool `json:"hibernate_enabled"`
+	HibernateIdleMinutes *int  `json:"hibernate_idle_minutes" validate:"omitempty,min=0,max=1440"`
+
+	// Scheduled backups every BackupIntervalMinutes, or on BackupCron when
+	// set, keeping BackupRetention of them; 0 and empty use the panel defaults
+	BackupEnabled         *bool   `json:"backup_enabled"`
+	BackupIntervalMinutes *int    `json:"backup_interval_minutes" validate:"omitempty,min=0,max=43200"`
+	BackupCron            *string `json:"backup_cron"`
+	BackupRetention       *int    `json:"backup_retention" validate:"omitempty,min=0,max=1000"`
 }
 
-// GetServers returns all servers for the current user
+// GetServers returns the servers of the current user, sorted by ?sort=
+// (name, type, status, port, created_at or updated_at; prefix - for
+// descending). ?status= and ?tag= filter them, and ?group=tag also returns
+// them grouped by tag. With ?page= or ?limit= one page is returned with the
+// total count; otherwise all servers are.
 func GetServers(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.User)
-	
-	var servers []models.Server
-	query := database.DB.Preload("Users").Preload("Metrics", func(db *gorm.DB) *gorm.DB {
-		return db.Order("timestamp DESC").Limit(1)
-	})
 
-	if user.Role == models.RoleAdmin {
-		// Admin can see all servers
-		query = query.Find(&servers)
-	} else {
-		// Regular users can only see servers they have access to
-		query = query.Joins("JOIN user_servers ON user_servers.server_id = servers.id").
-			Where("user_servers.user_id = ?", user.ID).Find(&servers)
+	page, err := services.ListServers(user, services.ServerListOptions{
+		Tag:    c.Query("tag"),
+		Status: c.Query("status"),
+		Sort:   c.Query("sort"),
+		Page:   c.QueryInt("page"),
+		Limit:  c.QueryInt("limit"),
+	})
+	if errors.Is(err, services.ErrInvalidServerList) {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid query", err.Error())
 	}
-
-	if query.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Database error",
-			"message": "Unable to retrieve servers",
-		})
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error",
+			"Unable to retrieve servers")
 	}
 
-	// Update server status and metrics
-	for i := range servers {
-		services.UpdateServerStatus(&servers[i])
+	// Statuses are checked in the background; this response has the stored ones
+	services.RefreshServerStatuses(page.Servers)
+
+	if c.Query("group") == "tag" {
+		page.Groups = services.GroupServersByTag(page.Servers)
+	}
+	if page.Limit > 0 {
+		return c.JSON(page)
+	}
+	if page.Groups != nil {
+		return c.JSON(fiber.Map{
+			"servers": page.Servers,
+			"groups":  page.Groups,
+		})
 	}
 
-	return c.JSON(servers)
+	return c.JSON(page.Servers)
 }
 
 // GetServer returns a specific server
@@ -97,10 +128,8 @@ func GetServer(c *fiber.Ctx) error {
 		First(&server, serverId).Error
 
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error":   "Server not found",
-			"message": "The requested server does not exist",
-		})
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
 	}
 
 	// Update server status
@@ -114,45 +143,88 @@ func CreateServer(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.User)
 
 	var req CreateServerRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request body",
-			"message": err.Error(),
-		})
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
 	}
 
-	// Check if port is already in use
-	var existingServer models.Server
-	err := database.DB.Where("port = ?", req.Port).First(&existingServer).Error
-	if err == nil {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"error":   "Port already in use",
-			"message": fmt.Sprintf("Port %d is already used by another server", req.Port),
-		})
+	cfg, _ := config.Load()
+
+	server, createErr := createServer(user, req, cfg, cfg.GameServers.PortRangeStart, cfg.GameServers.PortRangeEnd)
+	if createErr != nil {
+		return createErr
+	}
+
+	// Download server jar based on type
+	go services.SetupServerJar(server)
+
+	// Create audit log
+	auditLog := models.AuditLog{
+		UserID:    user.ID,
+		ServerID:  &server.ID,
+		Action:    "server_create",
+		Details:   fmt.Sprintf("Created server: %s", server.Name),
+		IPAddress: c.IP(),
+		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
+	}
+	database.DB.Create(&auditLog)
+	logEULAAcceptance(c, user, server)
+
+	return c.Status(fiber.StatusCreated).JSON(server)
+}
+
+// createServer allocates a port from [portStart, portEnd] when none is
+// given, creates the server directory and record and grants the user access.
+// Installing the server software is left to the caller.
+func createServer(user models.User, req CreateServerRequest, cfg *config.Config, portStart, portEnd int) (*models.Server, *utils.APIError) {
+	// Refuse versions the server software can't be installed for up front,
+	// rather than failing the download later
+	if err := services.ValidateServerVersion(req.Type, req.Version); err != nil {
+		return nil, utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Unsupported version", err.Error()).
+			WithDetail("supported_versions", services.SupportedVersions(req.Type))
+	}
+
+	if req.Port == 0 {
+		// Allocate the next free port from the configured range
+		port, err := services.AllocatePort(portStart, portEnd, req.Type)
+		if err != nil {
+			if errors.Is(err, services.ErrNoFreePort) {
+				return nil, utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "No free port", fmt.Sprintf("All ports between %d and %d are in use", portStart, portEnd))
+			}
+			return nil, utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Port allocation failed", err.Error())
+		}
+		defer services.ReleasePort(port)
+		req.Port = port
+	} else {
+		// Check if port is already in use
+		var existingServer models.Server
+		err := database.DB.Where("port = ?", req.Port).First(&existingServer).Error
+		if err == nil {
+			return nil, utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Port already in use", fmt.Sprintf("Port %d is already used by another server", req.Port))
+		}
 	}
 
 	// Generate server path
-	cfg, _ := config.Load()
 	serverPath := filepath.Join(cfg.GameServers.DefaultServerPath, utils.SanitizeFilename(req.Name))
 	
 	// Validate server path
 	if err := utils.ValidateServerPath(serverPath); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid server path",
-			"message": err.Error(),
-		})
+		return nil, utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid server path", err.Error())
 	}
 
 	// Create server directory
 	if err := utils.CreateDirectory(serverPath); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Directory creation failed",
-			"message": "Unable to create server directory",
-		})
+		return nil, utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Directory creation failed", "Unable to create server directory")
 	}
 
 	// Set default values
 	javaPath := req.JavaPath
+	if javaPath == "" && req.Type != models.ServerTypeBedrock {
+		// Pick an installed Java that can run this version, falling back to the default
+		if selected, err := services.SelectJava(req.Version); err == nil {
+			javaPath = selected
+		}
+	}
 	if javaPath == "" {
 		javaPath = cfg.GameServers.DefaultJavaPath
 	}
@@ -176,69 +248,153 @@ func CreateServer(c *fiber.Ctx) error {
 		Path:          serverPath,
 		JavaPath:      javaPath,
 		JavaArgs:      javaArgs,
+		JVMPreset:     req.JVMPreset,
 		AutoRestart:   req.AutoRestart,
 		AutoStart:     req.AutoStart,
 		BackupEnabled: true,
 	}
+	if req.AcceptEULA {
+		now := time.Now()
+		server.EULAAcceptedBy = &user.ID
+		server.EULAAcceptedAt = &now
+	}
+
+	if err := services.ValidateJVMPreset(req.JVMPreset, &server); err != nil {
+		return nil, utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid JVM preset", err.Error())
+	}
 
 	if err := database.DB.Create(&server).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Server creation failed",
-			"message": "Unable to create server record",
-		})
+		return nil, utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Server creation failed", "Unable to create server record")
+	}
+
+	// The creating user owns the server, admins included, so every server
+	// has an owner who can grant access or transfer it
+	database.DB.Create(&models.UserServer{UserID: user.ID, ServerID: server.ID, Role: models.ServerRoleOwner})
+
+	return &server, nil
+}
+
+type CreateFromTemplateRequest struct {
+	Name        string `json:"name" validate:"required,min=1,max=100"`
+	Description string `json:"description"`
+	Port        int    `json:"port" validate:"omitempty,min=1024,max=65535"`
+	AutoStart   bool   `json:"auto_start"`
+	AcceptEULA  bool   `json:"accept_eula"`
+}
+
+// CreateServerFromTemplate provisions a fully configured server from a template
+func CreateServerFromTemplate(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	templateId, err := uuid.Parse(c.Params("templateId"))
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid template ID",
+			"Template ID must be a valid UUID")
 	}
 
-	// Associate user with server (if not admin creating for others)
-	if user.Role != models.RoleAdmin {
-		database.DB.Model(&server).Association("Users").Append(&user)
+	var req CreateFromTemplateRequest
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
 	}
 
-	// Download server jar based on type
-	go services.SetupServerJar(&server)
+	var template models.ServerTemplate
+	if err := database.DB.First(&template, templateId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Template not found",
+			"The requested template does not exist")
+	}
+
+	cfg, _ := config.Load()
+
+	portStart, portEnd := cfg.GameServers.PortRangeStart, cfg.GameServers.PortRangeEnd
+	if template.PortRangeStart > 0 && template.PortRangeEnd > 0 {
+		portStart, portEnd = template.PortRangeStart, template.PortRangeEnd
+	}
+
+	server, createErr := createServer(user, CreateServerRequest{
+		Name:        req.Name,
+		Description: req.Description,
+		Type:        template.Type,
+		Version:     template.Version,
+		Port:        req.Port,
+		MemoryLimit: template.MemoryLimit,
+		DiskLimit:   template.DiskLimit,
+		CPULimit:    template.CPULimit,
+		JavaArgs:    template.JavaArgs,
+		AutoRestart: true,
+		AutoStart:   req.AutoStart,
+		AcceptEULA:  req.AcceptEULA,
+	}, cfg, portStart, portEnd)
+	if createErr != nil {
+		return createErr
+	}
+
+	plugins, err := services.QueueTemplatePlugins(server, &template)
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Plugin queueing failed",
+			err.Error())
+	}
+	server.Plugins = plugins
+
+	// Install the server software, properties and plugins in the background
+	go services.ProvisionFromTemplate(server, &template, plugins)
 
 	// Create audit log
 	auditLog := models.AuditLog{
 		UserID:    user.ID,
 		ServerID:  &server.ID,
 		Action:    "server_create",
-		Details:   fmt.Sprintf("Created server: %s", server.Name),
+		Details:   fmt.Sprintf("Created server %s from template %s", server.Name, template.Name),
 		IPAddress: c.IP(),
 		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
 	}
 	database.DB.Create(&auditLog)
+	logEULAAcceptance(c, user, server)
 
 	return c.Status(fiber.StatusCreated).JSON(server)
 }
 
+// GetJVMPresets returns the available JVM flag presets
+func GetJVMPresets(c *fiber.Ctx) error {
+	return c.JSON(services.GetJVMPresets())
+}
+
+// GetJavaInstallations lists the Java installations detected on this host.
+// Pass refresh=true to rescan.
+func GetJavaInstallations(c *fiber.Ctx) error {
+	return c.JSON(services.GetJavaInstallations(c.QueryBool("refresh")))
+}
+
 // UpdateServer updates server configuration
 func UpdateServer(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.User)
 	serverId := c.Locals("serverId").(uuid.UUID)
 
 	var req UpdateServerRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request body",
-			"message": err.Error(),
-		})
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
 	}
 
 	var server models.Server
 	if err := database.DB.First(&server, serverId).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error":   "Server not found",
-			"message": "The requested server does not exist",
-		})
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
 	}
 
-	// Check if server is running (some settings can't be changed while running)
-	if server.Status == models.ServerStatusRunning {
-		restrictedFields := []string{"memory_limit", "java_path", "java_args"}
-		// In a real implementation, you'd check which fields are being changed
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Server is running",
-			"message": "Stop the server before changing these settings",
-		})
+	// The command a server is run with runs on the host as the panel
+	if (req.JavaPath != "" || req.JavaArgs != "" || req.StartCommand != "") && !services.CanChangeServerCommand(&user, serverId) {
+		return utils.NewAPIError(fiber.StatusForbidden, utils.CodeForbidden, "Access denied",
+			"Only the server's owners can change its Java path, Java arguments or start command")
+	}
+
+	// Settings the JVM was started with can't be changed under it, whether
+	// it is still loading, running or shutting down
+	changesJVM := req.MemoryLimit > 0 || req.JavaPath != "" || req.JavaArgs != "" || req.JVMPreset != nil
+	jvmLive := server.Status == models.ServerStatusRunning || server.Status == models.ServerStatusStarting ||
+		server.Status == models.ServerStatusStopping
+	if jvmLive && changesJVM {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Server is running",
+			"Stop the server before changing these settings")
 	}
 
 	// Update fields
@@ -266,24 +422,69 @@ func UpdateServer(c *fiber.Ctx) error {
 	if req.JavaArgs != "" {
 		server.JavaArgs = req.JavaArgs
 	}
+	if req.JVMPreset != nil {
+		if err := services.ValidateJVMPreset(*req.JVMPreset, &server); err != nil {
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid JVM preset", err.Error())
+		}
+		server.JVMPreset = *req.JVMPreset
+	}
 	if req.StartCommand != "" {
 		server.StartCommand = req.StartCommand
 	}
 	if req.StopCommand != "" {
 		server.StopCommand = req.StopCommand
 	}
+	if req.StopTimeout > 0 {
+		server.StopTimeout = req.StopTimeout
+	}
 	if req.AutoRestart != nil {
 		server.AutoRestart = *req.AutoRestart
 	}
 	if req.AutoStart != nil {
 		server.AutoStart = *req.AutoStart
 	}
+	if req.MetricsInterval != nil {
+		if *req.MetricsInterval != 0 && (*req.MetricsInterval < 5 || *req.MetricsInterval > 3600) {
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid metrics interval",
+				"Metrics interval must be 0 or between 5 and 3600 seconds")
+		}
+		server.MetricsInterval = *req.MetricsInterval
+	}
+	if req.HibernateEnabled != nil {
+		server.HibernateEnabled = *req.HibernateEnabled
+	}
+	if req.HibernateIdleMinutes != nil {
+		if *req.HibernateIdleMinutes < 0 || *req.HibernateIdleMinutes > 1440 {
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid hibernation idle period",
+				"Hibernation idle period must be between 0 and 1440 minutes")
+		}
+		server.HibernateIdleMinutes = *req.HibernateIdleMinutes
+	}
+	if req.BackupEnabled != nil {
+		server.BackupEnabled = *req.BackupEnabled
+	}
+	if req.BackupIntervalMinutes != nil || req.BackupCron != nil {
+		interval, cron := server.BackupIntervalMinutes, server.BackupCron
+		if req.BackupIntervalMinutes != nil {
+			interval = *req.BackupIntervalMinutes
+		}
+		if req.BackupCron != nil {
+			cron = strings.TrimSpace(*req.BackupCron)
+		}
+		if err := services.ValidateBackupSchedule(interval, cron); err != nil {
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid backup schedule",
+				err.Error())
+		}
+		server.BackupIntervalMinutes = interval
+		server.BackupCron = cron
+	}
+	if req.BackupRetention != nil {
+		server.BackupRetention = *req.BackupRetention
+	}
 
 	if err := database.DB.Save(&server).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Update failed",
-			"message": "Unable to update server configuration",
-		})
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Update failed",
+			"Unable to update server configuration")
 	}
 
 	// Create audit log
@@ -294,12 +495,102 @@ func UpdateServer(c *fiber.Ctx) error {
 		Details:   fmt.Sprintf("Updated server configuration: %s", server.Name),
 		IPAddress: c.IP(),
 		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
 	}
 	database.DB.Create(&auditLog)
 
 	return c.JSON(server)
 }
 
+type CloneServerRequest struct {
+	Name string `json:"name" validate:"required,min=1,max=100"`
+	Port int    `json:"port" validate:"omitempty,min=1024,max=65535"`
+}
+
+// CloneServer duplicates a server's configuration and files into a new server
+func CloneServer(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	var req CloneServerRequest
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+
+	var source models.Server
+	if err := database.DB.First(&source, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	cfg, _ := config.Load()
+
+	if req.Port == 0 {
+		port, err := services.AllocatePort(cfg.GameServers.PortRangeStart, cfg.GameServers.PortRangeEnd, source.Type)
+		if err != nil {
+			if errors.Is(err, services.ErrNoFreePort) {
+				return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "No free port",
+					fmt.Sprintf("All ports between %d and %d are in use", cfg.GameServers.PortRangeStart, cfg.GameServers.PortRangeEnd))
+			}
+			return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Port allocation failed",
+				err.Error())
+		}
+		defer services.ReleasePort(port)
+		req.Port = port
+	} else {
+		var existingServer models.Server
+		if err := database.DB.Where("port = ?", req.Port).First(&existingServer).Error; err == nil {
+			return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Port already in use",
+				fmt.Sprintf("Port %d is already used by another server", req.Port))
+		}
+	}
+
+	serverPath := filepath.Join(cfg.GameServers.DefaultServerPath, utils.SanitizeFilename(req.Name))
+	if err := utils.ValidateServerPath(serverPath); err != nil {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid server path", err.Error())
+	}
+	if utils.FileExists(serverPath) {
+		return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Directory already exists",
+			"A server directory with this name already exists")
+	}
+
+	clone, err := services.CloneServer(&source, services.CloneOptions{
+		Name:          req.Name,
+		Path:          serverPath,
+		Port:          req.Port,
+		CopyPlugins:   c.Query("plugins", "false") == "true",
+		CopySchedules: c.Query("schedules", "false") == "true",
+	})
+	if err != nil && clone == nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Clone failed", err.Error())
+	}
+
+	// The cloning user owns the clone, as with a new server
+	database.DB.Create(&models.UserServer{UserID: user.ID, ServerID: clone.ID, Role: models.ServerRoleOwner})
+
+	// Create audit log
+	auditLog := models.AuditLog{
+		UserID:    user.ID,
+		ServerID:  &clone.ID,
+		Action:    "server_clone",
+		Details:   fmt.Sprintf("Cloned server %s to %s", source.Name, clone.Name),
+		IPAddress: c.IP(),
+		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
+	}
+	database.DB.Create(&auditLog)
+
+	if err != nil {
+		// The server was created but copying plugins or schedules failed
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"server":  clone,
+			"warning": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(clone)
+}
+
 // DeleteServer deletes a server
 func DeleteServer(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.User)
@@ -307,14 +598,14 @@ func DeleteServer(c *fiber.Ctx) error {
 
 	var server models.Server
 	if err := database.DB.First(&server, serverId).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error":   "Server not found",
-			"message": "The requested server does not exist",
-		})
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
 	}
 
-	// Stop server if running
-	if server.Status == models.ServerStatusRunning {
+	// Stop server if running or still starting, or stop it waking from
+	// hibernation
+	if server.Status == models.ServerStatusRunning || server.Status == models.ServerStatusStarting ||
+		server.Status == models.ServerStatusHibernating {
 		services.StopServer(&server)
 	}
 
@@ -330,10 +621,8 @@ func DeleteServer(c *fiber.Ctx) error {
 
 	// Delete server record
 	if err := database.DB.Delete(&server).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Deletion failed",
-			"message": "Unable to delete server",
-		})
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Deletion failed",
+			"Unable to delete server")
 	}
 
 	// Create audit log
@@ -343,6 +632,7 @@ func DeleteServer(c *fiber.Ctx) error {
 		Details:   fmt.Sprintf("Deleted server: %s", server.Name),
 		IPAddress: c.IP(),
 		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
 	}
 	database.DB.Create(&auditLog)
 
@@ -358,25 +648,34 @@ func StartServer(c *fiber.Ctx) error {
 
 	var server models.Server
 	if err := database.DB.First(&server, serverId).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error":   "Server not found",
-			"message": "The requested server does not exist",
-		})
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
 	}
 
 	if server.Status == models.ServerStatusRunning {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Server already running",
-			"message": "The server is already running",
-		})
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Server already running",
+			"The server is already running")
 	}
 
+	// A manual start gives a crash looping server a fresh restart budget
+	services.ResetCrashCounter(&server)
+
 	// Start server
 	if err := services.StartServer(&server); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Start failed",
-			"message": err.Error(),
-		})
+		// Another request may have started it since the status check above
+		if errors.Is(err, services.ErrServerAlreadyRunning) {
+			return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Server already running",
+				"The server is already running")
+		}
+		if errors.Is(err, services.ErrInvalidServerConfig) {
+			return utils.NewAPIError(fiber.StatusUnprocessableEntity, utils.CodeBadRequest, "Invalid server configuration",
+				err.Error())
+		}
+		if errors.Is(err, services.ErrEULANotAccepted) {
+			return utils.NewAPIError(fiber.StatusPreconditionFailed, utils.CodePreconditionFailed, "EULA not accepted",
+				"Accept the Minecraft EULA (https://aka.ms/MinecraftEULA) for this server before starting it")
+		}
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Start failed", err.Error())
 	}
 
 	// Create audit log
@@ -387,6 +686,7 @@ func StartServer(c *fiber.Ctx) error {
 		Details:   fmt.Sprintf("Started server: %s", server.Name),
 		IPAddress: c.IP(),
 		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
 	}
 	database.DB.Create(&auditLog)
 
@@ -403,25 +703,22 @@ func StopServer(c *fiber.Ctx) error {
 
 	var server models.Server
 	if err := database.DB.First(&server, serverId).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error":   "Server not found",
-			"message": "The requested server does not exist",
-		})
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
 	}
 
 	if server.Status == models.ServerStatusStopped {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Server already stopped",
-			"message": "The server is already stopped",
-		})
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Server already stopped",
+			"The server is already stopped")
 	}
 
 	// Stop server
 	if err := services.StopServer(&server); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Stop failed",
-			"message": err.Error(),
-		})
+		if errors.Is(err, services.ErrServerAlreadyStopped) {
+			return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Server already stopped",
+				"The server is already stopped")
+		}
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Stop failed", err.Error())
 	}
 
 	// Create audit log
@@ -432,6 +729,7 @@ func StopServer(c *fiber.Ctx) error {
 		Details:   fmt.Sprintf("Stopped server: %s", server.Name),
 		IPAddress: c.IP(),
 		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
 	}
 	database.DB.Create(&auditLog)
 
@@ -448,18 +746,29 @@ func RestartServer(c *fiber.Ctx) error {
 
 	var server models.Server
 	if err := database.DB.First(&server, serverId).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error":   "Server not found",
-			"message": "The requested server does not exist",
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	// ?countdown=true warns players first, like a scheduled restart
+	if c.QueryBool("countdown") {
+		go func(server models.Server) {
+			if err := services.StartRestartCountdown(&server, services.DefaultRestartWarnings); err != nil {
+				log.Printf("Restart countdown for server %s failed: %v", server.Name, err)
+			}
+		}(server)
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "Server restart countdown started",
 		})
 	}
 
+	// An immediate restart replaces any pending countdown
+	services.CancelRestartCountdown(server.ID)
+
 	// Restart server
 	if err := services.RestartServer(&server); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Restart failed",
-			"message": err.Error(),
-		})
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Restart failed", err.Error())
 	}
 
 	// Create audit log
@@ -470,6 +779,7 @@ func RestartServer(c *fiber.Ctx) error {
 		Details:   fmt.Sprintf("Restarted server: %s", server.Name),
 		IPAddress: c.IP(),
 		UserAgent: c.Get("User-Agent"),
+		RequestID: logger.RequestID(c),
 	}
 	database.DB.Create(&auditLog)
 
@@ -488,46 +798,33 @@ func SendCommand(c *fiber.Ctx) error {
 		Command string `json:"command" validate:"required"`
 	}
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid request body",
-			"message": err.Error(),
-		})
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
 	}
 
 	var server models.Server
 	if err := database.DB.First(&server, serverId).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error":   "Server not found",
-			"message": "The requested server does not exist",
-		})
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
 	}
 
-	if server.Status != models.ServerStatusRunning {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Server not running",
-			"message": "The server must be running to send commands",
-		})
+	// A server still loading already reads its console
+	if server.Status != models.ServerStatusRunning && server.Status != models.ServerStatusStarting {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Server not running",
+			"The server must be running to send commands")
 	}
 
 	// Send command to server
 	if err := services.SendServerCommand(&server, req.Command); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Command failed",
-			"message": err.Error(),
-		})
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Command failed", err.Error())
 	}
 
-	// Create audit log
-	auditLog := models.AuditLog{
-		UserID:    user.ID,
-		ServerID:  &server.ID,
-		Action:    "server_command",
-		Details:   fmt.Sprintf("Sent command to server %s: %s", server.Name, req.Command),
-		IPAddress: c.IP(),
-		UserAgent: c.Get("User-Agent"),
-	}
-	database.DB.Create(&auditLog)
+	services.RecordCommand(server.ID, user.ID, req.Command, "api")
+
+	// Audit the command without any credentials it carried, rather than
+	// the request body
+	logged, _ := services.RedactCommand(req.Command)
+	c.Locals("auditDetails", fmt.Sprintf("Sent command to server %s: %s", server.Name, logged))
 
 	return c.JSON(fiber.Map{
 		"message": "Command sent successfully",
@@ -540,10 +837,8 @@ func GetServerLogs(c *fiber.Ctx) error {
 
 	var server models.Server
 	if err := database.DB.First(&server, serverId).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error":   "Server not found",
-			"message": "The requested server does not exist",
-		})
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
 	}
 
 	// Get query parameters
@@ -557,10 +852,8 @@ func GetServerLogs(c *fiber.Ctx) error {
 	// Get logs from service
 	logs, err := services.GetServerLogs(&server, lines)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to retrieve logs",
-			"message": err.Error(),
-		})
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve logs",
+			err.Error())
 	}
 
 	return c.JSON(fiber.Map{
@@ -575,19 +868,15 @@ func GetServerStats(c *fiber.Ctx) error {
 
 	var server models.Server
 	if err := database.DB.First(&server, serverId).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error":   "Server not found",
-			"message": "The requested server does not exist",
-		})
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
 	}
 
 	// Get current stats
 	stats, err := services.GetServerStats(&server)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error":   "Failed to retrieve stats",
-			"message": err.Error(),
-		})
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Failed to retrieve stats",
+			err.Error())
 	}
 
 	return c.JSON(stats)
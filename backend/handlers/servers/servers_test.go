@@ -0,0 +1,148 @@
+package servers
+
+import (
+	"math/rand"
+	"net/http"
+	"testing"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestCreateServerFromTemplate(t *testing.T) {
+	testDB(t)
+	t.Setenv("DEFAULT_SERVER_PATH", t.TempDir())
+
+	// The other type has nothing to download, so provisioning in the
+	// background gives up without touching the network
+	portStart := 40000 + rand.Intn(10000)
+	template := models.ServerTemplate{
+		Name:           "test-" + uuid.NewString()[:8],
+		Type:           models.ServerTypeOther,
+		Version:        "1.20.4",
+		MemoryLimit:    3072,
+		JavaArgs:       "-XX:+UseG1GC",
+		PortRangeStart: portStart,
+		PortRangeEnd:   portStart + 9,
+		Plugins: []models.TemplatePlugin{
+			{Name: "LuckPerms", Version: "5.4", DownloadURL: "http://127.0.0.1:1/luckperms.jar"},
+			{Name: "EssentialsX", Version: "2.20", DownloadURL: "http://127.0.0.1:1/essentials.jar"},
+		},
+	}
+	if err := database.DB.Create(&template).Error; err != nil {
+		t.Fatalf("failed to create template: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Unscoped().Delete(&template) })
+
+	user := createTestUser(t, models.RoleUser)
+	app := newTestApp(user)
+	app.Post("/servers/from-template/:templateId", CreateServerFromTemplate)
+
+	var server models.Server
+	resp := doJSON(t, app, http.MethodPost, "/servers/from-template/"+template.ID.String(),
+		`{"name": "from-template-`+uuid.NewString()[:8]+`"}`, &server)
+	if server.ID != uuid.Nil {
+		testutil.DeleteServerOnCleanup(t, server.ID)
+	}
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("status = %d, want 201", resp.StatusCode)
+	}
+
+	if server.Port < template.PortRangeStart || server.Port > template.PortRangeEnd {
+		t.Errorf("port = %d, want one from the template's range %d-%d", server.Port, template.PortRangeStart, template.PortRangeEnd)
+	}
+	if server.MemoryLimit != template.MemoryLimit || server.JavaArgs != template.JavaArgs || server.Type != template.Type {
+		t.Errorf("server = %+v, want the template's type, memory and JVM flags", server)
+	}
+
+	var plugins []models.Plugin
+	database.DB.Where("server_id = ?", server.ID).Order("name").Find(&plugins)
+	if len(plugins) != 2 || plugins[0].Name != "EssentialsX" || plugins[1].Name != "LuckPerms" {
+		t.Fatalf("queued plugins = %+v, want the template's two plugins", plugins)
+	}
+	if plugins[1].SourceID != template.Plugins[0].DownloadURL {
+		t.Errorf("plugin source = %q, want the template's download URL", plugins[1].SourceID)
+	}
+
+	var owner models.UserServer
+	if err := database.DB.Where("server_id = ? AND user_id = ?", server.ID, user.ID).First(&owner).Error; err != nil || owner.Role != models.ServerRoleOwner {
+		t.Errorf("creator's access = %+v, %v, want owner", owner, err)
+	}
+}
+
+func TestCreateServerFromMissingTemplate(t *testing.T) {
+	testDB(t)
+
+	app := newTestApp(createTestUser(t, models.RoleUser))
+	app.Post("/servers/from-template/:templateId", CreateServerFromTemplate)
+
+	resp := doJSON(t, app, http.MethodPost, "/servers/from-template/"+uuid.NewString(), `{"name": "x"}`, nil)
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestUpdateServerRejectsJVMChangesWhileLive(t *testing.T) {
+	testDB(t)
+
+	user := createTestUser(t, models.RoleAdmin)
+	app := newTestApp(user)
+	app.Put("/servers/:serverId", withServerID, UpdateServer)
+
+	for _, status := range []models.ServerStatus{models.ServerStatusStarting, models.ServerStatusRunning, models.ServerStatusStopping} {
+		server := createTestServer(t, &models.Server{Status: status, MemoryLimit: 1024})
+		resp := doJSON(t, app, http.MethodPut, "/servers/"+server.ID.String(), `{"memory_limit": 2048}`, nil)
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("%s server: memory change status = %d, want 400", status, resp.StatusCode)
+		}
+
+		var stored models.Server
+		database.DB.First(&stored, "id = ?", server.ID)
+		if stored.MemoryLimit != 1024 {
+			t.Errorf("%s server: memory limit = %d, want it unchanged", status, stored.MemoryLimit)
+		}
+	}
+
+	stopped := createTestServer(t, &models.Server{MemoryLimit: 1024})
+	if resp := doJSON(t, app, http.MethodPut, "/servers/"+stopped.ID.String(), `{"memory_limit": 2048}`, nil); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("stopped server: memory change status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestGetServersPages(t *testing.T) {
+	testDB(t)
+
+	user := createTestUser(t, models.RoleUser)
+	for _, status := range []models.ServerStatus{models.ServerStatusRunning, models.ServerStatusRunning, models.ServerStatusStopped} {
+		server := createTestServer(t, &models.Server{Status: status})
+		testutil.GrantServerAccess(t, &user, server, models.ServerRoleMember)
+	}
+	app := newTestApp(user)
+	app.Get("/servers", GetServers)
+
+	var page services.ServerPage
+	resp := doJSON(t, app, http.MethodGet, "/servers?page=2&limit=1&status=running&sort=-name", "", &page)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if len(page.Servers) != 1 || page.Page != 2 || page.Limit != 1 || page.Total != 2 || page.Servers[0].Status != models.ServerStatusRunning {
+		t.Errorf("page = %+v, want the second of 2 running servers", page)
+	}
+
+	// Without paging the servers are listed as before
+	var servers []models.Server
+	if resp := doJSON(t, app, http.MethodGet, "/servers", "", &servers); resp.StatusCode != fiber.StatusOK || len(servers) != 3 {
+		t.Errorf("unpaged listing = %d servers (status %d), want all 3", len(servers), resp.StatusCode)
+	}
+
+	for _, query := range []string{"sort=password", "status=exploded"} {
+		if resp := doJSON(t, app, http.MethodGet, "/servers?"+query, "", nil); resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("%s status = %d, want 400", query, resp.StatusCode)
+		}
+	}
+}
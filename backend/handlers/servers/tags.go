@@ -0,0 +1,72 @@
+package servers
+
+import (
+	"errors"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type AddTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// AddServerTags adds tags to a server
+func AddServerTags(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	var req AddTagsRequest
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+	if len(req.Tags) == 0 {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid tags",
+			"At least one tag is required")
+	}
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	if err := services.AddServerTags(&server, req.Tags); err != nil {
+		return serverTagError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"tags": server.Tags,
+	})
+}
+
+// RemoveServerTag removes a tag from a server
+func RemoveServerTag(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	if err := services.RemoveServerTag(&server, c.Params("tag")); err != nil {
+		return serverTagError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"tags": server.Tags,
+	})
+}
+
+func serverTagError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, services.ErrInvalidTag) || errors.Is(err, services.ErrTooManyTags) {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid tags", err.Error())
+	}
+	return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Tag update failed",
+		"Unable to update server tags")
+}
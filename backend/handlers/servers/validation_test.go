@@ -0,0 +1,50 @@
+package servers
+
+import (
+	"net/http"
+	"testing"
+
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+)
+
+// The bodies are rejected before any lookup, so these run without a database
+func TestRequestBodiesAreValidated(t *testing.T) {
+	user := models.User{ID: uuid.New(), Role: models.RoleUser}
+	app := newTestApp(user)
+	app.Post("/servers/from-template/:templateId", CreateServerFromTemplate)
+	app.Post("/servers/:serverId/clone", withServerID, CloneServer)
+	app.Post("/servers/:serverId/command", withServerID, SendCommand)
+
+	serverPath := "/servers/" + uuid.NewString()
+	tests := []struct {
+		name  string
+		path  string
+		body  string
+		field string
+	}{
+		{"template with a privileged port", "/servers/from-template/" + uuid.NewString(), `{"name": "lobby", "port": 80}`, "port"},
+		{"template without a name", "/servers/from-template/" + uuid.NewString(), `{"port": 25565}`, "name"},
+		{"clone with a privileged port", serverPath + "/clone", `{"name": "lobby-copy", "port": 443}`, "port"},
+		{"clone with a port out of range", serverPath + "/clone", `{"name": "lobby-copy", "port": 70000}`, "port"},
+		{"clone without a name", serverPath + "/clone", `{}`, "name"},
+		{"empty command", serverPath + "/command", `{"command": ""}`, "command"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body utils.APIError
+			resp := doJSON(t, app, http.MethodPost, tt.path, tt.body, &body)
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", resp.StatusCode)
+			}
+			if body.Code != utils.CodeValidationFailed {
+				t.Errorf("code = %q, want %q", body.Code, utils.CodeValidationFailed)
+			}
+			if len(body.Fields) != 1 || body.Fields[0].Field != tt.field {
+				t.Errorf("fields = %+v, want one error for %q", body.Fields, tt.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package servers
+
+import (
+	"errors"
+	"os"
+
+	"playpulse-panel/config"
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// ImportWorld replaces a server's world with an uploaded zip. The multipart
+// "world" field holds the archive; "world_name" optionally names the world
+// folder (default "world").
+func ImportWorld(c *fiber.Ctx) error {
+	serverId := c.Locals("serverId").(uuid.UUID)
+
+	var server models.Server
+	if err := database.DB.First(&server, serverId).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+			"The requested server does not exist")
+	}
+
+	// The archive is extracted onto the server's disk, which may not be the
+	// one uploads are stored on
+	if err := utils.CheckFreeSpace(server.Path, int64(c.Request().Header.ContentLength())); err != nil {
+		return err
+	}
+
+	cfg, _ := config.Load()
+
+	upload, err := utils.SaveUpload(c, "world", cfg.Files.UploadPath, cfg.Files.MaxWorldSize)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(upload.Path)
+
+	snapshot, err := services.ImportWorld(&server, upload.Path, upload.Values["world_name"])
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrServerRunning):
+			return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Server is running",
+				"Stop the server before importing a world")
+		case errors.Is(err, services.ErrWorldMissingLevelDat),
+			errors.Is(err, services.ErrUnsafeArchivePath),
+			errors.Is(err, services.ErrInvalidWorldName):
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid world archive", err.Error())
+		case errors.Is(err, services.ErrWorldTooLarge):
+			return utils.NewAPIError(fiber.StatusRequestEntityTooLarge, utils.CodePayloadTooLarge, "World too large",
+				err.Error())
+		default:
+			return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Import failed", err.Error())
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "World imported successfully",
+		"backup":  snapshot,
+	})
+}
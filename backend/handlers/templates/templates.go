@@ -0,0 +1,171 @@
+package templates
+
+import (
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type TemplateRequest struct {
+	Name           string                  `json:"name" validate:"required,min=1,max=100"`
+	Description    string                  `json:"description"`
+	Type           models.ServerType       `json:"type" validate:"required"`
+	Version        string                  `json:"version"`
+	MemoryLimit    int64                   `json:"memory_limit" validate:"required,min=512"`
+	DiskLimit      int64                   `json:"disk_limit" validate:"required,min=1024"`
+	CPULimit       float64                 `json:"cpu_limit" validate:"min=0,max=100"`
+	JavaArgs       string                  `json:"java_args"`
+	PortRangeStart int                     `json:"port_range_start" validate:"omitempty,min=1024,max=65535"`
+	PortRangeEnd   int                     `json:"port_range_end" validate:"omitempty,min=1024,max=65535"`
+	Plugins        []models.TemplatePlugin `json:"plugins"`
+	Properties     map[string]string       `json:"properties"`
+}
+
+// GetTemplates returns all server templates
+func GetTemplates(c *fiber.Ctx) error {
+	var templates []models.ServerTemplate
+	if err := database.DB.Order("name ASC").Find(&templates).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Database error",
+			"Unable to retrieve templates")
+	}
+
+	return c.JSON(templates)
+}
+
+// GetTemplate returns a specific server template
+func GetTemplate(c *fiber.Ctx) error {
+	template, errResponse := findTemplate(c)
+	if template == nil {
+		return errResponse
+	}
+
+	return c.JSON(template)
+}
+
+// CreateTemplate creates a server template
+func CreateTemplate(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var req TemplateRequest
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+
+	template := models.ServerTemplate{CreatedBy: user.ID}
+	applyTemplateRequest(&template, req)
+
+	if err := validateTemplate(&template); err != "" {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid template", err)
+	}
+
+	if err := database.DB.Create(&template).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Template creation failed",
+			"Unable to create template")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(template)
+}
+
+// UpdateTemplate replaces a server template's settings. Servers already
+// provisioned from it are not changed.
+func UpdateTemplate(c *fiber.Ctx) error {
+	template, errResponse := findTemplate(c)
+	if template == nil {
+		return errResponse
+	}
+
+	var req TemplateRequest
+	if err := utils.ParseBody(c, &req); err != nil {
+		return err
+	}
+
+	applyTemplateRequest(template, req)
+
+	if err := validateTemplate(template); err != "" {
+		return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid template", err)
+	}
+
+	if err := database.DB.Save(template).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Update failed",
+			"Unable to update template")
+	}
+
+	return c.JSON(template)
+}
+
+// DeleteTemplate deletes a server template
+func DeleteTemplate(c *fiber.Ctx) error {
+	template, errResponse := findTemplate(c)
+	if template == nil {
+		return errResponse
+	}
+
+	if err := database.DB.Delete(template).Error; err != nil {
+		return utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal, "Deletion failed",
+			"Unable to delete template")
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Template deleted successfully",
+	})
+}
+
+// findTemplate loads the template named by the templateId route parameter.
+// On failure it returns nil and the error to return.
+func findTemplate(c *fiber.Ctx) (*models.ServerTemplate, error) {
+	templateId, err := uuid.Parse(c.Params("templateId"))
+	if err != nil {
+		return nil, utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid template ID",
+			"Template ID must be a valid UUID")
+	}
+
+	var template models.ServerTemplate
+	if err := database.DB.First(&template, templateId).Error; err != nil {
+		return nil, utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Template not found",
+			"The requested template does not exist")
+	}
+
+	return &template, nil
+}
+
+func applyTemplateRequest(template *models.ServerTemplate, req TemplateRequest) {
+	template.Name = req.Name
+	template.Description = req.Description
+	template.Type = req.Type
+	template.Version = req.Version
+	template.MemoryLimit = req.MemoryLimit
+	template.DiskLimit = req.DiskLimit
+	template.CPULimit = req.CPULimit
+	template.JavaArgs = req.JavaArgs
+	template.PortRangeStart = req.PortRangeStart
+	template.PortRangeEnd = req.PortRangeEnd
+	template.Plugins = req.Plugins
+	template.Properties = req.Properties
+}
+
+func validateTemplate(template *models.ServerTemplate) string {
+	if template.Name == "" {
+		return "Template name is required"
+	}
+	if template.Type == "" {
+		return "Server type is required"
+	}
+	if template.MemoryLimit < 512 {
+		return "Memory limit must be at least 512 MB"
+	}
+	if (template.PortRangeStart == 0) != (template.PortRangeEnd == 0) {
+		return "Port range needs both a start and an end"
+	}
+	if template.PortRangeStart > template.PortRangeEnd {
+		return "Port range start must not be after its end"
+	}
+	for _, plugin := range template.Plugins {
+		if plugin.Name == "" || plugin.DownloadURL == "" {
+			return "Every plugin needs a name and a download URL"
+		}
+	}
+	return ""
+}
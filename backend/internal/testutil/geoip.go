@@ -0,0 +1,167 @@
+package testutil
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// GeoIPNetwork is what a fixture GeoIP database lists for a network. When
+// any network has coordinates the database is a city database, otherwise a
+// country one.
+type GeoIPNetwork struct {
+	Country   string
+	Latitude  float64
+	Longitude float64
+}
+
+func (n GeoIPNetwork) hasLocation() bool {
+	return n.Latitude != 0 || n.Longitude != 0
+}
+
+// mmdbNode is a node of the fixture database's search tree. A record holds
+// one more than the data offset of the network ending there, or 0.
+type mmdbNode struct {
+	children [2]*mmdbNode
+	records  [2]int
+}
+
+func mmdbString(s string) []byte {
+	return append([]byte{2<<5 | byte(len(s))}, s...)
+}
+
+func mmdbMap(pairs int) []byte {
+	return []byte{7<<5 | byte(pairs)}
+}
+
+func mmdbDouble(v float64) []byte {
+	return binary.BigEndian.AppendUint64([]byte{3<<5 | 8}, math.Float64bits(v))
+}
+
+// mmdbUint encodes v as the unsigned type typ: 5 uint16, 6 uint32 or the
+// extended 9 uint64
+func mmdbUint(typ byte, v uint64) []byte {
+	var b []byte
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	if typ < 8 {
+		return append([]byte{typ<<5 | byte(len(b))}, b...)
+	}
+	return append([]byte{byte(len(b)), typ - 7}, b...)
+}
+
+// WriteGeoIPDatabase writes an IPv4 MaxMind database listing networks,
+// keyed by CIDR, and returns its path
+func WriteGeoIPDatabase(t testing.TB, networks map[string]GeoIPNetwork) string {
+	t.Helper()
+
+	databaseType := "GeoIP2-Country"
+	for _, network := range networks {
+		if network.hasLocation() {
+			databaseType = "GeoIP2-City"
+		}
+	}
+
+	root := &mmdbNode{}
+	var data []byte
+	for cidr, record := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ip := network.IP.To4()
+		ones, _ := network.Mask.Size()
+		bit := func(i int) int { return int(ip[i/8]>>(7-i%8)) & 1 }
+
+		node := root
+		for i := 0; i < ones-1; i++ {
+			if node.children[bit(i)] == nil {
+				node.children[bit(i)] = &mmdbNode{}
+			}
+			node = node.children[bit(i)]
+		}
+		node.records[bit(ones-1)] = len(data) + 1
+
+		if record.hasLocation() {
+			data = append(data, mmdbMap(2)...)
+		} else {
+			data = append(data, mmdbMap(1)...)
+		}
+		data = append(data, mmdbString("country")...)
+		data = append(data, mmdbMap(1)...)
+		data = append(data, mmdbString("iso_code")...)
+		data = append(data, mmdbString(record.Country)...)
+		if record.hasLocation() {
+			data = append(data, mmdbString("location")...)
+			data = append(data, mmdbMap(2)...)
+			data = append(data, mmdbString("latitude")...)
+			data = append(data, mmdbDouble(record.Latitude)...)
+			data = append(data, mmdbString("longitude")...)
+			data = append(data, mmdbDouble(record.Longitude)...)
+		}
+	}
+
+	// Number the nodes depth first from the root
+	var nodes []*mmdbNode
+	index := make(map[*mmdbNode]int)
+	var number func(node *mmdbNode)
+	number = func(node *mmdbNode) {
+		index[node] = len(nodes)
+		nodes = append(nodes, node)
+		for _, child := range node.children {
+			if child != nil {
+				number(child)
+			}
+		}
+	}
+	number(root)
+
+	// 24 bit records: a node number, the node count for nothing, or a data
+	// offset past the node count and the 16 byte separator
+	nodeCount := len(nodes)
+	var db []byte
+	for _, node := range nodes {
+		for b := 0; b < 2; b++ {
+			value := nodeCount
+			if node.children[b] != nil {
+				value = index[node.children[b]]
+			} else if node.records[b] > 0 {
+				value = nodeCount + 16 + node.records[b] - 1
+			}
+			db = append(db, byte(value>>16), byte(value>>8), byte(value))
+		}
+	}
+	db = append(db, make([]byte, 16)...)
+	db = append(db, data...)
+
+	db = append(db, "\xab\xcd\xefMaxMind.com"...)
+	db = append(db, mmdbMap(9)...)
+	for _, field := range []struct {
+		key   string
+		value []byte
+	}{
+		{"binary_format_major_version", mmdbUint(5, 2)},
+		{"binary_format_minor_version", mmdbUint(5, 0)},
+		{"build_epoch", mmdbUint(9, uint64(time.Now().Unix()))},
+		{"database_type", mmdbString(databaseType)},
+		{"description", append(append(mmdbMap(1), mmdbString("en")...), mmdbString("PlayPulse test database")...)},
+		{"ip_version", mmdbUint(5, 4)},
+		{"languages", append([]byte{1, 11 - 7}, mmdbString("en")...)},
+		{"node_count", mmdbUint(6, uint64(nodeCount))},
+		{"record_size", mmdbUint(5, 24)},
+	} {
+		db = append(db, mmdbString(field.key)...)
+		db = append(db, field.value...)
+	}
+
+	path := filepath.Join(t.TempDir(), databaseType+"-Test.mmdb")
+	if err := os.WriteFile(path, db, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
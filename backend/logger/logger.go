@@ -0,0 +1,51 @@
+package logger
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+
+	"playpulse-panel/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Init installs the structured logger as the default. Production writes JSON
+// lines; development writes human readable text. The standard log package is
+// routed through it too, so existing log.Printf calls gain levels and format.
+func Init(cfg *config.Config) {
+	opts := &slog.HandlerOptions{Level: parseLevel(cfg.Server.LogLevel)}
+
+	var handler slog.Handler
+	if cfg.IsProduction() {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	}
+
+	slog.SetDefault(slog.New(handler))
+}
+
+// RequestID returns the ID the request ID middleware assigned to c
+func RequestID(c *fiber.Ctx) string {
+	requestId, _ := c.Locals("requestId").(string)
+	return requestId
+}
+
+// Ctx returns a logger that tags every entry with the request's ID
+func Ctx(c *fiber.Ctx) *slog.Logger {
+	return slog.Default().With("request_id", RequestID(c))
+}
+
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
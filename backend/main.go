@@ -1,22 +1,34 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"playpulse-panel/config"
 	"playpulse-panel/database"
+	"playpulse-panel/handlers/admin"
 	"playpulse-panel/handlers/auth"
+	"playpulse-panel/handlers/backups"
+	"playpulse-panel/handlers/notifications"
+	"playpulse-panel/handlers/plugins"
 	"playpulse-panel/handlers/servers"
+	"playpulse-panel/handlers/templates"
+	"playpulse-panel/logger"
 	"playpulse-panel/middleware"
+	"playpulse-panel/models"
 	"playpulse-panel/services"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/websocket/v2"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
@@ -26,6 +38,9 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Structured logging; log.Printf output is routed through it too
+	logger.Init(cfg)
+
 	// Initialize database
 	if err := database.Initialize(cfg); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
@@ -42,35 +57,95 @@ func main() {
 	}
 
 	// Initialize services
+	if err := services.LoadSettings(); err != nil {
+		log.Fatalf("Failed to load settings: %v", err)
+	}
 	services.InitializeBackupService(cfg)
-	services.StartMetricsCollector()
+	services.InitializeNotificationService(cfg)
+	services.InitializeEmailService(cfg)
+	services.InitializeOAuth(cfg)
+	services.StartMetricWriter()
+	services.StartMetricsCollector(cfg)
+	services.InitializeHealthChecks(cfg)
+	services.InitializeResourceLimits(cfg)
+	services.InitializeServerRuntime(cfg)
+	services.InitializeDiskMonitor(cfg)
+	services.InitializeMetricsRetention(cfg)
+	services.InitializeAuditRetention(cfg)
+	services.InitializeScheduler()
+	services.InitializePluginUpdater(cfg)
+	services.InitializeHibernation()
+	services.InitializeNodes(cfg)
+	services.InitializeMarketplace()
+
+	if err := services.RegisterDatabaseMetrics(); err != nil {
+		log.Printf("Failed to register database metrics: %v", err)
+	}
+
+	// Start SFTP server
+	if cfg.Files.SFTP.Enabled {
+		sftpServer, err := services.NewSFTPServer(cfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize SFTP server: %v", err)
+		}
+		go func() {
+			if err := sftpServer.ListenAndServe(); err != nil {
+				log.Printf("SFTP server stopped: %v", err)
+			}
+		}()
+	}
 
 	// Create Fiber app
+	// Bodies are streamed so uploads go to disk instead of memory; see
+	// middleware.BodyLimit for the size caps
 	app := fiber.New(fiber.Config{
-		ErrorHandler: middleware.ErrorHandler,
-		BodyLimit:    100 * 1024 * 1024, // 100MB
+		ErrorHandler:      middleware.ErrorHandler,
+		BodyLimit:         int(cfg.Files.MaxFileSize),
+		StreamRequestBody: true,
 	})
 
 	// Setup middleware
 	middleware.SetupMiddleware(app, cfg)
 
-	// Health check endpoint
+	// Health check endpoints. /health/live only proves the process is
+	// serving; /health reports readiness of each subsystem.
+	app.Get("/health/live", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"status": "ok"})
+	})
 	app.Get("/health", func(c *fiber.Ctx) error {
-		if err := database.Health(); err != nil {
-			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
-				"status":   "error",
-				"database": "disconnected",
-				"error":    err.Error(),
-			})
+		report := services.CheckHealth(c.UserContext())
+
+		status := fiber.StatusOK
+		if report.Status == "down" {
+			status = fiber.StatusServiceUnavailable
 		}
 
-		return c.JSON(fiber.Map{
-			"status":   "ok",
-			"database": "connected",
-			"version":  "1.0.0",
+		return c.Status(status).JSON(fiber.Map{
+			"status":     report.Status,
+			"degraded":   report.Degraded,
+			"subsystems": report.Subsystems,
+			"checked_at": report.CheckedAt,
+			"version":    "1.0.0",
 		})
 	})
 
+	// Prometheus metrics endpoint
+	if cfg.Monitoring.EnableMetrics {
+		metricsHandler := adaptor.HTTPHandler(promhttp.HandlerFor(services.MetricsRegistry, promhttp.HandlerOpts{}))
+		if cfg.Monitoring.MetricsAdminOnly {
+			app.Get("/metrics", middleware.AuthRequired(), middleware.AdminRequired(), metricsHandler)
+		} else {
+			app.Get("/metrics", metricsHandler)
+		}
+	}
+
+	// The node event stream is a WebSocket under the admin routes. Its
+	// ?token= has to become the Authorization header before AuthRequired
+	// runs for the protected routes.
+	if services.NodeManager() != nil {
+		app.Use(cfg.Server.APIPrefix+"/admin/nodes/events", middleware.WebSocketUpgrade())
+	}
+
 	// API routes
 	api := app.Group(cfg.Server.APIPrefix)
 
@@ -84,92 +159,208 @@ func main() {
 			"author":      "hhexlorddev",
 		})
 	})
+	public.Get("/settings", admin.GetPublicSettings)
 
 	// Auth routes
 	authRoutes := api.Group("/auth")
-	authRoutes.Post("/login", auth.Login)
-	authRoutes.Post("/register", auth.Register)
+	authRoutes.Post("/login", middleware.AuthRateLimit(cfg), auth.Login)
+	authRoutes.Post("/register", middleware.AuthRateLimit(cfg), auth.Register)
 	authRoutes.Post("/refresh", auth.RefreshToken)
+	authRoutes.Post("/verify-email", middleware.AuthRateLimit(cfg), auth.VerifyEmail)
+	authRoutes.Post("/resend-verification", middleware.AuthRateLimit(cfg), auth.ResendVerification)
+	authRoutes.Post("/forgot-password", middleware.RateLimit(5, 15*time.Minute), auth.ForgotPassword)
+	authRoutes.Post("/reset-password", middleware.RateLimit(10, 15*time.Minute), auth.ResetPassword)
+	authRoutes.Get("/oauth/providers", auth.GetOAuthProviders)
+	authRoutes.Get("/oauth/:provider/start", middleware.AuthRateLimit(cfg), auth.OAuthStart)
+	authRoutes.Get("/oauth/:provider/callback", middleware.AuthRateLimit(cfg), auth.OAuthCallback)
 
 	// Protected routes
-	protected := api.Group("/", middleware.AuthRequired())
+	protected := api.Group("/", middleware.AuthRequired(), middleware.UserRateLimit(cfg))
 	
 	// Auth protected routes
 	authProtected := protected.Group("/auth")
 	authProtected.Post("/logout", auth.Logout)
 	authProtected.Get("/me", auth.Me)
+	authProtected.Get("/me/export", auth.ExportData)
+	authProtected.Delete("/me", middleware.RateLimit(5, 15*time.Minute), auth.DeleteAccount)
 	authProtected.Put("/profile", middleware.AuditLog("profile_update"), auth.UpdateProfile)
 	authProtected.Put("/password", middleware.AuditLog("password_change"), auth.ChangePassword)
+	authProtected.Get("/sessions", auth.GetSessions)
+	authProtected.Delete("/sessions", auth.RevokeOtherSessions)
+	authProtected.Delete("/sessions/:id", auth.RevokeSession)
+	authProtected.Get("/sftp-keys", auth.GetSFTPKeys)
+	authProtected.Post("/sftp-keys", middleware.AuditLog("sftp_key_add"), auth.AddSFTPKey)
+	authProtected.Delete("/sftp-keys/:id", middleware.AuditLog("sftp_key_delete"), auth.DeleteSFTPKey)
+	authProtected.Get("/api-keys", auth.GetAPIKeys)
+	authProtected.Post("/api-keys", middleware.AuditLog("api_key_create"), auth.CreateAPIKey)
+	authProtected.Post("/api-keys/:id/rotate", middleware.AuditLog("api_key_rotate"), auth.RotateAPIKey)
+	authProtected.Delete("/api-keys/:id", middleware.AuditLog("api_key_revoke"), auth.RevokeAPIKey)
 
 	// Server routes
 	serverRoutes := protected.Group("/servers")
 	serverRoutes.Get("/", servers.GetServers)
-	serverRoutes.Post("/", middleware.AuditLog("server_create"), servers.CreateServer)
+	serverRoutes.Post("/", middleware.Idempotent("server_create"), middleware.AuditLog("server_create"), servers.CreateServer)
+	serverRoutes.Get("/jvm-presets", servers.GetJVMPresets)
+	serverRoutes.Post("/bulk", servers.BulkServerAction)
+	serverRoutes.Post("/import", middleware.AdminRequired(), middleware.AuditLog("server_import"), servers.ImportServer)
+	serverRoutes.Post("/from-template/:templateId", middleware.AuditLog("server_create"), servers.CreateServerFromTemplate)
 
 	// Server-specific routes (require server access)
 	serverSpecific := serverRoutes.Group("/:serverId", middleware.ServerAccessRequired())
 	serverSpecific.Get("/", servers.GetServer)
-	serverSpecific.Put("/", middleware.AuditLog("server_update"), servers.UpdateServer)
-	serverSpecific.Delete("/", middleware.AuditLog("server_delete"), servers.DeleteServer)
+	serverSpecific.Put("/", middleware.ServerPermissionRequired(models.ServerPermissionSettings), middleware.AuditLog("server_update"), servers.UpdateServer)
+	serverSpecific.Delete("/", middleware.ServerOwnerRequired(), middleware.AuditLog("server_delete"), servers.DeleteServer)
+	serverSpecific.Post("/clone", middleware.ServerOwnerRequired(), middleware.AuditLog("server_clone"), servers.CloneServer)
+
+	// Server tags
+	serverSpecific.Post("/tags", middleware.ServerPermissionRequired(models.ServerPermissionSettings), middleware.AuditLog("server_tags_add"), servers.AddServerTags)
+	serverSpecific.Delete("/tags/:tag", middleware.ServerPermissionRequired(models.ServerPermissionSettings), middleware.AuditLog("server_tag_remove"), servers.RemoveServerTag)
+
+	// Server access
+	serverSpecific.Get("/users", middleware.ServerOwnerRequired(), servers.GetServerUsers)
+	serverSpecific.Post("/users", middleware.ServerOwnerRequired(), servers.GrantServerAccess)
+	serverSpecific.Delete("/users/:userId", middleware.ServerOwnerRequired(), servers.RevokeServerAccess)
+	serverSpecific.Post("/transfer", middleware.ServerOwnerRequired(), servers.TransferServerOwnership)
 	
 	// Server control
-	serverSpecific.Post("/start", middleware.AuditLog("server_start"), servers.StartServer)
-	serverSpecific.Post("/stop", middleware.AuditLog("server_stop"), servers.StopServer)
-	serverSpecific.Post("/restart", middleware.AuditLog("server_restart"), servers.RestartServer)
-	serverSpecific.Post("/command", middleware.AuditLog("server_command"), servers.SendCommand)
+	serverSpecific.Post("/eula", middleware.ServerPermissionRequired(models.ServerPermissionPower), servers.AcceptServerEULA)
+	serverSpecific.Post("/start", middleware.ServerPermissionRequired(models.ServerPermissionPower), middleware.AuditLog("server_start"), servers.StartServer)
+	serverSpecific.Post("/stop", middleware.ServerPermissionRequired(models.ServerPermissionPower), middleware.AuditLog("server_stop"), servers.StopServer)
+	serverSpecific.Post("/restart", middleware.ServerPermissionRequired(models.ServerPermissionPower), middleware.AuditLog("server_restart"), servers.RestartServer)
+	serverSpecific.Post("/command", middleware.ServerPermissionRequired(models.ServerPermissionConsole), middleware.AuditLog("server_command"), servers.SendCommand)
+	serverSpecific.Get("/commands/history", middleware.ServerPermissionRequired(models.ServerPermissionConsole), servers.GetCommandHistory)
+	serverSpecific.Post("/commands/history/:id/replay", middleware.ServerPermissionRequired(models.ServerPermissionConsole), middleware.AuditLog("server_command_replay"), servers.ReplayCommand)
 	
 	// Server monitoring
-	serverSpecific.Get("/logs", servers.GetServerLogs)
+	serverSpecific.Get("/logs", middleware.ServerPermissionRequired(models.ServerPermissionConsole), servers.GetServerLogs)
+	serverSpecific.Get("/logs/search", middleware.ServerPermissionRequired(models.ServerPermissionConsole), servers.SearchServerLogs)
+	serverSpecific.Get("/logs/download", middleware.ServerPermissionRequired(models.ServerPermissionConsole), middleware.AuditLog("logs_download"), servers.DownloadServerLogs)
+	serverSpecific.Get("/crash-reports", middleware.ServerPermissionRequired(models.ServerPermissionConsole), servers.GetCrashReports)
+	serverSpecific.Get("/crash-reports/:reportId", middleware.ServerPermissionRequired(models.ServerPermissionConsole), servers.GetCrashReport)
 	serverSpecific.Get("/stats", servers.GetServerStats)
+	serverSpecific.Get("/metrics", servers.GetServerMetrics)
+
+	// Player management
+	serverSpecific.Get("/players", servers.GetPlayers)
+	serverSpecific.Post("/players/:player/kick", middleware.ServerPermissionRequired(models.ServerPermissionConsole), middleware.AuditLog("player_kick"), servers.PlayerAction(services.PlayerActionKick))
+	serverSpecific.Post("/players/:player/ban", middleware.ServerPermissionRequired(models.ServerPermissionConsole), middleware.AuditLog("player_ban"), servers.PlayerAction(services.PlayerActionBan))
+	serverSpecific.Post("/players/:player/unban", middleware.ServerPermissionRequired(models.ServerPermissionConsole), middleware.AuditLog("player_unban"), servers.PlayerAction(services.PlayerActionUnban))
+	serverSpecific.Post("/players/:player/op", middleware.ServerPermissionRequired(models.ServerPermissionConsole), middleware.AuditLog("player_op"), servers.PlayerAction(services.PlayerActionOp))
+	serverSpecific.Post("/players/:player/deop", middleware.ServerPermissionRequired(models.ServerPermissionConsole), middleware.AuditLog("player_deop"), servers.PlayerAction(services.PlayerActionDeop))
+	serverSpecific.Get("/player-lists/:list", middleware.ServerPermissionRequired(models.ServerPermissionConsole), servers.GetPlayerList)
+	serverSpecific.Post("/player-lists/:list", middleware.ServerPermissionRequired(models.ServerPermissionConsole), middleware.AuditLog("player_list_add"), servers.AddPlayerListEntry)
+	serverSpecific.Delete("/player-lists/:list/:player", middleware.ServerPermissionRequired(models.ServerPermissionConsole), middleware.AuditLog("player_list_remove"), servers.RemovePlayerListEntry)
+
+	// server.properties editor
+	serverSpecific.Get("/properties", middleware.ServerPermissionRequired(models.ServerPermissionSettings), servers.GetServerProperties)
+	serverSpecific.Patch("/properties", middleware.ServerPermissionRequired(models.ServerPermissionSettings), middleware.AuditLog("server_properties_update"), servers.PatchServerProperties)
+
+	// World import
+	serverSpecific.Post("/world/import", middleware.ServerPermissionRequired(models.ServerPermissionFiles), middleware.UploadRateLimit(cfg), middleware.UploadLimit(cfg.Files.MaxWorldSize), middleware.DiskQuotaRequired(), middleware.AuditLog("world_import"), servers.ImportWorld)
 
 	// File management routes (to be implemented)
-	fileRoutes := serverSpecific.Group("/files")
+	fileRoutes := serverSpecific.Group("/files", middleware.ServerPermissionRequired(models.ServerPermissionFiles), middleware.UploadRateLimit(cfg), middleware.DiskQuotaRequired())
 	fileRoutes.Get("/", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"message": "File management routes to be implemented"})
 	})
 
 	// Plugin management routes (to be implemented)
-	pluginRoutes := serverSpecific.Group("/plugins")
+	pluginRoutes := serverSpecific.Group("/plugins", middleware.ServerPermissionRequired(models.ServerPermissionPlugins), middleware.DiskQuotaRequired())
 	pluginRoutes.Get("/", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"message": "Plugin management routes to be implemented"})
 	})
-
-	// Backup routes (to be implemented)
-	backupRoutes := serverSpecific.Group("/backups")
-	backupRoutes.Get("/", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"message": "Backup routes to be implemented"})
-	})
-
-	// Schedule routes (to be implemented)
-	scheduleRoutes := serverSpecific.Group("/schedules")
-	scheduleRoutes.Get("/", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"message": "Schedule routes to be implemented"})
-	})
+	pluginRoutes.Post("/marketplace", middleware.AuditLog("plugin_install"), plugins.InstallMarketplacePlugin)
+	pluginRoutes.Get("/updates", plugins.GetPluginUpdates)
+	pluginRoutes.Post("/:id/update", middleware.AuditLog("plugin_update"), plugins.UpdatePlugin)
+	pluginRoutes.Post("/:id/rollback", middleware.AuditLog("plugin_rollback"), plugins.RollbackPlugin)
+	pluginRoutes.Put("/:id/pin", middleware.AuditLog("plugin_pin"), plugins.PinPlugin)
+
+	// Backup routes
+	backupRoutes := serverSpecific.Group("/backups", middleware.ServerPermissionRequired(models.ServerPermissionBackups))
+	backupRoutes.Get("/", backups.GetBackups)
+	backupRoutes.Get("/policy", backups.GetBackupPolicy)
+	backupRoutes.Put("/policy", middleware.AuditLog("backup_policy_update"), backups.UpdateBackupPolicy)
+	backupRoutes.Post("/:backupId/restore", middleware.AuditLog("backup_restore"), backups.RestoreBackup)
+	backupRoutes.Post("/:backupId/verify", backups.VerifyBackup)
+
+	// Schedule routes
+	scheduleRoutes := serverSpecific.Group("/schedules", middleware.ServerPermissionRequired(models.ServerPermissionSchedules))
+	scheduleRoutes.Get("/", servers.GetSchedules)
+	scheduleRoutes.Post("/", middleware.AuditLog("schedule_create"), servers.CreateSchedule)
+	scheduleRoutes.Get("/:scheduleId", servers.GetSchedule)
+	scheduleRoutes.Put("/:scheduleId", middleware.AuditLog("schedule_update"), servers.UpdateSchedule)
+	scheduleRoutes.Delete("/:scheduleId", middleware.AuditLog("schedule_delete"), servers.DeleteSchedule)
+
+	// Server template routes
+	templateRoutes := protected.Group("/templates")
+	templateRoutes.Get("/", templates.GetTemplates)
+	templateRoutes.Get("/:templateId", templates.GetTemplate)
+	templateRoutes.Post("/", middleware.AdminRequired(), middleware.AuditLog("template_create"), templates.CreateTemplate)
+	templateRoutes.Put("/:templateId", middleware.AdminRequired(), middleware.AuditLog("template_update"), templates.UpdateTemplate)
+	templateRoutes.Delete("/:templateId", middleware.AdminRequired(), middleware.AuditLog("template_delete"), templates.DeleteTemplate)
+
+	// Notification routes
+	notificationRoutes := protected.Group("/notifications")
+	notificationRoutes.Get("/", notifications.GetNotifications)
+	notificationRoutes.Post("/read-all", notifications.MarkAllNotificationsRead)
+	notificationRoutes.Post("/:id/read", notifications.MarkNotificationRead)
+
+	// Marketplace routes are served by the marketplace's own routes
+	marketplaceMux := http.NewServeMux()
+	services.Marketplace().RegisterDeveloperRoutes(marketplaceMux, middleware.RequestUserID)
+	services.Marketplace().RegisterPayoutRoutes(marketplaceMux, middleware.RequestUserID)
+	services.Marketplace().RegisterPayoutAdminRoutes(marketplaceMux, middleware.RequestAdminID)
+	services.Marketplace().RegisterGitHubRoutes(marketplaceMux, middleware.RequestUserID)
+	marketplaceHandler := adaptor.HTTPHandler(http.StripPrefix(cfg.Server.APIPrefix+"/marketplace", marketplaceMux))
+
+	marketplaceRoutes := protected.Group("/marketplace")
+	marketplaceRoutes.Get("/developer", marketplaceHandler)
+	marketplaceRoutes.Post("/developer", middleware.AuditLog("developer_create"), marketplaceHandler)
+	marketplaceRoutes.Get("/developer/revenue", marketplaceHandler)
+	marketplaceRoutes.Get("/developer/payouts", marketplaceHandler)
+	marketplaceRoutes.Post("/developer/payouts", middleware.AuditLog("payout_request"), marketplaceHandler)
+	marketplaceRoutes.Get("/items/:itemId/github", marketplaceHandler)
+	marketplaceRoutes.Put("/items/:itemId/github", middleware.AuditLog("github_repository_track"), marketplaceHandler)
+	marketplaceRoutes.Delete("/items/:itemId/github", middleware.AuditLog("github_repository_untrack"), marketplaceHandler)
+	marketplaceRoutes.Post("/items/:itemId/github/sync", middleware.AuditLog("github_repository_sync"), marketplaceHandler)
+	marketplaceRoutes.Get("/admin/payouts", middleware.AdminRequired(), marketplaceHandler)
+	marketplaceRoutes.Post("/admin/payouts/:payoutId/approve", middleware.AdminRequired(), middleware.AuditLog("payout_approve"), marketplaceHandler)
+	marketplaceRoutes.Post("/admin/payouts/:payoutId/reject", middleware.AdminRequired(), middleware.AuditLog("payout_reject"), marketplaceHandler)
 
 	// Admin routes
 	adminRoutes := protected.Group("/admin", middleware.AdminRequired())
 	adminRoutes.Get("/users", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"message": "Admin user management to be implemented"})
 	})
-	adminRoutes.Get("/settings", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"message": "Admin settings to be implemented"})
-	})
+	adminRoutes.Get("/settings", admin.GetSettings)
+	adminRoutes.Get("/settings/:key", admin.GetSetting)
+	adminRoutes.Put("/settings/:key", admin.UpdateSetting)
 	adminRoutes.Get("/audit", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"message": "Audit logs to be implemented"})
 	})
+	adminRoutes.Get("/java", servers.GetJavaInstallations)
+	adminRoutes.Get("/nodes/:nodeId/token", admin.GetNodeToken)
+
+	// Marketplace rollouts are served by the marketplace's own routes
+	rolloutMux := http.NewServeMux()
+	services.Marketplace().RegisterRolloutRoutes(rolloutMux, services.NewRolloutController(), middleware.RequestUserID)
+	adminRoutes.Post("/marketplace/items/:itemId/rollout", middleware.AuditLog("marketplace_rollout"),
+		adaptor.HTTPHandler(http.StripPrefix(cfg.Server.APIPrefix+"/admin/marketplace", rolloutMux)))
+
+	if nodeManager := services.NodeManager(); nodeManager != nil {
+		adminRoutes.Get("/nodes/servers", adaptor.HTTPHandlerFunc(nodeManager.FleetServersHandler()))
+		protected.Get("/nodes/route", adaptor.HTTPHandlerFunc(nodeManager.RouteHandler()))
+		adminRoutes.Get("/nodes/events", websocket.New(func(c *websocket.Conn) {
+			nodeManager.StreamEvents(c)
+		}))
+	}
 
 	// WebSocket endpoint
-	app.Use("/ws", func(c *fiber.Ctx) error {
-		if websocket.IsWebSocketUpgrade(c) {
-			c.Locals("allowed", true)
-			return c.Next()
-		}
-		return fiber.ErrUpgradeRequired
-	})
+	app.Use("/ws", middleware.WebSocketUpgrade(), middleware.AuthRequired())
 
 	app.Get("/ws", websocket.New(func(c *websocket.Conn) {
-		// Get user from JWT token (implement proper auth for WebSocket)
-		services.HandleWebSocket(c, uuid.Nil) // For now, pass nil UUID
+		userId, _ := c.Locals("userId").(uuid.UUID)
+		services.HandleWebSocket(c, userId)
 	}))
 
 	// Serve static files (for frontend in production)
@@ -185,17 +376,34 @@ func main() {
 	go func() {
 		<-c
 		fmt.Println("\n🔄 Gracefully shutting down...")
-		
-		// Close database connection
-		if err := database.Close(); err != nil {
-			log.Printf("Error closing database: %v", err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+
+		// Tell WebSocket clients we are going away
+		services.CloseWebSockets()
+
+		// Let running backups and server stops finish before the database goes
+		if err := services.StopBackups(ctx); err != nil {
+			log.Printf("Backups still running at shutdown: %v", err)
 		}
-		
+		if err := services.WaitForServerStops(ctx); err != nil {
+			log.Printf("Server stops still running at shutdown: %v", err)
+		}
+		if err := services.StopMetricWriter(ctx); err != nil {
+			log.Printf("Metric samples not written at shutdown: %v", err)
+		}
+
 		// Shutdown server
-		if err := app.Shutdown(); err != nil {
+		if err := app.ShutdownWithContext(ctx); err != nil {
 			log.Printf("Error shutting down server: %v", err)
 		}
-		
+
+		// Close database connection
+		if err := database.Close(); err != nil {
+			log.Printf("Error closing database: %v", err)
+		}
+
 		fmt.Println("✅ Playpulse Panel shut down successfully")
 		os.Exit(0)
 	}()
@@ -0,0 +1,62 @@
+package marketplace
+
+import (
+	"strings"
+	"testing"
+
+	"playpulse-panel/internal/testutil"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// testDB opens the test database through testutil.OpenDB and migrates the
+// marketplace tables
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	// Test items have no author, so authors aren't enforced by a foreign key
+	cfg := &gorm.Config{DisableForeignKeyConstraintWhenMigrating: true}
+	return testutil.OpenDB(t, cfg, func(db *gorm.DB) error {
+		return db.AutoMigrate(&Developer{}, &MarketplaceItem{}, &Review{}, &ReviewVote{}, &Download{},
+			&ItemVersion{}, &GitHubRepository{}, &Favorite{}, &Purchase{}, &PayoutRequest{})
+	})
+}
+
+// createTestItem stores item as an approved plugin, filling in a unique
+// name, and removes it with its reviews, downloads, versions, favorites and
+// purchases when the test ends
+func createTestItem(t *testing.T, db *gorm.DB, item *MarketplaceItem) *MarketplaceItem {
+	t.Helper()
+
+	if item.Name == "" {
+		item.Name = "test-" + uuid.NewString()
+	}
+	if item.Slug == "" {
+		item.Slug = strings.ToLower(item.Name) + "-" + uuid.NewString()[:8]
+	}
+	if item.Category == "" {
+		item.Category = CategoryPlugins
+	}
+	if item.Type == "" {
+		item.Type = TypePlugin
+	}
+	if item.Status == "" {
+		item.Status = StatusApproved
+	}
+	if err := db.Omit(clause.Associations).Create(item).Error; err != nil {
+		t.Fatalf("failed to create item: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Where("review_id IN (?)", db.Model(&Review{}).Select("id").Where("item_id = ?", item.ID)).Delete(&ReviewVote{})
+		db.Where("item_id = ?", item.ID).Delete(&Review{})
+		db.Where("item_id = ?", item.ID).Delete(&Download{})
+		db.Where("item_id = ?", item.ID).Delete(&ItemVersion{})
+		db.Where("item_id = ?", item.ID).Delete(&GitHubRepository{})
+		db.Where("item_id = ?", item.ID).Delete(&Favorite{})
+		db.Where("item_id = ?", item.ID).Delete(&Purchase{})
+		db.Delete(item)
+	})
+	return item
+}
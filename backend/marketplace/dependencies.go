@@ -0,0 +1,217 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	DependencyRequired     = "required"
+	DependencyOptional     = "optional"
+	DependencyIncompatible = "incompatible"
+)
+
+var (
+	// ErrDependencyMissing is returned when a required dependency is not in the marketplace
+	ErrDependencyMissing = errors.New("required dependency not found")
+	// ErrDependencyCycle is returned when required dependencies depend on each other
+	ErrDependencyCycle = errors.New("dependency cycle detected")
+	// ErrDependencyIncompatible is returned when two items of a plan exclude each other
+	ErrDependencyIncompatible = errors.New("incompatible dependencies")
+	// ErrDependencyVersion is returned when no dependency version satisfies a constraint
+	ErrDependencyVersion = errors.New("dependency version constraint not satisfied")
+)
+
+// PlannedInstall is one step of an install plan
+type PlannedInstall struct {
+	ItemID       uuid.UUID `json:"item_id"`
+	Name         string    `json:"name"`
+	Version      string    `json:"version"`
+	IsDependency bool      `json:"is_dependency"`
+}
+
+// dependencyResolver walks required dependencies depth first so that every
+// item is planned after the items it depends on
+type dependencyResolver struct {
+	ctx      context.Context
+	m        *Marketplace
+	plan     []*MarketplaceItem
+	planned  map[string]bool
+	visiting map[string]bool
+	path     []string
+}
+
+// resolveDependencies returns the items to install for root, dependencies
+// first and root last
+func (m *Marketplace) resolveDependencies(ctx context.Context, root *MarketplaceItem) ([]*MarketplaceItem, error) {
+	r := &dependencyResolver{
+		ctx:      ctx,
+		m:        m,
+		planned:  make(map[string]bool),
+		visiting: make(map[string]bool),
+	}
+
+	if err := r.visit(root); err != nil {
+		return nil, err
+	}
+
+	if err := checkIncompatibilities(r.plan); err != nil {
+		return nil, err
+	}
+
+	return r.plan, nil
+}
+
+func (r *dependencyResolver) visit(item *MarketplaceItem) error {
+	key := strings.ToLower(item.Name)
+	if r.planned[key] {
+		return nil
+	}
+	if r.visiting[key] {
+		return fmt.Errorf("%w: %s -> %s", ErrDependencyCycle, strings.Join(r.path, " -> "), item.Name)
+	}
+
+	r.visiting[key] = true
+	r.path = append(r.path, item.Name)
+
+	for _, dep := range item.Dependencies {
+		if dep.Type != DependencyRequired {
+			continue
+		}
+
+		depItem, err := r.m.findDependency(r.ctx, dep)
+		if err != nil {
+			return fmt.Errorf("%s requires %s: %w", item.Name, dep.Name, err)
+		}
+
+		if err := r.visit(depItem); err != nil {
+			return err
+		}
+	}
+
+	r.path = r.path[:len(r.path)-1]
+	delete(r.visiting, key)
+	r.planned[key] = true
+	r.plan = append(r.plan, item)
+
+	return nil
+}
+
+// findDependency locates an approved item by name or slug and checks it
+// satisfies the dependency's version constraint
+func (m *Marketplace) findDependency(ctx context.Context, dep Dependency) (*MarketplaceItem, error) {
+	var item MarketplaceItem
+	err := m.db.WithContext(ctx).
+		Where("status = ? AND (LOWER(name) = ? OR slug = ?)", StatusApproved, strings.ToLower(dep.Name), m.generateSlug(dep.Name)).
+		First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDependencyMissing
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !versionSatisfies(item.Version, dep.Version) {
+		return nil, fmt.Errorf("%w: have %s, need %s", ErrDependencyVersion, item.Version, dep.Version)
+	}
+
+	return &item, nil
+}
+
+// checkIncompatibilities rejects a plan containing an item that another
+// planned item declares incompatible
+func checkIncompatibilities(plan []*MarketplaceItem) error {
+	planned := make(map[string]*MarketplaceItem)
+	for _, item := range plan {
+		planned[strings.ToLower(item.Name)] = item
+	}
+
+	for _, item := range plan {
+		for _, dep := range item.Dependencies {
+			if dep.Type != DependencyIncompatible {
+				continue
+			}
+
+			other, exists := planned[strings.ToLower(dep.Name)]
+			if exists && versionSatisfies(other.Version, dep.Version) {
+				return fmt.Errorf("%w: %s cannot be installed with %s", ErrDependencyIncompatible, item.Name, other.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// versionSatisfies reports whether version matches constraint. Constraints
+// are a version optionally prefixed by =, >, >=, < or <=; an empty constraint
+// or "*" matches any version.
+func versionSatisfies(version, constraint string) bool {
+	constraint = strings.TrimSpace(constraint)
+	if constraint == "" || constraint == "*" {
+		return true
+	}
+
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if !strings.HasPrefix(constraint, op) {
+			continue
+		}
+
+		cmp := compareVersions(version, strings.TrimSpace(strings.TrimPrefix(constraint, op)))
+		switch op {
+		case ">=":
+			return cmp >= 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		case "<":
+			return cmp < 0
+		default:
+			return cmp == 0
+		}
+	}
+
+	return compareVersions(version, constraint) == 0
+}
+
+// compareVersions compares dotted numeric versions, treating missing parts
+// as zero and ignoring a leading "v" and any pre-release suffix
+func compareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for len(pa) < len(pb) {
+		pa = append(pa, 0)
+	}
+	for len(pb) < len(pa) {
+		pb = append(pb, 0)
+	}
+
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] < pb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(version string) []int {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+ "); i >= 0 {
+		version = version[:i]
+	}
+
+	var parts []int
+	for _, field := range strings.Split(version, ".") {
+		n, _ := strconv.Atoi(field)
+		parts = append(parts, n)
+	}
+	return parts
+}
@@ -0,0 +1,121 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// uniqueName gives a test's items names no other test uses
+func uniqueName(name string) string {
+	return name + "-" + uuid.NewString()[:8]
+}
+
+func requires(name, version string) Dependency {
+	return Dependency{Name: name, Type: DependencyRequired, Version: version}
+}
+
+func planNames(plan []*MarketplaceItem) []string {
+	names := make([]string, len(plan))
+	for i, item := range plan {
+		names[i] = item.Name
+	}
+	return names
+}
+
+func TestResolveDependenciesLinearChain(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	lib, core, addon := uniqueName("Lib"), uniqueName("Core"), uniqueName("Addon")
+
+	createTestItem(t, db, &MarketplaceItem{Name: lib, Version: "2.1.0"})
+	createTestItem(t, db, &MarketplaceItem{Name: core, Version: "1.0.0", Dependencies: []Dependency{requires(lib, ">=2.0")}})
+	root := createTestItem(t, db, &MarketplaceItem{Name: addon, Version: "0.3.0", Dependencies: []Dependency{
+		requires(core, ""),
+		{Name: uniqueName("NotInstalled"), Type: DependencyOptional},
+	}})
+
+	plan, err := m.resolveDependencies(context.Background(), root)
+	if err != nil {
+		t.Fatalf("resolveDependencies: %v", err)
+	}
+	if got, want := planNames(plan), []string{lib, core, addon}; !reflect.DeepEqual(got, want) {
+		t.Errorf("plan = %v, want dependencies first %v", got, want)
+	}
+}
+
+func TestResolveDependenciesCycle(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	a, b := uniqueName("A"), uniqueName("B")
+
+	createTestItem(t, db, &MarketplaceItem{Name: b, Version: "1.0", Dependencies: []Dependency{requires(a, "")}})
+	root := createTestItem(t, db, &MarketplaceItem{Name: a, Version: "1.0", Dependencies: []Dependency{requires(b, "")}})
+
+	if _, err := m.resolveDependencies(context.Background(), root); !errors.Is(err, ErrDependencyCycle) {
+		t.Errorf("err = %v, want ErrDependencyCycle", err)
+	}
+}
+
+func TestResolveDependenciesIncompatiblePair(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	economy, shop, root := uniqueName("Economy"), uniqueName("Shop"), uniqueName("Server")
+
+	createTestItem(t, db, &MarketplaceItem{Name: economy, Version: "3.0"})
+	createTestItem(t, db, &MarketplaceItem{Name: shop, Version: "1.0", Dependencies: []Dependency{
+		{Name: economy, Type: DependencyIncompatible, Version: "<4.0"},
+	}})
+	item := createTestItem(t, db, &MarketplaceItem{Name: root, Version: "1.0", Dependencies: []Dependency{
+		requires(economy, ""),
+		requires(shop, ""),
+	}})
+
+	if _, err := m.resolveDependencies(context.Background(), item); !errors.Is(err, ErrDependencyIncompatible) {
+		t.Errorf("err = %v, want ErrDependencyIncompatible", err)
+	}
+}
+
+func TestResolveDependenciesMissingOrTooOld(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	lib := uniqueName("Lib")
+	createTestItem(t, db, &MarketplaceItem{Name: lib, Version: "1.4"})
+
+	missing := createTestItem(t, db, &MarketplaceItem{Dependencies: []Dependency{requires(uniqueName("Gone"), "")}})
+	if _, err := m.resolveDependencies(context.Background(), missing); !errors.Is(err, ErrDependencyMissing) {
+		t.Errorf("missing dependency: err = %v, want ErrDependencyMissing", err)
+	}
+
+	tooOld := createTestItem(t, db, &MarketplaceItem{Dependencies: []Dependency{requires(lib, ">=2.0")}})
+	if _, err := m.resolveDependencies(context.Background(), tooOld); !errors.Is(err, ErrDependencyVersion) {
+		t.Errorf("old dependency: err = %v, want ErrDependencyVersion", err)
+	}
+}
+
+func TestVersionSatisfies(t *testing.T) {
+	tests := []struct {
+		version, constraint string
+		want                bool
+	}{
+		{"1.0", "", true},
+		{"1.0", "*", true},
+		{"2.1.0", ">=2.0", true},
+		{"2.0", ">=2.0.0", true},
+		{"1.9.9", ">=2.0", false},
+		{"2.0", ">2.0", false},
+		{"v3.2", "<4", true},
+		{"4.0-SNAPSHOT", "<4", false},
+		{"1.2", "<=1.2.0", true},
+		{"1.2", "=1.2", true},
+		{"1.2.1", "1.2", false},
+	}
+	for _, tt := range tests {
+		if got := versionSatisfies(tt.version, tt.constraint); got != tt.want {
+			t.Errorf("versionSatisfies(%q, %q) = %v, want %v", tt.version, tt.constraint, got, tt.want)
+		}
+	}
+}
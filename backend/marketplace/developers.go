@@ -0,0 +1,169 @@
+package marketplace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotDeveloper is returned when a panel user has no developer profile
+	ErrNotDeveloper = errors.New("user has no developer profile")
+	// ErrDeveloperExists is returned when a panel user already has a
+	// developer profile, or its username or email is taken
+	ErrDeveloperExists = errors.New("developer profile already exists")
+)
+
+// DeveloperForUser returns the developer profile linked to a panel user.
+// Items, repositories and payouts belong to developers, whose IDs are not
+// user IDs, so ownership checks go through it.
+func (m *Marketplace) DeveloperForUser(ctx context.Context, userID uuid.UUID) (*Developer, error) {
+	var developer Developer
+	err := m.db.WithContext(ctx).Where("user_id = ?", userID).First(&developer).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotDeveloper
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &developer, nil
+}
+
+// CreateDeveloper creates the developer profile of a panel user
+func (m *Marketplace) CreateDeveloper(ctx context.Context, userID uuid.UUID, developer *Developer) error {
+	developer.ID = uuid.Nil
+	developer.UserID = &userID
+	developer.Username = strings.TrimSpace(developer.Username)
+	developer.Email = strings.TrimSpace(developer.Email)
+	if developer.Username == "" || developer.Email == "" {
+		return errors.New("username and email are required")
+	}
+	developer.Status = DeveloperStatusActive
+	developer.JoinedAt = time.Now()
+	developer.LastActive = developer.JoinedAt
+
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Developer{}).
+			Where("user_id = ? OR username = ? OR email = ?", userID, developer.Username, developer.Email).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrDeveloperExists
+		}
+		return tx.Omit("Items").Create(developer).Error
+	})
+}
+
+// isAuthor reports whether the panel user owns the developer profile that
+// published item
+func (m *Marketplace) isAuthor(ctx context.Context, userID uuid.UUID, item *MarketplaceItem) (bool, error) {
+	developer, err := m.DeveloperForUser(ctx, userID)
+	if errors.Is(err, ErrNotDeveloper) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return item.AuthorID == developer.ID, nil
+}
+
+// currentDeveloper resolves the developer profile of the authenticated user,
+// writing the error response when there is none
+func (m *Marketplace) currentDeveloper(w http.ResponseWriter, r *http.Request, currentUser func(r *http.Request) (uuid.UUID, error)) (uuid.UUID, bool) {
+	userID, err := currentUser(r)
+	if err != nil {
+		utils.WriteHTTPError(w, r, http.StatusUnauthorized, "authentication required")
+		return uuid.Nil, false
+	}
+
+	developer, err := m.DeveloperForUser(r.Context(), userID)
+	if errors.Is(err, ErrNotDeveloper) {
+		utils.WriteHTTPError(w, r, http.StatusForbidden, err.Error())
+		return uuid.Nil, false
+	}
+	if err != nil {
+		utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to fetch developer profile")
+		return uuid.Nil, false
+	}
+	return developer.ID, true
+}
+
+// RegisterDeveloperRoutes mounts the endpoints users read and create their
+// developer profile with on mux. currentUser resolves the authenticated user.
+func (m *Marketplace) RegisterDeveloperRoutes(mux *http.ServeMux, currentUser func(r *http.Request) (uuid.UUID, error)) {
+	mux.HandleFunc("GET /developer", func(w http.ResponseWriter, r *http.Request) {
+		userID, err := currentUser(r)
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		developer, err := m.DeveloperForUser(r.Context(), userID)
+		if errors.Is(err, ErrNotDeveloper) {
+			utils.WriteHTTPError(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to fetch developer profile")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(developer)
+	})
+
+	mux.HandleFunc("POST /developer", func(w http.ResponseWriter, r *http.Request) {
+		userID, err := currentUser(r)
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		var body struct {
+			Username    string `json:"username"`
+			Email       string `json:"email"`
+			DisplayName string `json:"display_name"`
+			Bio         string `json:"bio"`
+			Website     string `json:"website"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			utils.WriteHTTPError(w, r, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if strings.TrimSpace(body.Username) == "" || strings.TrimSpace(body.Email) == "" {
+			utils.WriteHTTPError(w, r, http.StatusBadRequest, "username and email are required")
+			return
+		}
+
+		developer := &Developer{
+			Username:    body.Username,
+			Email:       body.Email,
+			DisplayName: body.DisplayName,
+			Bio:         body.Bio,
+			Website:     body.Website,
+		}
+		err = m.CreateDeveloper(r.Context(), userID, developer)
+		if errors.Is(err, ErrDeveloperExists) {
+			utils.WriteHTTPError(w, r, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to create developer profile")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(developer)
+	})
+}
@@ -0,0 +1,115 @@
+package marketplace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCreateDeveloperLinksUser(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	ctx := context.Background()
+	userID := uuid.New()
+
+	if _, err := m.DeveloperForUser(ctx, userID); !errors.Is(err, ErrNotDeveloper) {
+		t.Fatalf("DeveloperForUser before creating a profile = %v, want ErrNotDeveloper", err)
+	}
+
+	name := uniqueName("dev")
+	developer := &Developer{Username: name, Email: name + "@example.com"}
+	if err := m.CreateDeveloper(ctx, userID, developer); err != nil {
+		t.Fatalf("CreateDeveloper: %v", err)
+	}
+	t.Cleanup(func() { db.Delete(developer) })
+
+	if developer.ID == userID {
+		t.Error("the developer profile reused the user ID")
+	}
+	found, err := m.DeveloperForUser(ctx, userID)
+	if err != nil || found.ID != developer.ID {
+		t.Fatalf("DeveloperForUser = %v (%v), want the created profile", found, err)
+	}
+
+	again := &Developer{Username: uniqueName("dev"), Email: uniqueName("dev") + "@example.com"}
+	if err := m.CreateDeveloper(ctx, userID, again); !errors.Is(err, ErrDeveloperExists) {
+		t.Errorf("second profile for the user = %v, want ErrDeveloperExists", err)
+	}
+}
+
+func TestGitHubRoutesCheckDeveloperProfile(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+
+	developer := createTestDeveloper(t, db, PayoutInfo{})
+	item := createTestItem(t, db, &MarketplaceItem{AuthorID: developer.ID})
+
+	mux := http.NewServeMux()
+	m.RegisterGitHubRoutes(mux, func(r *http.Request) (uuid.UUID, error) {
+		return uuid.Parse(r.Header.Get("X-User-ID"))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	track := func(userID uuid.UUID) int {
+		req, _ := http.NewRequest(http.MethodPut, server.URL+"/items/"+item.ID.String()+"/github",
+			strings.NewReader(`{"repository":"example/BetterSpawns"}`))
+		req.Header.Set("X-User-ID", userID.String())
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("PUT github: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Neither a user without a profile nor the developer ID passed as a
+	// user ID may track a repository for the item
+	if status := track(uuid.New()); status != http.StatusForbidden {
+		t.Errorf("user without a developer profile: status %d, want 403", status)
+	}
+	if status := track(developer.ID); status != http.StatusForbidden {
+		t.Errorf("developer ID as the user: status %d, want 403", status)
+	}
+
+	if status := track(*developer.UserID); status != http.StatusOK {
+		t.Fatalf("the item's developer: status %d, want 200", status)
+	}
+	var repo GitHubRepository
+	if err := db.Where("item_id = ? AND developer_id = ?", item.ID, developer.ID).First(&repo).Error; err != nil {
+		t.Errorf("tracked repository is not stored under the developer: %v", err)
+	}
+}
+
+func TestDeveloperRoutesReturnAPIErrors(t *testing.T) {
+	m := &Marketplace{}
+	mux := http.NewServeMux()
+	m.RegisterDeveloperRoutes(mux, func(r *http.Request) (uuid.UUID, error) {
+		return uuid.Nil, errors.New("user not authenticated")
+	})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/developer", nil))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", rec.Code)
+	}
+	var body struct {
+		Error   string `json:"error"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Path    string `json:"path"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("error body is not JSON: %v", err)
+	}
+	if body.Code != "unauthorized" || body.Message == "" || body.Path != "/developer" {
+		t.Errorf("body = %+v, want the API error shape", body)
+	}
+}
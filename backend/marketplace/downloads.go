@@ -0,0 +1,222 @@
+package marketplace
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// downloadURLLifetime is how long a signed download URL stays valid
+const downloadURLLifetime = 5 * time.Minute
+
+var (
+	// ErrNotEntitled is returned when a user asks to download a paid item
+	// they have not bought
+	ErrNotEntitled = errors.New("item has not been purchased")
+	// ErrInvalidDownloadSignature is returned for a tampered or expired
+	// download URL
+	ErrInvalidDownloadSignature = errors.New("invalid or expired download link")
+)
+
+// SetDownloadSigningKey sets the key download URLs are signed with. Without
+// it a random key is used, and links stop working when the process restarts.
+func (m *Marketplace) SetDownloadSigningKey(key []byte) {
+	m.downloadKey = key
+}
+
+// CheckEntitlement reports whether the user may download the item: free
+// items are open to everyone, paid ones to the user whose developer profile
+// published them and to users with a completed purchase
+func (m *Marketplace) CheckEntitlement(ctx context.Context, userID uuid.UUID, item *MarketplaceItem) error {
+	if item.IsFree || item.Price == 0 {
+		return nil
+	}
+	if author, err := m.isAuthor(ctx, userID, item); err != nil || author {
+		return err
+	}
+
+	var count int64
+	if err := m.db.WithContext(ctx).Model(&Purchase{}).
+		Where("item_id = ? AND user_id = ? AND status = ?", item.ID, userID, PurchaseStatusCompleted).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotEntitled
+	}
+	return nil
+}
+
+// SignDownload returns the query string of a download link for the user that
+// expires after downloadURLLifetime
+func (m *Marketplace) SignDownload(itemID, userID uuid.UUID, now time.Time) (url.Values, time.Time) {
+	expires := now.Add(downloadURLLifetime).Truncate(time.Second)
+
+	query := url.Values{}
+	query.Set("user", userID.String())
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", m.downloadSignature(itemID, userID, expires.Unix()))
+	return query, expires
+}
+
+// VerifyDownload checks a download link's signature and expiry and returns
+// the user it was issued to
+func (m *Marketplace) VerifyDownload(itemID uuid.UUID, query url.Values, now time.Time) (uuid.UUID, error) {
+	userID, err := uuid.Parse(query.Get("user"))
+	if err != nil {
+		return uuid.Nil, ErrInvalidDownloadSignature
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || now.Unix() > expires {
+		return uuid.Nil, ErrInvalidDownloadSignature
+	}
+
+	expected := m.downloadSignature(itemID, userID, expires)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return uuid.Nil, ErrInvalidDownloadSignature
+	}
+
+	return userID, nil
+}
+
+func (m *Marketplace) downloadSignature(itemID, userID uuid.UUID, expires int64) string {
+	mac := hmac.New(sha256.New, m.downloadKey)
+	fmt.Fprintf(mac, "%s:%s:%d", itemID, userID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomDownloadKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("failed to generate download signing key: %v", err))
+	}
+	return key
+}
+
+// RegisterDownloadRoutes mounts the download endpoints on mux. The first
+// checks the user may download the item and returns a short-lived signed
+// link; the second serves the file for a valid link, so the item's real
+// download URL is never handed out. currentUser resolves the authenticated user.
+func (m *Marketplace) RegisterDownloadRoutes(mux *http.ServeMux, currentUser func(r *http.Request) (uuid.UUID, error)) {
+	mux.HandleFunc("GET /items/{itemID}/download", func(w http.ResponseWriter, r *http.Request) {
+		userID, err := currentUser(r)
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		itemID, err := uuid.Parse(r.PathValue("itemID"))
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusBadRequest, "invalid item ID")
+			return
+		}
+
+		var item MarketplaceItem
+		err = m.db.WithContext(r.Context()).Where("id = ? AND status = ?", itemID, StatusApproved).First(&item).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.WriteHTTPError(w, r, http.StatusNotFound, "item not found")
+			return
+		}
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to fetch item")
+			return
+		}
+
+		if err := m.CheckEntitlement(r.Context(), userID, &item); err != nil {
+			if errors.Is(err, ErrNotEntitled) {
+				utils.WriteHTTPError(w, r, http.StatusPaymentRequired, err.Error())
+				return
+			}
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to check purchase")
+			return
+		}
+
+		// Link to the file endpoint under the same prefix the mux is mounted at
+		prefix := strings.TrimSuffix(r.URL.Path, "/items/"+r.PathValue("itemID")+"/download")
+		query, expires := m.SignDownload(itemID, userID, time.Now())
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"url":        fmt.Sprintf("%s/downloads/%s?%s", prefix, itemID, query.Encode()),
+			"expires_at": expires,
+		})
+	})
+
+	mux.HandleFunc("GET /downloads/{itemID}", func(w http.ResponseWriter, r *http.Request) {
+		itemID, err := uuid.Parse(r.PathValue("itemID"))
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusBadRequest, "invalid item ID")
+			return
+		}
+
+		userID, err := m.VerifyDownload(itemID, r.URL.Query(), time.Now())
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusForbidden, err.Error())
+			return
+		}
+
+		var item MarketplaceItem
+		if err := m.db.WithContext(r.Context()).Where("id = ?", itemID).First(&item).Error; err != nil || item.DownloadURL == "" {
+			utils.WriteHTTPError(w, r, http.StatusNotFound, "item not found")
+			return
+		}
+
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, item.DownloadURL, nil)
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusBadGateway, "failed to fetch file")
+			return
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusBadGateway, "failed to fetch file")
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			utils.WriteHTTPError(w, r, http.StatusBadGateway, "failed to fetch file")
+			return
+		}
+
+		fileName := path.Base(resp.Request.URL.Path)
+		if ext := strings.ToLower(path.Ext(fileName)); ext != ".jar" && ext != ".zip" {
+			fileName = item.Slug + ".jar"
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+		if resp.ContentLength > 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+		}
+
+		if _, err := io.Copy(w, resp.Body); err != nil {
+			log.Printf("Download of %s interrupted: %v", item.Name, err)
+			return
+		}
+
+		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+		go m.trackDownload(item.ID, InstallRequest{
+			UserID:    userID,
+			IPAddress: ip,
+			UserAgent: r.UserAgent(),
+		}, item.Version)
+	})
+}
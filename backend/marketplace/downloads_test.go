@@ -0,0 +1,214 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// createPaidTestItem stores an approved item with a price. is_free defaults
+// to true in the database, so it is cleared after the item is created.
+func createPaidTestItem(t *testing.T, db *gorm.DB, item *MarketplaceItem) *MarketplaceItem {
+	t.Helper()
+
+	item = createTestItem(t, db, item)
+	if err := db.Model(item).Update("is_free", false).Error; err != nil {
+		t.Fatalf("failed to mark item paid: %v", err)
+	}
+	item.IsFree = false
+	return item
+}
+
+func newDownloadServer(t *testing.T, m *Marketplace) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	m.RegisterDownloadRoutes(mux, func(r *http.Request) (uuid.UUID, error) {
+		id, err := uuid.Parse(r.Header.Get("X-User-ID"))
+		if err != nil {
+			return uuid.Nil, errors.New("no user")
+		}
+		return id, nil
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestVerifyDownload(t *testing.T) {
+	m := &Marketplace{downloadKey: []byte("test key")}
+	itemID, userID := uuid.New(), uuid.New()
+	now := time.Now()
+
+	query, expires := m.SignDownload(itemID, userID, now)
+	if got, err := m.VerifyDownload(itemID, query, now); err != nil || got != userID {
+		t.Fatalf("VerifyDownload = %s, %v, want the signing user", got, err)
+	}
+	if got, err := m.VerifyDownload(itemID, query, expires); err != nil || got != userID {
+		t.Errorf("VerifyDownload at the expiry = %s, %v, want it still valid", got, err)
+	}
+	if _, err := m.VerifyDownload(itemID, query, expires.Add(time.Second)); !errors.Is(err, ErrInvalidDownloadSignature) {
+		t.Errorf("VerifyDownload after the expiry = %v, want ErrInvalidDownloadSignature", err)
+	}
+	if _, err := m.VerifyDownload(uuid.New(), query, now); !errors.Is(err, ErrInvalidDownloadSignature) {
+		t.Errorf("VerifyDownload for another item = %v, want ErrInvalidDownloadSignature", err)
+	}
+
+	tampered := func(key, value string) url.Values {
+		changed := url.Values{}
+		for k, v := range query {
+			changed[k] = v
+		}
+		if value == "" {
+			changed.Del(key)
+		} else {
+			changed.Set(key, value)
+		}
+		return changed
+	}
+	for name, changed := range map[string]url.Values{
+		"another user":       tampered("user", uuid.NewString()),
+		"extended expiry":    tampered("expires", strconv.FormatInt(expires.Add(time.Hour).Unix(), 10)),
+		"altered signature":  tampered("signature", strings.Repeat("0", 64)),
+		"without user":       tampered("user", ""),
+		"without expiry":     tampered("expires", ""),
+		"without signature":  tampered("signature", ""),
+		"non-numeric expiry": tampered("expires", "soon"),
+	} {
+		if _, err := m.VerifyDownload(itemID, changed, now); !errors.Is(err, ErrInvalidDownloadSignature) {
+			t.Errorf("%s: VerifyDownload = %v, want ErrInvalidDownloadSignature", name, err)
+		}
+	}
+
+	// Links from before a key change stop working
+	other := &Marketplace{downloadKey: []byte("another key")}
+	if _, err := other.VerifyDownload(itemID, query, now); !errors.Is(err, ErrInvalidDownloadSignature) {
+		t.Errorf("VerifyDownload with another key = %v, want ErrInvalidDownloadSignature", err)
+	}
+}
+
+func TestCheckEntitlement(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	ctx := context.Background()
+	developer := createTestDeveloper(t, db, PayoutInfo{})
+	author, buyer := *developer.UserID, uuid.New()
+
+	free := createTestItem(t, db, &MarketplaceItem{AuthorID: developer.ID})
+	paid := createPaidTestItem(t, db, &MarketplaceItem{AuthorID: developer.ID, Price: 5})
+
+	if err := m.CheckEntitlement(ctx, buyer, free); err != nil {
+		t.Errorf("free item: %v", err)
+	}
+	if err := m.CheckEntitlement(ctx, author, paid); err != nil {
+		t.Errorf("author of a paid item: %v", err)
+	}
+	// The developer ID is not a user ID and grants nothing
+	if err := m.CheckEntitlement(ctx, developer.ID, paid); !errors.Is(err, ErrNotEntitled) {
+		t.Errorf("paid item checked with the developer ID = %v, want ErrNotEntitled", err)
+	}
+	if err := m.CheckEntitlement(ctx, buyer, paid); !errors.Is(err, ErrNotEntitled) {
+		t.Errorf("paid item without a purchase = %v, want ErrNotEntitled", err)
+	}
+
+	// Only a completed purchase counts
+	for _, status := range []PurchaseStatus{PurchaseStatusPending, PurchaseStatusRefunded} {
+		purchase := &Purchase{ItemID: paid.ID, UserID: buyer, Amount: 5, Status: status}
+		db.Create(purchase)
+		if err := m.CheckEntitlement(ctx, buyer, paid); !errors.Is(err, ErrNotEntitled) {
+			t.Errorf("paid item with a %s purchase = %v, want ErrNotEntitled", status, err)
+		}
+	}
+	db.Create(&Purchase{ItemID: paid.ID, UserID: buyer, Amount: 5, Status: PurchaseStatusCompleted})
+	if err := m.CheckEntitlement(ctx, buyer, paid); err != nil {
+		t.Errorf("paid item after buying it: %v", err)
+	}
+}
+
+func TestDownloadEndpoints(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db, downloadKey: []byte("test key")}
+	server := newDownloadServer(t, m)
+
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("jar contents"))
+	}))
+	t.Cleanup(files.Close)
+
+	paid := createPaidTestItem(t, db, &MarketplaceItem{AuthorID: uuid.New(), Price: 5, DownloadURL: files.URL + "/Homes-1.0.jar"})
+	buyer := uuid.New()
+
+	var link struct {
+		URL       string    `json:"url"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	path := "/items/" + paid.ID.String() + "/download"
+	if status := sendAs(t, server, buyer, http.MethodGet, path, &link); status != http.StatusPaymentRequired {
+		t.Fatalf("link for a paid item without a purchase = %d, want 402", status)
+	}
+	if status := sendAs(t, server, buyer, http.MethodGet, "/items/"+uuid.NewString()+"/download", nil); status != http.StatusNotFound {
+		t.Errorf("link for an unknown item = %d, want 404", status)
+	}
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("anonymous link request = %d, want 401", resp.StatusCode)
+	}
+
+	db.Create(&Purchase{ItemID: paid.ID, UserID: buyer, Amount: 5, Status: PurchaseStatusCompleted})
+	if status := sendAs(t, server, buyer, http.MethodGet, path, &link); status != http.StatusOK {
+		t.Fatalf("link after buying = %d, want 200", status)
+	}
+	if remaining := time.Until(link.ExpiresAt); remaining <= 0 || remaining > downloadURLLifetime {
+		t.Errorf("link expires in %s, want within %s", remaining, downloadURLLifetime)
+	}
+
+	resp, err = http.Get(server.URL + link.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "jar contents" {
+		t.Fatalf("download = %d %q, want the file", resp.StatusCode, body)
+	}
+	if disposition := resp.Header.Get("Content-Disposition"); disposition != `attachment; filename="Homes-1.0.jar"` {
+		t.Errorf("Content-Disposition = %q", disposition)
+	}
+
+	// The download is tracked once the file has been streamed
+	deadline := time.Now().Add(5 * time.Second)
+	var downloads int64
+	for downloads == 0 && time.Now().Before(deadline) {
+		db.Model(&Download{}).Where("item_id = ? AND user_id = ?", paid.ID, buyer).Count(&downloads)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if downloads != 1 {
+		t.Errorf("%d downloads tracked, want 1", downloads)
+	}
+
+	// An expired link is refused even though the user bought the item
+	expired, _ := m.SignDownload(paid.ID, buyer, time.Now().Add(-downloadURLLifetime-time.Minute))
+	resp, err = http.Get(server.URL + "/downloads/" + paid.ID.String() + "?" + expired.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("download with an expired link = %d, want 403", resp.StatusCode)
+	}
+}
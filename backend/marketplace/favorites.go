@@ -0,0 +1,209 @@
+package marketplace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Favorite records that a user favorited an item; the key makes it one per user and item
+type Favorite struct {
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;primaryKey"`
+	ItemID    uuid.UUID `json:"item_id" gorm:"type:uuid;primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DownloadHistoryEntry is one of a user's downloads with the item it was of
+type DownloadHistoryEntry struct {
+	ItemID    uuid.UUID  `json:"item_id"`
+	ItemName  string     `json:"item_name"`
+	ItemSlug  string     `json:"item_slug"`
+	Icon      string     `json:"icon"`
+	Version   string     `json:"version"`
+	ServerID  *uuid.UUID `json:"server_id"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// FavoriteItem adds the item to the user's favorites. Favoriting an item
+// twice changes nothing; FavoriteCount only moves when a row is added.
+func (m *Marketplace) FavoriteItem(ctx context.Context, userID, itemID uuid.UUID) error {
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var item MarketplaceItem
+		if err := tx.Select("id").Where("id = ? AND status = ?", itemID, StatusApproved).First(&item).Error; err != nil {
+			return err
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&Favorite{UserID: userID, ItemID: itemID})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		return tx.Model(&MarketplaceItem{}).Where("id = ?", itemID).
+			Update("favorite_count", gorm.Expr("favorite_count + 1")).Error
+	})
+}
+
+// UnfavoriteItem removes the item from the user's favorites
+func (m *Marketplace) UnfavoriteItem(ctx context.Context, userID, itemID uuid.UUID) error {
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ? AND item_id = ?", userID, itemID).Delete(&Favorite{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		return tx.Model(&MarketplaceItem{}).Where("id = ? AND favorite_count > 0", itemID).
+			Update("favorite_count", gorm.Expr("favorite_count - 1")).Error
+	})
+}
+
+// ListFavorites returns the user's favorited items, most recently favorited first
+func (m *Marketplace) ListFavorites(ctx context.Context, userID uuid.UUID, page, limit int) ([]MarketplaceItem, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	db := m.db.WithContext(ctx).Model(&MarketplaceItem{}).
+		Joins("JOIN favorites ON favorites.item_id = marketplace_items.id").
+		Where("favorites.user_id = ?", userID).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var items []MarketplaceItem
+	err := db.Order("favorites.created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&items).Error
+	return items, total, err
+}
+
+// DownloadHistory returns the user's downloads and installs, newest first
+func (m *Marketplace) DownloadHistory(ctx context.Context, userID uuid.UUID, page, limit int) ([]DownloadHistoryEntry, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	db := m.db.WithContext(ctx).Model(&Download{}).
+		Where("downloads.user_id = ?", userID).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var entries []DownloadHistoryEntry
+	err := db.Select("downloads.item_id, marketplace_items.name AS item_name, marketplace_items.slug AS item_slug, " +
+		"marketplace_items.icon, downloads.version, downloads.server_id, downloads.created_at").
+		Joins("JOIN marketplace_items ON marketplace_items.id = downloads.item_id").
+		Order("downloads.created_at DESC").Offset((page - 1) * limit).Limit(limit).
+		Scan(&entries).Error
+	return entries, total, err
+}
+
+// RegisterFavoriteRoutes mounts the favorites and download history endpoints
+// on mux. currentUser resolves the authenticated user.
+func (m *Marketplace) RegisterFavoriteRoutes(mux *http.ServeMux, currentUser func(r *http.Request) (uuid.UUID, error)) {
+	toggle := func(favorite bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			userID, err := currentUser(r)
+			if err != nil {
+				utils.WriteHTTPError(w, r, http.StatusUnauthorized, "authentication required")
+				return
+			}
+
+			itemID, err := uuid.Parse(r.PathValue("itemID"))
+			if err != nil {
+				utils.WriteHTTPError(w, r, http.StatusBadRequest, "invalid item ID")
+				return
+			}
+
+			if favorite {
+				err = m.FavoriteItem(r.Context(), userID, itemID)
+			} else {
+				err = m.UnfavoriteItem(r.Context(), userID, itemID)
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				utils.WriteHTTPError(w, r, http.StatusNotFound, "item not found")
+				return
+			}
+			if err != nil {
+				utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to update favorite")
+				return
+			}
+
+			var item MarketplaceItem
+			m.db.WithContext(r.Context()).Select("favorite_count").Where("id = ?", itemID).First(&item)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"favorited":      favorite,
+				"favorite_count": item.FavoriteCount,
+			})
+		}
+	}
+
+	mux.HandleFunc("POST /items/{itemID}/favorite", toggle(true))
+	mux.HandleFunc("DELETE /items/{itemID}/favorite", toggle(false))
+
+	mux.HandleFunc("GET /favorites", func(w http.ResponseWriter, r *http.Request) {
+		userID, err := currentUser(r)
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+		items, total, err := m.ListFavorites(r.Context(), userID, page, limit)
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to fetch favorites")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"items": items,
+			"total": total,
+		})
+	})
+
+	mux.HandleFunc("GET /history", func(w http.ResponseWriter, r *http.Request) {
+		userID, err := currentUser(r)
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+		downloads, total, err := m.DownloadHistory(r.Context(), userID, page, limit)
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to fetch download history")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"downloads": downloads,
+			"total":     total,
+		})
+	})
+}
@@ -0,0 +1,188 @@
+package marketplace
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// newFavoritesServer serves the favorite routes, taking the user from the
+// X-User-ID header
+func newFavoritesServer(t *testing.T, m *Marketplace) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	m.RegisterFavoriteRoutes(mux, func(r *http.Request) (uuid.UUID, error) {
+		id, err := uuid.Parse(r.Header.Get("X-User-ID"))
+		if err != nil {
+			return uuid.Nil, errors.New("no user")
+		}
+		return id, nil
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// sendAs makes a request to server as the user and decodes the JSON response
+// into out when given
+func sendAs(t *testing.T, server *httptest.Server, userID uuid.UUID, method, path string, out interface{}) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-User-ID", userID.String())
+
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: invalid response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestFavoriteToggleAdjustsCount(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	server := newFavoritesServer(t, m)
+	item := createTestItem(t, db, &MarketplaceItem{})
+	alice, bob := uuid.New(), uuid.New()
+	path := "/items/" + item.ID.String() + "/favorite"
+
+	steps := []struct {
+		user   uuid.UUID
+		method string
+		count  int
+	}{
+		{alice, http.MethodPost, 1},
+		{alice, http.MethodPost, 1}, // favoriting twice counts once
+		{bob, http.MethodPost, 2},
+		{alice, http.MethodDelete, 1},
+		{alice, http.MethodDelete, 1}, // so does unfavoriting
+		{bob, http.MethodDelete, 0},
+		{bob, http.MethodDelete, 0},
+	}
+	for i, step := range steps {
+		var body struct {
+			Favorited     bool `json:"favorited"`
+			FavoriteCount int  `json:"favorite_count"`
+		}
+		if status := sendAs(t, server, step.user, step.method, path, &body); status != http.StatusOK {
+			t.Fatalf("step %d: %s returned %d", i, step.method, status)
+		}
+		if body.Favorited != (step.method == http.MethodPost) || body.FavoriteCount != step.count {
+			t.Errorf("step %d: %s gave favorited %v with count %d, want count %d", i, step.method, body.Favorited, body.FavoriteCount, step.count)
+		}
+
+		var stored MarketplaceItem
+		db.First(&stored, "id = ?", item.ID)
+		if stored.FavoriteCount != step.count {
+			t.Errorf("step %d: stored favorite count %d, want %d", i, stored.FavoriteCount, step.count)
+		}
+	}
+
+	if status := sendAs(t, server, alice, http.MethodPost, "/items/"+uuid.NewString()+"/favorite", nil); status != http.StatusNotFound {
+		t.Errorf("favoriting a missing item returned %d, want 404", status)
+	}
+	resp, err := server.Client().Post(server.URL+path, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("anonymous favorite returned %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestListFavorites(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	server := newFavoritesServer(t, m)
+	first := createTestItem(t, db, &MarketplaceItem{})
+	second := createTestItem(t, db, &MarketplaceItem{})
+	createTestItem(t, db, &MarketplaceItem{})
+	userID := uuid.New()
+
+	sendAs(t, server, userID, http.MethodPost, "/items/"+first.ID.String()+"/favorite", nil)
+	time.Sleep(10 * time.Millisecond)
+	sendAs(t, server, userID, http.MethodPost, "/items/"+second.ID.String()+"/favorite", nil)
+	sendAs(t, server, uuid.New(), http.MethodPost, "/items/"+first.ID.String()+"/favorite", nil)
+
+	var body struct {
+		Items []MarketplaceItem `json:"items"`
+		Total int64             `json:"total"`
+	}
+	if status := sendAs(t, server, userID, http.MethodGet, "/favorites", &body); status != http.StatusOK {
+		t.Fatalf("GET /favorites returned %d", status)
+	}
+	if body.Total != 2 || len(body.Items) != 2 {
+		t.Fatalf("favorites = %d of %d, want the user's 2", len(body.Items), body.Total)
+	}
+	if body.Items[0].ID != second.ID || body.Items[1].ID != first.ID {
+		t.Errorf("favorites are not most recently favorited first")
+	}
+}
+
+func TestDownloadHistoryReflectsInstalls(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	server := newFavoritesServer(t, m)
+	item := createTestItem(t, db, &MarketplaceItem{})
+	userID, serverID := uuid.New(), uuid.New()
+
+	installs := []Download{
+		{ItemID: item.ID, UserID: &userID, Version: "1.0.0", CreatedAt: time.Now().Add(-2 * time.Hour)},
+		{ItemID: item.ID, UserID: &userID, ServerID: &serverID, Version: "1.1.0", CreatedAt: time.Now().Add(-time.Hour)},
+	}
+	other := uuid.New()
+	installs = append(installs, Download{ItemID: item.ID, UserID: &other, Version: "1.1.0"})
+	for i := range installs {
+		if err := db.Create(&installs[i]).Error; err != nil {
+			t.Fatalf("failed to record download: %v", err)
+		}
+	}
+
+	var body struct {
+		Downloads []DownloadHistoryEntry `json:"downloads"`
+		Total     int64                  `json:"total"`
+	}
+	if status := sendAs(t, server, userID, http.MethodGet, "/history", &body); status != http.StatusOK {
+		t.Fatalf("GET /history returned %d", status)
+	}
+	if body.Total != 2 || len(body.Downloads) != 2 {
+		t.Fatalf("history = %d of %d entries, want the user's 2", len(body.Downloads), body.Total)
+	}
+
+	latest := body.Downloads[0]
+	if latest.Version != "1.1.0" || latest.ServerID == nil || *latest.ServerID != serverID {
+		t.Errorf("latest entry = %+v, want the 1.1.0 install on the server", latest)
+	}
+	if latest.ItemID != item.ID || latest.ItemName != item.Name || latest.ItemSlug != item.Slug {
+		t.Errorf("latest entry = %+v, want it to name the item", latest)
+	}
+	if body.Downloads[1].Version != "1.0.0" || body.Downloads[1].ServerID != nil {
+		t.Errorf("older entry = %+v, want the 1.0.0 download", body.Downloads[1])
+	}
+
+	var page struct {
+		Downloads []DownloadHistoryEntry `json:"downloads"`
+	}
+	sendAs(t, server, userID, http.MethodGet, "/history?page=2&limit=1", &page)
+	if len(page.Downloads) != 1 || page.Downloads[0].Version != "1.0.0" {
+		t.Errorf("page 2 of 1 = %+v, want the older download", page.Downloads)
+	}
+}
@@ -0,0 +1,176 @@
+package marketplace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+	"github.com/oschwald/geoip2-golang"
+	"gorm.io/gorm"
+)
+
+const (
+	// UnknownCountry is recorded for downloads whose country can't be resolved
+	UnknownCountry = "unknown"
+	// GeoIPDatabaseEnv names the environment variable holding the path of
+	// the MaxMind database NewMarketplace opens; unset turns the lookup off
+	GeoIPDatabaseEnv = "MARKETPLACE_GEOIP_DB"
+)
+
+// GeoIP resolves IP addresses with a MaxMind database. It is shared with
+// the node manager, which places players with a city database; the zero
+// value resolves nothing.
+type GeoIP struct {
+	mutex  sync.RWMutex
+	reader *geoip2.Reader
+}
+
+// CountryDownloads is the number of downloads of an item from one country
+type CountryDownloads struct {
+	Country   string `json:"country"`
+	Downloads int64  `json:"downloads"`
+}
+
+// SetGeoIPDatabase opens the MaxMind country or city database at path used
+// to resolve download countries. An empty path turns the lookup off and
+// downloads are recorded with an unknown country.
+func (m *Marketplace) SetGeoIPDatabase(path string) error {
+	return m.geoIP.Open(path)
+}
+
+// Open replaces the database with the one at path; an empty path closes it
+func (g *GeoIP) Open(path string) error {
+	var reader *geoip2.Reader
+	if path != "" {
+		var err error
+		if reader, err = geoip2.Open(path); err != nil {
+			return err
+		}
+	}
+
+	g.mutex.Lock()
+	old := g.reader
+	g.reader = reader
+	g.mutex.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// publicIP parses ip, returning nil for invalid addresses and those no
+// database lists, such as private and loopback ones
+func publicIP(ip string) net.IP {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.IsPrivate() || parsed.IsLoopback() || parsed.IsUnspecified() ||
+		parsed.IsLinkLocalUnicast() {
+		return nil
+	}
+	return parsed
+}
+
+// Country returns the ISO country code of ip, or UnknownCountry for
+// private, invalid and unlisted addresses
+func (g *GeoIP) Country(ip string) string {
+	parsed := publicIP(ip)
+	if parsed == nil {
+		return UnknownCountry
+	}
+
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	if g.reader == nil {
+		return UnknownCountry
+	}
+
+	record, err := g.reader.Country(parsed)
+	if err != nil || record.Country.IsoCode == "" {
+		return UnknownCountry
+	}
+	return record.Country.IsoCode
+}
+
+// Location returns the coordinates of ip from a city database. ok is false
+// for private, invalid and unlisted addresses, and with a country database.
+func (g *GeoIP) Location(ip string) (latitude, longitude float64, ok bool) {
+	parsed := publicIP(ip)
+	if parsed == nil {
+		return 0, 0, false
+	}
+
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	if g.reader == nil {
+		return 0, 0, false
+	}
+
+	record, err := g.reader.City(parsed)
+	if err != nil || (record.Location.Latitude == 0 && record.Location.Longitude == 0) {
+		return 0, 0, false
+	}
+	return record.Location.Latitude, record.Location.Longitude, true
+}
+
+// DownloadsByCountry returns an item's downloads grouped by country, most
+// downloads first
+func (m *Marketplace) DownloadsByCountry(ctx context.Context, itemID uuid.UUID) ([]CountryDownloads, error) {
+	var countries []CountryDownloads
+	err := m.db.WithContext(ctx).Model(&Download{}).
+		Select("COALESCE(NULLIF(country, ''), ?) AS country, COUNT(*) AS downloads", UnknownCountry).
+		Where("item_id = ?", itemID).
+		Group("1").Order("downloads DESC").
+		Scan(&countries).Error
+	return countries, err
+}
+
+// RegisterGeoRoutes mounts the download country endpoint on mux. Only the
+// user whose developer profile published the item may see it; currentUser
+// resolves the authenticated user.
+func (m *Marketplace) RegisterGeoRoutes(mux *http.ServeMux, currentUser func(r *http.Request) (uuid.UUID, error)) {
+	mux.HandleFunc("GET /items/{itemID}/downloads/countries", func(w http.ResponseWriter, r *http.Request) {
+		userID, err := currentUser(r)
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		itemID, err := uuid.Parse(r.PathValue("itemID"))
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusBadRequest, "invalid item ID")
+			return
+		}
+
+		var item MarketplaceItem
+		err = m.db.WithContext(r.Context()).Select("id", "author_id").Where("id = ?", itemID).First(&item).Error
+		author := false
+		if err == nil {
+			author, err = m.isAuthor(r.Context(), userID, &item)
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !author) {
+			utils.WriteHTTPError(w, r, http.StatusNotFound, "item not found")
+			return
+		}
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to fetch item")
+			return
+		}
+
+		countries, err := m.DownloadsByCountry(r.Context(), itemID)
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to fetch download stats")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"countries": countries,
+		})
+	})
+}
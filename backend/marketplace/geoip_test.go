@@ -0,0 +1,125 @@
+package marketplace
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"playpulse-panel/internal/testutil"
+
+	"github.com/google/uuid"
+)
+
+// testCountries are the networks in the fixture GeoIP database
+var testCountries = map[string]testutil.GeoIPNetwork{
+	"81.2.69.0/24":     {Country: "GB"},
+	"89.160.20.112/28": {Country: "SE"},
+	"216.160.83.56/29": {Country: "US"},
+}
+
+func TestGeoIPCountry(t *testing.T) {
+	var geoIP GeoIP
+	if err := geoIP.Open(testutil.WriteGeoIPDatabase(t, testCountries)); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { geoIP.Open("") })
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"81.2.69.160", "GB"},
+		{"89.160.20.115", "SE"},
+		{"216.160.83.61", "US"},
+		{"::ffff:81.2.69.1", "GB"},
+		{"89.160.20.100", UnknownCountry}, // just outside the /28
+		{"1.1.1.1", UnknownCountry},
+		{"2001:4860:4860::8888", UnknownCountry}, // the database has no IPv6
+		{"10.1.2.3", UnknownCountry},
+		{"192.168.0.10", UnknownCountry},
+		{"172.16.5.4", UnknownCountry},
+		{"127.0.0.1", UnknownCountry},
+		{"::1", UnknownCountry},
+		{"fe80::1", UnknownCountry},
+		{"0.0.0.0", UnknownCountry},
+		{"not an ip", UnknownCountry},
+		{"", UnknownCountry},
+	}
+	for _, tt := range tests {
+		if got := geoIP.Country(tt.ip); got != tt.want {
+			t.Errorf("Country(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+
+	// A country database has no coordinates
+	if _, _, ok := geoIP.Location("81.2.69.160"); ok {
+		t.Error("Location resolved an address from a country database")
+	}
+}
+
+func TestGeoIPWithoutDatabase(t *testing.T) {
+	var geoIP GeoIP
+	if got := geoIP.Country("81.2.69.160"); got != UnknownCountry {
+		t.Errorf("Country without a database = %q, want %q", got, UnknownCountry)
+	}
+
+	if err := geoIP.Open(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Error("opening a missing database succeeded")
+	}
+
+	// Closing the database turns the lookup off again
+	if err := geoIP.Open(testutil.WriteGeoIPDatabase(t, testCountries)); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := geoIP.Open(""); err != nil {
+		t.Fatalf("Open(\"\"): %v", err)
+	}
+	if got := geoIP.Country("81.2.69.160"); got != UnknownCountry {
+		t.Errorf("Country after closing = %q, want %q", got, UnknownCountry)
+	}
+}
+
+func TestDownloadsByCountry(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	if err := m.SetGeoIPDatabase(testutil.WriteGeoIPDatabase(t, testCountries)); err != nil {
+		t.Fatalf("SetGeoIPDatabase: %v", err)
+	}
+	t.Cleanup(func() { m.SetGeoIPDatabase("") })
+	item := createTestItem(t, db, &MarketplaceItem{})
+
+	for _, ip := range []string{"81.2.69.160", "81.2.69.20", "89.160.20.115", "192.168.0.10"} {
+		m.trackDownload(item.ID, InstallRequest{UserID: uuid.New(), IPAddress: ip}, "1.0.0")
+	}
+	// Downloads from before countries were resolved
+	if err := db.Create(&Download{ItemID: item.ID}).Error; err != nil {
+		t.Fatalf("failed to record download: %v", err)
+	}
+
+	var recorded Download
+	db.Where("item_id = ? AND ip_address = ?", item.ID, "89.160.20.115").First(&recorded)
+	if recorded.Country != "SE" {
+		t.Errorf("download country = %q, want it resolved at download time", recorded.Country)
+	}
+
+	countries, err := m.DownloadsByCountry(context.Background(), item.ID)
+	if err != nil {
+		t.Fatalf("DownloadsByCountry: %v", err)
+	}
+	got := make(map[string]int64)
+	for _, country := range countries {
+		got[country.Country] = country.Downloads
+	}
+	want := map[string]int64{"GB": 2, "SE": 1, UnknownCountry: 2}
+	if len(got) != len(want) {
+		t.Errorf("countries = %v, want %v", got, want)
+	}
+	for country, downloads := range want {
+		if got[country] != downloads {
+			t.Errorf("%s: %d downloads, want %d", country, got[country], downloads)
+		}
+	}
+	if countries[0].Downloads < countries[len(countries)-1].Downloads {
+		t.Errorf("countries = %v, want most downloads first", countries)
+	}
+}
@@ -0,0 +1,486 @@
+package marketplace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// githubAPIBaseURL is the GitHub REST API root, replaceable in tests
+var githubAPIBaseURL = "https://api.github.com"
+
+// githubManifestName is the optional release asset describing compatibility
+const githubManifestName = "playpulse.json"
+
+var (
+	// ErrInvalidGitHubRepo is returned for repositories not in owner/name form
+	ErrInvalidGitHubRepo = errors.New("repository must be in owner/name form")
+	// ErrGitHubRateLimited is returned while the API rate limit is exhausted
+	ErrGitHubRateLimited = errors.New("github rate limit exhausted")
+	// ErrNoReleaseAsset is returned for releases without a jar or zip asset
+	ErrNoReleaseAsset = errors.New("release has no jar or zip asset")
+)
+
+var githubRepoPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+
+// GitHubRepository is a repository whose releases are synced into an item's versions
+type GitHubRepository struct {
+	ID            uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ItemID        uuid.UUID  `json:"item_id" gorm:"type:uuid;not null;uniqueIndex"`
+	DeveloperID   uuid.UUID  `json:"developer_id" gorm:"type:uuid;not null"`
+	Repository    string     `json:"repository" gorm:"not null"` // owner/name
+	ETag          string     `json:"-" gorm:"column:etag"`
+	LastReleaseID int64      `json:"last_release_id"`
+	LastSyncedAt  *time.Time `json:"last_synced_at"`
+	LastError     string     `json:"last_error"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// githubRelease is the part of a GitHub release the sync uses
+type githubRelease struct {
+	ID         int64         `json:"id"`
+	TagName    string        `json:"tag_name"`
+	Name       string        `json:"name"`
+	Body       string        `json:"body"`
+	Prerelease bool          `json:"prerelease"`
+	Assets     []githubAsset `json:"assets"`
+}
+
+type githubAsset struct {
+	Name               string `json:"name"`
+	Size               int64  `json:"size"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// githubManifest is the playpulse.json release asset
+type githubManifest struct {
+	MinecraftVersions []string `json:"minecraft_versions"`
+	Loaders           []string `json:"loaders"`
+}
+
+// SetGitHubToken sets the token used for GitHub API requests. Authenticated
+// requests get a far higher rate limit.
+func (m *Marketplace) SetGitHubToken(token string) {
+	m.githubAPI.Token = token
+}
+
+// TrackGitHubRepository registers a repository whose releases become new
+// versions of the developer's item. Tracking an item again replaces its repository.
+func (m *Marketplace) TrackGitHubRepository(ctx context.Context, developerID, itemID uuid.UUID, repository string) (*GitHubRepository, error) {
+	repository = strings.Trim(strings.TrimPrefix(strings.TrimSpace(repository), "https://github.com/"), "/")
+	if !githubRepoPattern.MatchString(repository) {
+		return nil, ErrInvalidGitHubRepo
+	}
+
+	var item MarketplaceItem
+	if err := m.db.WithContext(ctx).Where("id = ? AND author_id = ?", itemID, developerID).First(&item).Error; err != nil {
+		return nil, fmt.Errorf("item not found: %w", err)
+	}
+
+	repo := &GitHubRepository{
+		ItemID:      itemID,
+		DeveloperID: developerID,
+		Repository:  repository,
+	}
+
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("item_id = ?", itemID).Delete(&GitHubRepository{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(repo).Error; err != nil {
+			return err
+		}
+		return tx.Model(&item).Updates(map[string]interface{}{
+			"external_source": "github",
+			"external_id":     repository,
+			"external_url":    "https://github.com/" + repository,
+		}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to track repository: %w", err)
+	}
+
+	return repo, nil
+}
+
+// UntrackGitHubRepository stops syncing releases into the item
+func (m *Marketplace) UntrackGitHubRepository(ctx context.Context, developerID, itemID uuid.UUID) error {
+	return m.db.WithContext(ctx).Where("item_id = ? AND developer_id = ?", itemID, developerID).
+		Delete(&GitHubRepository{}).Error
+}
+
+// syncFromGitHub checks every tracked repository for a new latest release.
+// Unchanged releases are answered with 304 through the stored ETag, which
+// GitHub does not count against the rate limit.
+func (m *Marketplace) syncFromGitHub(ctx context.Context) error {
+	var repos []GitHubRepository
+	if err := m.db.WithContext(ctx).Find(&repos).Error; err != nil {
+		return err
+	}
+
+	for i := range repos {
+		err := m.syncGitHubRepository(ctx, &repos[i])
+		if errors.Is(err, ErrGitHubRateLimited) {
+			return err
+		}
+		if err != nil {
+			log.Printf("GitHub sync of %s failed: %v", repos[i].Repository, err)
+		}
+	}
+
+	return nil
+}
+
+func (m *Marketplace) syncGitHubRepository(ctx context.Context, repo *GitHubRepository) error {
+	release, etag, err := m.githubAPI.latestRelease(ctx, repo.Repository, repo.ETag)
+
+	now := time.Now()
+	updates := map[string]interface{}{"last_synced_at": now, "last_error": ""}
+	defer func() {
+		m.db.Model(repo).Updates(updates)
+	}()
+
+	if err != nil {
+		updates["last_error"] = err.Error()
+		return err
+	}
+
+	// Not modified, or already synced
+	if release == nil || release.ID == repo.LastReleaseID {
+		if etag != "" {
+			updates["etag"] = etag
+		}
+		return nil
+	}
+
+	version, err := m.githubReleaseVersion(ctx, repo, release)
+	if err != nil {
+		updates["last_error"] = err.Error()
+		return err
+	}
+
+	err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(version).Error; err != nil {
+			return err
+		}
+		return tx.Model(&MarketplaceItem{}).Where("id = ?", repo.ItemID).Update("last_updated", now).Error
+	})
+	if err != nil {
+		updates["last_error"] = err.Error()
+		return fmt.Errorf("failed to save version: %w", err)
+	}
+
+	// Only remember the ETag once the release is stored, so a failed sync is retried
+	updates["last_release_id"] = release.ID
+	updates["etag"] = etag
+	return nil
+}
+
+// githubReleaseVersion maps a release to a pending ItemVersion. The jar (or
+// failing that zip) asset is the download; compatibility comes from a
+// playpulse.json asset when present, otherwise from the release notes.
+func (m *Marketplace) githubReleaseVersion(ctx context.Context, repo *GitHubRepository, release *githubRelease) (*ItemVersion, error) {
+	asset := pickReleaseAsset(release.Assets)
+	if asset == nil {
+		return nil, ErrNoReleaseAsset
+	}
+
+	manifest := githubManifest{}
+	found := false
+	for _, candidate := range release.Assets {
+		if strings.EqualFold(candidate.Name, githubManifestName) {
+			if err := m.githubAPI.getJSON(ctx, candidate.BrowserDownloadURL, &manifest); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", githubManifestName, err)
+			}
+			found = true
+			break
+		}
+	}
+	if !found {
+		manifest = parseReleaseNotes(release.Body)
+	}
+
+	versionName := strings.TrimPrefix(release.TagName, "v")
+	if versionName == "" {
+		versionName = release.Name
+	}
+
+	return &ItemVersion{
+		ItemID:            repo.ItemID,
+		Version:           versionName,
+		Changelog:         release.Body,
+		MinecraftVersions: manifest.MinecraftVersions,
+		ServerTypes:       manifest.Loaders,
+		DownloadURL:       asset.BrowserDownloadURL,
+		FileSize:          asset.Size,
+		Status:            VersionStatusPending,
+		IsStable:          !release.Prerelease,
+		IsBeta:            release.Prerelease,
+	}, nil
+}
+
+// pickReleaseAsset prefers a jar over a zip, skipping sources and javadoc jars
+func pickReleaseAsset(assets []githubAsset) *githubAsset {
+	var zip *githubAsset
+	for i := range assets {
+		name := strings.ToLower(assets[i].Name)
+		switch {
+		case strings.HasSuffix(name, "-sources.jar") || strings.HasSuffix(name, "-javadoc.jar"):
+		case strings.HasSuffix(name, ".jar"):
+			return &assets[i]
+		case strings.HasSuffix(name, ".zip") && zip == nil:
+			zip = &assets[i]
+		}
+	}
+	return zip
+}
+
+var (
+	releaseNotesMinecraft = regexp.MustCompile(`(?im)^\W*(?:minecraft|mc|game)[ _-]?versions?\W*:\s*(.+)$`)
+	releaseNotesLoaders   = regexp.MustCompile(`(?im)^\W*(?:loaders?|platforms?|server[ _-]?types?)\W*:\s*(.+)$`)
+)
+
+// parseReleaseNotes reads "Minecraft: 1.20.1, 1.20.4" and "Loaders: paper,
+// fabric" lines from a release description
+func parseReleaseNotes(body string) githubManifest {
+	split := func(value string) []string {
+		var values []string
+		for _, part := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '|' }) {
+			if part = strings.Trim(part, "`*_"); part != "" {
+				values = append(values, strings.ToLower(part))
+			}
+		}
+		return values
+	}
+
+	var manifest githubManifest
+	if match := releaseNotesMinecraft.FindStringSubmatch(body); match != nil {
+		manifest.MinecraftVersions = split(match[1])
+	}
+	if match := releaseNotesLoaders.FindStringSubmatch(body); match != nil {
+		manifest.Loaders = split(match[1])
+	}
+	return manifest
+}
+
+// latestRelease fetches the repository's latest release. A nil release means
+// it is unchanged since etag.
+func (g *GitHubAPI) latestRelease(ctx context.Context, repository, etag string) (*githubRelease, string, error) {
+	if g.rateLimitedUntil.After(time.Now()) {
+		return nil, "", ErrGitHubRateLimited
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/repos/%s/releases/latest", githubAPIBaseURL, repository), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	g.setHeaders(req)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	g.trackRateLimit(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, etag, nil
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.StatusCode == http.StatusTooManyRequests {
+			return nil, "", ErrGitHubRateLimited
+		}
+		return nil, "", fmt.Errorf("github returned %s", resp.Status)
+	case http.StatusNotFound:
+		return nil, "", fmt.Errorf("repository %s has no published release", repository)
+	default:
+		return nil, "", fmt.Errorf("github returned %s", resp.Status)
+	}
+
+	var release githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, "", fmt.Errorf("invalid release response: %w", err)
+	}
+	return &release, resp.Header.Get("ETag"), nil
+}
+
+// getJSON downloads a small JSON document such as a release asset
+func (g *GitHubAPI) getJSON(ctx context.Context, url string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	g.setHeaders(req)
+	req.Header.Set("Accept", "application/octet-stream")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download returned %s", resp.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(target)
+}
+
+func (g *GitHubAPI) setHeaders(req *http.Request) {
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+}
+
+// trackRateLimit pauses requests until the reset time once the remaining
+// allowance is used up
+func (g *GitHubAPI) trackRateLimit(resp *http.Response) {
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return
+	}
+
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		g.rateLimitedUntil = time.Now().Add(time.Hour)
+		return
+	}
+	g.rateLimitedUntil = time.Unix(reset, 0)
+}
+
+// RegisterGitHubRoutes mounts the endpoints developers use to have an item
+// track a GitHub repository on mux. Tracked repositories are synced by
+// SyncExternalSources; the sync endpoint checks one straight away.
+// currentUser resolves the authenticated user, whose developer profile must
+// have published the item.
+func (m *Marketplace) RegisterGitHubRoutes(mux *http.ServeMux, currentUser func(r *http.Request) (uuid.UUID, error)) {
+	mux.HandleFunc("GET /items/{itemID}/github", func(w http.ResponseWriter, r *http.Request) {
+		developerID, itemID, ok := m.githubRouteParams(w, r, currentUser)
+		if !ok {
+			return
+		}
+
+		var repo GitHubRepository
+		err := m.db.WithContext(r.Context()).Where("item_id = ? AND developer_id = ?", itemID, developerID).First(&repo).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.WriteHTTPError(w, r, http.StatusNotFound, "item does not track a repository")
+			return
+		}
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to fetch repository")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(repo)
+	})
+
+	mux.HandleFunc("PUT /items/{itemID}/github", func(w http.ResponseWriter, r *http.Request) {
+		developerID, itemID, ok := m.githubRouteParams(w, r, currentUser)
+		if !ok {
+			return
+		}
+
+		var body struct {
+			Repository string `json:"repository"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			utils.WriteHTTPError(w, r, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		repo, err := m.TrackGitHubRepository(r.Context(), developerID, itemID, body.Repository)
+		switch {
+		case errors.Is(err, ErrInvalidGitHubRepo):
+			utils.WriteHTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.WriteHTTPError(w, r, http.StatusNotFound, "item not found")
+			return
+		case err != nil:
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to track repository")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(repo)
+	})
+
+	mux.HandleFunc("DELETE /items/{itemID}/github", func(w http.ResponseWriter, r *http.Request) {
+		developerID, itemID, ok := m.githubRouteParams(w, r, currentUser)
+		if !ok {
+			return
+		}
+
+		if err := m.UntrackGitHubRepository(r.Context(), developerID, itemID); err != nil {
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to untrack repository")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /items/{itemID}/github/sync", func(w http.ResponseWriter, r *http.Request) {
+		developerID, itemID, ok := m.githubRouteParams(w, r, currentUser)
+		if !ok {
+			return
+		}
+
+		var repo GitHubRepository
+		if err := m.db.WithContext(r.Context()).Where("item_id = ? AND developer_id = ?", itemID, developerID).First(&repo).Error; err != nil {
+			utils.WriteHTTPError(w, r, http.StatusNotFound, "item does not track a repository")
+			return
+		}
+
+		err := m.syncGitHubRepository(r.Context(), &repo)
+		if errors.Is(err, ErrGitHubRateLimited) {
+			utils.WriteHTTPError(w, r, http.StatusTooManyRequests, err.Error())
+			return
+		}
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusBadGateway, err.Error())
+			return
+		}
+
+		m.db.WithContext(r.Context()).First(&repo, "id = ?", repo.ID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(repo)
+	})
+}
+
+// githubRouteParams resolves the developer profile of the authenticated user
+// and the item of a GitHub route, writing the error response when either is
+// missing
+func (m *Marketplace) githubRouteParams(w http.ResponseWriter, r *http.Request, currentUser func(r *http.Request) (uuid.UUID, error)) (uuid.UUID, uuid.UUID, bool) {
+	developerID, ok := m.currentDeveloper(w, r, currentUser)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	itemID, err := uuid.Parse(r.PathValue("itemID"))
+	if err != nil {
+		utils.WriteHTTPError(w, r, http.StatusBadRequest, "invalid item ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return developerID, itemID, true
+}
@@ -0,0 +1,293 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// recordedRelease is a GitHub "get the latest release" response, trimmed to
+// the fields around the ones the sync reads. {{server}} is replaced with the
+// mock's URL so the manifest asset downloads from it.
+const recordedRelease = `{
+  "url": "https://api.github.com/repos/example/BetterSpawns/releases/148923711",
+  "html_url": "https://github.com/example/BetterSpawns/releases/tag/v2.4.0",
+  "id": 148923711,
+  "node_id": "RE_kwDOKx7c8s4I37Y_",
+  "tag_name": "v2.4.0",
+  "target_commitish": "main",
+  "name": "BetterSpawns 2.4.0",
+  "draft": false,
+  "prerelease": false,
+  "created_at": "2024-03-18T09:12:44Z",
+  "published_at": "2024-03-18T09:20:02Z",
+  "assets": [
+    {
+      "id": 158812001,
+      "name": "BetterSpawns-2.4.0-sources.jar",
+      "content_type": "application/java-archive",
+      "state": "uploaded",
+      "size": 48211,
+      "download_count": 12,
+      "browser_download_url": "https://github.com/example/BetterSpawns/releases/download/v2.4.0/BetterSpawns-2.4.0-sources.jar"
+    },
+    {
+      "id": 158812002,
+      "name": "BetterSpawns-2.4.0.jar",
+      "content_type": "application/java-archive",
+      "state": "uploaded",
+      "size": 183552,
+      "download_count": 907,
+      "browser_download_url": "https://github.com/example/BetterSpawns/releases/download/v2.4.0/BetterSpawns-2.4.0.jar"
+    },
+    {
+      "id": 158812003,
+      "name": "playpulse.json",
+      "content_type": "application/json",
+      "state": "uploaded",
+      "size": 71,
+      "download_count": 40,
+      "browser_download_url": "{{server}}/download/playpulse.json"
+    }
+  ],
+  "body": "## Changes\r\n- Spawn points respect world borders\r\n\r\nMinecraft: 1.19.4"
+}`
+
+const recordedManifest = `{"minecraft_versions": ["1.20.4", "1.20.6"], "loaders": ["paper", "purpur"]}`
+
+// githubMock serves the recorded release with an ETag, answering 304 to a
+// request carrying it
+type githubMock struct {
+	mutex       sync.Mutex
+	etag        string
+	requests    []*http.Request
+	notModified int
+}
+
+// seen returns the release requests received and how many were answered 304
+func (g *githubMock) seen() ([]*http.Request, int) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return append([]*http.Request(nil), g.requests...), g.notModified
+}
+
+// useGitHubMock points the GitHub API at a mock serving the recorded release
+// of example/BetterSpawns until the test ends
+func useGitHubMock(t *testing.T) *githubMock {
+	t.Helper()
+
+	mock := &githubMock{etag: `W/"6f2c1b5d8a"`}
+	mux := http.NewServeMux()
+	var serverURL string
+	mux.HandleFunc("GET /repos/example/BetterSpawns/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		mock.mutex.Lock()
+		mock.requests = append(mock.requests, r)
+		etag := mock.etag
+		if r.Header.Get("If-None-Match") == etag {
+			mock.notModified++
+		}
+		mock.mutex.Unlock()
+
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(strings.ReplaceAll(recordedRelease, "{{server}}", serverURL)))
+	})
+	mux.HandleFunc("GET /download/playpulse.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(recordedManifest))
+	})
+
+	server := httptest.NewServer(mux)
+	serverURL = server.URL
+	t.Cleanup(server.Close)
+
+	previous := githubAPIBaseURL
+	githubAPIBaseURL = server.URL
+	t.Cleanup(func() { githubAPIBaseURL = previous })
+
+	return mock
+}
+
+func TestLatestReleaseConditionalRequest(t *testing.T) {
+	mock := useGitHubMock(t)
+	api := &GitHubAPI{Token: "ghp_test", client: http.DefaultClient}
+
+	release, etag, err := api.latestRelease(context.Background(), "example/BetterSpawns", "")
+	if err != nil {
+		t.Fatalf("latestRelease: %v", err)
+	}
+	if release == nil || release.ID != 148923711 || release.TagName != "v2.4.0" || len(release.Assets) != 3 {
+		t.Fatalf("release = %+v, want the recorded release", release)
+	}
+	if etag != mock.etag {
+		t.Errorf("etag = %q, want %q", etag, mock.etag)
+	}
+
+	release, again, err := api.latestRelease(context.Background(), "example/BetterSpawns", etag)
+	if err != nil {
+		t.Fatalf("conditional latestRelease: %v", err)
+	}
+	if release != nil || again != etag {
+		t.Errorf("304 gave release %+v and etag %q, want no release and the same etag", release, again)
+	}
+
+	requests, notModified := mock.seen()
+	if len(requests) != 2 || notModified != 1 {
+		t.Fatalf("%d requests, %d not modified, want 2 with the second answered 304", len(requests), notModified)
+	}
+	if got := requests[0].Header.Get("If-None-Match"); got != "" {
+		t.Errorf("first request sent If-None-Match %q", got)
+	}
+	if got := requests[0].Header.Get("Authorization"); got != "Bearer ghp_test" {
+		t.Errorf("Authorization = %q, want the token", got)
+	}
+}
+
+func TestLatestReleaseRateLimited(t *testing.T) {
+	var requests atomic.Int32
+	reset := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	t.Cleanup(server.Close)
+	previous := githubAPIBaseURL
+	githubAPIBaseURL = server.URL
+	t.Cleanup(func() { githubAPIBaseURL = previous })
+
+	api := &GitHubAPI{client: server.Client()}
+	if _, _, err := api.latestRelease(context.Background(), "example/BetterSpawns", ""); !errors.Is(err, ErrGitHubRateLimited) {
+		t.Fatalf("latestRelease = %v, want ErrGitHubRateLimited", err)
+	}
+	if !api.rateLimitedUntil.Equal(reset) {
+		t.Errorf("rate limited until %v, want the reset time %v", api.rateLimitedUntil, reset)
+	}
+
+	// Until the reset nothing is sent
+	if _, _, err := api.latestRelease(context.Background(), "example/BetterSpawns", ""); !errors.Is(err, ErrGitHubRateLimited) {
+		t.Errorf("second latestRelease = %v, want ErrGitHubRateLimited", err)
+	}
+	if sent := requests.Load(); sent != 1 {
+		t.Errorf("%d requests sent, want 1", sent)
+	}
+}
+
+func TestPickReleaseAsset(t *testing.T) {
+	tests := []struct {
+		assets []string
+		want   string
+	}{
+		{[]string{"Plugin-1.0-sources.jar", "Plugin-1.0-javadoc.jar", "Plugin-1.0.jar"}, "Plugin-1.0.jar"},
+		{[]string{"Datapack.zip", "Plugin.JAR"}, "Plugin.JAR"},
+		{[]string{"checksums.txt", "Pack-a.zip", "Pack-b.zip"}, "Pack-a.zip"},
+		{[]string{"Plugin-sources.jar", "notes.md"}, ""},
+	}
+	for _, tt := range tests {
+		var assets []githubAsset
+		for _, name := range tt.assets {
+			assets = append(assets, githubAsset{Name: name})
+		}
+		got := ""
+		if asset := pickReleaseAsset(assets); asset != nil {
+			got = asset.Name
+		}
+		if got != tt.want {
+			t.Errorf("pickReleaseAsset(%v) = %q, want %q", tt.assets, got, tt.want)
+		}
+	}
+}
+
+func TestParseReleaseNotes(t *testing.T) {
+	body := "## What's new\n- Faster startup\n\n**Minecraft versions:** 1.20.1, 1.20.4\n* Loaders: `Paper` | Purpur\n"
+	got := parseReleaseNotes(body)
+	want := githubManifest{
+		MinecraftVersions: []string{"1.20.1", "1.20.4"},
+		Loaders:           []string{"paper", "purpur"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseReleaseNotes = %+v, want %+v", got, want)
+	}
+
+	if got := parseReleaseNotes("Bug fixes only"); got.MinecraftVersions != nil || got.Loaders != nil {
+		t.Errorf("notes without compatibility lines gave %+v", got)
+	}
+}
+
+func TestSyncGitHubRepository(t *testing.T) {
+	db := testDB(t)
+	mock := useGitHubMock(t)
+	m := &Marketplace{db: db, githubAPI: &GitHubAPI{client: http.DefaultClient}}
+
+	developerID := uuid.New()
+	item := createTestItem(t, db, &MarketplaceItem{AuthorID: developerID})
+
+	if _, err := m.TrackGitHubRepository(context.Background(), uuid.New(), item.ID, "example/BetterSpawns"); err == nil {
+		t.Error("another developer tracked a repository for the item")
+	}
+	if _, err := m.TrackGitHubRepository(context.Background(), developerID, item.ID, "not a repo"); !errors.Is(err, ErrInvalidGitHubRepo) {
+		t.Errorf("TrackGitHubRepository with a bad name = %v, want ErrInvalidGitHubRepo", err)
+	}
+	repo, err := m.TrackGitHubRepository(context.Background(), developerID, item.ID, "https://github.com/example/BetterSpawns/")
+	if err != nil {
+		t.Fatalf("TrackGitHubRepository: %v", err)
+	}
+	if repo.Repository != "example/BetterSpawns" {
+		t.Errorf("repository = %q, want owner/name", repo.Repository)
+	}
+
+	if err := m.syncFromGitHub(context.Background()); err != nil {
+		t.Fatalf("syncFromGitHub: %v", err)
+	}
+
+	var versions []ItemVersion
+	db.Where("item_id = ?", item.ID).Find(&versions)
+	if len(versions) != 1 {
+		t.Fatalf("%d versions after the sync, want 1", len(versions))
+	}
+	version := versions[0]
+	if version.Version != "2.4.0" || version.Status != VersionStatusPending || !version.IsStable {
+		t.Errorf("version = %+v, want a pending stable 2.4.0", version)
+	}
+	if version.DownloadURL != "https://github.com/example/BetterSpawns/releases/download/v2.4.0/BetterSpawns-2.4.0.jar" || version.FileSize != 183552 {
+		t.Errorf("download %s (%d bytes), want the plugin jar", version.DownloadURL, version.FileSize)
+	}
+	// The manifest asset wins over the release notes
+	if !reflect.DeepEqual(version.MinecraftVersions, []string{"1.20.4", "1.20.6"}) || !reflect.DeepEqual(version.ServerTypes, []string{"paper", "purpur"}) {
+		t.Errorf("compatibility = %v on %v, want the manifest's", version.MinecraftVersions, version.ServerTypes)
+	}
+
+	var synced GitHubRepository
+	db.First(&synced, "id = ?", repo.ID)
+	if synced.ETag != mock.etag || synced.LastReleaseID != 148923711 || synced.LastSyncedAt == nil || synced.LastError != "" {
+		t.Errorf("repository after sync = %+v, want the ETag and release stored", synced)
+	}
+
+	// Nothing changed, so the next sync is a 304 and adds no version
+	if err := m.syncFromGitHub(context.Background()); err != nil {
+		t.Fatalf("second syncFromGitHub: %v", err)
+	}
+	if _, notModified := mock.seen(); notModified != 1 {
+		t.Errorf("second sync got %d 304 responses, want 1", notModified)
+	}
+	var count int64
+	db.Model(&ItemVersion{}).Where("item_id = ?", item.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("%d versions after an unchanged sync, want still 1", count)
+	}
+}
@@ -0,0 +1,87 @@
+package marketplace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// searchToken is a word only the calling test's items contain
+func searchToken() string {
+	return "tok" + uuid.NewString()[:8]
+}
+
+func TestSearchItemsTotalMatchesFilters(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	token := searchToken()
+
+	for i := 0; i < 3; i++ {
+		createTestItem(t, db, &MarketplaceItem{Name: uniqueName(token), Category: CategoryPlugins, IsFree: true})
+	}
+	createTestItem(t, db, &MarketplaceItem{Name: uniqueName(token), Category: CategoryThemes, IsFree: true})
+	createTestItem(t, db, &MarketplaceItem{Name: uniqueName(token), Category: CategoryPlugins, Status: StatusPending})
+
+	query := SearchQuery{Query: token, Category: string(CategoryPlugins), Limit: 2}
+	results, err := m.SearchItems(context.Background(), query)
+	if err != nil {
+		t.Fatalf("SearchItems: %v", err)
+	}
+	if results.Total != 3 || results.TotalPages != 2 || len(results.Items) != 2 {
+		t.Errorf("total %d, %d pages, %d items, want 3 matching items over 2 pages of 2",
+			results.Total, results.TotalPages, len(results.Items))
+	}
+
+	query.Page = 2
+	results, err = m.SearchItems(context.Background(), query)
+	if err != nil {
+		t.Fatalf("SearchItems: %v", err)
+	}
+	if len(results.Items) != 1 || results.Total != 3 {
+		t.Errorf("last page has %d items of %d, want 1 of 3", len(results.Items), results.Total)
+	}
+	for _, item := range results.Items {
+		if item.Category != CategoryPlugins || item.Status != StatusApproved {
+			t.Errorf("result %s is %s/%s, want approved plugins only", item.Name, item.Category, item.Status)
+		}
+	}
+}
+
+func TestSearchItemsRanksExactNameFirst(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	token := searchToken()
+
+	popular := createTestItem(t, db, &MarketplaceItem{
+		Name:            uniqueName("Popular"),
+		Description:     "Works well alongside " + token,
+		PopularityScore: 100,
+	})
+	prefixed := createTestItem(t, db, &MarketplaceItem{Name: token + " Extras", PopularityScore: 40})
+	exact := createTestItem(t, db, &MarketplaceItem{Name: token, PopularityScore: 1})
+
+	results, err := m.SearchItems(context.Background(), SearchQuery{Query: token, SortBy: "relevance"})
+	if err != nil {
+		t.Fatalf("SearchItems: %v", err)
+	}
+	if len(results.Items) != 3 {
+		t.Fatalf("%d results, want 3", len(results.Items))
+	}
+
+	want := []uuid.UUID{exact.ID, prefixed.ID, popular.ID}
+	for i, item := range results.Items {
+		if item.ID != want[i] {
+			t.Errorf("result %d is %q, want the exact name match first, then name matches, then descriptions", i, item.Name)
+		}
+	}
+
+	// Relevance is the default order when searching by text
+	results, err = m.SearchItems(context.Background(), SearchQuery{Query: token})
+	if err != nil {
+		t.Fatalf("SearchItems: %v", err)
+	}
+	if len(results.Items) == 0 || results.Items[0].ID != exact.ID {
+		t.Error("default sort for a text search doesn't put the exact match first")
+	}
+}
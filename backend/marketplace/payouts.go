@@ -0,0 +1,455 @@
+package marketplace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PlatformFee is the share of each sale the marketplace keeps
+var PlatformFee = 0.10
+
+// defaultMinimumPayout applies to developers who have not set their own
+const defaultMinimumPayout = 25.0
+
+var (
+	// ErrBelowMinimumPayout is returned when a developer requests a payout
+	// before their balance reaches the minimum
+	ErrBelowMinimumPayout = errors.New("balance is below the minimum payout")
+	// ErrNoPayoutMethod is returned when a developer has no payout details
+	ErrNoPayoutMethod = errors.New("no payout method configured")
+	// ErrPayoutNotPending is returned when approving or rejecting a payout
+	// that was already processed
+	ErrPayoutNotPending = errors.New("payout request is not pending")
+	// ErrPurchaseNotPending is returned when completing a purchase that was
+	// already completed or refunded
+	ErrPurchaseNotPending = errors.New("purchase is not pending")
+)
+
+type PurchaseStatus string
+
+const (
+	PurchaseStatusPending   PurchaseStatus = "pending"
+	PurchaseStatusCompleted PurchaseStatus = "completed"
+	PurchaseStatusRefunded  PurchaseStatus = "refunded"
+)
+
+// Purchase records a user buying a paid item
+type Purchase struct {
+	ID        uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ItemID    uuid.UUID      `json:"item_id" gorm:"type:uuid;not null;index"`
+	UserID    uuid.UUID      `json:"user_id" gorm:"type:uuid;not null"`
+	Amount    float64        `json:"amount"`
+	Currency  string         `json:"currency" gorm:"default:'USD'"`
+	PaymentID string         `json:"payment_id"`
+	Status    PurchaseStatus `json:"status" gorm:"default:'pending'"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+type PayoutStatus string
+
+const (
+	PayoutStatusPending  PayoutStatus = "pending"
+	PayoutStatusApproved PayoutStatus = "approved"
+	PayoutStatusRejected PayoutStatus = "rejected"
+)
+
+// PayoutRequest is a developer asking to be paid their balance
+type PayoutRequest struct {
+	ID          uuid.UUID    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	DeveloperID uuid.UUID    `json:"developer_id" gorm:"type:uuid;not null;index"`
+	Amount      float64      `json:"amount"`
+	Status      PayoutStatus `json:"status" gorm:"default:'pending'"`
+	CreatedAt   time.Time    `json:"created_at"`
+	ProcessedAt *time.Time   `json:"processed_at"`
+}
+
+// ItemRevenue is the sales and downloads of one item over a report period
+type ItemRevenue struct {
+	ItemID       uuid.UUID `json:"item_id"`
+	Name         string    `json:"name"`
+	Sales        int64     `json:"sales"`
+	GrossRevenue float64   `json:"gross_revenue"`
+	NetRevenue   float64   `json:"net_revenue"`
+	Downloads    int64     `json:"downloads"`
+}
+
+// RevenueReport returns per-item sales and downloads for the developer's
+// items between from and to. Net revenue is completed purchases minus the
+// platform fee.
+func (m *Marketplace) RevenueReport(ctx context.Context, developerID uuid.UUID, from, to time.Time) ([]ItemRevenue, error) {
+	db := m.db.WithContext(ctx)
+
+	var report []ItemRevenue
+	if err := db.Model(&MarketplaceItem{}).Select("id AS item_id, name").
+		Where("author_id = ?", developerID).Order("name").Scan(&report).Error; err != nil {
+		return nil, err
+	}
+
+	var sales []struct {
+		ItemID uuid.UUID
+		Sales  int64
+		Gross  float64
+	}
+	if err := db.Model(&Purchase{}).
+		Select("purchases.item_id, COUNT(*) AS sales, COALESCE(SUM(purchases.amount), 0) AS gross").
+		Joins("JOIN marketplace_items ON marketplace_items.id = purchases.item_id").
+		Where("marketplace_items.author_id = ? AND purchases.status = ?", developerID, PurchaseStatusCompleted).
+		Where("purchases.created_at >= ? AND purchases.created_at < ?", from, to).
+		Group("purchases.item_id").Scan(&sales).Error; err != nil {
+		return nil, err
+	}
+
+	var downloads []struct {
+		ItemID    uuid.UUID
+		Downloads int64
+	}
+	if err := db.Model(&Download{}).
+		Select("downloads.item_id, COUNT(*) AS downloads").
+		Joins("JOIN marketplace_items ON marketplace_items.id = downloads.item_id").
+		Where("marketplace_items.author_id = ?", developerID).
+		Where("downloads.created_at >= ? AND downloads.created_at < ?", from, to).
+		Group("downloads.item_id").Scan(&downloads).Error; err != nil {
+		return nil, err
+	}
+
+	index := make(map[uuid.UUID]*ItemRevenue, len(report))
+	for i := range report {
+		index[report[i].ItemID] = &report[i]
+	}
+	for _, s := range sales {
+		if item, ok := index[s.ItemID]; ok {
+			item.Sales = s.Sales
+			item.GrossRevenue = s.Gross
+			item.NetRevenue = netRevenue(s.Gross)
+		}
+	}
+	for _, d := range downloads {
+		if item, ok := index[d.ItemID]; ok {
+			item.Downloads = d.Downloads
+		}
+	}
+
+	return report, nil
+}
+
+// CompletePurchase marks a pending purchase as paid and adds the author's
+// share to their total revenue in the same transaction, so the two can't
+// drift apart
+func (m *Marketplace) CompletePurchase(ctx context.Context, purchaseID uuid.UUID, paymentID string) (*Purchase, error) {
+	var purchase Purchase
+
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&purchase, "id = ?", purchaseID).Error; err != nil {
+			return err
+		}
+		if purchase.Status != PurchaseStatusPending {
+			return ErrPurchaseNotPending
+		}
+
+		purchase.Status = PurchaseStatusCompleted
+		purchase.PaymentID = paymentID
+		if err := tx.Model(&purchase).Updates(map[string]interface{}{
+			"status":     purchase.Status,
+			"payment_id": purchase.PaymentID,
+		}).Error; err != nil {
+			return err
+		}
+
+		var item MarketplaceItem
+		if err := tx.Select("author_id").First(&item, "id = ?", purchase.ItemID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Developer{}).Where("id = ?", item.AuthorID).
+			Update("total_revenue", gorm.Expr("total_revenue + ?", netRevenue(purchase.Amount))).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &purchase, nil
+}
+
+// ListPendingPayouts returns payout requests waiting for an admin, oldest
+// first
+func (m *Marketplace) ListPendingPayouts(ctx context.Context) ([]PayoutRequest, error) {
+	var payouts []PayoutRequest
+	err := m.db.WithContext(ctx).Where("status = ?", PayoutStatusPending).Order("created_at").Find(&payouts).Error
+	return payouts, err
+}
+
+// DeveloperBalance returns the developer's net revenue not yet paid out or
+// held by a pending payout request
+func (m *Marketplace) DeveloperBalance(ctx context.Context, developerID uuid.UUID) (float64, error) {
+	return developerBalance(m.db.WithContext(ctx), developerID)
+}
+
+// RequestPayout records a request to pay out the developer's whole balance,
+// for an admin to approve. The balance must reach the developer's minimum
+// payout.
+func (m *Marketplace) RequestPayout(ctx context.Context, developerID uuid.UUID) (*PayoutRequest, error) {
+	var payout *PayoutRequest
+
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the developer so concurrent requests can't claim the same balance
+		var developer Developer
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&developer, "id = ?", developerID).Error; err != nil {
+			return err
+		}
+
+		if developer.PayoutInfo.PayPalEmail == "" && developer.PayoutInfo.BankAccount == "" {
+			return ErrNoPayoutMethod
+		}
+
+		balance, err := developerBalance(tx, developerID)
+		if err != nil {
+			return err
+		}
+
+		minimum := developer.PayoutInfo.MinimumPayout
+		if minimum <= 0 {
+			minimum = defaultMinimumPayout
+		}
+		if balance < minimum {
+			return ErrBelowMinimumPayout
+		}
+
+		payout = &PayoutRequest{
+			DeveloperID: developerID,
+			Amount:      balance,
+			Status:      PayoutStatusPending,
+		}
+		return tx.Create(payout).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return payout, nil
+}
+
+// ListPayouts returns the developer's payout requests, newest first
+func (m *Marketplace) ListPayouts(ctx context.Context, developerID uuid.UUID) ([]PayoutRequest, error) {
+	var payouts []PayoutRequest
+	err := m.db.WithContext(ctx).Where("developer_id = ?", developerID).Order("created_at DESC").Find(&payouts).Error
+	return payouts, err
+}
+
+// ApprovePayout marks a pending payout request as paid
+func (m *Marketplace) ApprovePayout(ctx context.Context, payoutID uuid.UUID) error {
+	return m.setPayoutStatus(ctx, payoutID, PayoutStatusApproved)
+}
+
+// RejectPayout declines a pending payout request, returning its amount to
+// the developer's balance
+func (m *Marketplace) RejectPayout(ctx context.Context, payoutID uuid.UUID) error {
+	return m.setPayoutStatus(ctx, payoutID, PayoutStatusRejected)
+}
+
+func (m *Marketplace) setPayoutStatus(ctx context.Context, payoutID uuid.UUID, status PayoutStatus) error {
+	result := m.db.WithContext(ctx).Model(&PayoutRequest{}).
+		Where("id = ? AND status = ?", payoutID, PayoutStatusPending).
+		Updates(map[string]interface{}{"status": status, "processed_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		m.db.WithContext(ctx).Model(&PayoutRequest{}).Where("id = ?", payoutID).Count(&count)
+		if count == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return ErrPayoutNotPending
+	}
+
+	return nil
+}
+
+// developerBalance is lifetime net revenue minus payouts that are pending or
+// already approved
+func developerBalance(db *gorm.DB, developerID uuid.UUID) (float64, error) {
+	var gross float64
+	if err := db.Model(&Purchase{}).Select("COALESCE(SUM(purchases.amount), 0)").
+		Joins("JOIN marketplace_items ON marketplace_items.id = purchases.item_id").
+		Where("marketplace_items.author_id = ? AND purchases.status = ?", developerID, PurchaseStatusCompleted).
+		Scan(&gross).Error; err != nil {
+		return 0, err
+	}
+
+	var paid float64
+	if err := db.Model(&PayoutRequest{}).Select("COALESCE(SUM(amount), 0)").
+		Where("developer_id = ? AND status IN ?", developerID, []PayoutStatus{PayoutStatusPending, PayoutStatusApproved}).
+		Scan(&paid).Error; err != nil {
+		return 0, err
+	}
+
+	return netRevenue(gross) - paid, nil
+}
+
+// netRevenue is what the developer earns from gross sales
+func netRevenue(gross float64) float64 {
+	return gross * (1 - PlatformFee)
+}
+
+// RegisterPayoutRoutes mounts the developer revenue and payout endpoints on
+// mux. currentUser resolves the authenticated user, whose developer profile
+// the revenue and payouts are looked up under.
+func (m *Marketplace) RegisterPayoutRoutes(mux *http.ServeMux, currentUser func(r *http.Request) (uuid.UUID, error)) {
+	mux.HandleFunc("GET /developer/revenue", func(w http.ResponseWriter, r *http.Request) {
+		developerID, ok := m.currentDeveloper(w, r, currentUser)
+		if !ok {
+			return
+		}
+
+		// Defaults to the last 30 days; dates are YYYY-MM-DD and to is inclusive
+		var err error
+		to := time.Now()
+		from := to.AddDate(0, 0, -30)
+		if v := r.URL.Query().Get("from"); v != "" {
+			if from, err = time.Parse("2006-01-02", v); err != nil {
+				utils.WriteHTTPError(w, r, http.StatusBadRequest, "invalid from date")
+				return
+			}
+		}
+		if v := r.URL.Query().Get("to"); v != "" {
+			if to, err = time.Parse("2006-01-02", v); err != nil {
+				utils.WriteHTTPError(w, r, http.StatusBadRequest, "invalid to date")
+				return
+			}
+			to = to.AddDate(0, 0, 1)
+		}
+
+		report, err := m.RevenueReport(r.Context(), developerID, from, to)
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to build revenue report")
+			return
+		}
+
+		var gross, net float64
+		for _, item := range report {
+			gross += item.GrossRevenue
+			net += item.NetRevenue
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"items":         report,
+			"gross_revenue": gross,
+			"net_revenue":   net,
+			"platform_fee":  PlatformFee,
+		})
+	})
+
+	mux.HandleFunc("GET /developer/payouts", func(w http.ResponseWriter, r *http.Request) {
+		developerID, ok := m.currentDeveloper(w, r, currentUser)
+		if !ok {
+			return
+		}
+
+		balance, err := m.DeveloperBalance(r.Context(), developerID)
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to fetch balance")
+			return
+		}
+
+		payouts, err := m.ListPayouts(r.Context(), developerID)
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to fetch payouts")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"balance": balance,
+			"payouts": payouts,
+		})
+	})
+
+	mux.HandleFunc("POST /developer/payouts", func(w http.ResponseWriter, r *http.Request) {
+		developerID, ok := m.currentDeveloper(w, r, currentUser)
+		if !ok {
+			return
+		}
+
+		payout, err := m.RequestPayout(r.Context(), developerID)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.WriteHTTPError(w, r, http.StatusNotFound, "developer not found")
+			return
+		case errors.Is(err, ErrBelowMinimumPayout), errors.Is(err, ErrNoPayoutMethod):
+			utils.WriteHTTPError(w, r, http.StatusUnprocessableEntity, err.Error())
+			return
+		case err != nil:
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to request payout")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(payout)
+	})
+}
+
+// RegisterPayoutAdminRoutes mounts the endpoints admins use to review payout
+// requests on mux. currentAdmin resolves the authenticated admin and fails for
+// anyone else.
+func (m *Marketplace) RegisterPayoutAdminRoutes(mux *http.ServeMux, currentAdmin func(r *http.Request) (uuid.UUID, error)) {
+	mux.HandleFunc("GET /admin/payouts", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := currentAdmin(r); err != nil {
+			utils.WriteHTTPError(w, r, http.StatusForbidden, "admin access required")
+			return
+		}
+
+		payouts, err := m.ListPendingPayouts(r.Context())
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to fetch payouts")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"payouts": payouts,
+		})
+	})
+
+	process := func(action func(ctx context.Context, payoutID uuid.UUID) error) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if _, err := currentAdmin(r); err != nil {
+				utils.WriteHTTPError(w, r, http.StatusForbidden, "admin access required")
+				return
+			}
+
+			payoutID, err := uuid.Parse(r.PathValue("payoutID"))
+			if err != nil {
+				utils.WriteHTTPError(w, r, http.StatusBadRequest, "invalid payout ID")
+				return
+			}
+
+			err = action(r.Context(), payoutID)
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				utils.WriteHTTPError(w, r, http.StatusNotFound, "payout request not found")
+				return
+			case errors.Is(err, ErrPayoutNotPending):
+				utils.WriteHTTPError(w, r, http.StatusConflict, err.Error())
+				return
+			case err != nil:
+				utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to process payout")
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+
+	mux.HandleFunc("POST /admin/payouts/{payoutID}/approve", process(m.ApprovePayout))
+	mux.HandleFunc("POST /admin/payouts/{payoutID}/reject", process(m.RejectPayout))
+}
@@ -0,0 +1,261 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// createTestDeveloper stores a developer with the payout details, linked to
+// a fresh user ID, and removes them with their payout requests when the test
+// ends
+func createTestDeveloper(t *testing.T, db *gorm.DB, payout PayoutInfo) *Developer {
+	t.Helper()
+
+	name := uniqueName("dev")
+	userID := uuid.New()
+	developer := &Developer{UserID: &userID, Username: name, Email: name + "@example.com", PayoutInfo: payout}
+	if err := db.Create(developer).Error; err != nil {
+		t.Fatalf("failed to create developer: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Where("developer_id = ?", developer.ID).Delete(&PayoutRequest{})
+		db.Delete(developer)
+	})
+	return developer
+}
+
+func recordPurchase(t *testing.T, db *gorm.DB, itemID uuid.UUID, amount float64, status PurchaseStatus, at time.Time) *Purchase {
+	t.Helper()
+
+	purchase := &Purchase{ItemID: itemID, UserID: uuid.New(), Amount: amount, Status: status, CreatedAt: at}
+	if err := db.Create(purchase).Error; err != nil {
+		t.Fatalf("failed to record purchase: %v", err)
+	}
+	return purchase
+}
+
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestRevenueReportAggregatesPerItem(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	developer := createTestDeveloper(t, db, PayoutInfo{})
+	alpha := createTestItem(t, db, &MarketplaceItem{Name: uniqueName("Alpha"), AuthorID: developer.ID, Price: 10})
+	beta := createTestItem(t, db, &MarketplaceItem{Name: uniqueName("Beta"), AuthorID: developer.ID, Price: 4})
+	unsold := createTestItem(t, db, &MarketplaceItem{Name: uniqueName("Gamma"), AuthorID: developer.ID})
+	someoneElses := createTestItem(t, db, &MarketplaceItem{AuthorID: uuid.New()})
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	during := from.Add(10 * 24 * time.Hour)
+
+	recordPurchase(t, db, alpha.ID, 10, PurchaseStatusCompleted, during)
+	recordPurchase(t, db, alpha.ID, 10, PurchaseStatusCompleted, during.Add(time.Hour))
+	recordPurchase(t, db, alpha.ID, 10, PurchaseStatusPending, during)  // not paid
+	recordPurchase(t, db, alpha.ID, 10, PurchaseStatusRefunded, during) // refunded
+	recordPurchase(t, db, alpha.ID, 10, PurchaseStatusCompleted, to)    // after the period
+	recordPurchase(t, db, beta.ID, 4, PurchaseStatusCompleted, from)    // the period includes from
+	recordPurchase(t, db, someoneElses.ID, 50, PurchaseStatusCompleted, during)
+
+	for _, download := range []Download{
+		{ItemID: alpha.ID, CreatedAt: during},
+		{ItemID: alpha.ID, CreatedAt: during},
+		{ItemID: unsold.ID, CreatedAt: during},
+		{ItemID: unsold.ID, CreatedAt: from.Add(-time.Second)},
+	} {
+		if err := db.Create(&download).Error; err != nil {
+			t.Fatalf("failed to record download: %v", err)
+		}
+	}
+
+	report, err := m.RevenueReport(context.Background(), developer.ID, from, to)
+	if err != nil {
+		t.Fatalf("RevenueReport: %v", err)
+	}
+	if len(report) != 3 {
+		t.Fatalf("report has %d items, want the developer's 3", len(report))
+	}
+
+	want := map[uuid.UUID]ItemRevenue{
+		alpha.ID:  {Sales: 2, GrossRevenue: 20, NetRevenue: 18, Downloads: 2},
+		beta.ID:   {Sales: 1, GrossRevenue: 4, NetRevenue: 3.6},
+		unsold.ID: {Downloads: 1},
+	}
+	for _, row := range report {
+		expected, ok := want[row.ItemID]
+		if !ok {
+			t.Errorf("report includes item %s (%s)", row.ItemID, row.Name)
+			continue
+		}
+		if row.Sales != expected.Sales || !closeTo(row.GrossRevenue, expected.GrossRevenue) ||
+			!closeTo(row.NetRevenue, expected.NetRevenue) || row.Downloads != expected.Downloads {
+			t.Errorf("%s: %d sales, %.2f gross, %.2f net, %d downloads, want %d, %.2f, %.2f, %d", row.Name,
+				row.Sales, row.GrossRevenue, row.NetRevenue, row.Downloads,
+				expected.Sales, expected.GrossRevenue, expected.NetRevenue, expected.Downloads)
+		}
+	}
+}
+
+func TestRequestPayoutMinimumGate(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	ctx := context.Background()
+
+	noMethod := createTestDeveloper(t, db, PayoutInfo{})
+	if _, err := m.RequestPayout(ctx, noMethod.ID); !errors.Is(err, ErrNoPayoutMethod) {
+		t.Errorf("payout without a method = %v, want ErrNoPayoutMethod", err)
+	}
+	if _, err := m.RequestPayout(ctx, uuid.New()); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("payout for an unknown developer = %v, want gorm.ErrRecordNotFound", err)
+	}
+
+	developer := createTestDeveloper(t, db, PayoutInfo{PayPalEmail: "dev@example.com", MinimumPayout: 50})
+	item := createTestItem(t, db, &MarketplaceItem{AuthorID: developer.ID, Price: 20})
+
+	// Two sales net 36, short of the 50 minimum
+	recordPurchase(t, db, item.ID, 20, PurchaseStatusCompleted, time.Now())
+	recordPurchase(t, db, item.ID, 20, PurchaseStatusCompleted, time.Now())
+	if _, err := m.RequestPayout(ctx, developer.ID); !errors.Is(err, ErrBelowMinimumPayout) {
+		t.Fatalf("payout of 36 with a minimum of 50 = %v, want ErrBelowMinimumPayout", err)
+	}
+
+	// A third brings the balance to 54
+	recordPurchase(t, db, item.ID, 20, PurchaseStatusCompleted, time.Now())
+	payout, err := m.RequestPayout(ctx, developer.ID)
+	if err != nil {
+		t.Fatalf("RequestPayout: %v", err)
+	}
+	if !closeTo(payout.Amount, 54) || payout.Status != PayoutStatusPending {
+		t.Errorf("payout = %+v, want 54 pending", payout)
+	}
+
+	// The pending request holds the balance, so another is refused
+	if balance, _ := m.DeveloperBalance(ctx, developer.ID); !closeTo(balance, 0) {
+		t.Errorf("balance with a pending payout = %.2f, want 0", balance)
+	}
+	if _, err := m.RequestPayout(ctx, developer.ID); !errors.Is(err, ErrBelowMinimumPayout) {
+		t.Errorf("second payout = %v, want ErrBelowMinimumPayout", err)
+	}
+
+	// Rejecting returns the amount to the balance; a processed request can't be processed again
+	if err := m.RejectPayout(ctx, payout.ID); err != nil {
+		t.Fatalf("RejectPayout: %v", err)
+	}
+	if err := m.ApprovePayout(ctx, payout.ID); !errors.Is(err, ErrPayoutNotPending) {
+		t.Errorf("approving a rejected payout = %v, want ErrPayoutNotPending", err)
+	}
+	if balance, _ := m.DeveloperBalance(ctx, developer.ID); !closeTo(balance, 54) {
+		t.Errorf("balance after rejection = %.2f, want 54", balance)
+	}
+}
+
+func TestRequestPayoutDefaultMinimum(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	developer := createTestDeveloper(t, db, PayoutInfo{BankAccount: "DE00 0000"})
+	item := createTestItem(t, db, &MarketplaceItem{AuthorID: developer.ID, Price: 25})
+
+	// 25 gross nets 22.50, under the default minimum of 25
+	recordPurchase(t, db, item.ID, 25, PurchaseStatusCompleted, time.Now())
+	if _, err := m.RequestPayout(context.Background(), developer.ID); !errors.Is(err, ErrBelowMinimumPayout) {
+		t.Errorf("payout of 22.50 = %v, want ErrBelowMinimumPayout", err)
+	}
+
+	recordPurchase(t, db, item.ID, 25, PurchaseStatusCompleted, time.Now())
+	if _, err := m.RequestPayout(context.Background(), developer.ID); err != nil {
+		t.Errorf("payout of 45 = %v, want it accepted", err)
+	}
+}
+
+func TestCompletePurchaseCreditsDeveloper(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	developer := createTestDeveloper(t, db, PayoutInfo{})
+	item := createTestItem(t, db, &MarketplaceItem{AuthorID: developer.ID, Price: 15})
+	purchase := recordPurchase(t, db, item.ID, 15, PurchaseStatusPending, time.Now())
+
+	completed, err := m.CompletePurchase(context.Background(), purchase.ID, "pay_123")
+	if err != nil {
+		t.Fatalf("CompletePurchase: %v", err)
+	}
+	if completed.Status != PurchaseStatusCompleted || completed.PaymentID != "pay_123" {
+		t.Errorf("purchase = %+v, want it completed with the payment ID", completed)
+	}
+	if _, err := m.CompletePurchase(context.Background(), purchase.ID, "pay_123"); !errors.Is(err, ErrPurchaseNotPending) {
+		t.Errorf("completing twice = %v, want ErrPurchaseNotPending", err)
+	}
+
+	var stored Developer
+	db.First(&stored, "id = ?", developer.ID)
+	if !closeTo(stored.TotalRevenue, 13.5) {
+		t.Errorf("total revenue = %.2f, want 13.50 credited once", stored.TotalRevenue)
+	}
+}
+
+func TestNetRevenue(t *testing.T) {
+	previous := PlatformFee
+	t.Cleanup(func() { PlatformFee = previous })
+
+	for _, tt := range []struct{ fee, gross, want float64 }{
+		{0.10, 100, 90},
+		{0.10, 0, 0},
+		{0.25, 40, 30},
+		{0, 12.5, 12.5},
+	} {
+		PlatformFee = tt.fee
+		if got := netRevenue(tt.gross); !closeTo(got, tt.want) {
+			t.Errorf("netRevenue(%.2f) with a %.0f%% fee = %.4f, want %.2f", tt.gross, tt.fee*100, got, tt.want)
+		}
+	}
+}
+
+func TestPayoutRoutesResolveDeveloperFromUser(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+
+	developer := createTestDeveloper(t, db, PayoutInfo{PayPalEmail: "dev@example.com"})
+	item := createTestItem(t, db, &MarketplaceItem{AuthorID: developer.ID, Price: 30})
+	recordPurchase(t, db, item.ID, 30, PurchaseStatusCompleted, time.Now())
+
+	mux := http.NewServeMux()
+	m.RegisterPayoutRoutes(mux, func(r *http.Request) (uuid.UUID, error) {
+		return uuid.Parse(r.Header.Get("X-User-ID"))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	var balance struct {
+		Balance float64 `json:"balance"`
+	}
+	if status := sendAs(t, server, uuid.New(), http.MethodGet, "/developer/payouts", nil); status != http.StatusForbidden {
+		t.Errorf("user without a developer profile: status %d, want 403", status)
+	}
+	if status := sendAs(t, server, developer.ID, http.MethodGet, "/developer/payouts", nil); status != http.StatusForbidden {
+		t.Errorf("developer ID as the user: status %d, want 403", status)
+	}
+	if status := sendAs(t, server, *developer.UserID, http.MethodGet, "/developer/payouts", &balance); status != http.StatusOK {
+		t.Fatalf("developer's user: status %d, want 200", status)
+	}
+	if !closeTo(balance.Balance, 27) {
+		t.Errorf("balance = %.2f, want the developer's 27", balance.Balance)
+	}
+
+	if status := sendAs(t, server, *developer.UserID, http.MethodPost, "/developer/payouts", nil); status != http.StatusCreated {
+		t.Fatalf("payout request: status %d, want 201", status)
+	}
+	var count int64
+	db.Model(&PayoutRequest{}).Where("developer_id = ?", developer.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("%d payout requests under the developer, want 1", count)
+	}
+}
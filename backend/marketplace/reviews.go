@@ -0,0 +1,326 @@
+package marketplace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrNotVerifiedDownloader is returned when a user reviews an item they never downloaded
+	ErrNotVerifiedDownloader = errors.New("only users who downloaded the item can review it")
+	// ErrAlreadyReviewed is returned when a user submits a second review for an item
+	ErrAlreadyReviewed = errors.New("item already reviewed by this user")
+)
+
+type ReviewStatus string
+
+const (
+	ReviewStatusPending  ReviewStatus = "pending"
+	ReviewStatusApproved ReviewStatus = "approved"
+	ReviewStatusFlagged  ReviewStatus = "flagged"
+	ReviewStatusRejected ReviewStatus = "rejected"
+)
+
+// defaultBannedWords hold a review back for manual moderation
+var defaultBannedWords = []string{"scam", "malware", "virus", "crack", "cracked", "nulled", "http", "https", "www"}
+
+// ReviewVote records a user's helpfulness vote so each user votes once per review
+type ReviewVote struct {
+	ReviewID uuid.UUID `json:"review_id" gorm:"type:uuid;primaryKey"`
+	UserID   uuid.UUID `json:"user_id" gorm:"type:uuid;primaryKey"`
+	Helpful  bool      `json:"helpful"`
+}
+
+type ReviewRequest struct {
+	ItemID     uuid.UUID `json:"item_id"`
+	UserID     uuid.UUID `json:"user_id"`
+	Username   string    `json:"username"`
+	Rating     int       `json:"rating"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	Pros       []string  `json:"pros"`
+	Cons       []string  `json:"cons"`
+	Version    string    `json:"version"`
+	ServerType string    `json:"server_type"`
+}
+
+// SubmitReview stores a review from a user who downloaded the item and
+// queues it for moderation. The review stays hidden until approved.
+func (m *Marketplace) SubmitReview(ctx context.Context, request ReviewRequest) (*Review, error) {
+	if request.Rating < 1 || request.Rating > 5 {
+		return nil, fmt.Errorf("rating must be between 1 and 5")
+	}
+	if strings.TrimSpace(request.Content) == "" {
+		return nil, fmt.Errorf("content is required")
+	}
+
+	db := m.db.WithContext(ctx)
+
+	var downloads int64
+	if err := db.Model(&Download{}).
+		Where("item_id = ? AND user_id = ?", request.ItemID, request.UserID).
+		Count(&downloads).Error; err != nil {
+		return nil, err
+	}
+	if downloads == 0 {
+		return nil, ErrNotVerifiedDownloader
+	}
+
+	var existing int64
+	if err := db.Model(&Review{}).
+		Where("item_id = ? AND user_id = ?", request.ItemID, request.UserID).
+		Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, ErrAlreadyReviewed
+	}
+
+	review := &Review{
+		ItemID:     request.ItemID,
+		UserID:     request.UserID,
+		Username:   request.Username,
+		Rating:     request.Rating,
+		Title:      request.Title,
+		Content:    request.Content,
+		Pros:       request.Pros,
+		Cons:       request.Cons,
+		Version:    request.Version,
+		ServerType: request.ServerType,
+		IsVerified: true,
+		Status:     ReviewStatusPending,
+	}
+
+	if err := db.Create(review).Error; err != nil {
+		return nil, fmt.Errorf("failed to save review: %w", err)
+	}
+
+	select {
+	case m.reviewSystem.moderationQueue <- *review:
+	default:
+		// Queue is full; the review stays pending until moderated manually
+		log.Printf("Review moderation queue full, review %s left pending", review.ID)
+	}
+
+	return review, nil
+}
+
+// ApproveReview publishes a review, typically one flagged for manual review
+func (m *Marketplace) ApproveReview(ctx context.Context, reviewID uuid.UUID) error {
+	return m.reviewSystem.setStatus(ctx, reviewID, ReviewStatusApproved)
+}
+
+// RejectReview hides a review permanently
+func (m *Marketplace) RejectReview(ctx context.Context, reviewID uuid.UUID) error {
+	return m.reviewSystem.setStatus(ctx, reviewID, ReviewStatusRejected)
+}
+
+// ListReviews returns approved reviews for an item, most helpful first
+func (m *Marketplace) ListReviews(ctx context.Context, itemID uuid.UUID, page, limit int) ([]Review, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	db := m.db.WithContext(ctx).Model(&Review{}).
+		Where("item_id = ? AND status = ?", itemID, ReviewStatusApproved).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var reviews []Review
+	err := db.Order("helpful_votes DESC, created_at DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&reviews).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return reviews, total, nil
+}
+
+// VoteReview records whether a user found a review helpful. Voting again
+// replaces the user's previous vote.
+func (m *Marketplace) VoteReview(ctx context.Context, reviewID, userID uuid.UUID, helpful bool) (*Review, error) {
+	var review Review
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND status = ?", reviewID, ReviewStatusApproved).First(&review).Error; err != nil {
+			return err
+		}
+
+		vote := ReviewVote{ReviewID: reviewID, UserID: userID, Helpful: helpful}
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&vote).Error; err != nil {
+			return err
+		}
+
+		var helpfulVotes, totalVotes int64
+		if err := tx.Model(&ReviewVote{}).Where("review_id = ?", reviewID).Count(&totalVotes).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&ReviewVote{}).Where("review_id = ? AND helpful = ?", reviewID, true).Count(&helpfulVotes).Error; err != nil {
+			return err
+		}
+
+		review.HelpfulVotes = int(helpfulVotes)
+		review.TotalVotes = int(totalVotes)
+		return tx.Model(&review).Updates(map[string]interface{}{
+			"helpful_votes": review.HelpfulVotes,
+			"total_votes":   review.TotalVotes,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+// RegisterReviewRoutes mounts the review endpoints on mux. currentUser
+// resolves the authenticated user for voting.
+func (m *Marketplace) RegisterReviewRoutes(mux *http.ServeMux, currentUser func(r *http.Request) (uuid.UUID, error)) {
+	mux.HandleFunc("GET /items/{itemID}/reviews", func(w http.ResponseWriter, r *http.Request) {
+		itemID, err := uuid.Parse(r.PathValue("itemID"))
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusBadRequest, "invalid item ID")
+			return
+		}
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+		reviews, total, err := m.ListReviews(r.Context(), itemID, page, limit)
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to fetch reviews")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"reviews": reviews,
+			"total":   total,
+		})
+	})
+
+	mux.HandleFunc("POST /reviews/{reviewID}/vote", func(w http.ResponseWriter, r *http.Request) {
+		userID, err := currentUser(r)
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		reviewID, err := uuid.Parse(r.PathValue("reviewID"))
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusBadRequest, "invalid review ID")
+			return
+		}
+
+		var body struct {
+			Helpful bool `json:"helpful"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			utils.WriteHTTPError(w, r, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		review, err := m.VoteReview(r.Context(), reviewID, userID, body.Helpful)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.WriteHTTPError(w, r, http.StatusNotFound, "review not found")
+			return
+		}
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to record vote")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(review)
+	})
+}
+
+// Review System Implementation
+func (rs *ReviewSystem) startModeration() {
+	for review := range rs.moderationQueue {
+		status := ReviewStatusApproved
+		if rs.containsBannedWord(review) {
+			status = ReviewStatusFlagged
+		}
+
+		if err := rs.setStatus(context.Background(), review.ID, status); err != nil {
+			log.Printf("Failed to moderate review %s: %v", review.ID, err)
+		}
+	}
+}
+
+func (rs *ReviewSystem) containsBannedWord(review Review) bool {
+	parts := []string{review.Title, review.Content}
+	parts = append(parts, review.Pros...)
+	parts = append(parts, review.Cons...)
+
+	text := strings.ToLower(strings.Join(parts, " "))
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+
+	for _, word := range words {
+		for _, banned := range rs.bannedWords {
+			if word == banned {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setStatus moves a review to status and refreshes the item's rating, since
+// only approved reviews count towards it
+func (rs *ReviewSystem) setStatus(ctx context.Context, reviewID uuid.UUID, status ReviewStatus) error {
+	return rs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var review Review
+		if err := tx.First(&review, "id = ?", reviewID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&review).Update("status", status).Error; err != nil {
+			return err
+		}
+
+		return recomputeRating(tx, review.ItemID)
+	})
+}
+
+// recomputeRating sets an item's OverallRating and RatingCount from its approved reviews
+func recomputeRating(tx *gorm.DB, itemID uuid.UUID) error {
+	var stats struct {
+		Average float64
+		Count   int
+	}
+	if err := tx.Model(&Review{}).
+		Select("COALESCE(AVG(rating), 0) AS average, COUNT(*) AS count").
+		Where("item_id = ? AND status = ?", itemID, ReviewStatusApproved).
+		Scan(&stats).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&MarketplaceItem{}).Where("id = ?", itemID).Updates(map[string]interface{}{
+		"overall_rating": stats.Average,
+		"rating_count":   stats.Count,
+	}).Error
+}
@@ -0,0 +1,205 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// newReviewMarketplace builds a marketplace whose moderation worker runs
+// until the test ends
+func newReviewMarketplace(t *testing.T, db *gorm.DB) *Marketplace {
+	t.Helper()
+
+	rs := &ReviewSystem{
+		db:              db,
+		moderationQueue: make(chan Review, 10),
+		bannedWords:     defaultBannedWords,
+	}
+	go rs.startModeration()
+	t.Cleanup(func() { close(rs.moderationQueue) })
+
+	return &Marketplace{db: db, reviewSystem: rs}
+}
+
+func recordDownload(t *testing.T, db *gorm.DB, itemID, userID uuid.UUID) {
+	t.Helper()
+	if err := db.Create(&Download{ItemID: itemID, UserID: &userID}).Error; err != nil {
+		t.Fatalf("failed to record download: %v", err)
+	}
+}
+
+// waitForStatus polls until the moderation worker has moved the review on
+// from pending
+func waitForStatus(t *testing.T, db *gorm.DB, reviewID uuid.UUID) ReviewStatus {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var review Review
+		if err := db.First(&review, "id = ?", reviewID).Error; err != nil {
+			t.Fatalf("failed to load review: %v", err)
+		}
+		if review.Status != ReviewStatusPending || time.Now().After(deadline) {
+			return review.Status
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSubmitReviewRequiresDownload(t *testing.T) {
+	db := testDB(t)
+	m := newReviewMarketplace(t, db)
+	item := createTestItem(t, db, &MarketplaceItem{})
+	userID := uuid.New()
+
+	request := ReviewRequest{ItemID: item.ID, UserID: userID, Rating: 5, Content: "Works great"}
+	if _, err := m.SubmitReview(context.Background(), request); !errors.Is(err, ErrNotVerifiedDownloader) {
+		t.Fatalf("review without a download: err = %v, want ErrNotVerifiedDownloader", err)
+	}
+
+	// A download by someone else doesn't count
+	recordDownload(t, db, item.ID, uuid.New())
+	if _, err := m.SubmitReview(context.Background(), request); !errors.Is(err, ErrNotVerifiedDownloader) {
+		t.Fatalf("review after another user's download: err = %v, want ErrNotVerifiedDownloader", err)
+	}
+
+	recordDownload(t, db, item.ID, userID)
+	review, err := m.SubmitReview(context.Background(), request)
+	if err != nil {
+		t.Fatalf("SubmitReview: %v", err)
+	}
+	if !review.IsVerified || review.Status != ReviewStatusPending {
+		t.Errorf("review = %+v, want a verified pending review", review)
+	}
+
+	if _, err := m.SubmitReview(context.Background(), request); !errors.Is(err, ErrAlreadyReviewed) {
+		t.Errorf("second review: err = %v, want ErrAlreadyReviewed", err)
+	}
+}
+
+func TestSubmitReviewValidation(t *testing.T) {
+	m := &Marketplace{}
+	for _, request := range []ReviewRequest{
+		{Rating: 0, Content: "ok"},
+		{Rating: 6, Content: "ok"},
+		{Rating: 3, Content: "   "},
+	} {
+		if _, err := m.SubmitReview(context.Background(), request); err == nil {
+			t.Errorf("SubmitReview(%+v) succeeded", request)
+		}
+	}
+}
+
+func TestModerationRecomputesRating(t *testing.T) {
+	db := testDB(t)
+	m := newReviewMarketplace(t, db)
+	item := createTestItem(t, db, &MarketplaceItem{})
+
+	submit := func(rating int, content string) *Review {
+		t.Helper()
+		userID := uuid.New()
+		recordDownload(t, db, item.ID, userID)
+		review, err := m.SubmitReview(context.Background(), ReviewRequest{
+			ItemID: item.ID, UserID: userID, Rating: rating, Content: content,
+		})
+		if err != nil {
+			t.Fatalf("SubmitReview: %v", err)
+		}
+		return review
+	}
+	rating := func() (float64, int) {
+		t.Helper()
+		var current MarketplaceItem
+		if err := db.First(&current, "id = ?", item.ID).Error; err != nil {
+			t.Fatalf("failed to load item: %v", err)
+		}
+		return current.OverallRating, current.RatingCount
+	}
+
+	five := submit(5, "Great plugin")
+	four := submit(4, "Does the job")
+	flagged := submit(1, "This is malware, avoid")
+
+	if got := waitForStatus(t, db, five.ID); got != ReviewStatusApproved {
+		t.Errorf("clean review status = %s, want approved", got)
+	}
+	waitForStatus(t, db, four.ID)
+	if got := waitForStatus(t, db, flagged.ID); got != ReviewStatusFlagged {
+		t.Errorf("review with a banned word status = %s, want flagged", got)
+	}
+
+	// Flagged reviews don't count towards the rating
+	if avg, count := rating(); count != 2 || math.Abs(avg-4.5) > 1e-9 {
+		t.Errorf("rating = %v from %d reviews, want 4.5 from 2", avg, count)
+	}
+
+	if err := m.ApproveReview(context.Background(), flagged.ID); err != nil {
+		t.Fatalf("ApproveReview: %v", err)
+	}
+	if avg, count := rating(); count != 3 || math.Abs(avg-10.0/3) > 1e-9 {
+		t.Errorf("rating after approval = %v from %d reviews, want 3.33 from 3", avg, count)
+	}
+
+	if err := m.RejectReview(context.Background(), five.ID); err != nil {
+		t.Fatalf("RejectReview: %v", err)
+	}
+	if avg, count := rating(); count != 2 || math.Abs(avg-2.5) > 1e-9 {
+		t.Errorf("rating after rejection = %v from %d reviews, want 2.5 from 2", avg, count)
+	}
+}
+
+func TestVoteReviewReplacesPreviousVote(t *testing.T) {
+	db := testDB(t)
+	m := newReviewMarketplace(t, db)
+	item := createTestItem(t, db, &MarketplaceItem{})
+
+	userID := uuid.New()
+	recordDownload(t, db, item.ID, userID)
+	review, err := m.SubmitReview(context.Background(), ReviewRequest{ItemID: item.ID, UserID: userID, Rating: 4, Content: "Solid"})
+	if err != nil {
+		t.Fatalf("SubmitReview: %v", err)
+	}
+	waitForStatus(t, db, review.ID)
+
+	voter := uuid.New()
+	if _, err := m.VoteReview(context.Background(), review.ID, voter, true); err != nil {
+		t.Fatalf("VoteReview: %v", err)
+	}
+	voted, err := m.VoteReview(context.Background(), review.ID, voter, false)
+	if err != nil {
+		t.Fatalf("VoteReview: %v", err)
+	}
+	if voted.HelpfulVotes != 0 || voted.TotalVotes != 1 {
+		t.Errorf("votes = %d/%d, want the second vote to replace the first (0/1)", voted.HelpfulVotes, voted.TotalVotes)
+	}
+
+	if _, err := m.VoteReview(context.Background(), uuid.New(), voter, true); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("vote on a missing review: err = %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestContainsBannedWord(t *testing.T) {
+	rs := &ReviewSystem{bannedWords: defaultBannedWords}
+	tests := []struct {
+		review Review
+		want   bool
+	}{
+		{Review{Content: "Great plugin"}, false},
+		{Review{Content: "Download the CRACKED version"}, true},
+		{Review{Content: "see https://example.com"}, true},
+		{Review{Content: "fine", Cons: []string{"is a scam"}}, true},
+		// Whole words only
+		{Review{Content: "scampi recipes"}, false},
+	}
+	for _, tt := range tests {
+		if got := rs.containsBannedWord(tt.review); got != tt.want {
+			t.Errorf("containsBannedWord(%q, %q) = %v, want %v", tt.review.Content, tt.review.Cons, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package marketplace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RolloutInstalled = "installed"
+	RolloutFailed    = "failed"
+	RolloutSkipped   = "skipped"
+)
+
+// ErrRolloutNoServers is returned for a rollout without servers
+var ErrRolloutNoServers = errors.New("no servers selected for rollout")
+
+// ServerController stops and starts servers around an install; the panel's
+// server manager provides it
+type ServerController interface {
+	StopServer(ctx context.Context, serverID uuid.UUID) error
+	StartServer(ctx context.Context, serverID uuid.UUID) error
+}
+
+// RolloutRequest installs or updates an item on many servers. Servers are
+// done BatchSize at a time, each stopped, installed to and started again,
+// so only one batch is down at once. With PauseOnError a failed batch
+// halts the rollout and the servers after it are skipped.
+type RolloutRequest struct {
+	ItemID           uuid.UUID   `json:"item_id"`
+	UserID           uuid.UUID   `json:"user_id"`
+	Version          string      `json:"version"`
+	MinecraftVersion string      `json:"minecraft_version"`
+	ServerType       string      `json:"server_type"`
+	ServerIDs        []uuid.UUID `json:"server_ids"`
+	BatchSize        int         `json:"batch_size"`
+	PauseOnError     bool        `json:"pause_on_error"`
+
+	// Set from the HTTP request for download analytics
+	IPAddress string `json:"-"`
+	UserAgent string `json:"-"`
+}
+
+// RolloutServerResult is the outcome of a rollout on one server
+type RolloutServerResult struct {
+	ServerID uuid.UUID      `json:"server_id"`
+	Status   string         `json:"status"`
+	Error    string         `json:"error,omitempty"`
+	Install  *InstallResult `json:"install,omitempty"`
+}
+
+// RolloutResult reports a rollout server by server, in rollout order
+type RolloutResult struct {
+	ItemID    uuid.UUID             `json:"item_id"`
+	Servers   []RolloutServerResult `json:"servers"`
+	Installed int                   `json:"installed"`
+	Failed    int                   `json:"failed"`
+	Skipped   int                   `json:"skipped"`
+	// Halted is set when PauseOnError stopped the rollout early
+	Halted bool `json:"halted"`
+}
+
+// rolloutBatches splits servers into batches of size, the last one possibly
+// smaller. A size under 1 means one server at a time.
+func rolloutBatches(servers []uuid.UUID, size int) [][]uuid.UUID {
+	if size < 1 {
+		size = 1
+	}
+
+	var batches [][]uuid.UUID
+	for start := 0; start < len(servers); start += size {
+		end := start + size
+		if end > len(servers) {
+			end = len(servers)
+		}
+		batches = append(batches, servers[start:end])
+	}
+	return batches
+}
+
+// RolloutItem installs an item on the requested servers batch by batch
+func (m *Marketplace) RolloutItem(ctx context.Context, controller ServerController, request RolloutRequest) (*RolloutResult, error) {
+	if len(request.ServerIDs) == 0 {
+		return nil, ErrRolloutNoServers
+	}
+	if _, err := m.GetItem(ctx, request.ItemID); err != nil {
+		return nil, fmt.Errorf("item not found: %w", err)
+	}
+
+	result := &RolloutResult{ItemID: request.ItemID}
+	for _, batch := range rolloutBatches(request.ServerIDs, request.BatchSize) {
+		if result.Halted || ctx.Err() != nil {
+			for _, serverID := range batch {
+				result.Servers = append(result.Servers, RolloutServerResult{ServerID: serverID, Status: RolloutSkipped})
+				result.Skipped++
+			}
+			continue
+		}
+
+		outcomes := make([]RolloutServerResult, len(batch))
+		var wg sync.WaitGroup
+		for i, serverID := range batch {
+			wg.Add(1)
+			go func(i int, serverID uuid.UUID) {
+				defer wg.Done()
+				outcomes[i] = m.rolloutServer(ctx, controller, request, serverID)
+			}(i, serverID)
+		}
+		wg.Wait()
+
+		for _, outcome := range outcomes {
+			result.Servers = append(result.Servers, outcome)
+			if outcome.Status == RolloutInstalled {
+				result.Installed++
+			} else {
+				result.Failed++
+				if request.PauseOnError {
+					result.Halted = true
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// rolloutServer stops a server, installs the item and starts it again. The
+// server is started even if the install fails so a failure doesn't leave it
+// down.
+func (m *Marketplace) rolloutServer(ctx context.Context, controller ServerController, request RolloutRequest, serverID uuid.UUID) RolloutServerResult {
+	outcome := RolloutServerResult{ServerID: serverID, Status: RolloutFailed}
+
+	if err := controller.StopServer(ctx, serverID); err != nil {
+		outcome.Error = fmt.Sprintf("stop failed: %v", err)
+		return outcome
+	}
+
+	install, installErr := m.InstallItem(ctx, InstallRequest{
+		ItemID:           request.ItemID,
+		UserID:           request.UserID,
+		ServerID:         serverID,
+		Version:          request.Version,
+		MinecraftVersion: request.MinecraftVersion,
+		ServerType:       request.ServerType,
+		IPAddress:        request.IPAddress,
+		UserAgent:        request.UserAgent,
+	})
+
+	startErr := controller.StartServer(ctx, serverID)
+	switch {
+	case installErr != nil:
+		outcome.Error = installErr.Error()
+	case startErr != nil:
+		outcome.Install = install
+		outcome.Error = fmt.Sprintf("installed but start failed: %v", startErr)
+	default:
+		outcome.Install = install
+		outcome.Status = RolloutInstalled
+	}
+	return outcome
+}
+
+// RegisterRolloutRoutes mounts the rollout endpoint on mux. It is for
+// admins only; currentAdmin resolves the authenticated admin and fails for
+// anyone else.
+func (m *Marketplace) RegisterRolloutRoutes(mux *http.ServeMux, controller ServerController, currentAdmin func(r *http.Request) (uuid.UUID, error)) {
+	mux.HandleFunc("POST /items/{itemID}/rollout", func(w http.ResponseWriter, r *http.Request) {
+		userID, err := currentAdmin(r)
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusForbidden, "admin access required")
+			return
+		}
+
+		itemID, err := uuid.Parse(r.PathValue("itemID"))
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusBadRequest, "invalid item ID")
+			return
+		}
+
+		var request RolloutRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			utils.WriteHTTPError(w, r, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		request.ItemID = itemID
+		request.UserID = userID
+		request.IPAddress, _, _ = net.SplitHostPort(r.RemoteAddr)
+		request.UserAgent = r.UserAgent()
+
+		result, err := m.RolloutItem(r.Context(), controller, request)
+		if errors.Is(err, ErrRolloutNoServers) {
+			utils.WriteHTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusNotFound, "item not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+}
@@ -0,0 +1,229 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeController records the servers it stops and starts, and how many were
+// down at once
+type fakeController struct {
+	mutex    sync.Mutex
+	failStop map[uuid.UUID]bool
+	down     map[uuid.UUID]bool
+	stopped  []uuid.UUID
+	started  []uuid.UUID
+	maxDown  int
+}
+
+func newFakeController(failStop ...uuid.UUID) *fakeController {
+	c := &fakeController{failStop: make(map[uuid.UUID]bool), down: make(map[uuid.UUID]bool)}
+	for _, serverID := range failStop {
+		c.failStop[serverID] = true
+	}
+	return c
+}
+
+func (c *fakeController) StopServer(ctx context.Context, serverID uuid.UUID) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.stopped = append(c.stopped, serverID)
+	if c.failStop[serverID] {
+		return errors.New("server did not stop")
+	}
+	c.down[serverID] = true
+	if len(c.down) > c.maxDown {
+		c.maxDown = len(c.down)
+	}
+	return nil
+}
+
+func (c *fakeController) StartServer(ctx context.Context, serverID uuid.UUID) error {
+	// Give the rest of the batch time to stop, so overlapping batches
+	// would show in maxDown
+	time.Sleep(10 * time.Millisecond)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.started = append(c.started, serverID)
+	delete(c.down, serverID)
+	return nil
+}
+
+func newServerIDs(count int) []uuid.UUID {
+	ids := make([]uuid.UUID, count)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+	return ids
+}
+
+func TestRolloutBatches(t *testing.T) {
+	servers := newServerIDs(7)
+
+	tests := []struct {
+		name string
+		size int
+		want []int
+	}{
+		{"even batches with a smaller last one", 3, []int{3, 3, 1}},
+		{"one server at a time", 1, []int{1, 1, 1, 1, 1, 1, 1}},
+		{"no size given", 0, []int{1, 1, 1, 1, 1, 1, 1}},
+		{"negative size", -2, []int{1, 1, 1, 1, 1, 1, 1}},
+		{"batch larger than the fleet", 10, []int{7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batches := rolloutBatches(servers, tt.size)
+			if len(batches) != len(tt.want) {
+				t.Fatalf("%d batches, want %d", len(batches), len(tt.want))
+			}
+			next := 0
+			for i, batch := range batches {
+				if len(batch) != tt.want[i] {
+					t.Errorf("batch %d has %d servers, want %d", i+1, len(batch), tt.want[i])
+				}
+				for _, serverID := range batch {
+					if serverID != servers[next] {
+						t.Fatalf("batch %d is out of order", i+1)
+					}
+					next++
+				}
+			}
+		})
+	}
+
+	if batches := rolloutBatches(nil, 3); len(batches) != 0 {
+		t.Errorf("rollout without servers has %d batches", len(batches))
+	}
+}
+
+func TestRolloutItemInBatches(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	item := createTestItem(t, db, &MarketplaceItem{})
+	servers := newServerIDs(5)
+	controller := newFakeController()
+
+	result, err := m.RolloutItem(context.Background(), controller, RolloutRequest{
+		ItemID:    item.ID,
+		UserID:    uuid.New(),
+		ServerIDs: servers,
+		BatchSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("RolloutItem: %v", err)
+	}
+	if result.Installed != 5 || result.Failed != 0 || result.Skipped != 0 || result.Halted {
+		t.Fatalf("result = %+v, want all 5 installed", result)
+	}
+	for i, server := range result.Servers {
+		if server.ServerID != servers[i] || server.Status != RolloutInstalled || server.Install == nil {
+			t.Errorf("server %d = %+v, want it installed in rollout order", i+1, server)
+		}
+	}
+
+	if controller.maxDown != 2 {
+		t.Errorf("%d servers were down at once, want the batch size of 2", controller.maxDown)
+	}
+	if len(controller.started) != 5 || len(controller.down) != 0 {
+		t.Errorf("%d servers started again and %d left down", len(controller.started), len(controller.down))
+	}
+}
+
+func TestRolloutItemHaltsOnError(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	item := createTestItem(t, db, &MarketplaceItem{})
+	servers := newServerIDs(5)
+
+	controller := newFakeController(servers[1])
+	result, err := m.RolloutItem(context.Background(), controller, RolloutRequest{
+		ItemID:       item.ID,
+		UserID:       uuid.New(),
+		ServerIDs:    servers,
+		BatchSize:    2,
+		PauseOnError: true,
+	})
+	if err != nil {
+		t.Fatalf("RolloutItem: %v", err)
+	}
+	if !result.Halted || result.Installed != 1 || result.Failed != 1 || result.Skipped != 3 {
+		t.Fatalf("result = %+v, want the first batch done and the rest skipped", result)
+	}
+	if failed := result.Servers[1]; failed.Status != RolloutFailed || failed.Error == "" {
+		t.Errorf("failed server = %+v, want its error reported", failed)
+	}
+	for _, skipped := range result.Servers[2:] {
+		if skipped.Status != RolloutSkipped {
+			t.Errorf("server after the failed batch = %+v, want skipped", skipped)
+		}
+	}
+	if len(controller.stopped) != 2 {
+		t.Errorf("%d servers were stopped, want only the first batch", len(controller.stopped))
+	}
+
+	// Without PauseOnError the rollout carries on past the failure
+	controller = newFakeController(servers[1])
+	result, err = m.RolloutItem(context.Background(), controller, RolloutRequest{
+		ItemID:    item.ID,
+		UserID:    uuid.New(),
+		ServerIDs: servers,
+		BatchSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("RolloutItem: %v", err)
+	}
+	if result.Halted || result.Installed != 4 || result.Failed != 1 || result.Skipped != 0 {
+		t.Errorf("result = %+v, want 4 installed and 1 failed", result)
+	}
+}
+
+func TestRolloutItemRestartsServerAfterFailedInstall(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+	item := createTestItem(t, db, &MarketplaceItem{ServerTypes: []string{"paper"}})
+	servers := newServerIDs(2)
+	controller := newFakeController()
+
+	result, err := m.RolloutItem(context.Background(), controller, RolloutRequest{
+		ItemID:     item.ID,
+		UserID:     uuid.New(),
+		ServerType: "bedrock",
+		ServerIDs:  servers,
+		BatchSize:  2,
+	})
+	if err != nil {
+		t.Fatalf("RolloutItem: %v", err)
+	}
+	if result.Failed != 2 || result.Servers[0].Install != nil {
+		t.Fatalf("result = %+v, want both installs to fail", result)
+	}
+	if len(controller.started) != 2 || len(controller.down) != 0 {
+		t.Errorf("%d servers started again after the failed install, want 2", len(controller.started))
+	}
+}
+
+func TestRolloutItemValidatesRequest(t *testing.T) {
+	db := testDB(t)
+	m := &Marketplace{db: db}
+
+	if _, err := m.RolloutItem(context.Background(), newFakeController(), RolloutRequest{ItemID: uuid.New()}); !errors.Is(err, ErrRolloutNoServers) {
+		t.Errorf("rollout without servers = %v, want ErrRolloutNoServers", err)
+	}
+
+	controller := newFakeController()
+	if _, err := m.RolloutItem(context.Background(), controller, RolloutRequest{ItemID: uuid.New(), ServerIDs: newServerIDs(1)}); err == nil {
+		t.Error("rollout of a missing item succeeded")
+	}
+	if len(controller.stopped) != 0 {
+		t.Error("servers were stopped for a missing item")
+	}
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	corsAllowMethods = "GET,POST,PUT,DELETE,PATCH,OPTIONS"
+	corsAllowHeaders = "Origin,Content-Type,Accept,Authorization,X-API-Key,X-Request-ID,X-Requested-With"
+	corsMaxAge       = 300
+)
+
+// OriginPolicy decides which browser origins may call the API. Patterns are
+// exact origins ("https://panel.example.com"), wildcard subdomains
+// ("https://*.example.com", or "*.example.com" for any scheme) or "*". A
+// wildcard only matches origins on its port ("https://*.example.com:8443").
+type OriginPolicy struct {
+	exact     map[string]bool
+	wildcards []originWildcard
+	any       bool
+}
+
+type originWildcard struct {
+	scheme string // empty matches any scheme
+	suffix string // ".example.com"
+	port   string // empty for the scheme's default port
+}
+
+// NewOriginPolicy parses the configured origin patterns
+func NewOriginPolicy(patterns []string) *OriginPolicy {
+	policy := &OriginPolicy{exact: make(map[string]bool)}
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimRight(strings.TrimSpace(pattern), "/"))
+		switch {
+		case pattern == "":
+		case pattern == "*":
+			policy.any = true
+		case strings.Contains(pattern, "*."):
+			scheme, host, found := strings.Cut(pattern, "://")
+			if !found {
+				scheme, host = "", pattern
+			}
+			host, port, _ := strings.Cut(host, ":")
+			if strings.HasPrefix(host, "*.") {
+				policy.wildcards = append(policy.wildcards, originWildcard{scheme: scheme, suffix: host[1:], port: port})
+			}
+		default:
+			policy.exact[pattern] = true
+		}
+	}
+
+	return policy
+}
+
+// Check reports whether origin is allowed and whether it was matched
+// explicitly. Only explicit matches may send credentials; an origin allowed
+// only through "*" gets a credential-less response.
+func (p *OriginPolicy) Check(origin string) (allowed, explicit bool) {
+	origin = strings.ToLower(origin)
+
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" || (parsed.Path != "" && parsed.Path != "/") {
+		return false, false
+	}
+
+	if p.exact[origin] {
+		return true, true
+	}
+
+	for _, wildcard := range p.wildcards {
+		if wildcard.scheme != "" && wildcard.scheme != parsed.Scheme {
+			continue
+		}
+		if wildcard.port != parsed.Port() {
+			continue
+		}
+		host := parsed.Hostname()
+		if strings.HasSuffix(host, wildcard.suffix) && len(host) > len(wildcard.suffix) {
+			return true, true
+		}
+	}
+
+	return p.any, false
+}
+
+// CORS answers preflight requests and sets CORS headers for allowed origins.
+// The request's own origin is echoed back rather than a static list.
+func CORS(policy *OriginPolicy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		origin := c.Get(fiber.HeaderOrigin)
+		if origin == "" {
+			return c.Next()
+		}
+
+		c.Vary(fiber.HeaderOrigin)
+		allowed, explicit := policy.Check(origin)
+
+		if allowed {
+			if explicit {
+				c.Set(fiber.HeaderAccessControlAllowOrigin, origin)
+				c.Set(fiber.HeaderAccessControlAllowCredentials, "true")
+			} else {
+				c.Set(fiber.HeaderAccessControlAllowOrigin, "*")
+			}
+		}
+
+		// Preflight request
+		if c.Method() == fiber.MethodOptions && c.Get(fiber.HeaderAccessControlRequestMethod) != "" {
+			if allowed {
+				c.Set(fiber.HeaderAccessControlAllowMethods, corsAllowMethods)
+				c.Set(fiber.HeaderAccessControlAllowHeaders, corsAllowHeaders)
+				c.Set(fiber.HeaderAccessControlMaxAge, strconv.Itoa(corsMaxAge))
+			}
+			return c.SendStatus(fiber.StatusNoContent)
+		}
+
+		if allowed {
+			c.Set(fiber.HeaderAccessControlExposeHeaders, fiber.HeaderXRequestID)
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestOriginPolicyCheck(t *testing.T) {
+	policy := NewOriginPolicy([]string{
+		"https://panel.example.com/",
+		"https://*.example.com",
+		"*.dev.test",
+		"https://*.ports.test:8443",
+	})
+
+	tests := []struct {
+		origin            string
+		allowed, explicit bool
+	}{
+		{"https://panel.example.com", true, true},
+		{"https://eu.panel.example.com", true, true},
+		{"HTTPS://Shop.Example.com", true, true},
+		{"http://shop.example.com", false, false}, // wrong scheme
+		{"https://example.com", false, false},     // the bare domain is not a subdomain
+		{"https://evilexample.com", false, false}, // suffix without the dot
+		{"https://example.com.evil.io", false, false},
+		{"https://shop.example.com:8080", false, false}, // wildcard is on the default port
+		{"http://app.dev.test", true, true},
+		{"https://app.dev.test", true, true},
+		{"https://game.ports.test:8443", true, true},
+		{"https://game.ports.test", false, false},
+		{"https://panel.example.com/path", false, false},
+		{"null", false, false},
+	}
+
+	for _, tt := range tests {
+		allowed, explicit := policy.Check(tt.origin)
+		if allowed != tt.allowed || explicit != tt.explicit {
+			t.Errorf("Check(%q) = %v, %v, want %v, %v", tt.origin, allowed, explicit, tt.allowed, tt.explicit)
+		}
+	}
+}
+
+func corsRequest(t *testing.T, app *fiber.App, method, origin string) *http.Response {
+	t.Helper()
+
+	req := httptest.NewRequest(method, "/api/servers", nil)
+	req.Header.Set(fiber.HeaderOrigin, origin)
+	if method == http.MethodOptions {
+		req.Header.Set(fiber.HeaderAccessControlRequestMethod, http.MethodPost)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func newCORSApp(patterns ...string) *fiber.App {
+	app := fiber.New()
+	app.Use(CORS(NewOriginPolicy(patterns)))
+	app.Get("/api/servers", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	return app
+}
+
+func TestCORSEchoesAllowedSubdomain(t *testing.T) {
+	app := newCORSApp("https://*.example.com")
+
+	resp := corsRequest(t, app, http.MethodGet, "https://eu.example.com")
+	if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != "https://eu.example.com" {
+		t.Errorf("Allow-Origin = %q, want the request's origin echoed", got)
+	}
+	if got := resp.Header.Get(fiber.HeaderAccessControlAllowCredentials); got != "true" {
+		t.Errorf("Allow-Credentials = %q, want true for an explicit match", got)
+	}
+
+	resp = corsRequest(t, app, http.MethodOptions, "https://eu.example.com")
+	if resp.StatusCode != fiber.StatusNoContent || resp.Header.Get(fiber.HeaderAccessControlAllowMethods) == "" {
+		t.Errorf("preflight = %d with methods %q, want 204 with methods", resp.StatusCode, resp.Header.Get(fiber.HeaderAccessControlAllowMethods))
+	}
+}
+
+func TestCORSRejectsDisallowedOrigin(t *testing.T) {
+	app := newCORSApp("https://*.example.com")
+
+	for _, method := range []string{http.MethodGet, http.MethodOptions} {
+		resp := corsRequest(t, app, method, "https://evil.io")
+		for _, header := range []string{
+			fiber.HeaderAccessControlAllowOrigin,
+			fiber.HeaderAccessControlAllowCredentials,
+			fiber.HeaderAccessControlAllowMethods,
+		} {
+			if got := resp.Header.Get(header); got != "" {
+				t.Errorf("%s from a disallowed origin: %s = %q, want unset", method, header, got)
+			}
+		}
+	}
+}
+
+func TestCORSWildcardNeverAllowsCredentials(t *testing.T) {
+	app := newCORSApp("*", "https://panel.example.com")
+
+	resp := corsRequest(t, app, http.MethodGet, "https://anywhere.io")
+	if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != "*" {
+		t.Errorf("Allow-Origin = %q, want * for an origin only \"*\" allows", got)
+	}
+	if got := resp.Header.Get(fiber.HeaderAccessControlAllowCredentials); got != "" {
+		t.Errorf("Allow-Credentials = %q with a wildcard origin, want unset", got)
+	}
+
+	// Listed origins still get credentials alongside "*"
+	resp = corsRequest(t, app, http.MethodGet, "https://panel.example.com")
+	if resp.Header.Get(fiber.HeaderAccessControlAllowOrigin) != "https://panel.example.com" ||
+		resp.Header.Get(fiber.HeaderAccessControlAllowCredentials) != "true" {
+		t.Error("an explicitly listed origin lost credentials because \"*\" is also configured")
+	}
+}
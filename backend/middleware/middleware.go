@@ -1,20 +1,27 @@
 package middleware
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
 	"strings"
 	"time"
 
 	"playpulse-panel/config"
 	"playpulse-panel/database"
+	"playpulse-panel/logger"
 	"playpulse-panel/models"
+	"playpulse-panel/services"
 	"playpulse-panel/utils"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/websocket/v2"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
@@ -24,44 +31,158 @@ func SetupMiddleware(app *fiber.App, cfg *config.Config) {
 	// Recover middleware
 	app.Use(recover.New())
 
-	// Logger middleware
+	// Request ID middleware. A caller supplied X-Request-ID is kept so a
+	// request can be traced across services.
+	app.Use(func(c *fiber.Ctx) error {
+		requestId := c.Get(fiber.HeaderXRequestID)
+		if requestId == "" || len(requestId) > 128 {
+			requestId = uuid.New().String()
+		}
+		c.Locals("requestId", requestId)
+		c.Set(fiber.HeaderXRequestID, requestId)
+		return c.Next()
+	})
+
+	// Request log middleware
 	if cfg.Server.Debug {
-		app.Use(logger.New(logger.Config{
-			Format:     "${time} | ${status} | ${latency} | ${ip} | ${method} | ${path} | ${error}\n",
-			TimeFormat: "2006-01-02 15:04:05",
-			TimeZone:   "UTC",
-		}))
+		app.Use(RequestLogger())
 	}
 
 	// CORS middleware
-	app.Use(cors.New(cors.Config{
-		AllowOrigins:     strings.Join(cfg.Server.CORSOrigins, ","),
-		AllowMethods:     "GET,POST,PUT,DELETE,PATCH,OPTIONS",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,X-Requested-With",
-		AllowCredentials: true,
-		MaxAge:           300,
-	}))
-
-	// Rate limiting middleware
-	app.Use(limiter.New(limiter.Config{
-		Max:        100,
-		Expiration: time.Minute,
-		KeyGenerator: func(c *fiber.Ctx) string {
-			return c.IP()
-		},
-		LimitReached: func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error":   "Too many requests",
-				"message": "Rate limit exceeded. Please try again later.",
-			})
-		},
-	}))
+	app.Use(CORS(NewOriginPolicy(cfg.Server.CORSOrigins)))
 
-	// Request ID middleware
-	app.Use(func(c *fiber.Ctx) error {
-		c.Locals("requestId", uuid.New().String())
+	// Request bodies are streamed, so their size is capped here. Upload
+	// routes raise the cap with UploadLimit.
+	app.Use(BodyLimit(cfg.Files.MaxFileSize))
+
+	// Rate limiting middleware for anonymous requests. Requests carrying a
+	// valid token or API key are limited per user by UserRateLimit once
+	// authenticated; invalid credentials count against the IP like any other
+	// anonymous request.
+	app.Use(rateLimiter("anonymous", cfg.Security.RateLimits.Anonymous, cfg.Security.RateLimits.Window, hasValidCredentials))
+
+	// Request metrics middleware
+	if cfg.Monitoring.EnableMetrics {
+		app.Use(Metrics())
+	}
+}
+
+// RequestLogger writes one structured entry per request
+func RequestLogger() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		attrs := []any{
+			"method", c.Method(),
+			"path", c.Path(),
+			"status", c.Response().StatusCode(),
+			"latency_ms", time.Since(start).Milliseconds(),
+			"ip", c.IP(),
+		}
+		if userId, ok := c.Locals("userId").(uuid.UUID); ok {
+			attrs = append(attrs, "user_id", userId)
+		}
+		logger.Ctx(c).Info("request", attrs...)
+
+		return err
+	}
+}
+
+// Metrics records request counts and latencies for the /metrics endpoint
+func Metrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			var apiErr *utils.APIError
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			} else if errors.As(err, &apiErr) {
+				status = apiErr.Status
+			} else {
+				status = fiber.StatusInternalServerError
+			}
+		}
+
+		// c.Method() aliases the request buffer, which fasthttp reuses for
+		// the next request; the route's method and path are safe to keep
+		route := c.Route()
+		services.RecordHTTPRequest(route.Method, route.Path, status, time.Since(start))
+		return err
+	}
+}
+
+// BodyLimit caps request bodies, which the server streams rather than
+// buffering. Ordinary requests are read into memory up to limit and refused
+// beyond it. Multipart bodies keep streaming for their handler to write to
+// disk with utils.SaveUpload, failing once they go past limit, or past the
+// cap an UploadLimit on the route sets.
+func BodyLimit(limit int64) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		length := int64(c.Request().Header.ContentLength())
+
+		if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+			if stream := c.Context().RequestBodyStream(); stream != nil {
+				body := &utils.CappedBody{Body: stream, Max: limit}
+				c.Request().SetBodyStream(body, int(length))
+				c.Locals("cappedBody", body)
+			}
+			return c.Next()
+		}
+
+		if length > limit {
+			return bodyTooLarge(limit)
+		}
+		if stream := c.Context().RequestBodyStream(); stream != nil {
+			body, err := io.ReadAll(io.LimitReader(stream, limit+1))
+			if err != nil {
+				return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid request body", "Unable to read the request body")
+			}
+			if int64(len(body)) > limit {
+				return bodyTooLarge(limit)
+			}
+			c.Request().SetBody(body)
+		}
 		return c.Next()
-	})
+	}
+}
+
+// UploadLimit lets a route's multipart uploads stream up to limit instead of
+// the cap BodyLimit sets for every other request
+func UploadLimit(limit int64) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if int64(c.Request().Header.ContentLength()) > limit {
+			return bodyTooLarge(limit)
+		}
+		if body, ok := c.Locals("cappedBody").(*utils.CappedBody); ok {
+			body.Max = limit
+		}
+		return c.Next()
+	}
+}
+
+func bodyTooLarge(limit int64) error {
+	return utils.NewAPIError(fiber.StatusRequestEntityTooLarge, utils.CodePayloadTooLarge, "Request body too large",
+		fmt.Sprintf("Request bodies are limited to %s", utils.FormatBytes(limit)))
+}
+
+// WebSocketUpgrade lets only WebSocket upgrades through. Browsers cannot
+// set headers on WebSocket requests, so the access token may also be passed
+// as ?token=; it has to run before AuthRequired.
+func WebSocketUpgrade() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !websocket.IsWebSocketUpgrade(c) {
+			return fiber.ErrUpgradeRequired
+		}
+		if token := c.Query("token"); token != "" && c.Get(fiber.HeaderAuthorization) == "" {
+			c.Request().Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		}
+		c.Locals("allowed", true)
+		return c.Next()
+	}
 }
 
 // AuthRequired middleware for protected routes
@@ -69,98 +190,136 @@ func AuthRequired() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get token from Authorization header
 		authHeader := c.Get("Authorization")
+		if authHeader == "" && c.Get("X-API-Key") != "" {
+			return authenticateAPIKey(c)
+		}
 		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Missing authorization header",
-				"message": "Authorization header is required",
-			})
+			return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "Missing authorization header",
+				"Authorization header is required")
 		}
 
 		// Check if header starts with "Bearer "
 		if !strings.HasPrefix(authHeader, "Bearer ") {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Invalid authorization header",
-				"message": "Authorization header must start with 'Bearer '",
-			})
+			return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "Invalid authorization header",
+				"Authorization header must start with 'Bearer '")
 		}
 
 		// Extract token
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		if tokenString == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Missing token",
-				"message": "JWT token is required",
-			})
+			return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "Missing token",
+				"JWT token is required")
 		}
 
 		// Parse and validate token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			cfg, _ := config.Load()
-			return []byte(cfg.JWT.Secret), nil
-		})
-
+		token, err := parseToken(tokenString)
 		if err != nil || !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Invalid token",
-				"message": "JWT token is invalid or expired",
-			})
+			return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "Invalid token",
+				"JWT token is invalid or expired")
 		}
 
 		// Extract claims
 		claims, ok := token.Claims.(jwt.MapClaims)
 		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Invalid token claims",
-				"message": "Unable to parse token claims",
-			})
+			return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "Invalid token claims",
+				"Unable to parse token claims")
 		}
 
 		// Get user ID from claims
 		userIdStr, ok := claims["user_id"].(string)
 		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Invalid user ID in token",
-				"message": "User ID not found in token",
-			})
+			return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "Invalid user ID in token",
+				"User ID not found in token")
 		}
 
 		userId, err := uuid.Parse(userIdStr)
 		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Invalid user ID format",
-				"message": "User ID must be a valid UUID",
-			})
+			return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "Invalid user ID format",
+				"User ID must be a valid UUID")
 		}
 
 		// Get user from database
 		var user models.User
 		if err := database.DB.Where("id = ? AND is_active = ?", userId, true).First(&user).Error; err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "User not found",
-				"message": "User associated with token not found or inactive",
-			})
+			return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "User not found",
+				"User associated with token not found or inactive")
+		}
+
+		// Check that the session hasn't been revoked
+		var session models.UserSession
+		if err := database.DB.Where("user_id = ? AND token_hash = ? AND expires_at > ?", userId, utils.HashToken(tokenString), time.Now()).First(&session).Error; err != nil {
+			return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "Session expired",
+				"Your session has been revoked or has expired. Please login again.")
+		}
+
+		// Update last seen at most once a minute
+		now := time.Now()
+		if session.LastSeen == nil || now.Sub(*session.LastSeen) > time.Minute {
+			database.DB.Model(&session).Update("last_seen", now)
 		}
 
 		// Store user in context
 		c.Locals("user", user)
 		c.Locals("userId", userId)
+		c.Locals("sessionId", session.ID)
 
 		return c.Next()
 	}
 }
 
+// RequestUserID returns the user AuthRequired authenticated, for net/http
+// handlers mounted with the adaptor, which passes the request's locals on as
+// its context values
+func RequestUserID(r *http.Request) (uuid.UUID, error) {
+	userId, ok := r.Context().Value("userId").(uuid.UUID)
+	if !ok || userId == uuid.Nil {
+		return uuid.Nil, errors.New("user not authenticated")
+	}
+	return userId, nil
+}
+
+// RequestAdminID is RequestUserID for admins; it fails for anyone else
+func RequestAdminID(r *http.Request) (uuid.UUID, error) {
+	user, ok := r.Context().Value("user").(models.User)
+	if !ok || user.Role != models.RoleAdmin {
+		return uuid.Nil, errors.New("admin access required")
+	}
+	return user.ID, nil
+}
+
+// parseToken parses a JWT and verifies its signature and expiry
+func parseToken(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		cfg, _ := config.Load()
+		return []byte(cfg.JWT.Secret), nil
+	})
+}
+
+// hasValidCredentials reports whether a request carries a token signed by
+// the panel or an API key that authenticates. Anything else, including a
+// made up Authorization header, is treated as anonymous.
+func hasValidCredentials(c *fiber.Ctx) bool {
+	if authHeader := c.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		token, err := parseToken(strings.TrimPrefix(authHeader, "Bearer "))
+		return err == nil && token.Valid
+	}
+	if rawKey := c.Get("X-API-Key"); rawKey != "" {
+		_, _, err := services.AuthenticateAPIKey(rawKey)
+		return err == nil
+	}
+	return false
+}
+
 // RoleRequired middleware for role-based access control
 func RoleRequired(roles ...models.UserRole) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		user, ok := c.Locals("user").(models.User)
 		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "User not authenticated",
-				"message": "Please login to access this resource",
-			})
+			return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "User not authenticated",
+				"Please login to access this resource")
 		}
 
 		// Check if user has required role
@@ -173,10 +332,8 @@ func RoleRequired(roles ...models.UserRole) fiber.Handler {
 		}
 
 		if !hasRole {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error":   "Insufficient permissions",
-				"message": "You don't have permission to access this resource",
-			})
+			return utils.NewAPIError(fiber.StatusForbidden, utils.CodeForbidden, "Insufficient permissions",
+				"You don't have permission to access this resource")
 		}
 
 		return c.Next()
@@ -193,27 +350,21 @@ func ServerAccessRequired() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		user, ok := c.Locals("user").(models.User)
 		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "User not authenticated",
-				"message": "Please login to access this resource",
-			})
+			return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "User not authenticated",
+				"Please login to access this resource")
 		}
 
 		// Get server ID from URL params
 		serverIdStr := c.Params("serverId")
 		if serverIdStr == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Missing server ID",
-				"message": "Server ID is required",
-			})
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Missing server ID",
+				"Server ID is required")
 		}
 
 		serverId, err := uuid.Parse(serverIdStr)
 		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":   "Invalid server ID",
-				"message": "Server ID must be a valid UUID",
-			})
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid server ID",
+				"Server ID must be a valid UUID")
 		}
 
 		// Check if user is admin (admins have access to all servers)
@@ -223,66 +374,148 @@ func ServerAccessRequired() fiber.Handler {
 		}
 
 		// Check if user has access to this server
-		var server models.Server
-		err = database.DB.Preload("Users").Where("id = ?", serverId).First(&server).Error
+		server, err := services.GetAccessibleServer(&user, serverId)
+		if errors.Is(err, services.ErrServerAccessDenied) {
+			return utils.NewAPIError(fiber.StatusForbidden, utils.CodeForbidden, "Access denied",
+				"You don't have access to this server")
+		}
 		if err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error":   "Server not found",
-				"message": "The requested server does not exist",
-			})
+			return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found",
+				"The requested server does not exist")
 		}
 
-		// Check if user is associated with this server
-		hasAccess := false
-		for _, serverUser := range server.Users {
-			if serverUser.ID == user.ID {
-				hasAccess = true
-				break
-			}
+		c.Locals("serverId", serverId)
+		c.Locals("server", *server)
+		return c.Next()
+	}
+}
+
+// ServerOwnerRequired restricts a route to admins and the server's owners,
+// for managing access and anything that grants as much, such as cloning.
+// Must run after ServerAccessRequired.
+func ServerOwnerRequired() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := c.Locals("user").(models.User)
+		serverId := c.Locals("serverId").(uuid.UUID)
+
+		if !services.CanManageServerAccess(&user, serverId) {
+			return utils.NewAPIError(fiber.StatusForbidden, utils.CodeForbidden, "Access denied",
+				"Only the server's owners can do this")
 		}
 
-		if !hasAccess {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error":   "Access denied",
-				"message": "You don't have access to this server",
-			})
+		return c.Next()
+	}
+}
+
+// ServerPermissionRequired restricts a route to users with a permission on
+// the server; admins and owners have them all. Must run after
+// ServerAccessRequired.
+func ServerPermissionRequired(permission models.ServerPermission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := c.Locals("user").(models.User)
+		serverId := c.Locals("serverId").(uuid.UUID)
+
+		if !services.HasServerPermission(&user, serverId, permission) {
+			return utils.NewAPIError(fiber.StatusForbidden, utils.CodeForbidden, "Access denied",
+				fmt.Sprintf("You need the %s permission on this server", permission))
 		}
 
-		c.Locals("serverId", serverId)
-		c.Locals("server", server)
 		return c.Next()
 	}
 }
 
-// APIKeyAuth middleware for API key authentication
-func APIKeyAuth() fiber.Handler {
+// DiskQuotaRequired rejects uploads and other writes to a server that is
+// over its disk quota, or that the request body would take over it. Reads
+// always pass. Must run after ServerAccessRequired.
+func DiskQuotaRequired() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		apiKey := c.Get("X-API-Key")
-		if apiKey == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Missing API key",
-				"message": "X-API-Key header is required",
-			})
+		if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead || c.Method() == fiber.MethodDelete {
+			return c.Next()
 		}
 
-		// Find user by API key
-		var user models.User
-		if err := database.DB.Where("api_key = ? AND is_active = ?", apiKey, true).First(&user).Error; err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error":   "Invalid API key",
-				"message": "The provided API key is invalid",
-			})
+		serverId, ok := c.Locals("serverId").(uuid.UUID)
+		if !ok {
+			return c.Next()
 		}
 
-		// Store user in context
-		c.Locals("user", user)
-		c.Locals("userId", user.ID)
+		var server models.Server
+		if err := database.DB.First(&server, serverId).Error; err != nil {
+			return c.Next()
+		}
+
+		// Chunked bodies have no length, so only a server already over its
+		// quota is caught for them
+		length := int64(c.Request().Header.ContentLength())
+		if length < 0 {
+			length = 0
+		}
+		if err := services.CheckDiskQuota(&server, length); err != nil {
+			return utils.NewAPIError(fiber.StatusInsufficientStorage, utils.CodeInsufficientStorage, "Disk quota exceeded",
+				fmt.Sprintf("The upload would take server %s past its %d MB disk limit", server.Name, server.DiskLimit))
+		}
 
 		return c.Next()
 	}
 }
 
-// AuditLog middleware for logging user actions
+// APIKeyAuth middleware for API key authentication. The key's scope must
+// cover the route, see requiredAPIKeyScope.
+func APIKeyAuth() fiber.Handler {
+	return authenticateAPIKey
+}
+
+func authenticateAPIKey(c *fiber.Ctx) error {
+	rawKey := c.Get("X-API-Key")
+	if rawKey == "" {
+		return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "Missing API key",
+			"X-API-Key header is required")
+	}
+
+	key, user, err := services.AuthenticateAPIKey(rawKey)
+	if err != nil {
+		return utils.NewAPIError(fiber.StatusUnauthorized, utils.CodeUnauthorized, "Invalid API key",
+			"The provided API key is invalid, expired or revoked")
+	}
+
+	required, allowed := requiredAPIKeyScope(c)
+	if !allowed || !key.Scope.Allows(required) {
+		return utils.NewAPIError(fiber.StatusForbidden, utils.CodeForbidden, "Insufficient scope",
+			fmt.Sprintf("This API key's %s scope does not allow this request", key.Scope))
+	}
+
+	// Store user in context
+	c.Locals("user", *user)
+	c.Locals("userId", user.ID)
+	c.Locals("apiKeyId", key.ID)
+
+	return c.Next()
+}
+
+// requiredAPIKeyScope maps a request to the scope an API key needs for it.
+// Reads need read, changes to servers need server-control and any other
+// change needs admin. API keys can never manage API keys, so a leaked key
+// cannot mint or rotate others.
+func requiredAPIKeyScope(c *fiber.Ctx) (models.APIKeyScope, bool) {
+	cfg, _ := config.Load()
+	path := strings.TrimPrefix(c.Path(), cfg.Server.APIPrefix)
+	section := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case len(section) >= 2 && section[0] == "auth" && section[1] == "api-keys":
+		return "", false
+	case section[0] == "admin":
+		return models.APIKeyScopeAdmin, true
+	case c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead:
+		return models.APIKeyScopeRead, true
+	case section[0] == "servers":
+		return models.APIKeyScopeServerControl, true
+	default:
+		return models.APIKeyScopeAdmin, true
+	}
+}
+
+// AuditLog middleware for logging user actions. The details stored are the
+// request's, unless the handler set the auditDetails local.
 func AuditLog(action string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Execute the next handler first
@@ -290,52 +523,186 @@ func AuditLog(action string) fiber.Handler {
 
 		// Log the action if request was successful
 		if c.Response().StatusCode() < 400 {
-			go func() {
-				user, ok := c.Locals("user").(models.User)
-				if !ok {
-					return
-				}
-
-				serverId, _ := c.Locals("serverId").(uuid.UUID)
-				var serverIdPtr *uuid.UUID
-				if serverId != uuid.Nil {
-					serverIdPtr = &serverId
-				}
-
-				auditLog := models.AuditLog{
-					UserID:    user.ID,
-					ServerID:  serverIdPtr,
-					Action:    action,
-					Details:   utils.GetRequestDetails(c),
-					IPAddress: c.IP(),
-					UserAgent: c.Get("User-Agent"),
-				}
-
-				database.DB.Create(&auditLog)
-			}()
+			user, ok := c.Locals("user").(models.User)
+			if !ok {
+				return err
+			}
+
+			serverId, _ := c.Locals("serverId").(uuid.UUID)
+			var serverIdPtr *uuid.UUID
+			if serverId != uuid.Nil {
+				serverIdPtr = &serverId
+			}
+
+			// Handlers whose requests carry something that mustn't be
+			// stored, such as console commands, set the details themselves
+			details, ok := c.Locals("auditDetails").(string)
+			if !ok {
+				details = utils.GetRequestDetails(c)
+			}
+
+			// Read everything from the context now; fiber reuses it once
+			// the handler returns
+			auditLog := models.AuditLog{
+				UserID:    user.ID,
+				ServerID:  serverIdPtr,
+				Action:    action,
+				Details:   details,
+				IPAddress: c.IP(),
+				UserAgent: c.Get("User-Agent"),
+				RequestID: logger.RequestID(c),
+			}
+
+			go database.DB.Create(&auditLog)
 		}
 
 		return err
 	}
 }
 
-// ErrorHandler handles application errors
-func ErrorHandler(c *fiber.Ctx, err error) error {
-	code := fiber.StatusInternalServerError
-	message := "Internal Server Error"
+// maxIdempotencyKeyLength bounds the Idempotency-Key header
+const maxIdempotencyKeyLength = 255
+
+// Idempotent lets clients retry a request safely by sending an
+// Idempotency-Key header. The first response for a key is stored and a
+// retry with the same key and body within services.IdempotencyTTL gets it
+// back, marked with Idempotent-Replayed, without the handler running again.
+// Keys are per user and scope. Requests without the header run as usual.
+// Must run after AuthRequired.
+func Idempotent(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get("Idempotency-Key")
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return utils.NewAPIError(fiber.StatusBadRequest, utils.CodeBadRequest, "Invalid idempotency key",
+				fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength))
+		}
 
-	if e, ok := err.(*fiber.Error); ok {
-		code = e.Code
-		message = e.Message
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Next()
+		}
+
+		hash := sha256.New()
+		hash.Write([]byte(c.Method() + " " + c.Path() + "\n"))
+		hash.Write(c.Body())
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		record, replay, err := services.BeginIdempotentRequest(user.ID, scope, key, requestHash)
+		switch {
+		case errors.Is(err, services.ErrIdempotencyKeyReused):
+			return utils.NewAPIError(fiber.StatusUnprocessableEntity, utils.CodeIdempotencyMismatch, "Idempotency key reused",
+				err.Error())
+		case errors.Is(err, services.ErrIdempotencyInProgress):
+			return utils.NewAPIError(fiber.StatusConflict, utils.CodeConflict, "Request in progress", err.Error())
+		case err != nil:
+			return err
+		}
+
+		if replay != nil {
+			c.Set("Idempotent-Replayed", "true")
+			c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			return c.Status(replay.StatusCode).Send(replay.Response)
+		}
+
+		if err := c.Next(); err != nil {
+			services.ReleaseIdempotentRequest(record)
+			return err
+		}
+
+		// The body belongs to fiber's pooled response, so store a copy
+		response := append([]byte(nil), c.Response().Body()...)
+		services.CompleteIdempotentRequest(record, c.Response().StatusCode(), response)
+		return nil
 	}
+}
+
+// ErrorHandler handles application errors. An *utils.APIError is rendered
+// as is; other errors get a code from their status, and errors that aren't
+// fiber errors are internal and their details aren't shown.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	apiErr := utils.NewAPIError(fiber.StatusInternalServerError, utils.CodeInternal,
+		"Internal Server Error", "An unexpected error occurred")
+
+	var typed *utils.APIError
+	var fiberErr *fiber.Error
+	if errors.As(err, &typed) {
+		apiErr = typed
+	} else if errors.As(err, &fiberErr) {
+		apiErr = utils.NewAPIError(fiberErr.Code, utils.CodeForStatus(fiberErr.Code), fiberErr.Message, fiberErr.Message)
+	}
+	code := apiErr.Status
 
 	// Log error
-	fmt.Printf("Error: %v\n", err)
+	level := slog.LevelWarn
+	if code >= fiber.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	logger.Ctx(c).Log(c.UserContext(), level, "request failed",
+		"error", err,
+		"status", code,
+		"method", c.Method(),
+		"path", c.Path(),
+	)
+
+	return utils.SendAPIError(c, apiErr)
+}
+
+// RateLimit limits requests per client IP on a single route
+func RateLimit(max int, expiration time.Duration) fiber.Handler {
+	return rateLimiter("route", max, expiration, nil)
+}
+
+// UserRateLimit limits authenticated requests per user, with a higher
+// allowance for read-only requests. Must run after AuthRequired.
+func UserRateLimit(cfg *config.Config) fiber.Handler {
+	limits := cfg.Security.RateLimits
+	read := rateLimiter("read", limits.Read, limits.Window, nil)
+	write := rateLimiter("write", limits.Write, limits.Window, nil)
+
+	return func(c *fiber.Ctx) error {
+		if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+			return read(c)
+		}
+		return write(c)
+	}
+}
 
-	return c.Status(code).JSON(fiber.Map{
-		"error":     message,
-		"timestamp": time.Now().UTC(),
-		"path":      c.Path(),
-		"method":    c.Method(),
+// AuthRateLimit applies the strict limit for login and registration routes
+func AuthRateLimit(cfg *config.Config) fiber.Handler {
+	return rateLimiter("auth", cfg.Security.RateLimits.Auth, cfg.Security.RateLimits.Window, nil)
+}
+
+// UploadRateLimit applies the limit for file upload routes
+func UploadRateLimit(cfg *config.Config) fiber.Handler {
+	return rateLimiter("upload", cfg.Security.RateLimits.Upload, cfg.Security.RateLimits.Window, nil)
+}
+
+// rateLimiter creates a limiter for one tier. Requests are keyed by user ID
+// when authenticated and by IP otherwise. The limiter sets the
+// X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset headers and
+// Retry-After once the limit is reached.
+func rateLimiter(tier string, max int, expiration time.Duration, skip func(c *fiber.Ctx) bool) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Next:       skip,
+		Max:        max,
+		Expiration: expiration,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return tier + ":" + rateLimitKey(c)
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return utils.NewAPIError(fiber.StatusTooManyRequests, utils.CodeRateLimited, "Too many requests",
+				"Rate limit exceeded. Please try again later.")
+		},
 	})
+}
+
+// rateLimitKey identifies the client for rate limiting
+func rateLimitKey(c *fiber.Ctx) string {
+	if userId, ok := c.Locals("userId").(uuid.UUID); ok && userId != uuid.Nil {
+		return "user:" + userId.String()
+	}
+	return "ip:" + c.IP()
 }
\ No newline at end of file
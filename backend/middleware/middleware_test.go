@@ -0,0 +1,478 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+	"playpulse-panel/services"
+	"playpulse-panel/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// testUser stands in for AuthRequired, authenticating the user named in the
+// X-Test-User header
+func testUser(c *fiber.Ctx) error {
+	if id, err := uuid.Parse(c.Get("X-Test-User")); err == nil {
+		c.Locals("userId", id)
+	}
+	return c.Next()
+}
+
+func send(t *testing.T, app *fiber.App, method, path, user string) *http.Response {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, nil)
+	if user != "" {
+		req.Header.Set("X-Test-User", user)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return resp
+}
+
+// allowed counts how many of n requests pass before the limiter rejects one
+func allowed(t *testing.T, app *fiber.App, method, path, user string, n int) int {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		resp := send(t, app, method, path, user)
+		if resp.StatusCode == fiber.StatusTooManyRequests {
+			return i
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("%s %s = %d", method, path, resp.StatusCode)
+		}
+	}
+	return n
+}
+
+func newRateLimitedApp() *fiber.App {
+	cfg := &config.Config{}
+	cfg.Security.RateLimits = config.RateLimitConfig{
+		Window: time.Minute,
+		Read:   20,
+		Write:  5,
+		Auth:   3,
+	}
+
+	ok := func(c *fiber.Ctx) error { return c.SendString("ok") }
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Post("/auth/login", AuthRateLimit(cfg), ok)
+	api := app.Group("/api", testUser, UserRateLimit(cfg))
+	api.Get("/servers", ok)
+	api.Post("/servers", ok)
+	return app
+}
+
+func TestLoginLimitedMoreThanListServers(t *testing.T) {
+	app := newRateLimitedApp()
+	user := uuid.NewString()
+
+	if got := allowed(t, app, http.MethodPost, "/auth/login", "", 10); got != 3 {
+		t.Errorf("%d logins allowed, want 3", got)
+	}
+	if got := allowed(t, app, http.MethodGet, "/api/servers", user, 30); got != 20 {
+		t.Errorf("%d server listings allowed, want 20", got)
+	}
+	if got := allowed(t, app, http.MethodPost, "/api/servers", user, 10); got != 5 {
+		t.Errorf("%d server creations allowed, want 5", got)
+	}
+}
+
+func TestRateLimitKeyedPerUser(t *testing.T) {
+	app := newRateLimitedApp()
+	alice, bob := uuid.NewString(), uuid.NewString()
+
+	// Both users share an IP but not an allowance
+	if got := allowed(t, app, http.MethodPost, "/api/servers", alice, 10); got != 5 {
+		t.Fatalf("%d requests allowed for alice, want 5", got)
+	}
+	if got := allowed(t, app, http.MethodPost, "/api/servers", bob, 10); got != 5 {
+		t.Errorf("%d requests allowed for bob after alice hit her limit, want 5", got)
+	}
+
+	resp := send(t, app, http.MethodPost, "/api/servers", alice)
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("rate limited response has no Retry-After header")
+	}
+}
+
+func TestRateLimitKeyFallsBackToIP(t *testing.T) {
+	app := fiber.New()
+	app.Get("/key", testUser, func(c *fiber.Ctx) error {
+		return c.SendString(rateLimitKey(c))
+	})
+
+	key := func(user string) string {
+		resp := send(t, app, http.MethodGet, "/key", user)
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if got := key(""); got != "ip:0.0.0.0" {
+		t.Errorf("unauthenticated key = %q, want the client IP", got)
+	}
+	user := uuid.NewString()
+	if got := key(user); got != "user:"+user {
+		t.Errorf("authenticated key = %q, want the user ID", got)
+	}
+}
+
+func TestMetricsEndpointExportsKeySeries(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.HandlerFor(services.MetricsRegistry, promhttp.HandlerOpts{})))
+
+	api := app.Group("/api", Metrics())
+	api.Get("/servers/:id", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	api.Delete("/servers/:id", func(c *fiber.Ctx) error {
+		return utils.NewAPIError(fiber.StatusNotFound, utils.CodeNotFound, "Server not found", "No such server")
+	})
+
+	send(t, app, http.MethodGet, "/api/servers/"+uuid.NewString(), "")
+	send(t, app, http.MethodDelete, "/api/servers/"+uuid.NewString(), "")
+
+	resp := send(t, app, http.MethodGet, "/metrics", "")
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("GET /metrics = %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	scrape := string(body)
+
+	// Requests are labelled by route pattern, not by the raw path
+	want := []string{
+		`playpulse_http_requests_total{method="GET",route="/api/servers/:id",status="200"} 1`,
+		`playpulse_http_requests_total{method="DELETE",route="/api/servers/:id",status="404"} 1`,
+		`playpulse_http_request_duration_seconds_bucket{method="GET",route="/api/servers/:id",le="+Inf"} 1`,
+		"# TYPE playpulse_websocket_connections gauge",
+		"# TYPE playpulse_backup_queue_depth gauge",
+		"# TYPE playpulse_backups_running gauge",
+	}
+	for _, series := range want {
+		if !strings.Contains(scrape, series) {
+			t.Errorf("scrape is missing %s", series)
+		}
+	}
+	if strings.Contains(scrape, "go_goroutines") {
+		t.Error("scrape includes the default Go collectors")
+	}
+}
+
+// newAPIKeyApp serves a server read and a server start behind API key auth
+func newAPIKeyApp() *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	app.Get("/api/v1/servers/:id", APIKeyAuth(), ok)
+	app.Post("/api/v1/servers/:id/start", APIKeyAuth(), ok)
+	return app
+}
+
+func sendWithKey(t *testing.T, app *fiber.App, method, path, key string) int {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return resp.StatusCode
+}
+
+func TestReadOnlyAPIKeyCannotStartServer(t *testing.T) {
+	testutil.UseDB(t)
+	user := testutil.CreateUser(t, &models.User{})
+	app := newAPIKeyApp()
+	path := "/api/v1/servers/" + uuid.NewString()
+
+	_, readKey, err := services.CreateAPIKey(user.ID, "monitoring", models.APIKeyScopeRead, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if status := sendWithKey(t, app, fiber.MethodGet, path, readKey); status != fiber.StatusOK {
+		t.Errorf("read key on GET = %d, want 200", status)
+	}
+	if status := sendWithKey(t, app, fiber.MethodPost, path+"/start", readKey); status != fiber.StatusForbidden {
+		t.Errorf("read key on start = %d, want 403", status)
+	}
+
+	_, controlKey, err := services.CreateAPIKey(user.ID, "deploys", models.APIKeyScopeServerControl, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if status := sendWithKey(t, app, fiber.MethodPost, path+"/start", controlKey); status != fiber.StatusOK {
+		t.Errorf("server-control key on start = %d, want 200", status)
+	}
+}
+
+func TestRotatedAPIKeyInvalidatesOldKey(t *testing.T) {
+	testutil.UseDB(t)
+	user := testutil.CreateUser(t, &models.User{})
+	app := newAPIKeyApp()
+	path := "/api/v1/servers/" + uuid.NewString()
+
+	key, oldKey, err := services.CreateAPIKey(user.ID, "ci", models.APIKeyScopeRead, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	rotated, newKey, err := services.RotateAPIKey(user.ID, key.ID)
+	if err != nil {
+		t.Fatalf("RotateAPIKey: %v", err)
+	}
+	if newKey == oldKey || rotated.Scope != key.Scope || rotated.Name != key.Name {
+		t.Errorf("rotated key = %+v, want a new key with the old name and scope", rotated)
+	}
+
+	if status := sendWithKey(t, app, fiber.MethodGet, path, oldKey); status != fiber.StatusUnauthorized {
+		t.Errorf("old key after rotation = %d, want 401", status)
+	}
+	if status := sendWithKey(t, app, fiber.MethodGet, path, newKey); status != fiber.StatusOK {
+		t.Errorf("new key = %d, want 200", status)
+	}
+
+	// A revoked or expired key is refused the same way
+	if err := services.RevokeAPIKey(user.ID, rotated.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if status := sendWithKey(t, app, fiber.MethodGet, path, newKey); status != fiber.StatusUnauthorized {
+		t.Errorf("revoked key = %d, want 401", status)
+	}
+	expired := time.Now().Add(-time.Minute)
+	_, expiredKey, err := services.CreateAPIKey(user.ID, "old", models.APIKeyScopeRead, &expired)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if status := sendWithKey(t, app, fiber.MethodGet, path, expiredKey); status != fiber.StatusUnauthorized {
+		t.Errorf("expired key = %d, want 401", status)
+	}
+}
+
+func TestAPIKeyScopeAllows(t *testing.T) {
+	tests := []struct {
+		scope, required models.APIKeyScope
+		want            bool
+	}{
+		{models.APIKeyScopeRead, models.APIKeyScopeRead, true},
+		{models.APIKeyScopeRead, models.APIKeyScopeServerControl, false},
+		{models.APIKeyScopeServerControl, models.APIKeyScopeRead, true},
+		{models.APIKeyScopeServerControl, models.APIKeyScopeAdmin, false},
+		{models.APIKeyScopeAdmin, models.APIKeyScopeServerControl, true},
+		{"", models.APIKeyScopeRead, false},
+	}
+	for _, tt := range tests {
+		if got := tt.scope.Allows(tt.required); got != tt.want {
+			t.Errorf("%q.Allows(%q) = %v, want %v", tt.scope, tt.required, got, tt.want)
+		}
+	}
+}
+
+// captureLogs sends structured log entries to a buffer until the test ends
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// logEntries decodes JSON log lines, failing on anything that isn't one
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var entries []map[string]interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestFailingRequestLoggedWithRequestID(t *testing.T) {
+	logs := captureLogs(t)
+
+	cfg := &config.Config{}
+	cfg.Security.RateLimits = config.RateLimitConfig{Window: time.Minute, Anonymous: 100}
+	cfg.Files.MaxFileSize = 1 << 20
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	SetupMiddleware(app, cfg)
+	app.Get("/fail", func(c *fiber.Ctx) error { return errors.New("disk on fire") })
+
+	for _, supplied := range []string{"", "trace-from-proxy"} {
+		logs.Reset()
+
+		req := httptest.NewRequest(http.MethodGet, "/fail", nil)
+		if supplied != "" {
+			req.Header.Set(fiber.HeaderXRequestID, supplied)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusInternalServerError {
+			t.Fatalf("status = %d, want 500", resp.StatusCode)
+		}
+
+		requestId := resp.Header.Get(fiber.HeaderXRequestID)
+		if requestId == "" || (supplied != "" && requestId != supplied) {
+			t.Errorf("response request ID = %q, want %q kept or one generated", requestId, supplied)
+		}
+
+		entries := logEntries(t, logs)
+		if len(entries) != 1 {
+			t.Fatalf("%d log entries, want one for the failed request", len(entries))
+		}
+		entry := entries[0]
+		if entry["request_id"] != requestId || entry["level"] != "ERROR" || entry["error"] != "disk on fire" {
+			t.Errorf("log entry = %v, want the error at ERROR level with request ID %s", entry, requestId)
+		}
+		if entry["status"] != float64(fiber.StatusInternalServerError) || entry["path"] != "/fail" {
+			t.Errorf("log entry = %v, want the status and path", entry)
+		}
+	}
+}
+
+// newIdempotentApp serves a server create behind Idempotent that creates a
+// server owned by the user and answers with it. The user is the one in the
+// X-Test-User header, and the returned count is how many servers the
+// handler created.
+func newIdempotentApp(t *testing.T, users ...*models.User) (*fiber.App, *int) {
+	created := 0
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(func(c *fiber.Ctx) error {
+		for _, user := range users {
+			if user.ID.String() == c.Get("X-Test-User") {
+				c.Locals("user", *user)
+			}
+		}
+		return c.Next()
+	})
+	app.Post("/servers", Idempotent("server_create"), func(c *fiber.Ctx) error {
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := c.BodyParser(&body); err != nil || body.Name == "fail" {
+			return fiber.NewError(fiber.StatusInternalServerError, "create failed")
+		}
+		user := c.Locals("user").(models.User)
+		server := testutil.CreateServer(t, &models.Server{})
+		testutil.GrantServerAccess(t, &user, server, models.ServerRoleOwner)
+		created++
+		return c.Status(fiber.StatusCreated).JSON(server)
+	})
+	return app, &created
+}
+
+func sendIdempotent(t *testing.T, app *fiber.App, user *models.User, key, body string) (*http.Response, []byte) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/servers", strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set("X-Test-User", user.ID.String())
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("POST /servers: %v", err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	return resp, data
+}
+
+func TestIdempotentCreateReplaysResponse(t *testing.T) {
+	db := testutil.UseDB(t)
+	user := testutil.CreateUser(t, &models.User{})
+	app, created := newIdempotentApp(t, user)
+	key := uuid.NewString()
+
+	first, firstBody := sendIdempotent(t, app, user, key, `{"name":"survival"}`)
+	if first.StatusCode != fiber.StatusCreated || first.Header.Get("Idempotent-Replayed") != "" {
+		t.Fatalf("first request = %d, replayed %q", first.StatusCode, first.Header.Get("Idempotent-Replayed"))
+	}
+	retry, retryBody := sendIdempotent(t, app, user, key, `{"name":"survival"}`)
+	if retry.StatusCode != fiber.StatusCreated || retry.Header.Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry = %d, replayed %q, want the stored 201", retry.StatusCode, retry.Header.Get("Idempotent-Replayed"))
+	}
+	if !bytes.Equal(firstBody, retryBody) {
+		t.Errorf("retry body = %s, want the first response %s", retryBody, firstBody)
+	}
+
+	var servers int64
+	db.Model(&models.UserServer{}).Where("user_id = ?", user.ID).Count(&servers)
+	if *created != 1 || servers != 1 {
+		t.Errorf("%d servers created, %d owned, want one", *created, servers)
+	}
+
+	// Without a key every request runs
+	sendIdempotent(t, app, user, "", `{"name":"survival"}`)
+	sendIdempotent(t, app, user, "", `{"name":"survival"}`)
+	if *created != 3 {
+		t.Errorf("%d servers created, want two more for requests without a key", *created)
+	}
+}
+
+func TestIdempotentKeyScopedPerUser(t *testing.T) {
+	testutil.UseDB(t)
+	alice := testutil.CreateUser(t, &models.User{})
+	bob := testutil.CreateUser(t, &models.User{})
+	app, created := newIdempotentApp(t, alice, bob)
+	key := uuid.NewString()
+
+	_, aliceBody := sendIdempotent(t, app, alice, key, `{"name":"survival"}`)
+	resp, bobBody := sendIdempotent(t, app, bob, key, `{"name":"survival"}`)
+	if resp.Header.Get("Idempotent-Replayed") != "" || bytes.Equal(aliceBody, bobBody) {
+		t.Error("another user's request with the same key got the first user's response")
+	}
+	if *created != 2 {
+		t.Errorf("%d servers created, want one per user", *created)
+	}
+}
+
+func TestIdempotentRejectsReusedKey(t *testing.T) {
+	testutil.UseDB(t)
+	user := testutil.CreateUser(t, &models.User{})
+	app, created := newIdempotentApp(t, user)
+	key := uuid.NewString()
+
+	sendIdempotent(t, app, user, key, `{"name":"survival"}`)
+	if resp, _ := sendIdempotent(t, app, user, key, `{"name":"creative"}`); resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Errorf("same key with another body = %d, want 422", resp.StatusCode)
+	}
+
+	// A server error frees the key so the request can be retried
+	failKey := uuid.NewString()
+	if resp, _ := sendIdempotent(t, app, user, failKey, `{"name":"fail"}`); resp.StatusCode != fiber.StatusInternalServerError {
+		t.Fatalf("failing request = %d, want 500", resp.StatusCode)
+	}
+	if resp, _ := sendIdempotent(t, app, user, failKey, `{"name":"fail"}`); resp.Header.Get("Idempotent-Replayed") != "" {
+		t.Error("a failed request was replayed")
+	}
+
+	if resp, _ := sendIdempotent(t, app, user, strings.Repeat("k", 256), `{"name":"survival"}`); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("overlong key = %d, want 400", resp.StatusCode)
+	}
+	if *created != 1 {
+		t.Errorf("%d servers created, want one", *created)
+	}
+}
@@ -23,7 +23,6 @@ type User struct {
 	LastLogin         *time.Time     `json:"last_login"`
 	LoginAttempts     int            `json:"-" gorm:"default:0"`
 	LockedUntil       *time.Time     `json:"-"`
-	APIKey            string         `json:"api_key" gorm:"uniqueIndex"`
 	CreatedAt         time.Time      `json:"created_at"`
 	UpdatedAt         time.Time      `json:"updated_at"`
 	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
@@ -47,10 +46,11 @@ const (
 type UserSession struct {
 	ID           uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	UserID       uuid.UUID      `json:"user_id" gorm:"type:uuid;not null"`
-	TokenHash    string         `json:"-" gorm:"not null"`
+	TokenHash    string         `json:"-" gorm:"not null;index"`
 	RefreshToken string         `json:"-" gorm:"not null"`
 	IPAddress    string         `json:"ip_address"`
 	UserAgent    string         `json:"user_agent"`
+	LastSeen     *time.Time     `json:"last_seen"`
 	ExpiresAt    time.Time      `json:"expires_at"`
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
@@ -59,11 +59,34 @@ type UserSession struct {
 	User User `json:"user,omitempty"`
 }
 
+// PasswordResetToken is a single-use token for resetting a forgotten password.
+// Only the SHA-256 hash of the token is stored.
+type PasswordResetToken struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	IPAddress string     `json:"ip_address"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// VerificationToken is a single-use token that confirms a user's email address
+type VerificationToken struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	Email     string     `json:"email" gorm:"not null"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
 // Server represents a game server
 type Server struct {
 	ID              uuid.UUID       `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	Name            string          `json:"name" gorm:"not null" validate:"required,min=1,max=100"`
 	Description     string          `json:"description"`
+	Tags            []string        `json:"tags" gorm:"type:jsonb;serializer:json"` // lowercase labels for organising servers
 	Type            ServerType      `json:"type" gorm:"not null"`
 	Version         string          `json:"version"`
 	Status          ServerStatus    `json:"status" gorm:"default:'stopped'"`
@@ -74,14 +97,30 @@ type Server struct {
 	Path            string          `json:"path" gorm:"not null"`
 	JavaPath        string          `json:"java_path"`
 	JavaArgs        string          `json:"java_args"`
+	JVMPreset       string          `json:"jvm_preset"` // replaces JavaArgs when set
 	ServerJar       string          `json:"server_jar"`
-	StartCommand    string          `json:"start_command"`
+	StartCommand    string          `json:"start_command"` // launch arguments used instead of -jar (e.g. Forge args files)
 	StopCommand     string          `json:"stop_command"`
+	StopTimeout     int             `json:"stop_timeout" gorm:"default:60"` // seconds to wait for save and shutdown before killing
+	MetricsInterval int             `json:"metrics_interval"`                // seconds between stats samples; 0 uses the panel default
+	HibernateEnabled     bool           `json:"hibernate_enabled" gorm:"default:false"` // stop when empty and start on the next connection
+	HibernateIdleMinutes int            `json:"hibernate_idle_minutes"`                 // minutes without players before hibernating; 0 uses the default
 	AutoRestart     bool            `json:"auto_restart" gorm:"default:true"`
 	AutoStart       bool            `json:"auto_start" gorm:"default:false"`
 	BackupEnabled   bool            `json:"backup_enabled" gorm:"default:true"`
+	BackupInclude   []string        `json:"backup_include" gorm:"serializer:json"` // globs; when set only matching files are backed up
+	BackupExclude   []string        `json:"backup_exclude" gorm:"serializer:json"` // globs left out of backups
+	BackupIntervalMinutes int       `json:"backup_interval_minutes"` // minutes between scheduled backups; 0 uses the panel default
+	BackupCron      string          `json:"backup_cron"`      // cron pattern for scheduled backups, used instead of the interval
+	BackupRetention int             `json:"backup_retention"` // scheduled backups kept; 0 uses max_backup_count
 	LastBackup      *time.Time      `json:"last_backup"`
+	StartedAt       *time.Time      `json:"started_at"`
+	CrashCount      int             `json:"crash_count" gorm:"default:0"` // crashes in the current window
+	CrashWindowAt   *time.Time      `json:"crash_window_at"`              // start of the crash window
+	LastCrash       *time.Time      `json:"last_crash"`
 	PID             int             `json:"pid" gorm:"default:0"`
+	EULAAcceptedBy  *uuid.UUID      `json:"eula_accepted_by" gorm:"type:uuid"`
+	EULAAcceptedAt  *time.Time      `json:"eula_accepted_at"`
 	CreatedAt       time.Time       `json:"created_at"`
 	UpdatedAt       time.Time       `json:"updated_at"`
 	DeletedAt       gorm.DeletedAt  `json:"-" gorm:"index"`
@@ -101,6 +140,7 @@ type ServerType string
 const (
 	ServerTypeMinecraft  ServerType = "minecraft"
 	ServerTypePaper      ServerType = "paper"
+	ServerTypePurpur     ServerType = "purpur"
 	ServerTypeSpigot     ServerType = "spigot"
 	ServerTypeFabric     ServerType = "fabric"
 	ServerTypeForge      ServerType = "forge"
@@ -110,6 +150,16 @@ const (
 	ServerTypeOther      ServerType = "other"
 )
 
+// Valid reports whether the type is one of the known server types
+func (t ServerType) Valid() bool {
+	switch t {
+	case ServerTypeMinecraft, ServerTypePaper, ServerTypePurpur, ServerTypeSpigot, ServerTypeFabric,
+		ServerTypeForge, ServerTypeVanilla, ServerTypeBedrock, ServerTypeProxy, ServerTypeOther:
+		return true
+	}
+	return false
+}
+
 type ServerStatus string
 
 const (
@@ -118,9 +168,54 @@ const (
 	ServerStatusRunning  ServerStatus = "running"
 	ServerStatusStopping ServerStatus = "stopping"
 	ServerStatusCrashed  ServerStatus = "crashed"
+	// Stopped for having no players; starts again when a player connects
+	ServerStatusHibernating ServerStatus = "hibernating"
 	ServerStatusUnknown  ServerStatus = "unknown"
 )
 
+// UserServer is the user_servers join between users and the servers they
+// can access, with the user's role on the server
+type UserServer struct {
+	UserID   uuid.UUID  `json:"user_id" gorm:"type:uuid;primaryKey"`
+	ServerID uuid.UUID  `json:"server_id" gorm:"type:uuid;primaryKey"`
+	Role     ServerRole `json:"role" gorm:"not null;default:'member'"`
+	// What a member may do; owners may do everything
+	Permissions []ServerPermission `json:"permissions" gorm:"serializer:json"`
+	CreatedAt   time.Time          `json:"created_at"`
+}
+
+type ServerRole string
+
+const (
+	ServerRoleOwner  ServerRole = "owner"  // can grant and revoke access and transfer ownership
+	ServerRoleMember ServerRole = "member"
+)
+
+// ServerPermission is something a server member may be allowed to do.
+// Viewing the server, its stats and players needs no permission.
+type ServerPermission string
+
+const (
+	ServerPermissionConsole   ServerPermission = "console"   // logs, commands and player actions
+	ServerPermissionPower     ServerPermission = "power"     // start, stop and restart
+	ServerPermissionFiles     ServerPermission = "files"     // file manager, SFTP and world import
+	ServerPermissionBackups   ServerPermission = "backups"
+	ServerPermissionPlugins   ServerPermission = "plugins"
+	ServerPermissionSchedules ServerPermission = "schedules"
+	ServerPermissionSettings  ServerPermission = "settings" // server settings and server.properties
+)
+
+// ServerPermissions lists every server permission
+var ServerPermissions = []ServerPermission{
+	ServerPermissionConsole,
+	ServerPermissionPower,
+	ServerPermissionFiles,
+	ServerPermissionBackups,
+	ServerPermissionPlugins,
+	ServerPermissionSchedules,
+	ServerPermissionSettings,
+}
+
 // Plugin represents installed plugins/mods
 type Plugin struct {
 	ID           uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
@@ -138,6 +233,19 @@ type Plugin struct {
 	Dependencies []string       `json:"dependencies" gorm:"type:text[]"`
 	InstallDate  time.Time      `json:"install_date"`
 	UpdateDate   *time.Time     `json:"update_date"`
+
+	// Update check results, refreshed by the plugin updater
+	UpdateAvailable   bool       `json:"update_available" gorm:"default:false"`
+	LatestVersion     string     `json:"latest_version"`
+	LatestFileName    string     `json:"-"`
+	LatestDownloadURL string     `json:"-"`
+	LastUpdateCheck   *time.Time `json:"last_update_check"`
+
+	// Marketplace version the installed file came from; a pinned plugin is
+	// left out of update checks
+	ItemVersionID *uuid.UUID `json:"item_version_id" gorm:"type:uuid"`
+	Pinned        bool       `json:"pinned" gorm:"default:false"`
+
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
@@ -148,12 +256,115 @@ type Plugin struct {
 type PluginSource string
 
 const (
-	PluginSourceCurseForge PluginSource = "curseforge"
-	PluginSourceModrinth   PluginSource = "modrinth"
-	PluginSourceManual     PluginSource = "manual"
-	PluginSourceGitHub     PluginSource = "github"
+	PluginSourceCurseForge  PluginSource = "curseforge"
+	PluginSourceModrinth    PluginSource = "modrinth"
+	PluginSourceManual      PluginSource = "manual"
+	PluginSourceGitHub      PluginSource = "github"
+	PluginSourceMarketplace PluginSource = "marketplace"
+)
+
+// MarketplaceVersion is the part of a marketplace item version the panel
+// needs to install it. The marketplace owns the item_versions table and adds
+// its own columns; the panel migrates these so installs and rollbacks work
+// before the marketplace has run.
+type MarketplaceVersion struct {
+	ID                uuid.UUID               `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ItemID            uuid.UUID               `json:"item_id" gorm:"type:uuid;not null"`
+	Version           string                  `json:"version" gorm:"not null"`
+	MinecraftVersions []string                `json:"minecraft_versions" gorm:"type:json;serializer:json"`
+	ServerTypes       []string                `json:"server_types" gorm:"type:json;serializer:json"`
+	DownloadURL       string                  `json:"-"`
+	FileHash          string                  `json:"file_hash"` // hex SHA-256
+	SecurityScan      MarketplaceSecurityScan `json:"security_scan" gorm:"type:json;serializer:json"`
+	Status            string                  `json:"status" gorm:"default:'pending'"`
+	CreatedAt         time.Time               `json:"created_at"`
+}
+
+func (MarketplaceVersion) TableName() string {
+	return "item_versions"
+}
+
+// MarketplaceSecurityScan is the outcome of the marketplace's scan of a version
+type MarketplaceSecurityScan struct {
+	OverallScore float64 `json:"overall_score"`
+	SafetyRating string  `json:"safety_rating"`
+}
+
+// ServerTemplate is an admin-defined preset used to provision fully
+// configured servers in one call
+type ServerTemplate struct {
+	ID             uuid.UUID         `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Name           string            `json:"name" gorm:"uniqueIndex;not null"`
+	Description    string            `json:"description"`
+	Type           ServerType        `json:"type" gorm:"not null"`
+	Version        string            `json:"version"`
+	MemoryLimit    int64             `json:"memory_limit"` // recommended, in MB
+	DiskLimit      int64             `json:"disk_limit"`   // in MB
+	CPULimit       float64           `json:"cpu_limit"`    // percentage
+	JavaArgs       string            `json:"java_args"`
+	PortRangeStart int               `json:"port_range_start"` // 0 uses the global range
+	PortRangeEnd   int               `json:"port_range_end"`
+	Plugins        []TemplatePlugin  `json:"plugins" gorm:"serializer:json"`
+	Properties     map[string]string `json:"properties" gorm:"serializer:json"` // server.properties overrides
+	CreatedBy      uuid.UUID         `json:"created_by" gorm:"type:uuid"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt    `json:"-" gorm:"index"`
+}
+
+// TemplatePlugin is a plugin installed on servers provisioned from a template
+type TemplatePlugin struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	DownloadURL string `json:"download_url"`
+}
+
+// SFTPKey is a public key a user can log in to the SFTP server with. A key
+// bound to a server only grants access to that server.
+type SFTPKey struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID      uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	ServerID    *uuid.UUID `json:"server_id" gorm:"type:uuid"`
+	Name        string     `json:"name" gorm:"not null"`
+	PublicKey   string     `json:"public_key" gorm:"not null"`
+	Fingerprint string     `json:"fingerprint" gorm:"uniqueIndex;not null"`
+	LastUsed    *time.Time `json:"last_used"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// APIKey is a scoped key for programmatic access. Only the SHA-256 hash of
+// the key is stored; Prefix identifies the key in listings.
+type APIKey struct {
+	ID        uuid.UUID   `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID   `json:"user_id" gorm:"type:uuid;not null;index"`
+	Name      string      `json:"name" gorm:"not null"`
+	Prefix    string      `json:"prefix"`
+	KeyHash   string      `json:"-" gorm:"uniqueIndex;not null"`
+	Scope     APIKeyScope `json:"scope" gorm:"not null"`
+	ExpiresAt *time.Time  `json:"expires_at"`
+	LastUsed  *time.Time  `json:"last_used"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// APIKeyScope limits what an API key may do. Each scope includes the ones before it.
+type APIKeyScope string
+
+const (
+	APIKeyScopeRead          APIKeyScope = "read"           // GET requests only
+	APIKeyScopeServerControl APIKeyScope = "server-control" // read plus server actions
+	APIKeyScopeAdmin         APIKeyScope = "admin"          // everything the user can do
 )
 
+// Allows reports whether the scope includes required
+func (s APIKeyScope) Allows(required APIKeyScope) bool {
+	rank := map[APIKeyScope]int{
+		APIKeyScopeRead:          1,
+		APIKeyScopeServerControl: 2,
+		APIKeyScopeAdmin:         3,
+	}
+	return rank[s] > 0 && rank[s] >= rank[required]
+}
+
 // Schedule represents scheduled tasks
 type Schedule struct {
 	ID          uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
@@ -162,14 +373,17 @@ type Schedule struct {
 	Action      ScheduleAction `json:"action" gorm:"not null"`
 	Command     string         `json:"command"`
 	CronPattern string         `json:"cron_pattern" gorm:"not null"`
-	IsActive    bool           `json:"is_active" gorm:"default:true"`
-	LastRun     *time.Time     `json:"last_run"`
-	NextRun     *time.Time     `json:"next_run"`
-	RunCount    int            `json:"run_count" gorm:"default:0"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
-	
+	// RestartWarnings lists when players are warned before a scheduled
+	// restart, e.g. "5m,1m,10s". Empty uses the default; "none" disables them.
+	RestartWarnings string         `json:"restart_warnings"`
+	IsActive        bool           `json:"is_active" gorm:"default:true"`
+	LastRun         *time.Time     `json:"last_run"`
+	NextRun         *time.Time     `json:"next_run"`
+	RunCount        int            `json:"run_count" gorm:"default:0"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+
 	Server Server `json:"server,omitempty"`
 }
 
@@ -191,6 +405,15 @@ type Backup struct {
 	Description string       `json:"description"`
 	Path        string       `json:"path" gorm:"not null"`
 	Size        int64        `json:"size"`
+	Checksum    string       `json:"checksum"` // SHA-256 of the archive
+	VerifiedAt  *time.Time   `json:"verified_at"`
+	EncryptionKeyID string   `json:"encryption_key_id,omitempty"` // key the archive is encrypted with; empty when it isn't
+	// Partial backups were taken with the server's include or exclude
+	// patterns, kept here as they were; restoring one only replaces the
+	// files they select
+	Partial     bool         `json:"partial"`
+	Include     []string     `json:"include,omitempty" gorm:"serializer:json"`
+	Exclude     []string     `json:"exclude,omitempty" gorm:"serializer:json"`
 	Type        BackupType   `json:"type"`
 	Status      BackupStatus `json:"status"`
 	CreatedAt   time.Time    `json:"created_at"`
@@ -202,14 +425,17 @@ type Backup struct {
 type BackupType string
 
 const (
-	BackupTypeManual    BackupType = "manual"
-	BackupTypeScheduled BackupType = "scheduled"
-	BackupTypeAutomatic BackupType = "automatic"
+	BackupTypeManual     BackupType = "manual"
+	BackupTypeScheduled  BackupType = "scheduled"
+	BackupTypeAutomatic  BackupType = "automatic"
+	BackupTypePreRestore BackupType = "pre_restore"
+	BackupTypePreImport  BackupType = "pre_import"
 )
 
 type BackupStatus string
 
 const (
+	BackupStatusQueued    BackupStatus = "queued" // waiting for a free backup worker
 	BackupStatusCreating  BackupStatus = "creating"
 	BackupStatusCompleted BackupStatus = "completed"
 	BackupStatusFailed    BackupStatus = "failed"
@@ -265,12 +491,26 @@ type AuditLog struct {
 	Details   string    `json:"details"`
 	IPAddress string    `json:"ip_address"`
 	UserAgent string    `json:"user_agent"`
+	RequestID string    `json:"request_id" gorm:"index"`
 	CreatedAt time.Time `json:"created_at"`
 	
 	User   User    `json:"user,omitempty"`
 	Server *Server `json:"server,omitempty"`
 }
 
+// UserIdentity links a user to an account at an external login provider
+type UserIdentity struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	Provider  string    `json:"provider" gorm:"not null;uniqueIndex:idx_user_identity_subject"`
+	Subject   string    `json:"subject" gorm:"not null;uniqueIndex:idx_user_identity_subject"` // the provider's user ID
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	User User `json:"-"`
+}
+
 // SystemSetting represents system-wide settings
 type SystemSetting struct {
 	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
@@ -282,6 +522,47 @@ type SystemSetting struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// CommandHistory records a console command a user sent to a server.
+// Commands that look like they carry credentials are stored redacted.
+type CommandHistory struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ServerID  uuid.UUID `json:"server_id" gorm:"type:uuid;not null;index:idx_command_history_server_user"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index:idx_command_history_server_user"`
+	Command   string    `json:"command" gorm:"not null"`
+	Redacted  bool      `json:"redacted" gorm:"default:false"`
+	Source    string    `json:"source"` // api, websocket or replay
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CrashReport is what was captured when a server crashed: the crash report
+// the server wrote, if any, and the tail of its console
+type CrashReport struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ServerID    uuid.UUID `json:"server_id" gorm:"type:uuid;not null;index"`
+	FileName    string    `json:"file_name"` // in crash-reports/, empty without a report
+	Report      string    `json:"report,omitempty"`
+	ConsoleTail string    `json:"console_tail,omitempty"`
+	ExitError   string    `json:"exit_error"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// IdempotencyKey records a request made with an Idempotency-Key header and
+// the response it got, so a retry with the same key is answered with that
+// response instead of being run again. Keys are scoped to the user and the
+// action. Completed is false while the first request is still running.
+type IdempotencyKey struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID      uuid.UUID `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_idempotency_key"`
+	Scope       string    `json:"scope" gorm:"not null;uniqueIndex:idx_idempotency_key"`
+	Key         string    `json:"key" gorm:"not null;uniqueIndex:idx_idempotency_key"`
+	RequestHash string    `json:"-" gorm:"not null"`
+	Completed   bool      `json:"completed" gorm:"default:false"`
+	StatusCode  int       `json:"status_code"`
+	Response    []byte    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" gorm:"index"`
+}
+
 // Notification represents system notifications
 type Notification struct {
 	ID        uuid.UUID          `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
@@ -292,6 +573,7 @@ type Notification struct {
 	Type      NotificationType   `json:"type" gorm:"not null"`
 	Priority  NotificationPriority `json:"priority" gorm:"default:'medium'"`
 	IsRead    bool               `json:"is_read" gorm:"default:false"`
+	CrashReportID *uuid.UUID     `json:"crash_report_id" gorm:"type:uuid"` // set on crash notifications
 	CreatedAt time.Time          `json:"created_at"`
 	ReadAt    *time.Time         `json:"read_at"`
 	
@@ -321,9 +603,6 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	if u.ID == uuid.Nil {
 		u.ID = uuid.New()
 	}
-	if u.APIKey == "" {
-		u.APIKey = uuid.New().String()
-	}
 	return nil
 }
 
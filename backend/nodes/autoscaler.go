@@ -0,0 +1,375 @@
+package nodes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AutoScalerConfig controls when the cluster is scaled. Usage is averaged
+// over EvaluationWindow rather than taken from a single reading, and when
+// PredictionHorizon is set the autoscaler also scales up for the usage it
+// expects at the end of the horizon, from the usage trend and the demand
+// forecaster.
+type AutoScalerConfig struct {
+	Enabled      bool
+	MinNodes     int
+	MaxNodes     int
+	TargetCPU    float64 // percent
+	TargetMemory float64 // percent
+	// ScaleDownRatio is the fraction of the targets usage has to fall under
+	// before the cluster is scaled down
+	ScaleDownRatio    float64
+	EvaluationWindow  time.Duration
+	PredictionHorizon time.Duration // 0 turns prediction off
+	ScaleUpCooldown   time.Duration
+	ScaleDownCooldown time.Duration
+	// DryRun logs and publishes decisions without acting on them
+	DryRun bool
+}
+
+// DefaultAutoScalerConfig is the configuration a node manager starts with
+var DefaultAutoScalerConfig = AutoScalerConfig{
+	Enabled:           true,
+	MinNodes:          2,
+	MaxNodes:          50,
+	TargetCPU:         70.0,
+	TargetMemory:      80.0,
+	ScaleDownRatio:    0.5,
+	EvaluationWindow:  10 * time.Minute,
+	PredictionHorizon: 30 * time.Minute,
+	ScaleUpCooldown:   5 * time.Minute,
+	ScaleDownCooldown: 10 * time.Minute,
+}
+
+// DemandForecaster predicts how many players the cluster will have. By
+// default the analytics engine's hourly model is run over the node metrics.
+type DemandForecaster interface {
+	PredictPlayers(ctx context.Context, horizon time.Duration) (float64, error)
+}
+
+// ScalingAction is what the autoscaler decided to do
+type ScalingAction string
+
+const (
+	ScaleNone ScalingAction = "none"
+	ScaleUp   ScalingAction = "scale_up"
+	ScaleDown ScalingAction = "scale_down"
+)
+
+// ScalingDecision is the outcome of one autoscaler evaluation
+type ScalingDecision struct {
+	Action          ScalingAction `json:"action"`
+	Reason          string        `json:"reason"`
+	NodeCount       int           `json:"node_count"`
+	AvgCPU          float64       `json:"avg_cpu"`
+	AvgMemory       float64       `json:"avg_memory"`
+	ProjectedCPU    float64       `json:"projected_cpu"`
+	ProjectedMemory float64       `json:"projected_memory"`
+	// Predicted is set when only the projection is over the targets, so the
+	// cluster is scaled ahead of demand
+	Predicted bool `json:"predicted"`
+	DryRun    bool `json:"dry_run"`
+}
+
+// AutoScaler handles automatic scaling
+type AutoScaler struct {
+	db     *gorm.DB
+	events *eventHub
+
+	mutex         sync.Mutex
+	config        AutoScalerConfig
+	forecaster    DemandForecaster
+	lastScaleUp   time.Time
+	lastScaleDown time.Time
+}
+
+func newAutoScaler(db *gorm.DB, events *eventHub) *AutoScaler {
+	return &AutoScaler{
+		db:     db,
+		events: events,
+		config: DefaultAutoScalerConfig,
+	}
+}
+
+// SetAutoScalerConfig replaces the autoscaler's configuration; it applies
+// from the next evaluation
+func (nm *NodeManager) SetAutoScalerConfig(config AutoScalerConfig) error {
+	if config.MinNodes < 0 || config.MaxNodes < config.MinNodes {
+		return fmt.Errorf("invalid node limits: min %d, max %d", config.MinNodes, config.MaxNodes)
+	}
+	if config.TargetCPU <= 0 || config.TargetCPU > 100 || config.TargetMemory <= 0 || config.TargetMemory > 100 {
+		return fmt.Errorf("targets must be between 0 and 100 percent")
+	}
+	if config.ScaleDownRatio <= 0 || config.ScaleDownRatio >= 1 {
+		return fmt.Errorf("scale down ratio must be between 0 and 1")
+	}
+	if config.EvaluationWindow <= 0 {
+		return fmt.Errorf("evaluation window must be positive")
+	}
+
+	nm.autoScaler.mutex.Lock()
+	defer nm.autoScaler.mutex.Unlock()
+
+	nm.autoScaler.config = config
+	return nil
+}
+
+// SetDemandForecaster sets where the autoscaler gets player predictions
+// from; with nil it predicts from the usage trend alone
+func (nm *NodeManager) SetDemandForecaster(forecaster DemandForecaster) {
+	nm.autoScaler.mutex.Lock()
+	defer nm.autoScaler.mutex.Unlock()
+
+	nm.autoScaler.forecaster = forecaster
+}
+
+func (as *AutoScaler) Start() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		as.evaluateScaling()
+	}
+}
+
+func (as *AutoScaler) evaluateScaling() {
+	as.mutex.Lock()
+	enabled := as.config.Enabled
+	as.mutex.Unlock()
+	if !enabled {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	decision, err := as.decide(ctx, time.Now())
+	if err != nil {
+		log.Printf("Auto-scaling: evaluation failed: %v", err)
+		return
+	}
+	as.apply(decision, time.Now())
+}
+
+// decide works out whether the cluster should scale from the online nodes'
+// metrics over the evaluation window
+func (as *AutoScaler) decide(ctx context.Context, now time.Time) (ScalingDecision, error) {
+	as.mutex.Lock()
+	config := as.config
+	forecaster := as.forecaster
+	lastScaleUp, lastScaleDown := as.lastScaleUp, as.lastScaleDown
+	as.mutex.Unlock()
+
+	var nodes []Node
+	if err := as.db.WithContext(ctx).Where("status = ?", NodeStatusOnline).Find(&nodes).Error; err != nil {
+		return ScalingDecision{}, err
+	}
+	decision := ScalingDecision{Action: ScaleNone, NodeCount: len(nodes), DryRun: config.DryRun}
+	if len(nodes) == 0 {
+		return decision, nil
+	}
+
+	nodeIDs := make([]string, len(nodes))
+	for i, node := range nodes {
+		nodeIDs[i] = node.ID
+	}
+	var samples []NodeMetric
+	if err := as.db.WithContext(ctx).
+		Where("node_id IN ? AND timestamp > ?", nodeIDs, now.Add(-config.EvaluationWindow)).
+		Order("timestamp").
+		Find(&samples).Error; err != nil {
+		return ScalingDecision{}, err
+	}
+
+	cpu := make([]trendPoint, 0, len(samples))
+	memory := make([]trendPoint, 0, len(samples))
+	for _, sample := range samples {
+		offset := sample.Timestamp.Sub(now).Seconds()
+		cpu = append(cpu, trendPoint{offset, sample.CPUUsage})
+		memory = append(memory, trendPoint{offset, sample.MemoryUsage})
+	}
+	// Without samples in the window, fall back to the latest readings
+	if len(samples) == 0 {
+		for _, node := range nodes {
+			cpu = append(cpu, trendPoint{0, node.Resources.CPU.UsagePercent})
+			memory = append(memory, trendPoint{0, node.Resources.Memory.UsagePercent})
+		}
+	}
+
+	decision.AvgCPU = averageOf(cpu)
+	decision.AvgMemory = averageOf(memory)
+	decision.ProjectedCPU = decision.AvgCPU
+	decision.ProjectedMemory = decision.AvgMemory
+
+	if config.PredictionHorizon > 0 {
+		horizon := config.PredictionHorizon.Seconds()
+		decision.ProjectedCPU = maxFloat(decision.ProjectedCPU, projectTrend(cpu, horizon))
+		decision.ProjectedMemory = maxFloat(decision.ProjectedMemory, projectTrend(memory, horizon))
+
+		// Usage is taken to grow with players, so a predicted spike in
+		// players scales the current usage up by the same factor
+		if forecaster != nil {
+			if current := currentPlayers(samples); current > 0 {
+				predicted, err := forecaster.PredictPlayers(ctx, config.PredictionHorizon)
+				if err != nil {
+					log.Printf("Auto-scaling: player prediction failed: %v", err)
+				} else if growth := predicted / current; growth > 1 {
+					decision.ProjectedCPU = maxFloat(decision.ProjectedCPU, decision.AvgCPU*growth)
+					decision.ProjectedMemory = maxFloat(decision.ProjectedMemory, decision.AvgMemory*growth)
+				}
+			}
+		}
+	}
+
+	overNow := decision.AvgCPU > config.TargetCPU || decision.AvgMemory > config.TargetMemory
+	overProjected := decision.ProjectedCPU > config.TargetCPU || decision.ProjectedMemory > config.TargetMemory
+	underCPU := config.TargetCPU * config.ScaleDownRatio
+	underMemory := config.TargetMemory * config.ScaleDownRatio
+
+	switch {
+	case (overNow || overProjected) && len(nodes) < config.MaxNodes:
+		if now.Sub(lastScaleUp) < config.ScaleUpCooldown {
+			decision.Reason = "scale up cooling down"
+			break
+		}
+		decision.Action = ScaleUp
+		decision.Predicted = !overNow
+		if decision.Predicted {
+			decision.Reason = fmt.Sprintf("projected usage (CPU %.1f%%, memory %.1f%%) exceeds targets within %s",
+				decision.ProjectedCPU, decision.ProjectedMemory, config.PredictionHorizon)
+		} else {
+			decision.Reason = fmt.Sprintf("usage (CPU %.1f%%, memory %.1f%%) exceeds targets (CPU %.0f%%, memory %.0f%%)",
+				decision.AvgCPU, decision.AvgMemory, config.TargetCPU, config.TargetMemory)
+		}
+	case decision.ProjectedCPU < underCPU && decision.ProjectedMemory < underMemory && len(nodes) > config.MinNodes:
+		if now.Sub(lastScaleDown) < config.ScaleDownCooldown || now.Sub(lastScaleUp) < config.ScaleDownCooldown {
+			decision.Reason = "scale down cooling down"
+			break
+		}
+		decision.Action = ScaleDown
+		decision.Reason = fmt.Sprintf("usage (CPU %.1f%%, memory %.1f%%) is under %.0f%% of targets",
+			decision.AvgCPU, decision.AvgMemory, config.ScaleDownRatio*100)
+	}
+
+	return decision, nil
+}
+
+// apply carries out a decision, or only reports it in dry-run mode.
+// Cooldowns start either way so a dry run reports what would really happen.
+func (as *AutoScaler) apply(decision ScalingDecision, now time.Time) {
+	if decision.Action == ScaleNone {
+		return
+	}
+
+	as.mutex.Lock()
+	if decision.Action == ScaleUp {
+		as.lastScaleUp = now
+	} else {
+		as.lastScaleDown = now
+	}
+	as.mutex.Unlock()
+
+	eventType := EventScaleUp
+	if decision.Action == ScaleDown {
+		eventType = EventScaleDown
+	}
+	as.events.publish(ClusterEvent{
+		Type: eventType,
+		Data: map[string]interface{}{
+			"reason":           decision.Reason,
+			"node_count":       decision.NodeCount,
+			"avg_cpu":          decision.AvgCPU,
+			"avg_memory":       decision.AvgMemory,
+			"projected_cpu":    decision.ProjectedCPU,
+			"projected_memory": decision.ProjectedMemory,
+			"predicted":        decision.Predicted,
+			"dry_run":          decision.DryRun,
+		},
+	})
+
+	if decision.DryRun {
+		log.Printf("Auto-scaling (dry run): would %s: %s", decision.Action, decision.Reason)
+		return
+	}
+
+	if decision.Action == ScaleUp {
+		as.scaleUp()
+	} else {
+		as.scaleDown()
+	}
+}
+
+func (as *AutoScaler) scaleUp() {
+	log.Println("Auto-scaling: Scaling up cluster")
+	// Implementation would provision new nodes
+}
+
+func (as *AutoScaler) scaleDown() {
+	log.Println("Auto-scaling: Scaling down cluster")
+	// Implementation would drain and remove nodes
+}
+
+// trendPoint is a reading at an offset in seconds from now
+type trendPoint struct {
+	offset float64
+	value  float64
+}
+
+func averageOf(points []trendPoint) float64 {
+	if len(points) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, point := range points {
+		sum += point.value
+	}
+	return sum / float64(len(points))
+}
+
+// projectTrend fits a line through the points and returns its value at the
+// horizon. With too little spread to fit, it returns the average.
+func projectTrend(points []trendPoint, horizon float64) float64 {
+	n := float64(len(points))
+	var sumX, sumY, sumXY, sumXX float64
+	for _, point := range points {
+		sumX += point.offset
+		sumY += point.value
+		sumXY += point.offset * point.value
+		sumXX += point.offset * point.offset
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	if n < 2 || denominator == 0 {
+		return averageOf(points)
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	intercept := (sumY - slope*sumX) / n
+	return intercept + slope*horizon
+}
+
+// currentPlayers sums the latest player count of each node in the samples
+func currentPlayers(samples []NodeMetric) float64 {
+	latest := make(map[string]int)
+	for _, sample := range samples {
+		// Samples are in time order, so later ones overwrite earlier ones
+		latest[sample.NodeID] = sample.PlayerCount
+	}
+
+	var total float64
+	for _, players := range latest {
+		total += float64(players)
+	}
+	return total
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
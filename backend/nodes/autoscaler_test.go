@@ -0,0 +1,236 @@
+package nodes
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeForecaster predicts a fixed player count
+type fakeForecaster struct {
+	players float64
+	err     error
+}
+
+func (f fakeForecaster) PredictPlayers(ctx context.Context, horizon time.Duration) (float64, error) {
+	return f.players, f.err
+}
+
+// testScalerConfig scales between one and ten nodes with no cooldowns
+func testScalerConfig() AutoScalerConfig {
+	return AutoScalerConfig{
+		Enabled:           true,
+		MinNodes:          1,
+		MaxNodes:          10,
+		TargetCPU:         70,
+		TargetMemory:      80,
+		ScaleDownRatio:    0.5,
+		EvaluationWindow:  10 * time.Minute,
+		PredictionHorizon: 30 * time.Minute,
+	}
+}
+
+// createScalingNodes saves online nodes that each report cpu and memory
+// usage with players for the last five minutes
+func createScalingNodes(t *testing.T, nm *NodeManager, count int, cpu, memory float64, players int, now time.Time) {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		node := &Node{ID: "node-" + uuid.NewString()[:8], Name: "scaling", IPAddress: "10.0.0.1", Status: NodeStatusOnline, LastSeen: now}
+		if err := nm.db.Create(node).Error; err != nil {
+			t.Fatalf("failed to create node: %v", err)
+		}
+		t.Cleanup(func() {
+			nm.db.Delete(&Node{}, "id = ?", node.ID)
+			nm.db.Where("node_id = ?", node.ID).Delete(&NodeMetric{})
+		})
+
+		for minute := 5; minute > 0; minute-- {
+			sample := NodeMetric{
+				NodeID:      node.ID,
+				Timestamp:   now.Add(-time.Duration(minute) * time.Minute),
+				CPUUsage:    cpu,
+				MemoryUsage: memory,
+				PlayerCount: players,
+			}
+			if err := nm.db.Create(&sample).Error; err != nil {
+				t.Fatalf("failed to seed metrics: %v", err)
+			}
+		}
+	}
+}
+
+// newTestAutoScaler returns nm's autoscaler set up with config
+func newTestAutoScaler(t *testing.T, nm *NodeManager, config AutoScalerConfig) *AutoScaler {
+	t.Helper()
+
+	nm.autoScaler = newAutoScaler(nm.db, nm.events)
+	if err := nm.SetAutoScalerConfig(config); err != nil {
+		t.Fatalf("SetAutoScalerConfig: %v", err)
+	}
+	return nm.autoScaler
+}
+
+func TestProjectTrend(t *testing.T) {
+	// Usage rising by one percent a minute over the last five minutes
+	var rising []trendPoint
+	for minute := -5; minute <= 0; minute++ {
+		rising = append(rising, trendPoint{float64(minute * 60), 50 + float64(minute)})
+	}
+	if got := projectTrend(rising, 30*60); math.Abs(got-80) > 0.001 {
+		t.Errorf("rising trend projects %.2f, want 80", got)
+	}
+
+	// Readings all taken at once have no trend to fit
+	flat := []trendPoint{{0, 40}, {0, 60}}
+	if got := projectTrend(flat, 30*60); got != 50 {
+		t.Errorf("readings without spread project %.2f, want their average", got)
+	}
+	if got := projectTrend(nil, 30*60); got != 0 {
+		t.Errorf("no readings project %.2f, want 0", got)
+	}
+}
+
+func TestSetAutoScalerConfigValidates(t *testing.T) {
+	nm := newTestNodeManager(nil)
+	nm.autoScaler = newAutoScaler(nil, nm.events)
+
+	tests := []struct {
+		name   string
+		modify func(*AutoScalerConfig)
+	}{
+		{"negative minimum", func(c *AutoScalerConfig) { c.MinNodes = -1 }},
+		{"maximum under minimum", func(c *AutoScalerConfig) { c.MinNodes, c.MaxNodes = 5, 4 }},
+		{"zero cpu target", func(c *AutoScalerConfig) { c.TargetCPU = 0 }},
+		{"memory target over 100", func(c *AutoScalerConfig) { c.TargetMemory = 120 }},
+		{"zero scale down ratio", func(c *AutoScalerConfig) { c.ScaleDownRatio = 0 }},
+		{"scale down ratio of one", func(c *AutoScalerConfig) { c.ScaleDownRatio = 1 }},
+		{"no evaluation window", func(c *AutoScalerConfig) { c.EvaluationWindow = 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testScalerConfig()
+			tt.modify(&config)
+			if err := nm.SetAutoScalerConfig(config); err == nil {
+				t.Error("invalid config was accepted")
+			}
+		})
+	}
+
+	if nm.autoScaler.config != DefaultAutoScalerConfig {
+		t.Error("a rejected config replaced the current one")
+	}
+	if err := nm.SetAutoScalerConfig(testScalerConfig()); err != nil {
+		t.Errorf("valid config was rejected: %v", err)
+	}
+}
+
+func TestAutoScalerScalesUpForPredictedSpikeInDryRun(t *testing.T) {
+	nm := newTestNodeManager(testDB(t))
+	now := time.Now()
+	createScalingNodes(t, nm, 2, 40, 50, 20, now)
+
+	config := testScalerConfig()
+	config.DryRun = true
+	config.ScaleUpCooldown = 5 * time.Minute
+	as := newTestAutoScaler(t, nm, config)
+
+	// Without a forecast, steady usage under the targets needs nothing
+	decision, err := as.decide(context.Background(), now)
+	if err != nil {
+		t.Fatalf("decide: %v", err)
+	}
+	if decision.Action != ScaleNone {
+		t.Fatalf("decision without a forecast = %+v, want none", decision)
+	}
+
+	// Twice the players at the horizon takes CPU to 80%, over the target
+	nm.SetDemandForecaster(fakeForecaster{players: 80})
+	decision, err = as.decide(context.Background(), now)
+	if err != nil {
+		t.Fatalf("decide: %v", err)
+	}
+	if decision.Action != ScaleUp || !decision.Predicted || !decision.DryRun {
+		t.Fatalf("decision = %+v, want a predicted dry run scale up", decision)
+	}
+	if decision.AvgCPU != 40 || math.Abs(decision.ProjectedCPU-80) > 0.001 {
+		t.Errorf("CPU = %.1f projected to %.1f, want 40 projected to 80", decision.AvgCPU, decision.ProjectedCPU)
+	}
+
+	events, unsubscribe := nm.SubscribeEvents()
+	defer unsubscribe()
+	as.apply(decision, now)
+
+	event := nextEvent(t, events)
+	if event.Type != EventScaleUp {
+		t.Fatalf("event = %s, want scale_up", event.Type)
+	}
+	if event.Data["dry_run"] != true || event.Data["predicted"] != true {
+		t.Errorf("event data = %v, want dry_run and predicted set", event.Data)
+	}
+
+	// The dry run still starts the cooldown
+	decision, _ = as.decide(context.Background(), now.Add(time.Minute))
+	if decision.Action != ScaleNone || decision.Reason != "scale up cooling down" {
+		t.Errorf("decision during the cooldown = %+v", decision)
+	}
+}
+
+func TestAutoScalerThresholds(t *testing.T) {
+	nm := newTestNodeManager(testDB(t))
+	now := time.Now()
+	createScalingNodes(t, nm, 2, 40, 40, 20, now)
+	config := testScalerConfig()
+
+	tests := []struct {
+		name      string
+		targetCPU float64
+		minNodes  int
+		want      ScalingAction
+	}{
+		{"usage over the target", 30, 1, ScaleUp},
+		{"usage within the targets", 70, 1, ScaleNone},
+		{"usage under the scale down ratio", 100, 1, ScaleDown},
+		{"usage under the scale down ratio at the minimum", 100, 10, ScaleNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.TargetCPU = tt.targetCPU
+			config.TargetMemory = 100
+			config.MinNodes = tt.minNodes
+			as := newTestAutoScaler(t, nm, config)
+
+			decision, err := as.decide(context.Background(), now)
+			if err != nil {
+				t.Fatalf("decide: %v", err)
+			}
+			if decision.Action != tt.want {
+				t.Fatalf("decision = %+v, want %s", decision, tt.want)
+			}
+			if decision.Action == ScaleUp && decision.Predicted {
+				t.Error("scale up for current usage was marked predicted")
+			}
+		})
+	}
+}
+
+func TestAutoScalerIgnoresFailedForecast(t *testing.T) {
+	nm := newTestNodeManager(testDB(t))
+	now := time.Now()
+	createScalingNodes(t, nm, 2, 40, 50, 20, now)
+
+	as := newTestAutoScaler(t, nm, testScalerConfig())
+	nm.SetDemandForecaster(fakeForecaster{err: errors.New("not enough history")})
+
+	decision, err := as.decide(context.Background(), now)
+	if err != nil {
+		t.Fatalf("decide: %v", err)
+	}
+	if decision.Action != ScaleNone || math.Abs(decision.ProjectedCPU-40) > 0.001 {
+		t.Errorf("decision = %+v, want none with usage projected flat", decision)
+	}
+}
@@ -0,0 +1,131 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// deployTimeout is how long DeployServer waits for the agent to report the
+// outcome; deploying includes downloading the server software
+const deployTimeout = 5 * time.Minute
+
+var (
+	// ErrCommandTimeout is returned when a node doesn't reply to a command
+	// in time
+	ErrCommandTimeout = errors.New("node did not reply to the command in time")
+	// ErrNodeDisconnected is returned when a node disconnects before replying
+	// to a command
+	ErrNodeDisconnected = errors.New("node disconnected before replying")
+)
+
+// pendingCommand is a command waiting for its node's reply
+type pendingCommand struct {
+	nodeID string
+	reply  chan nodeMessage
+}
+
+// sendCommandAndWait sends a command to a node and waits for the reply that
+// carries its ID, until the timeout or the context ends
+func (nm *NodeManager) sendCommandAndWait(ctx context.Context, nodeID string, command NodeCommand, timeout time.Duration) (nodeMessage, error) {
+	reply := nm.expectReply(nodeID, command.ID)
+	defer nm.forgetCommand(command.ID)
+
+	if err := nm.sendCommandToNode(nodeID, command); err != nil {
+		return nodeMessage{}, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case msg, ok := <-reply:
+		if !ok {
+			return nodeMessage{}, ErrNodeDisconnected
+		}
+		return msg, nil
+	case <-timer.C:
+		return nodeMessage{}, fmt.Errorf("%w: %s after %s", ErrCommandTimeout, command.Type, timeout)
+	case <-ctx.Done():
+		return nodeMessage{}, ctx.Err()
+	}
+}
+
+// expectReply registers a command so its reply is handed to the returned
+// channel instead of the usual message handling
+func (nm *NodeManager) expectReply(nodeID, commandID string) <-chan nodeMessage {
+	nm.pendingMutex.Lock()
+	defer nm.pendingMutex.Unlock()
+
+	reply := make(chan nodeMessage, 1)
+	nm.pending[commandID] = &pendingCommand{nodeID: nodeID, reply: reply}
+	return reply
+}
+
+func (nm *NodeManager) forgetCommand(commandID string) {
+	nm.pendingMutex.Lock()
+	defer nm.pendingMutex.Unlock()
+
+	delete(nm.pending, commandID)
+}
+
+// resolveCommand hands a reply to the command waiting for it. It returns
+// false if nothing is waiting, such as for a reply that came after the
+// timeout or from a node the command wasn't sent to.
+func (nm *NodeManager) resolveCommand(nodeID string, msg nodeMessage) bool {
+	nm.pendingMutex.Lock()
+	defer nm.pendingMutex.Unlock()
+
+	pending, exists := nm.pending[msg.CommandID]
+	if !exists || pending.nodeID != nodeID {
+		return false
+	}
+	delete(nm.pending, msg.CommandID)
+	pending.reply <- msg
+	return true
+}
+
+// failPendingCommands ends the waits on a node's commands, for when it
+// disconnects and can no longer reply
+func (nm *NodeManager) failPendingCommands(nodeID string) {
+	nm.pendingMutex.Lock()
+	defer nm.pendingMutex.Unlock()
+
+	for id, pending := range nm.pending {
+		if pending.nodeID == nodeID {
+			delete(nm.pending, id)
+			close(pending.reply)
+		}
+	}
+}
+
+// deploymentResult turns the agent's reply to deploy_server into a result
+func deploymentResult(request ServerDeploymentRequest, nodeID string, msg nodeMessage) (*DeploymentResult, error) {
+	switch msg.Type {
+	case "server_deployed":
+		var deployed struct {
+			Status string `json:"status"`
+		}
+		if err := json.Unmarshal(msg.Data, &deployed); err != nil {
+			return nil, fmt.Errorf("invalid deployment reply from node %s: %v", nodeID, err)
+		}
+		return &DeploymentResult{
+			ServerID: request.ServerID,
+			NodeID:   nodeID,
+			Status:   deployed.Status,
+		}, nil
+	case "error":
+		var failure struct {
+			Message string `json:"message"`
+			Error   string `json:"error"`
+		}
+		if err := json.Unmarshal(msg.Data, &failure); err != nil {
+			return nil, fmt.Errorf("deployment failed on node %s", nodeID)
+		}
+		return nil, fmt.Errorf("deployment failed on node %s: %s: %s", nodeID, failure.Message, failure.Error)
+	default:
+		return nil, fmt.Errorf("unexpected %s reply to deployment from node %s", msg.Type, nodeID)
+	}
+}
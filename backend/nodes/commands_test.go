@@ -0,0 +1,145 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// connectTestAgent connects a node through the connect endpoint and returns
+// its ID and the agent's side of the connection
+func connectTestAgent(t *testing.T, nm *NodeManager) (string, *websocket.Conn) {
+	t.Helper()
+
+	nm.SetNodeToken("test-secret")
+	nodeID := "node-" + uuid.NewString()[:8]
+	t.Cleanup(func() { nm.db.Delete(&Node{}, "id = ?", nodeID) })
+
+	conn, _, err := dialNode(serveConnect(t, nm), nodeID, nm.NodeToken(nodeID))
+	if err != nil {
+		t.Fatalf("failed to connect the agent: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	sendRegistration(t, conn, agentRegistration{ID: nodeID, Name: "alpha"})
+	waitForNodeStatus(t, nm, nodeID, NodeStatusOnline)
+	return nodeID, conn
+}
+
+// readCommand reads the next command the agent is sent
+func readCommand(t *testing.T, conn *websocket.Conn) NodeCommand {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var command NodeCommand
+	if err := conn.ReadJSON(&command); err != nil {
+		t.Errorf("agent received no command: %v", err)
+	}
+	return command
+}
+
+// reply sends an agent message answering commandID
+func reply(conn *websocket.Conn, messageType, commandID string, data interface{}) error {
+	encoded, _ := json.Marshal(data)
+	return conn.WriteJSON(nodeMessage{Type: messageType, CommandID: commandID, Data: encoded, Timestamp: time.Now()})
+}
+
+func TestDeployServerWaitsForAgentReply(t *testing.T) {
+	nm := newTestNodeManager(testDB(t))
+	nodeID, agent := connectTestAgent(t, nm)
+
+	go func() {
+		command := readCommand(t, agent)
+		if command.Type != "deploy_server" {
+			t.Errorf("command = %s, want deploy_server", command.Type)
+		}
+		// A late reply to some other command is not taken as the result
+		reply(agent, "server_deployed", uuid.NewString(), map[string]string{"status": "stale"})
+		reply(agent, "server_deployed", command.ID, map[string]string{"status": "running"})
+	}()
+
+	result, err := nm.DeployServer(context.Background(), ServerDeploymentRequest{ServerID: "srv-1", ServerType: "minecraft-paper"})
+	if err != nil {
+		t.Fatalf("DeployServer: %v", err)
+	}
+	if result.NodeID != nodeID || result.ServerID != "srv-1" || result.Status != "running" {
+		t.Errorf("result = %+v, want srv-1 running on %s", result, nodeID)
+	}
+}
+
+func TestDeployServerReportsAgentError(t *testing.T) {
+	nm := newTestNodeManager(testDB(t))
+	_, agent := connectTestAgent(t, nm)
+
+	go func() {
+		command := readCommand(t, agent)
+		reply(agent, "error", command.ID, map[string]string{"message": "failed to pull image", "error": "manifest unknown"})
+	}()
+
+	_, err := nm.DeployServer(context.Background(), ServerDeploymentRequest{ServerID: "srv-1", ServerType: "minecraft-paper"})
+	if err == nil || !strings.Contains(err.Error(), "failed to pull image: manifest unknown") {
+		t.Errorf("DeployServer = %v, want the agent's error", err)
+	}
+}
+
+func TestSendCommandAndWaitTimesOut(t *testing.T) {
+	nm := newTestNodeManager(testDB(t))
+	nodeID, agent := connectTestAgent(t, nm)
+
+	command := NodeCommand{ID: uuid.NewString(), Type: "deploy_server"}
+	_, err := nm.sendCommandAndWait(context.Background(), nodeID, command, 100*time.Millisecond)
+	if !errors.Is(err, ErrCommandTimeout) {
+		t.Fatalf("sendCommandAndWait = %v, want ErrCommandTimeout", err)
+	}
+
+	// The command is forgotten, so a reply after the timeout is ignored
+	nm.pendingMutex.Lock()
+	pending := len(nm.pending)
+	nm.pendingMutex.Unlock()
+	if pending != 0 {
+		t.Errorf("%d commands still pending after the timeout", pending)
+	}
+	readCommand(t, agent)
+	if nm.resolveCommand(nodeID, nodeMessage{Type: "server_deployed", CommandID: command.ID}) {
+		t.Error("reply after the timeout was resolved")
+	}
+}
+
+func TestSendCommandAndWaitEndsOnDisconnect(t *testing.T) {
+	nm := newTestNodeManager(testDB(t))
+	nodeID, agent := connectTestAgent(t, nm)
+
+	go func() {
+		readCommand(t, agent)
+		agent.Close()
+	}()
+
+	command := NodeCommand{ID: uuid.NewString(), Type: "deploy_server"}
+	_, err := nm.sendCommandAndWait(context.Background(), nodeID, command, 5*time.Second)
+	if !errors.Is(err, ErrNodeDisconnected) {
+		t.Errorf("sendCommandAndWait = %v, want ErrNodeDisconnected", err)
+	}
+}
+
+func TestResolveCommandChecksNode(t *testing.T) {
+	nm := newTestNodeManager(nil)
+	replies := nm.expectReply("node-a", "cmd-1")
+
+	if nm.resolveCommand("node-b", nodeMessage{Type: "server_deployed", CommandID: "cmd-1"}) {
+		t.Fatal("reply from another node resolved the command")
+	}
+	if !nm.resolveCommand("node-a", nodeMessage{Type: "server_deployed", CommandID: "cmd-1"}) {
+		t.Fatal("reply from the node was not resolved")
+	}
+	if msg := <-replies; msg.Type != "server_deployed" {
+		t.Errorf("reply = %+v", msg)
+	}
+	if nm.resolveCommand("node-a", nodeMessage{Type: "server_deployed", CommandID: "cmd-1"}) {
+		t.Error("a second reply resolved the command again")
+	}
+}
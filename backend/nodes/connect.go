@@ -0,0 +1,422 @@
+package nodes
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+const (
+	// registrationTimeout is how long a node has to send node_registration
+	// after connecting
+	registrationTimeout = 10 * time.Second
+	// pingTimeout bounds writing the ping that times a node's responses
+	pingTimeout = 5 * time.Second
+)
+
+var nodeUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	// Nodes aren't browsers; they authenticate with their token instead
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// nodeMessage is a message from a node agent
+type nodeMessage struct {
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	Timestamp time.Time       `json:"timestamp"`
+	NodeID    string          `json:"node_id"`
+	// CommandID is set on replies to a command
+	CommandID string `json:"command_id,omitempty"`
+}
+
+// agentRegistration is the node_registration payload: the agent describing
+// itself
+type agentRegistration struct {
+	ID           string         `json:"id"`
+	Name         string         `json:"name"`
+	Location     string         `json:"location"`
+	Capabilities []string       `json:"capabilities"`
+	Resources    agentResources `json:"resources"`
+}
+
+// agentResources is how the agent reports resources, which differs from
+// NodeResources in the network fields
+type agentResources struct {
+	CPU     CPUResources    `json:"cpu"`
+	Memory  MemoryResources `json:"memory"`
+	Disk    DiskResources   `json:"disk"`
+	Network struct {
+		BytesReceived int64 `json:"bytes_received"`
+		BytesSent     int64 `json:"bytes_sent"`
+	} `json:"network"`
+}
+
+// agentResourceUpdate is the resource_update payload, which lists the
+// node's servers next to its resources
+type agentResourceUpdate struct {
+	agentResources
+	Servers []NodeServer `json:"servers"`
+}
+
+func (ar agentResources) nodeResources() NodeResources {
+	return NodeResources{
+		CPU:    ar.CPU,
+		Memory: ar.Memory,
+		Disk:   ar.Disk,
+		Network: NetworkResources{
+			BytesIn:  ar.Network.BytesReceived,
+			BytesOut: ar.Network.BytesSent,
+		},
+		Available: true,
+	}
+}
+
+// SetNodeToken sets the secret node tokens are derived from. Each node
+// authenticates with its own token, NodeToken(nodeID), set as the agent's
+// PLAYPULSE_NODE_TOKEN, so a token only admits the node it was issued to.
+// Until the secret is set every node is rejected.
+func (nm *NodeManager) SetNodeToken(secret string) {
+	nm.nodesMutex.Lock()
+	defer nm.nodesMutex.Unlock()
+
+	nm.nodeToken = secret
+}
+
+// SetMetricsInterval sets how often agents report their resources. A change
+// is pushed to the connected nodes as a node_update, and nodes that connect
+// later get it once registered. Zero leaves agents on their own interval.
+func (nm *NodeManager) SetMetricsInterval(interval time.Duration) {
+	nm.nodesMutex.Lock()
+	if interval == nm.metricsInterval {
+		nm.nodesMutex.Unlock()
+		return
+	}
+	nm.metricsInterval = interval
+	var connected []string
+	for _, node := range nm.nodes {
+		if node.Connection != nil {
+			connected = append(connected, node.ID)
+		}
+	}
+	nm.nodesMutex.Unlock()
+
+	for _, nodeID := range connected {
+		nm.pushNodeUpdate(nodeID)
+	}
+}
+
+// pushNodeUpdate sends a node the settings the control plane manages
+func (nm *NodeManager) pushNodeUpdate(nodeID string) {
+	nm.nodesMutex.RLock()
+	interval := nm.metricsInterval
+	nm.nodesMutex.RUnlock()
+
+	if interval <= 0 {
+		return
+	}
+
+	err := nm.sendCommandToNode(nodeID, NodeCommand{
+		ID:   uuid.New().String(),
+		Type: "node_update",
+		Payload: map[string]interface{}{
+			"metrics_interval_seconds": int(interval / time.Second),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to send settings to node %s: %v", nodeID, err)
+	}
+}
+
+// NodeToken returns the token the node with nodeID authenticates with, or ""
+// while no secret is set
+func (nm *NodeManager) NodeToken(nodeID string) string {
+	nm.nodesMutex.RLock()
+	secret := nm.nodeToken
+	nm.nodesMutex.RUnlock()
+
+	if secret == "" || nodeID == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(nodeID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// authenticateNode checks the bearer token a node connected with against the
+// token of the node it claims to be
+func (nm *NodeManager) authenticateNode(r *http.Request, nodeID string) bool {
+	expected := nm.NodeToken(nodeID)
+
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if expected == "" || !found {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// ConnectHandler is the endpoint agents connect to (/api/v1/nodes/connect).
+// It checks the node token, upgrades to a WebSocket, registers the node from
+// its node_registration message (or reloads it if it is already known) and
+// then handles the node's updates until it disconnects.
+func (nm *NodeManager) ConnectHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nodeID := r.Header.Get("Node-ID")
+		if nodeID == "" {
+			utils.WriteHTTPError(w, r, http.StatusBadRequest, "missing Node-ID header")
+			return
+		}
+
+		if !nm.authenticateNode(r, nodeID) {
+			utils.WriteHTTPError(w, r, http.StatusUnauthorized, "invalid node token")
+			return
+		}
+
+		conn, err := nodeUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Printf("Node %s WebSocket upgrade failed: %v", nodeID, err)
+			return
+		}
+
+		node, err := nm.acceptNode(r, conn, nodeID)
+		if err != nil {
+			log.Printf("Node %s failed to register: %v", nodeID, err)
+			conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()))
+			conn.Close()
+			return
+		}
+
+		nm.pushNodeUpdate(node.ID)
+		conn.SetPongHandler(func(payload string) error {
+			nm.recordResponseTime(node, payload)
+			return nil
+		})
+		nm.readNodeMessages(node, conn)
+	}
+}
+
+// acceptNode waits for the node's registration, registers the node if it is
+// new and marks it connected
+func (nm *NodeManager) acceptNode(r *http.Request, conn *websocket.Conn, nodeID string) (*Node, error) {
+	conn.SetReadDeadline(time.Now().Add(registrationTimeout))
+	var msg nodeMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		return nil, fmt.Errorf("no registration received: %v", err)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	if msg.Type != "node_registration" {
+		return nil, fmt.Errorf("expected node_registration, got %s", msg.Type)
+	}
+	var registration agentRegistration
+	if err := json.Unmarshal(msg.Data, &registration); err != nil {
+		return nil, fmt.Errorf("invalid registration: %v", err)
+	}
+	if registration.ID != "" && registration.ID != nodeID {
+		return nil, fmt.Errorf("registration is for node %s", registration.ID)
+	}
+
+	name := registration.Name
+	if name == "" {
+		name = r.Header.Get("Node-Name")
+	}
+	location := registration.Location
+	if location == "" {
+		location = r.Header.Get("Node-Location")
+	}
+	ipAddress, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ipAddress = r.RemoteAddr
+	}
+
+	node, err := nm.loadNode(r.Context(), nodeID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		node = &Node{
+			ID:           nodeID,
+			Name:         name,
+			Location:     location,
+			IPAddress:    ipAddress,
+			Capabilities: registration.Capabilities,
+			Resources:    registration.Resources.nodeResources(),
+			LastSeen:     time.Now(),
+		}
+		if err := nm.RegisterNode(r.Context(), node); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else {
+		// A known node reconnecting; refresh what it may have changed
+		nm.nodesMutex.Lock()
+		node.Name = name
+		node.Location = location
+		node.IPAddress = ipAddress
+		node.Capabilities = registration.Capabilities
+		node.Resources = registration.Resources.nodeResources()
+		nm.nodesMutex.Unlock()
+		nm.db.Model(node).Updates(map[string]interface{}{
+			"name":       name,
+			"location":   location,
+			"ip_address": ipAddress,
+		})
+	}
+
+	if err := nm.ConnectNode(nodeID, conn); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// loadNode returns a node from memory, or from the database into memory if
+// the manager hasn't seen it since starting
+func (nm *NodeManager) loadNode(ctx context.Context, nodeID string) (*Node, error) {
+	nm.nodesMutex.Lock()
+	defer nm.nodesMutex.Unlock()
+
+	if node, exists := nm.nodes[nodeID]; exists {
+		return node, nil
+	}
+
+	var node Node
+	if err := nm.db.WithContext(ctx).Where("id = ?", nodeID).First(&node).Error; err != nil {
+		return nil, err
+	}
+	nm.nodes[node.ID] = &node
+	nm.loadBalancer.nodes[node.ID] = &node
+	return &node, nil
+}
+
+// readNodeMessages handles a connected node's messages until the
+// connection drops, then disconnects the node
+func (nm *NodeManager) readNodeMessages(node *Node, conn *websocket.Conn) {
+	defer func() {
+		// A node that reconnected already has a new connection; leave it be
+		nm.nodesMutex.RLock()
+		current := node.Connection == conn
+		nm.nodesMutex.RUnlock()
+		if current {
+			nm.DisconnectNode(node.ID)
+		} else {
+			conn.Close()
+		}
+	}()
+
+	for {
+		var msg nodeMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("Node %s connection lost: %v", node.ID, err)
+			}
+			return
+		}
+
+		nm.handleNodeMessage(node, msg)
+	}
+}
+
+func (nm *NodeManager) handleNodeMessage(node *Node, msg nodeMessage) {
+	if msg.CommandID != "" && nm.resolveCommand(node.ID, msg) {
+		nm.touchNode(node)
+		return
+	}
+
+	switch msg.Type {
+	case "resource_update":
+		var update agentResourceUpdate
+		if err := json.Unmarshal(msg.Data, &update); err != nil {
+			log.Printf("Invalid resource update from node %s: %v", node.ID, err)
+			return
+		}
+		// Agents that couldn't list their servers leave the last list in place
+		if update.Servers != nil {
+			nm.UpdateNodeServers(node.ID, update.Servers)
+		}
+		nm.recordNodeResources(node, update.nodeResources())
+	case "health_response":
+		var health struct {
+			Resources agentResources `json:"resources"`
+		}
+		if err := json.Unmarshal(msg.Data, &health); err != nil {
+			log.Printf("Invalid health response from node %s: %v", node.ID, err)
+			return
+		}
+		nm.recordNodeResources(node, health.Resources.nodeResources())
+	default:
+		nm.touchNode(node)
+	}
+}
+
+// recordNodeResources stores a node's latest resources and keeps a metric
+// sample for the history and rollups
+func (nm *NodeManager) recordNodeResources(node *Node, resources NodeResources) {
+	now := time.Now()
+
+	nm.nodesMutex.Lock()
+	node.Resources = resources
+	node.LastSeen = now
+	serverCount := len(node.Servers)
+	playerCount := 0
+	for _, server := range node.Servers {
+		playerCount += server.Players
+	}
+	responseTime := node.ResponseTime
+	nm.nodesMutex.Unlock()
+
+	nm.db.Model(node).Update("last_seen", now)
+	nm.db.Create(&NodeMetric{
+		NodeID:       node.ID,
+		Timestamp:    now,
+		CPUUsage:     resources.CPU.UsagePercent,
+		MemoryUsage:  resources.Memory.UsagePercent,
+		DiskUsage:    resources.Disk.UsagePercent,
+		NetworkIn:    resources.Network.BytesIn,
+		NetworkOut:   resources.Network.BytesOut,
+		ServerCount:  serverCount,
+		PlayerCount:  playerCount,
+		ResponseTime: responseTime,
+	})
+}
+
+// recordResponseTime stores the round trip of a ping whose payload is the
+// time it was sent
+func (nm *NodeManager) recordResponseTime(node *Node, payload string) {
+	sent, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return
+	}
+	responseTime := float64(time.Since(time.Unix(0, sent))) / float64(time.Millisecond)
+
+	nm.nodesMutex.Lock()
+	node.ResponseTime = responseTime
+	nm.nodesMutex.Unlock()
+}
+
+// touchNode records that a node was heard from
+func (nm *NodeManager) touchNode(node *Node) {
+	now := time.Now()
+
+	nm.nodesMutex.Lock()
+	node.LastSeen = now
+	nm.nodesMutex.Unlock()
+
+	nm.db.Model(node).Update("last_seen", now)
+}
@@ -0,0 +1,191 @@
+package nodes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// newTestNodeManager returns a manager on db without the background loops
+// NewNodeManager starts
+func newTestNodeManager(db *gorm.DB) *NodeManager {
+	nm := &NodeManager{
+		db:           db,
+		events:       newEventHub(),
+		nodes:        make(map[string]*Node),
+		pending:      make(map[string]*pendingCommand),
+		deployKeys:   newDeployKeys(),
+		loadBalancer: &LoadBalancer{strategy: StrategyLeastLoaded, nodes: make(map[string]*Node)},
+	}
+	nm.healthMonitor = newHealthMonitor(nm)
+	return nm
+}
+
+// serveConnect serves nm's connect endpoint and returns its WebSocket URL
+func serveConnect(t *testing.T, nm *NodeManager) string {
+	t.Helper()
+
+	server := httptest.NewServer(nm.ConnectHandler())
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// dialNode connects to the connect endpoint as nodeID with token
+func dialNode(url, nodeID, token string) (*websocket.Conn, *http.Response, error) {
+	header := http.Header{}
+	if nodeID != "" {
+		header.Set("Node-ID", nodeID)
+	}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	header.Set("Node-Name", "header-name")
+	return websocket.DefaultDialer.Dial(url, header)
+}
+
+// sendRegistration sends the node_registration message an agent opens with
+func sendRegistration(t *testing.T, conn *websocket.Conn, registration agentRegistration) {
+	t.Helper()
+
+	data, _ := json.Marshal(registration)
+	if err := conn.WriteJSON(nodeMessage{Type: "node_registration", Data: data, Timestamp: time.Now()}); err != nil {
+		t.Fatalf("failed to send the registration: %v", err)
+	}
+}
+
+// nodeStatus reads a node's status from memory
+func nodeStatus(nm *NodeManager, nodeID string) NodeStatus {
+	nm.nodesMutex.RLock()
+	defer nm.nodesMutex.RUnlock()
+	if node, exists := nm.nodes[nodeID]; exists {
+		return node.Status
+	}
+	return ""
+}
+
+// waitForNodeStatus waits for a node to reach status
+func waitForNodeStatus(t *testing.T, nm *NodeManager, nodeID string, status NodeStatus) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for nodeStatus(nm, nodeID) != status {
+		if time.Now().After(deadline) {
+			t.Fatalf("node %s status = %q, want %q", nodeID, nodeStatus(nm, nodeID), status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConnectRegistersNode(t *testing.T) {
+	db := testDB(t)
+	nm := newTestNodeManager(db)
+	nm.SetNodeToken("test-secret")
+	url := serveConnect(t, nm)
+
+	nodeID := "node-" + uuid.NewString()[:8]
+	t.Cleanup(func() { db.Delete(&Node{}, "id = ?", nodeID) })
+
+	conn, _, err := dialNode(url, nodeID, nm.NodeToken(nodeID))
+	if err != nil {
+		t.Fatalf("valid node was refused: %v", err)
+	}
+	defer conn.Close()
+	sendRegistration(t, conn, agentRegistration{
+		ID:           nodeID,
+		Name:         "alpha",
+		Location:     "eu-west",
+		Capabilities: []string{CapabilityGPU},
+	})
+
+	waitForNodeStatus(t, nm, nodeID, NodeStatusOnline)
+
+	var stored Node
+	if err := db.First(&stored, "id = ?", nodeID).Error; err != nil {
+		t.Fatalf("registered node was not stored: %v", err)
+	}
+	if stored.Name != "alpha" || stored.Location != "eu-west" || stored.IPAddress != "127.0.0.1" {
+		t.Errorf("stored node = %+v, want the registration's name and location and the remote address", stored)
+	}
+	if len(stored.Capabilities) != 1 || stored.Capabilities[0] != CapabilityGPU {
+		t.Errorf("capabilities = %v, want [gpu]", stored.Capabilities)
+	}
+
+	// Dropping the connection takes the node offline
+	conn.Close()
+	waitForNodeStatus(t, nm, nodeID, NodeStatusOffline)
+}
+
+func TestConnectRejectsInvalidToken(t *testing.T) {
+	nm := newTestNodeManager(nil)
+	nm.SetNodeToken("test-secret")
+	url := serveConnect(t, nm)
+
+	other := newTestNodeManager(nil)
+	other.SetNodeToken("another-secret")
+
+	tests := []struct {
+		name   string
+		nodeID string
+		token  string
+		want   int
+	}{
+		{"missing node ID", "", nm.NodeToken("node-a"), http.StatusBadRequest},
+		{"missing token", "node-a", "", http.StatusUnauthorized},
+		{"token of another node", "node-a", nm.NodeToken("node-b"), http.StatusUnauthorized},
+		{"token from another secret", "node-a", other.NodeToken("node-a"), http.StatusUnauthorized},
+		{"made up token", "node-a", "not-a-token", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, resp, err := dialNode(url, tt.nodeID, tt.token)
+			if err == nil {
+				conn.Close()
+				t.Fatal("connection was upgraded")
+			}
+			if resp == nil || resp.StatusCode != tt.want {
+				t.Fatalf("response = %v, want status %d", resp, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnectRejectsEveryNodeWithoutSecret(t *testing.T) {
+	nm := newTestNodeManager(nil)
+	url := serveConnect(t, nm)
+
+	if conn, resp, err := dialNode(url, "node-a", "anything"); err == nil {
+		conn.Close()
+		t.Fatal("node connected with no node token secret set")
+	} else if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("response = %v, want 401", resp)
+	}
+}
+
+func TestConnectRejectsRegistrationForAnotherNode(t *testing.T) {
+	nm := newTestNodeManager(nil)
+	nm.SetNodeToken("test-secret")
+	url := serveConnect(t, nm)
+
+	conn, _, err := dialNode(url, "node-a", nm.NodeToken("node-a"))
+	if err != nil {
+		t.Fatalf("valid node was refused: %v", err)
+	}
+	defer conn.Close()
+	sendRegistration(t, conn, agentRegistration{ID: "node-b", Name: "beta"})
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("read after the registration = %v, want a policy violation close", err)
+	}
+	if status := nodeStatus(nm, "node-b"); status != "" {
+		t.Errorf("node-b was registered with status %q", status)
+	}
+}
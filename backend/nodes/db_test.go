@@ -0,0 +1,16 @@
+package nodes
+
+import (
+	"testing"
+
+	"playpulse-panel/internal/testutil"
+
+	"gorm.io/gorm"
+)
+
+// testDB opens the test database through testutil.OpenDB and migrates the
+// node tables
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return testutil.OpenDB(t, nil, Migrate)
+}
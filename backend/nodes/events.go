@@ -0,0 +1,144 @@
+package nodes
+
+import (
+	"sync"
+	"time"
+)
+
+// ClusterEventType is the kind of a cluster event
+type ClusterEventType string
+
+const (
+	EventNodeRegistered     ClusterEventType = "node_registered"
+	EventNodeOnline         ClusterEventType = "node_online"
+	EventNodeOffline        ClusterEventType = "node_offline"
+	EventNodeFailed         ClusterEventType = "node_failed"
+	EventNodeRecovered      ClusterEventType = "node_recovered"
+	EventNodeQuarantined    ClusterEventType = "node_quarantined"
+	EventDeploymentStarted  ClusterEventType = "deployment_started"
+	EventServerDeployed     ClusterEventType = "server_deployed"
+	EventDeploymentFailed   ClusterEventType = "deployment_failed"
+	EventMigrationStarted   ClusterEventType = "migration_started"
+	EventMigrationCompleted ClusterEventType = "migration_completed"
+	EventMigrationFailed    ClusterEventType = "migration_failed"
+	EventScaleUp            ClusterEventType = "autoscale_up"
+	EventScaleDown          ClusterEventType = "autoscale_down"
+)
+
+// eventBufferSize is how many events a subscriber may fall behind by before
+// further events are dropped for it
+const eventBufferSize = 64
+
+// ClusterEvent is something that happened to a node or a server on one
+type ClusterEvent struct {
+	Type      ClusterEventType       `json:"type"`
+	NodeID    string                 `json:"node_id,omitempty"`
+	ServerID  string                 `json:"server_id,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// eventHub fans cluster events out to subscribers. Publishing never blocks:
+// a subscriber that doesn't keep up misses events rather than holding up
+// the node manager.
+type eventHub struct {
+	mutex       sync.RWMutex
+	subscribers map[chan ClusterEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[chan ClusterEvent]struct{})}
+}
+
+func (eh *eventHub) subscribe() chan ClusterEvent {
+	eh.mutex.Lock()
+	defer eh.mutex.Unlock()
+
+	events := make(chan ClusterEvent, eventBufferSize)
+	eh.subscribers[events] = struct{}{}
+	return events
+}
+
+func (eh *eventHub) unsubscribe(events chan ClusterEvent) {
+	eh.mutex.Lock()
+	defer eh.mutex.Unlock()
+
+	if _, exists := eh.subscribers[events]; exists {
+		delete(eh.subscribers, events)
+		close(events)
+	}
+}
+
+func (eh *eventHub) publish(event ClusterEvent) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	eh.mutex.RLock()
+	defer eh.mutex.RUnlock()
+
+	for events := range eh.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// SubscribeEvents returns a channel of cluster events and a function that
+// ends the subscription
+func (nm *NodeManager) SubscribeEvents() (<-chan ClusterEvent, func()) {
+	events := nm.events.subscribe()
+	return events, func() { nm.events.unsubscribe(events) }
+}
+
+// publishEvent sends a cluster event to the subscribers
+func (nm *NodeManager) publishEvent(eventType ClusterEventType, nodeID, serverID string, data map[string]interface{}) {
+	nm.events.publish(ClusterEvent{
+		Type:     eventType,
+		NodeID:   nodeID,
+		ServerID: serverID,
+		Data:     data,
+	})
+}
+
+// EventConn is the part of a WebSocket connection the event stream uses.
+// The gorilla connections the agents use and the fiber connections the
+// panel's routes use both implement it.
+type EventConn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteJSON(v interface{}) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// StreamEvents streams cluster events over an upgraded WebSocket, one JSON
+// event per message, until the socket closes. Like the other handlers it
+// does no authentication itself and must be mounted behind the panel's
+// admin check.
+func (nm *NodeManager) StreamEvents(conn EventConn) {
+	events, unsubscribe := nm.SubscribeEvents()
+	defer unsubscribe()
+
+	// Subscribers only listen; reading is how a closed socket is noticed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case event := <-events:
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
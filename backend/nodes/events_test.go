@@ -0,0 +1,92 @@
+package nodes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// subscriberCount is how many event subscribers the manager has
+func subscriberCount(nm *NodeManager) int {
+	nm.events.mutex.RLock()
+	defer nm.events.mutex.RUnlock()
+	return len(nm.events.subscribers)
+}
+
+// waitForSubscribers waits until the manager has want event subscribers
+func waitForSubscribers(t *testing.T, nm *NodeManager, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for subscriberCount(nm) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("subscribers = %d, want %d", subscriberCount(nm), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// dialEventStream serves nm's event stream and connects to it
+func dialEventStream(t *testing.T, nm *NodeManager) *websocket.Conn {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		nm.StreamEvents(conn)
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to connect to the event stream: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestEventStreamDeliversNodeDisconnect(t *testing.T) {
+	db := testDB(t)
+	nm := &NodeManager{
+		db:     db,
+		events: newEventHub(),
+		nodes: map[string]*Node{
+			"node-a": {ID: "node-a", Name: "alpha", Status: NodeStatusOnline},
+		},
+	}
+
+	conn := dialEventStream(t, nm)
+	waitForSubscribers(t, nm, 1)
+
+	nm.DisconnectNode("node-a")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var event ClusterEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("no event received: %v", err)
+	}
+	if event.Type != EventNodeOffline || event.NodeID != "node-a" {
+		t.Errorf("event = %+v, want node_offline for node-a", event)
+	}
+	if event.Timestamp.IsZero() {
+		t.Error("event has no timestamp")
+	}
+}
+
+func TestEventStreamUnsubscribesOnClose(t *testing.T) {
+	nm := &NodeManager{events: newEventHub()}
+
+	conn := dialEventStream(t, nm)
+	waitForSubscribers(t, nm, 1)
+
+	conn.Close()
+	waitForSubscribers(t, nm, 0)
+}
@@ -0,0 +1,92 @@
+package nodes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// FleetServer is a server reported by a node, attributed to that node.
+// Stale is set when the node is not online, so the server state is the last
+// one the node reported rather than a live one.
+type FleetServer struct {
+	NodeServer
+	NodeName     string     `json:"node_name"`
+	NodeLocation string     `json:"node_location"`
+	NodeStatus   NodeStatus `json:"node_status"`
+	Stale        bool       `json:"stale"`
+	LastSeen     time.Time  `json:"last_seen"`
+}
+
+// UpdateNodeServers records the servers a node reports running. The list is
+// kept when the node goes offline so the fleet view can show its last state.
+func (nm *NodeManager) UpdateNodeServers(nodeID string, servers []NodeServer) error {
+	nm.nodesMutex.Lock()
+	defer nm.nodesMutex.Unlock()
+
+	node, exists := nm.nodes[nodeID]
+	if !exists {
+		return fmt.Errorf("node %s not found", nodeID)
+	}
+
+	node.Servers = servers
+	node.LastSeen = time.Now()
+	return nil
+}
+
+// ListFleetServers returns the servers of every node in one list, ordered by
+// node and then server name. Servers of nodes that are offline or failed are
+// returned with their last known state and flagged stale.
+func (nm *NodeManager) ListFleetServers() []FleetServer {
+	nm.nodesMutex.RLock()
+	defer nm.nodesMutex.RUnlock()
+
+	fleet := []FleetServer{}
+	for _, node := range nm.nodes {
+		stale := node.Status != NodeStatusOnline
+		for _, server := range node.Servers {
+			// Nodes don't always fill in the node ID on what they report
+			server.NodeID = node.ID
+			fleet = append(fleet, FleetServer{
+				NodeServer:   server,
+				NodeName:     node.Name,
+				NodeLocation: node.Location,
+				NodeStatus:   node.Status,
+				Stale:        stale,
+				LastSeen:     node.LastSeen,
+			})
+		}
+	}
+
+	sort.Slice(fleet, func(i, j int) bool {
+		if fleet[i].NodeName != fleet[j].NodeName {
+			return fleet[i].NodeName < fleet[j].NodeName
+		}
+		return fleet[i].Name < fleet[j].Name
+	})
+
+	return fleet
+}
+
+// FleetServersHandler serves ListFleetServers over HTTP
+func (nm *NodeManager) FleetServersHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		servers := nm.ListFleetServers()
+
+		stale := 0
+		for _, server := range servers {
+			if server.Stale {
+				stale++
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"servers": servers,
+			"total":   len(servers),
+			"stale":   stale,
+		})
+	}
+}
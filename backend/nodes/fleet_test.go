@@ -0,0 +1,97 @@
+package nodes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newFleetManager returns a manager that knows about two nodes, the first
+// online and the second online until the test takes it down
+func newFleetManager() *NodeManager {
+	return &NodeManager{nodes: map[string]*Node{
+		"node-a": {ID: "node-a", Name: "alpha", Location: "eu-west", Status: NodeStatusOnline},
+		"node-b": {ID: "node-b", Name: "beta", Location: "us-east", Status: NodeStatusOnline},
+	}}
+}
+
+func TestListFleetServersMergesNodes(t *testing.T) {
+	nm := newFleetManager()
+
+	// Nodes report without filling in their own ID
+	if err := nm.UpdateNodeServers("node-b", []NodeServer{
+		{ID: "b1", Name: "survival", Status: "running", Players: 12},
+		{ID: "b2", Name: "creative", Status: "stopped"},
+	}); err != nil {
+		t.Fatalf("UpdateNodeServers: %v", err)
+	}
+	if err := nm.UpdateNodeServers("node-a", []NodeServer{
+		{ID: "a1", Name: "lobby", Status: "running", Players: 40},
+	}); err != nil {
+		t.Fatalf("UpdateNodeServers: %v", err)
+	}
+	if err := nm.UpdateNodeServers("node-c", []NodeServer{{ID: "c1"}}); err == nil {
+		t.Error("UpdateNodeServers accepted servers from an unknown node")
+	}
+
+	fleet := nm.ListFleetServers()
+	want := []struct{ id, nodeID, nodeName string }{
+		{"a1", "node-a", "alpha"},
+		{"b2", "node-b", "beta"},
+		{"b1", "node-b", "beta"},
+	}
+	if len(fleet) != len(want) {
+		t.Fatalf("fleet has %d servers, want %d", len(fleet), len(want))
+	}
+	for i, w := range want {
+		server := fleet[i]
+		if server.ID != w.id || server.NodeID != w.nodeID || server.NodeName != w.nodeName {
+			t.Errorf("fleet[%d] = %s on %s (%s), want %s on %s (%s)", i,
+				server.ID, server.NodeID, server.NodeName, w.id, w.nodeID, w.nodeName)
+		}
+		if server.Stale {
+			t.Errorf("%s is stale while its node is online", server.ID)
+		}
+	}
+}
+
+func TestListFleetServersFlagsOfflineNodeStale(t *testing.T) {
+	nm := newFleetManager()
+	nm.UpdateNodeServers("node-a", []NodeServer{{ID: "a1", Name: "lobby", Status: "running"}})
+	nm.UpdateNodeServers("node-b", []NodeServer{{ID: "b1", Name: "survival", Status: "running", Players: 12}})
+
+	// The node drops off; its last report stays
+	nm.nodes["node-b"].Status = NodeStatusOffline
+
+	for _, server := range nm.ListFleetServers() {
+		switch server.ID {
+		case "a1":
+			if server.Stale {
+				t.Error("server on the online node is stale")
+			}
+		case "b1":
+			if !server.Stale || server.NodeStatus != NodeStatusOffline {
+				t.Errorf("server on the offline node = %+v, want it stale", server)
+			}
+			if server.Status != "running" || server.Players != 12 {
+				t.Errorf("server on the offline node = %+v, want its last known state", server)
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	nm.FleetServersHandler()(rec, httptest.NewRequest(http.MethodGet, "/api/fleet/servers", nil))
+
+	var body struct {
+		Servers []FleetServer `json:"servers"`
+		Total   int           `json:"total"`
+		Stale   int           `json:"stale"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if body.Total != 2 || body.Stale != 1 || len(body.Servers) != 2 {
+		t.Errorf("response has %d servers, total %d, stale %d, want 2, 2, 1", len(body.Servers), body.Total, body.Stale)
+	}
+}
@@ -0,0 +1,51 @@
+package nodes
+
+import (
+	"context"
+	"time"
+
+	"playpulse-panel/analytics"
+)
+
+// forecastHistory is how much hourly player history the forecast looks at
+const forecastHistory = 7 * 24 * time.Hour
+
+// playerForecaster predicts the cluster's players from the hourly node
+// metrics with the analytics engine's model
+type playerForecaster struct {
+	nm *NodeManager
+}
+
+// PredictPlayers sums the player counts of every node per hour over the last
+// week and extends the series horizon ahead. Hours without samples count as
+// no players, so a gap in the metrics does not shift the daily pattern.
+func (f *playerForecaster) PredictPlayers(ctx context.Context, horizon time.Duration) (float64, error) {
+	series, err := f.nm.GetAggregatedMetrics(ctx, time.Hour, time.Now().Add(-forecastHistory))
+	if err != nil {
+		return 0, err
+	}
+
+	totals := make(map[time.Time]float64)
+	var first, last time.Time
+	for _, rollups := range series {
+		for _, rollup := range rollups {
+			totals[rollup.Bucket] += rollup.PlayerCount
+			if first.IsZero() || rollup.Bucket.Before(first) {
+				first = rollup.Bucket
+			}
+			if rollup.Bucket.After(last) {
+				last = rollup.Bucket
+			}
+		}
+	}
+	if len(totals) == 0 {
+		return 0, nil
+	}
+
+	var history []float64
+	for bucket := first; !bucket.After(last); bucket = bucket.Add(time.Hour) {
+		history = append(history, totals[bucket])
+	}
+
+	return analytics.ForecastHourly(history, last, horizon), nil
+}
@@ -0,0 +1,267 @@
+package nodes
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// flapWindow and flapThreshold define flapping: a node that changes
+	// status flapThreshold times within flapWindow
+	flapWindow    = 15 * time.Minute
+	flapThreshold = 4
+	// flapQuarantine is how long a flapping node is kept out of the pool
+	// before it may recover again
+	flapQuarantine = 30 * time.Minute
+)
+
+// HealthMonitor checks connected nodes and moves them between online and
+// failed. A node fails after failureThreshold bad checks in a row and
+// recovers after recoveryThreshold good ones; a node that keeps flipping is
+// quarantined and stays failed until flapQuarantine has passed.
+type HealthMonitor struct {
+	manager           *NodeManager
+	checkInterval     time.Duration
+	failureThreshold  int
+	recoveryThreshold int
+
+	mutex  sync.Mutex
+	health map[string]*nodeHealth
+}
+
+// nodeHealth is what the monitor tracks for one node
+type nodeHealth struct {
+	failures         int
+	successes        int
+	transitions      []time.Time
+	quarantinedUntil time.Time
+}
+
+// NodeStatusChange describes a node changing status, for notifications
+type NodeStatusChange struct {
+	Node     *Node
+	Previous NodeStatus
+	Status   NodeStatus
+	Reason   string
+	// Quarantined is set when the node was found flapping and is kept out
+	// of the pool until QuarantinedUntil
+	Quarantined      bool
+	QuarantinedUntil time.Time
+}
+
+func newHealthMonitor(nm *NodeManager) *HealthMonitor {
+	return &HealthMonitor{
+		manager:           nm,
+		checkInterval:     30 * time.Second,
+		failureThreshold:  3,
+		recoveryThreshold: 2,
+		health:            make(map[string]*nodeHealth),
+	}
+}
+
+// Start runs the health checks
+func (hm *HealthMonitor) Start() {
+	ticker := time.NewTicker(hm.checkInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		hm.checkNodeHealth()
+	}
+}
+
+// OnNodeStatusChange registers a handler that is called whenever the health
+// monitor fails, recovers or quarantines a node
+func (nm *NodeManager) OnNodeStatusChange(handler func(change NodeStatusChange)) {
+	nm.nodesMutex.Lock()
+	defer nm.nodesMutex.Unlock()
+
+	nm.statusHandler = handler
+}
+
+func (hm *HealthMonitor) checkNodeHealth() {
+	nm := hm.manager
+	now := time.Now()
+
+	type nodeCheck struct {
+		node    *Node
+		status  NodeStatus
+		healthy bool
+	}
+
+	nm.nodesMutex.RLock()
+	checks := make([]nodeCheck, 0, len(nm.nodes))
+	for _, node := range nm.nodes {
+		// Disconnected nodes are offline, and maintenance and draining are
+		// set by an admin; only connected nodes are judged
+		if node.Status != NodeStatusOnline && node.Status != NodeStatusFailed {
+			continue
+		}
+		checks = append(checks, nodeCheck{
+			node:    node,
+			status:  node.Status,
+			healthy: node.Connection != nil && now.Sub(node.LastSeen) <= hm.checkInterval*2,
+		})
+	}
+	nm.nodesMutex.RUnlock()
+
+	for _, check := range checks {
+		switch hm.record(check.node.ID, check.healthy, check.status, now) {
+		case NodeStatusFailed:
+			hm.setStatus(check.node, NodeStatusOnline, NodeStatusFailed, "node stopped responding to health checks", now)
+		case NodeStatusOnline:
+			hm.setStatus(check.node, NodeStatusFailed, NodeStatusOnline, "node passed health checks again", now)
+		}
+	}
+}
+
+// record counts a check and returns the status the node should move to, or
+// "" to leave it as it is
+func (hm *HealthMonitor) record(nodeID string, healthy bool, status NodeStatus, now time.Time) NodeStatus {
+	hm.mutex.Lock()
+	defer hm.mutex.Unlock()
+
+	health := hm.nodeHealth(nodeID)
+	if healthy {
+		health.failures = 0
+		health.successes++
+	} else {
+		health.successes = 0
+		health.failures++
+	}
+
+	switch status {
+	case NodeStatusOnline:
+		if health.failures >= hm.failureThreshold {
+			return NodeStatusFailed
+		}
+	case NodeStatusFailed:
+		// Checks passed during quarantine don't count towards recovery
+		if now.Before(health.quarantinedUntil) {
+			health.successes = 0
+			return ""
+		}
+		if health.successes >= hm.recoveryThreshold {
+			return NodeStatusOnline
+		}
+	}
+	return ""
+}
+
+// setStatus moves a node to a new status if it is still in the status it was
+// checked in, and notifies about the change
+func (hm *HealthMonitor) setStatus(node *Node, from, to NodeStatus, reason string, now time.Time) {
+	nm := hm.manager
+
+	nm.nodesMutex.Lock()
+	if node.Status != from {
+		// Disconnected or changed by an admin since the check
+		nm.nodesMutex.Unlock()
+		return
+	}
+
+	change := NodeStatusChange{
+		Node:     node,
+		Previous: from,
+		Status:   to,
+		Reason:   reason,
+	}
+	if until, flapping := hm.recordTransition(node.ID, now); flapping {
+		// A flapping node may not rejoin the pool until the quarantine is over
+		change.Status = NodeStatusFailed
+		change.Reason = "node is flapping and has been quarantined"
+		change.Quarantined = true
+		change.QuarantinedUntil = until
+	}
+	node.Status = change.Status
+	handler := nm.statusHandler
+	nm.nodesMutex.Unlock()
+
+	if change.Status != from {
+		nm.db.Model(node).Update("status", change.Status)
+	}
+
+	switch {
+	case change.Quarantined:
+		log.Printf("Node %s is flapping, quarantined until %s", node.ID, change.QuarantinedUntil.Format(time.RFC3339))
+	case change.Status == NodeStatusOnline:
+		log.Printf("Node recovered: %s", node.ID)
+	default:
+		log.Printf("Node marked as unhealthy: %s", node.ID)
+	}
+
+	eventType := EventNodeFailed
+	switch {
+	case change.Quarantined:
+		eventType = EventNodeQuarantined
+	case change.Status == NodeStatusOnline:
+		eventType = EventNodeRecovered
+	}
+	data := map[string]interface{}{
+		"previous": change.Previous,
+		"status":   change.Status,
+		"reason":   change.Reason,
+	}
+	if change.Quarantined {
+		data["quarantined_until"] = change.QuarantinedUntil
+	}
+	nm.publishEvent(eventType, node.ID, "", data)
+
+	if handler != nil {
+		go handler(change)
+	}
+}
+
+// recordTransition notes a status change and quarantines the node if it has
+// changed too often within flapWindow
+func (hm *HealthMonitor) recordTransition(nodeID string, now time.Time) (time.Time, bool) {
+	hm.mutex.Lock()
+	defer hm.mutex.Unlock()
+
+	health := hm.nodeHealth(nodeID)
+	recent := health.transitions[:0]
+	for _, at := range health.transitions {
+		if now.Sub(at) < flapWindow {
+			recent = append(recent, at)
+		}
+	}
+	health.transitions = append(recent, now)
+
+	if len(health.transitions) < flapThreshold {
+		return time.Time{}, false
+	}
+	health.quarantinedUntil = now.Add(flapQuarantine)
+	health.transitions = nil
+	health.successes = 0
+	return health.quarantinedUntil, true
+}
+
+// quarantined reports whether a node is in flap quarantine
+func (hm *HealthMonitor) quarantined(nodeID string) bool {
+	hm.mutex.Lock()
+	defer hm.mutex.Unlock()
+
+	health, exists := hm.health[nodeID]
+	return exists && time.Now().Before(health.quarantinedUntil)
+}
+
+// resetCounters clears a node's consecutive check counts, for when it
+// reconnects and its earlier checks no longer apply
+func (hm *HealthMonitor) resetCounters(nodeID string) {
+	hm.mutex.Lock()
+	defer hm.mutex.Unlock()
+
+	health := hm.nodeHealth(nodeID)
+	health.failures = 0
+	health.successes = 0
+}
+
+// nodeHealth returns a node's record; hm.mutex must be held
+func (hm *HealthMonitor) nodeHealth(nodeID string) *nodeHealth {
+	health, exists := hm.health[nodeID]
+	if !exists {
+		health = &nodeHealth{}
+		hm.health[nodeID] = health
+	}
+	return health
+}
@@ -0,0 +1,189 @@
+package nodes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestHealthRecordThresholds(t *testing.T) {
+	hm := newHealthMonitor(nil)
+	now := time.Now()
+
+	// An online node fails after three bad checks in a row; a good check
+	// starts the count again
+	steps := []struct {
+		healthy bool
+		want    NodeStatus
+	}{
+		{false, ""},
+		{false, ""},
+		{true, ""},
+		{false, ""},
+		{false, ""},
+		{false, NodeStatusFailed},
+	}
+	for i, step := range steps {
+		if got := hm.record("node-a", step.healthy, NodeStatusOnline, now); got != step.want {
+			t.Fatalf("online check %d: record = %q, want %q", i+1, got, step.want)
+		}
+	}
+
+	// A failed node recovers after two good checks in a row
+	steps = []struct {
+		healthy bool
+		want    NodeStatus
+	}{
+		{true, ""},
+		{false, ""},
+		{true, ""},
+		{true, NodeStatusOnline},
+	}
+	for i, step := range steps {
+		if got := hm.record("node-a", step.healthy, NodeStatusFailed, now); got != step.want {
+			t.Fatalf("failed check %d: record = %q, want %q", i+1, got, step.want)
+		}
+	}
+}
+
+func TestHealthFlappingNodeIsQuarantined(t *testing.T) {
+	hm := newHealthMonitor(nil)
+	start := time.Now()
+
+	// Transitions spread wider than the flap window never add up
+	for i := 0; i < flapThreshold+2; i++ {
+		if _, flapping := hm.recordTransition("node-a", start.Add(time.Duration(i)*(flapWindow/2+time.Minute))); flapping {
+			t.Fatalf("transition %d outside the flap window quarantined the node", i+1)
+		}
+	}
+
+	for i := 0; i < flapThreshold-1; i++ {
+		if _, flapping := hm.recordTransition("node-b", start.Add(time.Duration(i)*time.Minute)); flapping {
+			t.Fatalf("transition %d quarantined the node early", i+1)
+		}
+	}
+	at := start.Add(flapThreshold * time.Minute)
+	until, flapping := hm.recordTransition("node-b", at)
+	if !flapping || !until.Equal(at.Add(flapQuarantine)) {
+		t.Fatalf("transition %d = %s, %v, want quarantine until %s", flapThreshold, until, flapping, at.Add(flapQuarantine))
+	}
+	if !hm.quarantined("node-b") || hm.quarantined("node-a") {
+		t.Error("quarantined reports the wrong nodes")
+	}
+
+	// Good checks during the quarantine don't count towards recovery
+	for i := 0; i < 5; i++ {
+		if got := hm.record("node-b", true, NodeStatusFailed, at.Add(time.Minute)); got != "" {
+			t.Fatalf("check during quarantine recovered the node")
+		}
+	}
+	hm.record("node-b", true, NodeStatusFailed, until.Add(time.Second))
+	if got := hm.record("node-b", true, NodeStatusFailed, until.Add(2*time.Second)); got != NodeStatusOnline {
+		t.Errorf("record after the quarantine = %q, want online", got)
+	}
+}
+
+// createHealthNode saves an online node that isn't connected and adds it to
+// the manager
+func createHealthNode(t *testing.T, nm *NodeManager, status NodeStatus) *Node {
+	t.Helper()
+
+	node := &Node{ID: "node-" + uuid.NewString()[:8], Name: "alpha", IPAddress: "10.0.0.1", Status: status, LastSeen: time.Now()}
+	if err := nm.db.Create(node).Error; err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	t.Cleanup(func() { nm.db.Delete(&Node{}, "id = ?", node.ID) })
+	nm.nodes[node.ID] = node
+	return node
+}
+
+// storedNodeStatus reads a node's status from the database
+func storedNodeStatus(nm *NodeManager, nodeID string) NodeStatus {
+	var node Node
+	nm.db.Select("status").First(&node, "id = ?", nodeID)
+	return node.Status
+}
+
+// nextEvent waits for the next cluster event
+func nextEvent(t *testing.T, events <-chan ClusterEvent) ClusterEvent {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event published")
+		return ClusterEvent{}
+	}
+}
+
+func TestCheckNodeHealthFailsSilentNode(t *testing.T) {
+	nm := newTestNodeManager(testDB(t))
+	node := createHealthNode(t, nm, NodeStatusOnline)
+
+	changes := make(chan NodeStatusChange, 1)
+	nm.OnNodeStatusChange(func(change NodeStatusChange) { changes <- change })
+	events, unsubscribe := nm.SubscribeEvents()
+	defer unsubscribe()
+
+	// The node has no connection, so every check fails
+	for i := 0; i < 2; i++ {
+		nm.healthMonitor.checkNodeHealth()
+	}
+	if nodeStatus(nm, node.ID) != NodeStatusOnline {
+		t.Fatal("node failed before the failure threshold")
+	}
+	nm.healthMonitor.checkNodeHealth()
+
+	if nodeStatus(nm, node.ID) != NodeStatusFailed || storedNodeStatus(nm, node.ID) != NodeStatusFailed {
+		t.Fatalf("status = %q, stored %q, want failed", nodeStatus(nm, node.ID), storedNodeStatus(nm, node.ID))
+	}
+	if event := nextEvent(t, events); event.Type != EventNodeFailed || event.NodeID != node.ID {
+		t.Errorf("event = %+v, want node_failed", event)
+	}
+	select {
+	case change := <-changes:
+		if change.Previous != NodeStatusOnline || change.Status != NodeStatusFailed || change.Quarantined {
+			t.Errorf("change = %+v, want online to failed", change)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("status change handler was not called")
+	}
+}
+
+func TestSetStatusRecoversAndQuarantinesFlappingNode(t *testing.T) {
+	nm := newTestNodeManager(testDB(t))
+	node := createHealthNode(t, nm, NodeStatusFailed)
+	events, unsubscribe := nm.SubscribeEvents()
+	defer unsubscribe()
+
+	hm := nm.healthMonitor
+	now := time.Now()
+	hm.setStatus(node, NodeStatusFailed, NodeStatusOnline, "node passed health checks again", now)
+	if nodeStatus(nm, node.ID) != NodeStatusOnline || storedNodeStatus(nm, node.ID) != NodeStatusOnline {
+		t.Fatalf("status = %q, want online", nodeStatus(nm, node.ID))
+	}
+	if event := nextEvent(t, events); event.Type != EventNodeRecovered {
+		t.Errorf("event = %s, want node_recovered", event.Type)
+	}
+
+	// A status that changed since the check is left alone
+	hm.setStatus(node, NodeStatusFailed, NodeStatusOnline, "stale check", now)
+
+	hm.setStatus(node, NodeStatusOnline, NodeStatusFailed, "down", now.Add(time.Minute))
+	hm.setStatus(node, NodeStatusFailed, NodeStatusOnline, "up", now.Add(2*time.Minute))
+	nextEvent(t, events)
+	nextEvent(t, events)
+
+	// The fourth change within the flap window quarantines the node, which
+	// stays failed instead of going down as asked
+	hm.setStatus(node, NodeStatusOnline, NodeStatusFailed, "down", now.Add(3*time.Minute))
+	event := nextEvent(t, events)
+	if event.Type != EventNodeQuarantined || nodeStatus(nm, node.ID) != NodeStatusFailed {
+		t.Fatalf("event %s with status %q, want node_quarantined and failed", event.Type, nodeStatus(nm, node.ID))
+	}
+	if _, found := event.Data["quarantined_until"]; !found {
+		t.Error("quarantine event has no end time")
+	}
+}
@@ -0,0 +1,125 @@
+package nodes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// deployKeyTTL is how long a deployment's result is kept for retries with
+// the same idempotency key
+const deployKeyTTL = 24 * time.Hour
+
+// ErrDeployKeyReused is returned when an idempotency key is sent again with
+// a different deployment
+var ErrDeployKeyReused = errors.New("idempotency key was already used for a different deployment")
+
+// deployRecord is a deployment made with an idempotency key. done is closed
+// once it finishes, after which result and err are set.
+type deployRecord struct {
+	fingerprint string
+	done        chan struct{}
+	result      *DeploymentResult
+	err         error
+	expiresAt   time.Time
+}
+
+// deployKeys tracks deployments by user and idempotency key
+type deployKeys struct {
+	records map[string]*deployRecord
+	mutex   sync.Mutex
+}
+
+func newDeployKeys() *deployKeys {
+	return &deployKeys{records: make(map[string]*deployRecord)}
+}
+
+// claim returns the record for a request's key, creating it if the key is
+// new or expired. owner is set when the caller created it and must run the
+// deployment and finish the record.
+func (dk *deployKeys) claim(request ServerDeploymentRequest, now time.Time) (record *deployRecord, owner bool, err error) {
+	fingerprint, err := deployFingerprint(request)
+	if err != nil {
+		return nil, false, err
+	}
+
+	dk.mutex.Lock()
+	defer dk.mutex.Unlock()
+
+	for key, existing := range dk.records {
+		if now.After(existing.expiresAt) {
+			delete(dk.records, key)
+		}
+	}
+
+	key := request.UserID + "\x00" + request.IdempotencyKey
+	if existing, exists := dk.records[key]; exists {
+		if existing.fingerprint != fingerprint {
+			return nil, false, ErrDeployKeyReused
+		}
+		return existing, false, nil
+	}
+
+	record = &deployRecord{
+		fingerprint: fingerprint,
+		done:        make(chan struct{}),
+		expiresAt:   now.Add(deployKeyTTL),
+	}
+	dk.records[key] = record
+	return record, true, nil
+}
+
+// finish records a deployment's outcome and wakes the retries waiting on it.
+// A failed deployment frees its key so it can be retried.
+func (dk *deployKeys) finish(request ServerDeploymentRequest, record *deployRecord, result *DeploymentResult, err error) {
+	dk.mutex.Lock()
+	record.result = result
+	record.err = err
+	if err != nil {
+		key := request.UserID + "\x00" + request.IdempotencyKey
+		if dk.records[key] == record {
+			delete(dk.records, key)
+		}
+	}
+	dk.mutex.Unlock()
+
+	close(record.done)
+}
+
+// deployFingerprint identifies what a request deploys, leaving out the key
+// and user, which aren't serialized
+func deployFingerprint(request ServerDeploymentRequest) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// deployIdempotent runs a deployment at most once per user and key. A retry
+// while the first is running waits for it, and a retry after it succeeded
+// gets its result without deploying again.
+func (nm *NodeManager) deployIdempotent(ctx context.Context, request ServerDeploymentRequest) (*DeploymentResult, error) {
+	record, owner, err := nm.deployKeys.claim(request, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if !owner {
+		select {
+		case <-record.done:
+			return record.result, record.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	result, err := nm.deployServer(ctx, request)
+	nm.deployKeys.finish(request, record, result, err)
+	return result, err
+}
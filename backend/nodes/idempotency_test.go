@@ -0,0 +1,107 @@
+package nodes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// answerDeploys replies to every deploy command the agent gets with a
+// status naming how many it has had, and returns that count
+func answerDeploys(agent *websocket.Conn) *atomic.Int32 {
+	var deploys atomic.Int32
+	go func() {
+		for {
+			var command NodeCommand
+			if err := agent.ReadJSON(&command); err != nil {
+				return
+			}
+			n := deploys.Add(1)
+			reply(agent, "server_deployed", command.ID, map[string]string{"status": fmt.Sprintf("deploy-%d", n)})
+		}
+	}()
+	return &deploys
+}
+
+func TestDeployServerWithIdempotencyKeyDeploysOnce(t *testing.T) {
+	nm := newTestNodeManager(testDB(t))
+	_, agent := connectTestAgent(t, nm)
+	deploys := answerDeploys(agent)
+
+	request := ServerDeploymentRequest{ServerID: "srv-1", ServerType: "minecraft-paper", IdempotencyKey: "key-1", UserID: "user-a"}
+
+	// A retry sent while the first is still running waits for it
+	results := make([]*DeploymentResult, 3)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := nm.DeployServer(context.Background(), request)
+			if err != nil {
+				t.Errorf("DeployServer: %v", err)
+			}
+			results[i] = result
+		}(i)
+	}
+	wg.Wait()
+
+	if deploys.Load() != 1 {
+		t.Fatalf("agent got %d deploys, want one", deploys.Load())
+	}
+	for i, result := range results {
+		if result == nil || result.Status != "deploy-1" {
+			t.Errorf("result %d = %+v, want the first deploy's", i+1, result)
+		}
+	}
+
+	// Keys are per user
+	other := request
+	other.UserID = "user-b"
+	result, err := nm.DeployServer(context.Background(), other)
+	if err != nil || result.Status != "deploy-2" {
+		t.Errorf("another user's deploy with the same key = %+v, %v, want a new deploy", result, err)
+	}
+
+	// The key can't be used for a different deployment
+	changed := request
+	changed.ServerType = "minecraft-fabric"
+	if _, err := nm.DeployServer(context.Background(), changed); !errors.Is(err, ErrDeployKeyReused) {
+		t.Errorf("reused key = %v, want ErrDeployKeyReused", err)
+	}
+	if deploys.Load() != 2 {
+		t.Errorf("agent got %d deploys, want two", deploys.Load())
+	}
+}
+
+func TestDeployKeysFreeFailedAndExpiredKeys(t *testing.T) {
+	dk := newDeployKeys()
+	request := ServerDeploymentRequest{ServerID: "srv-1", IdempotencyKey: "key-1", UserID: "user-a"}
+	now := time.Now()
+
+	record, owner, err := dk.claim(request, now)
+	if err != nil || !owner {
+		t.Fatalf("claim = %v, %v, want the new key claimed", owner, err)
+	}
+	dk.finish(request, record, nil, errors.New("no nodes"))
+
+	// A failed deployment can be retried
+	retry, owner, _ := dk.claim(request, now)
+	if !owner || retry == record {
+		t.Fatal("key of a failed deployment was not freed")
+	}
+	dk.finish(request, retry, &DeploymentResult{Status: "running"}, nil)
+
+	if replay, owner, _ := dk.claim(request, now.Add(time.Hour)); owner || replay.result.Status != "running" {
+		t.Errorf("claim within the TTL = %v, want the stored result", owner)
+	}
+	if _, owner, _ := dk.claim(request, now.Add(deployKeyTTL+time.Minute)); !owner {
+		t.Error("key was still held after the TTL")
+	}
+}
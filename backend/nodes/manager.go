@@ -2,9 +2,9 @@ package nodes
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
 	"sync"
 	"time"
 
@@ -22,29 +22,44 @@ type NodeManager struct {
 	serviceRegistry *ServiceRegistry
 	healthMonitor   *HealthMonitor
 	autoScaler      *AutoScaler
+	offlineHandler  func(node *Node)
+	statusHandler   func(change NodeStatusChange)
+	retention       MetricsRetention
+	nodeToken       string        // secret the per-node tokens are derived from
+	metricsInterval time.Duration // pushed to agents; 0 leaves them on their own
+	pending         map[string]*pendingCommand
+	pendingMutex    sync.Mutex
+	events          *eventHub
+	geoIP           geoLocator
+	deployKeys      *deployKeys
 }
 
 // Node represents a VPS node in the cluster
 type Node struct {
-	ID              string            `json:"id" gorm:"primaryKey"`
-	Name            string            `json:"name" gorm:"not null"`
-	Location        string            `json:"location"`
-	IPAddress       string            `json:"ip_address" gorm:"not null"`
-	InternalIP      string            `json:"internal_ip"`
-	Port            int               `json:"port" gorm:"default:8090"`
-	Status          NodeStatus        `json:"status" gorm:"default:'offline'"`
-	Capabilities    []string          `json:"capabilities" gorm:"type:json"`
-	Resources       NodeResources     `json:"resources" gorm:"type:json"`
-	Metadata        map[string]string `json:"metadata" gorm:"type:json"`
-	LastSeen        time.Time         `json:"last_seen"`
-	CreatedAt       time.Time         `json:"created_at"`
-	UpdatedAt       time.Time         `json:"updated_at"`
-	
-	// Runtime data
-	Connection      *websocket.Conn   `json:"-" gorm:"-"`
-	Servers         []NodeServer      `json:"servers,omitempty"`
-	Metrics         []NodeMetric      `json:"metrics,omitempty"`
-}
+	ID           string            `json:"id" gorm:"primaryKey"`
+	Name         string            `json:"name" gorm:"not null"`
+	Location     string            `json:"location"`
+	IPAddress    string            `json:"ip_address" gorm:"not null"`
+	InternalIP   string            `json:"internal_ip"`
+	Port         int               `json:"port" gorm:"default:8090"`
+	Status       NodeStatus        `json:"status" gorm:"default:'offline'"`
+	Capabilities []string          `json:"capabilities" gorm:"type:json;serializer:json"`
+	Resources    NodeResources     `json:"resources" gorm:"type:json;serializer:json"`
+	Metadata     map[string]string `json:"metadata" gorm:"type:json;serializer:json"`
+	LastSeen     time.Time         `json:"last_seen"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+
+	// Runtime data, reported by the agent rather than stored
+	Connection *websocket.Conn `json:"-" gorm:"-"`
+	Servers    []NodeServer    `json:"servers,omitempty" gorm:"-"`
+	Metrics    []NodeMetric    `json:"metrics,omitempty" gorm:"-"`
+	// ResponseTime is the round trip of the last ping in milliseconds
+	ResponseTime float64 `json:"response_time" gorm:"-"`
+}
+
+// CapabilityGPU is advertised by nodes with a usable NVIDIA GPU
+const CapabilityGPU = "gpu"
 
 type NodeStatus string
 
@@ -57,173 +72,132 @@ const (
 )
 
 type NodeResources struct {
-	CPU       CPUResources    `json:"cpu"`
-	Memory    MemoryResources `json:"memory"`
-	Disk      DiskResources   `json:"disk"`
+	CPU       CPUResources     `json:"cpu"`
+	Memory    MemoryResources  `json:"memory"`
+	Disk      DiskResources    `json:"disk"`
 	Network   NetworkResources `json:"network"`
-	Available bool            `json:"available"`
+	Available bool             `json:"available"`
 }
 
 type CPUResources struct {
-	Cores         int     `json:"cores"`
-	UsagePercent  float64 `json:"usage_percent"`
-	LoadAverage   float64 `json:"load_average"`
-	Available     int     `json:"available"`
+	Cores        int     `json:"cores"`
+	UsagePercent float64 `json:"usage_percent"`
+	LoadAverage  float64 `json:"load_average"`
+	Available    int     `json:"available"`
 }
 
 type MemoryResources struct {
-	Total         int64   `json:"total"`
-	Used          int64   `json:"used"`
-	Available     int64   `json:"available"`
-	UsagePercent  float64 `json:"usage_percent"`
+	Total        int64   `json:"total"`
+	Used         int64   `json:"used"`
+	Available    int64   `json:"available"`
+	UsagePercent float64 `json:"usage_percent"`
 }
 
 type DiskResources struct {
-	Total         int64   `json:"total"`
-	Used          int64   `json:"used"`
-	Available     int64   `json:"available"`
-	UsagePercent  float64 `json:"usage_percent"`
+	Total        int64   `json:"total"`
+	Used         int64   `json:"used"`
+	Available    int64   `json:"available"`
+	UsagePercent float64 `json:"usage_percent"`
 }
 
 type NetworkResources struct {
-	Bandwidth     int64 `json:"bandwidth"`
-	BytesIn       int64 `json:"bytes_in"`
-	BytesOut      int64 `json:"bytes_out"`
-	Connections   int   `json:"connections"`
+	Bandwidth   int64 `json:"bandwidth"`
+	BytesIn     int64 `json:"bytes_in"`
+	BytesOut    int64 `json:"bytes_out"`
+	Connections int   `json:"connections"`
 }
 
 // NodeServer represents a server running on a node
 type NodeServer struct {
-	ID          string            `json:"id"`
-	NodeID      string            `json:"node_id"`
-	Name        string            `json:"name"`
-	Type        string            `json:"type"`
-	Status      string            `json:"status"`
-	Port        int               `json:"port"`
-	Players     int               `json:"players"`
-	MaxPlayers  int               `json:"max_players"`
-	Resources   ServerResources   `json:"resources"`
-	CreatedAt   time.Time         `json:"created_at"`
+	ID         string          `json:"id"`
+	NodeID     string          `json:"node_id"`
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	Status     string          `json:"status"`
+	Port       int             `json:"port"`
+	Players    int             `json:"players"`
+	MaxPlayers int             `json:"max_players"`
+	Resources  ServerResources `json:"resources"`
+	CreatedAt  time.Time       `json:"created_at"`
 }
 
 type ServerResources struct {
-	CPUUsage      float64 `json:"cpu_usage"`
-	MemoryUsage   int64   `json:"memory_usage"`
-	MemoryLimit   int64   `json:"memory_limit"`
-	DiskUsage     int64   `json:"disk_usage"`
-	NetworkIn     int64   `json:"network_in"`
-	NetworkOut    int64   `json:"network_out"`
+	CPUUsage    float64 `json:"cpu_usage"`
+	MemoryUsage int64   `json:"memory_usage"`
+	MemoryLimit int64   `json:"memory_limit"`
+	DiskUsage   int64   `json:"disk_usage"`
+	NetworkIn   int64   `json:"network_in"`
+	NetworkOut  int64   `json:"network_out"`
 }
 
 // NodeMetric represents performance metrics for a node
 type NodeMetric struct {
-	ID           uuid.UUID     `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	NodeID       string        `json:"node_id" gorm:"not null"`
-	Timestamp    time.Time     `json:"timestamp"`
-	CPUUsage     float64       `json:"cpu_usage"`
-	MemoryUsage  float64       `json:"memory_usage"`
-	DiskUsage    float64       `json:"disk_usage"`
-	NetworkIn    int64         `json:"network_in"`
-	NetworkOut   int64         `json:"network_out"`
-	ServerCount  int           `json:"server_count"`
-	PlayerCount  int           `json:"player_count"`
-	ResponseTime float64       `json:"response_time"`
-	
-	Node Node `json:"node,omitempty"`
+	ID           uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	NodeID       string    `json:"node_id" gorm:"not null;index"`
+	Timestamp    time.Time `json:"timestamp" gorm:"index"`
+	CPUUsage     float64   `json:"cpu_usage"`
+	MemoryUsage  float64   `json:"memory_usage"`
+	DiskUsage    float64   `json:"disk_usage"`
+	NetworkIn    int64     `json:"network_in"`
+	NetworkOut   int64     `json:"network_out"`
+	ServerCount  int       `json:"server_count"`
+	PlayerCount  int       `json:"player_count"`
+	ResponseTime float64   `json:"response_time"`
 }
 
 // LoadBalancer handles traffic distribution across nodes
 type LoadBalancer struct {
 	strategy LoadBalancingStrategy
 	nodes    map[string]*Node
-	metrics  *MetricsCollector
 }
 
 type LoadBalancingStrategy string
 
 const (
-	StrategyRoundRobin     LoadBalancingStrategy = "round_robin"
-	StrategyLeastLoaded    LoadBalancingStrategy = "least_loaded"
+	StrategyRoundRobin      LoadBalancingStrategy = "round_robin"
+	StrategyLeastLoaded     LoadBalancingStrategy = "least_loaded"
 	StrategyGeographicAware LoadBalancingStrategy = "geographic_aware"
-	StrategyResourceBased  LoadBalancingStrategy = "resource_based"
-	StrategyLatencyBased   LoadBalancingStrategy = "latency_based"
+	StrategyResourceBased   LoadBalancingStrategy = "resource_based"
+	StrategyLatencyBased    LoadBalancingStrategy = "latency_based"
 )
 
-// ServiceRegistry tracks services across nodes
-type ServiceRegistry struct {
-	services map[string][]ServiceInstance
-	mutex    sync.RWMutex
-}
-
-type ServiceInstance struct {
-	ID       string            `json:"id"`
-	NodeID   string            `json:"node_id"`
-	Name     string            `json:"name"`
-	Address  string            `json:"address"`
-	Port     int               `json:"port"`
-	Health   string            `json:"health"`
-	Metadata map[string]string `json:"metadata"`
-	LastSeen time.Time         `json:"last_seen"`
-}
-
-// HealthMonitor monitors node health
-type HealthMonitor struct {
-	db             *gorm.DB
-	checkInterval  time.Duration
-	failureThreshold int
-	recoveryThreshold int
-}
-
-// AutoScaler handles automatic scaling
-type AutoScaler struct {
-	db              *gorm.DB
-	enabled         bool
-	minNodes        int
-	maxNodes        int
-	targetCPU       float64
-	targetMemory    float64
-	scaleUpCooldown time.Duration
-	scaleDownCooldown time.Duration
-}
-
 // NewNodeManager creates a new node manager
 func NewNodeManager(db *gorm.DB) *NodeManager {
+	events := newEventHub()
+
 	nm := &NodeManager{
-		db:    db,
-		nodes: make(map[string]*Node),
+		db:         db,
+		events:     events,
+		nodes:      make(map[string]*Node),
+		pending:    make(map[string]*pendingCommand),
+		deployKeys: newDeployKeys(),
+		retention:  DefaultMetricsRetention,
 		loadBalancer: &LoadBalancer{
 			strategy: StrategyLeastLoaded,
 			nodes:    make(map[string]*Node),
 		},
-		serviceRegistry: &ServiceRegistry{
-			services: make(map[string][]ServiceInstance),
-		},
-		healthMonitor: &HealthMonitor{
-			db:                db,
-			checkInterval:     30 * time.Second,
-			failureThreshold:  3,
-			recoveryThreshold: 2,
-		},
-		autoScaler: &AutoScaler{
-			db:                db,
-			enabled:           true,
-			minNodes:          2,
-			maxNodes:          50,
-			targetCPU:         70.0,
-			targetMemory:      80.0,
-			scaleUpCooldown:   5 * time.Minute,
-			scaleDownCooldown: 10 * time.Minute,
-		},
+		serviceRegistry: newServiceRegistry(DefaultServiceTTL),
 	}
 
+	nm.healthMonitor = newHealthMonitor(nm)
+	nm.autoScaler = newAutoScaler(db, events)
+	nm.autoScaler.forecaster = &playerForecaster{nm: nm}
+
 	// Start background processes
 	go nm.healthMonitor.Start()
 	go nm.autoScaler.Start()
 	go nm.startMetricsCollection()
+	go nm.startMetricsRollup()
+	go nm.serviceRegistry.startSweeper()
 
 	return nm
 }
 
+// Migrate creates the tables nodes and their metrics are stored in
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&Node{}, &NodeMetric{}, &NodeMetricRollup{})
+}
+
 // RegisterNode registers a new node with the cluster
 func (nm *NodeManager) RegisterNode(ctx context.Context, node *Node) error {
 	nm.nodesMutex.Lock()
@@ -239,6 +213,10 @@ func (nm *NodeManager) RegisterNode(ctx context.Context, node *Node) error {
 	nm.loadBalancer.nodes[node.ID] = node
 
 	log.Printf("Node registered: %s (%s) at %s", node.Name, node.ID, node.IPAddress)
+	nm.publishEvent(EventNodeRegistered, node.ID, "", map[string]interface{}{
+		"name":     node.Name,
+		"location": node.Location,
+	})
 	return nil
 }
 
@@ -256,13 +234,23 @@ func (nm *NodeManager) ConnectNode(nodeID string, conn *websocket.Conn) error {
 	node.Status = NodeStatusOnline
 	node.LastSeen = time.Now()
 
+	// A quarantined node stays out of the pool even if it reconnects; the
+	// health monitor brings it back once the quarantine is over
+	nm.healthMonitor.resetCounters(nodeID)
+	if nm.healthMonitor.quarantined(nodeID) {
+		node.Status = NodeStatusFailed
+	}
+
 	// Update database
 	nm.db.Model(node).Updates(map[string]interface{}{
-		"status":    NodeStatusOnline,
+		"status":    node.Status,
 		"last_seen": node.LastSeen,
 	})
 
 	log.Printf("Node connected: %s", nodeID)
+	if node.Status == NodeStatusOnline {
+		nm.publishEvent(EventNodeOnline, nodeID, "", nil)
+	}
 	return nil
 }
 
@@ -291,10 +279,42 @@ func (nm *NodeManager) DisconnectNode(nodeID string) {
 	})
 
 	log.Printf("Node disconnected: %s", nodeID)
+	nm.publishEvent(EventNodeOffline, nodeID, "", nil)
+
+	nm.failPendingCommands(nodeID)
+
+	if nm.offlineHandler != nil {
+		go nm.offlineHandler(node)
+	}
+}
+
+// OnNodeOffline registers a handler that is called when a node disconnects
+func (nm *NodeManager) OnNodeOffline(handler func(node *Node)) {
+	nm.nodesMutex.Lock()
+	defer nm.nodesMutex.Unlock()
+
+	nm.offlineHandler = handler
 }
 
 // DeployServer deploys a server to the best available node
 func (nm *NodeManager) DeployServer(ctx context.Context, request ServerDeploymentRequest) (*DeploymentResult, error) {
+	if request.IdempotencyKey != "" {
+		return nm.deployIdempotent(ctx, request)
+	}
+	return nm.deployServer(ctx, request)
+}
+
+// deployServer places a server on the best node and waits for the agent to
+// deploy it
+func (nm *NodeManager) deployServer(ctx context.Context, request ServerDeploymentRequest) (*DeploymentResult, error) {
+	// GPU deployments may only land on nodes that advertise a GPU. The
+	// requirements are copied so the caller's slice is left alone.
+	if request.GPU && !hasCapability(request.Requirements.RequiredCapabilities, CapabilityGPU) {
+		required := make([]string, len(request.Requirements.RequiredCapabilities), len(request.Requirements.RequiredCapabilities)+1)
+		copy(required, request.Requirements.RequiredCapabilities)
+		request.Requirements.RequiredCapabilities = append(required, CapabilityGPU)
+	}
+
 	// Select best node using load balancer
 	targetNode, err := nm.loadBalancer.SelectNode(request.Requirements)
 	if err != nil {
@@ -308,18 +328,29 @@ func (nm *NodeManager) DeployServer(ctx context.Context, request ServerDeploymen
 		Payload: request,
 	}
 
-	if err := nm.sendCommandToNode(targetNode.ID, deploymentCmd); err != nil {
-		return nil, fmt.Errorf("failed to send deployment command: %w", err)
-	}
+	nm.publishEvent(EventDeploymentStarted, targetNode.ID, request.ServerID, map[string]interface{}{
+		"server_type": request.ServerType,
+		"version":     request.Version,
+	})
 
-	// Wait for deployment result
-	result := &DeploymentResult{
-		ServerID: request.ServerID,
-		NodeID:   targetNode.ID,
-		Status:   "deploying",
+	// Wait for the agent to report how the deployment went
+	reply, err := nm.sendCommandAndWait(ctx, targetNode.ID, deploymentCmd, deployTimeout)
+	if err == nil {
+		var result *DeploymentResult
+		if result, err = deploymentResult(request, targetNode.ID, reply); err == nil {
+			nm.publishEvent(EventServerDeployed, targetNode.ID, request.ServerID, map[string]interface{}{
+				"status": result.Status,
+			})
+			return result, nil
+		}
+	} else {
+		err = fmt.Errorf("failed to deploy server to node %s: %w", targetNode.ID, err)
 	}
 
-	return result, nil
+	nm.publishEvent(EventDeploymentFailed, targetNode.ID, request.ServerID, map[string]interface{}{
+		"error": err.Error(),
+	})
+	return nil, err
 }
 
 // MigrateServer migrates a server from one node to another
@@ -332,7 +363,7 @@ func (nm *NodeManager) MigrateServer(ctx context.Context, serverID, targetNodeID
 
 	// Get target node
 	nm.nodesMutex.RLock()
-	targetNode, exists := nm.nodes[targetNodeID]
+	_, exists := nm.nodes[targetNodeID]
 	nm.nodesMutex.RUnlock()
 
 	if !exists {
@@ -347,14 +378,29 @@ func (nm *NodeManager) MigrateServer(ctx context.Context, serverID, targetNodeID
 		Strategy:     "live_migration",
 	}
 
+	nm.publishEvent(EventMigrationStarted, sourceNode.ID, serverID, map[string]interface{}{
+		"target_node_id": targetNodeID,
+	})
+
 	// Execute migration
-	return nm.executeMigration(ctx, migrationPlan)
+	if err := nm.executeMigration(ctx, migrationPlan); err != nil {
+		nm.publishEvent(EventMigrationFailed, sourceNode.ID, serverID, map[string]interface{}{
+			"target_node_id": targetNodeID,
+			"error":          err.Error(),
+		})
+		return err
+	}
+
+	nm.publishEvent(EventMigrationCompleted, targetNodeID, serverID, map[string]interface{}{
+		"source_node_id": sourceNode.ID,
+	})
+	return nil
 }
 
 // GetNodeMetrics returns metrics for all nodes
 func (nm *NodeManager) GetNodeMetrics(ctx context.Context, timeRange string) (map[string][]NodeMetric, error) {
 	var metrics []NodeMetric
-	
+
 	// Parse time range
 	duration, err := time.ParseDuration(timeRange)
 	if err != nil {
@@ -399,7 +445,7 @@ func (nm *NodeManager) GetClusterStatus() ClusterStatus {
 		if node.Status == NodeStatusOnline {
 			status.OnlineNodes++
 			status.TotalServers += len(node.Servers)
-			
+
 			for _, server := range node.Servers {
 				status.TotalPlayers += server.Players
 			}
@@ -430,6 +476,22 @@ func (nm *NodeManager) GetClusterStatus() ClusterStatus {
 	return status
 }
 
+// HealthCheck reports node connectivity for the panel's readiness report.
+// It fails when nodes are registered but none of them is online.
+func (nm *NodeManager) HealthCheck(ctx context.Context) (interface{}, error) {
+	status := nm.GetClusterStatus()
+	details := map[string]int{
+		"total":   status.TotalNodes,
+		"online":  status.OnlineNodes,
+		"offline": status.OfflineNodes,
+	}
+
+	if status.TotalNodes > 0 && status.OnlineNodes == 0 {
+		return details, fmt.Errorf("none of %d nodes is online", status.TotalNodes)
+	}
+	return details, nil
+}
+
 // Load Balancer Implementation
 func (lb *LoadBalancer) SelectNode(requirements ServerRequirements) (*Node, error) {
 	switch lb.strategy {
@@ -515,14 +577,7 @@ func (lb *LoadBalancer) nodeMetetsRequirements(node *Node, requirements ServerRe
 
 	// Check capabilities
 	for _, requiredCap := range requirements.RequiredCapabilities {
-		found := false
-		for _, nodeCap := range node.Capabilities {
-			if nodeCap == requiredCap {
-				found = true
-				break
-			}
-		}
-		if !found {
+		if !hasCapability(node.Capabilities, requiredCap) {
 			return false
 		}
 	}
@@ -530,90 +585,13 @@ func (lb *LoadBalancer) nodeMetetsRequirements(node *Node, requirements ServerRe
 	return true
 }
 
-// Health Monitor Implementation
-func (hm *HealthMonitor) Start() {
-	ticker := time.NewTicker(hm.checkInterval)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		hm.checkNodeHealth()
-	}
-}
-
-func (hm *HealthMonitor) checkNodeHealth() {
-	var nodes []Node
-	hm.db.Find(&nodes)
-
-	for _, node := range nodes {
-		if node.Status == NodeStatusOnline {
-			// Check if node is responsive
-			if time.Since(node.LastSeen) > hm.checkInterval*2 {
-				// Node hasn't been seen for too long
-				hm.markNodeUnhealthy(node.ID)
-			}
+func hasCapability(capabilities []string, capability string) bool {
+	for _, c := range capabilities {
+		if c == capability {
+			return true
 		}
 	}
-}
-
-func (hm *HealthMonitor) markNodeUnhealthy(nodeID string) {
-	hm.db.Model(&Node{}).Where("id = ?", nodeID).Update("status", NodeStatusFailed)
-	log.Printf("Node marked as unhealthy: %s", nodeID)
-}
-
-// Auto Scaler Implementation
-func (as *AutoScaler) Start() {
-	if !as.enabled {
-		return
-	}
-
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		as.evaluateScaling()
-	}
-}
-
-func (as *AutoScaler) evaluateScaling() {
-	// Get cluster metrics
-	var avgCPU, avgMemory float64
-	var nodeCount int
-
-	var nodes []Node
-	as.db.Where("status = ?", NodeStatusOnline).Find(&nodes)
-
-	for _, node := range nodes {
-		avgCPU += node.Resources.CPU.UsagePercent
-		avgMemory += node.Resources.Memory.UsagePercent
-		nodeCount++
-	}
-
-	if nodeCount == 0 {
-		return
-	}
-
-	avgCPU /= float64(nodeCount)
-	avgMemory /= float64(nodeCount)
-
-	// Scale up if needed
-	if (avgCPU > as.targetCPU || avgMemory > as.targetMemory) && nodeCount < as.maxNodes {
-		as.scaleUp()
-	}
-
-	// Scale down if needed
-	if avgCPU < as.targetCPU*0.5 && avgMemory < as.targetMemory*0.5 && nodeCount > as.minNodes {
-		as.scaleDown()
-	}
-}
-
-func (as *AutoScaler) scaleUp() {
-	log.Println("Auto-scaling: Scaling up cluster")
-	// Implementation would provision new nodes
-}
-
-func (as *AutoScaler) scaleDown() {
-	log.Println("Auto-scaling: Scaling down cluster")
-	// Implementation would drain and remove nodes
+	return false
 }
 
 // Supporting types
@@ -624,14 +602,20 @@ type ServerDeploymentRequest struct {
 	Port         int                `json:"port"`
 	Requirements ServerRequirements `json:"requirements"`
 	Environment  map[string]string  `json:"environment"`
+	GPU          bool               `json:"gpu"` // run a GPU-enabled image on a GPU node
+
+	// IdempotencyKey makes retries of the same deployment by UserID return
+	// the first deployment's result instead of deploying again
+	IdempotencyKey string `json:"-"`
+	UserID         string `json:"-"`
 }
 
 type ServerRequirements struct {
-	MinCPU                int      `json:"min_cpu"`
-	MinMemory             int64    `json:"min_memory"`
-	MinDisk               int64    `json:"min_disk"`
-	RequiredCapabilities  []string `json:"required_capabilities"`
-	PreferredLocation     string   `json:"preferred_location"`
+	MinCPU               int      `json:"min_cpu"`
+	MinMemory            int64    `json:"min_memory"`
+	MinDisk              int64    `json:"min_disk"`
+	RequiredCapabilities []string `json:"required_capabilities"`
+	PreferredLocation    string   `json:"preferred_location"`
 }
 
 type DeploymentResult struct {
@@ -728,8 +712,12 @@ func (nm *NodeManager) collectNodeMetrics() {
 				ID:   uuid.New().String(),
 				Type: "get_metrics",
 			}
-			
+
 			node.Connection.WriteJSON(metricsCmd)
+
+			// Time a ping; the pong handler records the round trip
+			node.Connection.WriteControl(websocket.PingMessage,
+				[]byte(strconv.FormatInt(time.Now().UnixNano(), 10)), time.Now().Add(pingTimeout))
 		}
 	}
 }
@@ -750,4 +738,4 @@ func (lb *LoadBalancer) selectResourceBasedNode(requirements ServerRequirements)
 
 func (lb *LoadBalancer) selectLatencyBasedNode(requirements ServerRequirements) (*Node, error) {
 	return lb.selectLeastLoadedNode(requirements)
-}
\ No newline at end of file
+}
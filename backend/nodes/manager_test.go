@@ -0,0 +1,96 @@
+package nodes
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newPlacementNodes returns an idle node without a GPU and a busier one
+// with a GPU, both online
+func newPlacementNodes() map[string]*Node {
+	cpuNode := &Node{ID: "cpu-1", Name: "cpu-1", Status: NodeStatusOnline, Capabilities: []string{"docker", "containers", "java"}}
+	cpuNode.Resources.CPU.UsagePercent = 5
+	cpuNode.Resources.Memory.UsagePercent = 10
+
+	gpuNode := &Node{ID: "gpu-1", Name: "gpu-1", Status: NodeStatusOnline, Capabilities: []string{"docker", "containers", "java", CapabilityGPU, "gpu-nvidia"}}
+	gpuNode.Resources.CPU.UsagePercent = 60
+	gpuNode.Resources.Memory.UsagePercent = 70
+
+	return map[string]*Node{cpuNode.ID: cpuNode, gpuNode.ID: gpuNode}
+}
+
+func TestSelectNodeRequiresGPU(t *testing.T) {
+	nodes := newPlacementNodes()
+	strategies := []LoadBalancingStrategy{StrategyRoundRobin, StrategyLeastLoaded, StrategyGeographicAware, StrategyResourceBased, StrategyLatencyBased}
+	gpu := ServerRequirements{RequiredCapabilities: []string{CapabilityGPU}}
+
+	for _, strategy := range strategies {
+		lb := &LoadBalancer{strategy: strategy, nodes: nodes}
+		// Map order varies, so a lucky pick would not show up in one try
+		for i := 0; i < 20; i++ {
+			node, err := lb.SelectNode(gpu)
+			if err != nil {
+				t.Fatalf("%s: SelectNode: %v", strategy, err)
+			}
+			if node.ID != "gpu-1" {
+				t.Fatalf("%s: GPU deployment placed on %s", strategy, node.ID)
+			}
+		}
+	}
+
+	// Without the requirement the idle node wins
+	lb := &LoadBalancer{strategy: StrategyLeastLoaded, nodes: nodes}
+	if node, err := lb.SelectNode(ServerRequirements{}); err != nil || node.ID != "cpu-1" {
+		t.Errorf("SelectNode without a GPU = %v, %v, want the least loaded node", node, err)
+	}
+
+	// With the GPU node down there is nowhere to put it
+	nodes["gpu-1"].Status = NodeStatusOffline
+	for _, strategy := range strategies {
+		lb := &LoadBalancer{strategy: strategy, nodes: nodes}
+		if node, err := lb.SelectNode(gpu); err == nil {
+			t.Errorf("%s: GPU deployment placed on %s with no GPU node online", strategy, node.ID)
+		}
+	}
+}
+
+func TestDeployServerRequiresGPUNode(t *testing.T) {
+	nodes := newPlacementNodes()
+	nm := &NodeManager{
+		nodes:        nodes,
+		loadBalancer: &LoadBalancer{strategy: StrategyLeastLoaded, nodes: nodes},
+		events:       newEventHub(),
+		pending:      make(map[string]*pendingCommand),
+	}
+
+	// The nodes have no connection, so the deployment fails once a node is
+	// picked, naming it
+	required := make([]string, 1, 2)
+	required[0] = "java"
+	request := ServerDeploymentRequest{
+		ServerID:     "srv-1",
+		ServerType:   "minecraft-paper",
+		GPU:          true,
+		Requirements: ServerRequirements{RequiredCapabilities: required},
+	}
+	_, err := nm.DeployServer(context.Background(), request)
+	if err == nil || !strings.Contains(err.Error(), "node gpu-1") {
+		t.Errorf("GPU deployment = %v, want it sent to gpu-1", err)
+	}
+	if !reflect.DeepEqual(required, []string{"java"}) || required[:2][1] != "" {
+		t.Errorf("caller's requirements changed to %q", required[:2])
+	}
+
+	request.GPU = false
+	if _, err := nm.DeployServer(context.Background(), request); err == nil || !strings.Contains(err.Error(), "node cpu-1") {
+		t.Errorf("deployment without a GPU = %v, want it sent to the idle cpu-1", err)
+	}
+
+	nodes["gpu-1"].Status = NodeStatusOffline
+	request.GPU = true
+	if _, err := nm.DeployServer(context.Background(), request); err == nil || !strings.Contains(err.Error(), "failed to select target node") {
+		t.Errorf("GPU deployment without a GPU node = %v, want no node selected", err)
+	}
+}
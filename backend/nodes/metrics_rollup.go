@@ -0,0 +1,240 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MetricsRetention controls how long node metrics are kept. Raw samples older
+// than Raw are folded into hourly rollups, and rollups older than Hourly are
+// deleted.
+type MetricsRetention struct {
+	Raw    time.Duration
+	Hourly time.Duration
+}
+
+// DefaultMetricsRetention keeps two days of raw samples and 90 days of rollups
+var DefaultMetricsRetention = MetricsRetention{
+	Raw:    48 * time.Hour,
+	Hourly: 90 * 24 * time.Hour,
+}
+
+// NodeMetricRollup holds the average of a node's metrics over one bucket.
+// Hourly rollups are stored; coarser resolutions are computed on read.
+type NodeMetricRollup struct {
+	ID           uuid.UUID `json:"-" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	NodeID       string    `json:"node_id" gorm:"not null;uniqueIndex:idx_node_metric_rollup_bucket"`
+	Bucket       time.Time `json:"bucket" gorm:"not null;uniqueIndex:idx_node_metric_rollup_bucket"`
+	Samples      int       `json:"samples"`
+	CPUUsage     float64   `json:"cpu_usage"`
+	MemoryUsage  float64   `json:"memory_usage"`
+	DiskUsage    float64   `json:"disk_usage"`
+	NetworkIn    float64   `json:"network_in"`
+	NetworkOut   float64   `json:"network_out"`
+	ServerCount  float64   `json:"server_count"`
+	PlayerCount  float64   `json:"player_count"`
+	ResponseTime float64   `json:"response_time"`
+}
+
+// SetMetricsRetention replaces the retention windows used by the rollup job
+func (nm *NodeManager) SetMetricsRetention(retention MetricsRetention) {
+	nm.nodesMutex.Lock()
+	defer nm.nodesMutex.Unlock()
+
+	nm.retention = retention
+}
+
+// RollupMetrics folds raw metrics older than the raw retention window into
+// hourly rollups, deletes the folded raw rows and prunes expired rollups.
+func (nm *NodeManager) RollupMetrics(ctx context.Context, now time.Time) error {
+	nm.nodesMutex.RLock()
+	retention := nm.retention
+	nm.nodesMutex.RUnlock()
+
+	// Only fold whole hours so a bucket is never split across two runs
+	cutoff := now.Add(-retention.Raw).Truncate(time.Hour)
+
+	return nm.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var raw []NodeMetric
+		if err := tx.Where("timestamp < ?", cutoff).Find(&raw).Error; err != nil {
+			return err
+		}
+
+		buckets := make(map[string]*NodeMetricRollup)
+		for _, metric := range raw {
+			bucket := metric.Timestamp.UTC().Truncate(time.Hour)
+			key := metric.NodeID + "|" + bucket.Format(time.RFC3339)
+
+			rollup, exists := buckets[key]
+			if !exists {
+				rollup = &NodeMetricRollup{NodeID: metric.NodeID, Bucket: bucket}
+				buckets[key] = rollup
+			}
+			rollup.add(rollupOf(metric))
+		}
+
+		for _, rollup := range buckets {
+			// Merge with a rollup left by an earlier run for the same hour
+			var existing NodeMetricRollup
+			err := tx.Where("node_id = ? AND bucket = ?", rollup.NodeID, rollup.Bucket).First(&existing).Error
+			switch {
+			case err == nil:
+				existing.add(*rollup)
+				if err := tx.Save(&existing).Error; err != nil {
+					return err
+				}
+			case err == gorm.ErrRecordNotFound:
+				if err := tx.Create(rollup).Error; err != nil {
+					return err
+				}
+			default:
+				return err
+			}
+		}
+
+		if err := tx.Where("timestamp < ?", cutoff).Delete(&NodeMetric{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("bucket < ?", now.Add(-retention.Hourly)).Delete(&NodeMetricRollup{}).Error
+	})
+}
+
+// GetAggregatedMetrics returns per-node series averaged into buckets of the
+// given resolution, combining stored rollups with raw samples. Resolutions
+// below an hour only apply to the raw window; older data stays hourly.
+func (nm *NodeManager) GetAggregatedMetrics(ctx context.Context, resolution time.Duration, since time.Time) (map[string][]NodeMetricRollup, error) {
+	if resolution <= 0 {
+		resolution = time.Hour
+	}
+
+	var rollups []NodeMetricRollup
+	if err := nm.db.WithContext(ctx).Where("bucket >= ?", since).Find(&rollups).Error; err != nil {
+		return nil, err
+	}
+
+	var raw []NodeMetric
+	if err := nm.db.WithContext(ctx).Where("timestamp >= ?", since).Find(&raw).Error; err != nil {
+		return nil, err
+	}
+
+	samples := rollups
+	for _, metric := range raw {
+		samples = append(samples, rollupOf(metric))
+	}
+
+	buckets := make(map[string]map[time.Time]*NodeMetricRollup)
+	for _, sample := range samples {
+		bucket := sample.Bucket.UTC().Truncate(resolution)
+		if buckets[sample.NodeID] == nil {
+			buckets[sample.NodeID] = make(map[time.Time]*NodeMetricRollup)
+		}
+
+		rollup, exists := buckets[sample.NodeID][bucket]
+		if !exists {
+			rollup = &NodeMetricRollup{NodeID: sample.NodeID, Bucket: bucket}
+			buckets[sample.NodeID][bucket] = rollup
+		}
+		rollup.add(sample)
+	}
+
+	result := make(map[string][]NodeMetricRollup)
+	for nodeID, series := range buckets {
+		for _, rollup := range series {
+			result[nodeID] = append(result[nodeID], *rollup)
+		}
+		sort.Slice(result[nodeID], func(i, j int) bool {
+			return result[nodeID][i].Bucket.Before(result[nodeID][j].Bucket)
+		})
+	}
+
+	return result, nil
+}
+
+// AggregatedMetricsHandler serves GetAggregatedMetrics over HTTP. It accepts
+// "resolution" (default 1h) and "range" (default 24h) as Go durations.
+func (nm *NodeManager) AggregatedMetricsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resolution, err := time.ParseDuration(r.URL.Query().Get("resolution"))
+		if err != nil {
+			resolution = time.Hour
+		}
+
+		timeRange, err := time.ParseDuration(r.URL.Query().Get("range"))
+		if err != nil {
+			timeRange = 24 * time.Hour
+		}
+
+		series, err := nm.GetAggregatedMetrics(r.Context(), resolution, time.Now().Add(-timeRange))
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to fetch metrics")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"resolution": resolution.String(),
+			"range":      timeRange.String(),
+			"series":     series,
+		})
+	}
+}
+
+func (nm *NodeManager) startMetricsRollup() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := nm.RollupMetrics(context.Background(), time.Now()); err != nil {
+			log.Printf("Failed to roll up node metrics: %v", err)
+		}
+	}
+}
+
+// rollupOf turns a raw sample into a single-sample rollup
+func rollupOf(metric NodeMetric) NodeMetricRollup {
+	return NodeMetricRollup{
+		NodeID:       metric.NodeID,
+		Bucket:       metric.Timestamp,
+		Samples:      1,
+		CPUUsage:     metric.CPUUsage,
+		MemoryUsage:  metric.MemoryUsage,
+		DiskUsage:    metric.DiskUsage,
+		NetworkIn:    float64(metric.NetworkIn),
+		NetworkOut:   float64(metric.NetworkOut),
+		ServerCount:  float64(metric.ServerCount),
+		PlayerCount:  float64(metric.PlayerCount),
+		ResponseTime: metric.ResponseTime,
+	}
+}
+
+// add merges other into r, weighting both averages by their sample counts
+func (r *NodeMetricRollup) add(other NodeMetricRollup) {
+	total := float64(r.Samples + other.Samples)
+	if total == 0 {
+		return
+	}
+
+	weight := func(a, b float64) float64 {
+		return (a*float64(r.Samples) + b*float64(other.Samples)) / total
+	}
+
+	r.CPUUsage = weight(r.CPUUsage, other.CPUUsage)
+	r.MemoryUsage = weight(r.MemoryUsage, other.MemoryUsage)
+	r.DiskUsage = weight(r.DiskUsage, other.DiskUsage)
+	r.NetworkIn = weight(r.NetworkIn, other.NetworkIn)
+	r.NetworkOut = weight(r.NetworkOut, other.NetworkOut)
+	r.ServerCount = weight(r.ServerCount, other.ServerCount)
+	r.PlayerCount = weight(r.PlayerCount, other.PlayerCount)
+	r.ResponseTime = weight(r.ResponseTime, other.ResponseTime)
+	r.Samples += other.Samples
+}
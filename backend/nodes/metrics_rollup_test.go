@@ -0,0 +1,120 @@
+package nodes
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// seedNodeMetrics stores raw samples for a fresh node ID and removes
+// everything stored for it when the test ends
+func seedNodeMetrics(t *testing.T, nm *NodeManager, metrics ...NodeMetric) string {
+	t.Helper()
+
+	nodeID := "test-" + uuid.NewString()
+	for i := range metrics {
+		metrics[i].NodeID = nodeID
+	}
+	if err := nm.db.Create(&metrics).Error; err != nil {
+		t.Fatalf("failed to seed metrics: %v", err)
+	}
+	t.Cleanup(func() {
+		nm.db.Where("node_id = ?", nodeID).Delete(&NodeMetric{})
+		nm.db.Where("node_id = ?", nodeID).Delete(&NodeMetricRollup{})
+	})
+	return nodeID
+}
+
+func TestRollupMetricsHourlyBuckets(t *testing.T) {
+	nm := &NodeManager{db: testDB(t), retention: DefaultMetricsRetention}
+	now := time.Date(2026, 3, 10, 12, 30, 0, 0, time.UTC)
+	old := now.Add(-72 * time.Hour).Truncate(time.Hour)
+
+	nodeID := seedNodeMetrics(t, nm,
+		NodeMetric{Timestamp: old.Add(5 * time.Minute), CPUUsage: 10, PlayerCount: 4},
+		NodeMetric{Timestamp: old.Add(35 * time.Minute), CPUUsage: 30, PlayerCount: 8},
+		NodeMetric{Timestamp: old.Add(65 * time.Minute), CPUUsage: 50, PlayerCount: 2},
+		// Inside the raw window, left alone
+		NodeMetric{Timestamp: now.Add(-time.Hour), CPUUsage: 90},
+	)
+
+	if err := nm.RollupMetrics(context.Background(), now); err != nil {
+		t.Fatalf("RollupMetrics: %v", err)
+	}
+
+	var rollups []NodeMetricRollup
+	nm.db.Where("node_id = ?", nodeID).Order("bucket").Find(&rollups)
+	if len(rollups) != 2 {
+		t.Fatalf("%d rollups, want one per hour (2)", len(rollups))
+	}
+	if !rollups[0].Bucket.Equal(old) || rollups[0].Samples != 2 || rollups[0].CPUUsage != 20 || rollups[0].PlayerCount != 6 {
+		t.Errorf("first bucket = %+v, want the average of the first two samples at %s", rollups[0], old)
+	}
+	if !rollups[1].Bucket.Equal(old.Add(time.Hour)) || rollups[1].Samples != 1 || rollups[1].CPUUsage != 50 {
+		t.Errorf("second bucket = %+v", rollups[1])
+	}
+
+	var raw []NodeMetric
+	nm.db.Where("node_id = ?", nodeID).Find(&raw)
+	if len(raw) != 1 || raw[0].CPUUsage != 90 {
+		t.Errorf("raw rows left = %+v, want only the recent sample", raw)
+	}
+}
+
+func TestRollupMetricsMergesAndPrunes(t *testing.T) {
+	nm := &NodeManager{db: testDB(t), retention: MetricsRetention{Raw: time.Hour, Hourly: 24 * time.Hour}}
+	now := time.Date(2026, 3, 10, 12, 30, 0, 0, time.UTC)
+	hour := now.Add(-3 * time.Hour).Truncate(time.Hour)
+
+	nodeID := seedNodeMetrics(t, nm,
+		NodeMetric{Timestamp: hour.Add(time.Minute), CPUUsage: 10},
+		NodeMetric{Timestamp: now.Add(-48 * time.Hour), CPUUsage: 99},
+	)
+	if err := nm.RollupMetrics(context.Background(), now); err != nil {
+		t.Fatalf("RollupMetrics: %v", err)
+	}
+
+	// A late sample for an hour that was already rolled up is merged in
+	late := NodeMetric{NodeID: nodeID, Timestamp: hour.Add(50 * time.Minute), CPUUsage: 40}
+	nm.db.Create(&late)
+	if err := nm.RollupMetrics(context.Background(), now); err != nil {
+		t.Fatalf("RollupMetrics: %v", err)
+	}
+
+	var rollups []NodeMetricRollup
+	nm.db.Where("node_id = ?", nodeID).Find(&rollups)
+	if len(rollups) != 1 {
+		t.Fatalf("%d rollups, want the expired one pruned and one merged hour", len(rollups))
+	}
+	if rollups[0].Samples != 2 || math.Abs(rollups[0].CPUUsage-25) > 1e-9 {
+		t.Errorf("merged rollup = %+v, want 2 samples averaging 25", rollups[0])
+	}
+}
+
+func TestGetAggregatedMetricsCombinesRollupsAndRaw(t *testing.T) {
+	nm := &NodeManager{db: testDB(t), retention: DefaultMetricsRetention}
+	now := time.Now().UTC()
+
+	nodeID := seedNodeMetrics(t, nm,
+		NodeMetric{Timestamp: now.Add(-72 * time.Hour), CPUUsage: 10},
+		NodeMetric{Timestamp: now.Add(-time.Hour), CPUUsage: 20},
+	)
+	if err := nm.RollupMetrics(context.Background(), now); err != nil {
+		t.Fatalf("RollupMetrics: %v", err)
+	}
+
+	series, err := nm.GetAggregatedMetrics(context.Background(), 24*time.Hour, now.Add(-7*24*time.Hour))
+	if err != nil {
+		t.Fatalf("GetAggregatedMetrics: %v", err)
+	}
+	points := series[nodeID]
+	if len(points) != 2 {
+		t.Fatalf("%d points, want the old rollup and the raw sample in separate days", len(points))
+	}
+	if !points[0].Bucket.Before(points[1].Bucket) || points[0].CPUUsage != 10 || points[1].CPUUsage != 20 {
+		t.Errorf("points = %+v, want them ordered by time", points)
+	}
+}
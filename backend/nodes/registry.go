@@ -0,0 +1,175 @@
+package nodes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultServiceTTL is how long a service instance stays registered without
+// a heartbeat
+const DefaultServiceTTL = 90 * time.Second
+
+const (
+	ServiceHealthy   = "healthy"
+	ServiceUnhealthy = "unhealthy"
+)
+
+// ErrServiceNotRegistered is returned for a heartbeat from an instance that
+// isn't registered, such as one that was evicted; it should register again
+var ErrServiceNotRegistered = errors.New("service instance not registered")
+
+// ServiceRegistry tracks services across nodes. Instances stay registered
+// while they send heartbeats and are evicted once they haven't been seen for
+// the TTL.
+type ServiceRegistry struct {
+	services map[string][]ServiceInstance
+	mutex    sync.RWMutex
+	ttl      time.Duration
+}
+
+type ServiceInstance struct {
+	ID       string            `json:"id"`
+	NodeID   string            `json:"node_id"`
+	Name     string            `json:"name"`
+	Address  string            `json:"address"`
+	Port     int               `json:"port"`
+	Health   string            `json:"health"`
+	Metadata map[string]string `json:"metadata"`
+	LastSeen time.Time         `json:"last_seen"`
+}
+
+func newServiceRegistry(ttl time.Duration) *ServiceRegistry {
+	return &ServiceRegistry{
+		services: make(map[string][]ServiceInstance),
+		ttl:      ttl,
+	}
+}
+
+// Services returns the node manager's service registry
+func (nm *NodeManager) Services() *ServiceRegistry {
+	return nm.serviceRegistry
+}
+
+// Register adds a service instance, or replaces the instance with the same
+// ID. Instances are healthy unless they say otherwise.
+func (sr *ServiceRegistry) Register(instance ServiceInstance) error {
+	if instance.ID == "" || instance.Name == "" {
+		return fmt.Errorf("service instance needs an ID and a name")
+	}
+	if instance.Health == "" {
+		instance.Health = ServiceHealthy
+	}
+	instance.LastSeen = time.Now()
+
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	sr.remove(instance.ID)
+	sr.services[instance.Name] = append(sr.services[instance.Name], instance)
+	return nil
+}
+
+// Deregister removes a service instance. It reports whether the instance
+// was registered.
+func (sr *ServiceRegistry) Deregister(instanceID string) bool {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	return sr.remove(instanceID)
+}
+
+// Heartbeat marks an instance as seen and records its health; an empty
+// health leaves it unchanged
+func (sr *ServiceRegistry) Heartbeat(instanceID, health string) error {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	for _, instances := range sr.services {
+		for i := range instances {
+			if instances[i].ID == instanceID {
+				instances[i].LastSeen = time.Now()
+				if health != "" {
+					instances[i].Health = health
+				}
+				return nil
+			}
+		}
+	}
+	return ErrServiceNotRegistered
+}
+
+// Healthy returns the instances of a service that report healthy and have
+// been seen within the TTL
+func (sr *ServiceRegistry) Healthy(name string) []ServiceInstance {
+	sr.mutex.RLock()
+	defer sr.mutex.RUnlock()
+
+	cutoff := time.Now().Add(-sr.ttl)
+	healthy := []ServiceInstance{}
+	for _, instance := range sr.services[name] {
+		if instance.Health == ServiceHealthy && instance.LastSeen.After(cutoff) {
+			healthy = append(healthy, instance)
+		}
+	}
+	return healthy
+}
+
+// EvictStale removes the instances not seen since the TTL before now and
+// returns how many were removed
+func (sr *ServiceRegistry) EvictStale(now time.Time) int {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	cutoff := now.Add(-sr.ttl)
+	evicted := 0
+	for name, instances := range sr.services {
+		kept := instances[:0]
+		for _, instance := range instances {
+			if instance.LastSeen.After(cutoff) {
+				kept = append(kept, instance)
+			} else {
+				evicted++
+			}
+		}
+		if len(kept) == 0 {
+			delete(sr.services, name)
+		} else {
+			sr.services[name] = kept
+		}
+	}
+	return evicted
+}
+
+// startSweeper evicts stale instances a few times per TTL
+func (sr *ServiceRegistry) startSweeper() {
+	ticker := time.NewTicker(sr.ttl / 3)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if evicted := sr.EvictStale(now); evicted > 0 {
+			log.Printf("Evicted %d stale service instances", evicted)
+		}
+	}
+}
+
+// remove deletes an instance by ID; sr.mutex must be held
+func (sr *ServiceRegistry) remove(instanceID string) bool {
+	for name, instances := range sr.services {
+		for i, instance := range instances {
+			if instance.ID != instanceID {
+				continue
+			}
+			instances = append(instances[:i], instances[i+1:]...)
+			if len(instances) == 0 {
+				delete(sr.services, name)
+			} else {
+				sr.services[name] = instances
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package nodes
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// backdate moves an instance's last heartbeat back by age
+func backdate(sr *ServiceRegistry, instanceID string, age time.Duration) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	for _, instances := range sr.services {
+		for i := range instances {
+			if instances[i].ID == instanceID {
+				instances[i].LastSeen = instances[i].LastSeen.Add(-age)
+			}
+		}
+	}
+}
+
+// instanceIDs returns the IDs of instances in order
+func instanceIDs(instances []ServiceInstance) []string {
+	ids := make([]string, len(instances))
+	for i, instance := range instances {
+		ids[i] = instance.ID
+	}
+	return ids
+}
+
+func TestServiceRegistryEvictsStaleInstances(t *testing.T) {
+	sr := newServiceRegistry(time.Minute)
+	for _, id := range []string{"proxy-1", "proxy-2"} {
+		if err := sr.Register(ServiceInstance{ID: id, Name: "proxy", NodeID: "node-a"}); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+	}
+
+	// Both were last seen 50 seconds ago; only proxy-1 sends a heartbeat
+	backdate(sr, "proxy-1", 50*time.Second)
+	backdate(sr, "proxy-2", 50*time.Second)
+	if err := sr.Heartbeat("proxy-1", ""); err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+
+	if evicted := sr.EvictStale(time.Now()); evicted != 0 {
+		t.Fatalf("evicted %d instances within the TTL", evicted)
+	}
+	if evicted := sr.EvictStale(time.Now().Add(20 * time.Second)); evicted != 1 {
+		t.Fatalf("evicted %d instances, want the one without a heartbeat", evicted)
+	}
+	if got := instanceIDs(sr.Healthy("proxy")); len(got) != 1 || got[0] != "proxy-1" {
+		t.Errorf("healthy instances = %v, want [proxy-1]", got)
+	}
+
+	// An evicted instance has to register again
+	if err := sr.Heartbeat("proxy-2", ""); !errors.Is(err, ErrServiceNotRegistered) {
+		t.Errorf("Heartbeat after eviction = %v, want ErrServiceNotRegistered", err)
+	}
+
+	if evicted := sr.EvictStale(time.Now().Add(2 * time.Minute)); evicted != 1 {
+		t.Fatalf("evicted %d instances, want the last one", evicted)
+	}
+	if _, exists := sr.services["proxy"]; exists {
+		t.Error("a service without instances was kept")
+	}
+}
+
+func TestServiceRegistryHealthy(t *testing.T) {
+	sr := newServiceRegistry(time.Minute)
+	sr.Register(ServiceInstance{ID: "lobby-1", Name: "lobby"})
+	sr.Register(ServiceInstance{ID: "lobby-2", Name: "lobby"})
+	sr.Register(ServiceInstance{ID: "lobby-3", Name: "lobby", Health: ServiceUnhealthy})
+	sr.Register(ServiceInstance{ID: "lobby-4", Name: "lobby"})
+	sr.Register(ServiceInstance{ID: "proxy-1", Name: "proxy"})
+
+	sr.Heartbeat("lobby-2", ServiceUnhealthy)
+	backdate(sr, "lobby-4", 2*time.Minute) // stale, but not swept yet
+
+	if got := instanceIDs(sr.Healthy("lobby")); len(got) != 1 || got[0] != "lobby-1" {
+		t.Errorf("healthy lobbies = %v, want [lobby-1]", got)
+	}
+
+	// A heartbeat without a health keeps the one reported before
+	sr.Heartbeat("lobby-3", ServiceHealthy)
+	sr.Heartbeat("lobby-3", "")
+	if got := instanceIDs(sr.Healthy("lobby")); len(got) != 2 || got[1] != "lobby-3" {
+		t.Errorf("healthy lobbies after lobby-3 recovered = %v", got)
+	}
+
+	if got := sr.Healthy("unknown"); got == nil || len(got) != 0 {
+		t.Errorf("Healthy for an unknown service = %v, want an empty list", got)
+	}
+}
+
+func TestServiceRegistryRegisterAndDeregister(t *testing.T) {
+	sr := newServiceRegistry(time.Minute)
+
+	if err := sr.Register(ServiceInstance{Name: "lobby"}); err == nil {
+		t.Error("instance without an ID was registered")
+	}
+	if err := sr.Register(ServiceInstance{ID: "lobby-1"}); err == nil {
+		t.Error("instance without a name was registered")
+	}
+
+	// Registering the same ID again replaces the instance, even under
+	// another name
+	sr.Register(ServiceInstance{ID: "lobby-1", Name: "lobby", Port: 25565})
+	sr.Register(ServiceInstance{ID: "lobby-1", Name: "hub", Port: 25566})
+	if got := sr.Healthy("lobby"); len(got) != 0 {
+		t.Errorf("lobby still has %d instances after lobby-1 moved", len(got))
+	}
+	if got := sr.Healthy("hub"); len(got) != 1 || got[0].Port != 25566 {
+		t.Errorf("hub instances = %+v, want lobby-1 on 25566", got)
+	}
+
+	if !sr.Deregister("lobby-1") {
+		t.Error("Deregister did not find lobby-1")
+	}
+	if sr.Deregister("lobby-1") {
+		t.Error("lobby-1 was deregistered twice")
+	}
+	if got := sr.Healthy("hub"); len(got) != 0 {
+		t.Errorf("hub has %d instances after deregistering", len(got))
+	}
+}
+
+func TestServiceRegistryConcurrentUse(t *testing.T) {
+	sr := newServiceRegistry(time.Minute)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				id := fmt.Sprintf("lobby-%d-%d", worker, i%5)
+				sr.Register(ServiceInstance{ID: id, Name: "lobby"})
+				sr.Heartbeat(id, ServiceHealthy)
+				sr.Healthy("lobby")
+				if i%10 == 0 {
+					sr.EvictStale(time.Now())
+					sr.Deregister(id)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	if got := len(sr.Healthy("lobby")); got != 8*5 {
+		t.Errorf("%d instances registered, want 40", got)
+	}
+}
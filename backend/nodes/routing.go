@@ -0,0 +1,280 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"playpulse-panel/marketplace"
+	"playpulse-panel/utils"
+)
+
+const (
+	// unknownDistanceLatency is the latency assumed for a node whose
+	// distance to the player can't be worked out
+	unknownDistanceLatency = 150.0
+	// kmPerLatencyMs turns distance into round-trip time; light in fibre
+	// covers roughly 100km of round trip per millisecond
+	kmPerLatencyMs = 100.0
+	// latencyWindow is how far back node response times are averaged
+	latencyWindow = 15 * time.Minute
+)
+
+// ErrNoRoute is returned when no online node can take the player
+var ErrNoRoute = errors.New("no node available for the player")
+
+// RouteRequest describes the player being routed. Region is a node location
+// such as "eu-west" that the client prefers; without it the player is placed
+// by the location of ClientIP. ServerID routes to that server, and
+// ServerType to the emptiest running server of that type.
+type RouteRequest struct {
+	ClientIP   string `json:"client_ip"`
+	Region     string `json:"region"`
+	ServerID   string `json:"server_id"`
+	ServerType string `json:"server_type"`
+}
+
+// PlayerRoute is where a player should connect
+type PlayerRoute struct {
+	NodeID   string `json:"node_id"`
+	NodeName string `json:"node_name"`
+	Location string `json:"location"`
+	Address  string `json:"address"`
+	ServerID string `json:"server_id,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	// EstimatedLatency is the expected round trip in milliseconds, from the
+	// distance to the node and the node's response time
+	EstimatedLatency float64 `json:"estimated_latency_ms"`
+}
+
+// geoPoint is a location from the GeoIP database
+type geoPoint struct {
+	latitude  float64
+	longitude float64
+}
+
+// geoLocator places players and nodes with the marketplace's GeoIP
+// resolver, caching node addresses since those rarely change
+type geoLocator struct {
+	marketplace.GeoIP
+
+	mutex sync.RWMutex
+	nodes map[string]*geoPoint
+}
+
+// SetGeoIPDatabase opens the MaxMind city database at path used to place
+// players and nodes. An empty path turns the lookup off; players are then
+// routed by region hint, response time and load only.
+func (nm *NodeManager) SetGeoIPDatabase(path string) error {
+	if err := nm.geoIP.Open(path); err != nil {
+		return err
+	}
+
+	nm.geoIP.mutex.Lock()
+	nm.geoIP.nodes = make(map[string]*geoPoint)
+	nm.geoIP.mutex.Unlock()
+	return nil
+}
+
+// locate returns the coordinates of ip, or nil for private, invalid and
+// unlisted addresses
+func (g *geoLocator) locate(ip string) *geoPoint {
+	latitude, longitude, ok := g.Location(ip)
+	if !ok {
+		return nil
+	}
+	return &geoPoint{latitude: latitude, longitude: longitude}
+}
+
+// locateNode returns a node's coordinates. The latitude and longitude
+// metadata keys take precedence, for nodes whose address GeoIP can't place.
+func (g *geoLocator) locateNode(node *Node) *geoPoint {
+	latitude, latErr := strconv.ParseFloat(node.Metadata["latitude"], 64)
+	longitude, lonErr := strconv.ParseFloat(node.Metadata["longitude"], 64)
+	if latErr == nil && lonErr == nil {
+		return &geoPoint{latitude: latitude, longitude: longitude}
+	}
+
+	g.mutex.RLock()
+	point, cached := g.nodes[node.IPAddress]
+	g.mutex.RUnlock()
+	if cached {
+		return point
+	}
+
+	point = g.locate(node.IPAddress)
+	g.mutex.Lock()
+	if g.nodes == nil {
+		g.nodes = make(map[string]*geoPoint)
+	}
+	g.nodes[node.IPAddress] = point
+	g.mutex.Unlock()
+	return point
+}
+
+// distanceKm is the great-circle distance between two points
+func distanceKm(a, b *geoPoint) float64 {
+	const earthRadiusKm = 6371.0
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+
+	dLat := toRadians(b.latitude - a.latitude)
+	dLon := toRadians(b.longitude - a.longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(a.latitude))*math.Cos(toRadians(b.latitude))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// routeCandidate is a node the player could be sent to
+type routeCandidate struct {
+	route PlayerRoute
+	load  float64
+}
+
+// RoutePlayer picks the node, and the server on it, a player should connect
+// to: the one with the lowest estimated latency, preferring the requested
+// region and then the least loaded.
+func (nm *NodeManager) RoutePlayer(ctx context.Context, request RouteRequest) (*PlayerRoute, error) {
+	responseTimes := nm.recentResponseTimes(ctx)
+
+	var client *geoPoint
+	if request.Region == "" {
+		client = nm.geoIP.locate(request.ClientIP)
+	}
+
+	nm.nodesMutex.RLock()
+	var candidates []routeCandidate
+	for _, node := range nm.nodes {
+		if node.Status != NodeStatusOnline || node.Connection == nil {
+			continue
+		}
+
+		route := PlayerRoute{
+			NodeID:   node.ID,
+			NodeName: node.Name,
+			Location: node.Location,
+			Address:  node.IPAddress,
+		}
+		load := node.Resources.CPU.UsagePercent
+		if request.ServerID != "" || request.ServerType != "" {
+			server := routeServer(node, request)
+			if server == nil {
+				continue
+			}
+			route.ServerID = server.ID
+			route.Port = server.Port
+			if server.MaxPlayers > 0 {
+				load = float64(server.Players) / float64(server.MaxPlayers) * 100
+			}
+		}
+
+		switch {
+		case request.Region != "" && node.Location == request.Region:
+			route.EstimatedLatency = 0
+		case client != nil:
+			if point := nm.geoIP.locateNode(node); point != nil {
+				route.EstimatedLatency = distanceKm(client, point) / kmPerLatencyMs
+			} else {
+				route.EstimatedLatency = unknownDistanceLatency
+			}
+		default:
+			route.EstimatedLatency = unknownDistanceLatency
+		}
+		route.EstimatedLatency += responseTimes[node.ID]
+
+		candidates = append(candidates, routeCandidate{route: route, load: load})
+	}
+	nm.nodesMutex.RUnlock()
+
+	if len(candidates) == 0 {
+		return nil, ErrNoRoute
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].route.EstimatedLatency != candidates[j].route.EstimatedLatency {
+			return candidates[i].route.EstimatedLatency < candidates[j].route.EstimatedLatency
+		}
+		return candidates[i].load < candidates[j].load
+	})
+	return &candidates[0].route, nil
+}
+
+// routeServer returns the server on the node that matches the request and
+// has room, or nil. The servers and their player counts come from the
+// agent's resource updates.
+func routeServer(node *Node, request RouteRequest) *NodeServer {
+	var best *NodeServer
+	for i := range node.Servers {
+		server := &node.Servers[i]
+		if request.ServerID != "" && server.ID != request.ServerID {
+			continue
+		}
+		if request.ServerType != "" && server.Type != request.ServerType {
+			continue
+		}
+		if server.Status != "running" || (server.MaxPlayers > 0 && server.Players >= server.MaxPlayers) {
+			continue
+		}
+		if best == nil || server.Players < best.Players {
+			best = server
+		}
+	}
+	return best
+}
+
+// recentResponseTimes returns each node's average response time in
+// milliseconds over latencyWindow
+func (nm *NodeManager) recentResponseTimes(ctx context.Context) map[string]float64 {
+	var rows []struct {
+		NodeID       string
+		ResponseTime float64
+	}
+	nm.db.WithContext(ctx).Model(&NodeMetric{}).
+		Select("node_id, AVG(response_time) AS response_time").
+		Where("timestamp > ?", time.Now().Add(-latencyWindow)).
+		Group("node_id").
+		Scan(&rows)
+
+	times := make(map[string]float64, len(rows))
+	for _, row := range rows {
+		times[row.NodeID] = row.ResponseTime
+	}
+	return times
+}
+
+// RouteHandler serves RoutePlayer over HTTP for the frontend or a proxy.
+// The client is the ip query parameter, or the caller itself without one;
+// region, server_id and server_type are passed through.
+func (nm *NodeManager) RouteHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		clientIP := query.Get("ip")
+		if clientIP == "" {
+			clientIP, _, _ = net.SplitHostPort(r.RemoteAddr)
+		}
+
+		route, err := nm.RoutePlayer(r.Context(), RouteRequest{
+			ClientIP:   clientIP,
+			Region:     query.Get("region"),
+			ServerID:   query.Get("server_id"),
+			ServerType: query.Get("server_type"),
+		})
+		if errors.Is(err, ErrNoRoute) {
+			utils.WriteHTTPError(w, r, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if err != nil {
+			utils.WriteHTTPError(w, r, http.StatusInternalServerError, "failed to route player")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(route)
+	}
+}
@@ -0,0 +1,173 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"playpulse-panel/internal/testutil"
+
+	"github.com/gorilla/websocket"
+)
+
+// Client and node networks in the fixture city database
+const (
+	londonClient  = "81.2.69.160"
+	seattleClient = "216.160.83.60"
+	seattleNode   = "216.160.83.57"
+)
+
+var testCities = map[string]testutil.GeoIPNetwork{
+	"81.2.69.0/24":     {Country: "GB", Latitude: 51.5142, Longitude: -0.0931},
+	"216.160.83.56/29": {Country: "US", Latitude: 47.6062, Longitude: -122.3321},
+}
+
+// newRoutingNodeManager returns a manager placing players with the fixture
+// city database and with a connected node in eu-west, placed by its
+// metadata, and one in us-west, placed by its address
+func newRoutingNodeManager(t *testing.T) *NodeManager {
+	t.Helper()
+
+	nm := newTestNodeManager(testDB(t))
+	if err := nm.SetGeoIPDatabase(testutil.WriteGeoIPDatabase(t, testCities)); err != nil {
+		t.Fatalf("SetGeoIPDatabase: %v", err)
+	}
+	t.Cleanup(func() { nm.SetGeoIPDatabase("") })
+
+	addRoutingNode(nm, &Node{
+		ID:        "node-eu",
+		Name:      "frankfurt",
+		Location:  "eu-west",
+		IPAddress: "10.0.0.1",
+		Metadata:  map[string]string{"latitude": "50.1109", "longitude": "8.6821"},
+	})
+	addRoutingNode(nm, &Node{ID: "node-us", Name: "seattle", Location: "us-west", IPAddress: seattleNode})
+	return nm
+}
+
+// addRoutingNode adds an online node with a connection to the manager
+func addRoutingNode(nm *NodeManager, node *Node) {
+	node.Status = NodeStatusOnline
+	node.Connection = &websocket.Conn{}
+	nm.nodes[node.ID] = node
+}
+
+func TestRoutePlayerPicksNearestNode(t *testing.T) {
+	nm := newRoutingNodeManager(t)
+
+	tests := []struct {
+		name     string
+		request  RouteRequest
+		wantNode string
+	}{
+		{"client in Europe", RouteRequest{ClientIP: londonClient}, "node-eu"},
+		{"client in the US", RouteRequest{ClientIP: seattleClient}, "node-us"},
+		{"region hint over the client's location", RouteRequest{ClientIP: londonClient, Region: "us-west"}, "node-us"},
+		{"region hint without an address", RouteRequest{Region: "eu-west"}, "node-eu"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route, err := nm.RoutePlayer(context.Background(), tt.request)
+			if err != nil {
+				t.Fatalf("RoutePlayer: %v", err)
+			}
+			if route.NodeID != tt.wantNode {
+				t.Errorf("routed to %s (%.1fms), want %s", route.NodeID, route.EstimatedLatency, tt.wantNode)
+			}
+		})
+	}
+
+	route, _ := nm.RoutePlayer(context.Background(), RouteRequest{ClientIP: londonClient})
+	if route.EstimatedLatency <= 0 || route.EstimatedLatency >= unknownDistanceLatency {
+		t.Errorf("estimated latency London to Frankfurt = %.1fms", route.EstimatedLatency)
+	}
+}
+
+func TestRoutePlayerFallsBackWhenRegionUnavailable(t *testing.T) {
+	nm := newRoutingNodeManager(t)
+	nm.nodes["node-eu"].Status = NodeStatusFailed
+
+	route, err := nm.RoutePlayer(context.Background(), RouteRequest{ClientIP: londonClient})
+	if err != nil {
+		t.Fatalf("RoutePlayer: %v", err)
+	}
+	if route.NodeID != "node-us" {
+		t.Errorf("routed to %s with the European node down, want node-us", route.NodeID)
+	}
+
+	nm.nodes["node-us"].Connection = nil
+	if _, err := nm.RoutePlayer(context.Background(), RouteRequest{ClientIP: londonClient}); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("RoutePlayer with no connected nodes = %v, want ErrNoRoute", err)
+	}
+}
+
+func TestRoutePlayerPrefersFasterNode(t *testing.T) {
+	nm := newTestNodeManager(testDB(t))
+	now := time.Now()
+	slow := seedNodeMetrics(t, nm, NodeMetric{Timestamp: now.Add(-time.Minute), ResponseTime: 40})
+	fast := seedNodeMetrics(t, nm, NodeMetric{Timestamp: now.Add(-time.Minute), ResponseTime: 5})
+	addRoutingNode(nm, &Node{ID: slow, Location: "eu-west"})
+	addRoutingNode(nm, &Node{ID: fast, Location: "eu-west"})
+
+	route, err := nm.RoutePlayer(context.Background(), RouteRequest{Region: "eu-west"})
+	if err != nil {
+		t.Fatalf("RoutePlayer: %v", err)
+	}
+	if route.NodeID != fast || route.EstimatedLatency != 5 {
+		t.Errorf("routed to %s (%.1fms), want the faster node", route.NodeID, route.EstimatedLatency)
+	}
+}
+
+func TestRoutePlayerPicksServerWithRoom(t *testing.T) {
+	nm := newRoutingNodeManager(t)
+	nm.nodes["node-eu"].Servers = []NodeServer{
+		{ID: "full", Type: "minecraft-paper", Status: "running", Port: 25565, Players: 20, MaxPlayers: 20},
+		{ID: "busy", Type: "minecraft-paper", Status: "running", Port: 25566, Players: 15, MaxPlayers: 20},
+		{ID: "quiet", Type: "minecraft-paper", Status: "running", Port: 25567, Players: 3, MaxPlayers: 20},
+		{ID: "stopped", Type: "minecraft-paper", Status: "stopped", Port: 25568, MaxPlayers: 20},
+		{ID: "modded", Type: "minecraft-forge", Status: "running", Port: 25569, MaxPlayers: 20},
+	}
+
+	route, err := nm.RoutePlayer(context.Background(), RouteRequest{ClientIP: londonClient, ServerType: "minecraft-paper"})
+	if err != nil {
+		t.Fatalf("RoutePlayer: %v", err)
+	}
+	if route.NodeID != "node-eu" || route.ServerID != "quiet" || route.Port != 25567 {
+		t.Errorf("route = %+v, want the emptiest paper server", route)
+	}
+
+	// A node without a matching server isn't a candidate however close
+	if _, err := nm.RoutePlayer(context.Background(), RouteRequest{ClientIP: londonClient, ServerID: "full"}); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("RoutePlayer to a full server = %v, want ErrNoRoute", err)
+	}
+}
+
+func TestRouteHandler(t *testing.T) {
+	nm := newRoutingNodeManager(t)
+	handler := nm.RouteHandler()
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/route?ip="+seattleClient, nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", recorder.Code)
+	}
+	var route PlayerRoute
+	if err := json.NewDecoder(recorder.Body).Decode(&route); err != nil {
+		t.Fatalf("failed to decode the route: %v", err)
+	}
+	if route.NodeID != "node-us" || route.Address != seattleNode {
+		t.Errorf("route = %+v, want node-us", route)
+	}
+
+	// Without nodes the caller is told to retry later
+	nm.nodes = make(map[string]*Node)
+	recorder = httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/route?region=eu-west", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("status without nodes = %d, want 503", recorder.Code)
+	}
+}
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrServerNotFound is returned when a server does not exist
+	ErrServerNotFound = errors.New("server not found")
+	// ErrServerAccessDenied is returned when a user is not associated with a server
+	ErrServerAccessDenied = errors.New("access to server denied")
+	// ErrUserNotFound is returned when access is granted to a user that
+	// does not exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrInvalidServerRole is returned for roles other than owner and member
+	ErrInvalidServerRole = errors.New("invalid server role")
+	// ErrInvalidServerPermission is returned for unknown server permissions
+	ErrInvalidServerPermission = errors.New("invalid server permission")
+	// ErrNoServerAccess is returned when revoking access a user doesn't have
+	ErrNoServerAccess = errors.New("user has no access to this server")
+	// ErrLastServerUser is returned when revoking would leave a server with
+	// no users, or with users but no owner
+	ErrLastServerUser = errors.New("cannot remove the last user or owner of a server")
+)
+
+// GetAccessibleServer loads a server the user may manage. Admins can access
+// every server; other users only servers they are associated with.
+func GetAccessibleServer(user *models.User, serverID uuid.UUID) (*models.Server, error) {
+	var server models.Server
+	err := database.DB.Preload("Users").Where("id = ?", serverID).First(&server).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrServerNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Role == models.RoleAdmin {
+		return &server, nil
+	}
+
+	for _, serverUser := range server.Users {
+		if serverUser.ID == user.ID {
+			return &server, nil
+		}
+	}
+
+	return nil, ErrServerAccessDenied
+}
+
+// GetAccessibleServers returns every server the user may manage
+func GetAccessibleServers(user *models.User) ([]models.Server, error) {
+	var servers []models.Server
+
+	query := database.DB
+	if user.Role != models.RoleAdmin {
+		query = query.Joins("JOIN user_servers ON user_servers.server_id = servers.id").
+			Where("user_servers.user_id = ?", user.ID)
+	}
+
+	if err := query.Find(&servers).Error; err != nil {
+		return nil, err
+	}
+
+	return servers, nil
+}
+
+// ServerAccess is a user's access to a server
+type ServerAccess struct {
+	User        models.User               `json:"user"`
+	Role        models.ServerRole         `json:"role"`
+	Permissions []models.ServerPermission `json:"permissions"`
+	GrantedAt   time.Time                 `json:"granted_at"`
+}
+
+// ServerRoleOf returns the user's role on a server, or "" if they have no
+// access to it
+func ServerRoleOf(userID, serverID uuid.UUID) models.ServerRole {
+	var access models.UserServer
+	if err := database.DB.Where("user_id = ? AND server_id = ?", userID, serverID).First(&access).Error; err != nil {
+		return ""
+	}
+	return access.Role
+}
+
+// HasServerPermission reports whether the user may do something on a
+// server. Admins and owners may do everything, members what they were
+// granted.
+func HasServerPermission(user *models.User, serverID uuid.UUID, permission models.ServerPermission) bool {
+	if user.Role == models.RoleAdmin {
+		return true
+	}
+
+	var access models.UserServer
+	if err := database.DB.Where("user_id = ? AND server_id = ?", user.ID, serverID).First(&access).Error; err != nil {
+		return false
+	}
+	if access.Role == models.ServerRoleOwner {
+		return true
+	}
+	for _, granted := range access.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// GetServerWithPermission loads a server the user may access and do
+// something on, returning ErrServerAccessDenied if they lack the permission
+func GetServerWithPermission(user *models.User, serverID uuid.UUID, permission models.ServerPermission) (*models.Server, error) {
+	server, err := GetAccessibleServer(user, serverID)
+	if err != nil {
+		return nil, err
+	}
+	if !HasServerPermission(user, serverID, permission) {
+		return nil, ErrServerAccessDenied
+	}
+	return server, nil
+}
+
+// CanManageServerAccess reports whether the user may grant, revoke and
+// transfer access to a server: admins and the server's owners
+func CanManageServerAccess(user *models.User, serverID uuid.UUID) bool {
+	return user.Role == models.RoleAdmin || ServerRoleOf(user.ID, serverID) == models.ServerRoleOwner
+}
+
+// CanChangeServerCommand reports whether the user may change what the panel
+// runs on the host for a server: its Java binary, JVM arguments and start
+// command. That amounts to running commands as the panel, so members with
+// the settings permission may not; only admins and the server's owners.
+func CanChangeServerCommand(user *models.User, serverID uuid.UUID) bool {
+	return CanManageServerAccess(user, serverID)
+}
+
+// ListServerAccess returns the users with access to a server, owners first
+func ListServerAccess(serverID uuid.UUID) ([]ServerAccess, error) {
+	var grants []models.UserServer
+	if err := database.DB.Where("server_id = ?", serverID).Order("created_at ASC").Find(&grants).Error; err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]uuid.UUID, 0, len(grants))
+	for _, grant := range grants {
+		userIDs = append(userIDs, grant.UserID)
+	}
+	var users []models.User
+	if err := database.DB.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	usersByID := make(map[uuid.UUID]models.User, len(users))
+	for _, user := range users {
+		user.Password = ""
+		user.TwoFactorSecret = ""
+		usersByID[user.ID] = user
+	}
+
+	access := make([]ServerAccess, 0, len(grants))
+	for _, grant := range grants {
+		if user, exists := usersByID[grant.UserID]; exists {
+			permissions := grant.Permissions
+			if grant.Role == models.ServerRoleOwner {
+				permissions = models.ServerPermissions
+			}
+			access = append(access, ServerAccess{User: user, Role: grant.Role, Permissions: permissions, GrantedAt: grant.CreatedAt})
+		}
+	}
+	sort.SliceStable(access, func(i, j int) bool {
+		return access[i].Role == models.ServerRoleOwner && access[j].Role != models.ServerRoleOwner
+	})
+	return access, nil
+}
+
+// GrantServerAccess gives a user access to a server with a role and, for
+// members, permissions; nil permissions grant them all. A user who already
+// has access gets the new role and permissions. Demoting the only owner is
+// refused like revoking them.
+func GrantServerAccess(serverID, userID uuid.UUID, role models.ServerRole, permissions []models.ServerPermission) error {
+	if role != models.ServerRoleOwner && role != models.ServerRoleMember {
+		return ErrInvalidServerRole
+	}
+	permissions, err := normalizeServerPermissions(role, permissions)
+	if err != nil {
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+
+		var grant models.UserServer
+		err := tx.Where("user_id = ? AND server_id = ?", userID, serverID).First(&grant).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Create(&models.UserServer{UserID: userID, ServerID: serverID, Role: role, Permissions: permissions}).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		if grant.Role == models.ServerRoleOwner && role != models.ServerRoleOwner {
+			if err := checkOtherOwners(tx, serverID, userID); err != nil {
+				return err
+			}
+		}
+		grant.Role = role
+		grant.Permissions = permissions
+		return tx.Model(&grant).Select("role", "permissions").Updates(&grant).Error
+	})
+}
+
+// RevokeServerAccess removes a user's access to a server. The last user and
+// the last owner can't be removed, so a server never ends up with users but
+// nobody to manage them.
+func RevokeServerAccess(serverID, userID uuid.UUID) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var grant models.UserServer
+		err := tx.Where("user_id = ? AND server_id = ?", userID, serverID).First(&grant).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNoServerAccess
+		}
+		if err != nil {
+			return err
+		}
+
+		var others int64
+		if err := tx.Model(&models.UserServer{}).Where("server_id = ? AND user_id <> ?", serverID, userID).Count(&others).Error; err != nil {
+			return err
+		}
+		if others == 0 {
+			return ErrLastServerUser
+		}
+		if grant.Role == models.ServerRoleOwner {
+			if err := checkOtherOwners(tx, serverID, userID); err != nil {
+				return err
+			}
+		}
+
+		return tx.Where("user_id = ? AND server_id = ?", userID, serverID).Delete(&models.UserServer{}).Error
+	})
+}
+
+// TransferServerOwnership makes a user the sole owner of a server. The
+// previous owners keep access as members with every permission.
+func TransferServerOwnership(serverID, newOwnerID uuid.UUID) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.First(&user, newOwnerID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+
+		var previousOwners []models.UserServer
+		err := tx.Where("server_id = ? AND user_id <> ? AND role = ?", serverID, newOwnerID, models.ServerRoleOwner).
+			Find(&previousOwners).Error
+		if err != nil {
+			return err
+		}
+		for _, previous := range previousOwners {
+			previous.Role = models.ServerRoleMember
+			previous.Permissions = models.ServerPermissions
+			if err := tx.Model(&previous).Select("role", "permissions").Updates(&previous).Error; err != nil {
+				return err
+			}
+		}
+
+		var grant models.UserServer
+		err = tx.Where("user_id = ? AND server_id = ?", newOwnerID, serverID).First(&grant).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Create(&models.UserServer{UserID: newOwnerID, ServerID: serverID, Role: models.ServerRoleOwner}).Error
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&grant).Update("role", models.ServerRoleOwner).Error
+	})
+}
+
+// normalizeServerPermissions checks the permissions for a grant. Owners
+// need none stored; members given nil get every permission.
+func normalizeServerPermissions(role models.ServerRole, permissions []models.ServerPermission) ([]models.ServerPermission, error) {
+	if role == models.ServerRoleOwner {
+		return nil, nil
+	}
+	if permissions == nil {
+		return models.ServerPermissions, nil
+	}
+
+	normalized := make([]models.ServerPermission, 0, len(permissions))
+	seen := make(map[models.ServerPermission]bool)
+	for _, permission := range permissions {
+		valid := false
+		for _, known := range models.ServerPermissions {
+			if permission == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidServerPermission, permission)
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			normalized = append(normalized, permission)
+		}
+	}
+	return normalized, nil
+}
+
+// checkOtherOwners returns ErrLastServerUser unless the server has an owner
+// besides the given user
+func checkOtherOwners(tx *gorm.DB, serverID, userID uuid.UUID) error {
+	var owners int64
+	err := tx.Model(&models.UserServer{}).
+		Where("server_id = ? AND user_id <> ? AND role = ?", serverID, userID, models.ServerRoleOwner).
+		Count(&owners).Error
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastServerUser
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// apiKeyPrefix marks panel API keys so they are recognisable in configs and logs
+const apiKeyPrefix = "pp_"
+
+var (
+	// ErrInvalidAPIKey is returned for unknown, expired or revoked keys
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrAPIKeyNotFound is returned when a user's key does not exist
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// CreateAPIKey issues a key for the user and returns the record with the raw
+// key. The raw key is only available here; just its hash is stored.
+func CreateAPIKey(userID uuid.UUID, name string, scope models.APIKeyScope, expiresAt *time.Time) (*models.APIKey, string, error) {
+	var key *models.APIKey
+	var raw string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		key, raw, err = createAPIKey(tx, userID, name, scope, expiresAt)
+		return err
+	})
+	return key, raw, err
+}
+
+// RotateAPIKey replaces one of the user's keys with a new key of the same
+// name, scope and expiry. The old key stops working immediately.
+func RotateAPIKey(userID, keyID uuid.UUID) (*models.APIKey, string, error) {
+	var key *models.APIKey
+	var raw string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var old models.APIKey
+		if err := tx.Where("id = ? AND user_id = ?", keyID, userID).First(&old).Error; err != nil {
+			return ErrAPIKeyNotFound
+		}
+
+		if err := tx.Delete(&old).Error; err != nil {
+			return fmt.Errorf("failed to revoke old key: %v", err)
+		}
+
+		var err error
+		key, raw, err = createAPIKey(tx, userID, old.Name, old.Scope, old.ExpiresAt)
+		return err
+	})
+	return key, raw, err
+}
+
+// RevokeAPIKey deletes one of the user's keys
+func RevokeAPIKey(userID, keyID uuid.UUID) error {
+	result := database.DB.Where("id = ? AND user_id = ?", keyID, userID).Delete(&models.APIKey{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey looks up a raw key and returns it with its active owner
+func AuthenticateAPIKey(raw string) (*models.APIKey, *models.User, error) {
+	var key models.APIKey
+	if err := database.DB.Where("key_hash = ?", utils.HashToken(raw)).First(&key).Error; err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ? AND is_active = ?", key.UserID, true).First(&user).Error; err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	// Update last used at most once a minute
+	if key.LastUsed == nil || now.Sub(*key.LastUsed) > time.Minute {
+		database.DB.Model(&key).Update("last_used", now)
+	}
+
+	return &key, &user, nil
+}
+
+func createAPIKey(tx *gorm.DB, userID uuid.UUID, name string, scope models.APIKeyScope, expiresAt *time.Time) (*models.APIKey, string, error) {
+	secret, err := utils.GenerateRandomString(40)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate key: %v", err)
+	}
+	raw := apiKeyPrefix + secret
+
+	key := models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    raw[:len(apiKeyPrefix)+6],
+		KeyHash:   utils.HashToken(raw),
+		Scope:     scope,
+		ExpiresAt: expiresAt,
+	}
+	if err := tx.Create(&key).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to save key: %v", err)
+	}
+
+	return &key, raw, nil
+}
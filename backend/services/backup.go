@@ -2,11 +2,15 @@ package services
 
 import (
 	"archive/zip"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"playpulse-panel/config"
@@ -17,19 +21,66 @@ import (
 	"github.com/google/uuid"
 )
 
-// BackupService handles server backups
+// BackupService handles server backups. Backups run on a fixed pool of
+// workers so a burst of requests queues instead of thrashing the disk.
 type BackupService struct {
 	config *config.Config
+	keys   map[string][]byte // derived encryption keys by key ID
+
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	queue   []backupJob
+	running int
+	stopped bool // set by StopBackups; no new backups are accepted
+}
+
+// backupJob is a queued backup. onComplete runs after a successful backup.
+type backupJob struct {
+	server     models.Server
+	backup     models.Backup
+	onComplete func(server *models.Server, backup *models.Backup)
 }
 
 var backupService *BackupService
 
+var (
+	// ErrServerRunning is returned when a restore is attempted on a running server without force
+	ErrServerRunning = errors.New("server is running")
+	// ErrBackupsStopped is returned for backups requested after shutdown began
+	ErrBackupsStopped = errors.New("backups are not accepted while the panel shuts down")
+)
+
 // InitializeBackupService initializes the backup service
 func InitializeBackupService(cfg *config.Config) {
 	backupService = &BackupService{
 		config: cfg,
 	}
-	
+	backupService.cond = sync.NewCond(&backupService.mutex)
+
+	keys, err := deriveBackupKeys(cfg.Files.BackupKeys)
+	if err != nil {
+		log.Printf("Invalid backup encryption keys left out, backups using them can't be created or restored: %v", err)
+	}
+	backupService.keys = keys
+	if _, exists := keys[cfg.Files.BackupKeyID]; cfg.Files.BackupKeyID != "" && !exists {
+		log.Printf("Backup encryption key %s is not configured, backups will fail until it is", cfg.Files.BackupKeyID)
+	}
+
+	// Backups half written by an unclean exit will never finish
+	database.DB.Model(&models.Backup{}).
+		Where("status = ?", models.BackupStatusCreating).
+		Update("status", models.BackupStatusFailed)
+
+	workers := cfg.Files.BackupConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go backupService.worker()
+	}
+
+	backupService.resumeQueued()
+
 	// Start backup scheduler
 	go backupService.startScheduler()
 }
@@ -40,70 +91,135 @@ func CreateBackup(server *models.Server, backupName string) error {
 		return fmt.Errorf("server is nil")
 	}
 
+	if !backupService.accepting() {
+		return ErrBackupsStopped
+	}
+
 	// Create backup record
 	backup := models.Backup{
 		ServerID:    server.ID,
 		Name:        backupName,
 		Description: fmt.Sprintf("Backup created at %s", time.Now().Format("2006-01-02 15:04:05")),
 		Type:        models.BackupTypeManual,
-		Status:      models.BackupStatusCreating,
+		Status:      models.BackupStatusQueued,
 	}
 
 	if err := database.DB.Create(&backup).Error; err != nil {
 		return fmt.Errorf("failed to create backup record: %v", err)
 	}
 
-	// Create backup in background
-	go func() {
-		if err := backupService.performBackup(server, &backup); err != nil {
-			backup.Status = models.BackupStatusFailed
-			database.DB.Save(&backup)
-			return
+	// Create backup in background once a worker is free
+	if err := backupService.enqueue(backupJob{server: *server, backup: backup}); err != nil {
+		database.DB.Model(&backup).Update("status", models.BackupStatusFailed)
+		return err
+	}
+
+	return nil
+}
+
+// StopBackups stops accepting backups and waits for running backups to finish
+// or ctx to expire. Backups still queued stay queued and resume on restart
+func StopBackups(ctx context.Context) error {
+	if backupService == nil {
+		return nil
+	}
+
+	bs := backupService
+	bs.mutex.Lock()
+	bs.stopped = true
+	bs.queue = nil
+	bs.mutex.Unlock()
+
+	// Wake idle workers so they exit
+	bs.cond.Broadcast()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if _, running := BackupQueueStats(); running == 0 {
+			return nil
 		}
 
-		backup.Status = models.BackupStatusCompleted
-		database.DB.Save(&backup)
-	}()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
 
-	return nil
+// BackupQueueStats returns how many backups are waiting and how many are running
+func BackupQueueStats() (queued, running int) {
+	if backupService == nil {
+		return 0, 0
+	}
+
+	backupService.mutex.Lock()
+	defer backupService.mutex.Unlock()
+	return len(backupService.queue), backupService.running
 }
 
-// RestoreBackup restores a server from a backup
-func RestoreBackup(server *models.Server, backupID uuid.UUID) error {
+// RestoreBackup restores a server from a backup. The current server directory
+// is first captured as a pre-restore backup so the restore can be undone.
+// A running server is only stopped when force is set. The server's lock is
+// held throughout, so it can't be started, stopped or restored concurrently.
+func RestoreBackup(server *models.Server, backupID uuid.UUID, force bool) (*models.Backup, error) {
 	var backup models.Backup
 	if err := database.DB.First(&backup, backupID).Error; err != nil {
-		return fmt.Errorf("backup not found: %v", err)
+		return nil, fmt.Errorf("backup not found: %v", err)
 	}
 
 	if backup.ServerID != server.ID {
-		return fmt.Errorf("backup does not belong to this server")
+		return nil, fmt.Errorf("backup does not belong to this server")
 	}
 
 	if backup.Status != models.BackupStatusCompleted {
-		return fmt.Errorf("backup is not completed")
+		return nil, fmt.Errorf("backup is not completed")
 	}
 
-	// Stop server if running
-	wasRunning := server.Status == models.ServerStatusRunning
-	if wasRunning {
-		if err := StopServer(server); err != nil {
-			return fmt.Errorf("failed to stop server: %v", err)
+	// Check the backup can be decrypted before stopping or snapshotting anything
+	if _, exists := backupService.keys[backup.EncryptionKeyID]; backup.EncryptionKeyID != "" && !exists {
+		return nil, fmt.Errorf("%w: %s", ErrBackupKeyUnavailable, backup.EncryptionKeyID)
+	}
+
+	// Hold the server's lock until the restore is done so nothing starts it
+	// while its files are being replaced, and check the status it has now
+	// rather than the one the caller loaded
+	unlock := lockServer(server.ID)
+	defer unlock()
+	refreshServerState(server)
+
+	// Refuse to clobber a running or stopping server unless explicitly forced
+	wasRunning := server.Status == models.ServerStatusRunning || server.Status == models.ServerStatusStarting
+	if wasRunning || server.Status == models.ServerStatusStopping || hasProcess(server.ID) {
+		if !force {
+			return nil, ErrServerRunning
 		}
+		if err := stopServer(server); err != nil {
+			return nil, fmt.Errorf("failed to stop server: %v", err)
+		}
+	}
+
+	// Snapshot the current state as a regular backup row
+	snapshot, err := backupService.createPreRestoreSnapshot(server, &backup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot server before restore: %v", err)
 	}
 
 	// Perform restore
 	if err := backupService.performRestore(server, &backup); err != nil {
-		return fmt.Errorf("failed to restore backup: %v", err)
+		return snapshot, fmt.Errorf("failed to restore backup: %v", err)
 	}
 
 	// Start server if it was running
 	if wasRunning {
-		if err := StartServer(server); err != nil {
-			return fmt.Errorf("failed to start server after restore: %v", err)
+		if err := startServer(server); err != nil {
+			return snapshot, fmt.Errorf("failed to start server after restore: %v", err)
 		}
 	}
 
-	return nil
+	return snapshot, nil
 }
 
 // DeleteBackup deletes a backup
@@ -135,10 +251,12 @@ func GetServerBackups(serverID uuid.UUID) ([]models.Backup, error) {
 	return backups, err
 }
 
-// CleanupOldBackups removes old backups based on retention policy
+// CleanupOldBackups removes old backups based on retention policy. Manual
+// backups don't count against the limit and are never pruned; users delete
+// them themselves.
 func CleanupOldBackups(serverID uuid.UUID, maxBackups int) error {
 	var backups []models.Backup
-	err := database.DB.Where("server_id = ? AND status = ?", serverID, models.BackupStatusCompleted).
+	err := database.DB.Where("server_id = ? AND status = ? AND type <> ?", serverID, models.BackupStatusCompleted, models.BackupTypeManual).
 		Order("created_at DESC").Find(&backups).Error
 	if err != nil {
 		return err
@@ -160,20 +278,108 @@ func CleanupOldBackups(serverID uuid.UUID, maxBackups int) error {
 
 // Internal methods
 
-func (bs *BackupService) performBackup(server *models.Server, backup *models.Backup) error {
+func (bs *BackupService) accepting() bool {
+	bs.mutex.Lock()
+	defer bs.mutex.Unlock()
+	return !bs.stopped
+}
+
+func (bs *BackupService) enqueue(job backupJob) error {
+	bs.mutex.Lock()
+	if bs.stopped {
+		bs.mutex.Unlock()
+		return ErrBackupsStopped
+	}
+	bs.queue = append(bs.queue, job)
+	bs.mutex.Unlock()
+
+	bs.cond.Signal()
+	return nil
+}
+
+// worker runs queued backups one at a time, oldest first, until StopBackups
+func (bs *BackupService) worker() {
+	for {
+		bs.mutex.Lock()
+		for len(bs.queue) == 0 && !bs.stopped {
+			bs.cond.Wait()
+		}
+		if len(bs.queue) == 0 {
+			bs.mutex.Unlock()
+			return
+		}
+		job := bs.queue[0]
+		bs.queue = bs.queue[1:]
+		bs.running++
+		bs.mutex.Unlock()
+
+		bs.runJob(&job)
+
+		bs.mutex.Lock()
+		bs.running--
+		bs.mutex.Unlock()
+	}
+}
+
+func (bs *BackupService) runJob(job *backupJob) {
+	job.backup.Status = models.BackupStatusCreating
+	database.DB.Save(&job.backup)
+
+	if err := bs.performBackup(&job.server, &job.backup); err != nil {
+		job.backup.Status = models.BackupStatusFailed
+		database.DB.Save(&job.backup)
+		return
+	}
+
+	job.backup.Status = models.BackupStatusCompleted
+	database.DB.Save(&job.backup)
+
+	NotifyBackupCompleted(&job.server, &job.backup)
+
+	if job.onComplete != nil {
+		job.onComplete(&job.server, &job.backup)
+	}
+}
+
+func (bs *BackupService) performBackup(server *models.Server, backup *models.Backup) (err error) {
+	defer func() { recordBackupResult(backup.Type, err) }()
+
 	// Create backup directory
 	backupDir := filepath.Join(bs.config.Files.BackupPath, server.ID.String())
 	if err := utils.CreateDirectory(backupDir); err != nil {
 		return fmt.Errorf("failed to create backup directory: %v", err)
 	}
 
-	// Generate backup filename
+	// Generate backup filename. The ID keeps a snapshot taken in the same
+	// second from overwriting the archive it is about to replace.
 	timestamp := time.Now().Format("20060102-150405")
-	backupFilename := fmt.Sprintf("%s-%s.zip", server.Name, timestamp)
+	backupFilename := fmt.Sprintf("%s-%s-%s.zip", server.Name, timestamp, backup.ID.String()[:8])
+	keyID := bs.config.Files.BackupKeyID
+	if keyID != "" {
+		backupFilename += ".enc"
+	}
 	backupPath := filepath.Join(backupDir, backupFilename)
 
+	// Snapshots taken before a restore or import must capture everything, as
+	// restoring one replaces the whole server directory
+	filter := newBackupFilter(server)
+	if backup.Type == models.BackupTypePreRestore || backup.Type == models.BackupTypePreImport {
+		filter = nil
+	}
+	if filter != nil {
+		backup.Partial = true
+		backup.Include = server.BackupInclude
+		backup.Exclude = server.BackupExclude
+	}
+
 	// Create backup zip file
-	if err := bs.createZipBackup(server.Path, backupPath); err != nil {
+	if keyID != "" {
+		err = bs.createEncryptedBackup(server.Path, backupPath, filter, keyID)
+	} else {
+		err = bs.createZipBackup(server.Path, backupPath, filter)
+	}
+	if err != nil {
+		os.Remove(backupPath)
 		return fmt.Errorf("failed to create zip backup: %v", err)
 	}
 
@@ -186,56 +392,204 @@ func (bs *BackupService) performBackup(server *models.Server, backup *models.Bac
 	// Update backup record
 	backup.Path = backupPath
 	backup.Size = size
+	backup.EncryptionKeyID = keyID
+
+	// Read the archive back now so a corrupt backup isn't found at restore
+	// time. If it merely can't be read right now the backup is kept
+	// unverified, and verifying it later records the checksum.
+	if err := verifyBackupArchive(backup); err != nil {
+		if errors.Is(err, ErrBackupCorrupt) {
+			return err
+		}
+		log.Printf("Backup %s could not be verified after creation: %v", backup.Name, err)
+		return nil
+	}
+	verifiedAt := time.Now()
+	backup.VerifiedAt = &verifiedAt
 
 	return nil
 }
 
+func (bs *BackupService) createPreRestoreSnapshot(server *models.Server, restoring *models.Backup) (*models.Backup, error) {
+	return bs.createSnapshot(server, models.BackupTypePreRestore, "pre-restore",
+		fmt.Sprintf("Automatic snapshot taken before restoring %s", restoring.Name))
+}
+
+// createSnapshot synchronously backs up the server before a destructive change
+func (bs *BackupService) createSnapshot(server *models.Server, backupType models.BackupType, namePrefix, description string) (*models.Backup, error) {
+	snapshot := models.Backup{
+		ServerID:    server.ID,
+		Name:        fmt.Sprintf("%s-%s", namePrefix, time.Now().Format("20060102-150405")),
+		Description: description,
+		Type:        backupType,
+		Status:      models.BackupStatusCreating,
+	}
+
+	if err := database.DB.Create(&snapshot).Error; err != nil {
+		return nil, fmt.Errorf("failed to create backup record: %v", err)
+	}
+
+	if err := bs.performBackup(server, &snapshot); err != nil {
+		snapshot.Status = models.BackupStatusFailed
+		database.DB.Save(&snapshot)
+		return nil, err
+	}
+
+	snapshot.Status = models.BackupStatusCompleted
+	database.DB.Save(&snapshot)
+
+	return &snapshot, nil
+}
+
 func (bs *BackupService) performRestore(server *models.Server, backup *models.Backup) error {
-	// Create temporary restore directory
-	tempDir := filepath.Join(os.TempDir(), "playpulse-restore-"+uuid.New().String())
+	if backup.Partial {
+		return bs.performPartialRestore(server, backup)
+	}
+
+	// Extract next to the server directory so the final swap is a same-filesystem rename
+	tempDir := server.Path + ".restore-" + uuid.New().String()
 	if err := utils.CreateDirectory(tempDir); err != nil {
 		return fmt.Errorf("failed to create temp directory: %v", err)
 	}
 	defer os.RemoveAll(tempDir)
 
 	// Extract backup to temp directory
-	if err := bs.extractZipBackup(backup.Path, tempDir); err != nil {
+	if err := bs.extractBackup(backup, tempDir); err != nil {
 		return fmt.Errorf("failed to extract backup: %v", err)
 	}
 
-	// Backup current server directory
-	currentBackupPath := server.Path + ".bak." + time.Now().Format("20060102-150405")
-	if err := os.Rename(server.Path, currentBackupPath); err != nil {
-		return fmt.Errorf("failed to backup current server directory: %v", err)
+	// Move the current directory out of the way
+	previousPath := server.Path + ".previous-" + time.Now().Format("20060102-150405")
+	if err := os.Rename(server.Path, previousPath); err != nil {
+		return fmt.Errorf("failed to move current server directory: %v", err)
 	}
 
 	// Move restored files to server directory
 	if err := os.Rename(tempDir, server.Path); err != nil {
 		// Restore original directory on failure
-		os.Rename(currentBackupPath, server.Path)
+		os.Rename(previousPath, server.Path)
 		return fmt.Errorf("failed to restore server directory: %v", err)
 	}
 
-	// Remove backup of current directory
-	go func() {
-		time.Sleep(5 * time.Minute)
-		os.RemoveAll(currentBackupPath)
-	}()
+	// The pre-restore snapshot holds the old state, so the directory can go
+	if err := os.RemoveAll(previousPath); err != nil {
+		return fmt.Errorf("failed to remove previous server directory: %v", err)
+	}
 
 	return nil
 }
 
-func (bs *BackupService) createZipBackup(sourceDir, backupPath string) error {
+// performPartialRestore restores a backup taken with include or exclude
+// patterns. Only the files the backup covers are replaced: those its
+// patterns select are removed and the archived ones put in their place, so
+// whatever it left out stays as it is.
+func (bs *BackupService) performPartialRestore(server *models.Server, backup *models.Backup) error {
+	tempDir := server.Path + ".restore-" + uuid.New().String()
+	if err := utils.CreateDirectory(tempDir); err != nil {
+		return fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := bs.extractBackup(backup, tempDir); err != nil {
+		return fmt.Errorf("failed to extract backup: %v", err)
+	}
+
+	filter := &backupFilter{
+		include: splitBackupPatterns(backup.Include),
+		exclude: splitBackupPatterns(backup.Exclude),
+	}
+	err := filepath.Walk(server.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(server.Path, path)
+		if err != nil || relativePath == "." {
+			return err
+		}
+
+		if bs.shouldSkipFile(relativePath) || filter.skip(relativePath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		return os.Remove(path)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove files covered by the backup: %v", err)
+	}
+
+	err = filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(tempDir, path)
+		if err != nil || relativePath == "." {
+			return err
+		}
+
+		target := filepath.Join(server.Path, relativePath)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return os.Rename(path, target)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore files: %v", err)
+	}
+	return nil
+}
+
+// createZipBackup archives sourceDir into backupPath, leaving out what
+// shouldSkipFile and the optional filter reject
+func (bs *BackupService) createZipBackup(sourceDir, backupPath string, filter *backupFilter) error {
 	zipFile, err := os.Create(backupPath)
 	if err != nil {
 		return err
 	}
-	defer zipFile.Close()
 
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
+	if err := bs.writeZipBackup(sourceDir, zipFile, filter); err != nil {
+		zipFile.Close()
+		return err
+	}
+	return zipFile.Close()
+}
+
+// createEncryptedBackup archives sourceDir like createZipBackup, encrypting
+// the archive with the key keyID as it is written
+func (bs *BackupService) createEncryptedBackup(sourceDir, backupPath string, filter *backupFilter, keyID string) error {
+	key, exists := bs.keys[keyID]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrBackupKeyUnavailable, keyID)
+	}
+
+	file, err := os.Create(backupPath)
+	if err != nil {
+		return err
+	}
+
+	encrypter, err := newBackupEncrypter(file, keyID, key)
+	if err == nil {
+		err = bs.writeZipBackup(sourceDir, encrypter, filter)
+	}
+	if err == nil {
+		err = encrypter.Close()
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeZipBackup writes the archive of sourceDir to w
+func (bs *BackupService) writeZipBackup(sourceDir string, w io.Writer, filter *backupFilter) error {
+	zipWriter := zip.NewWriter(w)
 
-	return filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -246,8 +600,12 @@ func (bs *BackupService) createZipBackup(sourceDir, backupPath string) error {
 			return err
 		}
 
-		// Skip temporary files and logs (optional)
-		if bs.shouldSkipFile(relativePath) {
+		if relativePath == "." {
+			return nil
+		}
+
+		// Skip temporary files and logs, and whatever the server's patterns leave out
+		if bs.shouldSkipFile(relativePath) || filter.skip(relativePath, info.IsDir()) {
 			if info.IsDir() {
 				return filepath.SkipDir
 			}
@@ -272,16 +630,66 @@ func (bs *BackupService) createZipBackup(sourceDir, backupPath string) error {
 		_, err = io.Copy(zipFileWriter, file)
 		return err
 	})
+	if err != nil {
+		zipWriter.Close()
+		return err
+	}
+	return zipWriter.Close()
 }
 
 func (bs *BackupService) extractZipBackup(backupPath, destDir string) error {
-	reader, err := zip.OpenReader(backupPath)
+	return extractZip(backupPath, destDir)
+}
+
+// extractBackup extracts a backup's archive into destDir, decrypting it if
+// it is encrypted
+func (bs *BackupService) extractBackup(backup *models.Backup, destDir string) error {
+	reader, closer, err := bs.openBackupArchive(backup.Path, backup.EncryptionKeyID)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	return extractZipFiles(reader.File, destDir)
+}
+
+// openBackupArchive opens a backup archive for reading, decrypting it with
+// the key keyID when set. Closing the closer releases the file.
+func (bs *BackupService) openBackupArchive(path, keyID string) (*zip.Reader, io.Closer, error) {
+	if keyID == "" {
+		reader, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &reader.Reader, reader, nil
+	}
+
+	archive, err := openEncryptedBackup(path, bs.keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := zip.NewReader(archive, archive.Size())
+	if err != nil {
+		archive.Close()
+		return nil, nil, err
+	}
+	return reader, archive, nil
+}
+
+// extractZip extracts a zip archive into destDir, rejecting entries that
+// would escape it
+func extractZip(archivePath, destDir string) error {
+	reader, err := zip.OpenReader(archivePath)
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
 
-	for _, file := range reader.File {
+	return extractZipFiles(reader.File, destDir)
+}
+
+func extractZipFiles(files []*zip.File, destDir string) error {
+	for _, file := range files {
 		path := filepath.Join(destDir, file.Name)
 
 		// Ensure the file path is within the destination directory
@@ -340,7 +748,7 @@ func (bs *BackupService) shouldSkipFile(relativePath string) bool {
 }
 
 func (bs *BackupService) startScheduler() {
-	ticker := time.NewTicker(1 * time.Hour)
+	ticker := time.NewTicker(backupCheckInterval)
 	defer ticker.Stop()
 
 	for range ticker.C {
@@ -362,41 +770,70 @@ func (bs *BackupService) performScheduledBackups() {
 				Name:        backupName,
 				Description: "Scheduled automatic backup",
 				Type:        models.BackupTypeScheduled,
-				Status:      models.BackupStatusCreating,
+				Status:      models.BackupStatusQueued,
 			}
 
 			if err := database.DB.Create(&backup).Error; err != nil {
 				continue
 			}
 
-			go func(s models.Server, b models.Backup) {
-				if err := bs.performBackup(&s, &b); err != nil {
-					b.Status = models.BackupStatusFailed
-					database.DB.Save(&b)
-					return
-				}
+			err := bs.enqueue(backupJob{
+				server:     server,
+				backup:     backup,
+				onComplete: scheduledBackupComplete,
+			})
+			if err != nil {
+				database.DB.Model(&backup).Update("status", models.BackupStatusFailed)
+				return
+			}
+		}
+	}
+}
+
+// scheduledBackupComplete records a finished scheduled backup and prunes old ones
+func scheduledBackupComplete(s *models.Server, b *models.Backup) {
+	// Update server's last backup time
+	database.DB.Model(s).Update("last_backup", b.CreatedAt)
+
+	// Clean up old backups
+	CleanupOldBackups(s.ID, backupRetention(s))
+}
 
-				b.Status = models.BackupStatusCompleted
-				database.DB.Save(&b)
+// resumeQueued re-queues backups that were still waiting when the panel last
+// stopped, oldest first
+func (bs *BackupService) resumeQueued() {
+	var backups []models.Backup
+	if err := database.DB.Where("status = ?", models.BackupStatusQueued).Order("created_at").Find(&backups).Error; err != nil {
+		log.Printf("Failed to load queued backups: %v", err)
+		return
+	}
 
-				// Update server's last backup time
-				s.LastBackup = &b.CreatedAt
-				database.DB.Save(&s)
+	for _, backup := range backups {
+		var server models.Server
+		if err := database.DB.First(&server, backup.ServerID).Error; err != nil {
+			database.DB.Model(&backup).Update("status", models.BackupStatusFailed)
+			continue
+		}
 
-				// Clean up old backups
-				CleanupOldBackups(s.ID, 10) // Keep last 10 backups
-			}(server, backup)
+		job := backupJob{server: server, backup: backup}
+		if backup.Type == models.BackupTypeScheduled {
+			job.onComplete = scheduledBackupComplete
+		}
+		if err := bs.enqueue(job); err != nil {
+			database.DB.Model(&backup).Update("status", models.BackupStatusFailed)
 		}
 	}
 }
 
 func (bs *BackupService) needsBackup(server *models.Server) bool {
-	// Backup every 24 hours
-	backupInterval := 24 * time.Hour
-
-	if server.LastBackup == nil {
-		return true
+	// A backup still waiting in the queue or running counts as taken
+	var pending int64
+	database.DB.Model(&models.Backup{}).
+		Where("server_id = ? AND status IN ?", server.ID, []models.BackupStatus{models.BackupStatusQueued, models.BackupStatusCreating}).
+		Count(&pending)
+	if pending > 0 {
+		return false
 	}
 
-	return time.Since(*server.LastBackup) >= backupInterval
+	return backupDue(server, time.Now())
 }
\ No newline at end of file
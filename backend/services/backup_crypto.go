@@ -0,0 +1,324 @@
+package services
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Encrypted backups are a header followed by the zip archive in chunks,
+// each sealed with AES-256-GCM. The header is:
+//
+//	"PPBK" | version (1) | key ID length (1) | key ID | nonce prefix (7)
+//
+// Chunk n is sealed with the nonce prefix | n as uint32 | 1 on the last
+// chunk, else 0, and the header as additional data. The counter and flag
+// stop chunks being reordered or the archive truncated, and fixed size
+// chunks let the archive be read at any offset, as zip needs.
+const (
+	backupCryptoMagic   = "PPBK"
+	backupCryptoVersion = 1
+	// backupChunkSize is the plaintext size of every chunk but the last
+	backupChunkSize = 64 << 10
+	// backupNoncePrefixSize leaves 5 bytes of the 12 byte nonce for the
+	// chunk counter and last chunk flag
+	backupNoncePrefixSize = 7
+	// backupKeyInfo separates keys derived for backups from other uses of
+	// the same secret
+	backupKeyInfo = "playpulse-panel backup encryption v1"
+)
+
+var (
+	// ErrBackupKeyUnavailable is returned for backups encrypted with a key
+	// ID that isn't configured
+	ErrBackupKeyUnavailable = errors.New("backup encryption key is not configured")
+	// ErrBackupDecrypt is returned when a backup doesn't decrypt with the
+	// configured key for its ID
+	ErrBackupDecrypt = errors.New("backup could not be decrypted with the configured key")
+)
+
+// deriveBackupKeys turns the configured secrets into AES-256 keys by key ID.
+// An invalid entry doesn't cost the others: every valid key is returned,
+// along with an error naming the ones left out.
+func deriveBackupKeys(secrets map[string]string) (map[string][]byte, error) {
+	keys := make(map[string][]byte, len(secrets))
+	var invalid []string
+	for id, secret := range secrets {
+		if id == "" || len(id) > 255 {
+			invalid = append(invalid, fmt.Sprintf("backup key ID %q must be 1 to 255 bytes", id))
+			continue
+		}
+		if secret == "" {
+			invalid = append(invalid, fmt.Sprintf("backup key %s has no secret", id))
+			continue
+		}
+
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), []byte(id), []byte(backupKeyInfo)), key); err != nil {
+			invalid = append(invalid, fmt.Sprintf("backup key %s: %v", id, err))
+			continue
+		}
+		keys[id] = key
+	}
+
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return keys, errors.New(strings.Join(invalid, "; "))
+	}
+	return keys, nil
+}
+
+func newBackupAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce of a chunk
+func chunkNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[backupNoncePrefixSize:], index)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// backupEncrypter encrypts everything written to it onto w. Close writes
+// the last chunk, so an archive not closed can't be decrypted.
+type backupEncrypter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	index  uint32
+	buffer []byte
+}
+
+// newBackupEncrypter writes the header for keyID and returns a writer
+// encrypting onto w
+func newBackupEncrypter(w io.Writer, keyID string, key []byte) (*backupEncrypter, error) {
+	aead, err := newBackupAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, backupNoncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+
+	header := []byte(backupCryptoMagic)
+	header = append(header, backupCryptoVersion, byte(len(keyID)))
+	header = append(header, keyID...)
+	header = append(header, prefix...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &backupEncrypter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		prefix: prefix,
+		buffer: make([]byte, 0, backupChunkSize),
+	}, nil
+}
+
+func (be *backupEncrypter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data follows, as the last
+		// chunk must be sealed as such
+		if len(be.buffer) == backupChunkSize {
+			if err := be.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(be.buffer[len(be.buffer):backupChunkSize], p)
+		be.buffer = be.buffer[:len(be.buffer)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close seals the last chunk. It doesn't close the underlying writer.
+func (be *backupEncrypter) Close() error {
+	return be.seal(true)
+}
+
+func (be *backupEncrypter) seal(last bool) error {
+	if be.index == ^uint32(0) {
+		return errors.New("backup too large to encrypt")
+	}
+	sealed := be.aead.Seal(nil, chunkNonce(be.prefix, be.index, last), be.buffer, be.header)
+	be.index++
+	be.buffer = be.buffer[:0]
+	_, err := be.w.Write(sealed)
+	return err
+}
+
+// encryptedBackup reads the plaintext of an encrypted backup at any offset,
+// decrypting the chunks it needs
+type encryptedBackup struct {
+	file   *os.File
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	chunks int64
+	size   int64 // of the plaintext
+
+	mutex  sync.Mutex
+	cached int64 // index of the chunk in plain, -1 for none
+	plain  []byte
+}
+
+// errNotEncrypted is returned by readBackupHeader for files without an
+// encryption header
+var errNotEncrypted = errors.New("backup is not encrypted")
+
+// readBackupHeader reads the encryption header from the start of a file
+func readBackupHeader(file *os.File) ([]byte, error) {
+	fixed := make([]byte, 6)
+	if _, err := io.ReadFull(file, fixed); err != nil || !bytes.Equal(fixed[:4], []byte(backupCryptoMagic)) {
+		return nil, errNotEncrypted
+	}
+	if fixed[4] != backupCryptoVersion {
+		return nil, fmt.Errorf("unsupported backup encryption version %d", fixed[4])
+	}
+
+	rest := make([]byte, int(fixed[5])+backupNoncePrefixSize)
+	if _, err := io.ReadFull(file, rest); err != nil {
+		return nil, fmt.Errorf("%w: truncated encryption header", ErrBackupCorrupt)
+	}
+	return append(fixed, rest...), nil
+}
+
+// openEncryptedBackup opens an encrypted backup with the key for its ID
+func openEncryptedBackup(path string, keys map[string][]byte) (*encryptedBackup, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	eb, err := newEncryptedBackup(file, keys)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return eb, nil
+}
+
+func newEncryptedBackup(file *os.File, keys map[string][]byte) (*encryptedBackup, error) {
+	header, err := readBackupHeader(file)
+	if err != nil {
+		return nil, err
+	}
+	keyID := string(header[6 : 6+header[5]])
+	key, exists := keys[keyID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrBackupKeyUnavailable, keyID)
+	}
+	aead, err := newBackupAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	sealedChunk := int64(backupChunkSize + aead.Overhead())
+	body := info.Size() - int64(len(header))
+	if body < int64(aead.Overhead()) {
+		return nil, fmt.Errorf("%w: truncated encrypted archive", ErrBackupCorrupt)
+	}
+	chunks := (body + sealedChunk - 1) / sealedChunk
+
+	eb := &encryptedBackup{
+		file:   file,
+		aead:   aead,
+		header: header,
+		prefix: header[len(header)-backupNoncePrefixSize:],
+		chunks: chunks,
+		size:   body - chunks*int64(aead.Overhead()),
+		cached: -1,
+	}
+
+	// The last chunk carries the flag, so decrypting it catches truncation
+	// and a wrong key before anything is read
+	if _, err := eb.chunk(chunks - 1); err != nil {
+		return nil, err
+	}
+	return eb, nil
+}
+
+// Size returns the length of the plaintext archive
+func (eb *encryptedBackup) Size() int64 {
+	return eb.size
+}
+
+func (eb *encryptedBackup) ReadAt(p []byte, off int64) (int, error) {
+	eb.mutex.Lock()
+	defer eb.mutex.Unlock()
+
+	read := 0
+	for read < len(p) {
+		if off >= eb.size {
+			return read, io.EOF
+		}
+		plain, err := eb.chunk(off / backupChunkSize)
+		if err != nil {
+			return read, err
+		}
+		n := copy(p[read:], plain[off%backupChunkSize:])
+		read += n
+		off += int64(n)
+	}
+	return read, nil
+}
+
+// chunk returns the plaintext of a chunk. The caller holds the mutex, except
+// when opening.
+func (eb *encryptedBackup) chunk(index int64) ([]byte, error) {
+	if index == eb.cached {
+		return eb.plain, nil
+	}
+
+	sealedChunk := int64(backupChunkSize + eb.aead.Overhead())
+	sealed := make([]byte, sealedChunk)
+	n, err := eb.file.ReadAt(sealed, int64(len(eb.header))+index*sealedChunk)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	last := index == eb.chunks-1
+	plain, err := eb.aead.Open(eb.plain[:0], chunkNonce(eb.prefix, uint32(index), last), sealed[:n], eb.header)
+	if err != nil {
+		eb.cached = -1
+		return nil, ErrBackupDecrypt
+	}
+	eb.plain = plain
+	eb.cached = index
+	return plain, nil
+}
+
+func (eb *encryptedBackup) Close() error {
+	return eb.file.Close()
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+)
+
+// backupSecret is a value the test server's files hold that must not
+// appear in an encrypted backup
+const backupSecret = "rcon-password-4f9c2d"
+
+// writeBackupSource writes a server directory with a config holding
+// backupSecret and a world file spanning several encryption chunks
+func writeBackupSource(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+
+	world := make([]byte, 3*backupChunkSize+123)
+	rand.New(rand.NewSource(1)).Read(world)
+	files := map[string][]byte{
+		"server.properties":      []byte("enable-rcon=true\nrcon.password=" + backupSecret + "\n"),
+		"world/region/r.0.0.mca": world,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+// testBackupKeys derives keys from secrets by key ID, failing on any error
+func testBackupKeys(t *testing.T, secrets map[string]string) map[string][]byte {
+	t.Helper()
+
+	keys, err := deriveBackupKeys(secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// checkRestoredFiles checks dir holds exactly the files written
+func checkRestoredFiles(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s restored as %d bytes (%v), want the original %d", name, len(got), err, len(want))
+		}
+	}
+}
+
+func TestEncryptedBackupRoundTrip(t *testing.T) {
+	source := t.TempDir()
+	files := writeBackupSource(t, source)
+	bs := &BackupService{keys: testBackupKeys(t, map[string]string{"2024-01": "first secret"})}
+
+	path := filepath.Join(t.TempDir(), "backup.zip.enc")
+	if err := bs.createEncryptedBackup(source, path, nil, "2024-01"); err != nil {
+		t.Fatalf("createEncryptedBackup: %v", err)
+	}
+
+	// The archive is neither a zip nor readable as plain text
+	if reader, err := zip.OpenReader(path); err == nil {
+		reader.Close()
+		t.Fatal("encrypted backup opened as a plain zip")
+	}
+	data, _ := os.ReadFile(path)
+	if !bytes.HasPrefix(data, []byte(backupCryptoMagic)) {
+		t.Errorf("encrypted backup starts with %q, want the %s header", data[:4], backupCryptoMagic)
+	}
+	if bytes.Contains(data, []byte(backupSecret)) || bytes.Contains(data, []byte("server.properties")) {
+		t.Error("encrypted backup contains plaintext from the server's files")
+	}
+
+	restored := t.TempDir()
+	if err := bs.extractBackup(&models.Backup{Path: path, EncryptionKeyID: "2024-01"}, restored); err != nil {
+		t.Fatalf("extractBackup: %v", err)
+	}
+	checkRestoredFiles(t, restored, files)
+}
+
+func TestEncryptedBackupNeedsTheRightKey(t *testing.T) {
+	source := t.TempDir()
+	writeBackupSource(t, source)
+	bs := &BackupService{keys: testBackupKeys(t, map[string]string{"2024-01": "first secret"})}
+
+	path := filepath.Join(t.TempDir(), "backup.zip.enc")
+	if err := bs.createEncryptedBackup(source, path, nil, "2024-01"); err != nil {
+		t.Fatalf("createEncryptedBackup: %v", err)
+	}
+	backup := &models.Backup{Path: path, EncryptionKeyID: "2024-01"}
+
+	// The same key ID with another secret
+	wrong := &BackupService{keys: testBackupKeys(t, map[string]string{"2024-01": "another secret"})}
+	if err := wrong.extractBackup(backup, t.TempDir()); !errors.Is(err, ErrBackupDecrypt) {
+		t.Errorf("extractBackup with the wrong key = %v, want ErrBackupDecrypt", err)
+	}
+
+	// A key ID that isn't configured
+	missing := &BackupService{keys: testBackupKeys(t, map[string]string{"2024-06": "first secret"})}
+	if err := missing.extractBackup(backup, t.TempDir()); !errors.Is(err, ErrBackupKeyUnavailable) {
+		t.Errorf("extractBackup without the key = %v, want ErrBackupKeyUnavailable", err)
+	}
+
+	// A truncated archive loses its last chunk, and with it the last chunk flag
+	data, _ := os.ReadFile(path)
+	truncated := filepath.Join(t.TempDir(), "truncated.zip.enc")
+	os.WriteFile(truncated, data[:len(data)-200], 0644)
+	if err := bs.extractBackup(&models.Backup{Path: truncated, EncryptionKeyID: "2024-01"}, t.TempDir()); !errors.Is(err, ErrBackupDecrypt) {
+		t.Errorf("extractBackup of a truncated archive = %v, want ErrBackupDecrypt", err)
+	}
+
+	// A changed byte in the middle fails its chunk when that is read
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)/2] ^= 0xff
+	tamperedPath := filepath.Join(t.TempDir(), "tampered.zip.enc")
+	os.WriteFile(tamperedPath, tampered, 0644)
+	if err := bs.extractBackup(&models.Backup{Path: tamperedPath, EncryptionKeyID: "2024-01"}, t.TempDir()); err == nil {
+		t.Error("tampered archive extracted without an error")
+	}
+}
+
+func TestEncryptedBackupRestorableAfterKeyRotation(t *testing.T) {
+	source := t.TempDir()
+	files := writeBackupSource(t, source)
+	secrets := map[string]string{"2024-01": "first secret"}
+
+	old := &BackupService{keys: testBackupKeys(t, secrets)}
+	path := filepath.Join(t.TempDir(), "backup.zip.enc")
+	if err := old.createEncryptedBackup(source, path, nil, "2024-01"); err != nil {
+		t.Fatalf("createEncryptedBackup: %v", err)
+	}
+
+	// New backups use the new key, and the old one is kept to read the
+	// backups taken with it
+	secrets["2024-06"] = "second secret"
+	rotated := &BackupService{keys: testBackupKeys(t, secrets)}
+	restored := t.TempDir()
+	if err := rotated.extractBackup(&models.Backup{Path: path, EncryptionKeyID: "2024-01"}, restored); err != nil {
+		t.Fatalf("extractBackup after rotation: %v", err)
+	}
+	checkRestoredFiles(t, restored, files)
+
+	if bytes.Equal(rotated.keys["2024-01"], rotated.keys["2024-06"]) {
+		t.Error("rotated keys are the same")
+	}
+}
+
+func TestDeriveBackupKeysKeepsValidKeys(t *testing.T) {
+	keys, err := deriveBackupKeys(map[string]string{
+		"good":                   "secret",
+		"same-secret":            "secret",
+		"empty":                  "",
+		"":                       "secret",
+		strings.Repeat("k", 256): "secret",
+	})
+	if err == nil || !strings.Contains(err.Error(), "empty has no secret") {
+		t.Errorf("deriveBackupKeys error = %v, want the invalid entries named", err)
+	}
+	if len(keys) != 2 || len(keys["good"]) != 32 {
+		t.Fatalf("keys = %d, want the 2 valid 32 byte keys", len(keys))
+	}
+
+	// The key ID salts the derivation, so IDs sharing a secret differ
+	if bytes.Equal(keys["good"], keys["same-secret"]) {
+		t.Error("key IDs with the same secret derived the same key")
+	}
+}
+
+func TestRestoreEncryptedBackup(t *testing.T) {
+	testDB(t)
+	service := useTestBackupService(t)
+	service.config.Files.BackupKeyID = "2024-01"
+	service.keys = testBackupKeys(t, map[string]string{"2024-01": "first secret"})
+
+	server := testutil.CreateServer(t, &models.Server{})
+	files := writeBackupSource(t, server.Path)
+	backup := createTestBackup(t, server)
+	if backup.EncryptionKeyID != "2024-01" || !strings.HasSuffix(backup.Path, ".enc") || backup.VerifiedAt == nil {
+		t.Fatalf("backup = %+v, want a verified archive encrypted with 2024-01", backup)
+	}
+
+	worldFile := filepath.Join(server.Path, "world", "region", "r.0.0.mca")
+	if err := os.WriteFile(worldFile, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restoring with the wrong key fails and leaves the files alone
+	service.keys = testBackupKeys(t, map[string]string{"2024-01": "another secret"})
+	if _, err := RestoreBackup(server, backup.ID, false); err == nil || !strings.Contains(err.Error(), ErrBackupDecrypt.Error()) {
+		t.Errorf("RestoreBackup with the wrong key = %v, want a decryption failure", err)
+	}
+	if content, _ := os.ReadFile(worldFile); string(content) != "changed" {
+		t.Errorf("world file = %d bytes after a failed restore, want it unchanged", len(content))
+	}
+
+	service.keys = testBackupKeys(t, map[string]string{"2024-01": "first secret"})
+	if _, err := RestoreBackup(server, backup.ID, false); err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+	checkRestoredFiles(t, server.Path, files)
+
+	// A key that was dropped from the config is refused before anything
+	// is touched
+	service.keys = map[string][]byte{}
+	if _, err := RestoreBackup(server, backup.ID, false); !errors.Is(err, ErrBackupKeyUnavailable) {
+		t.Errorf("RestoreBackup without the key = %v, want ErrBackupKeyUnavailable", err)
+	}
+	var snapshots int64
+	database.DB.Model(&models.Backup{}).Where("server_id = ? AND type = ?", server.ID, models.BackupTypePreRestore).Count(&snapshots)
+	if snapshots != 2 {
+		t.Errorf("%d pre-restore snapshots, want one per restore that got past the key check", snapshots)
+	}
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+)
+
+// maxBackupPatterns caps how many include or exclude patterns a server has
+const maxBackupPatterns = 50
+
+// ErrInvalidBackupPattern is returned for a backup pattern that can't be used
+var ErrInvalidBackupPattern = errors.New("invalid backup pattern")
+
+// backupFilter selects the files a backup archives from a server's include
+// and exclude patterns. Patterns are slash-separated globs relative to the
+// server directory; ** matches any number of directories, and a pattern
+// without a slash matches a file or directory of that name at any depth. A
+// pattern matching a directory matches everything under it.
+type backupFilter struct {
+	include [][]string
+	exclude [][]string
+}
+
+// newBackupFilter returns the filter for a server's backup patterns, or nil
+// when it has none
+func newBackupFilter(server *models.Server) *backupFilter {
+	if len(server.BackupInclude) == 0 && len(server.BackupExclude) == 0 {
+		return nil
+	}
+	return &backupFilter{
+		include: splitBackupPatterns(server.BackupInclude),
+		exclude: splitBackupPatterns(server.BackupExclude),
+	}
+}
+
+// skip reports whether a path relative to the server directory is left out.
+// Directories are only skipped when excluded, since an include pattern may
+// match something beneath them.
+func (f *backupFilter) skip(relativePath string, isDir bool) bool {
+	if f == nil {
+		return false
+	}
+
+	segments := strings.Split(filepath.ToSlash(relativePath), "/")
+	if matchesBackupPatterns(f.exclude, segments) {
+		return true
+	}
+	if isDir || len(f.include) == 0 {
+		return false
+	}
+	return !matchesBackupPatterns(f.include, segments)
+}
+
+// ValidateBackupPatterns checks include or exclude patterns before they are
+// saved and returns them cleaned
+func ValidateBackupPatterns(patterns []string) ([]string, error) {
+	if len(patterns) > maxBackupPatterns {
+		return nil, fmt.Errorf("%w: at most %d patterns are allowed", ErrInvalidBackupPattern, maxBackupPatterns)
+	}
+
+	cleaned := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		pattern = strings.Trim(strings.TrimSpace(filepath.ToSlash(pattern)), "/")
+		if pattern == "" {
+			return nil, fmt.Errorf("%w: patterns can't be empty", ErrInvalidBackupPattern)
+		}
+
+		for _, segment := range strings.Split(pattern, "/") {
+			if segment == ".." || segment == "." || segment == "" {
+				return nil, fmt.Errorf("%w: %q must be a path inside the server directory", ErrInvalidBackupPattern, pattern)
+			}
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("%w: %q is not a valid glob", ErrInvalidBackupPattern, pattern)
+			}
+		}
+		cleaned = append(cleaned, pattern)
+	}
+	return cleaned, nil
+}
+
+// SetBackupPatterns validates and saves a server's backup include and
+// exclude patterns
+func SetBackupPatterns(server *models.Server, include, exclude []string) error {
+	include, err := ValidateBackupPatterns(include)
+	if err != nil {
+		return err
+	}
+	exclude, err = ValidateBackupPatterns(exclude)
+	if err != nil {
+		return err
+	}
+
+	server.BackupInclude = include
+	server.BackupExclude = exclude
+	return database.DB.Model(server).Select("backup_include", "backup_exclude").Updates(server).Error
+}
+
+func splitBackupPatterns(patterns []string) [][]string {
+	split := make([][]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		segments := strings.Split(pattern, "/")
+		if len(segments) == 1 && segments[0] != "**" {
+			segments = []string{"**", segments[0]}
+		}
+		split = append(split, segments)
+	}
+	return split
+}
+
+// matchesBackupPatterns reports whether the path, or a directory it is in,
+// matches one of the patterns
+func matchesBackupPatterns(patterns [][]string, segments []string) bool {
+	for _, pattern := range patterns {
+		for i := 1; i <= len(segments); i++ {
+			if matchGlobSegments(pattern, segments[:i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchGlobSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlobSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], name[0]); !matched {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"playpulse-panel/models"
+)
+
+// writeTestServerFiles creates a server directory holding the given files
+func writeTestServerFiles(t *testing.T, files ...string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, name := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// archivedFiles archives dir with the server's backup patterns and returns
+// the names in the archive, sorted
+func archivedFiles(t *testing.T, dir string, server *models.Server) string {
+	t.Helper()
+
+	backupPath := filepath.Join(t.TempDir(), "backup.zip")
+	if err := (&BackupService{}).createZipBackup(dir, backupPath, newBackupFilter(server)); err != nil {
+		t.Fatalf("createZipBackup: %v", err)
+	}
+
+	reader, err := zip.OpenReader(backupPath)
+	if err != nil {
+		t.Fatalf("failed to open the archive: %v", err)
+	}
+	defer reader.Close()
+
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, filepath.ToSlash(file.Name))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+var testServerFiles = []string{
+	"server.properties",
+	"world/level.dat",
+	"world/region/r.0.0.mca",
+	"world_nether/DIM-1/region/r.0.0.mca",
+	"plugins/Essentials/config.yml",
+	"plugins/dynmap/configuration.txt",
+	"plugins/dynmap/web/tiles/world/t.png",
+	"logs/latest.log",
+}
+
+func TestBackupExcludeKeepsFilesOutOfArchive(t *testing.T) {
+	dir := writeTestServerFiles(t, testServerFiles...)
+
+	tests := []struct {
+		exclude []string
+		want    string
+	}{
+		{
+			nil,
+			"plugins/Essentials/config.yml,plugins/dynmap/configuration.txt,plugins/dynmap/web/tiles/world/t.png," +
+				"server.properties,world/level.dat,world/region/r.0.0.mca,world_nether/DIM-1/region/r.0.0.mca",
+		},
+		{
+			[]string{"plugins/dynmap/web/tiles"},
+			"plugins/Essentials/config.yml,plugins/dynmap/configuration.txt," +
+				"server.properties,world/level.dat,world/region/r.0.0.mca,world_nether/DIM-1/region/r.0.0.mca",
+		},
+		{
+			[]string{"**/*.mca", "*.png"},
+			"plugins/Essentials/config.yml,plugins/dynmap/configuration.txt,server.properties,world/level.dat",
+		},
+		{
+			[]string{"region"}, // a bare name matches at any depth
+			"plugins/Essentials/config.yml,plugins/dynmap/configuration.txt,plugins/dynmap/web/tiles/world/t.png," +
+				"server.properties,world/level.dat",
+		},
+		{
+			[]string{"world*", "plugins/*/web"},
+			"plugins/Essentials/config.yml,plugins/dynmap/configuration.txt,server.properties",
+		},
+	}
+	for _, tt := range tests {
+		got := archivedFiles(t, dir, &models.Server{BackupExclude: tt.exclude})
+		if got != tt.want {
+			t.Errorf("exclude %q archived %s, want %s", tt.exclude, got, tt.want)
+		}
+	}
+}
+
+func TestBackupIncludeArchivesOnlyMatchedSubtree(t *testing.T) {
+	dir := writeTestServerFiles(t, testServerFiles...)
+
+	tests := []struct {
+		include []string
+		exclude []string
+		want    string
+	}{
+		{[]string{"world/**"}, nil, "world/level.dat,world/region/r.0.0.mca"},
+		{[]string{"world"}, nil, "plugins/dynmap/web/tiles/world/t.png,world/level.dat,world/region/r.0.0.mca"}, // at any depth
+		{[]string{"plugins/*/config.yml"}, nil, "plugins/Essentials/config.yml"},
+		{[]string{"world/**", "server.properties"}, []string{"region"}, "server.properties,world/level.dat"},
+		{[]string{"nothing-here"}, nil, ""},
+	}
+	for _, tt := range tests {
+		got := archivedFiles(t, dir, &models.Server{BackupInclude: tt.include, BackupExclude: tt.exclude})
+		if got != tt.want {
+			t.Errorf("include %q exclude %q archived %s, want %s", tt.include, tt.exclude, got, tt.want)
+		}
+	}
+}
+
+func TestValidateBackupPatterns(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		want     string
+		valid    bool
+	}{
+		{[]string{" world/ ", "/plugins/*.jar/"}, "world,plugins/*.jar", true},
+		{[]string{"**/cache"}, "**/cache", true},
+		{nil, "", true},
+		{[]string{""}, "", false},
+		{[]string{"  "}, "", false},
+		{[]string{"../etc"}, "", false},
+		{[]string{"world/./region"}, "", false},
+		{[]string{"world//region"}, "", false},
+		{[]string{"world/[region"}, "", false},
+		{make([]string, maxBackupPatterns+1), "", false},
+	}
+	for _, tt := range tests {
+		cleaned, err := ValidateBackupPatterns(tt.patterns)
+		if !tt.valid {
+			if !errors.Is(err, ErrInvalidBackupPattern) {
+				t.Errorf("ValidateBackupPatterns(%q) = %v, want ErrInvalidBackupPattern", tt.patterns, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ValidateBackupPatterns(%q): %v", tt.patterns, err)
+			continue
+		}
+		if got := strings.Join(cleaned, ","); got != tt.want {
+			t.Errorf("ValidateBackupPatterns(%q) = %s, want %s", tt.patterns, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"playpulse-panel/models"
+)
+
+const (
+	// backupCheckInterval is how often servers are checked for a due
+	// scheduled backup; cron schedules run to the minute
+	backupCheckInterval = time.Minute
+	// defaultBackupIntervalHours applies when backup_interval_hours is unset
+	defaultBackupIntervalHours = 24
+	// minBackupIntervalMinutes keeps scheduled backups from piling up
+	// faster than they can be written and pruned
+	minBackupIntervalMinutes = 15
+	// maxBackupIntervalMinutes bounds a server's backup interval to 30 days
+	maxBackupIntervalMinutes = 30 * 24 * 60
+)
+
+// backupDue reports whether a server's next scheduled backup is due at now.
+// A cron pattern takes precedence over the interval, and servers without
+// either fall back to backup_interval_hours. A server never backed up is
+// due at once on an interval, or at the first cron match after it was
+// created.
+func backupDue(server *models.Server, now time.Time) bool {
+	if !server.BackupEnabled {
+		return false
+	}
+
+	if server.BackupCron != "" {
+		cron, err := parseCron(server.BackupCron)
+		if err != nil {
+			log.Printf("Server %s has an invalid backup cron pattern, using the interval: %v", server.Name, err)
+		} else {
+			last := server.CreatedAt
+			if server.LastBackup != nil {
+				last = *server.LastBackup
+			}
+			next := cron.Next(last)
+			return !next.IsZero() && !now.Before(next)
+		}
+	}
+
+	if server.LastBackup == nil {
+		return true
+	}
+	return now.Sub(*server.LastBackup) >= backupInterval(server)
+}
+
+// backupInterval returns the time between a server's scheduled backups
+func backupInterval(server *models.Server) time.Duration {
+	if server.BackupIntervalMinutes > 0 {
+		minutes := server.BackupIntervalMinutes
+		if minutes < minBackupIntervalMinutes {
+			minutes = minBackupIntervalMinutes
+		}
+		return time.Duration(minutes) * time.Minute
+	}
+	hours := GetInt("backup_interval_hours", defaultBackupIntervalHours)
+	if hours <= 0 {
+		hours = defaultBackupIntervalHours
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// backupRetention returns how many completed backups a server keeps
+func backupRetention(server *models.Server) int {
+	if server.BackupRetention > 0 {
+		return server.BackupRetention
+	}
+	return GetInt("max_backup_count", 10)
+}
+
+// ValidateBackupSchedule checks a server's backup interval and cron
+// pattern. An interval of 0 uses backup_interval_hours.
+func ValidateBackupSchedule(intervalMinutes int, cron string) error {
+	if intervalMinutes != 0 && (intervalMinutes < minBackupIntervalMinutes || intervalMinutes > maxBackupIntervalMinutes) {
+		return fmt.Errorf("backup interval must be 0 or between %d and %d minutes", minBackupIntervalMinutes, maxBackupIntervalMinutes)
+	}
+	if cron != "" {
+		schedule, err := parseCron(cron)
+		if err != nil {
+			return err
+		}
+		if schedule.Next(time.Now()).IsZero() {
+			return fmt.Errorf("cron pattern never matches")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+)
+
+// scheduledBackupTimes runs the schedule check every backupCheckInterval
+// over period from start, taking a backup whenever one is due, and returns
+// when they were taken
+func scheduledBackupTimes(server *models.Server, start time.Time, period time.Duration) []time.Duration {
+	var taken []time.Duration
+	for now := start; !now.After(start.Add(period)); now = now.Add(backupCheckInterval) {
+		if backupDue(server, now) {
+			last := now
+			server.LastBackup = &last
+			taken = append(taken, now.Sub(start))
+		}
+	}
+	return taken
+}
+
+func TestBackupDueOnServerInterval(t *testing.T) {
+	useTestSettings(t, models.SystemSetting{Key: "backup_interval_hours", Type: SettingTypeNumber, Value: "12"})
+	start := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		server models.Server
+		want   []time.Duration
+	}{
+		{
+			"six hour interval",
+			models.Server{BackupEnabled: true, BackupIntervalMinutes: 6 * 60},
+			[]time.Duration{0, 6 * time.Hour, 12 * time.Hour, 18 * time.Hour, 24 * time.Hour},
+		},
+		{
+			"panel default",
+			models.Server{BackupEnabled: true},
+			[]time.Duration{0, 12 * time.Hour, 24 * time.Hour},
+		},
+		{
+			"interval under the minimum",
+			models.Server{BackupEnabled: true, BackupIntervalMinutes: 1},
+			[]time.Duration{0, 15 * time.Minute, 30 * time.Minute, 45 * time.Minute, time.Hour},
+		},
+		{
+			"cron over the interval",
+			models.Server{BackupEnabled: true, BackupIntervalMinutes: 60, BackupCron: "0 */8 * * *", CreatedAt: start},
+			[]time.Duration{6*time.Hour + 30*time.Minute, 14*time.Hour + 30*time.Minute, 22*time.Hour + 30*time.Minute},
+		},
+		{
+			"disabled",
+			models.Server{BackupIntervalMinutes: 6 * 60},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := tt.server
+			period := 24 * time.Hour
+			if tt.server.BackupIntervalMinutes == 1 {
+				period = time.Hour
+			}
+			got := scheduledBackupTimes(&server, start, period)
+			if len(got) != len(tt.want) {
+				t.Fatalf("backups at %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("backups at %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBackupRetentionFallsBackToPanelDefault(t *testing.T) {
+	useTestSettings(t, models.SystemSetting{Key: "max_backup_count", Type: SettingTypeNumber, Value: "7"})
+
+	if got := backupRetention(&models.Server{BackupRetention: 3}); got != 3 {
+		t.Errorf("retention = %d, want the server's 3", got)
+	}
+	if got := backupRetention(&models.Server{}); got != 7 {
+		t.Errorf("retention = %d, want max_backup_count's 7", got)
+	}
+}
+
+func TestValidateBackupSchedule(t *testing.T) {
+	tests := []struct {
+		interval int
+		cron     string
+		valid    bool
+	}{
+		{0, "", true},
+		{360, "", true},
+		{14, "", false},
+		{maxBackupIntervalMinutes + 1, "", false},
+		{0, "0 */6 * * *", true},
+		{0, "0 0 31 2 *", false}, // never matches
+		{0, "not a cron", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateBackupSchedule(tt.interval, tt.cron); (err == nil) != tt.valid {
+			t.Errorf("ValidateBackupSchedule(%d, %q) = %v, want valid %v", tt.interval, tt.cron, err, tt.valid)
+		}
+	}
+}
+
+func TestScheduledBackupPrunesToServerRetention(t *testing.T) {
+	testDB(t)
+	useTestBackupService(t)
+
+	server := testutil.CreateServer(t, &models.Server{BackupEnabled: true, BackupRetention: 2})
+	other := testutil.CreateServer(t, &models.Server{BackupEnabled: true, BackupRetention: 2})
+
+	createBackup := func(server *models.Server, backupType models.BackupType, age time.Duration) models.Backup {
+		t.Helper()
+
+		backup := models.Backup{ServerID: server.ID, Name: "retention", Type: backupType, Status: models.BackupStatusCompleted}
+		if err := database.DB.Create(&backup).Error; err != nil {
+			t.Fatalf("failed to create backup record: %v", err)
+		}
+		database.DB.Model(&backup).Update("created_at", time.Now().Add(-age))
+		return backup
+	}
+
+	var scheduled []models.Backup
+	for i := 5; i >= 1; i-- {
+		scheduled = append(scheduled, createBackup(server, models.BackupTypeScheduled, time.Duration(i)*time.Hour))
+	}
+	manual := createBackup(server, models.BackupTypeManual, 10*time.Hour)
+	for i := 0; i < 3; i++ {
+		createBackup(other, models.BackupTypeScheduled, time.Duration(i)*time.Hour)
+	}
+
+	latest := scheduled[len(scheduled)-1]
+	database.DB.First(&latest, latest.ID)
+	scheduledBackupComplete(server, &latest)
+
+	var kept []models.Backup
+	database.DB.Where("server_id = ?", server.ID).Order("created_at DESC").Find(&kept)
+	if len(kept) != 3 || kept[0].ID != scheduled[4].ID || kept[1].ID != scheduled[3].ID || kept[2].ID != manual.ID {
+		t.Errorf("kept %d backups, want the 2 newest scheduled and the manual one", len(kept))
+	}
+
+	var otherCount int64
+	database.DB.Model(&models.Backup{}).Where("server_id = ?", other.ID).Count(&otherCount)
+	if otherCount != 3 {
+		t.Errorf("other server has %d backups, want its 3 untouched", otherCount)
+	}
+
+	var stored models.Server
+	database.DB.First(&stored, server.ID)
+	if stored.LastBackup == nil || !stored.LastBackup.Equal(latest.CreatedAt) {
+		t.Errorf("last backup = %v, want the completed backup's time %s", stored.LastBackup, latest.CreatedAt)
+	}
+}
+
+func TestNeedsBackupWaitsForPendingBackup(t *testing.T) {
+	testDB(t)
+	service := useTestBackupService(t)
+
+	server := testutil.CreateServer(t, &models.Server{BackupEnabled: true, BackupIntervalMinutes: 6 * 60})
+	if !service.needsBackup(server) {
+		t.Fatal("server never backed up is not due")
+	}
+
+	queued := models.Backup{ServerID: server.ID, Name: "queued", Type: models.BackupTypeScheduled, Status: models.BackupStatusQueued}
+	if err := database.DB.Create(&queued).Error; err != nil {
+		t.Fatalf("failed to create backup record: %v", err)
+	}
+	if service.needsBackup(server) {
+		t.Error("server with a queued backup is due again")
+	}
+}
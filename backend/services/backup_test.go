@@ -0,0 +1,361 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+)
+
+// createTestBackup writes a completed backup of the server's current files
+func createTestBackup(t *testing.T, server *models.Server) *models.Backup {
+	t.Helper()
+
+	backup := models.Backup{
+		ServerID: server.ID,
+		Name:     "test-backup",
+		Type:     models.BackupTypeManual,
+		Status:   models.BackupStatusCreating,
+	}
+	if err := database.DB.Create(&backup).Error; err != nil {
+		t.Fatalf("failed to create backup record: %v", err)
+	}
+	if err := backupService.performBackup(server, &backup); err != nil {
+		t.Fatalf("performBackup: %v", err)
+	}
+	backup.Status = models.BackupStatusCompleted
+	database.DB.Save(&backup)
+	return &backup
+}
+
+func TestRestoreBackupRefusesRunningServer(t *testing.T) {
+	testDB(t)
+	useTestBackupService(t)
+
+	server := testutil.CreateServer(t, &models.Server{})
+	backup := createTestBackup(t, server)
+
+	database.DB.Model(server).Update("status", models.ServerStatusRunning)
+	snapshot, err := RestoreBackup(server, backup.ID, false)
+	if !errors.Is(err, ErrServerRunning) {
+		t.Fatalf("RestoreBackup = %v, want ErrServerRunning", err)
+	}
+	if snapshot != nil {
+		t.Error("no snapshot should be taken when the restore is refused")
+	}
+
+	var snapshots int64
+	database.DB.Model(&models.Backup{}).
+		Where("server_id = ? AND type = ?", server.ID, models.BackupTypePreRestore).
+		Count(&snapshots)
+	if snapshots != 0 {
+		t.Errorf("%d pre-restore snapshots were created for a refused restore", snapshots)
+	}
+}
+
+func TestRestoreBackupChecksCurrentStatus(t *testing.T) {
+	testDB(t)
+	useTestBackupService(t)
+
+	server := testutil.CreateServer(t, &models.Server{})
+	backup := createTestBackup(t, server)
+
+	// The caller's copy still says stopped, but the server is stopping
+	database.DB.Model(&models.Server{}).Where("id = ?", server.ID).Update("status", models.ServerStatusStopping)
+	server.Status = models.ServerStatusStopped
+
+	if _, err := RestoreBackup(server, backup.ID, false); !errors.Is(err, ErrServerRunning) {
+		t.Fatalf("RestoreBackup of a stopping server = %v, want ErrServerRunning", err)
+	}
+}
+
+func TestRestoreBackupWaitsForServerLock(t *testing.T) {
+	testDB(t)
+	useTestBackupService(t)
+
+	server := testutil.CreateServer(t, &models.Server{})
+	backup := createTestBackup(t, server)
+
+	// A start or stop in progress holds the lock; the restore waits for it
+	unlock := lockServer(server.ID)
+	done := make(chan error, 1)
+	go func() {
+		_, err := RestoreBackup(server, backup.ID, false)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		unlock()
+		t.Fatalf("RestoreBackup returned %v while the server's lock was held", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("RestoreBackup: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("RestoreBackup did not finish after the lock was released")
+	}
+}
+
+func TestRestoreBackupKeepsQueryableSnapshot(t *testing.T) {
+	testDB(t)
+	useTestBackupService(t)
+
+	server := testutil.CreateServer(t, &models.Server{})
+	worldFile := filepath.Join(server.Path, "world.dat")
+	if err := os.WriteFile(worldFile, []byte("before"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	backup := createTestBackup(t, server)
+
+	if err := os.WriteFile(worldFile, []byte("after"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := RestoreBackup(server, backup.ID, false)
+	if err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+
+	content, err := os.ReadFile(worldFile)
+	if err != nil || string(content) != "before" {
+		t.Errorf("world.dat = %q (%v), want the backed up content", content, err)
+	}
+
+	backups, err := GetServerBackups(server.ID)
+	if err != nil {
+		t.Fatalf("GetServerBackups: %v", err)
+	}
+	found := false
+	for _, b := range backups {
+		if b.ID == snapshot.ID {
+			found = true
+			if b.Type != models.BackupTypePreRestore || b.Status != models.BackupStatusCompleted {
+				t.Errorf("snapshot is %s/%s, want a completed pre_restore backup", b.Type, b.Status)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("the pre-restore snapshot is not listed with the server's backups")
+	}
+
+	// Restoring the snapshot brings back the state from before the restore
+	if _, err := RestoreBackup(server, snapshot.ID, false); err != nil {
+		t.Fatalf("restoring the snapshot: %v", err)
+	}
+	content, _ = os.ReadFile(worldFile)
+	if string(content) != "after" {
+		t.Errorf("world.dat = %q after restoring the snapshot, want %q", content, "after")
+	}
+}
+
+// startBackupWorkers runs n workers for service until the test ends
+func startBackupWorkers(t *testing.T, service *BackupService, n int) {
+	for i := 0; i < n; i++ {
+		go service.worker()
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		StopBackups(ctx)
+	})
+}
+
+func TestBackupBurstRunsAtMostNAtOnce(t *testing.T) {
+	testDB(t)
+	service := useTestBackupService(t)
+	const workers, burst = 2, 8
+	startBackupWorkers(t, service, workers)
+
+	server := testutil.CreateServer(t, &models.Server{})
+	if err := os.WriteFile(filepath.Join(server.Path, "world.dat"), []byte("world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each backup holds its worker a little after finishing, so backups that
+	// could run together overlap
+	var mutex sync.Mutex
+	active, peak := 0, 0
+	var done sync.WaitGroup
+	onComplete := func(*models.Server, *models.Backup) {
+		mutex.Lock()
+		active++
+		if active > peak {
+			peak = active
+		}
+		mutex.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+
+		mutex.Lock()
+		active--
+		mutex.Unlock()
+		done.Done()
+	}
+
+	for i := 0; i < burst; i++ {
+		backup := models.Backup{
+			ServerID: server.ID,
+			Name:     fmt.Sprintf("burst-%d", i),
+			Type:     models.BackupTypeScheduled,
+			Status:   models.BackupStatusQueued,
+		}
+		if err := database.DB.Create(&backup).Error; err != nil {
+			t.Fatalf("failed to create backup record: %v", err)
+		}
+		done.Add(1)
+		if err := service.enqueue(backupJob{server: *server, backup: backup, onComplete: onComplete}); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		done.Wait()
+		close(finished)
+	}()
+
+	deadline := time.After(30 * time.Second)
+	for waiting := true; waiting; {
+		if _, running := BackupQueueStats(); running > workers {
+			t.Errorf("%d backups running, want at most %d", running, workers)
+		}
+		select {
+		case <-finished:
+			waiting = false
+		case <-deadline:
+			t.Fatal("burst of backups did not finish")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+
+	if peak > workers {
+		t.Errorf("%d backups ran at once, want at most %d", peak, workers)
+	}
+	if peak < workers {
+		t.Errorf("at most %d backup ran at once, want the pool's %d workers busy", peak, workers)
+	}
+
+	var completed int64
+	database.DB.Model(&models.Backup{}).
+		Where("server_id = ? AND status = ?", server.ID, models.BackupStatusCompleted).
+		Count(&completed)
+	if completed != burst {
+		t.Errorf("%d of %d backups completed", completed, burst)
+	}
+}
+
+func TestCreateBackupRefusedAfterStop(t *testing.T) {
+	testDB(t)
+	useTestBackupService(t)
+	server := testutil.CreateServer(t, &models.Server{})
+
+	if err := StopBackups(context.Background()); err != nil {
+		t.Fatalf("StopBackups: %v", err)
+	}
+	if err := CreateBackup(server, "late"); !errors.Is(err, ErrBackupsStopped) {
+		t.Errorf("CreateBackup after shutdown = %v, want ErrBackupsStopped", err)
+	}
+}
+
+func TestStopBackupsWaitsForRunningBackup(t *testing.T) {
+	testDB(t)
+	service := useTestBackupService(t)
+	startBackupWorkers(t, service, 1)
+
+	server := testutil.CreateServer(t, &models.Server{})
+	queue := func(name string, onComplete func(*models.Server, *models.Backup)) models.Backup {
+		backup := models.Backup{ServerID: server.ID, Name: name, Type: models.BackupTypeManual, Status: models.BackupStatusQueued}
+		if err := database.DB.Create(&backup).Error; err != nil {
+			t.Fatalf("failed to create backup record: %v", err)
+		}
+		if err := service.enqueue(backupJob{server: *server, backup: backup, onComplete: onComplete}); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+		return backup
+	}
+
+	// The first backup is still running when shutdown starts
+	started := make(chan struct{})
+	release := make(chan struct{})
+	finished := false
+	running := queue("in-progress", func(*models.Server, *models.Backup) {
+		close(started)
+		<-release
+		finished = true
+	})
+	waiting := queue("waiting", nil)
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		stopped <- StopBackups(ctx)
+	}()
+
+	select {
+	case err := <-stopped:
+		t.Fatalf("StopBackups returned %v while a backup was running", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(release)
+
+	if err := <-stopped; err != nil {
+		t.Fatalf("StopBackups: %v", err)
+	}
+	if !finished {
+		t.Error("StopBackups returned before the running backup finished")
+	}
+
+	var current models.Backup
+	database.DB.First(&current, "id = ?", running.ID)
+	if current.Status != models.BackupStatusCompleted {
+		t.Errorf("running backup is %s after shutdown, want completed", current.Status)
+	}
+	// The backup that never started is left queued for the next start
+	database.DB.First(&current, "id = ?", waiting.ID)
+	if current.Status != models.BackupStatusQueued {
+		t.Errorf("waiting backup is %s after shutdown, want queued", current.Status)
+	}
+}
+
+func TestStopBackupsGivesUpAfterGracePeriod(t *testing.T) {
+	testDB(t)
+	service := useTestBackupService(t)
+	startBackupWorkers(t, service, 1)
+
+	server := testutil.CreateServer(t, &models.Server{})
+	backup := models.Backup{ServerID: server.ID, Name: "slow", Type: models.BackupTypeManual, Status: models.BackupStatusQueued}
+	if err := database.DB.Create(&backup).Error; err != nil {
+		t.Fatalf("failed to create backup record: %v", err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	service.enqueue(backupJob{server: *server, backup: backup, onComplete: func(*models.Server, *models.Backup) {
+		close(started)
+		<-release
+	}})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := StopBackups(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("StopBackups with a stuck backup = %v, want the grace period to expire", err)
+	}
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrBackupNotFound is returned for backups that don't exist or belong
+	// to another server
+	ErrBackupNotFound = errors.New("backup not found")
+	// ErrBackupInProgress is returned when verifying a backup still being written
+	ErrBackupInProgress = errors.New("backup is still being created")
+	// ErrBackupCorrupt is returned when a backup archive can't be read back
+	// or no longer matches its checksum
+	ErrBackupCorrupt = errors.New("backup archive is corrupt")
+)
+
+// VerifyBackup re-reads a server's backup archive, checking every entry
+// decompresses and the file still matches the checksum taken when it was
+// created. A corrupt backup is marked failed; an error reading it, such as
+// an I/O failure, is returned without touching the backup so the check can
+// be retried. Backups made before checksums were stored get one recorded.
+func VerifyBackup(server *models.Server, backupID uuid.UUID) (*models.Backup, error) {
+	var backup models.Backup
+	if err := database.DB.Where("id = ? AND server_id = ?", backupID, server.ID).First(&backup).Error; err != nil {
+		return nil, ErrBackupNotFound
+	}
+
+	if backup.Status == models.BackupStatusQueued || backup.Status == models.BackupStatusCreating {
+		return &backup, ErrBackupInProgress
+	}
+
+	verifyErr := verifyBackupArchive(&backup)
+	if verifyErr != nil && !errors.Is(verifyErr, ErrBackupCorrupt) {
+		// Nothing is known about the archive until its key is configured
+		// again or it can be read
+		return &backup, verifyErr
+	}
+
+	now := time.Now()
+	backup.VerifiedAt = &now
+	if verifyErr != nil {
+		backup.Status = models.BackupStatusFailed
+	}
+	if err := database.DB.Save(&backup).Error; err != nil {
+		return &backup, err
+	}
+
+	return &backup, verifyErr
+}
+
+// verifyBackupArchive checks the archive against the backup's checksum,
+// filling the checksum in when there is none yet
+func verifyBackupArchive(backup *models.Backup) error {
+	checksum, err := backupChecksum(backup.Path)
+	if err != nil {
+		return backupReadError(err)
+	}
+
+	if backup.Checksum == "" {
+		backup.Checksum = checksum
+	} else if checksum != backup.Checksum {
+		return fmt.Errorf("%w: checksum %s does not match %s", ErrBackupCorrupt, checksum, backup.Checksum)
+	}
+
+	return backupService.checkBackupArchive(backup.Path, backup.EncryptionKeyID)
+}
+
+// backupChecksum returns the hex SHA-256 of a backup archive
+func backupChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// checkBackupArchive opens a backup archive and reads every entry through,
+// so a truncated file or a bad CRC is caught now rather than at restore
+// time. Encrypted archives are decrypted with the key keyID, which also
+// authenticates them.
+func (bs *BackupService) checkBackupArchive(path, keyID string) error {
+	reader, closer, err := bs.openBackupArchive(path, keyID)
+	if errors.Is(err, ErrBackupKeyUnavailable) {
+		return err
+	}
+	if err != nil {
+		return backupReadError(err)
+	}
+	defer closer.Close()
+
+	for _, file := range reader.File {
+		if err := checkArchiveEntry(file); err != nil {
+			return backupReadError(fmt.Errorf("%s: %w", file.Name, err))
+		}
+	}
+	return nil
+}
+
+// backupReadError classifies an error from reading a backup archive. A
+// filesystem error other than the file being gone may pass and is returned
+// as is; anything else means the archive itself is bad.
+func backupReadError(err error) error {
+	var pathErr *fs.PathError
+	if errors.Is(err, ErrBackupCorrupt) ||
+		(errors.As(err, &pathErr) && !errors.Is(err, fs.ErrNotExist)) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrBackupCorrupt, err)
+}
+
+func checkArchiveEntry(file *zip.File) error {
+	entry, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+
+	// The zip reader checks the CRC once the entry is read to the end
+	_, err = io.Copy(io.Discard, entry)
+	return err
+}
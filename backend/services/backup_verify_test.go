@@ -0,0 +1,119 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// truncateBackup cuts a backup archive down to half its size
+func truncateBackup(t *testing.T, backup *models.Backup) {
+	t.Helper()
+
+	info, err := os.Stat(backup.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(backup.Path, info.Size()/2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupChecksumStoredAndVerified(t *testing.T) {
+	service := useTestBackupService(t)
+	server := &models.Server{ID: uuid.New(), Name: "verify", Path: writeTestServerFiles(t, testServerFiles...)}
+	backup := &models.Backup{ID: uuid.New(), Type: models.BackupTypeManual}
+
+	if err := service.performBackup(server, backup); err != nil {
+		t.Fatalf("performBackup: %v", err)
+	}
+	checksum, err := backupChecksum(backup.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup.Checksum != checksum || len(checksum) != 64 {
+		t.Errorf("stored checksum %q, want the archive's SHA-256 %q", backup.Checksum, checksum)
+	}
+	if backup.VerifiedAt == nil {
+		t.Error("a good backup was not marked verified after creation")
+	}
+
+	if err := verifyBackupArchive(backup); err != nil {
+		t.Errorf("verifying a good backup: %v", err)
+	}
+
+	// A different archive in its place no longer matches
+	other := &models.Backup{ID: uuid.New(), Type: models.BackupTypeManual}
+	server.Path = writeTestServerFiles(t, "server.properties")
+	if err := service.performBackup(server, other); err != nil {
+		t.Fatalf("performBackup: %v", err)
+	}
+	if err := os.Rename(other.Path, backup.Path); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyBackupArchive(backup); !errors.Is(err, ErrBackupCorrupt) {
+		t.Errorf("verifying a replaced archive = %v, want ErrBackupCorrupt", err)
+	}
+}
+
+func TestTruncatedBackupIsCorrupt(t *testing.T) {
+	service := useTestBackupService(t)
+	server := &models.Server{ID: uuid.New(), Name: "verify", Path: writeTestServerFiles(t, testServerFiles...)}
+	backup := &models.Backup{ID: uuid.New(), Type: models.BackupTypeManual}
+	if err := service.performBackup(server, backup); err != nil {
+		t.Fatalf("performBackup: %v", err)
+	}
+
+	truncateBackup(t, backup)
+	if err := verifyBackupArchive(backup); !errors.Is(err, ErrBackupCorrupt) {
+		t.Errorf("verifying a truncated archive = %v, want ErrBackupCorrupt", err)
+	}
+
+	// Without a checksum to compare the archive itself gives it away
+	backup.Checksum = ""
+	if err := verifyBackupArchive(backup); !errors.Is(err, ErrBackupCorrupt) {
+		t.Errorf("verifying a truncated archive without a checksum = %v, want ErrBackupCorrupt", err)
+	}
+
+	os.Remove(backup.Path)
+	if err := verifyBackupArchive(backup); !errors.Is(err, ErrBackupCorrupt) {
+		t.Errorf("verifying a missing archive = %v, want ErrBackupCorrupt", err)
+	}
+}
+
+func TestVerifyBackupMarksCorruptBackupFailed(t *testing.T) {
+	testDB(t)
+	useTestBackupService(t)
+	server := testutil.CreateServer(t, &models.Server{})
+
+	good := createTestBackup(t, server)
+	verified, err := VerifyBackup(server, good.ID)
+	if err != nil {
+		t.Fatalf("VerifyBackup of a good backup: %v", err)
+	}
+	if verified.Status != models.BackupStatusCompleted || verified.VerifiedAt == nil {
+		t.Errorf("good backup is %s verified at %v, want completed and verified", verified.Status, verified.VerifiedAt)
+	}
+
+	bad := createTestBackup(t, server)
+	truncateBackup(t, bad)
+	if _, err := VerifyBackup(server, bad.ID); !errors.Is(err, ErrBackupCorrupt) {
+		t.Errorf("VerifyBackup of a truncated backup = %v, want ErrBackupCorrupt", err)
+	}
+	var stored models.Backup
+	database.DB.First(&stored, bad.ID)
+	if stored.Status != models.BackupStatusFailed {
+		t.Errorf("truncated backup is %s, want failed", stored.Status)
+	}
+
+	other := testutil.CreateServer(t, &models.Server{})
+	if _, err := VerifyBackup(other, good.ID); !errors.Is(err, ErrBackupNotFound) {
+		t.Errorf("VerifyBackup through another server = %v, want ErrBackupNotFound", err)
+	}
+}
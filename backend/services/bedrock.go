@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+)
+
+const bedrockBinary = "bedrock_server"
+
+// Where Bedrock dedicated server releases are downloaded from
+var bedrockDownloadURL = "https://www.minecraft.net/bedrockdedicatedserver/bin-linux/bedrock-server-%s.zip"
+
+// setupBedrockServer downloads and extracts the Bedrock dedicated server.
+// Bedrock is a native binary, so there is no jar and no EULA file.
+func setupBedrockServer(server *models.Server) error {
+	if server.Version == "" {
+		return fmt.Errorf("bedrock version is required")
+	}
+
+	archiveName := fmt.Sprintf("bedrock-server-%s.zip", server.Version)
+	archivePath := filepath.Join(server.Path, archiveName)
+	if err := downloadFile(fmt.Sprintf(bedrockDownloadURL, server.Version), archivePath); err != nil {
+		return fmt.Errorf("failed to download bedrock server: %v", err)
+	}
+	defer os.Remove(archivePath)
+
+	// Keep an existing configuration when re-installing
+	propertiesPath := filepath.Join(server.Path, "server.properties")
+	var existingProperties []byte
+	if utils.FileExists(propertiesPath) {
+		existingProperties, _ = os.ReadFile(propertiesPath)
+	}
+
+	if err := extractZip(archivePath, server.Path); err != nil {
+		return fmt.Errorf("failed to extract bedrock server: %v", err)
+	}
+
+	if existingProperties != nil {
+		os.WriteFile(propertiesPath, existingProperties, 0644)
+	} else {
+		createBedrockServerProperties(server)
+	}
+
+	binaryPath := filepath.Join(server.Path, bedrockBinary)
+	if !utils.FileExists(binaryPath) {
+		return fmt.Errorf("bedrock archive did not contain %s", bedrockBinary)
+	}
+	if err := os.Chmod(binaryPath, 0755); err != nil {
+		return fmt.Errorf("failed to make bedrock server executable: %v", err)
+	}
+
+	server.ServerJar = bedrockBinary
+	server.StartCommand = ""
+	database.DB.Save(server)
+
+	return nil
+}
+
+// createBedrockServerProperties writes server.properties in the Bedrock format,
+// replacing the defaults shipped in the archive
+func createBedrockServerProperties(server *models.Server) {
+	properties := fmt.Sprintf(`server-name=%s
+gamemode=survival
+difficulty=easy
+allow-cheats=false
+max-players=10
+online-mode=true
+allow-list=false
+server-port=%d
+server-portv6=%d
+view-distance=32
+tick-distance=4
+player-idle-timeout=30
+level-name=Bedrock level
+default-player-permission-level=member
+content-log-file-enabled=false
+`, server.Name, server.Port, server.Port+1)
+
+	os.WriteFile(filepath.Join(server.Path, "server.properties"), []byte(properties), 0644)
+}
+
+// bedrockCommand builds the command that runs the native Bedrock binary. The
+// server ships its own shared libraries next to the binary.
+func bedrockCommand(server *models.Server) *exec.Cmd {
+	if runsInContainers() {
+		return containerCommand(server, []string{"./" + bedrockBinary}, "LD_LIBRARY_PATH="+containerServerPath)
+	}
+
+	cmd := exec.Command(filepath.Join(server.Path, bedrockBinary))
+	cmd.Dir = server.Path
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH="+server.Path)
+	return cmd
+}
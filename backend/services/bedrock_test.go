@@ -0,0 +1,113 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+)
+
+// fakeBedrockArchive builds a release zip holding a stand-in binary
+func fakeBedrockArchive(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		bedrockBinary:       "#!/bin/sh\n",
+		"server.properties": "server-name=Dedicated Server\n",
+		"libCrypto.so":      "",
+	} {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSetupBedrockServerInstallsNativeBinary(t *testing.T) {
+	testDB(t)
+
+	archive := fakeBedrockArchive(t)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bedrock-server-1.20.81.01.zip" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(archive)
+	}))
+	defer api.Close()
+	defer func(url string) { bedrockDownloadURL = url }(bedrockDownloadURL)
+	bedrockDownloadURL = api.URL + "/bedrock-server-%s.zip"
+
+	server := testutil.CreateServer(t, &models.Server{Type: models.ServerTypeBedrock, Version: "1.20.81.01", Port: 55400})
+	if err := SetupServerJar(server); err != nil {
+		t.Fatalf("SetupServerJar: %v", err)
+	}
+
+	if server.ServerJar != bedrockBinary || server.StartCommand != "" {
+		t.Errorf("server jar %q and start command %q, want the bedrock binary", server.ServerJar, server.StartCommand)
+	}
+	info, err := os.Stat(filepath.Join(server.Path, bedrockBinary))
+	if err != nil || info.Mode()&0111 == 0 {
+		t.Fatalf("bedrock binary missing or not executable: %v", err)
+	}
+
+	properties, _ := os.ReadFile(filepath.Join(server.Path, "server.properties"))
+	if !strings.Contains(string(properties), "server-port=55400") || !strings.Contains(string(properties), "server-portv6=55401") {
+		t.Errorf("server.properties does not use the server's ports:\n%s", properties)
+	}
+	if _, err := os.Stat(filepath.Join(server.Path, "eula.txt")); err == nil {
+		t.Error("a EULA file was written for a Bedrock server")
+	}
+}
+
+func TestBedrockCommandDoesNotRunJava(t *testing.T) {
+	defer func(execution string) { serverRuntime.execution = execution }(serverRuntime.execution)
+
+	server := &models.Server{Type: models.ServerTypeBedrock, Path: t.TempDir(), JavaPath: "/usr/bin/java"}
+
+	serverRuntime.execution = ExecutionProcess
+	cmd := bedrockCommand(server)
+	if cmd.Path != filepath.Join(server.Path, bedrockBinary) {
+		t.Errorf("runs %s, want the bedrock binary", cmd.Path)
+	}
+	if len(cmd.Args) != 1 {
+		t.Errorf("args = %v, want none", cmd.Args[1:])
+	}
+	if cmd.Dir != server.Path {
+		t.Errorf("dir = %s, want %s", cmd.Dir, server.Path)
+	}
+	found := false
+	for _, env := range cmd.Env {
+		if env == "LD_LIBRARY_PATH="+server.Path {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("LD_LIBRARY_PATH does not point at the server directory")
+	}
+
+	serverRuntime.execution = ExecutionDocker
+	cmd = bedrockCommand(server)
+	for _, arg := range cmd.Args {
+		if arg == "java" || arg == "-jar" {
+			t.Errorf("container command invokes java: %v", cmd.Args)
+		}
+	}
+	if cmd.Args[len(cmd.Args)-1] != "./"+bedrockBinary {
+		t.Errorf("container command = %v, want it to run ./%s", cmd.Args, bedrockBinary)
+	}
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+)
+
+// CloneOptions controls which related records are copied to a clone
+type CloneOptions struct {
+	Name          string
+	Path          string
+	Port          int
+	CopyPlugins   bool
+	CopySchedules bool
+}
+
+// CloneServer duplicates a server's configuration and files into a new,
+// stopped server. Files are copied through the backup zip machinery so the
+// same logs and lock files are left out.
+func CloneServer(source *models.Server, opts CloneOptions) (*models.Server, error) {
+	if backupService == nil {
+		return nil, fmt.Errorf("backup service is not initialized")
+	}
+
+	if utils.FileExists(opts.Path) {
+		return nil, fmt.Errorf("directory %s already exists", opts.Path)
+	}
+
+	clone := models.Server{
+		Name:          opts.Name,
+		Description:   source.Description,
+		Tags:          source.Tags,
+		Type:          source.Type,
+		Version:       source.Version,
+		Status:        models.ServerStatusStopped,
+		Port:          opts.Port,
+		MemoryLimit:   source.MemoryLimit,
+		DiskLimit:     source.DiskLimit,
+		CPULimit:      source.CPULimit,
+		Path:          opts.Path,
+		JavaPath:      source.JavaPath,
+		JavaArgs:      source.JavaArgs,
+		ServerJar:     source.ServerJar,
+		StartCommand:  source.StartCommand,
+		StopCommand:   source.StopCommand,
+		AutoRestart:   source.AutoRestart,
+		AutoStart:     false,
+		BackupEnabled: source.BackupEnabled,
+		// The copied eula.txt carries the source's acceptance
+		EULAAcceptedBy: source.EULAAcceptedBy,
+		EULAAcceptedAt: source.EULAAcceptedAt,
+	}
+
+	if err := copyServerFiles(source.Path, opts.Path); err != nil {
+		os.RemoveAll(opts.Path)
+		return nil, fmt.Errorf("failed to copy server files: %v", err)
+	}
+
+	if err := database.DB.Create(&clone).Error; err != nil {
+		os.RemoveAll(opts.Path)
+		return nil, fmt.Errorf("failed to create server record: %v", err)
+	}
+
+	if opts.CopyPlugins {
+		var plugins []models.Plugin
+		database.DB.Where("server_id = ?", source.ID).Find(&plugins)
+		for _, plugin := range plugins {
+			plugin.ID = uuid.Nil
+			plugin.ServerID = clone.ID
+			plugin.FilePath = rebasePath(plugin.FilePath, source.Path, clone.Path)
+			if err := database.DB.Omit("Server").Create(&plugin).Error; err != nil {
+				return &clone, fmt.Errorf("failed to copy plugin %s: %v", plugin.Name, err)
+			}
+		}
+	}
+
+	if opts.CopySchedules {
+		var schedules []models.Schedule
+		database.DB.Where("server_id = ?", source.ID).Find(&schedules)
+		for _, schedule := range schedules {
+			schedule.ID = uuid.Nil
+			schedule.ServerID = clone.ID
+			schedule.LastRun = nil
+			schedule.RunCount = 0
+			if err := database.DB.Omit("Server").Create(&schedule).Error; err != nil {
+				return &clone, fmt.Errorf("failed to copy schedule %s: %v", schedule.Name, err)
+			}
+		}
+	}
+
+	return &clone, nil
+}
+
+func copyServerFiles(sourceDir, destDir string) error {
+	tempFile, err := os.CreateTemp("", "playpulse-clone-*.zip")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+	tempFile.Close()
+	defer os.Remove(tempPath)
+
+	if err := backupService.createZipBackup(sourceDir, tempPath, nil); err != nil {
+		return err
+	}
+
+	if err := utils.CreateDirectory(destDir); err != nil {
+		return err
+	}
+
+	return backupService.extractZipBackup(tempPath, destDir)
+}
+
+// rebasePath moves a path inside oldBase to the same location inside newBase
+func rebasePath(path, oldBase, newBase string) string {
+	relativePath, err := filepath.Rel(oldBase, path)
+	if err != nil || strings.HasPrefix(relativePath, "..") {
+		return path
+	}
+	return filepath.Join(newBase, relativePath)
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+)
+
+func TestCloneServerCopiesFilesToDistinctPort(t *testing.T) {
+	testDB(t)
+	useTestBackupService(t)
+
+	source := testutil.CreateServer(t, &models.Server{MemoryLimit: 2048})
+	files := map[string]string{
+		"server.properties":      "motd=source\n",
+		"world/level.dat":        "level",
+		"plugins/Essentials.jar": "jar",
+		"logs/latest.log":        "log",
+		"world/session.lock":     "lock",
+	}
+	for name, content := range files {
+		path := filepath.Join(source.Path, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	port, err := AllocatePort(55200, 55299, source.Type)
+	if err != nil {
+		t.Fatalf("AllocatePort: %v", err)
+	}
+	defer ReleasePort(port)
+
+	clonePath := filepath.Join(t.TempDir(), "clone")
+	clone, err := CloneServer(source, CloneOptions{Name: "clone-" + source.Name, Path: clonePath, Port: port})
+	if err != nil {
+		t.Fatalf("CloneServer: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Unscoped().Delete(clone) })
+
+	if clone.ID == source.ID || clone.Port == source.Port {
+		t.Errorf("clone shares ID or port with the source: %s/%d", clone.ID, clone.Port)
+	}
+	if clone.Status != models.ServerStatusStopped || clone.MemoryLimit != 2048 {
+		t.Errorf("clone is %s with %d MB, want stopped with the source's limits", clone.Status, clone.MemoryLimit)
+	}
+
+	for name, content := range files {
+		path := filepath.Join(clonePath, filepath.FromSlash(name))
+		skipped := name == "logs/latest.log" || name == "world/session.lock"
+		if skipped {
+			if utils.FileExists(path) {
+				t.Errorf("%s was copied to the clone", name)
+			}
+			continue
+		}
+
+		got, err := os.ReadFile(path)
+		if err != nil || string(got) != content {
+			t.Errorf("%s = %q (%v), want %q", name, got, err, content)
+		}
+	}
+
+	// The clone has its own directory
+	os.WriteFile(filepath.Join(clonePath, "server.properties"), []byte("motd=clone\n"), 0644)
+	if got, _ := os.ReadFile(filepath.Join(source.Path, "server.properties")); string(got) != "motd=source\n" {
+		t.Errorf("editing the clone changed the source: %q", got)
+	}
+}
+
+func TestCloneServerRefusesExistingDirectory(t *testing.T) {
+	testDB(t)
+	useTestBackupService(t)
+
+	source := testutil.CreateServer(t, &models.Server{})
+	if _, err := CloneServer(source, CloneOptions{Name: "clone", Path: t.TempDir(), Port: 55300}); err == nil {
+		t.Fatal("expected cloning into an existing directory to fail")
+	}
+}
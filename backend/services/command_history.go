@@ -0,0 +1,130 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrCommandNotFound is returned for history entries that don't exist or
+	// belong to another user or server
+	ErrCommandNotFound = errors.New("command not found")
+	// ErrCommandRedacted is returned when replaying a command that was stored redacted
+	ErrCommandRedacted = errors.New("command was redacted and cannot be replayed")
+)
+
+const (
+	defaultCommandHistoryPageSize = 50
+	maxCommandHistoryPageSize     = 200
+)
+
+// sensitiveCommands are the first words of commands that take a password,
+// such as AuthMe's /login and /register
+var sensitiveCommands = map[string]bool{
+	"login":          true,
+	"l":              true,
+	"register":       true,
+	"reg":            true,
+	"changepassword": true,
+	"changepass":     true,
+	"authme":         true,
+}
+
+// sensitiveWords flag commands anywhere in which a credential appears
+var sensitiveWords = regexp.MustCompile(`(?i)(password|passwd|secret|token|api[_-]?key)`)
+
+// CommandHistoryPage is one page of a user's commands on a server
+type CommandHistoryPage struct {
+	Commands []models.CommandHistory `json:"commands"`
+	Page     int                     `json:"page"`
+	PerPage  int                     `json:"per_page"`
+	Total    int64                   `json:"total"`
+}
+
+// RecordCommand stores a command in the user's history for the server. A
+// failure is logged rather than returned, since the command was already sent.
+func RecordCommand(serverID, userID uuid.UUID, command, source string) {
+	text, redacted := RedactCommand(command)
+	entry := models.CommandHistory{
+		ServerID: serverID,
+		UserID:   userID,
+		Command:  text,
+		Redacted: redacted,
+		Source:   source,
+	}
+
+	if err := database.DB.Create(&entry).Error; err != nil {
+		log.Printf("Failed to record command history for server %s: %v", serverID, err)
+	}
+}
+
+// RedactCommand returns the command as it may be stored. Commands that look
+// like they carry a credential keep only their first word.
+func RedactCommand(command string) (string, bool) {
+	command = strings.TrimSpace(command)
+	fields := strings.Fields(strings.TrimPrefix(command, "/"))
+	if len(fields) == 0 {
+		return command, false
+	}
+
+	if sensitiveCommands[strings.ToLower(fields[0])] || sensitiveWords.MatchString(command) {
+		return fields[0] + " [redacted]", true
+	}
+	return command, false
+}
+
+// ListCommandHistory returns a page of the user's commands on the server,
+// newest first
+func ListCommandHistory(serverID, userID uuid.UUID, page, perPage int) (*CommandHistoryPage, error) {
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = defaultCommandHistoryPageSize
+	}
+	if perPage > maxCommandHistoryPageSize {
+		perPage = maxCommandHistoryPageSize
+	}
+
+	result := &CommandHistoryPage{Page: page, PerPage: perPage}
+
+	query := database.DB.Model(&models.CommandHistory{}).Where("server_id = ? AND user_id = ?", serverID, userID)
+	if err := query.Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+
+	if err := query.Order("created_at DESC").Offset((page - 1) * perPage).Limit(perPage).
+		Find(&result.Commands).Error; err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ReplayCommand sends one of the user's earlier commands to the server again
+// and records it as a new history entry
+func ReplayCommand(server *models.Server, userID, entryID uuid.UUID) (*models.CommandHistory, error) {
+	var entry models.CommandHistory
+	if err := database.DB.Where("id = ? AND server_id = ? AND user_id = ?", entryID, server.ID, userID).
+		First(&entry).Error; err != nil {
+		return nil, ErrCommandNotFound
+	}
+
+	if entry.Redacted {
+		return nil, ErrCommandRedacted
+	}
+
+	if err := SendServerCommand(server, entry.Command); err != nil {
+		return nil, err
+	}
+
+	RecordCommand(server.ID, userID, entry.Command, "replay")
+	return &entry, nil
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// createTestCommands saves commands for the user on the server, each a minute
+// after the one before, and deletes the server's history when the test ends
+func createTestCommands(t *testing.T, serverID, userID uuid.UUID, commands ...string) []models.CommandHistory {
+	t.Helper()
+
+	t.Cleanup(func() { database.DB.Where("server_id = ?", serverID).Delete(&models.CommandHistory{}) })
+
+	start := time.Now().Add(-time.Hour)
+	entries := make([]models.CommandHistory, len(commands))
+	for i, command := range commands {
+		text, redacted := RedactCommand(command)
+		entries[i] = models.CommandHistory{
+			ServerID:  serverID,
+			UserID:    userID,
+			Command:   text,
+			Redacted:  redacted,
+			Source:    "api",
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		}
+	}
+	if err := database.DB.Create(&entries).Error; err != nil {
+		t.Fatalf("failed to create command history: %v", err)
+	}
+	return entries
+}
+
+func TestRedactCommand(t *testing.T) {
+	tests := []struct {
+		command  string
+		want     string
+		redacted bool
+	}{
+		{"say hello", "say hello", false},
+		{"  /give Steve diamond 64 ", "/give Steve diamond 64", false},
+		{"/login hunter2", "login [redacted]", true},
+		{"register hunter2 hunter2", "register [redacted]", true},
+		{"AuthMe changepassword Steve hunter2", "AuthMe [redacted]", true},
+		{"lp user Steve meta set discord_token abc", "lp [redacted]", true},
+		{"rcon set PASSWORD abc", "rcon [redacted]", true},
+		{"webhook api-key abc", "webhook [redacted]", true},
+		{"list", "list", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, redacted := RedactCommand(tt.command)
+		if got != tt.want || redacted != tt.redacted {
+			t.Errorf("RedactCommand(%q) = %q, %v, want %q, %v", tt.command, got, redacted, tt.want, tt.redacted)
+		}
+	}
+}
+
+func TestListCommandHistoryOrderingAndPagination(t *testing.T) {
+	testDB(t)
+	server := testutil.CreateServer(t, &models.Server{})
+	user := testutil.CreateUser(t, &models.User{})
+	other := testutil.CreateUser(t, &models.User{})
+
+	createTestCommands(t, server.ID, user.ID, "cmd-1", "cmd-2", "cmd-3", "cmd-4", "cmd-5")
+	createTestCommands(t, server.ID, other.ID, "someone else's")
+
+	commandsOf := func(page *CommandHistoryPage) string {
+		var commands []string
+		for _, entry := range page.Commands {
+			commands = append(commands, entry.Command)
+		}
+		return strings.Join(commands, ",")
+	}
+
+	tests := []struct {
+		page, perPage int
+		want          string
+	}{
+		{1, 2, "cmd-5,cmd-4"},
+		{2, 2, "cmd-3,cmd-2"},
+		{3, 2, "cmd-1"},
+		{4, 2, ""},
+		{0, 0, "cmd-5,cmd-4,cmd-3,cmd-2,cmd-1"}, // first page of the default size
+	}
+	for _, tt := range tests {
+		page, err := ListCommandHistory(server.ID, user.ID, tt.page, tt.perPage)
+		if err != nil {
+			t.Fatalf("ListCommandHistory(%d, %d): %v", tt.page, tt.perPage, err)
+		}
+		if got := commandsOf(page); got != tt.want {
+			t.Errorf("page %d of %d = %s, want %s", tt.page, tt.perPage, got, tt.want)
+		}
+		if page.Total != 5 {
+			t.Errorf("page %d of %d: total = %d, want only the user's 5", tt.page, tt.perPage, page.Total)
+		}
+	}
+
+	page, _ := ListCommandHistory(server.ID, user.ID, 0, 1000)
+	if page.Page != 1 || page.PerPage != maxCommandHistoryPageSize {
+		t.Errorf("page %d of %d, want page 1 capped at %d", page.Page, page.PerPage, maxCommandHistoryPageSize)
+	}
+}
+
+func TestRecordCommandRedactsCredentials(t *testing.T) {
+	testDB(t)
+	server := testutil.CreateServer(t, &models.Server{})
+	user := testutil.CreateUser(t, &models.User{})
+	t.Cleanup(func() { database.DB.Where("server_id = ?", server.ID).Delete(&models.CommandHistory{}) })
+
+	RecordCommand(server.ID, user.ID, "/register hunter2 hunter2", "websocket")
+
+	var stored []models.CommandHistory
+	database.DB.Where("server_id = ?", server.ID).Find(&stored)
+	if len(stored) != 1 {
+		t.Fatalf("%d entries stored, want 1", len(stored))
+	}
+	if stored[0].Command != "register [redacted]" || !stored[0].Redacted || stored[0].Source != "websocket" {
+		t.Errorf("stored %+v, want the command redacted", stored[0])
+	}
+	if strings.Contains(stored[0].Command, "hunter2") {
+		t.Error("the password was stored")
+	}
+}
+
+func TestReplayCommand(t *testing.T) {
+	testDB(t)
+	server := testutil.CreateServer(t, &models.Server{})
+	user := testutil.CreateUser(t, &models.User{})
+	other := testutil.CreateUser(t, &models.User{})
+	startFakeServer(t, server)
+
+	entries := createTestCommands(t, server.ID, user.ID, "list", "login hunter2")
+	theirs := createTestCommands(t, server.ID, other.ID, "list")
+
+	if _, err := ReplayCommand(server, user.ID, entries[1].ID); !errors.Is(err, ErrCommandRedacted) {
+		t.Errorf("replaying a redacted command = %v, want ErrCommandRedacted", err)
+	}
+	if _, err := ReplayCommand(server, user.ID, theirs[0].ID); !errors.Is(err, ErrCommandNotFound) {
+		t.Errorf("replaying another user's command = %v, want ErrCommandNotFound", err)
+	}
+	if _, err := ReplayCommand(server, user.ID, uuid.New()); !errors.Is(err, ErrCommandNotFound) {
+		t.Errorf("replaying an unknown command = %v, want ErrCommandNotFound", err)
+	}
+
+	replayed, err := ReplayCommand(server, user.ID, entries[0].ID)
+	if err != nil {
+		t.Fatalf("ReplayCommand: %v", err)
+	}
+	if replayed.Command != "list" {
+		t.Errorf("replayed %q, want list", replayed.Command)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Join(serverCommands(server), ",") != "list" && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got := serverCommands(server); strings.Join(got, ",") != "list" {
+		t.Errorf("server received %v, want only the replayed list", got)
+	}
+
+	// The replay is recorded as the newest entry
+	page, err := ListCommandHistory(server.ID, user.ID, 1, 1)
+	if err != nil {
+		t.Fatalf("ListCommandHistory: %v", err)
+	}
+	if page.Total != 3 || page.Commands[0].Command != "list" || page.Commands[0].Source != "replay" {
+		t.Errorf("history = %+v, want the replay recorded first", page)
+	}
+}
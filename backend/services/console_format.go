@@ -0,0 +1,290 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ConsoleSpan is a run of console text in one style. Color is a hex RGB
+// color such as #FF5555, empty for the default color.
+type ConsoleSpan struct {
+	Text          string `json:"text"`
+	Color         string `json:"color,omitempty"`
+	Bold          bool   `json:"bold,omitempty"`
+	Italic        bool   `json:"italic,omitempty"`
+	Underline     bool   `json:"underline,omitempty"`
+	Strikethrough bool   `json:"strikethrough,omitempty"`
+	Obfuscated    bool   `json:"obfuscated,omitempty"`
+}
+
+// ConsoleLine is a console line with its formatting codes and control
+// characters taken out. Spans holds the styled runs making up Text, and is
+// empty when the line has no styling. Level and Continuation are set by
+// classifying the line, see consoleClassifier.
+type ConsoleLine struct {
+	Text         string        `json:"text"`
+	Spans        []ConsoleSpan `json:"spans,omitempty"`
+	Level        string        `json:"level,omitempty"`
+	Continuation bool          `json:"continuation,omitempty"`
+}
+
+// consoleStyle is the style the next text is written in
+type consoleStyle struct {
+	color                                              string
+	bold, italic, underline, strikethrough, obfuscated bool
+}
+
+// minecraftColors are the section sign color codes, 0-9 and a-f
+var minecraftColors = map[rune]string{
+	'0': "#000000", '1': "#0000AA", '2': "#00AA00", '3': "#00AAAA",
+	'4': "#AA0000", '5': "#AA00AA", '6': "#FFAA00", '7': "#AAAAAA",
+	'8': "#555555", '9': "#5555FF", 'a': "#55FF55", 'b': "#55FFFF",
+	'c': "#FF5555", 'd': "#FF55FF", 'e': "#FFFF55", 'f': "#FFFFFF",
+}
+
+// ansiColors are the 16 basic ANSI colors, normal then bright, in the
+// Minecraft palette that servers translate their color codes to
+var ansiColors = [16]string{
+	"#000000", "#AA0000", "#00AA00", "#FFAA00", "#0000AA", "#AA00AA", "#00AAAA", "#AAAAAA",
+	"#555555", "#FF5555", "#55FF55", "#FFFF55", "#5555FF", "#FF55FF", "#55FFFF", "#FFFFFF",
+}
+
+// ParseConsoleLine splits a raw console line into clean text and styled
+// spans. Minecraft section sign codes (§c, §l, §x§R§R§G§G§B§B hex colors)
+// and ANSI SGR sequences become span styles; other escape sequences and
+// control characters are dropped.
+func ParseConsoleLine(raw string) ConsoleLine {
+	parser := consoleParser{}
+	runes := []rune(raw)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '§' && i+1 < len(runes):
+			i += parser.sectionCode(runes[i+1:])
+		case r == '\x1b':
+			i += parser.escapeSequence(runes[i+1:])
+		case r == '\t' || !unicode.IsControl(r):
+			parser.text.WriteRune(r)
+		}
+	}
+	parser.flush()
+
+	line := ConsoleLine{Text: parser.clean.String()}
+	for _, span := range parser.spans {
+		if span != (ConsoleSpan{Text: span.Text}) {
+			line.Spans = parser.spans
+			break
+		}
+	}
+	return line
+}
+
+// consoleParser collects the spans of a line as its codes are read
+type consoleParser struct {
+	style consoleStyle
+	text  strings.Builder
+	clean strings.Builder
+	spans []ConsoleSpan
+}
+
+// setStyle switches to a new style, closing the span written so far
+func (p *consoleParser) setStyle(style consoleStyle) {
+	if style != p.style {
+		p.flush()
+		p.style = style
+	}
+}
+
+// flush closes the current span
+func (p *consoleParser) flush() {
+	if p.text.Len() == 0 {
+		return
+	}
+	text := p.text.String()
+	p.text.Reset()
+	p.clean.WriteString(text)
+	p.spans = append(p.spans, ConsoleSpan{
+		Text:          text,
+		Color:         p.style.color,
+		Bold:          p.style.bold,
+		Italic:        p.style.italic,
+		Underline:     p.style.underline,
+		Strikethrough: p.style.strikethrough,
+		Obfuscated:    p.style.obfuscated,
+	})
+}
+
+// sectionCode applies the code following a section sign and returns how
+// many runes it used
+func (p *consoleParser) sectionCode(rest []rune) int {
+	code := unicode.ToLower(rest[0])
+	style := p.style
+
+	switch code {
+	case 'x':
+		// §x§R§R§G§G§B§B
+		if len(rest) >= 13 {
+			var hex strings.Builder
+			for j := 2; j < 13; j += 2 {
+				if rest[j-1] != '§' || !isHexDigit(rest[j]) {
+					hex.Reset()
+					break
+				}
+				hex.WriteRune(unicode.ToUpper(rest[j]))
+			}
+			if hex.Len() == 6 {
+				p.setStyle(consoleStyle{color: "#" + hex.String()})
+				return 13
+			}
+		}
+	case 'k':
+		style.obfuscated = true
+	case 'l':
+		style.bold = true
+	case 'm':
+		style.strikethrough = true
+	case 'n':
+		style.underline = true
+	case 'o':
+		style.italic = true
+	case 'r':
+		style = consoleStyle{}
+	default:
+		color, ok := minecraftColors[code]
+		if !ok {
+			// Not a code; keep the text as written
+			p.text.WriteRune('§')
+			return 0
+		}
+		// A color also ends any formatting, as in Minecraft
+		style = consoleStyle{color: color}
+	}
+
+	p.setStyle(style)
+	return 1
+}
+
+// escapeSequence handles the sequence after an ESC and returns how many
+// runes it used. SGR sequences set the style; anything else is skipped.
+func (p *consoleParser) escapeSequence(rest []rune) int {
+	if len(rest) == 0 {
+		return 0
+	}
+
+	switch rest[0] {
+	case '[':
+		// CSI: parameters and intermediates up to a final byte in @-~
+		for j := 1; j < len(rest); j++ {
+			if rest[j] >= '@' && rest[j] <= '~' {
+				if rest[j] == 'm' {
+					p.sgr(string(rest[1:j]))
+				}
+				return j + 1
+			}
+		}
+		return len(rest)
+	case ']':
+		// OSC: up to BEL or ESC \
+		for j := 1; j < len(rest); j++ {
+			if rest[j] == '\a' {
+				return j + 1
+			}
+			if rest[j] == '\x1b' && j+1 < len(rest) && rest[j+1] == '\\' {
+				return j + 2
+			}
+		}
+		return len(rest)
+	}
+	return 1
+}
+
+// sgr applies an ANSI Select Graphic Rendition parameter list
+func (p *consoleParser) sgr(params string) {
+	style := p.style
+	codes := strings.Split(params, ";")
+
+	for i := 0; i < len(codes); i++ {
+		code, err := strconv.Atoi(codes[i])
+		if err != nil {
+			code = 0 // an empty parameter means reset
+		}
+
+		switch {
+		case code == 0:
+			style = consoleStyle{}
+		case code == 1:
+			style.bold = true
+		case code == 3:
+			style.italic = true
+		case code == 4:
+			style.underline = true
+		case code == 5 || code == 6:
+			style.obfuscated = true
+		case code == 9:
+			style.strikethrough = true
+		case code == 22:
+			style.bold = false
+		case code == 23:
+			style.italic = false
+		case code == 24:
+			style.underline = false
+		case code == 25:
+			style.obfuscated = false
+		case code == 29:
+			style.strikethrough = false
+		case code >= 30 && code <= 37:
+			style.color = ansiColors[code-30]
+		case code >= 90 && code <= 97:
+			style.color = ansiColors[code-90+8]
+		case code == 39:
+			style.color = ""
+		case code == 38 && i+2 < len(codes) && codes[i+1] == "5":
+			if n, err := strconv.Atoi(codes[i+2]); err == nil && n >= 0 && n <= 255 {
+				style.color = ansi256Color(n)
+			}
+			i += 2
+		case code == 38 && i+4 < len(codes) && codes[i+1] == "2":
+			r, _ := strconv.Atoi(codes[i+2])
+			g, _ := strconv.Atoi(codes[i+3])
+			b, _ := strconv.Atoi(codes[i+4])
+			style.color = fmt.Sprintf("#%02X%02X%02X", r&0xff, g&0xff, b&0xff)
+			i += 4
+		case code == 48 && i+1 < len(codes):
+			// Background colors aren't kept; skip their arguments
+			if codes[i+1] == "5" {
+				i += 2
+			} else if codes[i+1] == "2" {
+				i += 4
+			}
+		}
+	}
+
+	p.setStyle(style)
+}
+
+// ansi256Color converts a 256-color palette index to hex
+func ansi256Color(n int) string {
+	switch {
+	case n < 16:
+		return ansiColors[n]
+	case n < 232:
+		n -= 16
+		level := func(v int) int {
+			if v == 0 {
+				return 0
+			}
+			return 55 + v*40
+		}
+		return fmt.Sprintf("#%02X%02X%02X", level(n/36), level(n/6%6), level(n%6))
+	default:
+		gray := 8 + (n-232)*10
+		return fmt.Sprintf("#%02X%02X%02X", gray, gray, gray)
+	}
+}
+
+func isHexDigit(r rune) bool {
+	return (r >= '0' && r <= '9') || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
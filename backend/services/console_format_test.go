@@ -0,0 +1,150 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+func TestParseConsoleLineSectionCodes(t *testing.T) {
+	line := ParseConsoleLine("§cError: §lfailed§r to load §x§1§2§a§b§c§dworld")
+
+	if line.Text != "Error: failed to load world" {
+		t.Errorf("text = %q, want the line without codes", line.Text)
+	}
+	want := []ConsoleSpan{
+		{Text: "Error: ", Color: "#FF5555"},
+		{Text: "failed", Color: "#FF5555", Bold: true},
+		{Text: " to load "},
+		{Text: "world", Color: "#12ABCD"},
+	}
+	if !reflect.DeepEqual(line.Spans, want) {
+		t.Errorf("spans = %+v, want %+v", line.Spans, want)
+	}
+}
+
+func TestParseConsoleLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       string
+		wantText  string
+		wantSpans []ConsoleSpan
+	}{
+		{
+			name:     "plain line",
+			raw:      "[12:00:00 INFO]: Done (3.2s)!",
+			wantText: "[12:00:00 INFO]: Done (3.2s)!",
+		},
+		{
+			name:     "codes in upper case",
+			raw:      "§AHello §NWorld",
+			wantText: "Hello World",
+			wantSpans: []ConsoleSpan{
+				{Text: "Hello ", Color: "#55FF55"},
+				{Text: "World", Color: "#55FF55", Underline: true},
+			},
+		},
+		{
+			name:     "color ends formatting",
+			raw:      "§l§obold§6gold",
+			wantText: "boldgold",
+			wantSpans: []ConsoleSpan{
+				{Text: "bold", Bold: true, Italic: true},
+				{Text: "gold", Color: "#FFAA00"},
+			},
+		},
+		{
+			name:     "section sign that isn't a code",
+			raw:      "costs 5§ or §zmore§",
+			wantText: "costs 5§ or §zmore§",
+		},
+		{
+			name:     "ansi colors",
+			raw:      "\x1b[31mred\x1b[0m \x1b[1;92mgreen\x1b[22m \x1b[38;5;21mblue\x1b[38;2;1;2;3mrgb\x1b[m",
+			wantText: "red green bluergb",
+			wantSpans: []ConsoleSpan{
+				{Text: "red", Color: "#AA0000"},
+				{Text: " "},
+				{Text: "green", Color: "#55FF55", Bold: true},
+				{Text: " ", Color: "#55FF55"},
+				{Text: "blue", Color: "#0000FF"},
+				{Text: "rgb", Color: "#010203"},
+			},
+		},
+		{
+			name:     "other escapes and control characters",
+			raw:      "\x1b[2K\x1b]0;title\a> list\r\x00\x07\tplayers",
+			wantText: "> list\tplayers",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := ParseConsoleLine(tt.raw)
+			if line.Text != tt.wantText {
+				t.Errorf("text = %q, want %q", line.Text, tt.wantText)
+			}
+			if !reflect.DeepEqual(line.Spans, tt.wantSpans) {
+				t.Errorf("spans = %+v, want %+v", line.Spans, tt.wantSpans)
+			}
+		})
+	}
+}
+
+// subscribeTestClient registers a connectionless client subscribed to a
+// server's console and returns it; broadcasts queue on its send channel
+func subscribeTestClient(t *testing.T, serverID uuid.UUID) *wsClient {
+	t.Helper()
+
+	client := newWSClient(nil, uuid.New())
+	client.subscribe(serverID)
+	id := uuid.NewString()
+
+	wsManager.mutex.Lock()
+	wsManager.connections[id] = client
+	wsManager.mutex.Unlock()
+	t.Cleanup(func() {
+		wsManager.mutex.Lock()
+		delete(wsManager.connections, id)
+		wsManager.mutex.Unlock()
+	})
+	return client
+}
+
+// nextConsoleMessage returns the next console line broadcast to client
+func nextConsoleMessage(t *testing.T, client *wsClient) ConsoleMessage {
+	t.Helper()
+
+	select {
+	case message := <-client.send:
+		console, ok := message.Data.(ConsoleMessage)
+		if message.Type != "console_log" || !ok {
+			t.Fatalf("message = %+v, want a console line", message)
+		}
+		return console
+	case <-time.After(5 * time.Second):
+		t.Fatal("no console line broadcast")
+		return ConsoleMessage{}
+	}
+}
+
+func TestBroadcastServerLogStructuredOutputSetting(t *testing.T) {
+	serverID := uuid.New()
+	client := subscribeTestClient(t, serverID)
+	line := ParseConsoleLine("§aServer started")
+
+	useTestSettings(t)
+	BroadcastServerLog(serverID, line)
+	if console := nextConsoleMessage(t, client); console.Line != "Server started" || len(console.Spans) != 1 {
+		t.Errorf("console line = %+v, want the clean text with its span by default", console)
+	}
+
+	useTestSettings(t, models.SystemSetting{Key: "console_structured_output", Value: "false", Type: "boolean"})
+	BroadcastServerLog(serverID, line)
+	if console := nextConsoleMessage(t, client); console.Line != "Server started" || console.Spans != nil {
+		t.Errorf("console line = %+v, want only the clean text with structured output off", console)
+	}
+}
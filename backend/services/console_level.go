@@ -0,0 +1,81 @@
+package services
+
+import "regexp"
+
+// Console line levels, as sent in ConsoleMessage.Type
+const (
+	ConsoleLevelInfo  = "info"
+	ConsoleLevelWarn  = "warn"
+	ConsoleLevelError = "error"
+)
+
+var (
+	// logLevelPattern finds the level in the prefix servers put on log
+	// lines: "[12:34:56 INFO]:" (Paper), "[12:34:56] [Server thread/WARN]:"
+	// (vanilla, Fabric, Forge) and "[2024-01-01 12:34:56:789 ERROR]" (Bedrock)
+	logLevelPattern = regexp.MustCompile(`^(?:\[[^\]]*\]\s*)?\[[^\]]*?[\s/](INFO|WARN|WARNING|ERROR|SEVERE|FATAL|DEBUG|TRACE)\]`)
+	// stackFramePattern matches the lines of a Java stack trace after its
+	// first line
+	stackFramePattern = regexp.MustCompile(`^\s+at \S|^\s*\.\.\. \d+ (?:more|common frames omitted)|^\s*Caused by: |^\s*Suppressed: `)
+	// exceptionPattern matches the first line of a Java stack trace, such as
+	// "java.lang.IllegalStateException: message"
+	exceptionPattern = regexp.MustCompile(`^(?:Exception in thread "[^"]*" )?(?:[a-zA-Z_$][\w$]*\.)+[A-Z][\w$]*(?:Exception|Error|Throwable)(?::.*)?$`)
+)
+
+// logLevels maps the levels servers log with to console levels
+var logLevels = map[string]string{
+	"TRACE":   ConsoleLevelInfo,
+	"DEBUG":   ConsoleLevelInfo,
+	"INFO":    ConsoleLevelInfo,
+	"WARN":    ConsoleLevelWarn,
+	"WARNING": ConsoleLevelWarn,
+	"ERROR":   ConsoleLevelError,
+	"SEVERE":  ConsoleLevelError,
+	"FATAL":   ConsoleLevelError,
+}
+
+// consoleClassifier works out the level of each line of one output stream.
+// It is stateful because a stack trace spans several lines without a log
+// prefix, all of which belong to the line that started it.
+type consoleClassifier struct {
+	level   string
+	inTrace bool
+}
+
+// classify sets the line's level, and marks it as a continuation when it
+// belongs to the previous line's block, as the lines of a stack trace do
+func (cc *consoleClassifier) classify(line *ConsoleLine) {
+	if match := logLevelPattern.FindStringSubmatch(line.Text); match != nil {
+		cc.level = logLevels[match[1]]
+		cc.inTrace = false
+		line.Level = cc.level
+		return
+	}
+
+	switch {
+	case stackFramePattern.MatchString(line.Text) && (cc.inTrace || cc.level != ""):
+		// A frame of the trace in progress, or of one logged with a level
+		cc.inTrace = true
+		line.Continuation = true
+	case exceptionPattern.MatchString(line.Text):
+		cc.inTrace = true
+		if cc.level == ConsoleLevelWarn || cc.level == ConsoleLevelError {
+			// The exception the warning or error just logged was about
+			line.Continuation = true
+		} else {
+			// A trace printed on its own, as printStackTrace does
+			cc.level = ConsoleLevelError
+		}
+	case stackFramePattern.MatchString(line.Text):
+		cc.level = ConsoleLevelError
+		cc.inTrace = true
+	default:
+		cc.level = ConsoleLevelInfo
+		cc.inTrace = false
+	}
+
+	if cc.level == "" {
+		cc.level = ConsoleLevelInfo
+	}
+	line.Level = cc.level
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// classifiedLine is a console line with the level and continuation it should
+// be classified with
+type classifiedLine struct {
+	text         string
+	level        string
+	continuation bool
+}
+
+// checkClassified runs the lines through one classifier in order
+func checkClassified(t *testing.T, lines []classifiedLine) {
+	t.Helper()
+
+	var classifier consoleClassifier
+	for i, want := range lines {
+		line := ConsoleLine{Text: want.text}
+		classifier.classify(&line)
+		if line.Level != want.level || line.Continuation != want.continuation {
+			t.Errorf("line %d %q = %s, continuation %v; want %s, continuation %v",
+				i+1, want.text, line.Level, line.Continuation, want.level, want.continuation)
+		}
+	}
+}
+
+func TestClassifyLogLevels(t *testing.T) {
+	checkClassified(t, []classifiedLine{
+		{"[12:34:56 INFO]: Starting minecraft server version 1.20.4", ConsoleLevelInfo, false},
+		{"[12:34:56 WARN]: Can't keep up! Is the server overloaded?", ConsoleLevelWarn, false},
+		{"[12:34:56 ERROR]: Could not load 'plugins/Broken.jar'", ConsoleLevelError, false},
+		{"[12:34:56] [Server thread/INFO]: Done (4.512s)! For help, type \"help\"", ConsoleLevelInfo, false},
+		{"[12:34:56] [Server thread/WARN]: Ambiguity between arguments", ConsoleLevelWarn, false},
+		{"[12:34:56] [Worker-Main-1/ERROR]: Failed to load recipe", ConsoleLevelError, false},
+		{"[2024-01-01 12:34:56:789 ERROR] Network port occupied, can't start server.", ConsoleLevelError, false},
+		{"[12:34:56 SEVERE]: Legacy plugin error", ConsoleLevelError, false},
+		{"[12:34:56 DEBUG]: Loaded 7 recipes", ConsoleLevelInfo, false},
+		{"> list", ConsoleLevelInfo, false},
+		{"There are 0 of a max of 20 players online", ConsoleLevelInfo, false},
+		// A message that only mentions an error isn't one
+		{"[12:34:56 INFO]: [Shop] 0 errors found in config", ConsoleLevelInfo, false},
+	})
+}
+
+func TestClassifyStackTraceAsOneBlock(t *testing.T) {
+	checkClassified(t, []classifiedLine{
+		{"[12:34:56 ERROR]: Error occurred while enabling Shop v1.0", ConsoleLevelError, false},
+		{"java.lang.NullPointerException: Cannot invoke \"String.length()\"", ConsoleLevelError, true},
+		{"\tat com.example.shop.Shop.onEnable(Shop.java:42) ~[Shop.jar:?]", ConsoleLevelError, true},
+		{"\tat org.bukkit.plugin.java.JavaPlugin.setEnabled(JavaPlugin.java:281)", ConsoleLevelError, true},
+		{"Caused by: java.io.FileNotFoundException: config.yml", ConsoleLevelError, true},
+		{"\t... 12 more", ConsoleLevelError, true},
+		{"[12:34:57 INFO]: Done (3.1s)!", ConsoleLevelInfo, false},
+	})
+
+	// A trace logged with a warning stays a warning
+	checkClassified(t, []classifiedLine{
+		{"[12:34:56] [Server thread/WARN]: Exception ticking entity", ConsoleLevelWarn, false},
+		{"java.lang.IllegalStateException: Entity is removed", ConsoleLevelWarn, true},
+		{"\tat net.minecraft.world.entity.Entity.tick(Entity.java:512)", ConsoleLevelWarn, true},
+	})
+
+	// A trace printed without a log line is an error block of its own
+	checkClassified(t, []classifiedLine{
+		{"Loading libraries, please wait...", ConsoleLevelInfo, false},
+		{"Exception in thread \"main\" java.lang.UnsupportedClassVersionError: bad version", ConsoleLevelError, false},
+		{"\tat java.base/java.lang.ClassLoader.defineClass1(Native Method)", ConsoleLevelError, true},
+		{"Loading libraries again", ConsoleLevelInfo, false},
+	})
+}
+
+func TestStderrLinesClassifiedByContent(t *testing.T) {
+	server := &models.Server{ID: uuid.New(), Path: t.TempDir()}
+	client := subscribeTestClient(t, server.ID)
+	useTestSettings(t)
+
+	stderr := strings.Join([]string{
+		"Picked up JAVA_TOOL_OPTIONS: -Dfile.encoding=UTF-8",
+		"java.lang.OutOfMemoryError: Java heap space",
+		"\tat java.base/java.util.Arrays.copyOf(Arrays.java:3512)",
+	}, "\n")
+	handleServerOutput(server, io.NopCloser(strings.NewReader("")), io.NopCloser(strings.NewReader(stderr)))
+
+	want := []struct {
+		level        string
+		continuation bool
+	}{
+		{ConsoleLevelInfo, false},
+		{ConsoleLevelError, false},
+		{ConsoleLevelError, true},
+	}
+	for i, w := range want {
+		console := nextConsoleMessage(t, client)
+		if console.Type != w.level || console.Continuation != w.continuation {
+			t.Errorf("stderr line %d %q = %s, continuation %v; want %s, continuation %v",
+				i+1, console.Line, console.Type, console.Continuation, w.level, w.continuation)
+		}
+	}
+
+	data, _ := os.ReadFile(filepath.Join(server.Path, "console.log"))
+	logged := string(data)
+	if strings.Contains(logged, "ERROR: Picked up") || !strings.Contains(logged, "ERROR: java.lang.OutOfMemoryError") {
+		t.Errorf("console.log = %q, want only the error lines marked", logged)
+	}
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrCrashReportNotFound is returned for crash reports that don't exist or
+// belong to another server
+var ErrCrashReportNotFound = errors.New("crash report not found")
+
+const (
+	// maxCrashReportBytes bounds how much of a crash report is kept
+	maxCrashReportBytes = 256 * 1024
+	// crashConsoleLines is how much of the console is kept with a crash
+	crashConsoleLines = 200
+	// crashReportsKept is how many crash reports are kept per server
+	crashReportsKept = 20
+)
+
+// CaptureCrashReport stores the newest crash report the server wrote since
+// it started, with the tail of its console, so it outlives the server's
+// files. It returns nil if nothing could be stored.
+func CaptureCrashReport(server *models.Server, exitErr error) *models.CrashReport {
+	report := &models.CrashReport{ServerID: server.ID}
+	if exitErr != nil {
+		report.ExitError = exitErr.Error()
+	}
+
+	since := time.Time{}
+	if server.StartedAt != nil {
+		since = *server.StartedAt
+	}
+	if path := latestCrashReport(server, since); path != "" {
+		content, err := readCrashReport(path)
+		if err != nil {
+			log.Printf("Failed to read crash report of server %s: %v", server.Name, err)
+		} else {
+			report.FileName = filepath.Base(path)
+			report.Report = content
+		}
+	}
+
+	if lines, err := TailFile(filepath.Join(server.Path, "console.log"), crashConsoleLines); err == nil {
+		report.ConsoleTail = strings.Join(lines, "\n")
+	}
+
+	if err := database.DB.Create(report).Error; err != nil {
+		log.Printf("Failed to store crash report of server %s: %v", server.Name, err)
+		return nil
+	}
+	pruneCrashReports(server.ID)
+
+	return report
+}
+
+// latestCrashReport returns the newest file in the server's crash-reports
+// directory written after since, or "" when there is none
+func latestCrashReport(server *models.Server, since time.Time) string {
+	dir := filepath.Join(server.Path, "crash-reports")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	var latest string
+	var latestTime time.Time
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), ".txt") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().Before(since) {
+			continue
+		}
+		if latest == "" || info.ModTime().After(latestTime) {
+			latest = filepath.Join(dir, entry.Name())
+			latestTime = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// readCrashReport reads up to maxCrashReportBytes of a crash report
+func readCrashReport(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, maxCrashReportBytes))
+	if err != nil {
+		return "", err
+	}
+	return strings.ToValidUTF8(string(content), "\uFFFD"), nil
+}
+
+// pruneCrashReports deletes all but the newest crashReportsKept crash
+// reports of a server
+func pruneCrashReports(serverID uuid.UUID) {
+	var keep []uuid.UUID
+	if err := database.DB.Model(&models.CrashReport{}).Where("server_id = ?", serverID).
+		Order("created_at DESC").Limit(crashReportsKept).Pluck("id", &keep).Error; err != nil || len(keep) < crashReportsKept {
+		return
+	}
+
+	if err := database.DB.Where("server_id = ? AND id NOT IN ?", serverID, keep).
+		Delete(&models.CrashReport{}).Error; err != nil {
+		log.Printf("Failed to prune crash reports of server %s: %v", serverID, err)
+	}
+}
+
+// ListCrashReports returns a server's crash reports, newest first, without
+// their contents
+func ListCrashReports(serverID uuid.UUID) ([]models.CrashReport, error) {
+	reports := []models.CrashReport{}
+	err := database.DB.Select("id", "server_id", "file_name", "exit_error", "created_at").
+		Where("server_id = ?", serverID).Order("created_at DESC").Find(&reports).Error
+	return reports, err
+}
+
+// GetCrashReport returns one of a server's crash reports
+func GetCrashReport(serverID, reportID uuid.UUID) (*models.CrashReport, error) {
+	var report models.CrashReport
+	if err := database.DB.Where("id = ? AND server_id = ?", reportID, serverID).First(&report).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCrashReportNotFound
+		}
+		return nil, err
+	}
+	return &report, nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// crashReport is what the fake server writes to crash-reports/ before it
+// exits
+const crashReport = `---- Minecraft Crash Report ----
+// Why did you do that?
+
+Time: 2024-03-01 12:00:00
+Description: Exception in server tick loop
+
+java.lang.OutOfMemoryError: Java heap space
+	at net.minecraft.world.level.chunk.LevelChunk.<init>(LevelChunk.java:112)
+`
+
+// crashingServerScript prints a little console output, writes the crash
+// report and exits with an error
+const crashingServerScript = `echo '[12:00:00 INFO]: Preparing level "world"'
+echo '[12:00:01 ERROR]: Encountered an unexpected exception'
+mkdir -p crash-reports
+cat > crash-reports/crash-2024-03-01_12.00.00-server.txt <<'EOF'
+` + crashReport + `EOF
+sleep 0.5
+exit 1
+`
+
+// waitForNotification waits for the user's notification about the server
+// with the title
+func waitForNotification(t *testing.T, userID, serverID uuid.UUID, title string) models.Notification {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var notification models.Notification
+		err := database.DB.Where("user_id = ? AND server_id = ? AND title = ?", userID, serverID, title).First(&notification).Error
+		if err == nil {
+			return notification
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no %q notification: %v", title, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestCrashAttachesCrashReport(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake server is a shell script")
+	}
+	testDB(t)
+
+	owner := testutil.CreateUser(t, &models.User{})
+	server := testutil.CreateServer(t, &models.Server{})
+	testutil.GrantServerAccess(t, owner, server, models.ServerRoleOwner)
+
+	// A report from an earlier crash isn't this crash's
+	old := filepath.Join(server.Path, "crash-reports", "crash-2024-02-01_09.00.00-server.txt")
+	if err := os.MkdirAll(filepath.Dir(old), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeLog(t, old, "---- Minecraft Crash Report ----\nDescription: an old crash\n")
+	earlier := time.Now().Add(-time.Hour)
+	os.Chtimes(old, earlier, earlier)
+
+	cmd := exec.Command("sh", "-c", crashingServerScript)
+	cmd.Dir = server.Path
+	server.Status = models.ServerStatusStarting
+	if err := launchServerProcess(server, cmd); err != nil {
+		t.Fatalf("launchServerProcess: %v", err)
+	}
+
+	notification := waitForNotification(t, owner.ID, server.ID, "Server crashed")
+	if notification.CrashReportID == nil {
+		t.Fatal("crash notification has no crash report")
+	}
+	var report models.CrashReport
+	if err := database.DB.First(&report, "id = ?", *notification.CrashReportID).Error; err != nil {
+		t.Fatalf("linked crash report: %v", err)
+	}
+
+	if report.ServerID != server.ID || report.FileName != "crash-2024-03-01_12.00.00-server.txt" || report.Report != crashReport {
+		t.Errorf("crash report = %s with %q, want this crash's report file", report.FileName, report.Report)
+	}
+	if !strings.Contains(report.ConsoleTail, "Encountered an unexpected exception") {
+		t.Errorf("console tail = %q, want the output before the crash", report.ConsoleTail)
+	}
+	if report.ExitError != "exit status 1" {
+		t.Errorf("exit error = %q, want exit status 1", report.ExitError)
+	}
+	if status := serverStatus(server.ID); status != models.ServerStatusCrashed {
+		t.Errorf("status = %s, want crashed", status)
+	}
+}
+
+func TestCaptureCrashReportWithoutReportFile(t *testing.T) {
+	testDB(t)
+	server := testutil.CreateServer(t, &models.Server{})
+
+	var console strings.Builder
+	for i := 1; i <= crashConsoleLines+50; i++ {
+		fmt.Fprintf(&console, "[12:00:00 INFO]: line %d\n", i)
+	}
+	writeLog(t, filepath.Join(server.Path, "console.log"), console.String())
+
+	report := CaptureCrashReport(server, nil)
+	if report == nil {
+		t.Fatal("nothing captured without a crash report file")
+	}
+	lines := strings.Split(report.ConsoleTail, "\n")
+	if report.FileName != "" || report.Report != "" || len(lines) != crashConsoleLines || lines[0] != "[12:00:00 INFO]: line 51" {
+		t.Errorf("captured %q and %d console lines from %q, want only the last %d console lines",
+			report.FileName, len(lines), lines[0], crashConsoleLines)
+	}
+}
+
+func TestCaptureCrashReportLimits(t *testing.T) {
+	testDB(t)
+	server := testutil.CreateServer(t, &models.Server{})
+
+	path := filepath.Join(server.Path, "crash-reports", "crash-huge.txt")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeLog(t, path, strings.Repeat("x", maxCrashReportBytes+1000))
+
+	// Only so much of a report is kept, and only so many reports
+	for i := 0; i < crashReportsKept+2; i++ {
+		report := CaptureCrashReport(server, nil)
+		if report == nil {
+			t.Fatalf("capture %d stored nothing", i)
+		}
+		if len(report.Report) != maxCrashReportBytes {
+			t.Fatalf("capture %d kept %d bytes of the report, want %d", i, len(report.Report), maxCrashReportBytes)
+		}
+	}
+
+	reports, err := ListCrashReports(server.ID)
+	if err != nil || len(reports) != crashReportsKept {
+		t.Fatalf("%d crash reports kept (%v), want %d", len(reports), err, crashReportsKept)
+	}
+	if reports[0].Report != "" {
+		t.Error("listing includes the reports' contents")
+	}
+
+	if _, err := GetCrashReport(uuid.New(), reports[0].ID); !errors.Is(err, ErrCrashReportNotFound) {
+		t.Errorf("another server's crash report = %v, want ErrCrashReportNotFound", err)
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"sync"
+	"testing"
+
+	"playpulse-panel/config"
+	"playpulse-panel/internal/testutil"
+)
+
+// testDB points database.DB at the test database through testutil.UseDB and
+// drops cached settings
+func testDB(t *testing.T) {
+	t.Helper()
+
+	testutil.UseDB(t)
+	resetSettingsCache()
+	t.Cleanup(resetSettingsCache)
+}
+
+func resetSettingsCache() {
+	settingsMutex.Lock()
+	settingsCache = nil
+	settingsMutex.Unlock()
+}
+
+// setTestSetting changes a setting for the duration of the test
+func setTestSetting(t *testing.T, key, value string) {
+	t.Helper()
+
+	_, previous, err := UpdateSetting(key, value)
+	if err != nil {
+		t.Fatalf("failed to set %s: %v", key, err)
+	}
+	t.Cleanup(func() { UpdateSetting(key, previous) })
+}
+
+// useTestBackupService swaps in a backup service writing under a temporary
+// directory, without starting its workers or scheduler
+func useTestBackupService(t *testing.T) *BackupService {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Files.BackupPath = t.TempDir()
+	cfg.Files.BackupConcurrency = 1
+
+	service := &BackupService{config: cfg, keys: map[string][]byte{}}
+	service.cond = sync.NewCond(&service.mutex)
+
+	previous := backupService
+	backupService = service
+	t.Cleanup(func() { backupService = previous })
+	return service
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrDiskQuotaExceeded is returned for writes that would take a server past its DiskLimit
+var ErrDiskQuotaExceeded = errors.New("disk quota exceeded")
+
+// DiskMonitor caches server directory sizes and alerts when a server nears
+// its DiskLimit. Sizes are refreshed by a periodic walk; writes through the
+// panel adjust the cached value in between.
+type DiskMonitor struct {
+	interval  time.Duration
+	threshold int
+	enforce   bool
+	usage     map[uuid.UUID]*diskUsageEntry
+	mutex     sync.Mutex
+}
+
+type diskUsageEntry struct {
+	bytes     int64
+	checkedAt time.Time
+	alerted   bool // cleared once usage drops back below the threshold
+}
+
+var diskMonitor = &DiskMonitor{
+	interval:  5 * time.Minute,
+	threshold: 90,
+	usage:     make(map[uuid.UUID]*diskUsageEntry),
+}
+
+// InitializeDiskMonitor starts the periodic disk usage check
+func InitializeDiskMonitor(cfg *config.Config) {
+	diskMonitor.mutex.Lock()
+	if cfg.Monitoring.DiskCheckInterval > 0 {
+		diskMonitor.interval = cfg.Monitoring.DiskCheckInterval
+	}
+	if cfg.Monitoring.DiskAlertThreshold > 0 && cfg.Monitoring.DiskAlertThreshold <= 100 {
+		diskMonitor.threshold = cfg.Monitoring.DiskAlertThreshold
+	}
+	diskMonitor.enforce = cfg.Monitoring.EnforceDiskQuota
+	interval := diskMonitor.interval
+	diskMonitor.mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			checkAllDiskUsage()
+			<-ticker.C
+		}
+	}()
+}
+
+// checkAllDiskUsage recomputes the size of every server directory
+func checkAllDiskUsage() {
+	var servers []models.Server
+	if err := database.DB.Find(&servers).Error; err != nil {
+		log.Printf("Failed to load servers for disk check: %v", err)
+		return
+	}
+
+	for i := range servers {
+		if _, err := refreshDiskUsage(&servers[i]); err != nil {
+			log.Printf("Failed to compute disk usage of server %s: %v", servers[i].Name, err)
+		}
+	}
+}
+
+// ServerDiskUsage returns the size of the server directory in bytes, walking
+// it only when the cached size is older than the check interval
+func ServerDiskUsage(server *models.Server) (int64, error) {
+	diskMonitor.mutex.Lock()
+	entry, exists := diskMonitor.usage[server.ID]
+	fresh := exists && time.Since(entry.checkedAt) < diskMonitor.interval
+	var bytes int64
+	if fresh {
+		bytes = entry.bytes
+	}
+	diskMonitor.mutex.Unlock()
+
+	if fresh {
+		return bytes, nil
+	}
+	return refreshDiskUsage(server)
+}
+
+// refreshDiskUsage walks the server directory, caches the result and raises
+// an alert when the server crosses the threshold
+func refreshDiskUsage(server *models.Server) (int64, error) {
+	bytes, err := directorySize(server.Path)
+	if err != nil {
+		return 0, err
+	}
+
+	diskMonitor.mutex.Lock()
+	entry, exists := diskMonitor.usage[server.ID]
+	if !exists {
+		entry = &diskUsageEntry{}
+		diskMonitor.usage[server.ID] = entry
+	}
+	entry.bytes = bytes
+	entry.checkedAt = time.Now()
+	alert := updateDiskAlert(entry, server.DiskLimit, diskMonitor.threshold)
+	diskMonitor.mutex.Unlock()
+
+	if alert {
+		NotifyDiskQuota(server, bytes, diskMonitor.threshold)
+	}
+
+	return bytes, nil
+}
+
+// updateDiskAlert reports whether the entry just crossed the threshold. An
+// alert fires once per crossing; dropping back below re-arms it.
+func updateDiskAlert(entry *diskUsageEntry, limitMB int64, threshold int) bool {
+	if limitMB <= 0 {
+		entry.alerted = false
+		return false
+	}
+
+	over := entry.bytes*100 >= limitMB*1024*1024*int64(threshold)
+	if !over {
+		entry.alerted = false
+		return false
+	}
+	if entry.alerted {
+		return false
+	}
+
+	entry.alerted = true
+	return true
+}
+
+// CheckDiskQuota returns ErrDiskQuotaExceeded when writing additional bytes
+// would take the server past its DiskLimit. It always passes when quota
+// enforcement is off or the server has no limit.
+func CheckDiskQuota(server *models.Server, additional int64) error {
+	diskMonitor.mutex.Lock()
+	enforce := diskMonitor.enforce
+	diskMonitor.mutex.Unlock()
+
+	if !enforce || server.DiskLimit <= 0 {
+		return nil
+	}
+
+	used, err := ServerDiskUsage(server)
+	if err != nil {
+		// Don't block writes because the size could not be computed
+		return nil
+	}
+
+	limit := server.DiskLimit * 1024 * 1024
+	if used+additional > limit {
+		return fmt.Errorf("%w: %d of %d MB used", ErrDiskQuotaExceeded, used/1024/1024, server.DiskLimit)
+	}
+	return nil
+}
+
+// RecordDiskWrite adjusts the cached size after the panel changes a server's
+// files, so quota checks don't have to wait for the next walk
+func RecordDiskWrite(server *models.Server, delta int64) {
+	diskMonitor.mutex.Lock()
+	entry, exists := diskMonitor.usage[server.ID]
+	if !exists {
+		diskMonitor.mutex.Unlock()
+		return
+	}
+
+	entry.bytes += delta
+	if entry.bytes < 0 {
+		entry.bytes = 0
+	}
+	bytes := entry.bytes
+	alert := updateDiskAlert(entry, server.DiskLimit, diskMonitor.threshold)
+	diskMonitor.mutex.Unlock()
+
+	if alert {
+		NotifyDiskQuota(server, bytes, diskMonitor.threshold)
+	}
+}
+
+// directorySize sums the size of regular files below root without following symlinks
+func directorySize(root string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Files can vanish while a running server writes, and a new
+			// server may not have a directory yet
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
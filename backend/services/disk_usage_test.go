@@ -0,0 +1,157 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+// useDiskMonitor replaces the disk monitor with an empty one until the test ends
+func useDiskMonitor(t *testing.T, threshold int, enforce bool) {
+	previous := diskMonitor
+	diskMonitor = &DiskMonitor{
+		interval:  time.Hour,
+		threshold: threshold,
+		enforce:   enforce,
+		usage:     make(map[uuid.UUID]*diskUsageEntry),
+	}
+	t.Cleanup(func() { diskMonitor = previous })
+}
+
+func writeSizedFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.WriteFile(path, bytes.Repeat([]byte("x"), size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// diskNotifications returns the disk alerts a user got for a server
+func diskNotifications(userID, serverID uuid.UUID) []models.Notification {
+	var notifications []models.Notification
+	database.DB.Where("user_id = ? AND server_id = ? AND title = ?", userID, serverID, "Disk almost full").Find(&notifications)
+	return notifications
+}
+
+func TestUpdateDiskAlert(t *testing.T) {
+	const limitMB = 10
+	entry := &diskUsageEntry{}
+
+	steps := []struct {
+		bytes int64
+		alert bool
+	}{
+		{5 << 20, false},
+		{9 << 20, true}, // crosses 90%
+		{9<<20 + 512<<10, false},
+		{4 << 20, false}, // drops back, re-arming the alert
+		{10 << 20, true},
+	}
+	for i, step := range steps {
+		entry.bytes = step.bytes
+		if alert := updateDiskAlert(entry, limitMB, 90); alert != step.alert {
+			t.Errorf("step %d (%d bytes): alert = %v, want %v", i, step.bytes, alert, step.alert)
+		}
+	}
+
+	if updateDiskAlert(&diskUsageEntry{bytes: 1 << 40}, 0, 90) {
+		t.Error("a server without a disk limit raised an alert")
+	}
+}
+
+func TestDiskThresholdCrossingNotifies(t *testing.T) {
+	testDB(t)
+	useDiskMonitor(t, 90, false)
+
+	user := testutil.CreateUser(t, &models.User{})
+	server := testutil.CreateServer(t, &models.Server{DiskLimit: 1})
+	testutil.GrantServerAccess(t, user, server, models.ServerRoleOwner)
+	t.Cleanup(func() { database.DB.Where("server_id = ?", server.ID).Delete(&models.Notification{}) })
+
+	writeSizedFile(t, filepath.Join(server.Path, "world.dat"), 512<<10)
+	if _, err := refreshDiskUsage(server); err != nil {
+		t.Fatalf("refreshDiskUsage: %v", err)
+	}
+	if got := diskNotifications(user.ID, server.ID); len(got) != 0 {
+		t.Fatalf("%d alerts at 50%% usage, want none", len(got))
+	}
+
+	writeSizedFile(t, filepath.Join(server.Path, "region.mca"), 450<<10)
+	used, err := refreshDiskUsage(server)
+	if err != nil {
+		t.Fatalf("refreshDiskUsage: %v", err)
+	}
+	if used != 962<<10 {
+		t.Errorf("usage = %d bytes, want %d", used, 962<<10)
+	}
+
+	alerts := diskNotifications(user.ID, server.ID)
+	if len(alerts) != 1 {
+		t.Fatalf("%d alerts after crossing 90%%, want 1", len(alerts))
+	}
+	if alerts[0].Priority != models.NotificationPriorityHigh || alerts[0].Type != models.NotificationTypeWarning {
+		t.Errorf("alert = %+v, want a high priority warning", alerts[0])
+	}
+
+	// Staying over the threshold doesn't repeat the alert
+	refreshDiskUsage(server)
+	RecordDiskWrite(server, 1024)
+	if got := diskNotifications(user.ID, server.ID); len(got) != 1 {
+		t.Errorf("%d alerts while staying over the threshold, want still 1", len(got))
+	}
+}
+
+func TestFileWriteOverQuotaRejected(t *testing.T) {
+	testDB(t)
+	useDiskMonitor(t, 90, true)
+	addr := startTestSFTP(t)
+
+	user := createSFTPUser(t)
+	server := testutil.CreateServer(t, &models.Server{DiskLimit: 1})
+	testutil.GrantServerAccess(t, user, server, models.ServerRoleOwner)
+	t.Cleanup(func() { database.DB.Where("server_id = ?", server.ID).Delete(&models.Notification{}) })
+	writeSizedFile(t, filepath.Join(server.Path, "world.dat"), 768<<10)
+
+	if err := CheckDiskQuota(server, 128<<10); err != nil {
+		t.Errorf("CheckDiskQuota within the limit: %v", err)
+	}
+	if err := CheckDiskQuota(server, 512<<10); !errors.Is(err, ErrDiskQuotaExceeded) {
+		t.Errorf("CheckDiskQuota past the limit = %v, want ErrDiskQuotaExceeded", err)
+	}
+
+	client, err := dialSFTP(t, addr, user.Username, ssh.Password(sftpTestPassword))
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	upload := "/" + server.ID.String() + "/upload.bin"
+	file, err := client.Create(upload)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	_, writeErr := file.Write(bytes.Repeat([]byte("x"), 512<<10))
+	closeErr := file.Close()
+	if writeErr == nil && closeErr == nil {
+		t.Error("upload past the disk quota succeeded")
+	}
+	if info, err := os.Stat(filepath.Join(server.Path, "upload.bin")); err == nil && info.Size() > 256<<10 {
+		t.Errorf("%d bytes written past the quota", info.Size())
+	}
+
+	// Without enforcement the same check passes
+	diskMonitor.mutex.Lock()
+	diskMonitor.enforce = false
+	diskMonitor.mutex.Unlock()
+	if err := CheckDiskQuota(server, 512<<10); err != nil {
+		t.Errorf("CheckDiskQuota with enforcement off: %v", err)
+	}
+}
@@ -0,0 +1,338 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/models"
+)
+
+// ErrContainerRuntimeUnavailable is returned when servers run in containers
+// but docker can't be reached
+var ErrContainerRuntimeUnavailable = errors.New("container runtime unavailable")
+
+const (
+	ExecutionProcess = "process"
+	ExecutionDocker  = "docker"
+
+	// containerServerPath is where a server's directory is mounted
+	containerServerPath = "/server"
+	// defaultServerImage runs server types without an image of their own
+	defaultServerImage = "playpulse/generic:latest"
+)
+
+// defaultServerImages are the images node agents use, per server type
+var defaultServerImages = map[models.ServerType]string{
+	models.ServerTypePaper:   "playpulse/minecraft-paper:latest",
+	models.ServerTypePurpur:  "playpulse/minecraft-purpur:latest",
+	models.ServerTypeFabric:  "playpulse/minecraft-fabric:latest",
+	models.ServerTypeForge:   "playpulse/minecraft-forge:latest",
+	models.ServerTypeBedrock: "playpulse/minecraft-bedrock:latest",
+}
+
+// dockerCommand builds a docker CLI invocation; a variable so it can be
+// pointed at a fake docker
+var dockerCommand = func(args ...string) *exec.Cmd {
+	return exec.Command("docker", args...)
+}
+
+// serverRuntime holds how servers are run, determined at startup
+var serverRuntime = struct {
+	execution string
+	images    map[string]string
+	available bool
+	reason    string
+}{execution: ExecutionProcess}
+
+// InitializeServerRuntime selects how locally hosted servers are run. With
+// docker, each server runs in its own container with the image for its
+// type, its CPU and memory limits and its directory mounted; when docker
+// can't be reached, starting servers fails rather than running them
+// unisolated.
+func InitializeServerRuntime(cfg *config.Config) {
+	execution := cfg.GameServers.Execution
+	switch execution {
+	case ExecutionProcess, ExecutionDocker:
+	default:
+		log.Printf("Unknown SERVER_EXECUTION %q, using %q", execution, ExecutionProcess)
+		execution = ExecutionProcess
+	}
+
+	serverRuntime.execution = execution
+	serverRuntime.images = cfg.GameServers.DockerImages
+	if execution != ExecutionDocker {
+		return
+	}
+
+	output, err := dockerOutput("version", "--format", "{{.Server.Version}}")
+	if err != nil {
+		serverRuntime.reason = err.Error()
+		log.Printf("Servers are set to run in docker but docker is unavailable, servers will not start: %v", err)
+		return
+	}
+
+	serverRuntime.available = true
+	log.Printf("Running servers in docker %s containers", strings.TrimSpace(string(output)))
+}
+
+// runsInContainers reports whether servers are run in docker containers
+func runsInContainers() bool {
+	return serverRuntime.execution == ExecutionDocker
+}
+
+// containerName is the name of a server's container
+func containerName(server *models.Server) string {
+	return "playpulse-" + server.ID.String()
+}
+
+// serverImage returns the image a server's container runs
+func serverImage(server *models.Server) string {
+	if image := serverRuntime.images[string(server.Type)]; image != "" {
+		return image
+	}
+	if image, exists := defaultServerImages[server.Type]; exists {
+		return image
+	}
+	return defaultServerImage
+}
+
+// containerCommand builds a docker run of command in the server's
+// container. The run stays attached, so the panel reads the console from its
+// output, sends commands to its stdin and sees the container exit as the
+// command exiting, just like a process on the host.
+func containerCommand(server *models.Server, command []string, env ...string) *exec.Cmd {
+	return dockerCommand(containerRunArgs(server, command, env)...)
+}
+
+// containerRunArgs are the docker run arguments for a server's container
+func containerRunArgs(server *models.Server, command []string, env []string) []string {
+	args := []string{"run", "-i", "--rm",
+		"--name", containerName(server),
+		"-v", fmt.Sprintf("%s:%s", server.Path, containerServerPath),
+		"-w", containerServerPath,
+	}
+
+	for _, port := range publishedPorts(server) {
+		args = append(args, "-p", port)
+	}
+
+	// The same ceiling the cgroup gets for a server run on the host
+	if server.MemoryLimit > 0 {
+		args = append(args, "--memory", cgroupMemoryMax(server.MemoryLimit))
+	}
+	if server.CPULimit > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(cpuLimitCores(server.CPULimit), 'f', 2, 64))
+	}
+
+	// Files the server writes stay owned by the panel's user
+	if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 && gid >= 0 {
+		args = append(args, "--user", fmt.Sprintf("%d:%d", uid, gid))
+	}
+	for _, variable := range env {
+		args = append(args, "-e", variable)
+	}
+
+	args = append(args, serverImage(server))
+	return append(args, command...)
+}
+
+// publishedPorts returns the ports a server's container publishes: the game
+// port, Bedrock's IPv6 port, and RCON and query when server.properties turns
+// them on
+func publishedPorts(server *models.Server) []string {
+	publish := func(port int, protocol string) string {
+		return fmt.Sprintf("%d:%d/%s", port, port, protocol)
+	}
+
+	// Bedrock listens on UDP, Java servers and proxies on TCP
+	if server.Type == models.ServerTypeBedrock {
+		ports := []string{publish(server.Port, "udp")}
+		portV6 := server.Port + 1
+		if properties, err := ReadServerProperties(server); err == nil {
+			if port, ok := properties["server-portv6"].(int); ok {
+				portV6 = port
+			}
+		}
+		if portV6 > 0 && portV6 != server.Port {
+			ports = append(ports, publish(portV6, "udp"))
+		}
+		return ports
+	}
+
+	ports := []string{publish(server.Port, "tcp")}
+	if server.Type == models.ServerTypeProxy {
+		return ports
+	}
+
+	properties, err := ReadServerProperties(server)
+	if err != nil {
+		return ports
+	}
+	if properties["enable-rcon"] == true {
+		port, ok := properties["rcon.port"].(int)
+		if !ok {
+			port = 25575
+		}
+		ports = append(ports, publish(port, "tcp"))
+	}
+	if properties["enable-query"] == true {
+		port, ok := properties["query.port"].(int)
+		if !ok {
+			port = server.Port
+		}
+		ports = append(ports, publish(port, "udp"))
+	}
+	return ports
+}
+
+// prepareContainer checks that docker is available and removes a container
+// left behind by an earlier run, which would keep the name taken
+func prepareContainer(server *models.Server) error {
+	if !serverRuntime.available {
+		return fmt.Errorf("%w: %s", ErrContainerRuntimeUnavailable, serverRuntime.reason)
+	}
+
+	if _, err := dockerOutput("rm", "--force", containerName(server)); err != nil && !strings.Contains(err.Error(), "No such container") {
+		return fmt.Errorf("failed to remove old container: %v", err)
+	}
+	return nil
+}
+
+// killContainer kills a server's container
+func killContainer(server *models.Server) error {
+	_, err := dockerOutput("kill", containerName(server))
+	return err
+}
+
+// containerStats is one line of docker stats --format '{{json .}}'
+type containerStats struct {
+	Name     string `json:"Name"`
+	CPUPerc  string `json:"CPUPerc"`
+	MemUsage string `json:"MemUsage"`
+}
+
+// How long a docker stats sample of all containers is reused. Sampling
+// takes about two seconds however many containers there are.
+const containerStatsTTL = 5 * time.Second
+
+// containerStatsCache holds the latest docker stats sample of every running
+// container. One docker stats call covers all servers, and it runs in the
+// background so readers never wait for it.
+var containerStatsCache = struct {
+	mutex      sync.Mutex
+	stats      map[string]containerStats
+	sampledAt  time.Time
+	refreshing bool
+}{}
+
+// getContainerStats returns the CPU percentage and memory use in bytes of
+// a server's container from the latest sample, starting a new sample when
+// it is out of date
+func getContainerStats(server *models.Server) (float64, int64, error) {
+	cache := &containerStatsCache
+	cache.mutex.Lock()
+	if time.Since(cache.sampledAt) > containerStatsTTL && !cache.refreshing {
+		cache.refreshing = true
+		go refreshContainerStats()
+	}
+	stats, exists := cache.stats[containerName(server)]
+	cache.mutex.Unlock()
+
+	if !exists {
+		return 0, 0, fmt.Errorf("no stats sampled yet for %s", containerName(server))
+	}
+
+	cpuUsage, _ := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(stats.CPUPerc), "%"), 64)
+	used, _, _ := strings.Cut(stats.MemUsage, "/")
+	return cpuUsage, parseDockerSize(used), nil
+}
+
+// refreshContainerStats samples every running container with one docker
+// stats call
+func refreshContainerStats() {
+	sample := make(map[string]containerStats)
+	output, err := dockerOutput("stats", "--no-stream", "--format", "{{json .}}")
+	if err != nil {
+		log.Printf("Failed to sample container stats: %v", err)
+	} else {
+		for _, line := range bytes.Split(bytes.TrimSpace(output), []byte("\n")) {
+			var stats containerStats
+			if err := json.Unmarshal(line, &stats); err == nil && stats.Name != "" {
+				sample[stats.Name] = stats
+			}
+		}
+	}
+
+	cache := &containerStatsCache
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.refreshing = false
+	cache.sampledAt = time.Now()
+	if err == nil {
+		cache.stats = sample
+	}
+}
+
+// imageJavaMajorVersion returns the major version of the Java a server
+// image runs servers with, cached per image like JavaMajorVersion
+func imageJavaMajorVersion(image string) (int, error) {
+	return cachedJavaVersion("docker:"+image, func() (int, error) {
+		// java -version writes to stderr
+		output, err := dockerCommand("run", "--rm", "--entrypoint", "java", image, "-version").CombinedOutput()
+		if err != nil {
+			return 0, fmt.Errorf("failed to run java in %s: %v", image, err)
+		}
+		return parseJavaVersion(string(output))
+	})
+}
+
+// dockerOutput runs docker and returns its stdout, with stderr in the error
+func dockerOutput(args ...string) ([]byte, error) {
+	cmd := dockerCommand(args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("docker %s: %s", args[0], message)
+		}
+		return nil, fmt.Errorf("docker %s: %v", args[0], err)
+	}
+	return output, nil
+}
+
+// parseDockerSize parses sizes as docker stats prints them, such as
+// "512MiB", "1.5GiB" or "3.2kB", into bytes
+func parseDockerSize(size string) int64 {
+	size = strings.TrimSpace(size)
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"kB", 1e3}, {"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"B", 1},
+	}
+
+	for _, unit := range units {
+		if strings.HasSuffix(size, unit.suffix) {
+			value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(size, unit.suffix)), 64)
+			if err != nil {
+				return 0
+			}
+			return int64(value * unit.multiplier)
+		}
+	}
+	return 0
+}
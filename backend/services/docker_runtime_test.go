@@ -0,0 +1,187 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+)
+
+// useFakeDocker points docker at a script that logs each invocation to the
+// returned file and selects docker execution with images. A container run
+// becomes the fake server in the mounted directory. While unavailable, the
+// daemon can't be reached.
+func useFakeDocker(t *testing.T, available bool, images map[string]string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake docker is a shell script")
+	}
+
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls.txt")
+	version := "echo 24.0.7"
+	if !available {
+		version = "echo 'Cannot connect to the Docker daemon' >&2; exit 1"
+	}
+	script := fmt.Sprintf(`#!/bin/sh
+echo "$*" >> %q
+case "$1" in
+version) %s ;;
+run)
+	while [ $# -gt 0 ]; do
+		[ "$1" = "-v" ] && cd "${2%%%%:*}"
+		shift
+	done
+	%s ;;
+esac
+`, calls, version, fakeServerScript)
+	docker := filepath.Join(dir, "docker")
+	if err := os.WriteFile(docker, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	previousCommand, previousRuntime := dockerCommand, serverRuntime
+	dockerCommand = func(args ...string) *exec.Cmd { return exec.Command(docker, args...) }
+	t.Cleanup(func() { dockerCommand, serverRuntime = previousCommand, previousRuntime })
+
+	InitializeServerRuntime(&config.Config{GameServers: config.GameServerConfig{Execution: ExecutionDocker, DockerImages: images}})
+	return calls
+}
+
+// dockerCalls returns the logged docker invocations
+func dockerCalls(path string) []string {
+	data, _ := os.ReadFile(path)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+// flagValues returns the values given for a flag in docker arguments
+func flagValues(args []string, flag string) []string {
+	var values []string
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == flag {
+			values = append(values, args[i+1])
+		}
+	}
+	return values
+}
+
+func TestContainerRunArgsUseServerLimits(t *testing.T) {
+	useFakeDocker(t, true, map[string]string{"fabric": "example/fabric:1.20"})
+
+	server := &models.Server{Type: models.ServerTypePaper, Path: t.TempDir(), Port: 25570, MemoryLimit: 2048, CPULimit: 50}
+	writeLog(t, filepath.Join(server.Path, "server.properties"), "enable-rcon=true\nrcon.port=25580\nenable-query=false\n")
+
+	args := containerRunArgs(server, []string{"java", "-jar", "server.jar", "nogui"}, []string{"EULA=true"})
+	wantCPUs := fmt.Sprintf("%.2f", 0.5*float64(runtime.NumCPU()))
+	checks := []struct {
+		flag string
+		want string
+	}{
+		{"--name", containerName(server)},
+		// 2048MB and a quarter again for the JVM's own memory
+		{"--memory", "2684354560"},
+		{"--cpus", wantCPUs},
+		{"-v", server.Path + ":/server"},
+		{"-w", "/server"},
+		{"-p", "25570:25570/tcp,25580:25580/tcp"},
+		{"-e", "EULA=true"},
+	}
+	for _, check := range checks {
+		if got := strings.Join(flagValues(args, check.flag), ","); got != check.want {
+			t.Errorf("%s = %q, want %q", check.flag, got, check.want)
+		}
+	}
+	if got := strings.Join(args[len(args)-5:], " "); got != "playpulse/minecraft-paper:latest java -jar server.jar nogui" {
+		t.Errorf("run ends with %q, want the paper image and the java command", got)
+	}
+
+	// Without limits the container is left unlimited, and a configured image
+	// replaces the default
+	server = &models.Server{Type: models.ServerTypeFabric, Path: t.TempDir(), Port: 25571}
+	args = containerRunArgs(server, []string{"java"}, nil)
+	if limits := append(flagValues(args, "--memory"), flagValues(args, "--cpus")...); len(limits) != 0 {
+		t.Errorf("unlimited server got limits %v", limits)
+	}
+	if got := args[len(args)-2]; got != "example/fabric:1.20" {
+		t.Errorf("image = %q, want the configured one", got)
+	}
+}
+
+func TestContainerRunArgsPublishBedrockPorts(t *testing.T) {
+	server := &models.Server{Type: models.ServerTypeBedrock, Path: t.TempDir(), Port: 19132}
+	if got := strings.Join(publishedPorts(server), ","); got != "19132:19132/udp,19133:19133/udp" {
+		t.Errorf("ports = %s, want the game and IPv6 ports over UDP", got)
+	}
+
+	writeLog(t, filepath.Join(server.Path, "server.properties"), "server-portv6=19200\n")
+	if got := strings.Join(publishedPorts(server), ","); got != "19132:19132/udp,19200:19200/udp" {
+		t.Errorf("ports = %s, want the configured IPv6 port", got)
+	}
+}
+
+func TestLaunchServerInContainer(t *testing.T) {
+	testDB(t)
+	calls := useFakeDocker(t, true, nil)
+
+	server := testutil.CreateServer(t, &models.Server{MemoryLimit: 1024, CPULimit: 25})
+	server.Status = models.ServerStatusStarting
+	if err := launchServerProcess(server, containerCommand(server, []string{"java", "-jar", "server.jar", "nogui"})); err != nil {
+		t.Fatalf("launchServerProcess: %v", err)
+	}
+	pid := server.PID
+	t.Cleanup(func() {
+		if utils.IsProcessRunning(pid) {
+			utils.KillProcess(pid)
+			waitForProcessExit(pid, 5*time.Second)
+		}
+	})
+
+	// A container left from an earlier run is removed before the new one
+	// starts with the server's limits
+	got := dockerCalls(calls)
+	if len(got) != 3 || got[1] != "rm --force "+containerName(server) || !strings.HasPrefix(got[2], "run -i --rm --name "+containerName(server)) {
+		t.Fatalf("docker calls = %q, want version, rm and run", got)
+	}
+	wantCPUs := fmt.Sprintf("%.2f", 0.25*float64(runtime.NumCPU()))
+	if !strings.Contains(got[2], " --memory 1342177280 --cpus "+wantCPUs+" ") {
+		t.Errorf("run = %q, want --memory 1342177280 and --cpus %s", got[2], wantCPUs)
+	}
+
+	// Commands reach the server through the attached run's stdin
+	if _, err := stopCopy(t, server); err != nil {
+		t.Fatalf("StopServer: %v", err)
+	}
+	if got := serverCommands(server); strings.Join(got, ",") != "save-all,stop" {
+		t.Errorf("commands = %v, want save-all then stop", got)
+	}
+}
+
+func TestLaunchServerWithoutDocker(t *testing.T) {
+	testDB(t)
+	calls := useFakeDocker(t, false, nil)
+
+	server := testutil.CreateServer(t, &models.Server{})
+	server.Status = models.ServerStatusStarting
+	err := launchServerProcess(server, containerCommand(server, []string{"java"}))
+	if !errors.Is(err, ErrContainerRuntimeUnavailable) || !strings.Contains(err.Error(), "Cannot connect") {
+		t.Fatalf("launchServerProcess = %v, want ErrContainerRuntimeUnavailable with docker's reason", err)
+	}
+
+	// The server isn't run on the host instead
+	if got := dockerCalls(calls); len(got) != 1 || got[0] != "version --format {{.Server.Version}}" {
+		t.Errorf("docker calls = %q, want only the version check", got)
+	}
+	if status := serverStatus(server.ID); status != models.ServerStatusStopped || server.PID != 0 {
+		t.Errorf("status = %s with PID %d, want stopped", status, server.PID)
+	}
+}
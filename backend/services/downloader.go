@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrDownloadVerification is returned when a download doesn't have the
+// expected size or checksum
+var ErrDownloadVerification = errors.New("download verification failed")
+
+const (
+	// downloadTimeout bounds a whole download, retries included
+	downloadTimeout = 15 * time.Minute
+	// maxDownloadAttempts is how often a download is tried before giving up
+	maxDownloadAttempts = 4
+	// downloadRetryDelay is the wait before the first retry, doubled for
+	// each one after it
+	downloadRetryDelay = time.Second
+)
+
+// downloadClient gives up on servers that don't start answering, without
+// limiting how long a large body may take
+var downloadClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: 30 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+	},
+}
+
+// DownloadOptions are what is known about a file before downloading it.
+// Zero values skip the check.
+type DownloadOptions struct {
+	Size   int64  // bytes
+	SHA256 string // hex encoded
+}
+
+// downloadFile downloads url to path, retrying and resuming on failure
+func downloadFile(url, path string) error {
+	return downloadFileVerified(context.Background(), url, path, DownloadOptions{})
+}
+
+// downloadFileVerified downloads url to path. The file is written to a
+// .part file next to path, which interrupted attempts resume with a range
+// request, and is renamed into place only once it is complete and matches
+// opts, so path never holds a partial download.
+func downloadFileVerified(ctx context.Context, url, path string, opts DownloadOptions) error {
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+
+	partPath := path + ".part"
+	// A part file from an earlier download may be of another file
+	os.Remove(partPath)
+
+	delay := downloadRetryDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		retry, err = downloadAttempt(ctx, url, partPath)
+		if err == nil || !retry || attempt == maxDownloadAttempts {
+			break
+		}
+
+		log.Printf("Download of %s failed (attempt %d of %d), retrying in %s: %v", url, attempt, maxDownloadAttempts, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		delay *= 2
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return err
+	}
+
+	if err := verifyDownload(partPath, opts); err != nil {
+		os.Remove(partPath)
+		return err
+	}
+
+	if err := os.Rename(partPath, path); err != nil {
+		os.Remove(partPath)
+		return err
+	}
+	return nil
+}
+
+// downloadAttempt downloads what is missing of the part file. It reports
+// whether a failure is worth retrying: network errors and server errors
+// are, client errors such as a 404 are not.
+func downloadAttempt(ctx context.Context, url, partPath string) (bool, error) {
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := downloadClient.Do(request)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0 &&
+		strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)):
+		// Resuming where the last attempt stopped
+	case resp.StatusCode == http.StatusOK:
+		// A server without range support sends the whole file again
+		if err := file.Truncate(0); err != nil {
+			return false, err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		offset = 0
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable || resp.StatusCode == http.StatusPartialContent:
+		// The part file doesn't fit the file on the server; start over
+		if err := file.Truncate(0); err != nil {
+			return false, err
+		}
+		return true, fmt.Errorf("download failed: %s", resp.Status)
+	default:
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("download failed: %s", resp.Status)
+	}
+
+	written, err := io.Copy(file, resp.Body)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	if resp.ContentLength >= 0 && written != resp.ContentLength {
+		return true, fmt.Errorf("download ended after %d of %d bytes", offset+written, offset+resp.ContentLength)
+	}
+
+	if err := file.Sync(); err != nil {
+		return false, err
+	}
+	return false, file.Close()
+}
+
+// verifyDownload checks a downloaded file against the expected size and
+// checksum
+func verifyDownload(path string, opts DownloadOptions) error {
+	if opts.Size <= 0 && opts.SHA256 == "" {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+
+	if opts.Size > 0 && size != opts.Size {
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrDownloadVerification, opts.Size, size)
+	}
+	if opts.SHA256 != "" {
+		if sum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(sum, opts.SHA256) {
+			return fmt.Errorf("%w: expected SHA-256 %s, got %s", ErrDownloadVerification, opts.SHA256, sum)
+		}
+	}
+	return nil
+}
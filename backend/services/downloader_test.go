@@ -0,0 +1,162 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyDownload serves data, cutting the connection off halfway through the
+// first response. Without range support every response is the whole file.
+type flakyDownload struct {
+	data          []byte
+	supportsRange bool
+
+	mutex  sync.Mutex
+	ranges []string // Range header of each request
+}
+
+func (d *flakyDownload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mutex.Lock()
+	d.ranges = append(d.ranges, r.Header.Get("Range"))
+	first := len(d.ranges) == 1
+	d.mutex.Unlock()
+
+	if first {
+		w.Header().Set("Content-Length", strconv.Itoa(len(d.data)))
+		w.Write(d.data[:len(d.data)/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	if !d.supportsRange {
+		r.Header.Del("Range")
+	}
+	http.ServeContent(w, r, "server.jar", time.Time{}, bytes.NewReader(d.data))
+}
+
+// requestRanges returns the Range header of each request served
+func (d *flakyDownload) requestRanges() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]string(nil), d.ranges...)
+}
+
+// downloadData is a jar's worth of random bytes and its SHA-256
+func downloadData() ([]byte, string) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	sum := sha256.Sum256(data)
+	return data, hex.EncodeToString(sum[:])
+}
+
+func TestDownloadResumesAfterMidStreamFailure(t *testing.T) {
+	data, sum := downloadData()
+	download := &flakyDownload{data: data, supportsRange: true}
+	api := httptest.NewServer(download)
+	defer api.Close()
+
+	path := filepath.Join(t.TempDir(), "server.jar")
+	if err := downloadFileVerified(context.Background(), api.URL, path, DownloadOptions{Size: int64(len(data)), SHA256: sum}); err != nil {
+		t.Fatalf("downloadFileVerified: %v", err)
+	}
+
+	// The retry asks only for what the first attempt didn't get
+	ranges := download.requestRanges()
+	if len(ranges) != 2 || ranges[0] != "" || ranges[1] != "bytes="+strconv.Itoa(len(data)/2)+"-" {
+		t.Errorf("requests ranged %q, want the whole file then the second half", ranges)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, data) {
+		t.Errorf("downloaded %d bytes that differ from the %d served", len(got), len(data))
+	}
+	if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+		t.Error("part file left after a completed download")
+	}
+}
+
+func TestDownloadRestartsWithoutRangeSupport(t *testing.T) {
+	data, sum := downloadData()
+	download := &flakyDownload{data: data}
+	api := httptest.NewServer(download)
+	defer api.Close()
+
+	path := filepath.Join(t.TempDir(), "server.jar")
+	if err := downloadFileVerified(context.Background(), api.URL, path, DownloadOptions{SHA256: sum}); err != nil {
+		t.Fatalf("downloadFileVerified: %v", err)
+	}
+
+	// The whole file came back, so the partial first half is replaced
+	// rather than appended to
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, data) {
+		t.Errorf("downloaded %d bytes that differ from the %d served", len(got), len(data))
+	}
+	if n := len(download.requestRanges()); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+}
+
+func TestDownloadRejectsChecksumMismatch(t *testing.T) {
+	data, sum := downloadData()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer api.Close()
+
+	path := filepath.Join(t.TempDir(), "server.jar")
+	writeLog(t, path, "the jar from before")
+
+	for _, opts := range []DownloadOptions{
+		{SHA256: strings.Repeat("0", 64)},
+		{Size: int64(len(data)) + 1, SHA256: sum},
+	} {
+		err := downloadFileVerified(context.Background(), api.URL, path, opts)
+		if !errors.Is(err, ErrDownloadVerification) {
+			t.Errorf("download with %+v = %v, want ErrDownloadVerification", opts, err)
+		}
+
+		// The file already there is kept and the rejected one removed
+		if got, _ := os.ReadFile(path); string(got) != "the jar from before" {
+			t.Errorf("file = %d bytes after a rejected download, want it unchanged", len(got))
+		}
+		if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+			t.Error("rejected download left behind")
+		}
+	}
+
+	// The published checksum matches however it is cased
+	if err := downloadFileVerified(context.Background(), api.URL, path, DownloadOptions{SHA256: strings.ToUpper(sum)}); err != nil {
+		t.Errorf("download with the right checksum: %v", err)
+	}
+}
+
+func TestDownloadDoesNotRetryClientErrors(t *testing.T) {
+	var requests int
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer api.Close()
+
+	path := filepath.Join(t.TempDir(), "server.jar")
+	err := downloadFile(api.URL, path)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("downloadFile = %v, want the 404", err)
+	}
+	if requests != 1 {
+		t.Errorf("%d requests, want a missing file not retried", requests)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("failed download created the file")
+	}
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/models"
+)
+
+const emailSendTimeout = 30 * time.Second
+
+// EmailService sends account emails over SMTP, reusing a single connection
+// between messages
+type EmailService struct {
+	config      config.EmailConfig
+	frontendURL string
+	client      *smtp.Client
+	conn        net.Conn
+	mutex       sync.Mutex
+}
+
+var emailService *EmailService
+
+var emailTemplates = template.Must(template.New("emails").Parse(`
+{{define "verification"}}Hello {{.Username}},
+
+Welcome to {{.PanelName}}! Please confirm your email address by opening the link below:
+
+{{.Link}}
+
+If you did not create an account, you can ignore this email.
+{{end}}
+{{define "password_changed"}}Hello {{.Username}},
+
+The password of your {{.PanelName}} account was changed on {{.Time}}.
+
+If you did not make this change, reset your password and contact an administrator immediately.
+{{end}}
+{{define "password_reset"}}Hello {{.Username}},
+
+A password reset was requested for your {{.PanelName}} account. Open the link below to choose a new password:
+
+{{.Link}}
+
+The link expires in {{.Expires}}. If you did not request a reset, you can ignore this email.
+{{end}}
+{{define "account_locked"}}Hello {{.Username}},
+
+Your {{.PanelName}} account has been locked until {{.Time}} after too many failed login attempts.
+
+If this wasn't you, consider changing your password once the lock expires.
+{{end}}
+`))
+
+// InitializeEmailService initializes the email service
+func InitializeEmailService(cfg *config.Config) {
+	emailService = &EmailService{
+		config:      cfg.Notifications.Email,
+		frontendURL: strings.TrimRight(cfg.Server.FrontendURL, "/"),
+	}
+}
+
+// SendEmail sends a plain text email. The connection to the SMTP server is
+// kept open and reused for following messages.
+func SendEmail(ctx context.Context, to, subject, body string) error {
+	if emailService == nil {
+		return fmt.Errorf("email service is not initialized")
+	}
+	return emailService.send(ctx, to, subject, body)
+}
+
+// SendVerificationEmail sends the email address verification link
+func SendVerificationEmail(user *models.User, token string) {
+	link := fmt.Sprintf("%s/verify-email?token=%s", emailFrontendURL(), token)
+	sendAccountEmail(user, "Verify your email address", "verification", map[string]string{
+		"Link": link,
+	})
+}
+
+// SendPasswordChangedEmail informs a user that their password was changed
+func SendPasswordChangedEmail(user *models.User) {
+	sendAccountEmail(user, "Your password was changed", "password_changed", map[string]string{
+		"Time": time.Now().Format("2006-01-02 15:04:05 MST"),
+	})
+}
+
+// SendPasswordResetEmail sends a password reset link
+func SendPasswordResetEmail(user *models.User, token string, expiresIn time.Duration) {
+	link := fmt.Sprintf("%s/reset-password?token=%s", emailFrontendURL(), token)
+	sendAccountEmail(user, "Reset your password", "password_reset", map[string]string{
+		"Link":    link,
+		"Expires": expiresIn.String(),
+	})
+}
+
+// SendAccountLockedEmail informs a user that their account was locked
+func SendAccountLockedEmail(user *models.User, until time.Time) {
+	sendAccountEmail(user, "Your account has been locked", "account_locked", map[string]string{
+		"Time": until.Format("2006-01-02 15:04:05 MST"),
+	})
+}
+
+func emailFrontendURL() string {
+	if emailService == nil {
+		return ""
+	}
+	return emailService.frontendURL
+}
+
+// sendAccountEmail renders a template and sends it in the background if email
+// notifications are enabled
+func sendAccountEmail(user *models.User, subject, templateName string, data map[string]string) {
+	if emailService == nil || !GetBool("enable_email_notifications", false) {
+		return
+	}
+
+	panelName := getPanelName()
+	data["Username"] = user.Username
+	data["PanelName"] = panelName
+
+	var body bytes.Buffer
+	if err := emailTemplates.ExecuteTemplate(&body, templateName, data); err != nil {
+		log.Printf("Failed to render %s email: %v", templateName, err)
+		return
+	}
+
+	to := user.Email
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), emailSendTimeout)
+		defer cancel()
+
+		if err := SendEmail(ctx, to, fmt.Sprintf("[%s] %s", panelName, subject), body.String()); err != nil {
+			log.Printf("Failed to send %s email to %s: %v", templateName, to, err)
+		}
+	}()
+}
+
+func getPanelName() string {
+	if name := GetString("panel_name", ""); name != "" {
+		return name
+	}
+	return "Playpulse Panel"
+}
+
+func (es *EmailService) send(ctx context.Context, to, subject, body string) error {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	message := es.buildMessage(to, subject, body)
+
+	// A reused connection may have been closed by the server, so retry once
+	// on a fresh one
+	err := es.deliver(ctx, to, message)
+	if err != nil && es.client != nil {
+		es.reset()
+		err = es.deliver(ctx, to, message)
+	}
+	if err != nil {
+		es.reset()
+	}
+	return err
+}
+
+func (es *EmailService) deliver(ctx context.Context, to string, message []byte) error {
+	if es.client == nil {
+		if err := es.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Set the deadline before the first command so RSET on a stale
+	// connection can't hang
+	if deadline, ok := ctx.Deadline(); ok {
+		es.conn.SetDeadline(deadline)
+	} else {
+		es.conn.SetDeadline(time.Now().Add(emailSendTimeout))
+	}
+
+	if err := es.client.Reset(); err != nil {
+		return err
+	}
+
+	if err := es.client.Mail(es.fromAddress()); err != nil {
+		return fmt.Errorf("MAIL FROM failed: %v", err)
+	}
+	if err := es.client.Rcpt(to); err != nil {
+		return fmt.Errorf("RCPT TO failed: %v", err)
+	}
+
+	w, err := es.client.Data()
+	if err != nil {
+		return fmt.Errorf("DATA failed: %v", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write message: %v", err)
+	}
+	return w.Close()
+}
+
+// connect dials the SMTP server, upgrades to TLS when STARTTLS is offered and
+// authenticates if credentials are configured
+func (es *EmailService) connect(ctx context.Context) error {
+	host := es.config.SMTPHost
+	addr := net.JoinHostPort(host, es.config.SMTPPort)
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %v", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %v", err)
+	}
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			client.Close()
+			return fmt.Errorf("STARTTLS failed: %v", err)
+		}
+	}
+
+	if es.config.SMTPUser != "" {
+		auth := smtp.PlainAuth("", es.config.SMTPUser, es.config.SMTPPassword, host)
+		if err := client.Auth(auth); err != nil {
+			client.Close()
+			return fmt.Errorf("SMTP authentication failed: %v", err)
+		}
+	}
+
+	es.client = client
+	es.conn = conn
+	return nil
+}
+
+func (es *EmailService) reset() {
+	if es.client != nil {
+		es.client.Close()
+	}
+	es.client = nil
+	es.conn = nil
+}
+
+func (es *EmailService) fromAddress() string {
+	if es.config.SMTPFrom != "" {
+		return es.config.SMTPFrom
+	}
+	return es.config.SMTPUser
+}
+
+func (es *EmailService) buildMessage(to, subject, body string) []byte {
+	var msg bytes.Buffer
+	msg.WriteString(fmt.Sprintf("From: %s\r\n", es.fromAddress()))
+	msg.WriteString(fmt.Sprintf("To: %s\r\n", to))
+	msg.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
+	msg.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return msg.Bytes()
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"playpulse-panel/config"
+)
+
+// fakeSMTPMessage is a message accepted by the fake SMTP server
+type fakeSMTPMessage struct {
+	from string
+	rcpt []string
+	data string
+}
+
+// startFakeSMTP runs a minimal SMTP server that accepts every message
+func startFakeSMTP(t *testing.T) (string, string, func() []fakeSMTPMessage) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var mutex sync.Mutex
+	var messages []fakeSMTPMessage
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				text := textproto.NewConn(conn)
+				text.PrintfLine("220 fake ESMTP")
+
+				var current fakeSMTPMessage
+				for {
+					line, err := text.ReadLine()
+					if err != nil {
+						return
+					}
+					verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+					switch verb {
+					case "EHLO", "HELO":
+						text.PrintfLine("250 fake")
+					case "RSET":
+						current = fakeSMTPMessage{}
+						text.PrintfLine("250 OK")
+					case "MAIL":
+						current.from = strings.TrimSuffix(strings.TrimPrefix(line, "MAIL FROM:<"), ">")
+						text.PrintfLine("250 OK")
+					case "RCPT":
+						current.rcpt = append(current.rcpt, strings.TrimSuffix(strings.TrimPrefix(line, "RCPT TO:<"), ">"))
+						text.PrintfLine("250 OK")
+					case "DATA":
+						text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+						lines, err := text.ReadDotLines()
+						if err != nil {
+							return
+						}
+						current.data = strings.Join(lines, "\n")
+						mutex.Lock()
+						messages = append(messages, current)
+						mutex.Unlock()
+						text.PrintfLine("250 OK")
+					case "QUIT":
+						text.PrintfLine("221 Bye")
+						return
+					default:
+						text.PrintfLine("502 Command not implemented")
+					}
+				}
+			}()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	return host, port, func() []fakeSMTPMessage {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]fakeSMTPMessage(nil), messages...)
+	}
+}
+
+// messageHeaders parses the header block of a delivered message
+func messageHeaders(t *testing.T, data string) textproto.MIMEHeader {
+	t.Helper()
+
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(data + "\n\n")))
+	header, err := reader.ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("failed to parse message headers: %v", err)
+	}
+	return header
+}
+
+func TestSendEmailHeadersAndRecipient(t *testing.T) {
+	host, port, messages := startFakeSMTP(t)
+	es := &EmailService{config: config.EmailConfig{
+		SMTPHost: host,
+		SMTPPort: port,
+		SMTPFrom: "panel@example.com",
+	}}
+	defer es.reset()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := es.send(ctx, "steve@example.com", "[Playpulse Panel] Verify your email address", "Hello steve,\n\nWelcome!"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	got := messages()
+	if len(got) != 1 {
+		t.Fatalf("%d messages delivered, want 1", len(got))
+	}
+	if got[0].from != "panel@example.com" {
+		t.Errorf("MAIL FROM = %q", got[0].from)
+	}
+	if len(got[0].rcpt) != 1 || got[0].rcpt[0] != "steve@example.com" {
+		t.Errorf("RCPT TO = %v, want steve@example.com", got[0].rcpt)
+	}
+
+	header := messageHeaders(t, got[0].data)
+	want := map[string]string{
+		"From":         "panel@example.com",
+		"To":           "steve@example.com",
+		"Subject":      "[Playpulse Panel] Verify your email address",
+		"Content-Type": "text/plain; charset=UTF-8",
+	}
+	for name, value := range want {
+		if header.Get(name) != value {
+			t.Errorf("%s = %q, want %q", name, header.Get(name), value)
+		}
+	}
+	if _, err := time.Parse(time.RFC1123Z, header.Get("Date")); err != nil {
+		t.Errorf("Date header %q is invalid: %v", header.Get("Date"), err)
+	}
+	if !strings.Contains(got[0].data, "Welcome!") {
+		t.Errorf("body missing from message:\n%s", got[0].data)
+	}
+}
+
+func TestSendEmailReusesConnection(t *testing.T) {
+	host, port, messages := startFakeSMTP(t)
+	es := &EmailService{config: config.EmailConfig{SMTPHost: host, SMTPPort: port, SMTPFrom: "panel@example.com"}}
+	defer es.reset()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := es.send(ctx, "a@example.com", "first", "one"); err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+	conn := es.conn
+	if err := es.send(ctx, "b@example.com", "second", "two"); err != nil {
+		t.Fatalf("second send: %v", err)
+	}
+
+	if es.conn != conn {
+		t.Error("the second message opened a new connection")
+	}
+	got := messages()
+	if len(got) != 2 || got[1].rcpt[0] != "b@example.com" {
+		t.Fatalf("delivered %+v, want two messages with the second to b@example.com", got)
+	}
+}
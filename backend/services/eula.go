@@ -0,0 +1,63 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrEULANotAccepted is returned when starting a server whose Minecraft EULA
+// no user has accepted
+var ErrEULANotAccepted = errors.New("the Minecraft EULA has not been accepted for this server")
+
+// serverNeedsEULA reports whether the server type reads eula.txt. Bedrock
+// has no such file and proxies aren't Minecraft servers.
+func serverNeedsEULA(serverType models.ServerType) bool {
+	return serverType != models.ServerTypeBedrock && serverType != models.ServerTypeProxy
+}
+
+// EULAAccepted reports whether the server may start as far as the EULA goes
+func EULAAccepted(server *models.Server) bool {
+	return !serverNeedsEULA(server.Type) || server.EULAAcceptedAt != nil
+}
+
+// AcceptEULA records that the user accepted the Minecraft EULA for the
+// server and writes eula=true
+func AcceptEULA(server *models.Server, userID uuid.UUID) error {
+	now := time.Now()
+	server.EULAAcceptedBy = &userID
+	server.EULAAcceptedAt = &now
+
+	if err := database.DB.Model(server).Updates(map[string]interface{}{
+		"eula_accepted_by": userID,
+		"eula_accepted_at": now,
+	}).Error; err != nil {
+		return err
+	}
+
+	return writeEULA(server)
+}
+
+// writeEULA writes eula.txt to match whether the EULA was accepted, so the
+// server never runs on an acceptance nobody gave
+func writeEULA(server *models.Server) error {
+	if !serverNeedsEULA(server.Type) {
+		return nil
+	}
+
+	eula := "eula=false\n"
+	if server.EULAAcceptedAt != nil {
+		eula = "eula=true\n"
+	}
+	if err := os.WriteFile(filepath.Join(server.Path, "eula.txt"), []byte(eula), 0644); err != nil {
+		return fmt.Errorf("failed to write eula.txt: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+)
+
+func TestWriteEULAFollowsAcceptance(t *testing.T) {
+	accepted := time.Now()
+	tests := []struct {
+		serverType models.ServerType
+		acceptedAt *time.Time
+		want       string
+	}{
+		{models.ServerTypePaper, nil, "eula=false\n"},
+		{models.ServerTypePaper, &accepted, "eula=true\n"},
+		{models.ServerTypeForge, nil, "eula=false\n"},
+		{models.ServerTypeBedrock, nil, ""},
+		{models.ServerTypeProxy, nil, ""},
+	}
+	for _, tt := range tests {
+		server := &models.Server{Type: tt.serverType, Path: t.TempDir(), EULAAcceptedAt: tt.acceptedAt}
+		if err := writeEULA(server); err != nil {
+			t.Fatalf("%s: writeEULA: %v", tt.serverType, err)
+		}
+
+		content, err := os.ReadFile(filepath.Join(server.Path, "eula.txt"))
+		if tt.want == "" {
+			if !os.IsNotExist(err) {
+				t.Errorf("%s: eula.txt written for a server that doesn't read it", tt.serverType)
+			}
+			if !EULAAccepted(server) {
+				t.Errorf("%s: EULAAccepted = false, want no acceptance needed", tt.serverType)
+			}
+			continue
+		}
+		if string(content) != tt.want {
+			t.Errorf("%s accepted=%v: eula.txt = %q, want %q", tt.serverType, tt.acceptedAt != nil, content, tt.want)
+		}
+		if EULAAccepted(server) != (tt.acceptedAt != nil) {
+			t.Errorf("%s accepted=%v: EULAAccepted = %v", tt.serverType, tt.acceptedAt != nil, EULAAccepted(server))
+		}
+	}
+}
+
+func TestStartBlockedUntilEULAAccepted(t *testing.T) {
+	testDB(t)
+	user := testutil.CreateUser(t, &models.User{})
+	java := writeFakeJava(t, fakeServerScript)
+	server := testutil.CreateServer(t, &models.Server{JavaPath: java, ServerJar: "server.jar", StopTimeout: 5})
+	if err := os.WriteFile(filepath.Join(server.Path, "server.jar"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeEULA(server); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if hasProcess(server.ID) {
+			stopCopy(t, server)
+		}
+	})
+
+	if err := StartServer(server); !errors.Is(err, ErrEULANotAccepted) {
+		t.Fatalf("StartServer without the EULA accepted = %v, want ErrEULANotAccepted", err)
+	}
+	if hasProcess(server.ID) {
+		t.Fatal("the server was launched without the EULA accepted")
+	}
+	if content, _ := os.ReadFile(filepath.Join(server.Path, "eula.txt")); string(content) != "eula=false\n" {
+		t.Errorf("eula.txt = %q, want eula=false", content)
+	}
+
+	if err := AcceptEULA(server, user.ID); err != nil {
+		t.Fatalf("AcceptEULA: %v", err)
+	}
+	var stored models.Server
+	database.DB.First(&stored, server.ID)
+	if stored.EULAAcceptedBy == nil || *stored.EULAAcceptedBy != user.ID || stored.EULAAcceptedAt == nil {
+		t.Errorf("stored acceptance = %v by %v, want the user's acceptance recorded", stored.EULAAcceptedAt, stored.EULAAcceptedBy)
+	}
+	if content, _ := os.ReadFile(filepath.Join(server.Path, "eula.txt")); string(content) != "eula=true\n" {
+		t.Errorf("eula.txt after acceptance = %q, want eula=true", content)
+	}
+
+	if err := StartServer(server); err != nil {
+		t.Fatalf("StartServer after accepting the EULA: %v", err)
+	}
+	if !hasProcess(server.ID) {
+		t.Error("the server was not launched after the EULA was accepted")
+	}
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+)
+
+const (
+	forgeMavenURL      = "https://maven.minecraftforge.net/net/minecraftforge/forge"
+	forgePromotionsURL = "https://files.minecraftforge.net/net/minecraftforge/forge/promotions_slim.json"
+
+	// The installer downloads libraries and patches the game, which can be slow
+	forgeInstallTimeout = 15 * time.Minute
+)
+
+// setupForgeServer downloads the Forge installer, runs it headless inside the
+// server directory and records how the installed server has to be launched
+func setupForgeServer(server *models.Server) error {
+	forgeVersion, err := resolveForgeVersion(server.Version)
+	if err != nil {
+		return fmt.Errorf("failed to resolve forge version: %v", err)
+	}
+
+	installerName := fmt.Sprintf("forge-%s-installer.jar", forgeVersion)
+	installerURL := fmt.Sprintf("%s/%s/%s", forgeMavenURL, forgeVersion, installerName)
+	installerPath := filepath.Join(server.Path, installerName)
+
+	if err := downloadFile(installerURL, installerPath); err != nil {
+		return fmt.Errorf("failed to download forge installer: %v", err)
+	}
+	defer os.Remove(installerPath)
+	defer os.Remove(installerPath + ".log")
+
+	if err := runForgeInstaller(server, installerName); err != nil {
+		return err
+	}
+
+	serverJar, startCommand, err := detectForgeLaunch(server.Path, forgeVersion)
+	if err != nil {
+		return err
+	}
+
+	server.ServerJar = serverJar
+	server.StartCommand = startCommand
+	database.DB.Save(server)
+
+	// Create server.properties if it doesn't exist
+	createDefaultServerProperties(server)
+
+	// eula=true only once a user has accepted it
+	writeEULA(server)
+
+	return nil
+}
+
+func runForgeInstaller(server *models.Server, installerName string) error {
+	javaPath := server.JavaPath
+	if javaPath == "" {
+		javaPath = "java"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), forgeInstallTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, javaPath, "-jar", installerName, "--installServer")
+	cmd.Dir = server.Path
+
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("forge installer timed out after %s", forgeInstallTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("forge installer failed: %v: %s", err, lastLines(string(output), 10))
+	}
+
+	return nil
+}
+
+// detectForgeLaunch inspects an installed Forge server and returns either the
+// jar to run (old fat-jar layout) or the launch arguments (args-file layout)
+func detectForgeLaunch(serverPath, forgeVersion string) (string, string, error) {
+	// 1.17+ installs a run.sh that points at an args file in libraries/
+	argsFile := filepath.Join("libraries", "net", "minecraftforge", "forge", forgeVersion, "unix_args.txt")
+	if utils.FileExists(filepath.Join(serverPath, argsFile)) {
+		startCommand := "@" + filepath.ToSlash(argsFile)
+		if utils.FileExists(filepath.Join(serverPath, "user_jvm_args.txt")) {
+			startCommand = "@user_jvm_args.txt " + startCommand
+		}
+		return "", startCommand, nil
+	}
+
+	// Older versions produce a runnable jar in the server root
+	candidates := []string{
+		fmt.Sprintf("forge-%s.jar", forgeVersion),
+		fmt.Sprintf("forge-%s-universal.jar", forgeVersion),
+		fmt.Sprintf("forge-%s-shim.jar", forgeVersion),
+	}
+	for _, candidate := range candidates {
+		if utils.FileExists(filepath.Join(serverPath, candidate)) {
+			return candidate, "", nil
+		}
+	}
+
+	// Fall back to any forge jar that isn't the installer
+	matches, _ := filepath.Glob(filepath.Join(serverPath, "forge-*.jar"))
+	for _, match := range matches {
+		name := filepath.Base(match)
+		if !strings.HasSuffix(name, "-installer.jar") {
+			return name, "", nil
+		}
+	}
+
+	return "", "", fmt.Errorf("forge installer finished but no server jar or args file was found")
+}
+
+// resolveForgeVersion turns a Minecraft version into a full Forge version
+// (e.g. 1.20.1 -> 1.20.1-47.2.0). Full versions are passed through.
+func resolveForgeVersion(version string) (string, error) {
+	if version == "" {
+		return "", fmt.Errorf("forge version is required")
+	}
+	if strings.Contains(version, "-") {
+		return version, nil
+	}
+
+	promotions, err := fetchForgePromotions()
+	if err != nil {
+		return "", err
+	}
+
+	// Prefer the recommended build and fall back to the latest one
+	for _, channel := range []string{"recommended", "latest"} {
+		if build, exists := promotions[version+"-"+channel]; exists {
+			return version + "-" + build, nil
+		}
+	}
+
+	return "", fmt.Errorf("no forge build available for minecraft %s", version)
+}
+
+// fetchForgePromotions returns Forge's promoted builds, keyed by Minecraft
+// version and channel (e.g. "1.20.1-recommended")
+func fetchForgePromotions() (map[string]string, error) {
+	var promotions struct {
+		Promos map[string]string `json:"promos"`
+	}
+	if err := buildResolver.getJSON(forgePromotionsURL, &promotions); err != nil {
+		return nil, err
+	}
+	return promotions.Promos, nil
+}
+
+func lastLines(output string, n int) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"playpulse-panel/models"
+)
+
+// writeFakeJava writes a script standing in for java that runs body in the
+// server directory
+func writeFakeJava(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake installer is a shell script")
+	}
+
+	path := filepath.Join(t.TempDir(), "java")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestForgeInstallerArgsFileLayout(t *testing.T) {
+	const forgeVersion = "1.20.1-47.2.0"
+	java := writeFakeJava(t, `
+[ "$3" = "--installServer" ] || exit 2
+mkdir -p libraries/net/minecraftforge/forge/`+forgeVersion+`
+touch libraries/net/minecraftforge/forge/`+forgeVersion+`/unix_args.txt user_jvm_args.txt run.sh
+`)
+
+	server := &models.Server{Path: t.TempDir(), JavaPath: java}
+	if err := runForgeInstaller(server, "forge-"+forgeVersion+"-installer.jar"); err != nil {
+		t.Fatalf("runForgeInstaller: %v", err)
+	}
+
+	jar, startCommand, err := detectForgeLaunch(server.Path, forgeVersion)
+	if err != nil {
+		t.Fatalf("detectForgeLaunch: %v", err)
+	}
+	if jar != "" {
+		t.Errorf("jar = %q, want none for the args file layout", jar)
+	}
+	want := "@user_jvm_args.txt @libraries/net/minecraftforge/forge/" + forgeVersion + "/unix_args.txt"
+	if startCommand != want {
+		t.Errorf("start command = %q, want %q", startCommand, want)
+	}
+}
+
+func TestForgeInstallerFatJarLayout(t *testing.T) {
+	const forgeVersion = "1.12.2-14.23.5.2860"
+	java := writeFakeJava(t, "touch forge-"+forgeVersion+".jar minecraft_server.1.12.2.jar\n")
+
+	server := &models.Server{Path: t.TempDir(), JavaPath: java}
+	if err := runForgeInstaller(server, "forge-"+forgeVersion+"-installer.jar"); err != nil {
+		t.Fatalf("runForgeInstaller: %v", err)
+	}
+
+	jar, startCommand, err := detectForgeLaunch(server.Path, forgeVersion)
+	if err != nil {
+		t.Fatalf("detectForgeLaunch: %v", err)
+	}
+	if jar != "forge-"+forgeVersion+".jar" || startCommand != "" {
+		t.Errorf("got jar %q and start command %q, want the forge jar", jar, startCommand)
+	}
+}
+
+func TestForgeInstallerFailure(t *testing.T) {
+	java := writeFakeJava(t, "echo 'Failed to download libraries' >&2\nexit 1\n")
+
+	server := &models.Server{Path: t.TempDir(), JavaPath: java}
+	if err := runForgeInstaller(server, "forge-installer.jar"); err == nil {
+		t.Fatal("expected the failing installer to be reported")
+	}
+
+	if _, _, err := detectForgeLaunch(server.Path, "1.20.1-47.2.0"); err == nil {
+		t.Fatal("expected detection to fail without installed artifacts")
+	}
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/database"
+)
+
+// healthCheckTimeout bounds each subsystem check so a hung dependency cannot
+// hang the health endpoint
+const healthCheckTimeout = 3 * time.Second
+
+// HealthCheck probes one subsystem. A failing critical check makes the panel
+// unready; a failing non-critical check only marks it degraded.
+type HealthCheck struct {
+	Name     string
+	Critical bool
+	Check    func(ctx context.Context) (details interface{}, err error)
+}
+
+// SubsystemHealth is the result of one health check
+type SubsystemHealth struct {
+	Status   string      `json:"status"` // "ok" or "down"
+	Critical bool        `json:"critical"`
+	Error    string      `json:"error,omitempty"`
+	Details  interface{} `json:"details,omitempty"`
+}
+
+// HealthReport summarises every subsystem. Status is "ok", "degraded" when a
+// non-critical subsystem is down, or "down" when a critical one is.
+type HealthReport struct {
+	Status     string                     `json:"status"`
+	Degraded   bool                       `json:"degraded"`
+	Subsystems map[string]SubsystemHealth `json:"subsystems"`
+	CheckedAt  time.Time                  `json:"checked_at"`
+}
+
+var (
+	healthChecks      []HealthCheck
+	healthChecksMutex sync.RWMutex
+)
+
+// RegisterHealthCheck adds a subsystem to the readiness report, e.g. a node
+// manager running alongside the panel
+func RegisterHealthCheck(check HealthCheck) {
+	healthChecksMutex.Lock()
+	defer healthChecksMutex.Unlock()
+	healthChecks = append(healthChecks, check)
+}
+
+// InitializeHealthChecks registers the panel's built-in subsystem checks
+func InitializeHealthChecks(cfg *config.Config) {
+	RegisterHealthCheck(HealthCheck{Name: "database", Critical: true, Check: checkDatabase})
+	RegisterHealthCheck(HealthCheck{Name: "backup_storage", Check: func(ctx context.Context) (interface{}, error) {
+		return nil, checkStorageWritable(cfg.Files.BackupPath)
+	}})
+	RegisterHealthCheck(HealthCheck{Name: "websocket", Check: checkWebSockets})
+}
+
+// CheckHealth runs every registered check concurrently
+func CheckHealth(ctx context.Context) HealthReport {
+	healthChecksMutex.RLock()
+	checks := append([]HealthCheck(nil), healthChecks...)
+	healthChecksMutex.RUnlock()
+
+	report := HealthReport{
+		Status:     "ok",
+		Subsystems: make(map[string]SubsystemHealth, len(checks)),
+		CheckedAt:  time.Now().UTC(),
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+			result := runHealthCheck(ctx, check)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Subsystems[check.Name] = result
+		}(check)
+	}
+	wg.Wait()
+
+	for _, result := range report.Subsystems {
+		if result.Status == "ok" {
+			continue
+		}
+		if result.Critical {
+			report.Status = "down"
+		} else if report.Status == "ok" {
+			report.Status = "degraded"
+		}
+	}
+	report.Degraded = report.Status == "degraded"
+
+	return report
+}
+
+func runHealthCheck(ctx context.Context, check HealthCheck) SubsystemHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	type outcome struct {
+		details interface{}
+		err     error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		details, err := check.Check(ctx)
+		done <- outcome{details, err}
+	}()
+
+	result := SubsystemHealth{Status: "ok", Critical: check.Critical}
+	select {
+	case out := <-done:
+		result.Details = out.details
+		if out.err != nil {
+			result.Status = "down"
+			result.Error = out.err.Error()
+		}
+	case <-ctx.Done():
+		result.Status = "down"
+		result.Error = fmt.Sprintf("check timed out after %s", healthCheckTimeout)
+	}
+
+	return result
+}
+
+func checkDatabase(ctx context.Context) (interface{}, error) {
+	if database.DB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	sqlDB, err := database.DB.DB()
+	if err != nil {
+		return nil, err
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return nil, err
+	}
+
+	stats := sqlDB.Stats()
+	return map[string]int{
+		"open_connections": stats.OpenConnections,
+		"in_use":           stats.InUse,
+	}, nil
+}
+
+// checkStorageWritable writes and removes a probe file in dir
+func checkStorageWritable(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("storage unreachable: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("storage path %s is not a directory", dir)
+	}
+
+	probe, err := os.CreateTemp(dir, ".health-*")
+	if err != nil {
+		return fmt.Errorf("storage not writable: %v", err)
+	}
+	probe.Close()
+	return os.Remove(filepath.Clean(probe.Name()))
+}
+
+// checkWebSockets reports the connection count, failing if the manager is
+// shutting down or its lock is stuck
+func checkWebSockets(ctx context.Context) (interface{}, error) {
+	locked := make(chan int, 1)
+	go func() {
+		wsManager.mutex.RLock()
+		defer wsManager.mutex.RUnlock()
+		if wsManager.closing {
+			locked <- -1
+			return
+		}
+		locked <- len(wsManager.connections)
+	}()
+
+	select {
+	case connections := <-locked:
+		if connections < 0 {
+			return nil, fmt.Errorf("websocket manager is shutting down")
+		}
+		return map[string]int{"connections": connections}, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("websocket manager unresponsive")
+	}
+}
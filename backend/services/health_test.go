@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// useHealthChecks replaces the registered health checks until the test ends
+func useHealthChecks(t *testing.T, checks ...HealthCheck) {
+	healthChecksMutex.Lock()
+	previous := healthChecks
+	healthChecks = checks
+	healthChecksMutex.Unlock()
+
+	t.Cleanup(func() {
+		healthChecksMutex.Lock()
+		healthChecks = previous
+		healthChecksMutex.Unlock()
+	})
+}
+
+func databaseUp(ctx context.Context) (interface{}, error) {
+	return map[string]int{"open_connections": 1}, nil
+}
+
+func TestHealthDegradedWhenStorageDown(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "unmounted")
+	useHealthChecks(t,
+		HealthCheck{Name: "database", Critical: true, Check: databaseUp},
+		HealthCheck{Name: "backup_storage", Check: func(ctx context.Context) (interface{}, error) {
+			return nil, checkStorageWritable(missing)
+		}},
+	)
+
+	report := CheckHealth(context.Background())
+	if report.Status != "degraded" || !report.Degraded {
+		t.Fatalf("status %q, degraded %v, want degraded", report.Status, report.Degraded)
+	}
+
+	storage := report.Subsystems["backup_storage"]
+	if storage.Status != "down" || storage.Critical || storage.Error == "" {
+		t.Errorf("backup_storage = %+v, want a non-critical failure with its error", storage)
+	}
+	if db := report.Subsystems["database"]; db.Status != "ok" || !db.Critical {
+		t.Errorf("database = %+v, want ok and critical", db)
+	}
+
+	// The body reports each subsystem by name
+	body, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Status     string `json:"status"`
+		Degraded   bool   `json:"degraded"`
+		Subsystems map[string]struct {
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		} `json:"subsystems"`
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Status != "degraded" || !decoded.Degraded || decoded.Subsystems["backup_storage"].Error == "" {
+		t.Errorf("body = %s, want degraded with the storage error", body)
+	}
+}
+
+func TestHealthDownWhenCriticalSubsystemFails(t *testing.T) {
+	useHealthChecks(t,
+		HealthCheck{Name: "database", Critical: true, Check: func(ctx context.Context) (interface{}, error) {
+			return nil, errors.New("connection refused")
+		}},
+		HealthCheck{Name: "backup_storage", Check: func(ctx context.Context) (interface{}, error) {
+			return nil, errors.New("storage unreachable")
+		}},
+	)
+
+	report := CheckHealth(context.Background())
+	if report.Status != "down" || report.Degraded {
+		t.Errorf("status %q, degraded %v, want down", report.Status, report.Degraded)
+	}
+	if db := report.Subsystems["database"]; db.Error != "connection refused" {
+		t.Errorf("database = %+v, want its error reported", db)
+	}
+}
+
+func TestHealthOKWhenStorageWritable(t *testing.T) {
+	dir := t.TempDir()
+	useHealthChecks(t,
+		HealthCheck{Name: "database", Critical: true, Check: databaseUp},
+		HealthCheck{Name: "backup_storage", Check: func(ctx context.Context) (interface{}, error) {
+			return nil, checkStorageWritable(dir)
+		}},
+	)
+
+	report := CheckHealth(context.Background())
+	if report.Status != "ok" || report.Degraded || len(report.Subsystems) != 2 {
+		t.Errorf("report = %+v, want ok with both subsystems", report)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, ".health-*")); len(matches) != 0 {
+		t.Errorf("storage probe left %v behind", matches)
+	}
+}
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// hibernationCheckInterval is how often running servers are checked for
+	// players
+	hibernationCheckInterval = time.Minute
+	// defaultHibernateIdleMinutes applies when a server enables hibernation
+	// without setting an idle period
+	defaultHibernateIdleMinutes = 15
+	// handshakeTimeout is how long a connection to a hibernating server has
+	// to send its handshake
+	handshakeTimeout = 5 * time.Second
+	// maxHandshakeLength bounds the length a Java handshake can declare: a
+	// 255 character address and a handful of varints
+	maxHandshakeLength = 1024
+)
+
+// hibernation tracks how long servers have been empty and the listeners
+// standing in for hibernating servers
+type hibernation struct {
+	mutex     sync.Mutex
+	idleSince map[uuid.UUID]time.Time
+	listeners map[uuid.UUID]io.Closer
+}
+
+var hibernator = &hibernation{
+	idleSince: make(map[uuid.UUID]time.Time),
+	listeners: make(map[uuid.UUID]io.Closer),
+}
+
+// InitializeHibernation puts servers that were hibernating when the panel
+// stopped back to sleep and starts the idle check
+func InitializeHibernation() {
+	var servers []models.Server
+	if err := database.DB.Where("status = ?", models.ServerStatusHibernating).Find(&servers).Error; err != nil {
+		log.Printf("Failed to load hibernating servers: %v", err)
+	}
+	for i := range servers {
+		server := &servers[i]
+		if err := listenForWake(server); err != nil {
+			log.Printf("Failed to listen for players of hibernating server %s: %v", server.Name, err)
+			database.DB.Model(server).Update("status", models.ServerStatusStopped)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(hibernationCheckInterval)
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			checkIdleServers(now)
+		}
+	}()
+}
+
+// checkIdleServers hibernates the running servers that have had no players
+// for their idle period
+func checkIdleServers(now time.Time) {
+	var servers []models.Server
+	if err := database.DB.Where("status = ? AND hibernate_enabled = ?", models.ServerStatusRunning, true).Find(&servers).Error; err != nil {
+		log.Printf("Failed to load servers for hibernation check: %v", err)
+		return
+	}
+
+	hibernator.mutex.Lock()
+	defer hibernator.mutex.Unlock()
+
+	candidates := make(map[uuid.UUID]bool, len(servers))
+	for i := range servers {
+		server := servers[i]
+		candidates[server.ID] = true
+
+		if onlinePlayerCount(&server) > 0 {
+			delete(hibernator.idleSince, server.ID)
+			continue
+		}
+
+		since, idle := hibernator.idleSince[server.ID]
+		if !idle {
+			hibernator.idleSince[server.ID] = now
+			continue
+		}
+		if now.Sub(since) < hibernateIdle(&server) {
+			continue
+		}
+
+		delete(hibernator.idleSince, server.ID)
+		go func() {
+			if err := HibernateServer(&server); err != nil {
+				log.Printf("Failed to hibernate server %s: %v", server.Name, err)
+			}
+		}()
+	}
+
+	// Forget servers that stopped or turned hibernation off
+	for id := range hibernator.idleSince {
+		if !candidates[id] {
+			delete(hibernator.idleSince, id)
+		}
+	}
+}
+
+// onlinePlayerCount counts a server's players from the tracked joins and
+// leaves, or the console log if the panel hasn't been tracking the server
+func onlinePlayerCount(server *models.Server) int {
+	onlinePlayersMutex.Lock()
+	players, tracked := onlinePlayers[server.ID]
+	count := len(players)
+	onlinePlayersMutex.Unlock()
+
+	if !tracked {
+		return countOnlinePlayers(server)
+	}
+	return count
+}
+
+// hibernateIdle is how long a server has to be empty before it hibernates
+func hibernateIdle(server *models.Server) time.Duration {
+	minutes := server.HibernateIdleMinutes
+	if minutes <= 0 {
+		minutes = defaultHibernateIdleMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// HibernateServer stops a running server and listens on its port in its
+// place, so the next player to connect starts it again. Starting it any
+// other way also ends the hibernation.
+func HibernateServer(server *models.Server) error {
+	unlock := lockServer(server.ID)
+	defer unlock()
+
+	refreshServerState(server)
+	if server.Status != models.ServerStatusRunning {
+		return ErrServerAlreadyStopped
+	}
+
+	if err := stopServer(server); err != nil {
+		return err
+	}
+
+	server.Status = models.ServerStatusHibernating
+	database.DB.Model(server).Update("status", models.ServerStatusHibernating)
+	if err := listenForWake(server); err != nil {
+		// Nothing could wake it, so leave it plainly stopped
+		server.Status = models.ServerStatusStopped
+		database.DB.Model(server).Update("status", models.ServerStatusStopped)
+		return fmt.Errorf("failed to listen for players: %v", err)
+	}
+	BroadcastServerStatus(server.ID, models.ServerStatusHibernating,
+		fmt.Sprintf("No players for %s, hibernating until someone connects", hibernateIdle(server)))
+	log.Printf("Server %s hibernated after %s without players", server.Name, hibernateIdle(server))
+	return nil
+}
+
+// rearmHibernation puts a server that failed to wake back to sleep
+func rearmHibernation(server *models.Server) {
+	if err := listenForWake(server); err != nil {
+		log.Printf("Failed to listen for players of hibernating server %s: %v", server.Name, err)
+		return
+	}
+	server.Status = models.ServerStatusHibernating
+	database.DB.Model(server).Update("status", models.ServerStatusHibernating)
+	BroadcastServerStatus(server.ID, models.ServerStatusHibernating, "Server failed to start, hibernating until someone connects")
+}
+
+// wakeServer starts a hibernating server after a player tried to connect
+func wakeServer(serverID uuid.UUID) {
+	var server models.Server
+	if err := database.DB.First(&server, serverID).Error; err != nil {
+		return
+	}
+	if server.Status != models.ServerStatusHibernating {
+		return
+	}
+
+	log.Printf("Waking hibernating server %s for a connecting player", server.Name)
+	BroadcastServerStatus(server.ID, models.ServerStatusStarting, "Player connecting, waking from hibernation")
+	if err := StartServer(&server); err != nil {
+		log.Printf("Failed to wake server %s: %v", server.Name, err)
+	}
+}
+
+// listenForWake listens on the server's port until a player tries to join.
+// Java clients only wake the server when they log in; server list pings are
+// turned away so the server stays asleep while showing as offline. Bedrock
+// runs over UDP and wakes on a RakNet connection request; pings and other
+// packets are ignored. Scanners and other junk traffic never wake it.
+func listenForWake(server *models.Server) error {
+	serverID := server.ID
+	address := fmt.Sprintf(":%d", server.Port)
+
+	// The listener is registered before anything is served on it, so a
+	// player connecting straight away finds it to release
+	var closer io.Closer
+	var serve func()
+	if server.Type == models.ServerTypeBedrock {
+		conn, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return err
+		}
+		closer = conn
+
+		serve = func() {
+			buffer := make([]byte, 2048)
+			for {
+				n, _, err := conn.ReadFrom(buffer)
+				if err != nil {
+					return
+				}
+				if !isRakNetConnectionRequest(buffer[:n]) {
+					continue
+				}
+
+				releaseWakeListener(serverID)
+				wakeServer(serverID)
+				return
+			}
+		}
+	} else {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return err
+		}
+		closer = listener
+
+		serve = func() {
+			var wake sync.Once
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+
+				// Each connection gets its own handshake timeout, so one
+				// that sends nothing doesn't hold up a player behind it
+				go func() {
+					conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+					login := isLoginHandshake(conn)
+					conn.Close()
+					if !login {
+						return
+					}
+
+					wake.Do(func() {
+						releaseWakeListener(serverID)
+						wakeServer(serverID)
+					})
+				}()
+			}
+		}
+	}
+
+	hibernator.mutex.Lock()
+	hibernator.listeners[serverID] = closer
+	hibernator.mutex.Unlock()
+
+	go serve()
+	return nil
+}
+
+// releaseWakeListener closes a hibernating server's listener, freeing its
+// port for the server
+func releaseWakeListener(serverID uuid.UUID) {
+	hibernator.mutex.Lock()
+	listener, exists := hibernator.listeners[serverID]
+	delete(hibernator.listeners, serverID)
+	hibernator.mutex.Unlock()
+
+	if exists {
+		listener.Close()
+	}
+}
+
+// isLoginHandshake reports whether a Java connection opens with a handshake
+// asking to log in. Status pings and anything that can't be read as a
+// handshake are not join attempts.
+func isLoginHandshake(r io.Reader) bool {
+	reader := bufio.NewReader(r)
+
+	// Handshake: length, packet ID 0, protocol version, server address,
+	// port, next state (1 for status, 2 for login)
+	length, err := binary.ReadUvarint(reader)
+	if err != nil || length == 0 || length > maxHandshakeLength {
+		return false
+	}
+	if packetID, err := binary.ReadUvarint(reader); err != nil || packetID != 0 {
+		return false
+	}
+	if _, err := binary.ReadUvarint(reader); err != nil {
+		return false
+	}
+	addressLength, err := binary.ReadUvarint(reader)
+	if err != nil || addressLength > 255 {
+		return false
+	}
+	if _, err := reader.Discard(int(addressLength) + 2); err != nil {
+		return false
+	}
+	nextState, err := binary.ReadUvarint(reader)
+	return err == nil && nextState == 2
+}
+
+// raknetOfflineMagic is the constant every unconnected RakNet packet carries
+var raknetOfflineMagic = []byte{0x00, 0xff, 0xff, 0x00, 0xfe, 0xfe, 0xfe, 0xfe, 0xfd, 0xfd, 0xfd, 0xfd, 0x12, 0x34, 0x56, 0x78}
+
+// isRakNetConnectionRequest reports whether a Bedrock packet is an Open
+// Connection Request, the first packet a client sends when it joins.
+// Unconnected pings from the server list are not.
+func isRakNetConnectionRequest(packet []byte) bool {
+	const (
+		openConnectionRequest1 = 0x05
+		openConnectionRequest2 = 0x07
+	)
+	if len(packet) < 1+len(raknetOfflineMagic) {
+		return false
+	}
+	if packet[0] != openConnectionRequest1 && packet[0] != openConnectionRequest2 {
+		return false
+	}
+	return bytes.Equal(packet[1:1+len(raknetOfflineMagic)], raknetOfflineMagic)
+}
@@ -0,0 +1,329 @@
+package services
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// javaHandshake builds the handshake a Java client opens with, asking for
+// nextState (1 for status, 2 for login)
+func javaHandshake(nextState byte) []byte {
+	const address = "play.example.com"
+	body := []byte{0x00}                   // packet ID
+	body = binary.AppendUvarint(body, 765) // protocol version
+	body = binary.AppendUvarint(body, uint64(len(address)))
+	body = append(body, address...)
+	body = append(body, 0x63, 0xdd) // port 25565
+	body = append(body, nextState)
+	return append(binary.AppendUvarint(nil, uint64(len(body))), body...)
+}
+
+// raknetPacket builds an unconnected RakNet packet with the given ID
+func raknetPacket(id byte) []byte {
+	packet := append([]byte{id}, raknetOfflineMagic...)
+	return append(packet, make([]byte, 8)...)
+}
+
+func TestIsLoginHandshake(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		want   bool
+	}{
+		{"login", javaHandshake(2), true},
+		{"status ping", javaHandshake(1), false},
+		{"unknown next state", javaHandshake(7), false},
+		{"truncated login", javaHandshake(2)[:10], false},
+		{"legacy ping", []byte{0xfe, 0x01, 0xfa}, false},
+		{"http request", []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"), false},
+		{"tls client hello", []byte{0x16, 0x03, 0x01, 0x02, 0x00, 0x01, 0x00, 0x01, 0xfc}, false},
+		{"nothing", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isLoginHandshake(strings.NewReader(string(tt.packet))); got != tt.want {
+				t.Errorf("isLoginHandshake = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRakNetConnectionRequest(t *testing.T) {
+	withoutMagic := raknetPacket(0x05)
+	withoutMagic[5] = 0x00
+
+	tests := []struct {
+		name   string
+		packet []byte
+		want   bool
+	}{
+		{"open connection request 1", raknetPacket(0x05), true},
+		{"open connection request 2", raknetPacket(0x07), true},
+		{"unconnected ping", raknetPacket(0x01), false},
+		{"unconnected ping open connections", raknetPacket(0x02), false},
+		{"request without the magic", withoutMagic, false},
+		{"too short", []byte{0x05, 0x00, 0xff}, false},
+		{"junk", []byte("hello"), false},
+		{"empty", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRakNetConnectionRequest(tt.packet); got != tt.want {
+				t.Errorf("isRakNetConnectionRequest = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// createHibernatingServer saves a server running the fake server script
+// when it starts and puts it to sleep on its port
+func createHibernatingServer(t *testing.T, serverType models.ServerType) *models.Server {
+	t.Helper()
+
+	java := writeFakeJava(t, fakeServerScript)
+	accepted := time.Now()
+	server := testutil.CreateServer(t, &models.Server{
+		Type:             serverType,
+		JavaPath:         java,
+		ServerJar:        "server.jar",
+		StopTimeout:      5,
+		EULAAcceptedAt:   &accepted,
+		HibernateEnabled: true,
+		Status:           models.ServerStatusHibernating,
+	})
+	if err := os.WriteFile(filepath.Join(server.Path, "server.jar"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		releaseWakeListener(server.ID)
+		if hasProcess(server.ID) {
+			stopCopy(t, server)
+		}
+	})
+
+	if err := listenForWake(server); err != nil {
+		t.Fatalf("listenForWake: %v", err)
+	}
+	return server
+}
+
+// wakeListenerOpen reports whether a server still has a wake listener
+func wakeListenerOpen(serverID uuid.UUID) bool {
+	hibernator.mutex.Lock()
+	defer hibernator.mutex.Unlock()
+	_, open := hibernator.listeners[serverID]
+	return open
+}
+
+// serverStatus reads a server's status from the database
+func serverStatus(serverID uuid.UUID) models.ServerStatus {
+	var current models.Server
+	database.DB.Select("status").First(&current, serverID)
+	return current.Status
+}
+
+// waitForServerStatus waits for a server to reach one of statuses
+func waitForServerStatus(t *testing.T, serverID uuid.UUID, statuses ...models.ServerStatus) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status := serverStatus(serverID)
+		for _, want := range statuses {
+			if status == want {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server status = %s, want one of %v", status, statuses)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// sendTCP connects to the server's port and sends data
+func sendTCP(t *testing.T, port int, data []byte) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	if err != nil {
+		t.Fatalf("failed to connect to the wake listener: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	// Read until the listener closes the connection, so it has been handled
+	conn.SetReadDeadline(time.Now().Add(handshakeTimeout + time.Second))
+	conn.Read(make([]byte, 1))
+}
+
+func TestJavaWakeListenerIgnoresPingsAndJunk(t *testing.T) {
+	testDB(t)
+	server := createHibernatingServer(t, models.ServerTypePaper)
+
+	sendTCP(t, server.Port, javaHandshake(1))
+	sendTCP(t, server.Port, []byte("GET / HTTP/1.1\r\n\r\n"))
+	sendTCP(t, server.Port, []byte{0x16, 0x03, 0x01, 0x00, 0x05})
+
+	if !wakeListenerOpen(server.ID) || serverStatus(server.ID) != models.ServerStatusHibernating {
+		t.Fatalf("server woke on a status ping or junk: listener open %v, status %s",
+			wakeListenerOpen(server.ID), serverStatus(server.ID))
+	}
+
+	sendTCP(t, server.Port, javaHandshake(2))
+	waitForServerStatus(t, server.ID, models.ServerStatusStarting, models.ServerStatusRunning)
+	if wakeListenerOpen(server.ID) {
+		t.Error("wake listener still open after the server woke")
+	}
+}
+
+func TestBedrockWakeListenerIgnoresPingsAndJunk(t *testing.T) {
+	testDB(t)
+	server := createHibernatingServer(t, models.ServerTypeBedrock)
+
+	conn, err := net.Dial("udp", "127.0.0.1:"+strconv.Itoa(server.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write(raknetPacket(0x01))
+	conn.Write([]byte("junk"))
+	time.Sleep(200 * time.Millisecond)
+	if !wakeListenerOpen(server.ID) {
+		t.Fatal("server woke on a ping or junk packet")
+	}
+
+	// Marked stopped so waking doesn't download the bedrock server; the
+	// listener closing shows the request was taken as a join
+	database.DB.Model(server).Update("status", models.ServerStatusStopped)
+	conn.Write(raknetPacket(0x05))
+	deadline := time.Now().Add(5 * time.Second)
+	for wakeListenerOpen(server.ID) {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not wake on an open connection request")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestWakeOnFirstPacketReleasesPort(t *testing.T) {
+	testDB(t)
+	server := createHibernatingServer(t, models.ServerTypeBedrock)
+	// Marked stopped so waking doesn't download the bedrock server
+	database.DB.Model(server).Update("status", models.ServerStatusStopped)
+
+	conn, err := net.Dial("udp", "127.0.0.1:"+strconv.Itoa(server.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// A join arriving as soon as the listener is up must still find it to
+	// release, or the port stays taken and the server can't start on it
+	for i := 0; i < 20; i++ {
+		releaseWakeListener(server.ID)
+		if err := listenForWake(server); err != nil {
+			t.Fatalf("listenForWake: %v", err)
+		}
+		conn.Write(raknetPacket(0x05))
+
+		deadline := time.Now().Add(5 * time.Second)
+		for wakeListenerOpen(server.ID) {
+			if time.Now().After(deadline) {
+				t.Fatalf("round %d: wake listener not released", i)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		port, err := net.ListenPacket("udp", ":"+strconv.Itoa(server.Port))
+		if err != nil {
+			t.Fatalf("round %d: port still taken after waking: %v", i, err)
+		}
+		port.Close()
+	}
+}
+
+func TestStartServerEndsHibernation(t *testing.T) {
+	testDB(t)
+	server := createHibernatingServer(t, models.ServerTypePaper)
+
+	starting := *server
+	if err := StartServer(&starting); err != nil {
+		t.Fatalf("StartServer: %v", err)
+	}
+	if wakeListenerOpen(server.ID) {
+		t.Error("wake listener still open after starting the server")
+	}
+	waitForServerStatus(t, server.ID, models.ServerStatusRunning)
+}
+
+func TestIdleServerHibernates(t *testing.T) {
+	testDB(t)
+	server := createHibernatingServer(t, models.ServerTypePaper)
+	database.DB.Model(server).Update("hibernate_idle_minutes", 1)
+
+	starting := *server
+	if err := StartServer(&starting); err != nil {
+		t.Fatalf("StartServer: %v", err)
+	}
+	waitForServerStatus(t, server.ID, models.ServerStatusRunning)
+
+	setPlayers := func(names ...string) {
+		players := make(map[string]time.Time)
+		for _, name := range names {
+			players[name] = time.Now()
+		}
+		onlinePlayersMutex.Lock()
+		onlinePlayers[server.ID] = players
+		onlinePlayersMutex.Unlock()
+	}
+	t.Cleanup(func() {
+		onlinePlayersMutex.Lock()
+		delete(onlinePlayers, server.ID)
+		onlinePlayersMutex.Unlock()
+	})
+
+	// A player online keeps the idle timer from starting
+	start := time.Now()
+	setPlayers("Steve")
+	checkIdleServers(start)
+	checkIdleServers(start.Add(2 * time.Minute))
+	if serverStatus(server.ID) != models.ServerStatusRunning {
+		t.Fatalf("server with a player online hibernated")
+	}
+
+	// The timer starts once the server is empty and resets when someone
+	// joins before it runs out
+	setPlayers()
+	checkIdleServers(start)
+	setPlayers("Alex")
+	checkIdleServers(start.Add(30 * time.Second))
+	setPlayers()
+	checkIdleServers(start.Add(40 * time.Second))
+	checkIdleServers(start.Add(90 * time.Second))
+	if serverStatus(server.ID) != models.ServerStatusRunning {
+		t.Fatalf("server hibernated before its idle period since the last player left")
+	}
+
+	checkIdleServers(start.Add(101 * time.Second))
+	waitForServerStatus(t, server.ID, models.ServerStatusHibernating)
+	if !wakeListenerOpen(server.ID) {
+		t.Error("hibernated server has no wake listener")
+	}
+	if hasProcess(server.ID) {
+		t.Error("hibernated server still has a process")
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyTTL is how long a response is kept for replay
+const IdempotencyTTL = 24 * time.Hour
+
+var (
+	// ErrIdempotencyInProgress is returned when a request with the same key
+	// is still running
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is still in progress")
+	// ErrIdempotencyKeyReused is returned when a key is sent again with a
+	// different request
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+)
+
+// BeginIdempotentRequest claims a key for a request. It returns the claimed
+// record for a new key, which must be finished with CompleteIdempotentRequest
+// or ReleaseIdempotentRequest, or the stored record when the request was
+// already made and its response should be replayed.
+func BeginIdempotentRequest(userID uuid.UUID, scope, key, requestHash string) (claimed *models.IdempotencyKey, replay *models.IdempotencyKey, err error) {
+	now := time.Now()
+	if err := database.DB.Where("expires_at < ?", now).Delete(&models.IdempotencyKey{}).Error; err != nil {
+		log.Printf("Failed to remove expired idempotency keys: %v", err)
+	}
+
+	record := &models.IdempotencyKey{
+		UserID:      userID,
+		Scope:       scope,
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   now.Add(IdempotencyTTL),
+	}
+	result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return record, nil, nil
+	}
+
+	var existing models.IdempotencyKey
+	if err := database.DB.Where("user_id = ? AND scope = ? AND key = ?", userID, scope, key).
+		First(&existing).Error; err != nil {
+		return nil, nil, err
+	}
+	if existing.RequestHash != requestHash {
+		return nil, nil, ErrIdempotencyKeyReused
+	}
+	if !existing.Completed {
+		return nil, nil, ErrIdempotencyInProgress
+	}
+	return nil, &existing, nil
+}
+
+// CompleteIdempotentRequest stores the response to a claimed request.
+// Server errors aren't stored and free the key, so the request can be
+// retried.
+func CompleteIdempotentRequest(record *models.IdempotencyKey, statusCode int, response []byte) {
+	if statusCode >= 500 {
+		ReleaseIdempotentRequest(record)
+		return
+	}
+
+	if err := database.DB.Model(record).Updates(map[string]interface{}{
+		"completed":   true,
+		"status_code": statusCode,
+		"response":    response,
+	}).Error; err != nil {
+		log.Printf("Failed to store response for idempotency key %s: %v", record.Key, err)
+	}
+}
+
+// ReleaseIdempotentRequest frees a claimed key without storing a response
+func ReleaseIdempotentRequest(record *models.IdempotencyKey) {
+	if err := database.DB.Delete(record).Error; err != nil {
+		log.Printf("Failed to release idempotency key %s: %v", record.Key, err)
+	}
+}
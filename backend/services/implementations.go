@@ -0,0 +1,178 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"playpulse-panel/models"
+)
+
+// ErrUnsupportedVersion is returned when a server type isn't available for
+// the requested Minecraft version
+var ErrUnsupportedVersion = errors.New("unsupported version")
+
+// ServerImplementation is the software behind a server type: where the
+// Minecraft versions it is available for are listed and where its jar is
+// downloaded from. The versions come from the implementation's own API
+// (Mojang's for Vanilla and Spigot), so new releases need no panel update.
+type ServerImplementation struct {
+	Type        models.ServerType `json:"type"`
+	DisplayName string            `json:"display_name"`
+
+	// versions lists the available versions, newest first
+	versions *upstreamVersionList
+
+	// resolveDownload returns the jar URL and file name for a version; nil
+	// for types that are installed another way (Forge, Bedrock)
+	resolveDownload func(version string) (string, string, error)
+}
+
+var serverImplementations = map[models.ServerType]*ServerImplementation{
+	models.ServerTypeVanilla: {
+		Type:        models.ServerTypeVanilla,
+		DisplayName: "Vanilla",
+		versions:    newUpstreamVersionList(mojangReleasesSince("1.0")),
+		resolveDownload: func(version string) (string, string, error) {
+			return getVanillaDownloadURL(version), fmt.Sprintf("server-%s.jar", version), nil
+		},
+	},
+	models.ServerTypePaper: {
+		Type:            models.ServerTypePaper,
+		DisplayName:     "Paper",
+		versions:        newUpstreamVersionList(fetchPaperVersions),
+		resolveDownload: getPaperDownloadURL,
+	},
+	models.ServerTypePurpur: {
+		Type:            models.ServerTypePurpur,
+		DisplayName:     "Purpur",
+		versions:        newUpstreamVersionList(fetchPurpurVersions),
+		resolveDownload: getPurpurDownloadURL,
+	},
+	models.ServerTypeSpigot: {
+		Type:        models.ServerTypeSpigot,
+		DisplayName: "Spigot",
+		// BuildTools builds every release from 1.8
+		versions: newUpstreamVersionList(mojangReleasesSince("1.8")),
+		resolveDownload: func(version string) (string, string, error) {
+			return getSpigotDownloadURL(version), fmt.Sprintf("spigot-%s.jar", version), nil
+		},
+	},
+	models.ServerTypeFabric: {
+		Type:        models.ServerTypeFabric,
+		DisplayName: "Fabric",
+		versions:    newUpstreamVersionList(fetchFabricVersions),
+		resolveDownload: func(version string) (string, string, error) {
+			return getFabricDownloadURL(version), fmt.Sprintf("fabric-server-%s.jar", version), nil
+		},
+	},
+	models.ServerTypeForge: {
+		Type:        models.ServerTypeForge,
+		DisplayName: "Minecraft Forge",
+		versions:    newUpstreamVersionList(fetchForgeVersions),
+	},
+}
+
+// ImplementationFor returns the implementation metadata of a server type, or
+// nil for types the panel has none for (Bedrock, proxies, custom servers),
+// whose versions are taken as given
+func ImplementationFor(serverType models.ServerType) *ServerImplementation {
+	return serverImplementations[serverType]
+}
+
+// Versions lists the versions the implementation is available for, newest
+// first
+func (si *ServerImplementation) Versions() ([]string, error) {
+	return si.versions.get()
+}
+
+// SupportsVersion reports whether the implementation is available for a
+// Minecraft version. Forge also takes a full Forge version such as
+// 1.20.1-47.2.0, checked by its Minecraft part.
+func (si *ServerImplementation) SupportsVersion(version string) (bool, error) {
+	versions, err := si.Versions()
+	if err != nil {
+		return false, err
+	}
+
+	if si.Type == models.ServerTypeForge {
+		version, _, _ = strings.Cut(version, "-")
+	}
+	for _, supported := range versions {
+		if supported == version {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// JavaRange returns the oldest and newest Java the implementation runs on
+// for a Minecraft version
+func (si *ServerImplementation) JavaRange(version string) (int, int) {
+	minor, patch := parseMinecraftVersion(version)
+
+	javaMin := 8
+	switch {
+	case minor > 20 || (minor == 20 && patch >= 5):
+		javaMin = 21
+	case minor >= 18:
+		javaMin = 17
+	case minor == 17:
+		javaMin = 16
+	}
+
+	javaMax := 21
+	if minor < 17 {
+		javaMax = 16
+		if si.Type == models.ServerTypeForge {
+			// Forge's installer and launch wrapper before 1.17 need Java 8
+			javaMax = 8
+		}
+	}
+
+	return javaMin, javaMax
+}
+
+// ValidateServerVersion checks the version can be installed for the server
+// type. Vanilla also accepts any version Mojang lists, snapshots included.
+// When the implementation's version list cannot be fetched the version is let
+// through; installing it reports whether it exists. SupportedVersions gives
+// the alternatives when it fails.
+func ValidateServerVersion(serverType models.ServerType, version string) error {
+	implementation := ImplementationFor(serverType)
+	if implementation == nil {
+		return nil
+	}
+	if version == "" {
+		return fmt.Errorf("%w: %s needs a version", ErrUnsupportedVersion, implementation.DisplayName)
+	}
+
+	supported, err := implementation.SupportsVersion(version)
+	if err != nil || supported {
+		return nil
+	}
+
+	if serverType == models.ServerTypeVanilla {
+		if known, _, err := mojangVersions.versions(); err == nil && known[version] {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s is not available for %s", ErrUnsupportedVersion, implementation.DisplayName, version)
+}
+
+// SupportedVersions lists the versions a server type can be created with,
+// newest first, or nil when any version is accepted or the list cannot be
+// fetched
+func SupportedVersions(serverType models.ServerType) []string {
+	implementation := ImplementationFor(serverType)
+	if implementation == nil {
+		return nil
+	}
+
+	versions, err := implementation.Versions()
+	if err != nil {
+		return nil
+	}
+	return versions
+}
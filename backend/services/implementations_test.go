@@ -0,0 +1,157 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"playpulse-panel/models"
+)
+
+// Trimmed responses recorded from the Mojang, Paper and Fabric version APIs
+const (
+	recordedMojangManifest = `{"versions": [
+		{"id": "24w14a", "type": "snapshot"},
+		{"id": "1.20.4", "type": "release"},
+		{"id": "1.20.1", "type": "release"},
+		{"id": "1.8.9", "type": "release"},
+		{"id": "1.7.10", "type": "release"},
+		{"id": "b1.7.3", "type": "old_beta"}
+	]}`
+	recordedPaperProject = `{"project_id": "paper", "versions": ["1.19.4", "1.20.1", "1.20.4"]}`
+	recordedFabricGames  = `[
+		{"version": "24w14a", "stable": false},
+		{"version": "1.20.4", "stable": true},
+		{"version": "1.20.1", "stable": true}
+	]`
+)
+
+// useRecordedVersions points the version lists at recorded API responses
+// with empty caches, restoring them when the test ends
+func useRecordedVersions(t *testing.T) {
+	t.Helper()
+
+	api := newRecordedAPI(t, map[string]string{
+		"/mojang/version_manifest.json": recordedMojangManifest,
+		"/projects/paper":               recordedPaperProject,
+		"/fabric/v2/versions/game":      recordedFabricGames,
+	})
+
+	previousResolver, previousCatalog := buildResolver, mojangVersions
+	previousPaper, previousManifest, previousFabric := paperAPIBase, mojangManifestURL, fabricGameVersionsURL
+	previousLists := make(map[models.ServerType]*upstreamVersionList)
+	for serverType, implementation := range serverImplementations {
+		previousLists[serverType] = implementation.versions
+		implementation.versions = newUpstreamVersionList(implementation.versions.fetch)
+	}
+	t.Cleanup(func() {
+		buildResolver, mojangVersions = previousResolver, previousCatalog
+		paperAPIBase, mojangManifestURL, fabricGameVersionsURL = previousPaper, previousManifest, previousFabric
+		for serverType, versions := range previousLists {
+			serverImplementations[serverType].versions = versions
+		}
+	})
+
+	buildResolver = &BuildResolver{client: api.Client(), cache: make(map[string]*ResolvedBuild)}
+	mojangVersions = &mojangVersionCatalog{}
+	paperAPIBase = api.URL
+	mojangManifestURL = api.URL + "/mojang/version_manifest.json"
+	fabricGameVersionsURL = api.URL + "/fabric/v2/versions/game"
+}
+
+func TestValidateServerVersionRejectsUnsupported(t *testing.T) {
+	useRecordedVersions(t)
+
+	tests := []struct {
+		serverType models.ServerType
+		version    string
+		supported  bool
+	}{
+		{models.ServerTypePaper, "1.20.4", true},
+		{models.ServerTypePaper, "1.8.9", false},
+		{models.ServerTypePaper, "", false},
+		{models.ServerTypeSpigot, "1.8.9", true},
+		{models.ServerTypeSpigot, "1.7.10", false},
+		{models.ServerTypeVanilla, "1.7.10", true},
+		{models.ServerTypeVanilla, "24w14a", true}, // snapshots are known to Mojang
+		{models.ServerTypeVanilla, "1.99", false},
+		{models.ServerTypeFabric, "1.20.1", true},
+		{models.ServerTypeFabric, "24w14a", false},
+		{models.ServerTypeBedrock, "1.20.81.01", true}, // taken as given
+		{models.ServerTypeOther, "", true},
+	}
+	for _, tt := range tests {
+		err := ValidateServerVersion(tt.serverType, tt.version)
+		if tt.supported {
+			if err != nil {
+				t.Errorf("%s %q: %v, want it accepted", tt.serverType, tt.version, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("%s %q = %v, want ErrUnsupportedVersion", tt.serverType, tt.version, err)
+			continue
+		}
+		// The error says which software and version, so the user knows
+		// what to change
+		display := ImplementationFor(tt.serverType).DisplayName
+		if !strings.Contains(err.Error(), display) || !strings.Contains(err.Error(), tt.version) {
+			t.Errorf("%s %q: error %q doesn't name the software and version", tt.serverType, tt.version, err)
+		}
+	}
+}
+
+func TestValidateServerVersionLetsThroughWhenListUnavailable(t *testing.T) {
+	useRecordedVersions(t)
+	paperAPIBase = paperAPIBase + "/unavailable"
+
+	if err := ValidateServerVersion(models.ServerTypePaper, "1.8.9"); err != nil {
+		t.Errorf("ValidateServerVersion with the list unavailable = %v, want the install to decide", err)
+	}
+	if versions := SupportedVersions(models.ServerTypePaper); versions != nil {
+		t.Errorf("SupportedVersions with the list unavailable = %v, want nil", versions)
+	}
+}
+
+func TestSupportedVersionsNewestFirst(t *testing.T) {
+	useRecordedVersions(t)
+
+	tests := []struct {
+		serverType models.ServerType
+		want       string
+	}{
+		{models.ServerTypePaper, "1.20.4,1.20.1,1.19.4"},
+		{models.ServerTypeSpigot, "1.20.4,1.20.1,1.8.9"},
+		{models.ServerTypeVanilla, "1.20.4,1.20.1,1.8.9,1.7.10"},
+		{models.ServerTypeFabric, "1.20.4,1.20.1"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(SupportedVersions(tt.serverType), ","); got != tt.want {
+			t.Errorf("SupportedVersions(%s) = %s, want %s", tt.serverType, got, tt.want)
+		}
+	}
+	if versions := SupportedVersions(models.ServerTypeBedrock); versions != nil {
+		t.Errorf("SupportedVersions(bedrock) = %v, want nil for any version", versions)
+	}
+}
+
+func TestImplementationJavaRange(t *testing.T) {
+	tests := []struct {
+		serverType models.ServerType
+		version    string
+		min, max   int
+	}{
+		{models.ServerTypePaper, "1.20.4", 17, 21},
+		{models.ServerTypePaper, "1.20.5", 21, 21},
+		{models.ServerTypePaper, "1.17.1", 16, 21},
+		{models.ServerTypePaper, "1.12.2", 8, 16},
+		{models.ServerTypeForge, "1.12.2", 8, 8},
+		{models.ServerTypeForge, "1.20.1", 17, 21},
+	}
+	for _, tt := range tests {
+		min, max := ImplementationFor(tt.serverType).JavaRange(tt.version)
+		if min != tt.min || max != tt.max {
+			t.Errorf("%s %s: Java %d-%d, want %d-%d", tt.serverType, tt.version, min, max, tt.min, tt.max)
+		}
+	}
+}
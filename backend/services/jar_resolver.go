@@ -0,0 +1,202 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// API endpoints used to resolve concrete build numbers
+var (
+	paperAPIBase  = "https://api.papermc.io/v2"
+	purpurAPIBase = "https://api.purpurmc.org/v2"
+)
+
+// How long a resolved build is reused before asking the API again
+const buildCacheTTL = time.Hour
+
+// ResolvedBuild represents a concrete, downloadable server build
+type ResolvedBuild struct {
+	Project    string    `json:"project"`
+	Version    string    `json:"version"`
+	Build      int       `json:"build"`
+	FileName   string    `json:"file_name"`
+	URL        string    `json:"url"`
+	SHA256     string    `json:"sha256,omitempty"` // published checksum, if any
+	ResolvedAt time.Time `json:"resolved_at"`
+}
+
+// BuildResolver looks up the newest stable build for a project version
+type BuildResolver struct {
+	client *http.Client
+	cache  map[string]*ResolvedBuild
+	mutex  sync.RWMutex
+}
+
+var buildResolver = &BuildResolver{
+	client: &http.Client{Timeout: 30 * time.Second},
+	cache:  make(map[string]*ResolvedBuild),
+}
+
+type paperBuildsResponse struct {
+	ProjectID string `json:"project_id"`
+	Version   string `json:"version"`
+	Builds    []struct {
+		Build     int    `json:"build"`
+		Channel   string `json:"channel"`
+		Downloads struct {
+			Application struct {
+				Name   string `json:"name"`
+				SHA256 string `json:"sha256"`
+			} `json:"application"`
+		} `json:"downloads"`
+	} `json:"builds"`
+}
+
+type purpurVersionResponse struct {
+	Project string `json:"project"`
+	Version string `json:"version"`
+	Builds  struct {
+		Latest string   `json:"latest"`
+		All    []string `json:"all"`
+	} `json:"builds"`
+}
+
+// ResolvePaper returns the newest stable Paper build for a Minecraft version
+func (br *BuildResolver) ResolvePaper(version string) (*ResolvedBuild, error) {
+	return br.resolve("paper", version, br.fetchPaper)
+}
+
+// ResolvePurpur returns the newest Purpur build for a Minecraft version
+func (br *BuildResolver) ResolvePurpur(version string) (*ResolvedBuild, error) {
+	return br.resolve("purpur", version, br.fetchPurpur)
+}
+
+func (br *BuildResolver) resolve(project, version string, fetch func(string) (*ResolvedBuild, error)) (*ResolvedBuild, error) {
+	if version == "" {
+		return nil, fmt.Errorf("%s version is required", project)
+	}
+
+	key := project + ":" + version
+
+	br.mutex.RLock()
+	cached, exists := br.cache[key]
+	br.mutex.RUnlock()
+
+	if exists && time.Since(cached.ResolvedAt) < buildCacheTTL {
+		return cached, nil
+	}
+
+	build, err := fetch(version)
+	if err != nil {
+		return nil, err
+	}
+	build.ResolvedAt = time.Now()
+
+	br.mutex.Lock()
+	br.cache[key] = build
+	br.mutex.Unlock()
+
+	return build, nil
+}
+
+// checksumFor returns the published SHA-256 of a resolved build's download
+// URL, or "" when it is unknown
+func (br *BuildResolver) checksumFor(url string) string {
+	br.mutex.RLock()
+	defer br.mutex.RUnlock()
+
+	for _, build := range br.cache {
+		if build.URL == url {
+			return build.SHA256
+		}
+	}
+	return ""
+}
+
+func (br *BuildResolver) fetchPaper(version string) (*ResolvedBuild, error) {
+	url := fmt.Sprintf("%s/projects/paper/versions/%s/builds", paperAPIBase, version)
+
+	var response paperBuildsResponse
+	if err := br.getJSON(url, &response); err != nil {
+		return nil, fmt.Errorf("failed to query paper builds: %v", err)
+	}
+
+	// Pick the highest build on the default (stable) channel
+	best := -1
+	for i, build := range response.Builds {
+		if build.Channel != "" && build.Channel != "default" {
+			continue
+		}
+		if build.Downloads.Application.Name == "" {
+			continue
+		}
+		if best == -1 || build.Build > response.Builds[best].Build {
+			best = i
+		}
+	}
+
+	if best == -1 {
+		return nil, fmt.Errorf("no stable paper build found for version %s", version)
+	}
+
+	build := response.Builds[best]
+	fileName := build.Downloads.Application.Name
+
+	return &ResolvedBuild{
+		Project:  "paper",
+		Version:  version,
+		Build:    build.Build,
+		FileName: fileName,
+		URL: fmt.Sprintf("%s/projects/paper/versions/%s/builds/%d/downloads/%s",
+			paperAPIBase, version, build.Build, fileName),
+		SHA256: build.Downloads.Application.SHA256,
+	}, nil
+}
+
+func (br *BuildResolver) fetchPurpur(version string) (*ResolvedBuild, error) {
+	url := fmt.Sprintf("%s/purpur/%s", purpurAPIBase, version)
+
+	var response purpurVersionResponse
+	if err := br.getJSON(url, &response); err != nil {
+		return nil, fmt.Errorf("failed to query purpur builds: %v", err)
+	}
+
+	// Purpur only publishes successful builds, so the highest number wins
+	best := 0
+	candidates := append([]string{response.Builds.Latest}, response.Builds.All...)
+	for _, candidate := range candidates {
+		if number, err := strconv.Atoi(candidate); err == nil && number > best {
+			best = number
+		}
+	}
+
+	if best == 0 {
+		return nil, fmt.Errorf("no purpur build found for version %s", version)
+	}
+
+	return &ResolvedBuild{
+		Project:  "purpur",
+		Version:  version,
+		Build:    best,
+		FileName: fmt.Sprintf("purpur-%s-%d.jar", version, best),
+		URL:      fmt.Sprintf("%s/purpur/%s/%d/download", purpurAPIBase, version, best),
+	}, nil
+}
+
+func (br *BuildResolver) getJSON(url string, target interface{}) error {
+	resp, err := br.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(target)
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Trimmed responses recorded from the Paper and Purpur APIs
+const (
+	recordedPaperBuilds = `{
+		"project_id": "paper",
+		"version": "1.20.4",
+		"builds": [
+			{"build": 496, "channel": "default", "downloads": {"application": {"name": "paper-1.20.4-496.jar", "sha256": "aa11"}}},
+			{"build": 497, "channel": "default", "downloads": {"application": {"name": "paper-1.20.4-497.jar", "sha256": "bb22"}}},
+			{"build": 498, "channel": "experimental", "downloads": {"application": {"name": "paper-1.20.4-498.jar", "sha256": "cc33"}}}
+		]
+	}`
+	recordedPurpurVersion = `{
+		"project": "purpur",
+		"version": "1.20.4",
+		"builds": {"latest": "2176", "all": ["2174", "2175", "2176"]}
+	}`
+)
+
+func newRecordedAPI(t *testing.T, responses map[string]string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestResolvePaperPicksNewestStableBuild(t *testing.T) {
+	api := newRecordedAPI(t, map[string]string{
+		"/projects/paper/versions/1.20.4/builds": recordedPaperBuilds,
+	})
+	defer func(base string) { paperAPIBase = base }(paperAPIBase)
+	paperAPIBase = api.URL
+
+	resolver := &BuildResolver{client: api.Client(), cache: make(map[string]*ResolvedBuild)}
+	build, err := resolver.ResolvePaper("1.20.4")
+	if err != nil {
+		t.Fatalf("ResolvePaper: %v", err)
+	}
+
+	if build.Build != 497 {
+		t.Errorf("build = %d, want 497 (498 is experimental)", build.Build)
+	}
+	want := api.URL + "/projects/paper/versions/1.20.4/builds/497/downloads/paper-1.20.4-497.jar"
+	if build.URL != want {
+		t.Errorf("URL = %s, want %s", build.URL, want)
+	}
+	if strings.Contains(build.URL, "latest") {
+		t.Errorf("URL %s does not name a concrete build", build.URL)
+	}
+	if build.SHA256 != "bb22" {
+		t.Errorf("SHA256 = %q, want bb22", build.SHA256)
+	}
+}
+
+func TestResolvePurpurPicksHighestBuild(t *testing.T) {
+	api := newRecordedAPI(t, map[string]string{
+		"/purpur/1.20.4": recordedPurpurVersion,
+	})
+	defer func(base string) { purpurAPIBase = base }(purpurAPIBase)
+	purpurAPIBase = api.URL
+
+	resolver := &BuildResolver{client: api.Client(), cache: make(map[string]*ResolvedBuild)}
+	build, err := resolver.ResolvePurpur("1.20.4")
+	if err != nil {
+		t.Fatalf("ResolvePurpur: %v", err)
+	}
+
+	if build.Build != 2176 {
+		t.Errorf("build = %d, want 2176", build.Build)
+	}
+	if want := api.URL + "/purpur/1.20.4/2176/download"; build.URL != want {
+		t.Errorf("URL = %s, want %s", build.URL, want)
+	}
+}
+
+func TestResolvePaperWithoutStableBuild(t *testing.T) {
+	api := newRecordedAPI(t, map[string]string{
+		"/projects/paper/versions/1.21/builds": `{"builds": [
+			{"build": 1, "channel": "experimental", "downloads": {"application": {"name": "paper-1.21-1.jar"}}}
+		]}`,
+	})
+	defer func(base string) { paperAPIBase = base }(paperAPIBase)
+	paperAPIBase = api.URL
+
+	resolver := &BuildResolver{client: api.Client(), cache: make(map[string]*ResolvedBuild)}
+	if _, err := resolver.ResolvePaper("1.21"); err == nil {
+		t.Fatal("expected an error when only experimental builds exist")
+	}
+}
+
+func TestResolveCachesBuilds(t *testing.T) {
+	requests := 0
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(recordedPaperBuilds))
+	}))
+	defer api.Close()
+	defer func(base string) { paperAPIBase = base }(paperAPIBase)
+	paperAPIBase = api.URL
+
+	resolver := &BuildResolver{client: api.Client(), cache: make(map[string]*ResolvedBuild)}
+	for i := 0; i < 3; i++ {
+		if _, err := resolver.ResolvePaper("1.20.4"); err != nil {
+			t.Fatalf("ResolvePaper: %v", err)
+		}
+	}
+
+	if requests != 1 {
+		t.Errorf("API was queried %d times, want 1", requests)
+	}
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNoCompatibleJava is returned when no detected Java can run a version
+var ErrNoCompatibleJava = errors.New("no compatible Java installation found")
+
+// JavaInstallation is a Java binary found on this host
+type JavaInstallation struct {
+	Path  string `json:"path"`
+	Major int    `json:"major"`
+}
+
+// javaSearchGlobs are the common install locations scanned for Java
+var javaSearchGlobs = []string{
+	"/usr/lib/jvm/*/bin/java",
+	"/usr/lib64/jvm/*/bin/java",
+	"/usr/java/*/bin/java",
+	"/opt/java/*/bin/java",
+	"/opt/jdk*/bin/java",
+	"/usr/local/java/*/bin/java",
+	"/Library/Java/JavaVirtualMachines/*/Contents/Home/bin/java",
+}
+
+var (
+	javaInstallations []JavaInstallation
+	javaDiscovered    bool
+	javaDiscoveryMu   sync.Mutex
+)
+
+// GetJavaInstallations returns the Java installations on this host, newest
+// first. The scan runs once; refresh forces a new one.
+func GetJavaInstallations(refresh bool) []JavaInstallation {
+	javaDiscoveryMu.Lock()
+	defer javaDiscoveryMu.Unlock()
+
+	if !javaDiscovered || refresh {
+		javaInstallations = discoverJava(javaCandidates())
+		javaDiscovered = true
+	}
+
+	return javaInstallations
+}
+
+// SelectJava picks the Java for a Minecraft version: the oldest installed
+// Java that meets the version's requirement, as newer Java releases drop
+// APIs older servers and mods depend on
+func SelectJava(mcVersion string) (string, error) {
+	return selectJava(GetJavaInstallations(false), mcVersion)
+}
+
+func selectJava(installations []JavaInstallation, mcVersion string) (string, error) {
+	required := requiredJavaVersion(mcVersion)
+
+	var best *JavaInstallation
+	for i := range installations {
+		java := &installations[i]
+		if java.Major < required {
+			continue
+		}
+		if best == nil || java.Major < best.Major {
+			best = java
+		}
+	}
+
+	if best == nil {
+		return "", fmt.Errorf("%w: Minecraft %s needs Java %d or newer", ErrNoCompatibleJava, mcVersion, required)
+	}
+	return best.Path, nil
+}
+
+// requiredJavaVersion returns the minimum Java for a Minecraft version. It
+// follows VersionManager.getJavaVersion in minecraft/versions; versions that
+// are not numbered (e.g. "latest") get the newest requirement.
+func requiredJavaVersion(mcVersion string) int {
+	if mcVersion == "" || mcVersion == "latest" {
+		return 21
+	}
+
+	minor, patch := parseMinecraftVersion(mcVersion)
+
+	switch {
+	case minor > 20 || (minor == 20 && patch >= 5):
+		return 21
+	case minor >= 17:
+		return 17
+	case minor >= 12:
+		return 11
+	default:
+		return 8
+	}
+}
+
+// parseMinecraftVersion returns the minor and patch numbers of a release
+// such as 1.20.4; parts that are not numbers read as 0
+func parseMinecraftVersion(mcVersion string) (minor, patch int) {
+	parts := strings.Split(strings.TrimPrefix(mcVersion, "1."), ".")
+	minor, _ = strconv.Atoi(parts[0])
+	if len(parts) > 1 {
+		patch, _ = strconv.Atoi(parts[1])
+	}
+	return minor, patch
+}
+
+// javaCandidates lists possible Java binaries from JAVA_HOME, PATH,
+// update-alternatives and the common install locations
+func javaCandidates() []string {
+	var candidates []string
+
+	if javaHome := os.Getenv("JAVA_HOME"); javaHome != "" {
+		candidates = append(candidates, filepath.Join(javaHome, "bin", "java"))
+	}
+
+	if path, err := exec.LookPath("java"); err == nil {
+		candidates = append(candidates, path)
+	}
+
+	if output, err := exec.Command("update-alternatives", "--list", "java").Output(); err == nil {
+		for _, line := range strings.Split(string(output), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				candidates = append(candidates, line)
+			}
+		}
+	}
+
+	for _, pattern := range javaSearchGlobs {
+		matches, _ := filepath.Glob(pattern)
+		candidates = append(candidates, matches...)
+	}
+
+	return candidates
+}
+
+// discoverJava probes each candidate, skipping duplicates reached through
+// symlinks and binaries whose version cannot be read
+func discoverJava(candidates []string) []JavaInstallation {
+	seen := make(map[string]bool)
+	installations := []JavaInstallation{}
+
+	for _, candidate := range candidates {
+		resolved, err := filepath.EvalSymlinks(candidate)
+		if err != nil || seen[resolved] {
+			continue
+		}
+		seen[resolved] = true
+
+		major, err := JavaMajorVersion(resolved)
+		if err != nil {
+			continue
+		}
+		installations = append(installations, JavaInstallation{Path: resolved, Major: major})
+	}
+
+	sort.Slice(installations, func(i, j int) bool {
+		if installations[i].Major != installations[j].Major {
+			return installations[i].Major > installations[j].Major
+		}
+		return installations[i].Path < installations[j].Path
+	})
+
+	return installations
+}
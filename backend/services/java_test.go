@@ -0,0 +1,68 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeJavaVersion writes a java stand-in reporting the given -version line
+func fakeJavaVersion(t *testing.T, version string) string {
+	t.Helper()
+	return writeFakeJava(t, "echo '"+version+"' >&2\n")
+}
+
+func TestDiscoverAndSelectJava(t *testing.T) {
+	java8 := fakeJavaVersion(t, `openjdk version "1.8.0_392"`)
+	java17 := fakeJavaVersion(t, `openjdk version "17.0.9" 2023-10-17`)
+	java21 := fakeJavaVersion(t, `openjdk version "21.0.2" 2024-01-16`)
+	broken := writeFakeJava(t, "exit 1\n")
+
+	// The same Java reached through a symlink is only listed once
+	link := filepath.Join(t.TempDir(), "java")
+	if err := os.Symlink(java21, link); err != nil {
+		t.Fatal(err)
+	}
+
+	installations := discoverJava([]string{java17, link, java8, broken, java21, "/nonexistent/bin/java"})
+	if len(installations) != 3 {
+		t.Fatalf("discovered %+v, want Java 21, 17 and 8", installations)
+	}
+	for i, major := range []int{21, 17, 8} {
+		if installations[i].Major != major {
+			t.Errorf("installation %d is Java %d, want %d (newest first)", i, installations[i].Major, major)
+		}
+	}
+
+	tests := map[string]string{
+		"1.8.9":  java8,
+		"1.12.2": java17,
+		"1.18.2": java17,
+		"1.20.4": java17,
+		"1.21":   java21,
+		"1.20.5": java21,
+		"latest": java21,
+	}
+	for mcVersion, want := range tests {
+		got, err := selectJava(installations, mcVersion)
+		if err != nil {
+			t.Errorf("selectJava(%s): %v", mcVersion, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("selectJava(%s) = %s, want %s", mcVersion, got, want)
+		}
+	}
+}
+
+func TestSelectJavaWithoutCompatibleInstall(t *testing.T) {
+	installations := []JavaInstallation{{Path: "/usr/lib/jvm/java-8/bin/java", Major: 8}}
+
+	if _, err := selectJava(installations, "1.21"); !errors.Is(err, ErrNoCompatibleJava) {
+		t.Errorf("Minecraft 1.21 on Java 8 only: err = %v, want ErrNoCompatibleJava", err)
+	}
+	if _, err := selectJava(nil, "1.8.9"); !errors.Is(err, ErrNoCompatibleJava) {
+		t.Errorf("no Java installed: err = %v, want ErrNoCompatibleJava", err)
+	}
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	"playpulse-panel/models"
+)
+
+var (
+	// ErrUnknownJVMPreset is returned for a preset name that does not exist
+	ErrUnknownJVMPreset = errors.New("unknown JVM preset")
+	// ErrJVMPresetUnsupported is returned when the Java version lacks the preset's GC
+	ErrJVMPresetUnsupported = errors.New("JVM preset not supported by this Java version")
+)
+
+// JVMPreset is a named, tuned set of JVM flags. Flags are generated from the
+// server's memory limit so heap and GC tuning scale with it.
+type JVMPreset struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MinJava     int    `json:"min_java"` // lowest Java major version with a production-ready GC
+	flags       func(heapMB int64) []string
+}
+
+var jvmPresets = map[string]JVMPreset{
+	"aikar": {
+		Name:        "aikar",
+		Description: "Aikar's G1GC flags, tuned for Minecraft servers",
+		MinJava:     8,
+		flags:       aikarFlags,
+	},
+	"zgc": {
+		Name:        "zgc",
+		Description: "Z Garbage Collector for very low pause times on large heaps",
+		MinJava:     15,
+		flags: func(heapMB int64) []string {
+			return []string{
+				"-XX:+UseZGC",
+				"-XX:+AlwaysPreTouch",
+				"-XX:+DisableExplicitGC",
+				"-XX:+PerfDisableSharedMem",
+			}
+		},
+	},
+	"shenandoah": {
+		Name:        "shenandoah",
+		Description: "Shenandoah GC for low pause times with moderate heaps",
+		MinJava:     15,
+		flags: func(heapMB int64) []string {
+			return []string{
+				"-XX:+UseShenandoahGC",
+				"-XX:+AlwaysPreTouch",
+				"-XX:+DisableExplicitGC",
+				"-XX:+PerfDisableSharedMem",
+			}
+		},
+	},
+}
+
+// aikarFlags returns Aikar's flags. Above 12GB of heap the young generation
+// and G1 region size are raised as the flags recommend.
+func aikarFlags(heapMB int64) []string {
+	newSize, maxNewSize, regionSize, reserve, occupancy := 30, 40, "8M", 20, 15
+	if heapMB > 12*1024 {
+		newSize, maxNewSize, regionSize, reserve, occupancy = 40, 50, "16M", 15, 20
+	}
+
+	return []string{
+		"-XX:+UseG1GC",
+		"-XX:+ParallelRefProcEnabled",
+		"-XX:MaxGCPauseMillis=200",
+		"-XX:+UnlockExperimentalVMOptions",
+		"-XX:+DisableExplicitGC",
+		"-XX:+AlwaysPreTouch",
+		fmt.Sprintf("-XX:G1NewSizePercent=%d", newSize),
+		fmt.Sprintf("-XX:G1MaxNewSizePercent=%d", maxNewSize),
+		"-XX:G1HeapRegionSize=" + regionSize,
+		fmt.Sprintf("-XX:G1ReservePercent=%d", reserve),
+		"-XX:G1HeapWastePercent=5",
+		"-XX:G1MixedGCCountTarget=4",
+		fmt.Sprintf("-XX:InitiatingHeapOccupancyPercent=%d", occupancy),
+		"-XX:G1MixedGCLiveThresholdPercent=90",
+		"-XX:G1RSetUpdatingPauseTimePercent=5",
+		"-XX:SurvivorRatio=32",
+		"-XX:+PerfDisableSharedMem",
+		"-XX:MaxTenuringThreshold=1",
+		"-Dusing.aikars.flags=https://mcflags.emc.gs",
+		"-Daikars.new.flags=true",
+	}
+}
+
+// GetJVMPresets returns all presets sorted by name
+func GetJVMPresets() []JVMPreset {
+	presets := make([]JVMPreset, 0, len(jvmPresets))
+	for _, preset := range jvmPresets {
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	return presets
+}
+
+// ValidateJVMPreset checks the preset exists and that the Java the server
+// runs on supports its GC. A Java version that cannot be detected is not
+// rejected here; starting the server reports the real problem.
+func ValidateJVMPreset(name string, server *models.Server) error {
+	if name == "" {
+		return nil
+	}
+
+	javaMajor, _ := serverJavaMajorVersion(server)
+	_, err := ExpandJVMPreset(name, 1024, javaMajor)
+	return err
+}
+
+// serverJavaMajorVersion returns the major version of the Java a server runs
+// on: its image's when servers run in containers, otherwise its JavaPath's
+func serverJavaMajorVersion(server *models.Server) (int, error) {
+	if runsInContainers() {
+		return imageJavaMajorVersion(serverImage(server))
+	}
+	return JavaMajorVersion(server.JavaPath)
+}
+
+// ExpandJVMPreset turns a preset into concrete JVM arguments for a server
+// with memoryMB of memory. javaMajor of 0 skips the Java version check.
+func ExpandJVMPreset(name string, memoryMB int64, javaMajor int) ([]string, error) {
+	preset, ok := jvmPresets[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJVMPreset, name)
+	}
+
+	if javaMajor > 0 && javaMajor < preset.MinJava {
+		return nil, fmt.Errorf("%w: %s needs Java %d or newer, found Java %d", ErrJVMPresetUnsupported, name, preset.MinJava, javaMajor)
+	}
+
+	heapMB := presetHeapSize(memoryMB)
+	args := []string{
+		fmt.Sprintf("-Xms%dM", heapMB),
+		fmt.Sprintf("-Xmx%dM", heapMB),
+	}
+	return append(args, preset.flags(heapMB)...), nil
+}
+
+// presetHeapSize leaves 15% of the memory limit for off-heap JVM memory.
+// Heap is pinned (Xms = Xmx) as the tuned presets expect.
+func presetHeapSize(memoryMB int64) int64 {
+	heapMB := memoryMB * 85 / 100
+	if heapMB < 512 {
+		heapMB = 512
+	}
+	return heapMB
+}
+
+var (
+	javaVersionPattern = regexp.MustCompile(`version "(\d+)(?:\.(\d+))?`)
+	javaVersionCache   = make(map[string]int)
+	javaVersionMutex   sync.Mutex
+)
+
+// JavaMajorVersion runs "java -version" for javaPath and returns the major
+// version, mapping the legacy "1.8" scheme to 8
+func JavaMajorVersion(javaPath string) (int, error) {
+	return cachedJavaVersion(javaPath, func() (int, error) {
+		// java -version writes to stderr
+		output, err := exec.Command(javaPath, "-version").CombinedOutput()
+		if err != nil {
+			return 0, fmt.Errorf("failed to run %s: %v", javaPath, err)
+		}
+		return parseJavaVersion(string(output))
+	})
+}
+
+// cachedJavaVersion returns the cached version for key, running detect to
+// find it on a miss. The lock is not held while detect runs java, so a slow
+// JVM start doesn't hold up other lookups; concurrent misses may both run it.
+func cachedJavaVersion(key string, detect func() (int, error)) (int, error) {
+	javaVersionMutex.Lock()
+	version, ok := javaVersionCache[key]
+	javaVersionMutex.Unlock()
+	if ok {
+		return version, nil
+	}
+
+	version, err := detect()
+	if err != nil {
+		return 0, err
+	}
+
+	javaVersionMutex.Lock()
+	javaVersionCache[key] = version
+	javaVersionMutex.Unlock()
+	return version, nil
+}
+
+func parseJavaVersion(output string) (int, error) {
+	match := javaVersionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return 0, fmt.Errorf("unrecognised java -version output")
+	}
+
+	major, _ := strconv.Atoi(match[1])
+	if major == 1 && match[2] != "" {
+		major, _ = strconv.Atoi(match[2])
+	}
+	return major, nil
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"playpulse-panel/models"
+)
+
+// flagValue returns the value of the -XX:name=value flag in args
+func flagValue(args []string, name string) string {
+	prefix := "-XX:" + name + "="
+	for _, arg := range args {
+		if strings.HasPrefix(arg, prefix) {
+			return strings.TrimPrefix(arg, prefix)
+		}
+	}
+	return ""
+}
+
+func TestAikarPresetScalesWithMemory(t *testing.T) {
+	tests := []struct {
+		memoryMB   int64
+		heap       string
+		regionSize string
+		newSize    string
+		maxNewSize string
+	}{
+		{memoryMB: 4096, heap: "3481M", regionSize: "8M", newSize: "30", maxNewSize: "40"},
+		{memoryMB: 14458, heap: "12289M", regionSize: "16M", newSize: "40", maxNewSize: "50"},
+		{memoryMB: 32768, heap: "27852M", regionSize: "16M", newSize: "40", maxNewSize: "50"},
+		// Tiny limits still get a usable heap
+		{memoryMB: 256, heap: "512M", regionSize: "8M", newSize: "30", maxNewSize: "40"},
+	}
+
+	for _, tt := range tests {
+		args, err := ExpandJVMPreset("aikar", tt.memoryMB, 17)
+		if err != nil {
+			t.Fatalf("ExpandJVMPreset(aikar, %d): %v", tt.memoryMB, err)
+		}
+		if args[0] != "-Xms"+tt.heap || args[1] != "-Xmx"+tt.heap {
+			t.Errorf("%dMB: heap flags %v, want pinned at %s", tt.memoryMB, args[:2], tt.heap)
+		}
+		if got := flagValue(args, "G1HeapRegionSize"); got != tt.regionSize {
+			t.Errorf("%dMB: G1HeapRegionSize = %s, want %s", tt.memoryMB, got, tt.regionSize)
+		}
+		if got := flagValue(args, "G1NewSizePercent"); got != tt.newSize {
+			t.Errorf("%dMB: G1NewSizePercent = %s, want %s", tt.memoryMB, got, tt.newSize)
+		}
+		if got := flagValue(args, "G1MaxNewSizePercent"); got != tt.maxNewSize {
+			t.Errorf("%dMB: G1MaxNewSizePercent = %s, want %s", tt.memoryMB, got, tt.maxNewSize)
+		}
+	}
+}
+
+func TestExpandJVMPresetChecksJavaVersion(t *testing.T) {
+	for _, name := range []string{"zgc", "shenandoah"} {
+		if _, err := ExpandJVMPreset(name, 4096, 11); !errors.Is(err, ErrJVMPresetUnsupported) {
+			t.Errorf("%s on Java 11: err = %v, want ErrJVMPresetUnsupported", name, err)
+		}
+		if _, err := ExpandJVMPreset(name, 4096, 17); err != nil {
+			t.Errorf("%s on Java 17: %v", name, err)
+		}
+		// An undetected version is left for the server start to report
+		if _, err := ExpandJVMPreset(name, 4096, 0); err != nil {
+			t.Errorf("%s with an unknown Java version: %v", name, err)
+		}
+	}
+
+	if _, err := ExpandJVMPreset("aikar", 4096, 8); err != nil {
+		t.Errorf("aikar on Java 8: %v", err)
+	}
+	if _, err := ExpandJVMPreset("cms", 4096, 17); !errors.Is(err, ErrUnknownJVMPreset) {
+		t.Errorf("unknown preset: err = %v, want ErrUnknownJVMPreset", err)
+	}
+}
+
+func TestValidateJVMPresetRejectsOldJava(t *testing.T) {
+	java8 := writeFakeJava(t, `echo 'openjdk version "1.8.0_392"' >&2`)
+	server := &models.Server{JavaPath: java8}
+
+	if err := ValidateJVMPreset("zgc", server); !errors.Is(err, ErrJVMPresetUnsupported) {
+		t.Errorf("zgc on Java 8: err = %v, want ErrJVMPresetUnsupported", err)
+	}
+	if err := ValidateJVMPreset("aikar", server); err != nil {
+		t.Errorf("aikar on Java 8: %v", err)
+	}
+
+	java21 := writeFakeJava(t, `echo 'openjdk version "21.0.2" 2024-01-16' >&2`)
+	if err := ValidateJVMPreset("zgc", &models.Server{JavaPath: java21}); err != nil {
+		t.Errorf("zgc on Java 21: %v", err)
+	}
+}
+
+func TestParseJavaVersion(t *testing.T) {
+	tests := map[string]int{
+		`java version "1.8.0_392"`:                8,
+		`openjdk version "11.0.21" 2023-10-17`:    11,
+		`openjdk version "17" 2021-09-14`:         17,
+		`openjdk version "21.0.2" 2024-01-16 LTS`: 21,
+	}
+	for output, want := range tests {
+		if got, err := parseJavaVersion(output); err != nil || got != want {
+			t.Errorf("parseJavaVersion(%q) = %d, %v, want %d", output, got, err, want)
+		}
+	}
+	if _, err := parseJavaVersion("command not found"); err == nil {
+		t.Error("parseJavaVersion accepted output without a version")
+	}
+}
@@ -0,0 +1,381 @@
+package services
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"playpulse-panel/models"
+)
+
+const (
+	// defaultLogSearchLimit and maxLogSearchLimit bound the matches a
+	// search returns
+	defaultLogSearchLimit = 200
+	maxLogSearchLimit     = 2000
+	// maxLogLineLength is the longest line searched; longer lines are cut
+	maxLogLineLength = 1 << 20
+	// maxLogQueryLength bounds search terms and patterns
+	maxLogQueryLength = 256
+)
+
+// ErrInvalidLogQuery is returned for an empty, overlong or invalid search
+var ErrInvalidLogQuery = errors.New("invalid log search")
+
+// LogSearchOptions is a search of a server's logs. Query is matched case
+// insensitively, as a substring or, with Regex, as a regular expression.
+// Lines written before Since are left out.
+type LogSearchOptions struct {
+	Query string
+	Regex bool
+	Since time.Time
+	Limit int
+}
+
+// LogMatch is a log line matching a search
+type LogMatch struct {
+	File string `json:"file"` // relative to the server directory
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// LogSearchResult holds the most recent matches of a search, oldest first.
+// Truncated is set when older matches were left out to stay within the
+// limit.
+type LogSearchResult struct {
+	Matches       []LogMatch `json:"matches"`
+	Truncated     bool       `json:"truncated"`
+	FilesSearched int        `json:"files_searched"`
+}
+
+// logFile is a log of a server, current or rotated
+type logFile struct {
+	path     string
+	name     string // relative to the server directory
+	modified time.Time
+}
+
+// serverLogFiles returns a server's log files, oldest first: the rotated
+// and current logs in logs/, gzipped or not, and the panel's console.log.
+// Only regular files inside the server directory are returned; symlinks
+// could point a search or an archive at any file the panel can read.
+func serverLogFiles(server *models.Server) ([]logFile, error) {
+	var files []logFile
+
+	add := func(path string) {
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			return
+		}
+		if err := ensureWithin(server.Path, path); err != nil {
+			return
+		}
+		name, err := filepath.Rel(server.Path, path)
+		if err != nil {
+			return
+		}
+		files = append(files, logFile{path: path, name: filepath.ToSlash(name), modified: info.ModTime()})
+	}
+
+	entries, err := os.ReadDir(filepath.Join(server.Path, "logs"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, ".log") || strings.HasSuffix(name, ".log.gz") {
+			add(filepath.Join(server.Path, "logs", name))
+		}
+	}
+	add(filepath.Join(server.Path, "console.log"))
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].modified.Before(files[j].modified)
+	})
+	return files, nil
+}
+
+// SearchServerLogs searches a server's current and rotated logs, returning
+// up to the limit of the most recent matching lines
+func SearchServerLogs(server *models.Server, opts LogSearchOptions) (*LogSearchResult, error) {
+	match, err := logMatcher(opts.Query, opts.Regex)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultLogSearchLimit
+	}
+	if limit > maxLogSearchLimit {
+		limit = maxLogSearchLimit
+	}
+
+	files, err := serverLogFiles(server)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &LogSearchResult{Matches: []LogMatch{}}
+	for _, file := range files {
+		// Nothing in a file last written before since is recent enough
+		if !opts.Since.IsZero() && file.modified.Before(opts.Since) {
+			continue
+		}
+		result.FilesSearched++
+
+		// Matches are kept with when they were written until the whole
+		// file is read, which is when the dates of its lines are known.
+		// Lines are in order, so those before since are always the first.
+		clock := &logClock{modified: file.modified}
+		var matches []timedMatch
+		var dropped *timedMatch
+		err := scanLogFile(file.path, func(number int, line string) {
+			text := ParseConsoleLine(line).Text
+			clock.observe(text)
+			if !match(text) {
+				return
+			}
+			matches = append(matches, timedMatch{LogMatch{File: file.name, Line: number, Text: text}, clock.mark()})
+			if len(matches) > limit {
+				first := matches[0]
+				dropped = &first
+				matches = matches[1:]
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to search %s: %v", file.name, err)
+		}
+
+		if dropped != nil && !clock.time(dropped.mark).Before(opts.Since) {
+			result.Truncated = true
+		}
+		for _, m := range matches {
+			if opts.Since.IsZero() || !clock.time(m.mark).Before(opts.Since) {
+				result.Matches = append(result.Matches, m.LogMatch)
+			}
+		}
+		if len(result.Matches) > limit {
+			result.Matches = result.Matches[len(result.Matches)-limit:]
+			result.Truncated = true
+		}
+	}
+
+	return result, nil
+}
+
+var (
+	// consoleLogTime is the date and time the panel writes before each
+	// line of console.log
+	consoleLogTime = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})\]`)
+	// serverLogTime is the time of day servers write before each line of
+	// their own logs, as [12:34:56] or [12:34:56 INFO]
+	serverLogTime = regexp.MustCompile(`^\[(\d{2}:\d{2}:\d{2})[\] ]`)
+)
+
+// timedMatch is a match with when its line was written
+type timedMatch struct {
+	LogMatch
+	mark logMark
+}
+
+// logMark is when a line was written, as far as known while reading
+type logMark struct {
+	dated     time.Time     // from a line with a full date
+	timeOfDay time.Duration // from a line with only the time of day
+	rollovers int           // days the log had passed at the line
+	known     bool
+}
+
+// logClock works out when the lines of a log file were written. Lines of
+// console.log carry their date. Servers' own logs only carry the time of
+// day, so lines are dated counting back from the day the file was last
+// written, one day for each time the time of day goes backwards. Lines
+// without a time take that of the line before them.
+type logClock struct {
+	modified  time.Time
+	current   logMark
+	rollovers int
+}
+
+func (c *logClock) observe(line string) {
+	if match := consoleLogTime.FindStringSubmatch(line); match != nil {
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05", match[1], time.Local); err == nil {
+			c.current = logMark{dated: t, known: true}
+		}
+		return
+	}
+
+	match := serverLogTime.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	t, err := time.Parse("15:04:05", match[1])
+	if err != nil {
+		return
+	}
+	timeOfDay := t.Sub(time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	// Going back more than a few hours is the next day rather than the
+	// clock being turned back
+	if c.current.known && c.current.dated.IsZero() && timeOfDay < c.current.timeOfDay-12*time.Hour {
+		c.rollovers++
+	}
+	c.current = logMark{timeOfDay: timeOfDay, rollovers: c.rollovers, known: true}
+}
+
+// mark returns when the last observed line was written
+func (c *logClock) mark() logMark {
+	return c.current
+}
+
+// time resolves a mark once the whole file was observed. Lines before the
+// first with a time are taken as written at the zero time.
+func (c *logClock) time(mark logMark) time.Time {
+	switch {
+	case !mark.known:
+		return time.Time{}
+	case !mark.dated.IsZero():
+		return mark.dated
+	}
+	year, month, day := c.modified.In(time.Local).Date()
+	return time.Date(year, month, day-(c.rollovers-mark.rollovers), 0, 0, 0, 0, time.Local).Add(mark.timeOfDay)
+}
+
+// logMatcher returns a case insensitive matcher for a search
+func logMatcher(query string, isRegex bool) (func(string) bool, error) {
+	if query == "" || len(query) > maxLogQueryLength {
+		return nil, fmt.Errorf("%w: the query must be 1 to %d characters", ErrInvalidLogQuery, maxLogQueryLength)
+	}
+
+	if isRegex {
+		pattern, err := regexp.Compile("(?i)" + query)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidLogQuery, err)
+		}
+		return pattern.MatchString, nil
+	}
+
+	query = strings.ToLower(query)
+	return func(line string) bool {
+		return strings.Contains(strings.ToLower(line), query)
+	}, nil
+}
+
+// scanLogFile calls fn with each line of a log file and its number,
+// decompressing gzipped logs
+func scanLogFile(path string, fn func(number int, line string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	buffered := bufio.NewReaderSize(reader, 64*1024)
+	for number := 1; ; number++ {
+		line, err := readLogLine(buffered)
+		if line != "" || err == nil {
+			fn(number, line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readLogLine reads a line without its line ending, discarding whatever
+// goes past maxLogLineLength
+func readLogLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if len(line) < maxLogLineLength {
+			line = append(line, chunk...)
+		}
+		if err != nil {
+			return string(line), err
+		}
+		if !isPrefix {
+			break
+		}
+	}
+	if len(line) > maxLogLineLength {
+		line = line[:maxLogLineLength]
+	}
+	return string(line), nil
+}
+
+// WriteServerLogArchive writes a gzipped tar archive of a server's log
+// files to w, rotated logs included as they are on disk
+func WriteServerLogArchive(server *models.Server, w io.Writer) error {
+	files, err := serverLogFiles(server)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+
+	for _, file := range files {
+		if err := addLogToArchive(archive, file); err != nil {
+			archive.Close()
+			gz.Close()
+			return fmt.Errorf("failed to archive %s: %v", file.name, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
+}
+
+func addLogToArchive(archive *tar.Writer, file logFile) error {
+	source, err := os.Open(file.path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := archive.WriteHeader(&tar.Header{
+		Name:    file.name,
+		Mode:    0644,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}); err != nil {
+		return err
+	}
+
+	// The current log may grow while it is copied; only the size in the
+	// header is written
+	_, err = io.CopyN(archive, source, info.Size())
+	return err
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"playpulse-panel/models"
+)
+
+// serverLog is a log file of a test server and when it was last written
+type serverLog struct {
+	name     string
+	content  string
+	modified time.Time
+}
+
+// writeServerLogs writes log files into a new server directory, gzipping
+// those named .gz, and returns the server
+func writeServerLogs(t *testing.T, logs ...serverLog) *models.Server {
+	t.Helper()
+
+	server := &models.Server{Name: "logs", Path: t.TempDir()}
+	for _, l := range logs {
+		path := filepath.Join(server.Path, l.name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		data := []byte(l.content)
+		if filepath.Ext(l.name) == ".gz" {
+			var compressed bytes.Buffer
+			gz := gzip.NewWriter(&compressed)
+			gz.Write(data)
+			gz.Close()
+			data = compressed.Bytes()
+		}
+		writeLog(t, path, string(data))
+		if err := os.Chtimes(path, l.modified, l.modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return server
+}
+
+// rotatedServerLogs is a server with a gzipped rotated log, the current log
+// and the panel's console log, last written an hour apart
+func rotatedServerLogs(t *testing.T) *models.Server {
+	t.Helper()
+
+	day := time.Date(2024, 3, 2, 0, 0, 0, 0, time.Local)
+	return writeServerLogs(t,
+		serverLog{"logs/2024-03-01-1.log.gz", "[20:00:00 INFO]: Steve joined the game\n[20:05:00 INFO]: Steve lost connection\n[21:00:00 INFO]: Steve left the game\n", day.Add(-3 * time.Hour)},
+		serverLog{"logs/latest.log", "[09:00:00 INFO]: Starting minecraft server\n[09:10:00 INFO]: Alex JOINED the game\n", day.Add(10 * time.Hour)},
+		serverLog{"logs/notes.txt", "Alex joined the game\n", day.Add(11 * time.Hour)},
+		serverLog{"console.log", "[2024-03-02 11:00:00] \x1b[32mAlex left the game\x1b[0m\n", day.Add(11 * time.Hour)},
+	)
+}
+
+func TestSearchServerLogsRegexAcrossFiles(t *testing.T) {
+	server := rotatedServerLogs(t)
+
+	result, err := SearchServerLogs(server, LogSearchOptions{Query: `(joined|left) the game`, Regex: true})
+	if err != nil {
+		t.Fatalf("SearchServerLogs: %v", err)
+	}
+
+	// Matches come oldest first, from the gzipped rotated log through to
+	// the console log, case insensitively and with colors stripped. Files
+	// that aren't logs are left out.
+	want := []LogMatch{
+		{File: "logs/2024-03-01-1.log.gz", Line: 1, Text: "[20:00:00 INFO]: Steve joined the game"},
+		{File: "logs/2024-03-01-1.log.gz", Line: 3, Text: "[21:00:00 INFO]: Steve left the game"},
+		{File: "logs/latest.log", Line: 2, Text: "[09:10:00 INFO]: Alex JOINED the game"},
+		{File: "console.log", Line: 1, Text: "[2024-03-02 11:00:00] Alex left the game"},
+	}
+	if !reflect.DeepEqual(result.Matches, want) {
+		t.Errorf("matches = %+v, want %+v", result.Matches, want)
+	}
+	if result.FilesSearched != 3 || result.Truncated {
+		t.Errorf("searched %d files, truncated %v, want 3 and not truncated", result.FilesSearched, result.Truncated)
+	}
+
+	// The same query as text only finds the words in that order
+	result, err = SearchServerLogs(server, LogSearchOptions{Query: "left the game"})
+	if err != nil || len(result.Matches) != 2 {
+		t.Errorf("text search = %+v, %v, want the 2 left the game lines", result, err)
+	}
+}
+
+func TestSearchServerLogsLimitAndSince(t *testing.T) {
+	server := rotatedServerLogs(t)
+
+	// The most recent matches are kept
+	result, err := SearchServerLogs(server, LogSearchOptions{Query: "the game", Limit: 2})
+	if err != nil {
+		t.Fatalf("SearchServerLogs: %v", err)
+	}
+	if len(result.Matches) != 2 || result.Matches[0].File != "logs/latest.log" || result.Matches[1].File != "console.log" || !result.Truncated {
+		t.Errorf("limited search = %+v, want the 2 newest matches and truncated", result)
+	}
+
+	// Lines of the rotated log are dated from the day before it was last
+	// written, and the rotated log isn't opened at all
+	since := time.Date(2024, 3, 2, 9, 5, 0, 0, time.Local)
+	result, err = SearchServerLogs(server, LogSearchOptions{Query: "the game", Since: since})
+	if err != nil {
+		t.Fatalf("SearchServerLogs: %v", err)
+	}
+	if len(result.Matches) != 2 || result.FilesSearched != 2 || result.Truncated {
+		t.Errorf("search since %s = %+v, want the 2 later matches from 2 files", since, result)
+	}
+
+	since = time.Date(2024, 3, 2, 10, 30, 0, 0, time.Local)
+	result, _ = SearchServerLogs(server, LogSearchOptions{Query: "the game", Since: since})
+	if len(result.Matches) != 1 || result.Matches[0].File != "console.log" {
+		t.Errorf("search since %s = %+v, want only the console log's dated line", since, result)
+	}
+}
+
+func TestSearchServerLogsRejectsInvalidQuery(t *testing.T) {
+	server := rotatedServerLogs(t)
+
+	for _, opts := range []LogSearchOptions{
+		{Query: ""},
+		{Query: "(unclosed", Regex: true},
+		{Query: string(bytes.Repeat([]byte("a"), maxLogQueryLength+1))},
+	} {
+		if _, err := SearchServerLogs(server, opts); !errors.Is(err, ErrInvalidLogQuery) {
+			t.Errorf("SearchServerLogs(%q) = %v, want ErrInvalidLogQuery", opts.Query, err)
+		}
+	}
+}
+
+func TestServerLogFilesSkipsSymlinks(t *testing.T) {
+	server := rotatedServerLogs(t)
+	secret := filepath.Join(t.TempDir(), "secret.log")
+	writeLog(t, secret, "the game password is hunter2\n")
+	if err := os.Symlink(secret, filepath.Join(server.Path, "logs", "linked.log")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	result, err := SearchServerLogs(server, LogSearchOptions{Query: "password"})
+	if err != nil || len(result.Matches) != 0 {
+		t.Errorf("search = %+v, %v, want nothing from the linked file", result, err)
+	}
+}
+
+func TestWriteServerLogArchive(t *testing.T) {
+	server := rotatedServerLogs(t)
+
+	var archive bytes.Buffer
+	if err := WriteServerLogArchive(server, &archive); err != nil {
+		t.Fatalf("WriteServerLogArchive: %v", err)
+	}
+
+	files := readLogArchive(t, &archive)
+	if len(files) != 3 {
+		t.Errorf("archive holds %v, want the 3 log files", files)
+	}
+	for _, name := range []string{"logs/2024-03-01-1.log.gz", "logs/latest.log", "console.log"} {
+		onDisk, _ := os.ReadFile(filepath.Join(server.Path, name))
+		if !bytes.Equal(files[name], onDisk) {
+			t.Errorf("archived %s differs from the file on disk", name)
+		}
+	}
+}
+
+// readLogArchive reads a gzipped tar archive into its files by name
+func readLogArchive(t *testing.T, r io.Reader) map[string][]byte {
+	t.Helper()
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatalf("archive is not gzipped: %v", err)
+	}
+	reader := tar.NewReader(gz)
+	files := make(map[string][]byte)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatalf("archive is not a valid tar: %v", err)
+		}
+		files[header.Name], _ = io.ReadAll(reader)
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// Only the tail of console.log is scanned, it is appended to across restarts
+const consoleLogScanBytes = 1024 * 1024
+
+// logPatterns describes how a server type reports startup and player
+// connections in its console output
+type logPatterns struct {
+	started *regexp.Regexp
+	join    *regexp.Regexp
+	leave   *regexp.Regexp
+
+	// Reply to save-all, nil when the server type has no such command
+	saved *regexp.Regexp
+}
+
+var (
+	javaLogPatterns = logPatterns{
+		started: regexp.MustCompile(`Done \([0-9.,]+s\)!`),
+		join:    regexp.MustCompile(`: (\w{1,16}) joined the game`),
+		leave:   regexp.MustCompile(`: (\w{1,16}) left the game`),
+		saved:   regexp.MustCompile(`Saved the (game|world)`),
+	}
+
+	// Velocity prints the Done line of Java servers; BungeeCord and
+	// Waterfall only that they are listening. Proxies have no world to save.
+	proxyLogPatterns = logPatterns{
+		started: regexp.MustCompile(`Done \([0-9.,]+s\)!|Listening on /`),
+		join:    javaLogPatterns.join,
+		leave:   javaLogPatterns.leave,
+	}
+
+	// e.g. [2024-01-01 12:00:00:000 INFO] Player connected: Steve, xuid: 2535400000000000
+	bedrockLogPatterns = logPatterns{
+		started: regexp.MustCompile(`Server started\.`),
+		join:    regexp.MustCompile(`Player connected: ([^,]+), xuid`),
+		leave:   regexp.MustCompile(`Player disconnected: ([^,]+), xuid`),
+	}
+)
+
+func patternsFor(serverType models.ServerType) logPatterns {
+	switch serverType {
+	case models.ServerTypeBedrock:
+		return bedrockLogPatterns
+	case models.ServerTypeProxy:
+		return proxyLogPatterns
+	}
+	return javaLogPatterns
+}
+
+// countOnlinePlayers replays join and leave messages since the last server
+// start to work out how many players are connected
+func countOnlinePlayers(server *models.Server) int {
+	return len(playersFromConsoleLog(server))
+}
+
+// playersFromConsoleLog returns the players connected according to the tail
+// of the server's console.log
+func playersFromConsoleLog(server *models.Server) map[string]bool {
+	file, err := os.Open(filepath.Join(server.Path, "console.log"))
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil && info.Size() > consoleLogScanBytes {
+		file.Seek(-consoleLogScanBytes, io.SeekEnd)
+	}
+
+	return playersInLog(file, patternsFor(server.Type))
+}
+
+// playersInLog returns the players still connected at the end of the log
+func playersInLog(r io.Reader, patterns logPatterns) map[string]bool {
+	online := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if patterns.started.MatchString(line) {
+			online = make(map[string]bool)
+			continue
+		}
+		if match := patterns.join.FindStringSubmatch(line); match != nil {
+			online[strings.TrimSpace(match[1])] = true
+			continue
+		}
+		if match := patterns.leave.FindStringSubmatch(line); match != nil {
+			delete(online, strings.TrimSpace(match[1]))
+		}
+	}
+
+	return online
+}
+
+// logWatcher waits for a console line matching a pattern
+type logWatcher struct {
+	serverID uuid.UUID
+	pattern  *regexp.Regexp
+	matched  chan struct{}
+	once     sync.Once
+
+	// The first matching line, set before matched is closed
+	line string
+}
+
+var (
+	logWatchers      = make(map[uuid.UUID][]*logWatcher)
+	logWatchersMutex sync.Mutex
+)
+
+// watchServerLog registers a watcher whose matched channel is closed when the
+// server prints a matching line. Close must be called when done.
+func watchServerLog(serverID uuid.UUID, pattern *regexp.Regexp) *logWatcher {
+	watcher := &logWatcher{
+		serverID: serverID,
+		pattern:  pattern,
+		matched:  make(chan struct{}),
+	}
+
+	logWatchersMutex.Lock()
+	logWatchers[serverID] = append(logWatchers[serverID], watcher)
+	logWatchersMutex.Unlock()
+
+	return watcher
+}
+
+// Close unregisters the watcher
+func (w *logWatcher) Close() {
+	logWatchersMutex.Lock()
+	defer logWatchersMutex.Unlock()
+
+	watchers := logWatchers[w.serverID]
+	for i, watcher := range watchers {
+		if watcher == w {
+			logWatchers[w.serverID] = append(watchers[:i], watchers[i+1:]...)
+			break
+		}
+	}
+	if len(logWatchers[w.serverID]) == 0 {
+		delete(logWatchers, w.serverID)
+	}
+}
+
+// publishServerLogLine hands a console line to the server's watchers
+func publishServerLogLine(serverID uuid.UUID, line string) {
+	logWatchersMutex.Lock()
+	defer logWatchersMutex.Unlock()
+
+	for _, watcher := range logWatchers[serverID] {
+		if watcher.pattern.MatchString(line) {
+			watcher.once.Do(func() {
+				watcher.line = line
+				close(watcher.matched)
+			})
+		}
+	}
+}
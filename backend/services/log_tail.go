@@ -0,0 +1,266 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"playpulse-panel/models"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/uuid"
+)
+
+const (
+	tailChunkSize       = 64 * 1024
+	maxTailBackfill     = 5000
+	defaultTailBackfill = 100
+)
+
+// serverLogPath returns the log file the server writes its console to
+func serverLogPath(server *models.Server) string {
+	if server.Type == models.ServerTypeBedrock {
+		// Bedrock only logs to stdout, which is captured in console.log
+		return filepath.Join(server.Path, "console.log")
+	}
+	return filepath.Join(server.Path, "logs", "latest.log")
+}
+
+// TailFile returns the last n lines of a file. It reads backwards from the end
+// in chunks, so only the tail of large files is loaded.
+func TailFile(path string, n int) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	lines, _, err := tailReader(file, info.Size(), n)
+	return lines, err
+}
+
+// tailReader returns the last n lines of the first size bytes of r and
+// whether the last line is terminated by a newline
+func tailReader(r io.ReaderAt, size int64, n int) ([]string, bool, error) {
+	// Ignore a trailing newline so it doesn't count as an empty last line
+	end := size
+	if size > 0 {
+		last := make([]byte, 1)
+		if _, err := r.ReadAt(last, size-1); err == nil && last[0] == '\n' {
+			end--
+		}
+	}
+
+	terminated := end < size || size == 0
+	if n <= 0 || end == 0 {
+		return []string{}, terminated, nil
+	}
+
+	// Read backwards until the data holds n line breaks or the whole file
+	var data []byte
+	offset := end
+	for offset > 0 && bytes.Count(data, []byte{'\n'}) < n {
+		chunk := int64(tailChunkSize)
+		if offset < chunk {
+			chunk = offset
+		}
+		offset -= chunk
+
+		buf := make([]byte, chunk)
+		if _, err := r.ReadAt(buf, offset); err != nil && err != io.EOF {
+			return nil, terminated, err
+		}
+		data = append(buf, data...)
+	}
+
+	lines := strings.Split(string(data), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+
+	return lines, terminated, nil
+}
+
+// logFollower streams lines appended to a log file. It survives truncation
+// and the file being replaced (e.g. latest.log rotated on server start).
+type logFollower struct {
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	partial string
+
+	// The line at offset was already sent unterminated, drop its remainder
+	midLine bool
+}
+
+func newLogFollower(path string, offset int64, midLine bool) *logFollower {
+	return &logFollower{path: path, offset: offset, midLine: midLine}
+}
+
+// read returns complete lines appended since the last call
+func (f *logFollower) read() ([]string, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Rotated away and not yet recreated
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// Reopen when the file was replaced
+	if f.file == nil || !os.SameFile(f.info, info) {
+		if f.file != nil {
+			f.file.Close()
+			f.offset = 0
+			f.partial = ""
+			f.midLine = false
+		}
+		file, err := os.Open(f.path)
+		if err != nil {
+			return nil, err
+		}
+		f.file = file
+	}
+	f.info = info
+
+	// Start over when the file was truncated
+	if info.Size() < f.offset {
+		f.offset = 0
+		f.partial = ""
+		f.midLine = false
+	}
+	if info.Size() == f.offset {
+		return nil, nil
+	}
+
+	buf := make([]byte, info.Size()-f.offset)
+	read, err := f.file.ReadAt(buf, f.offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	f.offset += int64(read)
+
+	text := f.partial + string(buf[:read])
+	lines := strings.Split(text, "\n")
+
+	// Keep an unterminated last line until it is complete
+	f.partial = lines[len(lines)-1]
+	lines = lines[:len(lines)-1]
+
+	if f.midLine && len(lines) > 0 {
+		lines = lines[1:]
+		f.midLine = false
+	}
+
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines, nil
+}
+
+func (f *logFollower) close() {
+	if f.file != nil {
+		f.file.Close()
+	}
+}
+
+// followServerLog sends the last backfill lines of a server's log to the
+// connection and then streams new lines until ctx is cancelled
+func followServerLog(ctx context.Context, c *wsClient, server *models.Server, backfill int) {
+	path := serverLogPath(server)
+
+	var offset int64
+	terminated := true
+	if file, err := os.Open(path); err == nil {
+		if info, err := file.Stat(); err == nil {
+			var lines []string
+			lines, terminated, _ = tailReader(file, info.Size(), backfill)
+			offset = info.Size()
+			sendTailLines(c, server.ID, lines, true)
+		}
+		file.Close()
+	}
+
+	follower := newLogFollower(path, offset, !terminated)
+	defer follower.close()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("Failed to watch the log of server %s: %v", server.Name, err)
+		return
+	}
+	defer watcher.Close()
+
+	// Watch the directory rather than the file so rotation and recreation
+	// are seen. logs/ only exists after the first start, so until then the
+	// server directory is watched for it.
+	dir := filepath.Dir(path)
+	if err := watcher.Add(dir); err != nil {
+		if err := watcher.Add(filepath.Dir(dir)); err != nil {
+			log.Printf("Failed to watch the log of server %s: %v", server.Name, err)
+			return
+		}
+	}
+
+	// Catch up on lines written before the watch started
+	if lines, err := follower.read(); err == nil && len(lines) > 0 {
+		sendTailLines(c, server.ID, lines, false)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) == filepath.Clean(dir) && event.Has(fsnotify.Create) {
+				watcher.Add(dir)
+			}
+			if filepath.Clean(event.Name) != filepath.Clean(path) {
+				continue
+			}
+			lines, err := follower.read()
+			if err != nil {
+				continue
+			}
+			if len(lines) > 0 {
+				sendTailLines(c, server.ID, lines, false)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Log watcher error for server %s: %v", server.Name, err)
+		}
+	}
+}
+
+func sendTailLines(c *wsClient, serverID uuid.UUID, lines []string, backfill bool) {
+	message := WebSocketMessage{
+		Type:     "console_tail",
+		ServerID: serverID.String(),
+		Data: map[string]interface{}{
+			"lines":    lines,
+			"backfill": backfill,
+		},
+		Timestamp: getCurrentTimestamp(),
+	}
+
+	c.enqueue(message)
+}
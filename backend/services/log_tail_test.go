@@ -0,0 +1,158 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeLog(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func appendLog(t *testing.T, path, content string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTailFileLargeFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latest.log")
+
+	// Several read chunks worth of lines
+	var content strings.Builder
+	const total = 20000
+	for i := 1; i <= total; i++ {
+		fmt.Fprintf(&content, "[12:00:00 INFO]: line %d\n", i)
+	}
+	writeLog(t, path, content.String())
+
+	for _, n := range []int{1, 100, 5000, total, total + 10} {
+		lines, err := TailFile(path, n)
+		if err != nil {
+			t.Fatalf("TailFile(%d): %v", n, err)
+		}
+
+		want := n
+		if want > total {
+			want = total
+		}
+		if len(lines) != want {
+			t.Fatalf("TailFile(%d) returned %d lines, want %d", n, len(lines), want)
+		}
+		if first := fmt.Sprintf("[12:00:00 INFO]: line %d", total-want+1); lines[0] != first {
+			t.Errorf("TailFile(%d) starts with %q, want %q", n, lines[0], first)
+		}
+		if last := fmt.Sprintf("[12:00:00 INFO]: line %d", total); lines[len(lines)-1] != last {
+			t.Errorf("TailFile(%d) ends with %q, want %q", n, lines[len(lines)-1], last)
+		}
+	}
+}
+
+func TestTailFileEdgeCases(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		n       int
+		want    []string
+	}{
+		{"empty", "", 10, []string{}},
+		{"unterminated last line", "a\nb\nc", 2, []string{"b", "c"}},
+		{"crlf", "a\r\nb\r\n", 5, []string{"a", "b"}},
+		{"blank lines kept", "a\n\nb\n", 3, []string{"a", "", "b"}},
+		{"zero lines", "a\nb\n", 0, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "latest.log")
+			writeLog(t, path, tt.content)
+
+			lines, err := TailFile(path, tt.n)
+			if err != nil {
+				t.Fatalf("TailFile: %v", err)
+			}
+			if !reflect.DeepEqual(lines, tt.want) {
+				t.Errorf("TailFile = %q, want %q", lines, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogFollowerPartialLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latest.log")
+	writeLog(t, path, "old\n")
+
+	follower := newLogFollower(path, 4, false)
+	defer follower.close()
+
+	appendLog(t, path, "first\nsec")
+	lines, err := follower.read()
+	if err != nil || !reflect.DeepEqual(lines, []string{"first"}) {
+		t.Fatalf("read = %q, %v, want the complete line only", lines, err)
+	}
+
+	appendLog(t, path, "ond\n")
+	if lines, _ := follower.read(); !reflect.DeepEqual(lines, []string{"second"}) {
+		t.Errorf("read = %q, want the completed line", lines)
+	}
+}
+
+func TestLogFollowerRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "latest.log")
+	writeLog(t, path, "")
+
+	follower := newLogFollower(path, 0, false)
+	defer follower.close()
+
+	appendLog(t, path, "before rotation\n")
+	if lines, _ := follower.read(); !reflect.DeepEqual(lines, []string{"before rotation"}) {
+		t.Fatalf("read = %q", lines)
+	}
+
+	// The server moves latest.log aside and starts a new one
+	if err := os.Rename(path, filepath.Join(dir, "2024-01-01-1.log")); err != nil {
+		t.Fatal(err)
+	}
+	if lines, err := follower.read(); err != nil || len(lines) != 0 {
+		t.Fatalf("read while rotated away = %q, %v", lines, err)
+	}
+
+	writeLog(t, path, "after rotation\n")
+	if lines, _ := follower.read(); !reflect.DeepEqual(lines, []string{"after rotation"}) {
+		t.Errorf("read after rotation = %q, want the new file from its start", lines)
+	}
+
+	// A truncated file is read from its start again
+	writeLog(t, path, "fresh\n")
+	if lines, _ := follower.read(); !reflect.DeepEqual(lines, []string{"fresh"}) {
+		t.Errorf("read after truncation = %q", lines)
+	}
+}
+
+func TestLogFollowerSkipsRestOfBackfilledLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latest.log")
+	writeLog(t, path, "done\nhalf a li")
+
+	// The backfill already sent "half a li"
+	follower := newLogFollower(path, 14, true)
+	defer follower.close()
+
+	appendLog(t, path, "ne\nnext\n")
+	if lines, _ := follower.read(); !reflect.DeepEqual(lines, []string{"next"}) {
+		t.Errorf("read = %q, want only the line after the backfilled one", lines)
+	}
+}
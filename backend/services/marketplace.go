@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"playpulse-panel/database"
+	"playpulse-panel/marketplace"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// marketplaceService is the plugin marketplace the routes are served from
+var marketplaceService *marketplace.Marketplace
+
+// InitializeMarketplace creates the marketplace
+func InitializeMarketplace() {
+	marketplaceService = marketplace.NewMarketplace(database.DB)
+}
+
+// Marketplace returns the marketplace
+func Marketplace() *marketplace.Marketplace {
+	return marketplaceService
+}
+
+// RolloutController stops and starts servers around marketplace rollouts
+// with the server manager. Only the servers it stopped are started again, so
+// a rollout leaves servers that were already stopped as they were.
+type RolloutController struct {
+	mutex   sync.Mutex
+	stopped map[uuid.UUID]bool
+}
+
+// NewRolloutController creates a rollout controller
+func NewRolloutController() *RolloutController {
+	return &RolloutController{stopped: make(map[uuid.UUID]bool)}
+}
+
+// StopServer stops the server for the install
+func (rc *RolloutController) StopServer(ctx context.Context, serverID uuid.UUID) error {
+	var server models.Server
+	if err := database.DB.WithContext(ctx).First(&server, "id = ?", serverID).Error; err != nil {
+		return err
+	}
+
+	err := StopServer(&server)
+	if errors.Is(err, ErrServerAlreadyStopped) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	rc.mutex.Lock()
+	rc.stopped[serverID] = true
+	rc.mutex.Unlock()
+	return nil
+}
+
+// StartServer starts the server again if StopServer stopped it
+func (rc *RolloutController) StartServer(ctx context.Context, serverID uuid.UUID) error {
+	rc.mutex.Lock()
+	stopped := rc.stopped[serverID]
+	delete(rc.stopped, serverID)
+	rc.mutex.Unlock()
+
+	if !stopped {
+		return nil
+	}
+
+	var server models.Server
+	if err := database.DB.WithContext(ctx).First(&server, "id = ?", serverID).Error; err != nil {
+		return err
+	}
+	return StartServer(&server)
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"strconv"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// MetricsRegistry holds every metric exported on /metrics. A dedicated
+// registry keeps Go runtime defaults out of tests scraping it.
+var MetricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "playpulse_http_requests_total",
+		Help: "Total HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "playpulse_http_request_duration_seconds",
+		Help:    "HTTP request latency, by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	websocketConnections = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "playpulse_websocket_connections",
+		Help: "Number of open WebSocket connections.",
+	}, func() float64 {
+		wsManager.mutex.RLock()
+		defer wsManager.mutex.RUnlock()
+		return float64(len(wsManager.connections))
+	})
+
+	backupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "playpulse_backups_total",
+		Help: "Backups performed, by backup type and result.",
+	}, []string{"type", "result"})
+
+	backupQueueDepth = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "playpulse_backup_queue_depth",
+		Help: "Backups waiting for a free backup worker.",
+	}, func() float64 {
+		queued, _ := BackupQueueStats()
+		return float64(queued)
+	})
+
+	backupsRunning = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "playpulse_backups_running",
+		Help: "Backups currently being created.",
+	}, func() float64 {
+		_, running := BackupQueueStats()
+		return float64(running)
+	})
+
+	serversDesc = prometheus.NewDesc(
+		"playpulse_servers",
+		"Number of servers, by status.",
+		[]string{"status"}, nil,
+	)
+)
+
+// serverStatusCollector counts servers per status from the database on each scrape
+type serverStatusCollector struct{}
+
+func (serverStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- serversDesc
+}
+
+func (serverStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	if database.DB == nil {
+		return
+	}
+
+	var rows []struct {
+		Status models.ServerStatus
+		Count  int64
+	}
+	if err := database.DB.Model(&models.Server{}).
+		Select("status, count(*) as count").
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		return
+	}
+
+	counts := map[models.ServerStatus]int64{
+		models.ServerStatusStopped:     0,
+		models.ServerStatusStarting:    0,
+		models.ServerStatusRunning:     0,
+		models.ServerStatusStopping:    0,
+		models.ServerStatusCrashed:     0,
+		models.ServerStatusHibernating: 0,
+		models.ServerStatusUnknown:     0,
+	}
+	for _, row := range rows {
+		counts[row.Status] += row.Count
+	}
+
+	for status, count := range counts {
+		ch <- prometheus.MustNewConstMetric(serversDesc, prometheus.GaugeValue, float64(count), string(status))
+	}
+}
+
+func init() {
+	MetricsRegistry.MustRegister(
+		httpRequestsTotal,
+		httpRequestDuration,
+		websocketConnections,
+		backupsTotal,
+		backupQueueDepth,
+		backupsRunning,
+		serverStatusCollector{},
+	)
+}
+
+// RegisterDatabaseMetrics exports the connection pool stats of the open
+// database. Call it once after database.Initialize.
+func RegisterDatabaseMetrics() error {
+	sqlDB, err := database.DB.DB()
+	if err != nil {
+		return err
+	}
+	return MetricsRegistry.Register(collectors.NewDBStatsCollector(sqlDB, "playpulse"))
+}
+
+// RecordHTTPRequest records a handled request. route is the matched route
+// pattern rather than the raw path, to keep label cardinality bounded.
+func RecordHTTPRequest(method, route string, status int, duration time.Duration) {
+	httpRequestsTotal.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpRequestDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// recordBackupResult counts a finished backup as a success or failure
+func recordBackupResult(backupType models.BackupType, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	backupsTotal.WithLabelValues(string(backupType), result).Inc()
+}
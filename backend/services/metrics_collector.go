@@ -0,0 +1,174 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// minMetricsInterval is the shortest persistence interval allowed,
+	// globally or per server
+	minMetricsInterval = 5 * time.Second
+	// statsBroadcastInterval is how often running servers' stats are pushed
+	// to WebSocket clients, independently of how often they are persisted
+	statsBroadcastInterval = 2 * time.Second
+)
+
+// metricsCollector broadcasts running servers' stats every
+// statsBroadcastInterval and persists them on a slower tick. The persistence
+// tick runs at the shortest interval in use and saves each server once its
+// own interval has passed.
+type metricsCollector struct {
+	defaultInterval time.Duration
+	lastSampled     map[uuid.UUID]time.Time
+}
+
+// StartMetricsCollector starts the metrics collection goroutine. The
+// persistence interval is the metrics_interval_seconds setting, or the
+// configured METRICS_INTERVAL_SECONDS while that is 0, and is re-read every
+// tick so changes apply without a restart.
+func StartMetricsCollector(cfg *config.Config) {
+	collector := &metricsCollector{
+		defaultInterval: cfg.Monitoring.MetricsInterval,
+		lastSampled:     make(map[uuid.UUID]time.Time),
+	}
+
+	go func() {
+		broadcastTicker := time.NewTicker(statsBroadcastInterval)
+		defer broadcastTicker.Stop()
+
+		interval := collector.tickInterval(nil)
+		persistTicker := time.NewTicker(interval)
+		defer persistTicker.Stop()
+
+		for {
+			select {
+			case <-broadcastTicker.C:
+				collector.broadcast()
+			case <-persistTicker.C:
+				servers := collector.collect(time.Now())
+
+				if next := collector.tickInterval(servers); next != interval {
+					interval = next
+					persistTicker.Reset(interval)
+				}
+			}
+		}
+	}()
+}
+
+// MetricsInterval returns how often a server is sampled: its own override,
+// or the panel-wide interval
+func (mc *metricsCollector) MetricsInterval(server *models.Server) time.Duration {
+	if server != nil && server.MetricsInterval > 0 {
+		return clampMetricsInterval(time.Duration(server.MetricsInterval) * time.Second)
+	}
+
+	return panelMetricsInterval(mc.defaultInterval)
+}
+
+// panelMetricsInterval is the metrics_interval_seconds setting, or
+// defaultInterval while that is 0
+func panelMetricsInterval(defaultInterval time.Duration) time.Duration {
+	interval := defaultInterval
+	if seconds := GetInt("metrics_interval_seconds", 0); seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+	return clampMetricsInterval(interval)
+}
+
+// tickInterval is the shortest interval of the panel default and the
+// running servers' overrides
+func (mc *metricsCollector) tickInterval(servers []models.Server) time.Duration {
+	interval := mc.MetricsInterval(nil)
+	for i := range servers {
+		if serverInterval := mc.MetricsInterval(&servers[i]); serverInterval < interval {
+			interval = serverInterval
+		}
+	}
+	return interval
+}
+
+// runningServers loads the servers that are running
+func runningServers() ([]models.Server, error) {
+	var servers []models.Server
+	err := database.DB.Where("status = ?", models.ServerStatusRunning).Find(&servers).Error
+	return servers, err
+}
+
+// broadcast pushes the stats of running servers to WebSocket clients.
+// Nothing is sampled while no client is connected.
+func (mc *metricsCollector) broadcast() {
+	if !hasWebSocketClients() {
+		return
+	}
+
+	servers, err := runningServers()
+	if err != nil {
+		log.Printf("Error loading running servers for stats: %v", err)
+		return
+	}
+
+	for i := range servers {
+		stats, err := GetServerStats(&servers[i])
+		if err != nil {
+			log.Printf("Error collecting stats for server %s: %v", servers[i].Name, err)
+			continue
+		}
+		BroadcastServerStats(servers[i].ID, stats)
+	}
+}
+
+// collect persists the stats of the running servers that are due and
+// returns the running servers. Stopped servers are never sampled.
+func (mc *metricsCollector) collect(now time.Time) []models.Server {
+	servers, err := runningServers()
+	if err != nil {
+		log.Printf("Error loading running servers for metrics: %v", err)
+		return nil
+	}
+
+	running := make(map[uuid.UUID]bool, len(servers))
+	for i := range servers {
+		server := &servers[i]
+		running[server.ID] = true
+
+		// Half a second of slack so a server whose interval equals the tick
+		// isn't skipped for ticker jitter
+		if last, sampled := mc.lastSampled[server.ID]; sampled && now.Sub(last) < mc.MetricsInterval(server)-500*time.Millisecond {
+			continue
+		}
+		mc.lastSampled[server.ID] = now
+
+		stats, err := GetServerStats(server)
+		if err != nil {
+			log.Printf("Error collecting stats for server %s: %v", server.Name, err)
+			continue
+		}
+
+		persistServerStats(server, stats)
+	}
+
+	// Forget servers that stopped so they are sampled as soon as they start
+	for id := range mc.lastSampled {
+		if !running[id] {
+			delete(mc.lastSampled, id)
+		}
+	}
+	pruneServerStats(running)
+
+	return servers
+}
+
+func clampMetricsInterval(interval time.Duration) time.Duration {
+	if interval < minMetricsInterval {
+		return minMetricsInterval
+	}
+	return interval
+}
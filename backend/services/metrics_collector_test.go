@@ -0,0 +1,199 @@
+package services
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+func TestMetricsTickIntervalFollowsSetting(t *testing.T) {
+	collector := &metricsCollector{defaultInterval: 30 * time.Second}
+	setInterval := func(seconds int) {
+		useTestSettings(t, models.SystemSetting{Key: "metrics_interval_seconds", Type: SettingTypeNumber, Value: strconv.Itoa(seconds)})
+	}
+
+	setInterval(0)
+	if got := collector.tickInterval(nil); got != 30*time.Second {
+		t.Errorf("interval with the setting at 0 = %s, want the configured 30s", got)
+	}
+
+	// The setting is read on every tick, so a change needs no restart
+	setInterval(10)
+	if got := collector.tickInterval(nil); got != 10*time.Second {
+		t.Errorf("interval with the setting at 10 = %s, want 10s", got)
+	}
+	setInterval(1)
+	if got := collector.tickInterval(nil); got != minMetricsInterval {
+		t.Errorf("interval with the setting at 1 = %s, want the %s minimum", got, minMetricsInterval)
+	}
+
+	// The tick runs at the shortest interval any running server needs
+	setInterval(60)
+	servers := []models.Server{{MetricsInterval: 0}, {MetricsInterval: 20}, {MetricsInterval: 120}}
+	if got := collector.tickInterval(servers); got != 20*time.Second {
+		t.Errorf("tick interval = %s, want the 20s override", got)
+	}
+	if got := collector.MetricsInterval(&servers[2]); got != 2*time.Minute {
+		t.Errorf("interval of a server overriding it to 120 = %s, want 2m", got)
+	}
+	if got := collector.MetricsInterval(&models.Server{MetricsInterval: 2}); got != minMetricsInterval {
+		t.Errorf("interval of a server overriding it to 2 = %s, want the %s minimum", got, minMetricsInterval)
+	}
+}
+
+func TestMetricsCollectorSkipsStoppedServers(t *testing.T) {
+	testDB(t)
+	useTestSettings(t, models.SystemSetting{Key: "metrics_interval_seconds", Type: SettingTypeNumber, Value: "30"})
+
+	running := testutil.CreateServer(t, &models.Server{Status: models.ServerStatusRunning})
+	stopped := testutil.CreateServer(t, &models.Server{})
+	fast := testutil.CreateServer(t, &models.Server{Status: models.ServerStatusRunning, MetricsInterval: 10})
+
+	collector := &metricsCollector{defaultInterval: 30 * time.Second, lastSampled: make(map[uuid.UUID]time.Time)}
+	start := time.Now()
+	collector.collect(start)
+
+	if _, sampled := collector.lastSampled[stopped.ID]; sampled {
+		t.Error("a stopped server was sampled")
+	}
+	if collector.lastSampled[running.ID] != start || collector.lastSampled[fast.ID] != start {
+		t.Fatalf("sampled at %v, want both running servers sampled", collector.lastSampled)
+	}
+
+	// Each server is sampled again once its own interval has passed
+	collector.collect(start.Add(10 * time.Second))
+	if collector.lastSampled[running.ID] != start {
+		t.Error("a server was sampled again before its 30s interval passed")
+	}
+	if collector.lastSampled[fast.ID] != start.Add(10*time.Second) {
+		t.Error("the server with a 10s interval was not sampled after 10s")
+	}
+
+	// A server that stops is forgotten
+	database.DB.Model(running).Update("status", models.ServerStatusStopped)
+	collector.collect(start.Add(30 * time.Second))
+	if _, sampled := collector.lastSampled[running.ID]; sampled {
+		t.Error("a server that stopped is still tracked")
+	}
+}
+
+func TestStatsBroadcastOutpacesPersistence(t *testing.T) {
+	testDB(t)
+	useTestSettings(t, models.SystemSetting{Key: "metrics_interval_seconds", Type: SettingTypeNumber, Value: "10"})
+	writer := useTestMetricWriter(t, metricQueueSize, false)
+	client := registerTestWSClient(t, uuid.New())
+
+	server := testutil.CreateServer(t, &models.Server{Status: models.ServerStatusRunning})
+	collector := &metricsCollector{defaultInterval: 30 * time.Second, lastSampled: make(map[uuid.UUID]time.Time)}
+
+	// Both ticks over 30 seconds, broadcasting from the start and persisting
+	// once the persistence interval has passed each time
+	var broadcasts, persisted int
+	start := time.Now()
+	persistInterval := collector.tickInterval(nil)
+	for elapsed := time.Duration(0); elapsed <= 30*time.Second; elapsed += statsBroadcastInterval {
+		collector.broadcast()
+		if elapsed%persistInterval == 0 {
+			collector.collect(start.Add(elapsed))
+		}
+
+		for drained := false; !drained; {
+			select {
+			case message := <-client.send:
+				if message.Type == "server_stats" && message.ServerID == server.ID.String() {
+					broadcasts++
+				}
+			default:
+				drained = true
+			}
+		}
+	}
+	for len(writer.rows) > 0 {
+		if row := <-writer.rows; row.ServerID == server.ID {
+			persisted++
+		}
+	}
+
+	if broadcasts != 16 || persisted != 4 {
+		t.Errorf("%d broadcasts and %d rows persisted over 30s, want 16 and 4", broadcasts, persisted)
+	}
+}
+
+func TestStatsBroadcastNeedsClients(t *testing.T) {
+	testDB(t)
+	server := testutil.CreateServer(t, &models.Server{Status: models.ServerStatusRunning})
+
+	wsManager.mutex.RLock()
+	connected := len(wsManager.connections)
+	wsManager.mutex.RUnlock()
+	if connected > 0 {
+		t.Skip("other WebSocket clients are connected")
+	}
+
+	collector := &metricsCollector{lastSampled: make(map[uuid.UUID]time.Time)}
+	collector.broadcast()
+
+	statsSampler.Lock()
+	_, sampled := statsSampler.samples[server.ID]
+	statsSampler.Unlock()
+	if sampled {
+		t.Error("stats were sampled with no client to broadcast them to")
+	}
+}
+
+func TestGetServerStatsReusesRecentSample(t *testing.T) {
+	server := &models.Server{ID: uuid.New(), Status: models.ServerStatusRunning, MemoryLimit: 2048}
+	t.Cleanup(func() {
+		statsSampler.Lock()
+		delete(statsSampler.samples, server.ID)
+		statsSampler.Unlock()
+	})
+
+	first, err := GetServerStats(server)
+	if err != nil {
+		t.Fatalf("GetServerStats: %v", err)
+	}
+	statsSampler.Lock()
+	sampledAt := statsSampler.samples[server.ID].sampledAt
+	statsSampler.Unlock()
+
+	// A second read within statsSampleMaxAge shares the first sample, and
+	// changing the copy returned doesn't change the cache
+	first.MemoryLimit = 1
+	second, _ := GetServerStats(server)
+	statsSampler.Lock()
+	resampled := statsSampler.samples[server.ID].sampledAt != sampledAt
+	statsSampler.Unlock()
+	if resampled || second.MemoryLimit != 2048 {
+		t.Errorf("second read resampled %v with memory limit %d, want the cached sample", resampled, second.MemoryLimit)
+	}
+
+	// Once it is older, the server is sampled again
+	statsSampler.Lock()
+	expired := statsSampler.samples[server.ID]
+	expired.sampledAt = sampledAt.Add(-statsSampleMaxAge)
+	statsSampler.samples[server.ID] = expired
+	statsSampler.Unlock()
+	GetServerStats(server)
+	statsSampler.Lock()
+	resampled = statsSampler.samples[server.ID].sampledAt != expired.sampledAt
+	statsSampler.Unlock()
+	if !resampled {
+		t.Error("an expired sample was reused")
+	}
+
+	// Servers that stopped running are dropped from the cache
+	pruneServerStats(map[uuid.UUID]bool{})
+	statsSampler.Lock()
+	_, cached := statsSampler.samples[server.ID]
+	statsSampler.Unlock()
+	if cached {
+		t.Error("stats of a stopped server are still cached")
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// maxMetricPoints caps how many buckets a history query returns; a finer
+// resolution is widened to fit
+const maxMetricPoints = 500
+
+// MetricPoint is one bucket of a server's metric history
+type MetricPoint struct {
+	Timestamp  time.Time `json:"timestamp"`
+	CPUAvg     float64   `json:"cpu_avg"`
+	CPUMax     float64   `json:"cpu_max"`
+	MemoryAvg  float64   `json:"memory_avg"` // in MB
+	MemoryMax  int64     `json:"memory_max"` // in MB
+	PlayersAvg float64   `json:"players_avg"`
+	PlayersMax int       `json:"players_max"`
+	TPSAvg     float64   `json:"tps_avg"`
+	TPSMax     float64   `json:"tps_max"`
+	Samples    int       `json:"samples"`
+}
+
+// InitializeMetricsRetention prunes raw server metrics older than the
+// configured retention once an hour
+func InitializeMetricsRetention(cfg *config.Config) {
+	retention := cfg.Monitoring.MetricsRetention
+	if retention <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			if err := PruneServerMetrics(time.Now().Add(-retention)); err != nil {
+				log.Printf("Failed to prune server metrics: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// PruneServerMetrics deletes raw server metrics recorded before cutoff
+func PruneServerMetrics(cutoff time.Time) error {
+	return database.DB.Where("timestamp < ?", cutoff).Delete(&models.ServerMetric{}).Error
+}
+
+// MetricsResolution returns the bucket size for a history query over
+// timeRange: the requested resolution, widened so at most maxMetricPoints
+// buckets come back, and never under a minute
+func MetricsResolution(timeRange, requested time.Duration) time.Duration {
+	resolution := requested
+	if min := timeRange / maxMetricPoints; resolution < min {
+		resolution = min
+	}
+	if resolution < time.Minute {
+		resolution = time.Minute
+	}
+	return resolution.Truncate(time.Second)
+}
+
+// ServerMetricsHistory returns a server's metrics between from and to,
+// averaged and maximised per bucket of resolution. Empty buckets are left out.
+func ServerMetricsHistory(serverID uuid.UUID, from, to time.Time, resolution time.Duration) ([]MetricPoint, error) {
+	seconds := int64(resolution / time.Second)
+
+	var points []MetricPoint
+	err := database.DB.Model(&models.ServerMetric{}).
+		Select(`to_timestamp(floor(extract(epoch from timestamp) / ?) * ?) AS timestamp,
+			AVG(cpu_usage) AS cpu_avg, MAX(cpu_usage) AS cpu_max,
+			AVG(memory_usage) AS memory_avg, MAX(memory_usage) AS memory_max,
+			AVG(player_count) AS players_avg, MAX(player_count) AS players_max,
+			AVG(tps) AS tps_avg, MAX(tps) AS tps_max,
+			COUNT(*) AS samples`, seconds, seconds).
+		Where("server_id = ? AND timestamp >= ? AND timestamp < ?", serverID, from, to).
+		Group("1").Order("1").
+		Scan(&points).Error
+	return points, err
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// recordTestMetrics saves raw metrics for the server and deletes its metrics
+// when the test ends
+func recordTestMetrics(t *testing.T, serverID uuid.UUID, metrics ...models.ServerMetric) {
+	t.Helper()
+
+	for i := range metrics {
+		metrics[i].ServerID = serverID
+	}
+	if err := database.DB.Create(&metrics).Error; err != nil {
+		t.Fatalf("failed to record metrics: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Where("server_id = ?", serverID).Delete(&models.ServerMetric{}) })
+}
+
+func TestMetricsResolution(t *testing.T) {
+	tests := []struct {
+		timeRange, requested, want time.Duration
+	}{
+		{time.Hour, 5 * time.Minute, 5 * time.Minute},
+		{time.Hour, 0, time.Minute}, // never under a minute
+		{time.Hour, 10 * time.Second, time.Minute},
+		{24 * time.Hour, time.Minute, 172 * time.Second}, // widened to 500 points
+		{7 * 24 * time.Hour, time.Hour, time.Hour},
+		{30 * 24 * time.Hour, 0, 5184 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := MetricsResolution(tt.timeRange, tt.requested); got != tt.want {
+			t.Errorf("MetricsResolution(%s, %s) = %s, want %s", tt.timeRange, tt.requested, got, tt.want)
+		}
+	}
+}
+
+func TestServerMetricsHistoryBuckets(t *testing.T) {
+	testDB(t)
+	server := testutil.CreateServer(t, &models.Server{})
+	other := testutil.CreateServer(t, &models.Server{})
+
+	from := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	at := func(d time.Duration) time.Time { return from.Add(d) }
+
+	recordTestMetrics(t, server.ID,
+		models.ServerMetric{Timestamp: at(time.Minute), CPUUsage: 10, MemoryUsage: 1000, PlayerCount: 2, TPS: 20},
+		models.ServerMetric{Timestamp: at(5 * time.Minute), CPUUsage: 30, MemoryUsage: 3000, PlayerCount: 6, TPS: 18},
+		models.ServerMetric{Timestamp: at(9*time.Minute + 59*time.Second), CPUUsage: 50, MemoryUsage: 2000, PlayerCount: 4, TPS: 16},
+		models.ServerMetric{Timestamp: at(10 * time.Minute), CPUUsage: 70, MemoryUsage: 4000, PlayerCount: 8, TPS: 12},
+		// Nothing from 20 to 30 minutes
+		models.ServerMetric{Timestamp: at(31 * time.Minute), CPUUsage: 5, MemoryUsage: 500, PlayerCount: 1, TPS: 20},
+		// Outside the range
+		models.ServerMetric{Timestamp: at(-time.Second), CPUUsage: 99, MemoryUsage: 9999, PlayerCount: 99, TPS: 1},
+		models.ServerMetric{Timestamp: to, CPUUsage: 99, MemoryUsage: 9999, PlayerCount: 99, TPS: 1},
+	)
+	recordTestMetrics(t, other.ID,
+		models.ServerMetric{Timestamp: at(2 * time.Minute), CPUUsage: 99, MemoryUsage: 9999, PlayerCount: 99, TPS: 1},
+	)
+
+	points, err := ServerMetricsHistory(server.ID, from, to, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("ServerMetricsHistory: %v", err)
+	}
+
+	want := []MetricPoint{
+		{Timestamp: at(0), CPUAvg: 30, CPUMax: 50, MemoryAvg: 2000, MemoryMax: 3000, PlayersAvg: 4, PlayersMax: 6, TPSAvg: 18, TPSMax: 20, Samples: 3},
+		{Timestamp: at(10 * time.Minute), CPUAvg: 70, CPUMax: 70, MemoryAvg: 4000, MemoryMax: 4000, PlayersAvg: 8, PlayersMax: 8, TPSAvg: 12, TPSMax: 12, Samples: 1},
+		{Timestamp: at(30 * time.Minute), CPUAvg: 5, CPUMax: 5, MemoryAvg: 500, MemoryMax: 500, PlayersAvg: 1, PlayersMax: 1, TPSAvg: 20, TPSMax: 20, Samples: 1},
+	}
+	if len(points) != len(want) {
+		t.Fatalf("got %d buckets %+v, want %d", len(points), points, len(want))
+	}
+	for i, w := range want {
+		p := points[i]
+		if !p.Timestamp.Equal(w.Timestamp) {
+			t.Errorf("bucket %d starts at %s, want %s", i, p.Timestamp, w.Timestamp)
+		}
+		p.Timestamp = w.Timestamp
+		if p != w {
+			t.Errorf("bucket %d = %+v, want %+v", i, p, w)
+		}
+	}
+
+	// A narrower range only sees the rows inside it
+	points, err = ServerMetricsHistory(server.ID, at(5*time.Minute), at(10*time.Minute), time.Hour)
+	if err != nil {
+		t.Fatalf("ServerMetricsHistory: %v", err)
+	}
+	if len(points) != 1 || points[0].Samples != 2 || points[0].CPUMax != 50 {
+		t.Errorf("narrow range = %+v, want the two samples from 5 to 10 minutes", points)
+	}
+}
+
+func TestPruneServerMetrics(t *testing.T) {
+	testDB(t)
+	server := testutil.CreateServer(t, &models.Server{})
+	now := time.Now()
+
+	recordTestMetrics(t, server.ID,
+		models.ServerMetric{Timestamp: now.Add(-48 * time.Hour)},
+		models.ServerMetric{Timestamp: now.Add(-25 * time.Hour)},
+		models.ServerMetric{Timestamp: now.Add(-23 * time.Hour)},
+		models.ServerMetric{Timestamp: now},
+	)
+
+	if err := PruneServerMetrics(now.Add(-24 * time.Hour)); err != nil {
+		t.Fatalf("PruneServerMetrics: %v", err)
+	}
+
+	var remaining []models.ServerMetric
+	database.DB.Where("server_id = ?", server.ID).Order("timestamp").Find(&remaining)
+	if len(remaining) != 2 || remaining[0].Timestamp.Before(now.Add(-24*time.Hour)) {
+		t.Errorf("%d metrics remain, want the 2 inside the retention window", len(remaining))
+	}
+}
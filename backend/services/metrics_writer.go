@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+)
+
+const (
+	// metricBatchSize is how many samples are written in one insert; a full
+	// batch is written straight away
+	metricBatchSize = 200
+	// metricFlushInterval is the longest a sample waits to be written
+	metricFlushInterval = 10 * time.Second
+	// metricQueueSize bounds the samples waiting for the writer. Samples
+	// beyond it are dropped rather than blocking stats collection.
+	metricQueueSize = 2000
+)
+
+// metricWriter collects metric samples and writes them in multi-row
+// inserts instead of one insert per sample
+type metricWriter struct {
+	rows    chan models.ServerMetric
+	done    chan struct{}
+	mutex   sync.RWMutex
+	stopped bool
+	dropped int64 // samples dropped since the last flush, updated atomically
+}
+
+var metricsWriter *metricWriter
+
+// StartMetricWriter starts writing recorded metric samples in batches
+func StartMetricWriter() {
+	metricsWriter = &metricWriter{
+		rows: make(chan models.ServerMetric, metricQueueSize),
+		done: make(chan struct{}),
+	}
+	go metricsWriter.run()
+}
+
+// StopMetricWriter writes the samples still waiting and stops the writer,
+// giving up when ctx expires. Samples recorded afterwards are written
+// directly.
+func StopMetricWriter(ctx context.Context) error {
+	if metricsWriter == nil {
+		return nil
+	}
+
+	metricsWriter.mutex.Lock()
+	if !metricsWriter.stopped {
+		metricsWriter.stopped = true
+		close(metricsWriter.rows)
+	}
+	metricsWriter.mutex.Unlock()
+
+	select {
+	case <-metricsWriter.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// recordMetric queues a sample to be written with the next batch
+func recordMetric(metric models.ServerMetric) {
+	if metricsWriter == nil {
+		database.DB.Create(&metric)
+		return
+	}
+
+	metricsWriter.mutex.RLock()
+	defer metricsWriter.mutex.RUnlock()
+	if metricsWriter.stopped {
+		database.DB.Create(&metric)
+		return
+	}
+
+	select {
+	case metricsWriter.rows <- metric:
+	default:
+		atomic.AddInt64(&metricsWriter.dropped, 1)
+	}
+}
+
+func (mw *metricWriter) run() {
+	defer close(mw.done)
+
+	ticker := time.NewTicker(metricFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.ServerMetric, 0, metricBatchSize)
+	for {
+		select {
+		case metric, ok := <-mw.rows:
+			if !ok {
+				mw.flush(batch)
+				return
+			}
+			batch = append(batch, metric)
+			if len(batch) >= metricBatchSize {
+				mw.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			mw.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush writes a batch in a single insert
+func (mw *metricWriter) flush(batch []models.ServerMetric) {
+	if dropped := atomic.SwapInt64(&mw.dropped, 0); dropped > 0 {
+		log.Printf("Metric writer queue full, dropped %d samples", dropped)
+	}
+
+	if len(batch) == 0 {
+		return
+	}
+	if err := database.DB.Create(&batch).Error; err != nil {
+		log.Printf("Failed to write %d metric samples: %v", len(batch), err)
+	}
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// useTestMetricWriter swaps in a metric writer queueing up to size samples.
+// It runs unless run is false, and is stopped when the test ends.
+func useTestMetricWriter(t *testing.T, size int, run bool) *metricWriter {
+	t.Helper()
+
+	writer := &metricWriter{
+		rows: make(chan models.ServerMetric, size),
+		done: make(chan struct{}),
+	}
+	previous := metricsWriter
+	metricsWriter = writer
+	if run {
+		go writer.run()
+	}
+	t.Cleanup(func() {
+		if run {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			StopMetricWriter(ctx)
+		}
+		metricsWriter = previous
+	})
+	return writer
+}
+
+// countMetricInserts counts the inserts into server_metrics until the test
+// ends
+func countMetricInserts(t *testing.T) *atomic.Int32 {
+	t.Helper()
+
+	inserts := &atomic.Int32{}
+	name := "test:count_metric_inserts"
+	database.DB.Callback().Create().After("gorm:create").Register(name, func(db *gorm.DB) {
+		if db.Statement.Table == "server_metrics" {
+			inserts.Add(1)
+		}
+	})
+	t.Cleanup(func() { database.DB.Callback().Create().Remove(name) })
+	return inserts
+}
+
+// storedMetricCount counts the metric rows saved for a server
+func storedMetricCount(serverID uuid.UUID) int64 {
+	var count int64
+	database.DB.Model(&models.ServerMetric{}).Where("server_id = ?", serverID).Count(&count)
+	return count
+}
+
+// stopTestMetricWriter stops the writer, failing if it doesn't finish
+func stopTestMetricWriter(t *testing.T) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := StopMetricWriter(ctx); err != nil {
+		t.Fatalf("StopMetricWriter: %v", err)
+	}
+}
+
+func TestRapidSamplesWrittenInOneInsert(t *testing.T) {
+	testDB(t)
+	server := testutil.CreateServer(t, &models.Server{Status: models.ServerStatusRunning})
+	t.Cleanup(func() { database.DB.Where("server_id = ?", server.ID).Delete(&models.ServerMetric{}) })
+	useTestMetricWriter(t, metricQueueSize, true)
+	inserts := countMetricInserts(t)
+
+	const samples = 50
+	for i := 0; i < samples; i++ {
+		persistServerStats(server, &ServerStats{CPUUsage: float64(i), PlayerCount: i})
+	}
+	if n := storedMetricCount(server.ID); n != 0 {
+		t.Errorf("%d samples written before the flush, want them queued", n)
+	}
+
+	// Stopping flushes what is queued
+	stopTestMetricWriter(t)
+	if n := inserts.Load(); n != 1 {
+		t.Errorf("%d inserts, want the %d samples in one", n, samples)
+	}
+	if n := storedMetricCount(server.ID); n != samples {
+		t.Errorf("%d samples stored, want %d", n, samples)
+	}
+
+	// Samples recorded after shutdown are still written, one at a time
+	persistServerStats(server, &ServerStats{})
+	if n := storedMetricCount(server.ID); n != samples+1 {
+		t.Errorf("%d samples stored after a late sample, want %d", n, samples+1)
+	}
+}
+
+func TestFullBatchWrittenWithoutWaiting(t *testing.T) {
+	testDB(t)
+	server := testutil.CreateServer(t, &models.Server{Status: models.ServerStatusRunning})
+	t.Cleanup(func() { database.DB.Where("server_id = ?", server.ID).Delete(&models.ServerMetric{}) })
+	useTestMetricWriter(t, metricQueueSize, true)
+	inserts := countMetricInserts(t)
+
+	for i := 0; i < metricBatchSize+1; i++ {
+		persistServerStats(server, &ServerStats{})
+	}
+
+	// The full batch goes out well before the flush interval; the sample
+	// after it waits
+	deadline := time.Now().Add(metricFlushInterval / 2)
+	for storedMetricCount(server.ID) < metricBatchSize {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d samples stored, want the full batch of %d written", storedMetricCount(server.ID), metricBatchSize)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if n := storedMetricCount(server.ID); n != metricBatchSize || inserts.Load() != 1 {
+		t.Errorf("%d samples in %d inserts, want one batch of %d", n, inserts.Load(), metricBatchSize)
+	}
+
+	stopTestMetricWriter(t)
+	if n := storedMetricCount(server.ID); n != metricBatchSize+1 || inserts.Load() != 2 {
+		t.Errorf("%d samples in %d inserts after shutdown, want the last one flushed", n, inserts.Load())
+	}
+}
+
+func TestFullQueueDropsSamples(t *testing.T) {
+	// The writer isn't running and there is no database, so a sample that
+	// wasn't queued or dropped would panic
+	previousDB := database.DB
+	database.DB = nil
+	t.Cleanup(func() { database.DB = previousDB })
+	writer := useTestMetricWriter(t, 2, false)
+
+	for i := 0; i < 5; i++ {
+		recordMetric(models.ServerMetric{ServerID: uuid.New()})
+	}
+	if len(writer.rows) != 2 || atomic.LoadInt64(&writer.dropped) != 3 {
+		t.Errorf("%d queued and %d dropped, want 2 and 3", len(writer.rows), atomic.LoadInt64(&writer.dropped))
+	}
+
+	// The drops are reported with the next flush and counted from zero again
+	writer.flush(nil)
+	if dropped := atomic.LoadInt64(&writer.dropped); dropped != 0 {
+		t.Errorf("%d dropped after the flush, want the count reset", dropped)
+	}
+}
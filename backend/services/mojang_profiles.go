@@ -0,0 +1,202 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Mojang's lookups from a name to a profile and from a UUID to a profile
+var (
+	mojangProfileURL = "https://api.mojang.com/users/profiles/minecraft/%s"
+	mojangSessionURL = "https://sessionserver.mojang.com/session/minecraft/profile/%s"
+)
+
+const (
+	// profileCacheTTL is how long a resolved profile is reused. Names can
+	// change, so entries don't live forever.
+	profileCacheTTL = 6 * time.Hour
+	// profileMissTTL is how long a name or UUID Mojang doesn't know is
+	// remembered as unknown
+	profileMissTTL = 10 * time.Minute
+	// mojangDefaultBackoff is how long lookups pause after a 429 that
+	// doesn't say when to retry
+	mojangDefaultBackoff = time.Minute
+	// profileCacheSweepSize is the cache size past which expired entries
+	// are dropped on insert
+	profileCacheSweepSize = 1000
+)
+
+var (
+	// ErrPlayerNotFound is returned when Mojang has no player by the name
+	// or UUID
+	ErrPlayerNotFound = errors.New("no Minecraft account with that name or UUID")
+	// ErrMojangRateLimited is returned while Mojang is refusing lookups
+	ErrMojangRateLimited = errors.New("mojang is rate limiting lookups, try again shortly")
+)
+
+// PlayerProfile is a Minecraft account's UUID and current name
+type PlayerProfile struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+// profileCacheEntry is a cached lookup; a nil profile records a miss
+type profileCacheEntry struct {
+	profile   *PlayerProfile
+	expiresAt time.Time
+}
+
+// ProfileResolver maps player names to UUIDs and back through Mojang's
+// API. Results, including unknown names, are cached, and after a 429
+// lookups that aren't cached fail fast until Mojang's backoff has passed.
+type ProfileResolver struct {
+	client       *http.Client
+	cache        map[string]*profileCacheEntry
+	backoffUntil time.Time
+	mutex        sync.Mutex
+}
+
+var profileResolver = &ProfileResolver{
+	client: &http.Client{Timeout: 10 * time.Second},
+	cache:  make(map[string]*profileCacheEntry),
+}
+
+// LookupPlayerByName returns the profile of the account with a name, in
+// any case
+func LookupPlayerByName(name string) (*PlayerProfile, error) {
+	if !playerNamePattern.MatchString(name) {
+		return nil, ErrInvalidPlayerName
+	}
+	return profileResolver.lookup("name:"+strings.ToLower(name),
+		fmt.Sprintf(mojangProfileURL, url.PathEscape(name)))
+}
+
+// LookupPlayerByUUID returns the profile of the account with a UUID, with
+// or without dashes
+func LookupPlayerByUUID(id string) (*PlayerProfile, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid UUID", ErrInvalidPlayerName)
+	}
+	return profileResolver.lookup("uuid:"+parsed.String(),
+		fmt.Sprintf(mojangSessionURL, strings.ReplaceAll(parsed.String(), "-", "")))
+}
+
+// LookupPlayer returns the UUID and current name of a player given by
+// either, for code that takes both (analytics.PlayerLookup)
+func LookupPlayer(player string) (string, string, error) {
+	var profile *PlayerProfile
+	var err error
+	if _, parseErr := uuid.Parse(player); parseErr == nil {
+		profile, err = LookupPlayerByUUID(player)
+	} else {
+		profile, err = LookupPlayerByName(player)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return profile.UUID, profile.Name, nil
+}
+
+// lookup returns the cached result for key, or fetches the profile and
+// caches it under both its name and UUID
+func (pr *ProfileResolver) lookup(key, endpoint string) (*PlayerProfile, error) {
+	pr.mutex.Lock()
+	if entry, exists := pr.cache[key]; exists && time.Now().Before(entry.expiresAt) {
+		pr.mutex.Unlock()
+		if entry.profile == nil {
+			return nil, ErrPlayerNotFound
+		}
+		profile := *entry.profile
+		return &profile, nil
+	}
+	if time.Now().Before(pr.backoffUntil) {
+		pr.mutex.Unlock()
+		return nil, ErrMojangRateLimited
+	}
+	pr.mutex.Unlock()
+
+	profile, err := pr.fetch(endpoint)
+
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	switch {
+	case errors.Is(err, ErrPlayerNotFound):
+		pr.store(key, nil, profileMissTTL)
+		return nil, err
+	case err != nil:
+		return nil, err
+	}
+
+	pr.store("name:"+strings.ToLower(profile.Name), profile, profileCacheTTL)
+	pr.store("uuid:"+profile.UUID, profile, profileCacheTTL)
+	result := *profile
+	return &result, nil
+}
+
+// store caches a result, dropping expired entries once the cache grows.
+// The caller holds the mutex.
+func (pr *ProfileResolver) store(key string, profile *PlayerProfile, ttl time.Duration) {
+	now := time.Now()
+	if len(pr.cache) >= profileCacheSweepSize {
+		for cached, entry := range pr.cache {
+			if now.After(entry.expiresAt) {
+				delete(pr.cache, cached)
+			}
+		}
+	}
+	pr.cache[key] = &profileCacheEntry{profile: profile, expiresAt: now.Add(ttl)}
+}
+
+// fetch requests a profile. Mojang's empty and not found replies are
+// ErrPlayerNotFound, and a 429 starts a backoff.
+func (pr *ProfileResolver) fetch(endpoint string) (*PlayerProfile, error) {
+	resp, err := pr.client.Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Mojang: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent, http.StatusNotFound, http.StatusBadRequest:
+		return nil, ErrPlayerNotFound
+	case http.StatusTooManyRequests:
+		backoff := mojangDefaultBackoff
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			backoff = time.Duration(seconds) * time.Second
+		}
+		pr.mutex.Lock()
+		pr.backoffUntil = time.Now().Add(backoff)
+		pr.mutex.Unlock()
+		return nil, ErrMojangRateLimited
+	default:
+		return nil, fmt.Errorf("mojang lookup failed: %s", resp.Status)
+	}
+
+	var reply struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return nil, fmt.Errorf("invalid reply from Mojang: %v", err)
+	}
+	if reply.ID == "" {
+		return nil, ErrPlayerNotFound
+	}
+	id, err := uuid.Parse(reply.ID)
+	if err != nil {
+		return nil, fmt.Errorf("mojang returned an invalid UUID: %v", err)
+	}
+	return &PlayerProfile{UUID: id.String(), Name: reply.Name}, nil
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLookupKnownPlayer(t *testing.T) {
+	requests := useMockMojang(t, map[string]string{"Notch": strings.ReplaceAll(notchUUID, "-", "")})
+
+	profile, err := LookupPlayerByName("NOTCH")
+	if err != nil {
+		t.Fatalf("LookupPlayerByName: %v", err)
+	}
+	if profile.UUID != notchUUID || profile.Name != "Notch" {
+		t.Errorf("profile = %+v, want Notch with the dashed UUID", profile)
+	}
+
+	// The lookup is cached under both the name and the UUID, so neither
+	// asks Mojang again
+	for _, player := range []string{"notch", notchUUID, strings.ReplaceAll(notchUUID, "-", "")} {
+		id, name, err := LookupPlayer(player)
+		if err != nil || id != notchUUID || name != "Notch" {
+			t.Errorf("LookupPlayer(%s) = %s, %s, %v, want Notch", player, id, name, err)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Mojang lookups = %d, want 1", n)
+	}
+
+	// Changing the returned profile doesn't change the cache
+	profile.Name = "Changed"
+	if cached, _ := LookupPlayerByName("notch"); cached.Name != "Notch" {
+		t.Errorf("cached name = %s, want Notch", cached.Name)
+	}
+
+	// Expired entries are looked up again
+	profileResolver.mutex.Lock()
+	for _, entry := range profileResolver.cache {
+		entry.expiresAt = time.Now().Add(-time.Second)
+	}
+	profileResolver.mutex.Unlock()
+	if _, err := LookupPlayerByName("Notch"); err != nil {
+		t.Fatalf("LookupPlayerByName after expiry: %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("Mojang lookups = %d, want 2 after the cache expired", n)
+	}
+}
+
+func TestLookupUnknownPlayerIsCached(t *testing.T) {
+	requests := useMockMojang(t, nil)
+
+	for i := 0; i < 3; i++ {
+		if _, err := LookupPlayerByName("NoSuchPlayer"); !errors.Is(err, ErrPlayerNotFound) {
+			t.Fatalf("lookup %d = %v, want ErrPlayerNotFound", i+1, err)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Mojang lookups = %d, want the miss remembered after 1", n)
+	}
+
+	// Invalid names and UUIDs never reach Mojang
+	if _, err := LookupPlayerByName("not a name"); !errors.Is(err, ErrInvalidPlayerName) {
+		t.Errorf("LookupPlayerByName with spaces = %v, want ErrInvalidPlayerName", err)
+	}
+	if _, err := LookupPlayerByUUID("1234"); !errors.Is(err, ErrInvalidPlayerName) {
+		t.Errorf("LookupPlayerByUUID with a bad UUID = %v, want ErrInvalidPlayerName", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Mojang lookups = %d, want invalid input refused locally", n)
+	}
+}
+
+func TestLookupBacksOffWhenRateLimited(t *testing.T) {
+	useMockMojang(t, nil)
+
+	requests := &atomic.Int32{}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(api.Close)
+	mojangProfileURL = api.URL + "/users/profiles/minecraft/%s"
+
+	if _, err := LookupPlayerByName("Steve"); !errors.Is(err, ErrMojangRateLimited) {
+		t.Fatalf("LookupPlayerByName = %v, want ErrMojangRateLimited", err)
+	}
+	if until := time.Until(profileResolver.backoffUntil); until < 110*time.Second || until > 120*time.Second {
+		t.Errorf("backoff = %s, want the 2 minutes Mojang asked for", until)
+	}
+
+	// Lookups fail fast during the backoff, and a rate limit isn't cached
+	// as a miss
+	if _, err := LookupPlayerByName("Alex"); !errors.Is(err, ErrMojangRateLimited) {
+		t.Errorf("LookupPlayerByName during the backoff = %v, want ErrMojangRateLimited", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Mojang lookups = %d, want none during the backoff", n)
+	}
+	if _, cached := profileResolver.cache["name:steve"]; cached {
+		t.Error("rate limited lookup was cached")
+	}
+}
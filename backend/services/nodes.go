@@ -0,0 +1,71 @@
+package services
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/database"
+	"playpulse-panel/nodes"
+)
+
+// nodeSettingsInterval is how often node settings are checked for changes
+// to push to the agents
+const nodeSettingsInterval = 30 * time.Second
+
+// nodeManager coordinates the node agents; nil while nodes are turned off
+var nodeManager *nodes.NodeManager
+
+// InitializeNodes starts the node manager and the listener agents connect to.
+// Agents get their own listener because the WebSocket upgrade needs net/http.
+// Without NODE_TOKEN_SECRET no agent could authenticate, so nodes stay off.
+func InitializeNodes(cfg *config.Config) {
+	if cfg.Nodes.TokenSecret == "" {
+		log.Printf("NODE_TOKEN_SECRET is not set, node agents are turned off")
+		return
+	}
+
+	if err := nodes.Migrate(database.DB); err != nil {
+		log.Printf("Failed to migrate node tables, node agents are turned off: %v", err)
+		return
+	}
+
+	nodeManager = nodes.NewNodeManager(database.DB)
+	nodeManager.SetNodeToken(cfg.Nodes.TokenSecret)
+	nodeManager.OnNodeOffline(func(node *nodes.Node) {
+		NotifyNodeOffline(node.ID, node.Name)
+	})
+	nodeManager.OnNodeStatusChange(func(change nodes.NodeStatusChange) {
+		NotifyNodeHealth(change.Node.ID, change.Node.Name, string(change.Status), change.Reason, change.QuarantinedUntil)
+	})
+	RegisterHealthCheck(HealthCheck{Name: "nodes", Check: nodeManager.HealthCheck})
+	if err := nodeManager.SetGeoIPDatabase(cfg.Nodes.GeoIPDatabase); err != nil {
+		log.Printf("Failed to open GeoIP database, players are routed without it: %v", err)
+	}
+
+	// Agents report resources at the panel's metrics interval, pushed to
+	// them whenever the setting changes
+	nodeManager.SetMetricsInterval(panelMetricsInterval(cfg.Monitoring.MetricsInterval))
+	go func() {
+		ticker := time.NewTicker(nodeSettingsInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			nodeManager.SetMetricsInterval(panelMetricsInterval(cfg.Monitoring.MetricsInterval))
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/nodes/connect", nodeManager.ConnectHandler())
+	go func() {
+		if err := http.ListenAndServe(cfg.Nodes.ListenAddress, mux); err != nil {
+			log.Printf("Node agent listener stopped: %v", err)
+		}
+	}()
+	log.Printf("Accepting node agents on %s", cfg.Nodes.ListenAddress)
+}
+
+// NodeManager returns the node manager, or nil when nodes are turned off
+func NodeManager() *nodes.NodeManager {
+	return nodeManager
+}
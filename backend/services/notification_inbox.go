@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrNotificationNotFound is returned for notifications that don't exist or
+// belong to another user
+var ErrNotificationNotFound = errors.New("notification not found")
+
+const (
+	defaultNotificationPageSize = 20
+	maxNotificationPageSize     = 100
+)
+
+// NotificationPage is one page of a user's notifications
+type NotificationPage struct {
+	Notifications []models.Notification `json:"notifications"`
+	Page          int                   `json:"page"`
+	PerPage       int                   `json:"per_page"`
+	Total         int64                 `json:"total"`
+	Unread        int64                 `json:"unread"`
+}
+
+// CreateNotification stores a panel notification and pushes it to the
+// user's open WebSocket connections
+func CreateNotification(notification *models.Notification) error {
+	if err := database.DB.Create(notification).Error; err != nil {
+		return err
+	}
+
+	PushNotification(notification)
+	return nil
+}
+
+// ListNotifications returns a page of the user's notifications, newest first
+func ListNotifications(userID uuid.UUID, unreadOnly bool, page, perPage int) (*NotificationPage, error) {
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = defaultNotificationPageSize
+	}
+	if perPage > maxNotificationPageSize {
+		perPage = maxNotificationPageSize
+	}
+
+	result := &NotificationPage{Page: page, PerPage: perPage}
+
+	query := database.DB.Model(&models.Notification{}).Where("user_id = ?", userID)
+	if unreadOnly {
+		query = query.Where("is_read = ?", false)
+	}
+	if err := query.Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+
+	if err := query.Order("created_at DESC").Offset((page - 1) * perPage).Limit(perPage).
+		Find(&result.Notifications).Error; err != nil {
+		return nil, err
+	}
+
+	if err := database.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND is_read = ?", userID, false).Count(&result.Unread).Error; err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// MarkNotificationRead marks one of the user's notifications read. Marking a
+// notification that is already read leaves its read time unchanged.
+func MarkNotificationRead(userID, notificationID uuid.UUID) (*models.Notification, error) {
+	var notification models.Notification
+	if err := database.DB.Where("id = ? AND user_id = ?", notificationID, userID).First(&notification).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotificationNotFound
+		}
+		return nil, err
+	}
+
+	if notification.IsRead {
+		return &notification, nil
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(&notification).Updates(map[string]interface{}{
+		"is_read": true,
+		"read_at": now,
+	}).Error; err != nil {
+		return nil, err
+	}
+	notification.IsRead = true
+	notification.ReadAt = &now
+
+	return &notification, nil
+}
+
+// MarkAllNotificationsRead marks every unread notification of the user read
+// and returns how many changed
+func MarkAllNotificationsRead(userID uuid.UUID) (int64, error) {
+	result := database.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND is_read = ?", userID, false).
+		Updates(map[string]interface{}{
+			"is_read": true,
+			"read_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// registerTestWSClient adds a connection of the user to the WebSocket
+// manager until the test ends. Messages pushed to it wait in its send queue.
+func registerTestWSClient(t *testing.T, userID uuid.UUID) *wsClient {
+	client := newWSClient(nil, userID)
+	connectionID := uuid.NewString()
+
+	wsManager.mutex.Lock()
+	wsManager.connections[connectionID] = client
+	wsManager.mutex.Unlock()
+
+	t.Cleanup(func() {
+		wsManager.mutex.Lock()
+		delete(wsManager.connections, connectionID)
+		wsManager.mutex.Unlock()
+	})
+	return client
+}
+
+// createTestNotifications saves n notifications for the user, the first read
+// of them marked read, and deletes the user's notifications when the test ends
+func createTestNotifications(t *testing.T, userID uuid.UUID, n, read int) []models.Notification {
+	t.Helper()
+
+	t.Cleanup(func() { database.DB.Where("user_id = ?", userID).Delete(&models.Notification{}) })
+
+	notifications := make([]models.Notification, n)
+	for i := range notifications {
+		notifications[i] = models.Notification{
+			UserID:   userID,
+			Title:    "Test",
+			Message:  "Test notification",
+			Type:     models.NotificationTypeInfo,
+			Priority: models.NotificationPriorityLow,
+			IsRead:   i < read,
+		}
+		if err := database.DB.Create(&notifications[i]).Error; err != nil {
+			t.Fatalf("failed to create notification: %v", err)
+		}
+	}
+	return notifications
+}
+
+func TestListNotificationsUnreadFilter(t *testing.T) {
+	testDB(t)
+	user := testutil.CreateUser(t, &models.User{})
+	createTestNotifications(t, user.ID, 5, 2)
+
+	all, err := ListNotifications(user.ID, false, 1, 0)
+	if err != nil {
+		t.Fatalf("ListNotifications: %v", err)
+	}
+	if all.Total != 5 || all.Unread != 3 || len(all.Notifications) != 5 {
+		t.Errorf("all: total %d, unread %d, %d listed, want 5, 3, 5", all.Total, all.Unread, len(all.Notifications))
+	}
+
+	unread, err := ListNotifications(user.ID, true, 1, 2)
+	if err != nil {
+		t.Fatalf("ListNotifications: %v", err)
+	}
+	if unread.Total != 3 || unread.Unread != 3 || len(unread.Notifications) != 2 {
+		t.Errorf("unread page 1: total %d, unread %d, %d listed, want 3, 3, 2", unread.Total, unread.Unread, len(unread.Notifications))
+	}
+	for _, notification := range unread.Notifications {
+		if notification.IsRead || notification.UserID != user.ID {
+			t.Errorf("unread filter returned %+v", notification)
+		}
+	}
+
+	last, err := ListNotifications(user.ID, true, 2, 2)
+	if err != nil {
+		t.Fatalf("ListNotifications: %v", err)
+	}
+	if len(last.Notifications) != 1 {
+		t.Errorf("unread page 2 lists %d, want 1", len(last.Notifications))
+	}
+}
+
+func TestMarkNotificationReadIsIdempotent(t *testing.T) {
+	testDB(t)
+	user := testutil.CreateUser(t, &models.User{})
+	other := testutil.CreateUser(t, &models.User{})
+	notifications := createTestNotifications(t, user.ID, 3, 0)
+
+	first, err := MarkNotificationRead(user.ID, notifications[0].ID)
+	if err != nil {
+		t.Fatalf("MarkNotificationRead: %v", err)
+	}
+	if !first.IsRead || first.ReadAt == nil {
+		t.Fatalf("notification = %+v, want it read", first)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	again, err := MarkNotificationRead(user.ID, notifications[0].ID)
+	if err != nil {
+		t.Fatalf("marking read twice: %v", err)
+	}
+	if again.ReadAt == nil || again.ReadAt.Sub(*first.ReadAt).Abs() > time.Millisecond {
+		t.Errorf("read at moved from %v to %v on the second mark", first.ReadAt, again.ReadAt)
+	}
+
+	// Another user's notification is not found rather than marked
+	if _, err := MarkNotificationRead(other.ID, notifications[1].ID); !errors.Is(err, ErrNotificationNotFound) {
+		t.Errorf("marking another user's notification = %v, want ErrNotificationNotFound", err)
+	}
+
+	marked, err := MarkAllNotificationsRead(user.ID)
+	if err != nil || marked != 2 {
+		t.Errorf("MarkAllNotificationsRead = %d, %v, want the 2 still unread", marked, err)
+	}
+	if marked, _ := MarkAllNotificationsRead(user.ID); marked != 0 {
+		t.Errorf("second MarkAllNotificationsRead changed %d, want 0", marked)
+	}
+}
+
+func TestCreateNotificationPushesToUsersSockets(t *testing.T) {
+	testDB(t)
+	user := testutil.CreateUser(t, &models.User{})
+	other := testutil.CreateUser(t, &models.User{})
+	t.Cleanup(func() { database.DB.Where("user_id = ?", user.ID).Delete(&models.Notification{}) })
+
+	tabs := []*wsClient{registerTestWSClient(t, user.ID), registerTestWSClient(t, user.ID)}
+	stranger := registerTestWSClient(t, other.ID)
+
+	notification := models.Notification{
+		UserID:   user.ID,
+		Title:    "Backup completed",
+		Message:  "The backup finished",
+		Type:     models.NotificationTypeSuccess,
+		Priority: models.NotificationPriorityLow,
+	}
+	if err := CreateNotification(&notification); err != nil {
+		t.Fatalf("CreateNotification: %v", err)
+	}
+
+	for i, tab := range tabs {
+		select {
+		case message := <-tab.send:
+			pushed, ok := message.Data.(*models.Notification)
+			if message.Type != "notification" || !ok || pushed.ID != notification.ID {
+				t.Errorf("connection %d got %+v, want the new notification", i, message)
+			}
+		default:
+			t.Errorf("connection %d of the user got nothing", i)
+		}
+	}
+
+	select {
+	case message := <-stranger.send:
+		t.Errorf("another user's connection got %+v", message)
+	default:
+	}
+}
@@ -0,0 +1,403 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+)
+
+// NotificationEvent identifies a lifecycle event that can be sent to Discord
+type NotificationEvent string
+
+const (
+	EventServerCrash     NotificationEvent = "server_crash"
+	EventServerStart     NotificationEvent = "server_start"
+	EventServerStop      NotificationEvent = "server_stop"
+	EventBackupCompleted NotificationEvent = "backup_completed"
+	EventNodeOffline     NotificationEvent = "node_offline"
+	EventNodeHealth      NotificationEvent = "node_health"
+	EventDiskQuota       NotificationEvent = "disk_quota"
+)
+
+// Embed colors
+const (
+	colorRed    = 0xE74C3C
+	colorGreen  = 0x2ECC71
+	colorGrey   = 0x95A5A6
+	colorBlue   = 0x3498DB
+	colorOrange = 0xE67E22
+)
+
+const (
+	discordMaxAttempts = 4
+
+	// Repeated events for the same subject within this window are coalesced
+	// into a single message, so a crash loop doesn't spam the channel
+	notificationCoalesceWindow = 5 * time.Minute
+)
+
+// NotificationService posts lifecycle events to a Discord webhook
+type NotificationService struct {
+	webhookURL string
+	client     *http.Client
+	window     time.Duration
+	lastSent   map[string]time.Time
+	suppressed map[string]int
+	mutex      sync.Mutex
+}
+
+var notificationService *NotificationService
+
+// DiscordEmbed is a Discord rich embed
+type DiscordEmbed struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	Color       int                 `json:"color"`
+	Fields      []DiscordEmbedField `json:"fields,omitempty"`
+	Footer      *DiscordEmbedFooter `json:"footer,omitempty"`
+	Timestamp   string              `json:"timestamp"`
+}
+
+type DiscordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type DiscordEmbedFooter struct {
+	Text string `json:"text"`
+}
+
+type discordWebhookPayload struct {
+	Username string         `json:"username,omitempty"`
+	Embeds   []DiscordEmbed `json:"embeds"`
+}
+
+// InitializeNotificationService initializes the notification service
+func InitializeNotificationService(cfg *config.Config) {
+	notificationService = &NotificationService{
+		webhookURL: cfg.Notifications.Discord.WebhookURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		window:     notificationCoalesceWindow,
+		lastSent:   make(map[string]time.Time),
+		suppressed: make(map[string]int),
+	}
+}
+
+// NotifyServerCrash reports a server that exited unexpectedly, on Discord and
+// as a panel notification linked to the captured crash report, if any
+func NotifyServerCrash(server *models.Server, exitErr error, report *models.CrashReport) {
+	fields := serverFields(server)
+	if exitErr != nil {
+		fields = append(fields, DiscordEmbedField{Name: "Exit", Value: exitErr.Error()})
+	}
+	if server.AutoRestart {
+		fields = append(fields, DiscordEmbedField{Name: "Auto-restart", Value: "Enabled", Inline: true})
+	}
+
+	message := fmt.Sprintf("%s exited unexpectedly.", server.Name)
+	if exitErr != nil {
+		message = fmt.Sprintf("%s exited unexpectedly: %v", server.Name, exitErr)
+	}
+	notification := models.Notification{
+		Title:    "Server crashed",
+		Message:  message,
+		Type:     models.NotificationTypeError,
+		Priority: models.NotificationPriorityMedium,
+	}
+	if report != nil {
+		notification.CrashReportID = &report.ID
+		if report.FileName != "" {
+			fields = append(fields, DiscordEmbedField{Name: "Crash report", Value: report.FileName})
+		}
+	}
+	notifyServerUsers(server, notification)
+
+	notify(EventServerCrash, server.ID.String(), DiscordEmbed{
+		Title:  fmt.Sprintf("Server crashed: %s", server.Name),
+		Color:  colorRed,
+		Fields: fields,
+	})
+}
+
+// NotifyCrashLoop reports a server whose auto-restart was paused after
+// crashing repeatedly. Besides Discord, every user with access to the server
+// gets a high priority panel notification.
+func NotifyCrashLoop(server *models.Server, window time.Duration) {
+	message := fmt.Sprintf("%s crashed %d times within %s. Auto-restart has been paused until the server is started manually.",
+		server.Name, server.CrashCount, window)
+
+	createServerNotification(server, "Crash loop detected", message, models.NotificationTypeError, models.NotificationPriorityHigh)
+
+	// Use a separate subject so the alert isn't swallowed by crash coalescing
+	notify(EventServerCrash, server.ID.String()+":loop", DiscordEmbed{
+		Title:       fmt.Sprintf("Crash loop detected: %s", server.Name),
+		Description: message,
+		Color:       colorRed,
+		Fields:      serverFields(server),
+	})
+}
+
+// NotifyServerStart reports a server that has finished starting
+func NotifyServerStart(server *models.Server) {
+	notify(EventServerStart, server.ID.String(), DiscordEmbed{
+		Title:  fmt.Sprintf("Server started: %s", server.Name),
+		Color:  colorGreen,
+		Fields: serverFields(server),
+	})
+}
+
+// NotifyStuckStart reports a server that hasn't finished loading within
+// the start timeout
+func NotifyStuckStart(server *models.Server, timeout time.Duration) {
+	message := fmt.Sprintf("%s has not finished starting after %s. Check its console for errors.", server.Name, timeout)
+	createServerNotification(server, "Server start stuck", message, models.NotificationTypeWarning, models.NotificationPriorityMedium)
+}
+
+// NotifyServerStop reports a server that was stopped
+func NotifyServerStop(server *models.Server) {
+	notify(EventServerStop, server.ID.String(), DiscordEmbed{
+		Title:  fmt.Sprintf("Server stopped: %s", server.Name),
+		Color:  colorGrey,
+		Fields: serverFields(server),
+	})
+}
+
+// NotifyBackupCompleted reports a finished backup, on Discord and as a panel
+// notification
+func NotifyBackupCompleted(server *models.Server, backup *models.Backup) {
+	fields := append(serverFields(server),
+		DiscordEmbedField{Name: "Backup", Value: backup.Name, Inline: true},
+		DiscordEmbedField{Name: "Size", Value: utils.FormatBytes(backup.Size), Inline: true},
+	)
+
+	createServerNotification(server, "Backup completed",
+		fmt.Sprintf("Backup %s of %s finished (%s).", backup.Name, server.Name, utils.FormatBytes(backup.Size)),
+		models.NotificationTypeSuccess, models.NotificationPriorityLow)
+
+	notify(EventBackupCompleted, backup.ID.String(), DiscordEmbed{
+		Title:  fmt.Sprintf("Backup completed: %s", server.Name),
+		Color:  colorBlue,
+		Fields: fields,
+	})
+}
+
+// NotifyDiskQuota reports a server whose files reached threshold percent of
+// its DiskLimit. Users with access to the server get a high priority panel
+// notification.
+func NotifyDiskQuota(server *models.Server, usedBytes int64, threshold int) {
+	limitBytes := server.DiskLimit * 1024 * 1024
+	message := fmt.Sprintf("%s is using %s of its %s disk limit (over %d%%).",
+		server.Name, utils.FormatBytes(usedBytes), utils.FormatBytes(limitBytes), threshold)
+
+	createServerNotification(server, "Disk almost full", message, models.NotificationTypeWarning, models.NotificationPriorityHigh)
+
+	notify(EventDiskQuota, server.ID.String(), DiscordEmbed{
+		Title:       fmt.Sprintf("Disk almost full: %s", server.Name),
+		Description: message,
+		Color:       colorOrange,
+		Fields:      serverFields(server),
+	})
+}
+
+// NotifyNodeOffline reports a node that lost its connection
+func NotifyNodeOffline(nodeID, nodeName string) {
+	notify(EventNodeOffline, nodeID, DiscordEmbed{
+		Title: fmt.Sprintf("Node offline: %s", nodeName),
+		Color: colorOrange,
+		Fields: []DiscordEmbedField{
+			{Name: "Node ID", Value: nodeID, Inline: true},
+		},
+	})
+}
+
+// NotifyNodeHealth reports a node the health monitor failed, recovered or
+// quarantined. quarantinedUntil is zero unless the node was quarantined.
+func NotifyNodeHealth(nodeID, nodeName, status, reason string, quarantinedUntil time.Time) {
+	color := colorRed
+	switch {
+	case !quarantinedUntil.IsZero():
+		color = colorOrange
+	case status == "online":
+		color = colorGreen
+	}
+
+	fields := []DiscordEmbedField{
+		{Name: "Node ID", Value: nodeID, Inline: true},
+		{Name: "Status", Value: status, Inline: true},
+	}
+	if !quarantinedUntil.IsZero() {
+		fields = append(fields, DiscordEmbedField{Name: "Quarantined until", Value: quarantinedUntil.Format(time.RFC3339), Inline: true})
+	}
+
+	// Keyed by status so a recovery isn't coalesced into the failure
+	notify(EventNodeHealth, nodeID+":"+status, DiscordEmbed{
+		Title:       fmt.Sprintf("Node %s: %s", status, nodeName),
+		Description: reason,
+		Color:       color,
+		Fields:      fields,
+	})
+}
+
+func serverFields(server *models.Server) []DiscordEmbedField {
+	return []DiscordEmbedField{
+		{Name: "Type", Value: string(server.Type), Inline: true},
+		{Name: "Version", Value: server.Version, Inline: true},
+		{Name: "Port", Value: strconv.Itoa(server.Port), Inline: true},
+	}
+}
+
+// notify sends an embed in the background if the event is enabled and not
+// throttled
+func notify(event NotificationEvent, subject string, embed DiscordEmbed) {
+	ns := notificationService
+	if ns == nil || ns.webhookURL == "" || !notificationEnabled(event) {
+		return
+	}
+
+	go func() {
+		if err := ns.send(event, subject, embed); err != nil {
+			log.Printf("Failed to send Discord notification (%s): %v", event, err)
+		}
+	}()
+}
+
+// notificationEnabled checks the global Discord switch and the per-event flag
+func notificationEnabled(event NotificationEvent) bool {
+	if !GetBool("enable_discord_notifications", false) {
+		return false
+	}
+	return GetBool("discord_notify_"+string(event), true)
+}
+
+// send coalesces repeated events and posts the embed to the webhook
+func (ns *NotificationService) send(event NotificationEvent, subject string, embed DiscordEmbed) error {
+	suppressed, ok := ns.throttle(event, subject)
+	if !ok {
+		return nil
+	}
+
+	if suppressed > 0 {
+		embed.Footer = &DiscordEmbedFooter{
+			Text: fmt.Sprintf("%d similar notifications suppressed in the last %s", suppressed, ns.window),
+		}
+	}
+	if embed.Timestamp == "" {
+		embed.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	return ns.post(discordWebhookPayload{
+		Username: "Playpulse Panel",
+		Embeds:   []DiscordEmbed{embed},
+	})
+}
+
+// throttle reports whether a notification may be sent now and how many were
+// suppressed since the last one
+func (ns *NotificationService) throttle(event NotificationEvent, subject string) (int, bool) {
+	key := string(event) + ":" + subject
+
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	if last, exists := ns.lastSent[key]; exists && time.Since(last) < ns.window {
+		ns.suppressed[key]++
+		return 0, false
+	}
+
+	suppressed := ns.suppressed[key]
+	delete(ns.suppressed, key)
+	ns.lastSent[key] = time.Now()
+
+	return suppressed, true
+}
+
+// post delivers the payload, retrying with backoff on 429 and 5xx responses
+func (ns *NotificationService) post(payload discordWebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %v", err)
+	}
+
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		resp, err := ns.client.Post(ns.webhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			if attempt >= discordMaxAttempts {
+				return err
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+			continue
+		}
+
+		resp.Body.Close()
+
+		if resp.StatusCode < 300 {
+			return nil
+		}
+
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if !retryable || attempt >= discordMaxAttempts {
+			return fmt.Errorf("webhook returned %s", resp.Status)
+		}
+
+		wait := backoff
+		if resp.StatusCode == http.StatusTooManyRequests {
+			if seconds, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil {
+				wait = time.Duration(seconds * float64(time.Second))
+			}
+		}
+
+		time.Sleep(wait)
+		backoff *= 2
+	}
+}
+
+// createServerNotification stores a panel notification for the server's users
+// and all administrators
+func createServerNotification(server *models.Server, title, message string, notificationType models.NotificationType, priority models.NotificationPriority) {
+	notifyServerUsers(server, models.Notification{
+		Title:    title,
+		Message:  message,
+		Type:     notificationType,
+		Priority: priority,
+	})
+}
+
+// notifyServerUsers sends a copy of notification to every user with access
+// to the server and every admin
+func notifyServerUsers(server *models.Server, template models.Notification) {
+	var userIDs []uuid.UUID
+	database.DB.Table("user_servers").Where("server_id = ?", server.ID).Pluck("user_id", &userIDs)
+
+	var adminIDs []uuid.UUID
+	database.DB.Model(&models.User{}).Where("role = ?", models.RoleAdmin).Pluck("id", &adminIDs)
+
+	seen := make(map[uuid.UUID]bool)
+	for _, userID := range append(userIDs, adminIDs...) {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		notification := template
+		notification.UserID = userID
+		notification.ServerID = &server.ID
+		if err := CreateNotification(&notification); err != nil {
+			log.Printf("Failed to create notification for user %s: %v", userID, err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newMockWebhook records the payloads posted to it
+func newMockWebhook(t *testing.T) (*NotificationService, func() []discordWebhookPayload) {
+	t.Helper()
+
+	var mutex sync.Mutex
+	var payloads []discordWebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload discordWebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("webhook received invalid JSON: %v", err)
+		}
+		mutex.Lock()
+		payloads = append(payloads, payload)
+		mutex.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	ns := &NotificationService{
+		webhookURL: server.URL,
+		client:     server.Client(),
+		window:     time.Hour,
+		lastSent:   make(map[string]time.Time),
+		suppressed: make(map[string]int),
+	}
+	return ns, func() []discordWebhookPayload {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]discordWebhookPayload(nil), payloads...)
+	}
+}
+
+func TestNotificationEmbedPayload(t *testing.T) {
+	ns, payloads := newMockWebhook(t)
+
+	embed := DiscordEmbed{
+		Title: "Server crashed: survival",
+		Color: colorRed,
+		Fields: []DiscordEmbedField{
+			{Name: "Type", Value: "paper", Inline: true},
+			{Name: "Exit", Value: "exit status 1"},
+		},
+	}
+	if err := ns.send(EventServerCrash, "server-1", embed); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	got := payloads()
+	if len(got) != 1 || len(got[0].Embeds) != 1 {
+		t.Fatalf("got %+v, want one payload with one embed", got)
+	}
+	if got[0].Username != "Playpulse Panel" {
+		t.Errorf("username = %q", got[0].Username)
+	}
+	sent := got[0].Embeds[0]
+	if sent.Title != embed.Title || sent.Color != colorRed || len(sent.Fields) != 2 {
+		t.Errorf("embed = %+v, want %+v", sent, embed)
+	}
+	if _, err := time.Parse(time.RFC3339, sent.Timestamp); err != nil {
+		t.Errorf("timestamp %q is not RFC 3339: %v", sent.Timestamp, err)
+	}
+	if sent.Footer != nil {
+		t.Errorf("unexpected footer %q on the first notification", sent.Footer.Text)
+	}
+}
+
+func TestNotificationCrashesAreThrottled(t *testing.T) {
+	ns, payloads := newMockWebhook(t)
+	embed := DiscordEmbed{Title: "Server crashed", Color: colorRed}
+
+	for i := 0; i < 5; i++ {
+		if err := ns.send(EventServerCrash, "server-1", embed); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	// Another server's crash is not coalesced with the first one's
+	if err := ns.send(EventServerCrash, "server-2", embed); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if got := len(payloads()); got != 2 {
+		t.Fatalf("%d notifications sent, want 2", got)
+	}
+
+	// Once the window has passed the suppressed count is reported
+	ns.mutex.Lock()
+	ns.lastSent["server_crash:server-1"] = time.Now().Add(-2 * time.Hour)
+	ns.mutex.Unlock()
+
+	if err := ns.send(EventServerCrash, "server-1", embed); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	got := payloads()
+	if len(got) != 3 {
+		t.Fatalf("%d notifications sent, want 3", len(got))
+	}
+	footer := got[2].Embeds[0].Footer
+	if footer == nil || !strings.HasPrefix(footer.Text, "4 similar notifications suppressed") {
+		t.Errorf("footer = %+v, want the 4 suppressed crashes counted", footer)
+	}
+}
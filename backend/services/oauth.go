@@ -0,0 +1,454 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+	"gorm.io/gorm"
+)
+
+// oauthLoginLifetime is how long a user has to finish logging in at the
+// provider after starting
+const oauthLoginLifetime = 10 * time.Minute
+
+var (
+	// ErrOAuthProviderUnknown is returned for providers that don't exist or
+	// aren't configured
+	ErrOAuthProviderUnknown = errors.New("unknown login provider")
+	// ErrOAuthStateInvalid is returned when a callback's state or nonce
+	// doesn't match a login this panel started
+	ErrOAuthStateInvalid = errors.New("invalid or expired login attempt")
+	// ErrOAuthEmailNotVerified is returned when the provider hasn't verified
+	// the account's email, so it can't be matched to a panel user
+	ErrOAuthEmailNotVerified = errors.New("the provider account has no verified email address")
+	// ErrOAuthSignupDisabled is returned when no user matches and accounts
+	// may not be created on login
+	ErrOAuthSignupDisabled = errors.New("no account matches this login and signup is disabled")
+	// ErrOAuthAccountNotVerified is returned when the matching panel user
+	// never verified their email, so the address may not be theirs to link
+	ErrOAuthAccountNotVerified = errors.New("the account with this email address has not verified it")
+)
+
+// OAuthIdentity is the account a provider vouched for
+type OAuthIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	FirstName     string
+	LastName      string
+}
+
+// oauthProvider is a configured login provider. Providers with an ID token
+// verifier are OpenID Connect and are checked against the login's nonce;
+// the others are asked who the user is with fetchIdentity.
+type oauthProvider struct {
+	config        *oauth2.Config
+	verifier      *oidc.IDTokenVerifier
+	fetchIdentity func(ctx context.Context, client *http.Client) (*OAuthIdentity, error)
+}
+
+// oauthLogin is a login started with StartOAuthLogin and not yet completed
+type oauthLogin struct {
+	provider string
+	nonce    string
+	verifier string // PKCE code verifier
+	expires  time.Time
+}
+
+var (
+	oauthProviders = make(map[string]*oauthProvider)
+	oauthConfig    config.OAuthConfig
+
+	oauthLogins      = make(map[string]oauthLogin)
+	oauthLoginsMutex sync.Mutex
+)
+
+// InitializeOAuth sets up the login providers that have credentials configured
+func InitializeOAuth(cfg *config.Config) {
+	oauthConfig = cfg.OAuth
+	callback := strings.TrimSuffix(cfg.OAuth.CallbackBaseURL, "/")
+
+	if google := cfg.OAuth.Google; google.ClientID != "" && google.ClientSecret != "" {
+		keySet := oidc.NewRemoteKeySet(context.Background(), "https://www.googleapis.com/oauth2/v3/certs")
+		RegisterOAuthProvider("google", &oauth2.Config{
+			ClientID:     google.ClientID,
+			ClientSecret: google.ClientSecret,
+			Endpoint:     endpoints.Google,
+			RedirectURL:  callback + "/google/callback",
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		}, oidc.NewVerifier("https://accounts.google.com", keySet, &oidc.Config{ClientID: google.ClientID}), nil)
+	}
+
+	if github := cfg.OAuth.GitHub; github.ClientID != "" && github.ClientSecret != "" {
+		RegisterOAuthProvider("github", &oauth2.Config{
+			ClientID:     github.ClientID,
+			ClientSecret: github.ClientSecret,
+			Endpoint:     endpoints.GitHub,
+			RedirectURL:  callback + "/github/callback",
+			Scopes:       []string{"read:user", "user:email"},
+		}, nil, fetchGitHubIdentity)
+	}
+
+	if discord := cfg.OAuth.Discord; discord.ClientID != "" && discord.ClientSecret != "" {
+		RegisterOAuthProvider("discord", &oauth2.Config{
+			ClientID:     discord.ClientID,
+			ClientSecret: discord.ClientSecret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  "https://discord.com/oauth2/authorize",
+				TokenURL: "https://discord.com/api/oauth2/token",
+			},
+			RedirectURL: callback + "/discord/callback",
+			Scopes:      []string{"identify", "email"},
+		}, nil, fetchDiscordIdentity)
+	}
+}
+
+// RegisterOAuthProvider adds a login provider. Pass an ID token verifier
+// for an OpenID Connect provider, or fetchIdentity for a plain OAuth2 one.
+func RegisterOAuthProvider(name string, config *oauth2.Config, verifier *oidc.IDTokenVerifier, fetchIdentity func(ctx context.Context, client *http.Client) (*OAuthIdentity, error)) {
+	oauthProviders[name] = &oauthProvider{
+		config:        config,
+		verifier:      verifier,
+		fetchIdentity: fetchIdentity,
+	}
+}
+
+// OAuthProviders returns the names of the configured login providers
+func OAuthProviders() []string {
+	names := make([]string, 0, len(oauthProviders))
+	for name := range oauthProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartOAuthLogin begins a login with a provider and returns the URL to
+// send the user to and the state the callback must come back with
+func StartOAuthLogin(providerName string) (string, string, error) {
+	provider, exists := oauthProviders[providerName]
+	if !exists {
+		return "", "", ErrOAuthProviderUnknown
+	}
+
+	state, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := utils.GenerateRandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	login := oauthLogin{
+		provider: providerName,
+		nonce:    nonce,
+		verifier: oauth2.GenerateVerifier(),
+		expires:  time.Now().Add(oauthLoginLifetime),
+	}
+
+	oauthLoginsMutex.Lock()
+	for key, pending := range oauthLogins {
+		if time.Now().After(pending.expires) {
+			delete(oauthLogins, key)
+		}
+	}
+	oauthLogins[state] = login
+	oauthLoginsMutex.Unlock()
+
+	options := []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(login.verifier)}
+	if provider.verifier != nil {
+		options = append(options, oidc.Nonce(nonce))
+	}
+	return provider.config.AuthCodeURL(state, options...), state, nil
+}
+
+// CompleteOAuthLogin finishes a login from the provider's callback: it
+// checks the state, exchanges the code and returns the panel user for the
+// identity, linking or creating the account as needed
+func CompleteOAuthLogin(ctx context.Context, providerName, state, code string) (*models.User, error) {
+	oauthLoginsMutex.Lock()
+	login, exists := oauthLogins[state]
+	delete(oauthLogins, state)
+	oauthLoginsMutex.Unlock()
+
+	if !exists || login.provider != providerName || time.Now().After(login.expires) {
+		return nil, ErrOAuthStateInvalid
+	}
+
+	provider, exists := oauthProviders[providerName]
+	if !exists {
+		return nil, ErrOAuthProviderUnknown
+	}
+
+	token, err := provider.config.Exchange(ctx, code, oauth2.VerifierOption(login.verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %v", err)
+	}
+
+	var identity *OAuthIdentity
+	if provider.verifier != nil {
+		identity, err = verifyIDToken(ctx, provider.verifier, token, login.nonce)
+	} else {
+		identity, err = provider.fetchIdentity(ctx, provider.config.Client(ctx, token))
+	}
+	if err != nil {
+		return nil, err
+	}
+	identity.Provider = providerName
+
+	return resolveOAuthUser(identity)
+}
+
+// verifyIDToken checks an OpenID Connect ID token's signature, audience and
+// nonce and reads the identity from its claims
+func verifyIDToken(ctx context.Context, verifier *oidc.IDTokenVerifier, token *oauth2.Token, nonce string) (*OAuthIdentity, error) {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("provider did not return an ID token")
+	}
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %v", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, ErrOAuthStateInvalid
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		PreferredUsername string `json:"preferred_username"`
+		GivenName         string `json:"given_name"`
+		FamilyName        string `json:"family_name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid ID token claims: %v", err)
+	}
+
+	username := claims.PreferredUsername
+	if username == "" {
+		username, _, _ = strings.Cut(claims.Email, "@")
+	}
+	return &OAuthIdentity{
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Username:      username,
+		FirstName:     claims.GivenName,
+		LastName:      claims.FamilyName,
+	}, nil
+}
+
+func fetchGitHubIdentity(ctx context.Context, client *http.Client) (*OAuthIdentity, error) {
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := oauthGetJSON(ctx, client, "https://api.github.com/user", &user); err != nil {
+		return nil, err
+	}
+
+	// The profile email may be unverified or hidden, so take the primary
+	// address from the emails list
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := oauthGetJSON(ctx, client, "https://api.github.com/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &OAuthIdentity{
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Username: user.Login,
+	}
+	identity.FirstName, identity.LastName, _ = strings.Cut(user.Name, " ")
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+		}
+	}
+	return identity, nil
+}
+
+func fetchDiscordIdentity(ctx context.Context, client *http.Client) (*OAuthIdentity, error) {
+	var user struct {
+		ID         string `json:"id"`
+		Username   string `json:"username"`
+		GlobalName string `json:"global_name"`
+		Email      string `json:"email"`
+		Verified   bool   `json:"verified"`
+	}
+	if err := oauthGetJSON(ctx, client, "https://discord.com/api/users/@me", &user); err != nil {
+		return nil, err
+	}
+
+	return &OAuthIdentity{
+		Subject:       user.ID,
+		Email:         user.Email,
+		EmailVerified: user.Verified,
+		Username:      user.Username,
+		FirstName:     user.GlobalName,
+	}, nil
+}
+
+func oauthGetJSON(ctx context.Context, client *http.Client, url string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+// resolveOAuthUser returns the user linked to the identity. An identity
+// seen for the first time is linked to the user with the same verified
+// email, or to a new account when signup is allowed.
+func resolveOAuthUser(identity *OAuthIdentity) (*models.User, error) {
+	var user models.User
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var link models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&link).Error
+		if err == nil {
+			if err := tx.First(&user, link.UserID).Error; err != nil {
+				return err
+			}
+			if identity.Email != "" && identity.Email != link.Email {
+				tx.Model(&link).Update("email", identity.Email)
+			}
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// Matching by email is only safe when the provider vouches for it
+		if identity.Email == "" || !identity.EmailVerified {
+			return ErrOAuthEmailNotVerified
+		}
+
+		// Accounts are only linked when both sides vouch for the address.
+		// Anyone can register with an address they don't own and wait for
+		// its owner to log in with a provider.
+		err = tx.Where("LOWER(email) = LOWER(?)", identity.Email).First(&user).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if !oauthConfig.AllowSignup || !GetBool("allow_registration", true) {
+				return ErrOAuthSignupDisabled
+			}
+			err = createOAuthUser(tx, identity, &user)
+		case err == nil && !user.EmailVerified:
+			return ErrOAuthAccountNotVerified
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+var usernameInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// createOAuthUser provisions an account for an identity. It gets a random
+// password, so it can only log in through the provider until one is set.
+func createOAuthUser(tx *gorm.DB, identity *OAuthIdentity, user *models.User) error {
+	base := usernameInvalidChars.ReplaceAllString(identity.Username, "")
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	if len(base) < 3 {
+		base = "user"
+	}
+
+	username := base
+	for attempt := 0; ; attempt++ {
+		var count int64
+		if err := tx.Model(&models.User{}).Unscoped().Where("username = ?", username).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			break
+		}
+		if attempt >= 10 {
+			return fmt.Errorf("failed to pick a free username for %s", identity.Username)
+		}
+		suffix, err := utils.GenerateRandomString(5)
+		if err != nil {
+			return err
+		}
+		username = base + "-" + strings.ToLower(suffix)
+	}
+
+	password, err := utils.GenerateRandomString(48)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	role := models.UserRole(oauthConfig.DefaultRole)
+	if role != models.RoleAdmin && role != models.RoleModerator && role != models.RoleUser {
+		log.Printf("Invalid OAuth default role %q, using %q", oauthConfig.DefaultRole, models.RoleUser)
+		role = models.RoleUser
+	}
+
+	*user = models.User{
+		Username:      username,
+		Email:         identity.Email,
+		Password:      hashedPassword,
+		FirstName:     identity.FirstName,
+		LastName:      identity.LastName,
+		Role:          role,
+		IsActive:      true,
+		EmailVerified: true,
+	}
+	return tx.Create(user).Error
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// mockOIDCProvider is an OpenID Connect provider whose token endpoint
+// answers any code with an ID token carrying the claims the test set
+type mockOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mutex  sync.Mutex
+	claims map[string]interface{}
+}
+
+// useMockOIDCProvider registers a mock provider as "mock" until the test
+// ends, with the given OAuth settings
+func useMockOIDCProvider(t *testing.T, settings config.OAuthConfig) *mockOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &mockOIDCProvider{key: key}
+	provider.server = httptest.NewServer(http.HandlerFunc(provider.token))
+	t.Cleanup(provider.server.Close)
+
+	previousConfig := oauthConfig
+	oauthConfig = settings
+	t.Cleanup(func() {
+		oauthConfig = previousConfig
+		delete(oauthProviders, "mock")
+	})
+
+	verifier := oidc.NewVerifier(provider.server.URL, &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{&key.PublicKey}},
+		&oidc.Config{ClientID: "panel"})
+	RegisterOAuthProvider("mock", &oauth2.Config{
+		ClientID:     "panel",
+		ClientSecret: "secret",
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  provider.server.URL + "/authorize",
+			TokenURL: provider.server.URL + "/token",
+		},
+		RedirectURL: "http://panel.test/callback",
+		Scopes:      []string{oidc.ScopeOpenID, "email"},
+	}, verifier, nil)
+	return provider
+}
+
+func (p *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("code") != "good-code" || r.FormValue("code_verifier") == "" {
+		http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	p.mutex.Lock()
+	claims := map[string]interface{}{
+		"iss": p.server.URL,
+		"aud": "panel",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range p.claims {
+		claims[name] = value
+	}
+	p.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     p.sign(claims),
+	})
+}
+
+// sign returns the claims as an RS256 JWT
+func (p *mockOIDCProvider) sign(claims map[string]interface{}) string {
+	encode := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signingInput := encode(map[string]string{"alg": "RS256", "typ": "JWT"}) + "." + encode(claims)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// login starts a login and completes it as the given account, returning the
+// panel user it resolved to. The nonce is the one sent to the provider
+// unless the claims give their own.
+func (p *mockOIDCProvider) login(t *testing.T, claims map[string]interface{}) (*models.User, error) {
+	t.Helper()
+
+	authURL, state, err := StartOAuthLogin("mock")
+	if err != nil {
+		t.Fatalf("StartOAuthLogin: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.mutex.Lock()
+	p.claims = map[string]interface{}{"nonce": parsed.Query().Get("nonce")}
+	for name, value := range claims {
+		p.claims[name] = value
+	}
+	p.mutex.Unlock()
+
+	return CompleteOAuthLogin(context.Background(), "mock", state, "good-code")
+}
+
+func TestStartOAuthLoginSendsStateNonceAndPKCE(t *testing.T) {
+	useMockOIDCProvider(t, config.OAuthConfig{})
+
+	authURL, state, err := StartOAuthLogin("mock")
+	if err != nil {
+		t.Fatalf("StartOAuthLogin: %v", err)
+	}
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	if query.Get("state") != state || state == "" {
+		t.Errorf("state = %q, want %q in the URL", query.Get("state"), state)
+	}
+	if query.Get("nonce") == "" || query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		t.Errorf("authorize URL %s is missing the nonce or PKCE challenge", authURL)
+	}
+
+	if _, _, err := StartOAuthLogin("nope"); !errors.Is(err, ErrOAuthProviderUnknown) {
+		t.Errorf("StartOAuthLogin of an unknown provider = %v, want ErrOAuthProviderUnknown", err)
+	}
+}
+
+func TestCompleteOAuthLoginChecksStateAndNonce(t *testing.T) {
+	provider := useMockOIDCProvider(t, config.OAuthConfig{})
+	ctx := context.Background()
+
+	if _, err := CompleteOAuthLogin(ctx, "mock", "made-up", "good-code"); !errors.Is(err, ErrOAuthStateInvalid) {
+		t.Errorf("callback with an unknown state = %v, want ErrOAuthStateInvalid", err)
+	}
+
+	// A state is only good for the provider it was started with
+	_, state, _ := StartOAuthLogin("mock")
+	if _, err := CompleteOAuthLogin(ctx, "other", state, "good-code"); !errors.Is(err, ErrOAuthStateInvalid) {
+		t.Errorf("callback for another provider = %v, want ErrOAuthStateInvalid", err)
+	}
+	// and is used up by the attempt
+	if _, err := CompleteOAuthLogin(ctx, "mock", state, "good-code"); !errors.Is(err, ErrOAuthStateInvalid) {
+		t.Errorf("reused state = %v, want ErrOAuthStateInvalid", err)
+	}
+
+	_, state, _ = StartOAuthLogin("mock")
+	oauthLoginsMutex.Lock()
+	login := oauthLogins[state]
+	login.expires = time.Now().Add(-time.Second)
+	oauthLogins[state] = login
+	oauthLoginsMutex.Unlock()
+	if _, err := CompleteOAuthLogin(ctx, "mock", state, "good-code"); !errors.Is(err, ErrOAuthStateInvalid) {
+		t.Errorf("expired login = %v, want ErrOAuthStateInvalid", err)
+	}
+
+	// An ID token minted for another login is refused
+	_, err := provider.login(t, map[string]interface{}{
+		"sub": "123", "email": "steve@example.com", "email_verified": true, "nonce": "someone-elses",
+	})
+	if !errors.Is(err, ErrOAuthStateInvalid) {
+		t.Errorf("ID token with the wrong nonce = %v, want ErrOAuthStateInvalid", err)
+	}
+
+	_, state, _ = StartOAuthLogin("mock")
+	if _, err := CompleteOAuthLogin(ctx, "mock", state, "bad-code"); err == nil || errors.Is(err, ErrOAuthStateInvalid) {
+		t.Errorf("callback with a rejected code = %v, want the exchange to fail", err)
+	}
+}
+
+func TestOAuthLoginLinksByVerifiedEmail(t *testing.T) {
+	testDB(t)
+	provider := useMockOIDCProvider(t, config.OAuthConfig{AllowSignup: true, DefaultRole: string(models.RoleModerator)})
+	useTestSettings(t, models.SystemSetting{Key: "allow_registration", Type: SettingTypeBoolean, Value: "true"})
+
+	user := testutil.CreateUser(t, &models.User{EmailVerified: true})
+	t.Cleanup(func() { database.DB.Where("user_id = ?", user.ID).Delete(&models.UserIdentity{}) })
+	subject := "sub-" + strconv.Itoa(int(time.Now().UnixNano()))
+
+	// The provider must vouch for the address
+	_, err := provider.login(t, map[string]interface{}{"sub": subject, "email": user.Email, "email_verified": false})
+	if !errors.Is(err, ErrOAuthEmailNotVerified) {
+		t.Errorf("login with an unverified provider email = %v, want ErrOAuthEmailNotVerified", err)
+	}
+
+	linked, err := provider.login(t, map[string]interface{}{"sub": subject, "email": user.Email, "email_verified": true})
+	if err != nil {
+		t.Fatalf("login with a verified email: %v", err)
+	}
+	if linked.ID != user.ID {
+		t.Errorf("logged in as %s, want the user with the same email %s", linked.Username, user.Username)
+	}
+	var identities []models.UserIdentity
+	database.DB.Where("provider = ? AND subject = ?", "mock", subject).Find(&identities)
+	if len(identities) != 1 || identities[0].UserID != user.ID {
+		t.Fatalf("identities = %+v, want the link to %s stored", identities, user.Username)
+	}
+
+	// Once linked the subject decides, whatever the email says now
+	again, err := provider.login(t, map[string]interface{}{"sub": subject, "email": "changed@example.com", "email_verified": false})
+	if err != nil || again.ID != user.ID {
+		t.Errorf("login of a linked identity = %v, %v, want %s", again, err, user.Username)
+	}
+}
+
+func TestOAuthLoginRefusesUnverifiedPanelAccount(t *testing.T) {
+	testDB(t)
+	provider := useMockOIDCProvider(t, config.OAuthConfig{AllowSignup: true})
+	useTestSettings(t, models.SystemSetting{Key: "allow_registration", Type: SettingTypeBoolean, Value: "true"})
+
+	user := testutil.CreateUser(t, &models.User{})
+	_, err := provider.login(t, map[string]interface{}{"sub": "sub-" + user.Username, "email": user.Email, "email_verified": true})
+	if !errors.Is(err, ErrOAuthAccountNotVerified) {
+		t.Errorf("login matching an unverified account = %v, want ErrOAuthAccountNotVerified", err)
+	}
+	var count int64
+	database.DB.Model(&models.UserIdentity{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 0 {
+		t.Error("an identity was linked to an account that never verified its email")
+	}
+}
+
+func TestOAuthLoginProvisionsNewUser(t *testing.T) {
+	testDB(t)
+	provider := useMockOIDCProvider(t, config.OAuthConfig{AllowSignup: true, DefaultRole: string(models.RoleModerator)})
+	useTestSettings(t, models.SystemSetting{Key: "allow_registration", Type: SettingTypeBoolean, Value: "true"})
+
+	suffix := strconv.Itoa(int(time.Now().UnixNano()))
+	claims := map[string]interface{}{
+		"sub":                "sub-" + suffix,
+		"email":              "new" + suffix + "@example.com",
+		"email_verified":     true,
+		"preferred_username": "new user!" + suffix,
+		"given_name":         "New",
+	}
+	created, err := provider.login(t, claims)
+	if err != nil {
+		t.Fatalf("login of a new account: %v", err)
+	}
+	t.Cleanup(func() {
+		database.DB.Where("user_id = ?", created.ID).Delete(&models.UserIdentity{})
+		database.DB.Unscoped().Delete(created)
+	})
+	if created.Username != "newuser"+suffix || created.Role != models.RoleModerator || !created.EmailVerified || created.FirstName != "New" {
+		t.Errorf("created %+v, want a verified moderator named from the provider", created)
+	}
+
+	// With signup off nobody new gets in
+	oauthConfig.AllowSignup = false
+	claims["sub"], claims["email"] = "sub-other-"+suffix, "other"+suffix+"@example.com"
+	if _, err := provider.login(t, claims); !errors.Is(err, ErrOAuthSignupDisabled) {
+		t.Errorf("login of a new account with signup disabled = %v, want ErrOAuthSignupDisabled", err)
+	}
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	// ErrWeakPassword is returned when a password doesn't meet the policy;
+	// the wrapped message says which rule it broke
+	ErrWeakPassword = errors.New("password does not meet the password policy")
+	// ErrPasswordBreached is returned when a password appears in a known
+	// data breach
+	ErrPasswordBreached = errors.New("password has appeared in a data breach")
+)
+
+// Have I Been Pwned's range API. Only the first five hex characters of the
+// password's SHA-1 are sent, so the password itself never leaves the panel.
+var pwnedPasswordsURL = "https://api.pwnedpasswords.com/range/"
+
+var pwnedPasswordsClient = &http.Client{Timeout: 5 * time.Second}
+
+// PasswordPolicy is the rule set new passwords are checked against. It is
+// read from the security settings so admins can change it at runtime.
+type PasswordPolicy struct {
+	MinLength           int  `json:"min_length"`
+	RequireUppercase    bool `json:"require_uppercase"`
+	RequireLowercase    bool `json:"require_lowercase"`
+	RequireNumber       bool `json:"require_number"`
+	RequireSymbol       bool `json:"require_symbol"`
+	DisallowAccountInfo bool `json:"disallow_account_info"`
+	BreachCheck         bool `json:"breach_check"`
+}
+
+// CurrentPasswordPolicy returns the policy from the system settings
+func CurrentPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:           GetInt("password_min_length", 8),
+		RequireUppercase:    GetBool("password_require_uppercase", false),
+		RequireLowercase:    GetBool("password_require_lowercase", false),
+		RequireNumber:       GetBool("password_require_number", false),
+		RequireSymbol:       GetBool("password_require_symbol", false),
+		DisallowAccountInfo: GetBool("password_disallow_account_info", true),
+		BreachCheck:         GetBool("password_breach_check", false),
+	}
+}
+
+// ValidatePassword checks a new password for the account with the given
+// username and email against the current policy
+func ValidatePassword(password, username, email string) error {
+	return CurrentPasswordPolicy().Validate(password, username, email)
+}
+
+// Validate checks a password against the policy. The breach check is only
+// done once every other rule passes, and is skipped if the API can't be
+// reached rather than blocking the change.
+func (p PasswordPolicy) Validate(password, username, email string) error {
+	minLength := p.MinLength
+	if minLength < 8 {
+		minLength = 8
+	}
+	if len([]rune(password)) < minLength {
+		return fmt.Errorf("%w: password must be at least %d characters long", ErrWeakPassword, minLength)
+	}
+
+	var hasUpper, hasLower, hasNumber, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasNumber = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUppercase && !hasUpper {
+		return fmt.Errorf("%w: password must contain an uppercase letter", ErrWeakPassword)
+	}
+	if p.RequireLowercase && !hasLower {
+		return fmt.Errorf("%w: password must contain a lowercase letter", ErrWeakPassword)
+	}
+	if p.RequireNumber && !hasNumber {
+		return fmt.Errorf("%w: password must contain a number", ErrWeakPassword)
+	}
+	if p.RequireSymbol && !hasSymbol {
+		return fmt.Errorf("%w: password must contain a symbol", ErrWeakPassword)
+	}
+
+	if p.DisallowAccountInfo {
+		lowered := strings.ToLower(password)
+		if username != "" && len(username) >= 3 && strings.Contains(lowered, strings.ToLower(username)) {
+			return fmt.Errorf("%w: password must not contain your username", ErrWeakPassword)
+		}
+		localPart, _, _ := strings.Cut(email, "@")
+		if len(localPart) >= 3 && strings.Contains(lowered, strings.ToLower(localPart)) {
+			return fmt.Errorf("%w: password must not contain your email address", ErrWeakPassword)
+		}
+	}
+
+	if p.BreachCheck {
+		breached, err := passwordBreached(password)
+		if err != nil {
+			log.Printf("Skipping password breach check: %v", err)
+		} else if breached {
+			return ErrPasswordBreached
+		}
+	}
+
+	return nil
+}
+
+// passwordBreached looks the password up in Have I Been Pwned by the
+// k-anonymity range of its SHA-1 hash
+func passwordBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequest(http.MethodGet, pwnedPasswordsURL+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	// Padding hides the real number of matches from anyone watching
+	req.Header.Set("Add-Padding", "true")
+	req.Header.Set("User-Agent", "Playpulse-Panel")
+
+	resp, err := pwnedPasswordsClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to query breached passwords: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to query breached passwords: %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		candidate, count, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		// Padding entries have a count of zero
+		if found && candidate == suffix && count != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// useMockBreachAPI serves a Have I Been Pwned range API that knows the
+// given passwords as breached, and returns the prefixes it was asked for
+func useMockBreachAPI(t *testing.T, breached ...string) func() []string {
+	t.Helper()
+
+	ranges := make(map[string][]string)
+	for _, password := range breached {
+		sum := sha1.Sum([]byte(password))
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+		ranges[hash[:5]] = append(ranges[hash[:5]], hash[5:]+":3730471")
+	}
+
+	var mutex sync.Mutex
+	var requested []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := strings.TrimPrefix(r.URL.Path, "/range/")
+		mutex.Lock()
+		requested = append(requested, prefix)
+		mutex.Unlock()
+
+		// A padding entry that happens to share the suffix of every
+		// password is not a match
+		fmt.Fprintln(w, "0000000000000000000000000000000000A:0")
+		for _, line := range ranges[prefix] {
+			fmt.Fprintf(w, "%s\r\n", line)
+		}
+	}))
+	t.Cleanup(api.Close)
+
+	previous := pwnedPasswordsURL
+	pwnedPasswordsURL = api.URL + "/range/"
+	t.Cleanup(func() { pwnedPasswordsURL = previous })
+
+	return func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), requested...)
+	}
+}
+
+func TestPasswordPolicyRejections(t *testing.T) {
+	strict := PasswordPolicy{
+		MinLength:           12,
+		RequireUppercase:    true,
+		RequireLowercase:    true,
+		RequireNumber:       true,
+		RequireSymbol:       true,
+		DisallowAccountInfo: true,
+	}
+
+	tests := []struct {
+		policy   PasswordPolicy
+		password string
+		reason   string
+	}{
+		{PasswordPolicy{MinLength: 4}, "short12", "at least 8 characters"}, // never below 8
+		{strict, "Sh0rt-pass", "at least 12 characters"},
+		{strict, "lowercase-only-1", "uppercase letter"},
+		{strict, "UPPERCASE-ONLY-1", "lowercase letter"},
+		{strict, "No-Numbers-Here", "number"},
+		{strict, "NoSymbolsHere123", "symbol"},
+		{strict, "My-Steve_Rocks-1", "username"},
+		{strict, "Crafter-Mail-1234", "email address"},
+		{strict, "Correct-Horse-9", ""},
+		{PasswordPolicy{MinLength: 8}, "steve_rocks", ""}, // account info allowed
+		{strict, "ÜBER-sicher-pass-1", ""},
+	}
+	for _, tt := range tests {
+		err := tt.policy.Validate(tt.password, "steve_", "crafter@example.com")
+		if tt.reason == "" {
+			if err != nil {
+				t.Errorf("%q: %v, want it accepted", tt.password, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrWeakPassword) || !strings.Contains(err.Error(), tt.reason) {
+			t.Errorf("%q = %v, want ErrWeakPassword for %s", tt.password, err, tt.reason)
+		}
+	}
+}
+
+func TestPasswordBreachCheck(t *testing.T) {
+	requested := useMockBreachAPI(t, "Password123!")
+	policy := PasswordPolicy{MinLength: 8, BreachCheck: true}
+
+	if err := policy.Validate("Password123!", "steve", "steve@example.com"); !errors.Is(err, ErrPasswordBreached) {
+		t.Errorf("breached password = %v, want ErrPasswordBreached", err)
+	}
+	if err := policy.Validate("Correct-Horse-Battery-9", "steve", "steve@example.com"); err != nil {
+		t.Errorf("unbreached password = %v, want it accepted", err)
+	}
+
+	// Only the five character prefix of the hash is sent
+	for _, prefix := range requested() {
+		if len(prefix) != 5 {
+			t.Errorf("requested range %q, want a five character prefix", prefix)
+		}
+	}
+	if got := len(requested()); got != 2 {
+		t.Errorf("%d range requests, want 2", got)
+	}
+
+	// Weak passwords are refused before asking
+	if err := policy.Validate("short", "steve", "steve@example.com"); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("short password = %v, want ErrWeakPassword", err)
+	}
+	if got := len(requested()); got != 2 {
+		t.Errorf("%d range requests after a weak password, want still 2", got)
+	}
+
+	// Without the check the API isn't consulted
+	if err := (PasswordPolicy{MinLength: 8}).Validate("Password123!", "steve", "steve@example.com"); err != nil {
+		t.Errorf("breached password without the check = %v, want it accepted", err)
+	}
+}
+
+func TestPasswordBreachCheckSkippedWhenUnavailable(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer api.Close()
+	previous := pwnedPasswordsURL
+	pwnedPasswordsURL = api.URL + "/range/"
+	defer func() { pwnedPasswordsURL = previous }()
+
+	policy := PasswordPolicy{MinLength: 8, BreachCheck: true}
+	if err := policy.Validate("Password123!", "steve", "steve@example.com"); err != nil {
+		t.Errorf("Validate with the breach API failing = %v, want the password accepted", err)
+	}
+}
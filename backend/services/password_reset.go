@@ -0,0 +1,120 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+)
+
+const (
+	passwordResetTokenTTL = 30 * time.Minute
+
+	// Reset emails per account per hour
+	passwordResetHourlyLimit = 3
+)
+
+var (
+	ErrResetTokenInvalid = errors.New("password reset token is invalid")
+	ErrResetTokenExpired = errors.New("password reset token has expired")
+)
+
+// RequestPasswordReset emails a reset link if the address belongs to an
+// active account. Unknown addresses and rate limited accounts are ignored
+// silently so callers can't tell them apart.
+func RequestPasswordReset(email, ipAddress string) error {
+	var user models.User
+	if err := database.DB.Where("email = ? AND is_active = ?", email, true).First(&user).Error; err != nil {
+		return nil
+	}
+
+	var recent int64
+	database.DB.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-time.Hour)).
+		Count(&recent)
+	if recent >= passwordResetHourlyLimit {
+		log.Printf("Password reset rate limit reached for user %s", user.ID)
+		return nil
+	}
+
+	token, err := utils.GenerateRandomString(48)
+	if err != nil {
+		return fmt.Errorf("failed to generate reset token: %v", err)
+	}
+
+	// Only the newest token is valid. Older ones are expired rather than
+	// deleted so they still count towards the rate limit.
+	database.DB.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", user.ID).
+		Update("expires_at", time.Now())
+
+	record := models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		IPAddress: ipAddress,
+		ExpiresAt: time.Now().Add(passwordResetTokenTTL),
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		return fmt.Errorf("failed to create reset token: %v", err)
+	}
+
+	SendPasswordResetEmail(&user, token, passwordResetTokenTTL)
+	return nil
+}
+
+// ResetPassword validates a reset token, sets the new password and signs the
+// user out of all sessions
+func ResetPassword(token, newPassword string) (*models.User, error) {
+	var record models.PasswordResetToken
+	if err := database.DB.Where("token_hash = ? AND used_at IS NULL", utils.HashToken(token)).First(&record).Error; err != nil {
+		return nil, ErrResetTokenInvalid
+	}
+
+	if time.Now().After(record.ExpiresAt) {
+		return nil, ErrResetTokenExpired
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, record.UserID).Error; err != nil {
+		return nil, ErrResetTokenInvalid
+	}
+
+	// Check the policy before consuming the token so the user can retry
+	if err := ValidatePassword(newPassword, user.Username, user.Email); err != nil {
+		return nil, err
+	}
+
+	// Mark the token used atomically so it can't be consumed twice
+	result := database.DB.Model(&models.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", record.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to consume reset token: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrResetTokenInvalid
+	}
+
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %v", err)
+	}
+
+	user.Password = hashedPassword
+	user.LoginAttempts = 0
+	user.LockedUntil = nil
+	if err := database.DB.Save(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to update password: %v", err)
+	}
+
+	// Invalidate all sessions
+	database.DB.Where("user_id = ?", user.ID).Delete(&models.UserSession{})
+
+	SendPasswordChangedEmail(&user)
+
+	return &user, nil
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+)
+
+// createTestResetToken stores a reset token for the user and returns it
+func createTestResetToken(t *testing.T, user *models.User, expiresAt time.Time) string {
+	t.Helper()
+
+	token, err := utils.GenerateRandomString(48)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: expiresAt,
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		t.Fatalf("failed to create reset token: %v", err)
+	}
+	return token
+}
+
+func countResetTokens(userID uuid.UUID) int64 {
+	var count int64
+	database.DB.Model(&models.PasswordResetToken{}).Where("user_id = ?", userID).Count(&count)
+	return count
+}
+
+func TestRequestPasswordResetDoesNotRevealAccounts(t *testing.T) {
+	testDB(t)
+	user := testutil.CreateUser(t, &models.User{})
+
+	unknownErr := RequestPasswordReset("nobody-"+user.Email, "127.0.0.1")
+	knownErr := RequestPasswordReset(user.Email, "127.0.0.1")
+	if unknownErr != nil || knownErr != nil {
+		t.Fatalf("unknown address = %v, known address = %v, want both nil", unknownErr, knownErr)
+	}
+	if got := countResetTokens(user.ID); got != 1 {
+		t.Errorf("%d reset tokens stored for the account, want 1", got)
+	}
+
+	// Rate limited requests look the same as any other
+	for i := 0; i < passwordResetHourlyLimit+2; i++ {
+		if err := RequestPasswordReset(user.Email, "127.0.0.1"); err != nil {
+			t.Fatalf("rate limited request returned %v", err)
+		}
+	}
+	if got := countResetTokens(user.ID); got != passwordResetHourlyLimit {
+		t.Errorf("%d reset tokens stored, want the limit of %d", got, passwordResetHourlyLimit)
+	}
+}
+
+func TestResetPasswordTokenExpiry(t *testing.T) {
+	testDB(t)
+	user := testutil.CreateUser(t, &models.User{})
+
+	token := createTestResetToken(t, user, time.Now().Add(-time.Minute))
+	if _, err := ResetPassword(token, "An0ther-passphrase"); !errors.Is(err, ErrResetTokenExpired) {
+		t.Fatalf("ResetPassword = %v, want ErrResetTokenExpired", err)
+	}
+
+	if _, err := ResetPassword("not-a-token", "An0ther-passphrase"); !errors.Is(err, ErrResetTokenInvalid) {
+		t.Fatalf("ResetPassword = %v, want ErrResetTokenInvalid", err)
+	}
+}
+
+func TestResetPasswordInvalidatesSessions(t *testing.T) {
+	testDB(t)
+	user := testutil.CreateUser(t, &models.User{})
+
+	for i := 0; i < 2; i++ {
+		session := models.UserSession{
+			UserID:       user.ID,
+			TokenHash:    utils.HashToken(uuid.NewString()),
+			RefreshToken: uuid.NewString(),
+			ExpiresAt:    time.Now().Add(time.Hour),
+		}
+		if err := database.DB.Create(&session).Error; err != nil {
+			t.Fatalf("failed to create session: %v", err)
+		}
+	}
+
+	token := createTestResetToken(t, user, time.Now().Add(passwordResetTokenTTL))
+	updated, err := ResetPassword(token, "An0ther-passphrase")
+	if err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if !utils.CheckPasswordHash("An0ther-passphrase", updated.Password) {
+		t.Error("the new password was not set")
+	}
+
+	var sessions int64
+	database.DB.Model(&models.UserSession{}).Where("user_id = ?", user.ID).Count(&sessions)
+	if sessions != 0 {
+		t.Errorf("%d sessions survived the reset, want 0", sessions)
+	}
+
+	// The token can't be used a second time
+	if _, err := ResetPassword(token, "Yet-an0ther-passphrase"); !errors.Is(err, ErrResetTokenInvalid) {
+		t.Errorf("second use = %v, want ErrResetTokenInvalid", err)
+	}
+}
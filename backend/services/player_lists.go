@@ -0,0 +1,338 @@
+package services
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// Player lists kept by Java servers, as named in the API
+const (
+	PlayerListWhitelist = "whitelist"
+	PlayerListOps       = "ops"
+	PlayerListBans      = "banned-players"
+)
+
+// playerListFiles are the files the lists are stored in
+var playerListFiles = map[string]string{
+	PlayerListWhitelist: "whitelist.json",
+	PlayerListOps:       "ops.json",
+	PlayerListBans:      "banned-players.json",
+}
+
+const (
+	// defaultOpLevel is the permission level of ops added without one, the
+	// same as the op command gives
+	defaultOpLevel = 4
+	// banTimeFormat is how Minecraft writes ban dates
+	banTimeFormat = "2006-01-02 15:04:05 -0700"
+)
+
+var (
+	// ErrUnknownPlayerList is returned for a list name that isn't one of the
+	// player lists
+	ErrUnknownPlayerList = errors.New("unknown player list")
+	// ErrPlayerListUnsupported is returned for servers that don't keep
+	// Java player list files
+	ErrPlayerListUnsupported = errors.New("player lists are not supported by this server type")
+	// ErrPlayerNotListed is returned when removing a player who isn't on the list
+	ErrPlayerNotListed = errors.New("player is not on the list")
+)
+
+// playerListsMutex serializes changes to list files so concurrent edits
+// don't drop each other's entries
+var playerListsMutex sync.Mutex
+
+// PlayerListEntry is an entry of whitelist.json, ops.json or
+// banned-players.json. Level and BypassesPlayerLimit are only used by ops,
+// the rest only by bans.
+type PlayerListEntry struct {
+	UUID                string `json:"uuid"`
+	Name                string `json:"name"`
+	Level               int    `json:"level,omitempty"`
+	BypassesPlayerLimit bool   `json:"bypassesPlayerLimit,omitempty"`
+	Created             string `json:"created,omitempty"`
+	Source              string `json:"source,omitempty"`
+	Expires             string `json:"expires,omitempty"`
+	Reason              string `json:"reason,omitempty"`
+}
+
+// PlayerListAddition is a player to add to a list, by name, UUID or both
+type PlayerListAddition struct {
+	Name   string
+	UUID   string
+	Level  int    // ops only; defaults to 4
+	Reason string // bans only
+	Source string // bans only; who banned the player
+}
+
+// ReadPlayerList returns the entries of one of a server's player lists
+func ReadPlayerList(server *models.Server, list string) ([]PlayerListEntry, error) {
+	path, err := playerListPath(server, list)
+	if err != nil {
+		return nil, err
+	}
+	return readPlayerListFile(path)
+}
+
+// AddToPlayerList adds a player to a list, looking up the UUID or name that
+// wasn't given, and applies the change to the server if it is running. A
+// player already on the list is updated in place.
+func AddToPlayerList(server *models.Server, list string, addition PlayerListAddition) (*PlayerListEntry, error) {
+	path, err := playerListPath(server, list)
+	if err != nil {
+		return nil, err
+	}
+
+	name, id, err := resolvePlayer(server, addition.Name, addition.UUID)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := PlayerListEntry{UUID: id, Name: name}
+	switch list {
+	case PlayerListOps:
+		entry.Level = addition.Level
+		if entry.Level == 0 {
+			entry.Level = defaultOpLevel
+		}
+	case PlayerListBans:
+		entry.Created = time.Now().Format(banTimeFormat)
+		entry.Source = addition.Source
+		entry.Expires = "forever"
+		entry.Reason = addition.Reason
+		if entry.Reason == "" {
+			entry.Reason = "Banned by an operator."
+		}
+	}
+
+	playerListsMutex.Lock()
+	defer playerListsMutex.Unlock()
+
+	entries, err := readPlayerListFile(path)
+	if err != nil {
+		return nil, err
+	}
+	replaced := false
+	for i := range entries {
+		if strings.EqualFold(entries[i].UUID, id) {
+			entries[i] = entry
+			replaced = true
+		}
+	}
+	if !replaced {
+		entries = append(entries, entry)
+	}
+	if err := writePlayerListFile(path, entries); err != nil {
+		return nil, err
+	}
+
+	applyPlayerListChange(server, list, entry, true)
+	return &entry, nil
+}
+
+// RemoveFromPlayerList removes a player, given by name or UUID, from a list
+// and applies the change to the server if it is running
+func RemoveFromPlayerList(server *models.Server, list, player string) error {
+	path, err := playerListPath(server, list)
+	if err != nil {
+		return err
+	}
+
+	playerListsMutex.Lock()
+	defer playerListsMutex.Unlock()
+
+	entries, err := readPlayerListFile(path)
+	if err != nil {
+		return err
+	}
+
+	kept := entries[:0]
+	var removed *PlayerListEntry
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Name, player) || strings.EqualFold(entry.UUID, player) {
+			entry := entry
+			removed = &entry
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	if removed == nil {
+		return ErrPlayerNotListed
+	}
+	if err := writePlayerListFile(path, kept); err != nil {
+		return err
+	}
+
+	applyPlayerListChange(server, list, *removed, false)
+	return nil
+}
+
+// applyPlayerListChange tells a running server about a change to a list
+// file. The whitelist can be reloaded; ops and bans are only read at start
+// and written back from memory, so the matching command is sent instead.
+func applyPlayerListChange(server *models.Server, list string, entry PlayerListEntry, added bool) {
+	if server.Status != models.ServerStatusRunning {
+		return
+	}
+
+	var command string
+	switch {
+	case list == PlayerListWhitelist:
+		command = "whitelist reload"
+	case list == PlayerListOps && added:
+		// op gives the server's op-permission-level and writes it back over
+		// the file, so another level only applies at the next start
+		if entry.Level != serverOpLevel(server) {
+			log.Printf("Server %s: %s was made an op with level %d, which applies when it restarts", server.Name, entry.Name, entry.Level)
+			return
+		}
+		command = "op " + entry.Name
+	case list == PlayerListOps:
+		command = "deop " + entry.Name
+	case list == PlayerListBans && added:
+		command = "ban " + entry.Name + " " + consoleLine(entry.Reason)
+	case list == PlayerListBans:
+		command = "pardon " + entry.Name
+	}
+
+	if err := SendServerCommand(server, command); err != nil {
+		// The file is written, so the change applies at the next start
+		log.Printf("Failed to apply %s change to server %s: %v", list, server.Name, err)
+	}
+}
+
+// serverOpLevel returns the permission level the op command gives on a
+// server
+func serverOpLevel(server *models.Server) int {
+	if properties, err := ReadServerProperties(server); err == nil {
+		if level, ok := properties["op-permission-level"].(int); ok {
+			return level
+		}
+	}
+	return defaultOpLevel
+}
+
+// playerListPath returns the file of a list, checking the server keeps one
+func playerListPath(server *models.Server, list string) (string, error) {
+	if server.Type == models.ServerTypeBedrock || server.Type == models.ServerTypeProxy {
+		return "", ErrPlayerListUnsupported
+	}
+	file, exists := playerListFiles[list]
+	if !exists {
+		return "", ErrUnknownPlayerList
+	}
+	return filepath.Join(server.Path, file), nil
+}
+
+// readPlayerListFile reads a list file; a missing file is an empty list
+func readPlayerListFile(path string) ([]PlayerListEntry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return []PlayerListEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []PlayerListEntry{}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return entries, nil
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s is not valid JSON: %v", filepath.Base(path), err)
+	}
+	return entries, nil
+}
+
+// writePlayerListFile replaces a list file, writing to a temporary file
+// first so the server never reads a partial list
+func writePlayerListFile(path string, entries []PlayerListEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
+
+// resolvePlayer completes a player's name and UUID. Servers in offline mode
+// use the UUID derived from the name; online ones look the player up with
+// Mojang, which also gives the name as the account spells it.
+func resolvePlayer(server *models.Server, name, id string) (string, string, error) {
+	if name != "" && !playerNamePattern.MatchString(name) {
+		return "", "", ErrInvalidPlayerName
+	}
+	if id != "" {
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: invalid UUID", ErrInvalidPlayerName)
+		}
+		id = parsed.String()
+	}
+
+	if !serverOnlineMode(server) {
+		if name == "" {
+			return "", "", fmt.Errorf("%w: offline mode servers need the player's name", ErrInvalidPlayerName)
+		}
+		if id == "" {
+			id = offlinePlayerUUID(name)
+		}
+		return name, id, nil
+	}
+
+	if name != "" && id != "" {
+		return name, id, nil
+	}
+
+	var profile *PlayerProfile
+	var err error
+	if name != "" {
+		profile, err = LookupPlayerByName(name)
+	} else {
+		profile, err = LookupPlayerByUUID(id)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return profile.Name, profile.UUID, nil
+}
+
+// serverOnlineMode reports whether the server authenticates players with
+// Mojang, which is the default
+func serverOnlineMode(server *models.Server) bool {
+	properties, err := ReadServerProperties(server)
+	if err != nil {
+		return true
+	}
+	online, ok := properties["online-mode"].(bool)
+	return !ok || online
+}
+
+// offlinePlayerUUID is the UUID an offline mode server gives a player: a
+// version 3 UUID of "OfflinePlayer:<name>", as Java's nameUUIDFromBytes
+func offlinePlayerUUID(name string) string {
+	sum := md5.Sum([]byte("OfflinePlayer:" + name))
+	sum[6] = sum[6]&0x0f | 0x30
+	sum[8] = sum[8]&0x3f | 0x80
+	return uuid.UUID(sum).String()
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// notchUUID is the UUID of the account the Mojang mock knows as Notch
+const notchUUID = "069a79f4-44e9-4726-a5be-fca90e38aaf5"
+
+// useMockMojang serves Mojang's profile lookups for the accounts in
+// profiles, keyed by name with the UUID undashed as Mojang sends it, and
+// gives the resolver an empty cache. It returns the number of lookups made.
+func useMockMojang(t *testing.T, profiles map[string]string) *atomic.Int32 {
+	t.Helper()
+
+	requests := &atomic.Int32{}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		key := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		for name, id := range profiles {
+			if strings.EqualFold(name, key) || id == key {
+				json.NewEncoder(w).Encode(map[string]string{"id": id, "name": name})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(api.Close)
+
+	previousProfile, previousSession, previousResolver := mojangProfileURL, mojangSessionURL, profileResolver
+	mojangProfileURL = api.URL + "/users/profiles/minecraft/%s"
+	mojangSessionURL = api.URL + "/session/minecraft/profile/%s"
+	profileResolver = &ProfileResolver{client: api.Client(), cache: make(map[string]*profileCacheEntry)}
+	t.Cleanup(func() {
+		mojangProfileURL, mojangSessionURL, profileResolver = previousProfile, previousSession, previousResolver
+	})
+	return requests
+}
+
+// newPlayerListServer returns a stopped Java server in a temporary
+// directory with the given server.properties lines
+func newPlayerListServer(t *testing.T, properties ...string) *models.Server {
+	t.Helper()
+
+	server := &models.Server{ID: uuid.New(), Type: models.ServerTypePaper, Path: t.TempDir(), Status: models.ServerStatusStopped}
+	if len(properties) > 0 {
+		data := strings.Join(properties, "\n") + "\n"
+		if err := os.WriteFile(filepath.Join(server.Path, "server.properties"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return server
+}
+
+// readListFile decodes a list file as Minecraft would, failing on invalid
+// JSON
+func readListFile(t *testing.T, server *models.Server, file string) []map[string]interface{} {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(server.Path, file))
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", file, err)
+	}
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatalf("%s is not valid JSON: %v\n%s", file, err, data)
+	}
+	return entries
+}
+
+func TestAddToWhitelistByNameResolvesUUID(t *testing.T) {
+	requests := useMockMojang(t, map[string]string{"Notch": strings.ReplaceAll(notchUUID, "-", "")})
+	server := newPlayerListServer(t)
+
+	entry, err := AddToPlayerList(server, PlayerListWhitelist, PlayerListAddition{Name: "notch"})
+	if err != nil {
+		t.Fatalf("AddToPlayerList: %v", err)
+	}
+	if entry.UUID != notchUUID || entry.Name != "Notch" {
+		t.Errorf("entry = %+v, want Notch with the dashed UUID", entry)
+	}
+
+	entries := readListFile(t, server, "whitelist.json")
+	if len(entries) != 1 || entries[0]["uuid"] != notchUUID || entries[0]["name"] != "Notch" {
+		t.Fatalf("whitelist.json = %v, want Notch", entries)
+	}
+	if len(entries[0]) != 2 {
+		t.Errorf("whitelist entry = %v, want only uuid and name", entries[0])
+	}
+
+	// Adding the player again by UUID updates the entry without asking
+	// Mojang, as the UUID is cached from the first lookup
+	if _, err := AddToPlayerList(server, PlayerListWhitelist, PlayerListAddition{UUID: strings.ReplaceAll(notchUUID, "-", "")}); err != nil {
+		t.Fatalf("AddToPlayerList by UUID: %v", err)
+	}
+	if entries := readListFile(t, server, "whitelist.json"); len(entries) != 1 {
+		t.Errorf("whitelist.json = %v, want Notch once", entries)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Mojang lookups = %d, want 1", n)
+	}
+}
+
+func TestAddToPlayerListRejectsUnknownPlayer(t *testing.T) {
+	useMockMojang(t, nil)
+	server := newPlayerListServer(t)
+
+	if _, err := AddToPlayerList(server, PlayerListWhitelist, PlayerListAddition{Name: "NoSuchPlayer"}); !errors.Is(err, ErrPlayerNotFound) {
+		t.Fatalf("AddToPlayerList = %v, want ErrPlayerNotFound", err)
+	}
+	if _, err := AddToPlayerList(server, PlayerListWhitelist, PlayerListAddition{Name: "bad name!"}); !errors.Is(err, ErrInvalidPlayerName) {
+		t.Errorf("AddToPlayerList with an invalid name = %v, want ErrInvalidPlayerName", err)
+	}
+	if _, err := os.Stat(filepath.Join(server.Path, "whitelist.json")); !os.IsNotExist(err) {
+		t.Errorf("whitelist.json was written for a player that wasn't added")
+	}
+}
+
+func TestAddToPlayerListOfflineMode(t *testing.T) {
+	requests := useMockMojang(t, nil)
+	server := newPlayerListServer(t, "online-mode=false")
+
+	entry, err := AddToPlayerList(server, PlayerListWhitelist, PlayerListAddition{Name: "Steve"})
+	if err != nil {
+		t.Fatalf("AddToPlayerList: %v", err)
+	}
+	id, err := uuid.Parse(entry.UUID)
+	if err != nil || id.Version() != 3 || entry.UUID != offlinePlayerUUID("Steve") {
+		t.Errorf("entry UUID = %s, want the version 3 offline UUID", entry.UUID)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("Mojang lookups = %d, want none in offline mode", n)
+	}
+	if _, err := AddToPlayerList(server, PlayerListWhitelist, PlayerListAddition{UUID: notchUUID}); !errors.Is(err, ErrInvalidPlayerName) {
+		t.Errorf("AddToPlayerList by UUID alone = %v, want ErrInvalidPlayerName", err)
+	}
+}
+
+func TestOpsAndBansEntries(t *testing.T) {
+	useMockMojang(t, nil)
+	server := newPlayerListServer(t, "online-mode=false")
+
+	// Entries already in the file are kept
+	existing := `[{"uuid": "` + offlinePlayerUUID("Alex") + `", "name": "Alex", "level": 2, "bypassesPlayerLimit": true}]`
+	if err := os.WriteFile(filepath.Join(server.Path, "ops.json"), []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddToPlayerList(server, PlayerListOps, PlayerListAddition{Name: "Steve"}); err != nil {
+		t.Fatalf("AddToPlayerList ops: %v", err)
+	}
+	ops := readListFile(t, server, "ops.json")
+	if len(ops) != 2 || ops[0]["bypassesPlayerLimit"] != true || ops[1]["name"] != "Steve" || ops[1]["level"] != float64(defaultOpLevel) {
+		t.Errorf("ops.json = %v, want Alex kept and Steve at level %d", ops, defaultOpLevel)
+	}
+
+	if _, err := AddToPlayerList(server, PlayerListBans, PlayerListAddition{Name: "Griefer", Source: "admin"}); err != nil {
+		t.Fatalf("AddToPlayerList bans: %v", err)
+	}
+	bans := readListFile(t, server, "banned-players.json")
+	if len(bans) != 1 || bans[0]["expires"] != "forever" || bans[0]["source"] != "admin" || bans[0]["reason"] == "" {
+		t.Fatalf("banned-players.json = %v, want a permanent ban by admin with a reason", bans)
+	}
+	if _, err := time.Parse(banTimeFormat, bans[0]["created"].(string)); err != nil {
+		t.Errorf("ban created = %v, want Minecraft's date format", bans[0]["created"])
+	}
+
+	// Players are removed by name or UUID, in any case
+	if err := RemoveFromPlayerList(server, PlayerListOps, "alex"); err != nil {
+		t.Fatalf("RemoveFromPlayerList by name: %v", err)
+	}
+	if err := RemoveFromPlayerList(server, PlayerListBans, strings.ToUpper(offlinePlayerUUID("Griefer"))); err != nil {
+		t.Fatalf("RemoveFromPlayerList by UUID: %v", err)
+	}
+	if ops := readListFile(t, server, "ops.json"); len(ops) != 1 || ops[0]["name"] != "Steve" {
+		t.Errorf("ops.json = %v, want only Steve", ops)
+	}
+	if bans := readListFile(t, server, "banned-players.json"); len(bans) != 0 {
+		t.Errorf("banned-players.json = %v, want it empty", bans)
+	}
+	if err := RemoveFromPlayerList(server, PlayerListOps, "alex"); !errors.Is(err, ErrPlayerNotListed) {
+		t.Errorf("removing a player twice = %v, want ErrPlayerNotListed", err)
+	}
+}
+
+func TestPlayerListPathChecksListAndServer(t *testing.T) {
+	server := newPlayerListServer(t)
+	if _, err := ReadPlayerList(server, "whitelist.json"); !errors.Is(err, ErrUnknownPlayerList) {
+		t.Errorf("ReadPlayerList of a file name = %v, want ErrUnknownPlayerList", err)
+	}
+	if entries, err := ReadPlayerList(server, PlayerListOps); err != nil || len(entries) != 0 {
+		t.Errorf("ReadPlayerList without ops.json = %v, %v, want an empty list", entries, err)
+	}
+
+	server.Type = models.ServerTypeBedrock
+	if _, err := ReadPlayerList(server, PlayerListWhitelist); !errors.Is(err, ErrPlayerListUnsupported) {
+		t.Errorf("ReadPlayerList on bedrock = %v, want ErrPlayerListUnsupported", err)
+	}
+}
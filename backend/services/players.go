@@ -0,0 +1,255 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// playerConfirmTimeout is how long a player action waits for the server to
+// acknowledge it in the console
+const playerConfirmTimeout = 5 * time.Second
+
+var (
+	// ErrInvalidPlayerName is returned for names that can't be a Minecraft player
+	ErrInvalidPlayerName = errors.New("invalid player name")
+	// ErrPlayerActionUnsupported is returned when the server type has no
+	// command for the action
+	ErrPlayerActionUnsupported = errors.New("player action not supported by this server type")
+)
+
+// Player actions accepted by PlayerAction
+const (
+	PlayerActionKick  = "kick"
+	PlayerActionBan   = "ban"
+	PlayerActionUnban = "unban"
+	PlayerActionOp    = "op"
+	PlayerActionDeop  = "deop"
+)
+
+var playerNamePattern = regexp.MustCompile(`^\w{1,16}$`)
+
+// javaListPattern matches the reply to list, e.g.
+// "There are 2 of a max of 20 players online: Steve, Alex"
+var javaListPattern = regexp.MustCompile(`There are \d+ of a max(?: of)? \d+ players online:(.*)$`)
+
+// OnlinePlayer is a player connected to a server
+type OnlinePlayer struct {
+	Name string `json:"name"`
+	// Nil when the player was already online before the panel was watching
+	JoinedAt *time.Time `json:"joined_at,omitempty"`
+}
+
+// playerCommand is how a server type performs a player action: the command
+// to send and the console line that confirms it. %s is the player name.
+type playerCommand struct {
+	command   string
+	confirm   string
+	hasReason bool
+}
+
+var (
+	javaPlayerCommands = map[string]playerCommand{
+		PlayerActionKick:  {command: "kick %s", confirm: `Kicked %s`, hasReason: true},
+		PlayerActionBan:   {command: "ban %s", confirm: `Banned %s`, hasReason: true},
+		PlayerActionUnban: {command: "pardon %s", confirm: `Unbanned %s`},
+		PlayerActionOp:    {command: "op %s", confirm: `Made %s a server operator`},
+		PlayerActionDeop:  {command: "deop %s", confirm: `Made %s no longer a server operator`},
+	}
+
+	// Bedrock Dedicated Server has no ban list
+	bedrockPlayerCommands = map[string]playerCommand{
+		PlayerActionKick: {command: "kick %s", confirm: `Kicked %s`, hasReason: true},
+		PlayerActionOp:   {command: "op %s", confirm: `Opped: %s`},
+		PlayerActionDeop: {command: "deop %s", confirm: `De-opped: %s`},
+	}
+)
+
+// onlinePlayers tracks who is connected to each running server, from the
+// join and leave lines in its console output
+var (
+	onlinePlayers      = make(map[uuid.UUID]map[string]time.Time)
+	onlinePlayersMutex sync.Mutex
+)
+
+// trackPlayers updates the online players of a server from a console line
+func trackPlayers(server *models.Server, line string) {
+	patterns := patternsFor(server.Type)
+
+	if patterns.started.MatchString(line) {
+		onlinePlayersMutex.Lock()
+		onlinePlayers[server.ID] = make(map[string]time.Time)
+		onlinePlayersMutex.Unlock()
+		return
+	}
+
+	if match := patterns.join.FindStringSubmatch(line); match != nil {
+		onlinePlayersMutex.Lock()
+		players, exists := onlinePlayers[server.ID]
+		if !exists {
+			players = make(map[string]time.Time)
+			onlinePlayers[server.ID] = players
+		}
+		players[strings.TrimSpace(match[1])] = time.Now()
+		onlinePlayersMutex.Unlock()
+		return
+	}
+
+	if match := patterns.leave.FindStringSubmatch(line); match != nil {
+		onlinePlayersMutex.Lock()
+		delete(onlinePlayers[server.ID], strings.TrimSpace(match[1]))
+		onlinePlayersMutex.Unlock()
+	}
+}
+
+// clearOnlinePlayers forgets a server's players once its process has exited
+func clearOnlinePlayers(serverID uuid.UUID) {
+	onlinePlayersMutex.Lock()
+	delete(onlinePlayers, serverID)
+	onlinePlayersMutex.Unlock()
+}
+
+// OnlinePlayers returns the players connected to a server, sorted by name,
+// from the join and leave lines tracked in its console. The first time a
+// server is asked about, its console log is replayed, and Java servers are
+// also asked with list in the background so players that joined while the
+// panel wasn't watching show up on the next read.
+func OnlinePlayers(server *models.Server) []OnlinePlayer {
+	if server.Status != models.ServerStatusRunning {
+		return []OnlinePlayer{}
+	}
+
+	onlinePlayersMutex.Lock()
+	players, exists := onlinePlayers[server.ID]
+	if !exists {
+		players = make(map[string]time.Time)
+		for name := range playersFromConsoleLog(server) {
+			players[name] = time.Time{}
+		}
+		onlinePlayers[server.ID] = players
+
+		if server.Type != models.ServerTypeBedrock && server.Type != models.ServerTypeProxy {
+			go refreshPlayersFromList(server)
+		}
+	}
+
+	result := make([]OnlinePlayer, 0, len(players))
+	for name, joinedAt := range players {
+		player := OnlinePlayer{Name: name}
+		if !joinedAt.IsZero() {
+			joined := joinedAt
+			player.JoinedAt = &joined
+		}
+		result = append(result, player)
+	}
+	onlinePlayersMutex.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return strings.ToLower(result[i].Name) < strings.ToLower(result[j].Name)
+	})
+	return result
+}
+
+// refreshPlayersFromList sends list and replaces the tracked players with
+// its reply, keeping the join time of players already known
+func refreshPlayersFromList(server *models.Server) {
+	watcher := watchServerLog(server.ID, javaListPattern)
+	defer watcher.Close()
+
+	if err := SendServerCommand(server, "list"); err != nil {
+		return
+	}
+
+	select {
+	case <-watcher.matched:
+	case <-time.After(playerConfirmTimeout):
+		return
+	}
+
+	match := javaListPattern.FindStringSubmatch(watcher.line)
+	if match == nil {
+		return
+	}
+
+	onlinePlayersMutex.Lock()
+	defer onlinePlayersMutex.Unlock()
+
+	previous := onlinePlayers[server.ID]
+	players := make(map[string]time.Time)
+	for _, name := range strings.Split(match[1], ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		players[name] = previous[name]
+	}
+	onlinePlayers[server.ID] = players
+}
+
+// consoleLine flattens text onto one console line, so it can't end the
+// command early and run a second one
+func consoleLine(text string) string {
+	return strings.TrimSpace(strings.NewReplacer("\r", " ", "\n", " ").Replace(text))
+}
+
+// PlayerAction kicks, bans, unbans, ops or deops a player, given by name or
+// UUID, with the command for the server type, and reports whether the
+// server confirmed it in the console within playerConfirmTimeout. The
+// command sent is returned.
+func PlayerAction(server *models.Server, action, player, reason string) (string, bool, error) {
+	// The commands take names, so a UUID is looked up
+	if _, err := uuid.Parse(player); err == nil {
+		name, _, err := resolvePlayer(server, "", player)
+		if err != nil {
+			return "", false, err
+		}
+		player = name
+	}
+	if !playerNamePattern.MatchString(player) {
+		return "", false, ErrInvalidPlayerName
+	}
+
+	var commands map[string]playerCommand
+	switch server.Type {
+	case models.ServerTypeBedrock:
+		commands = bedrockPlayerCommands
+	case models.ServerTypeProxy:
+		return "", false, ErrPlayerActionUnsupported
+	default:
+		commands = javaPlayerCommands
+	}
+
+	spec, exists := commands[action]
+	if !exists {
+		return "", false, ErrPlayerActionUnsupported
+	}
+
+	command := fmt.Sprintf(spec.command, player)
+	if reason = consoleLine(reason); spec.hasReason && reason != "" {
+		command += " " + reason
+	}
+
+	// Names are case-insensitive and the server echoes them as it knows them
+	confirm := regexp.MustCompile("(?i)" + fmt.Sprintf(spec.confirm, regexp.QuoteMeta(player)))
+	watcher := watchServerLog(server.ID, confirm)
+	defer watcher.Close()
+
+	if err := SendServerCommand(server, command); err != nil {
+		return command, false, err
+	}
+
+	select {
+	case <-watcher.matched:
+		return command, true, nil
+	case <-time.After(playerConfirmTimeout):
+		return command, false, nil
+	}
+}
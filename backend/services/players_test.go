@@ -0,0 +1,178 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// onlinePlayerNames returns the names OnlinePlayers reports, in its order
+func onlinePlayerNames(server *models.Server) []string {
+	names := []string{}
+	for _, player := range OnlinePlayers(server) {
+		names = append(names, player.Name)
+	}
+	return names
+}
+
+func TestTrackPlayersFromLogLines(t *testing.T) {
+	tests := []struct {
+		serverType models.ServerType
+		join       func(name string) string
+		leave      func(name string) string
+		started    string
+	}{
+		{
+			serverType: models.ServerTypePaper,
+			join:       func(name string) string { return "[12:00:00 INFO]: " + name + " joined the game" },
+			leave:      func(name string) string { return "[12:00:00 INFO]: " + name + " left the game" },
+			started:    `[12:00:00 INFO]: Done (3.512s)! For help, type "help"`,
+		},
+		{
+			serverType: models.ServerTypeBedrock,
+			join: func(name string) string {
+				return "[2024-01-01 12:00:00:000 INFO] Player connected: " + name + ", xuid: 2535400000000000"
+			},
+			leave: func(name string) string {
+				return "[2024-01-01 12:00:00:000 INFO] Player disconnected: " + name + ", xuid: 2535400000000000"
+			},
+			started: "[2024-01-01 12:00:00:000 INFO] Server started.",
+		},
+	}
+
+	for _, tt := range tests {
+		server := &models.Server{ID: uuid.New(), Type: tt.serverType, Status: models.ServerStatusRunning}
+		t.Cleanup(func() { clearOnlinePlayers(server.ID) })
+
+		trackPlayers(server, tt.started)
+		for _, line := range []string{
+			tt.join("Steve"),
+			tt.join("alex"),
+			tt.join("Notch"),
+			"[12:00:00 INFO]: <Steve> Notch joined the game", // chat, not a join
+			tt.leave("Notch"),
+			tt.leave("Herobrine"), // never joined
+		} {
+			trackPlayers(server, line)
+		}
+
+		if got := strings.Join(onlinePlayerNames(server), ","); got != "alex,Steve" {
+			t.Errorf("%s: players = %s, want alex,Steve", tt.serverType, got)
+		}
+		for _, player := range OnlinePlayers(server) {
+			if player.JoinedAt == nil || time.Since(*player.JoinedAt) > time.Minute {
+				t.Errorf("%s: %s joined at %v, want the time of the join line", tt.serverType, player.Name, player.JoinedAt)
+			}
+		}
+
+		// A restart starts from nobody
+		trackPlayers(server, tt.started)
+		if got := onlinePlayerNames(server); len(got) != 0 {
+			t.Errorf("%s: players after a restart = %v, want none", tt.serverType, got)
+		}
+
+		// Nobody is online on a stopped server
+		trackPlayers(server, tt.join("Steve"))
+		server.Status = models.ServerStatusStopped
+		if got := onlinePlayerNames(server); len(got) != 0 {
+			t.Errorf("%s: players of a stopped server = %v, want none", tt.serverType, got)
+		}
+	}
+}
+
+func TestOnlinePlayersReplaysConsoleLog(t *testing.T) {
+	server := &models.Server{ID: uuid.New(), Type: models.ServerTypeBedrock, Status: models.ServerStatusRunning, Path: t.TempDir()}
+	t.Cleanup(func() { clearOnlinePlayers(server.ID) })
+
+	console := strings.Join([]string{
+		"[2024-01-01 11:00:00] Player connected: Old, xuid: 1",
+		"[2024-01-01 12:00:00] Server started.",
+		"[2024-01-01 12:01:00] Player connected: Steve, xuid: 2",
+		"[2024-01-01 12:02:00] Player connected: Alex, xuid: 3",
+		"[2024-01-01 12:03:00] Player disconnected: Alex, xuid: 3",
+	}, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(server.Path, "console.log"), []byte(console), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	players := OnlinePlayers(server)
+	if len(players) != 1 || players[0].Name != "Steve" || players[0].JoinedAt != nil {
+		t.Errorf("players = %+v, want Steve from the log with no known join time", players)
+	}
+}
+
+func TestPlayerActionRejectsBeforeSending(t *testing.T) {
+	paper := &models.Server{ID: uuid.New(), Type: models.ServerTypePaper}
+	bedrock := &models.Server{ID: uuid.New(), Type: models.ServerTypeBedrock}
+	proxy := &models.Server{ID: uuid.New(), Type: models.ServerTypeProxy}
+
+	tests := []struct {
+		server *models.Server
+		action string
+		player string
+		err    error
+	}{
+		{paper, PlayerActionKick, "Steve; stop", ErrInvalidPlayerName},
+		{paper, PlayerActionKick, "Steve\nstop", ErrInvalidPlayerName},
+		{paper, PlayerActionKick, "AVeryLongPlayerName", ErrInvalidPlayerName},
+		{paper, PlayerActionKick, "", ErrInvalidPlayerName},
+		{paper, "smite", "Steve", ErrPlayerActionUnsupported},
+		{bedrock, PlayerActionBan, "Steve", ErrPlayerActionUnsupported},
+		{bedrock, PlayerActionUnban, "Steve", ErrPlayerActionUnsupported},
+		{proxy, PlayerActionKick, "Steve", ErrPlayerActionUnsupported},
+	}
+	for _, tt := range tests {
+		if _, _, err := PlayerAction(tt.server, tt.action, tt.player, ""); !errors.Is(err, tt.err) {
+			t.Errorf("%s %s %q = %v, want %v", tt.server.Type, tt.action, tt.player, err, tt.err)
+		}
+	}
+}
+
+// lastServerCommand waits for the fake server to log a console command and
+// returns the last one received, or "" when none arrives
+func lastServerCommand(server *models.Server) string {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		data, _ := os.ReadFile(filepath.Join(server.Path, "commands.txt"))
+		if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); lines[0] != "" {
+			return lines[len(lines)-1]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return ""
+}
+
+func TestPlayerActionKickSendsCommand(t *testing.T) {
+	testDB(t)
+	server := testutil.CreateServer(t, &models.Server{})
+	startFakeServer(t, server)
+
+	// The server confirms the kick the way vanilla does
+	go func() {
+		if command := lastServerCommand(server); strings.HasPrefix(command, "kick ") {
+			publishServerLogLine(server.ID, "[12:00:00 INFO]: Kicked steve: Griefing the spawn")
+		}
+	}()
+
+	command, confirmed, err := PlayerAction(server, PlayerActionKick, "Steve", "Griefing\nthe spawn")
+	if err != nil {
+		t.Fatalf("PlayerAction: %v", err)
+	}
+	if command != "kick Steve Griefing the spawn" {
+		t.Errorf("command = %q, want the kick with the reason on one line", command)
+	}
+	if got := lastServerCommand(server); got != command {
+		t.Errorf("server received %q, want %q", got, command)
+	}
+	if !confirmed {
+		t.Error("kick not confirmed though the server reported it")
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrPluginNotPurchased is returned when installing a paid marketplace
+	// item the user has not bought
+	ErrPluginNotPurchased = errors.New("marketplace item has not been purchased")
+	// ErrPluginAlreadyInstalled is returned when the item, or a file with the
+	// same name, is already installed on the server
+	ErrPluginAlreadyInstalled = errors.New("plugin is already installed")
+)
+
+// marketplaceItem is the part of a marketplace item needed to install and
+// pay for it
+type marketplaceItem struct {
+	Name     string
+	IsFree   bool
+	Price    float64
+	AuthorID uuid.UUID
+}
+
+// InstallMarketplacePlugin installs an approved marketplace version on the
+// server and records it against that version, so it can later be rolled
+// back. The same compatibility, security and purchase checks apply as in the
+// marketplace, and the server must be stopped.
+func InstallMarketplacePlugin(server *models.Server, userID, versionID uuid.UUID) (*models.Plugin, error) {
+	if server.Status != models.ServerStatusStopped && server.Status != models.ServerStatusCrashed {
+		return nil, ErrServerRunning
+	}
+
+	var version models.MarketplaceVersion
+	if err := database.DB.Where("id = ? AND status = ?", versionID, "approved").First(&version).Error; err != nil {
+		return nil, ErrPluginVersionNotFound
+	}
+
+	if err := checkVersionCompatibility(server, &version); err != nil {
+		return nil, err
+	}
+
+	if version.SecurityScan.OverallScore < minPluginSecurityScore || version.SecurityScan.SafetyRating == "dangerous" {
+		return nil, ErrPluginVersionUnsafe
+	}
+
+	var item marketplaceItem
+	if err := database.DB.Table("marketplace_items").Select("name, is_free, price, author_id").
+		Where("id = ? AND status = ?", version.ItemID, "approved").Take(&item).Error; err != nil {
+		return nil, ErrPluginVersionNotFound
+	}
+
+	if !item.IsFree && item.Price != 0 && item.AuthorID != userID {
+		var purchases int64
+		if err := database.DB.Table("purchases").
+			Where("item_id = ? AND user_id = ? AND status = ?", version.ItemID, userID, "completed").
+			Count(&purchases).Error; err != nil {
+			return nil, fmt.Errorf("failed to check purchase: %v", err)
+		}
+		if purchases == 0 {
+			return nil, ErrPluginNotPurchased
+		}
+	}
+
+	// Another version of the item is replaced through rollback, not reinstalled
+	var installed int64
+	database.DB.Model(&models.Plugin{}).
+		Where("server_id = ? AND item_version_id IN (?)", server.ID,
+			database.DB.Model(&models.MarketplaceVersion{}).Select("id").Where("item_id = ?", version.ItemID)).
+		Count(&installed)
+	if installed > 0 {
+		return nil, ErrPluginAlreadyInstalled
+	}
+
+	// Name the file after the download, falling back to the item's name
+	fileName := ""
+	if u, err := url.Parse(version.DownloadURL); err == nil {
+		fileName = utils.SanitizeFilename(path.Base(u.Path))
+	}
+	if fileName == "" || !strings.HasSuffix(strings.ToLower(fileName), ".jar") {
+		fileName = utils.SanitizeFilename(item.Name) + ".jar"
+	}
+
+	pluginDir := filepath.Join(server.Path, pluginDirectory(server.Type))
+	if err := utils.CreateDirectory(pluginDir); err != nil {
+		return nil, fmt.Errorf("failed to create plugin directory: %v", err)
+	}
+
+	filePath := filepath.Join(pluginDir, fileName)
+	if utils.FileExists(filePath) {
+		return nil, ErrPluginAlreadyInstalled
+	}
+
+	if err := downloadFileVerified(context.Background(), version.DownloadURL, filePath, DownloadOptions{SHA256: version.FileHash}); err != nil {
+		return nil, fmt.Errorf("failed to download plugin: %w", err)
+	}
+
+	plugin := models.Plugin{
+		ServerID:      server.ID,
+		Name:          item.Name,
+		Version:       version.Version,
+		FileName:      fileName,
+		FilePath:      filePath,
+		Source:        models.PluginSourceMarketplace,
+		SourceID:      version.ItemID.String(),
+		IsEnabled:     true,
+		InstallDate:   time.Now(),
+		ItemVersionID: &version.ID,
+	}
+	if size, err := utils.GetFileSize(filePath); err == nil {
+		plugin.FileSize = size
+	}
+
+	if err := database.DB.Omit("Server").Create(&plugin).Error; err != nil {
+		os.Remove(filePath)
+		return nil, fmt.Errorf("failed to save plugin: %v", err)
+	}
+
+	return &plugin, nil
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+)
+
+// minPluginSecurityScore is the lowest marketplace security score a version
+// may have to be installed, the same bar the marketplace uses
+const minPluginSecurityScore = 0.7
+
+var (
+	// ErrPluginNotFromMarketplace is returned when rolling back a plugin that
+	// was not installed from a marketplace version
+	ErrPluginNotFromMarketplace = errors.New("plugin was not installed from the marketplace")
+	// ErrPluginVersionNotFound is returned for a version that is not an
+	// approved, earlier release of the installed item
+	ErrPluginVersionNotFound = errors.New("plugin version not found")
+	// ErrPluginVersionIncompatible is returned for a version that does not
+	// support the server's type or Minecraft version
+	ErrPluginVersionIncompatible = errors.New("plugin version is not compatible with this server")
+	// ErrPluginVersionUnsafe is returned for a version that has not passed
+	// the marketplace security scan
+	ErrPluginVersionUnsafe = errors.New("plugin version failed its security scan")
+)
+
+// RollbackPlugin reinstalls an earlier approved marketplace version of a
+// plugin. The target version must support the server and have passed its
+// security scan. As with updates, the server must be stopped and the current
+// file is kept in .backups. When pin is set the plugin is also pinned, so
+// update checks leave the rolled back version alone.
+func RollbackPlugin(server *models.Server, pluginID, versionID uuid.UUID, pin bool) (*models.Plugin, error) {
+	if server.Status != models.ServerStatusStopped && server.Status != models.ServerStatusCrashed {
+		return nil, ErrServerRunning
+	}
+
+	var plugin models.Plugin
+	if err := database.DB.Where("id = ? AND server_id = ?", pluginID, server.ID).First(&plugin).Error; err != nil {
+		return nil, ErrPluginNotFound
+	}
+
+	if plugin.ItemVersionID == nil {
+		return nil, ErrPluginNotFromMarketplace
+	}
+
+	var installed models.MarketplaceVersion
+	if err := database.DB.First(&installed, "id = ?", *plugin.ItemVersionID).Error; err != nil {
+		return nil, ErrPluginNotFromMarketplace
+	}
+
+	var target models.MarketplaceVersion
+	if err := database.DB.Where("id = ? AND item_id = ? AND status = ? AND created_at < ?",
+		versionID, installed.ItemID, "approved", installed.CreatedAt).First(&target).Error; err != nil {
+		return nil, ErrPluginVersionNotFound
+	}
+
+	if err := checkVersionCompatibility(server, &target); err != nil {
+		return nil, err
+	}
+
+	if target.SecurityScan.OverallScore < minPluginSecurityScore || target.SecurityScan.SafetyRating == "dangerous" {
+		return nil, ErrPluginVersionUnsafe
+	}
+
+	// Name the file after the download, falling back to the plugin's name
+	fileName := ""
+	if u, err := url.Parse(target.DownloadURL); err == nil {
+		fileName = path.Base(u.Path)
+	}
+
+	newPath, err := replacePluginFile(&plugin, target.DownloadURL, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	plugin.Version = target.Version
+	plugin.ItemVersionID = &target.ID
+	plugin.FileName = filepath.Base(newPath)
+	plugin.FilePath = newPath
+	plugin.UpdateDate = &now
+	plugin.UpdateAvailable = false
+	if pin {
+		plugin.Pinned = true
+	}
+	if size, err := utils.GetFileSize(newPath); err == nil {
+		plugin.FileSize = size
+	}
+
+	if err := database.DB.Omit("Server").Save(&plugin).Error; err != nil {
+		return nil, fmt.Errorf("failed to save plugin: %v", err)
+	}
+
+	return &plugin, nil
+}
+
+// SetPluginPinned pins or unpins a plugin. Pinning also clears any pending
+// update so the plugin no longer shows up as updatable.
+func SetPluginPinned(server *models.Server, pluginID uuid.UUID, pinned bool) (*models.Plugin, error) {
+	var plugin models.Plugin
+	if err := database.DB.Where("id = ? AND server_id = ?", pluginID, server.ID).First(&plugin).Error; err != nil {
+		return nil, ErrPluginNotFound
+	}
+
+	updates := map[string]interface{}{"pinned": pinned}
+	if pinned {
+		updates["update_available"] = false
+	}
+	if err := database.DB.Model(&plugin).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to save plugin: %v", err)
+	}
+
+	return &plugin, nil
+}
+
+// checkVersionCompatibility checks the server's type and Minecraft version
+// against those a marketplace version lists. An empty list allows any.
+func checkVersionCompatibility(server *models.Server, version *models.MarketplaceVersion) error {
+	contains := func(values []string, value string) bool {
+		for _, v := range values {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(version.ServerTypes) > 0 && !contains(version.ServerTypes, string(server.Type)) {
+		return ErrPluginVersionIncompatible
+	}
+	if len(version.MinecraftVersions) > 0 && server.Version != "" && !contains(version.MinecraftVersions, server.Version) {
+		return ErrPluginVersionIncompatible
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// createTestVersion saves a marketplace version made age ago and deletes it
+// when the test ends
+func createTestVersion(t *testing.T, version *models.MarketplaceVersion, age time.Duration) *models.MarketplaceVersion {
+	t.Helper()
+
+	version.CreatedAt = time.Now().Add(-age)
+	if err := database.DB.Create(version).Error; err != nil {
+		t.Fatalf("failed to create version: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Delete(&models.MarketplaceVersion{}, "id = ?", version.ID) })
+	return version
+}
+
+func TestRollbackPluginToVersion(t *testing.T) {
+	testDB(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/files/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("jar " + filepath.Base(r.URL.Path)))
+	})
+	files := httptest.NewServer(mux)
+	t.Cleanup(files.Close)
+
+	server := testutil.CreateServer(t, &models.Server{Version: "1.20.4"})
+	itemID := uuid.New()
+	safe := models.MarketplaceSecurityScan{OverallScore: 0.95, SafetyRating: "safe"}
+	version := func(name string, age time.Duration, change func(*models.MarketplaceVersion)) *models.MarketplaceVersion {
+		v := &models.MarketplaceVersion{
+			ItemID:            itemID,
+			Version:           name,
+			MinecraftVersions: []string{"1.20.1", "1.20.4"},
+			ServerTypes:       []string{"paper", "spigot"},
+			DownloadURL:       files.URL + "/files/Homes-" + name + ".jar",
+			SecurityScan:      safe,
+			Status:            "approved",
+		}
+		if change != nil {
+			change(v)
+		}
+		return createTestVersion(t, v, age)
+	}
+
+	target := version("1.0.0", 5*time.Hour, nil)
+	otherLoader := version("1.1.0", 4*time.Hour, func(v *models.MarketplaceVersion) { v.ServerTypes = []string{"fabric"} })
+	otherMinecraft := version("1.2.0", 3*time.Hour, func(v *models.MarketplaceVersion) { v.MinecraftVersions = []string{"1.19.4"} })
+	unsafe := version("1.3.0", 2*time.Hour, func(v *models.MarketplaceVersion) { v.SecurityScan.OverallScore = 0.4 })
+	pending := version("1.3.1", 90*time.Minute, func(v *models.MarketplaceVersion) { v.Status = "pending" })
+	installed := version("1.4.0", time.Hour, nil)
+	newer := version("1.5.0", 0, nil)
+	otherItem := createTestVersion(t, &models.MarketplaceVersion{ItemID: uuid.New(), Version: "0.9.0", Status: "approved", SecurityScan: safe}, 6*time.Hour)
+
+	plugin := createTestPlugin(t, server, &models.Plugin{
+		Name:          "Homes",
+		Version:       "1.4.0",
+		Source:        models.PluginSourceMarketplace,
+		ItemVersionID: &installed.ID,
+	})
+	if err := os.MkdirAll(filepath.Dir(plugin.FilePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(plugin.FilePath, []byte("jar 1.4.0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		version *models.MarketplaceVersion
+		err     error
+	}{
+		{otherLoader, ErrPluginVersionIncompatible},
+		{otherMinecraft, ErrPluginVersionIncompatible},
+		{unsafe, ErrPluginVersionUnsafe},
+		{pending, ErrPluginVersionNotFound},
+		{installed, ErrPluginVersionNotFound},
+		{newer, ErrPluginVersionNotFound}, // not a rollback
+		{otherItem, ErrPluginVersionNotFound},
+	}
+	for _, tt := range tests {
+		if _, err := RollbackPlugin(server, plugin.ID, tt.version.ID, false); !errors.Is(err, tt.err) {
+			t.Errorf("rollback to %s = %v, want %v", tt.version.Version, err, tt.err)
+		}
+	}
+	if content, _ := os.ReadFile(plugin.FilePath); string(content) != "jar 1.4.0" {
+		t.Fatalf("a refused rollback replaced the plugin file with %q", content)
+	}
+
+	server.Status = models.ServerStatusRunning
+	if _, err := RollbackPlugin(server, plugin.ID, target.ID, true); !errors.Is(err, ErrServerRunning) {
+		t.Errorf("rollback on a running server = %v, want ErrServerRunning", err)
+	}
+	server.Status = models.ServerStatusStopped
+
+	rolledBack, err := RollbackPlugin(server, plugin.ID, target.ID, true)
+	if err != nil {
+		t.Fatalf("RollbackPlugin: %v", err)
+	}
+	if rolledBack.Version != "1.0.0" || rolledBack.ItemVersionID == nil || *rolledBack.ItemVersionID != target.ID || !rolledBack.Pinned {
+		t.Errorf("plugin = %+v, want version 1.0.0 installed and pinned", rolledBack)
+	}
+	if content, err := os.ReadFile(rolledBack.FilePath); err != nil || string(content) != "jar Homes-1.0.0.jar" {
+		t.Errorf("installed file = %q, %v, want the 1.0.0 download", content, err)
+	}
+	if rolledBack.FileName != "Homes-1.0.0.jar" {
+		t.Errorf("file name = %q, want the download's name", rolledBack.FileName)
+	}
+	backups, _ := filepath.Glob(filepath.Join(filepath.Dir(plugin.FilePath), ".backups", "Homes.jar.*"))
+	if len(backups) != 1 {
+		t.Errorf("backups = %v, want the 1.4.0 file kept", backups)
+	}
+
+	var stored models.Plugin
+	database.DB.First(&stored, "id = ?", plugin.ID)
+	if stored.Version != "1.0.0" || !stored.Pinned || stored.ItemVersionID == nil || *stored.ItemVersionID != target.ID {
+		t.Errorf("stored plugin = %+v, want the rollback saved", stored)
+	}
+
+	// A plugin from outside the marketplace has no versions to go back to
+	manual := createTestPlugin(t, server, &models.Plugin{Name: "Manual", Version: "1.0", Source: models.PluginSourceManual})
+	if _, err := RollbackPlugin(server, manual.ID, target.ID, false); !errors.Is(err, ErrPluginNotFromMarketplace) {
+		t.Errorf("rollback of a manual plugin = %v, want ErrPluginNotFromMarketplace", err)
+	}
+}
+
+func TestCheckPluginUpdatesSkipsPinned(t *testing.T) {
+	testDB(t)
+
+	var mutex sync.Mutex
+	var asked []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/modrinth/project/", func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		asked = append(asked, strings.Split(strings.TrimPrefix(r.URL.Path, "/modrinth/project/"), "/")[0])
+		mutex.Unlock()
+		w.Write([]byte(`[{"version_number": "2.0.0", "files": [{"url": "https://cdn.example/plugin-2.0.0.jar", "filename": "plugin-2.0.0.jar", "primary": true}]}]`))
+	})
+	useTestPluginSources(t, mux)
+
+	server := testutil.CreateServer(t, &models.Server{Version: "1.20.4"})
+	free := createTestPlugin(t, server, &models.Plugin{Name: "Free", Version: "1.0.0", Source: models.PluginSourceModrinth, SourceID: "free"})
+	pinned := createTestPlugin(t, server, &models.Plugin{Name: "Pinned", Version: "1.0.0", Source: models.PluginSourceModrinth, SourceID: "pinned", Pinned: true})
+
+	if _, err := CheckPluginUpdates(context.Background(), server); err != nil {
+		t.Fatalf("CheckPluginUpdates: %v", err)
+	}
+
+	mutex.Lock()
+	if len(asked) != 1 || asked[0] != "free" {
+		t.Errorf("sources asked about %v, want only the unpinned plugin", asked)
+	}
+	mutex.Unlock()
+
+	var current models.Plugin
+	database.DB.First(&current, "id = ?", free.ID)
+	if !current.UpdateAvailable || current.LatestVersion != "2.0.0" {
+		t.Errorf("unpinned plugin = %+v, want 2.0.0 available", current)
+	}
+	database.DB.First(&current, "id = ?", pinned.ID)
+	if current.UpdateAvailable || current.LatestVersion != "" {
+		t.Errorf("pinned plugin = %+v, want it left unchecked", current)
+	}
+
+	// Pinning clears a pending update and blocks updating
+	if _, err := SetPluginPinned(server, free.ID, true); err != nil {
+		t.Fatalf("SetPluginPinned: %v", err)
+	}
+	database.DB.First(&current, "id = ?", free.ID)
+	if !current.Pinned || current.UpdateAvailable {
+		t.Errorf("after pinning, plugin = %+v, want pinned with no update pending", current)
+	}
+	if _, err := UpdatePlugin(server, free.ID); !errors.Is(err, ErrPluginPinned) {
+		t.Errorf("UpdatePlugin on a pinned plugin = %v, want ErrPluginPinned", err)
+	}
+}
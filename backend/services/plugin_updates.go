@@ -0,0 +1,364 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+)
+
+// pluginUpdateInterval is how often installed plugins are checked for updates
+const pluginUpdateInterval = 6 * time.Hour
+
+var (
+	// ErrPluginNotFound is returned for a plugin that is not on the server
+	ErrPluginNotFound = errors.New("plugin not found")
+	// ErrNoPluginUpdate is returned when a plugin has no known update
+	ErrNoPluginUpdate = errors.New("no update available")
+	// ErrPluginSourceUnsupported is returned for plugins without an update source
+	ErrPluginSourceUnsupported = errors.New("plugin source does not support updates")
+	// ErrPluginPinned is returned when updating a plugin pinned to its version
+	ErrPluginPinned = errors.New("plugin is pinned")
+)
+
+// Source API base URLs, variables so they can point at a mock server
+var (
+	modrinthAPIBase   = "https://api.modrinth.com/v2"
+	curseForgeAPIBase = "https://api.curseforge.com/v1"
+	githubAPIBase     = "https://api.github.com"
+)
+
+// pluginRelease is the newest release of a plugin found at its source
+type pluginRelease struct {
+	Version     string
+	FileName    string
+	DownloadURL string
+}
+
+// PluginUpdater checks installed plugins against their source for newer releases
+type PluginUpdater struct {
+	client           *http.Client
+	curseForgeAPIKey string
+}
+
+var pluginUpdater *PluginUpdater
+
+// InitializePluginUpdater starts the periodic plugin update check
+func InitializePluginUpdater(cfg *config.Config) {
+	pluginUpdater = &PluginUpdater{
+		client:           &http.Client{Timeout: 30 * time.Second},
+		curseForgeAPIKey: cfg.ExternalAPIs.CurseForgeAPIKey,
+	}
+
+	go pluginUpdater.startChecker()
+}
+
+// CheckPluginUpdates checks every updatable plugin on a server and records
+// the result. Plugins whose source cannot be reached keep their last result,
+// and pinned plugins are skipped.
+func CheckPluginUpdates(ctx context.Context, server *models.Server) ([]models.Plugin, error) {
+	var plugins []models.Plugin
+	if err := database.DB.Where("server_id = ? AND pinned = ? AND source IN ? AND source_id <> ''", server.ID, false, []models.PluginSource{
+		models.PluginSourceModrinth, models.PluginSourceCurseForge, models.PluginSourceGitHub,
+	}).Find(&plugins).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range plugins {
+		if err := pluginUpdater.checkPlugin(ctx, server, &plugins[i]); err != nil {
+			log.Printf("Failed to check %s for updates on server %s: %v", plugins[i].Name, server.Name, err)
+		}
+	}
+
+	return plugins, nil
+}
+
+// UpdatePlugin installs the latest known release of a plugin. The server must
+// be stopped, as plugins are only loaded at startup. The old file is kept in
+// the plugin directory's .backups folder.
+func UpdatePlugin(server *models.Server, pluginID uuid.UUID) (*models.Plugin, error) {
+	if server.Status != models.ServerStatusStopped && server.Status != models.ServerStatusCrashed {
+		return nil, ErrServerRunning
+	}
+
+	var plugin models.Plugin
+	if err := database.DB.Where("id = ? AND server_id = ?", pluginID, server.ID).First(&plugin).Error; err != nil {
+		return nil, ErrPluginNotFound
+	}
+
+	if plugin.Pinned {
+		return nil, ErrPluginPinned
+	}
+
+	if !plugin.UpdateAvailable || plugin.LatestDownloadURL == "" {
+		return nil, ErrNoPluginUpdate
+	}
+
+	newPath, err := replacePluginFile(&plugin, plugin.LatestDownloadURL, plugin.LatestFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	plugin.Version = plugin.LatestVersion
+	plugin.FileName = filepath.Base(newPath)
+	plugin.FilePath = newPath
+	plugin.UpdateDate = &now
+	plugin.UpdateAvailable = false
+	// The file now comes from the plugin's source, not a marketplace version
+	plugin.ItemVersionID = nil
+	if size, err := utils.GetFileSize(newPath); err == nil {
+		plugin.FileSize = size
+	}
+
+	if err := database.DB.Omit("Server").Save(&plugin).Error; err != nil {
+		return nil, fmt.Errorf("failed to save plugin: %v", err)
+	}
+
+	return &plugin, nil
+}
+
+// replacePluginFile downloads downloadURL next to the plugin and swaps it in,
+// moving the current file to the plugin directory's .backups folder. It
+// returns the path of the new file.
+func replacePluginFile(plugin *models.Plugin, downloadURL, fileName string) (string, error) {
+	pluginDir := filepath.Dir(plugin.FilePath)
+	fileName = utils.SanitizeFilename(fileName)
+	if fileName == "" || !strings.HasSuffix(strings.ToLower(fileName), ".jar") {
+		fileName = utils.SanitizeFilename(plugin.Name) + ".jar"
+	}
+	newPath := filepath.Join(pluginDir, fileName)
+
+	// Download next to the plugins so the swap is a same-filesystem rename
+	tempPath := newPath + ".download"
+	if err := downloadFile(downloadURL, tempPath); err != nil {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("failed to download plugin: %v", err)
+	}
+
+	if utils.FileExists(plugin.FilePath) {
+		backupDir := filepath.Join(pluginDir, ".backups")
+		if err := utils.CreateDirectory(backupDir); err != nil {
+			os.Remove(tempPath)
+			return "", fmt.Errorf("failed to create backup directory: %v", err)
+		}
+		backupName := fmt.Sprintf("%s.%s", filepath.Base(plugin.FilePath), time.Now().Format("20060102-150405"))
+		if err := os.Rename(plugin.FilePath, filepath.Join(backupDir, backupName)); err != nil {
+			os.Remove(tempPath)
+			return "", fmt.Errorf("failed to back up old plugin: %v", err)
+		}
+	}
+
+	if err := os.Rename(tempPath, newPath); err != nil {
+		return "", fmt.Errorf("failed to install plugin: %v", err)
+	}
+
+	return newPath, nil
+}
+
+func (pu *PluginUpdater) startChecker() {
+	ticker := time.NewTicker(pluginUpdateInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var servers []models.Server
+		database.DB.Find(&servers)
+
+		for i := range servers {
+			CheckPluginUpdates(context.Background(), &servers[i])
+		}
+	}
+}
+
+func (pu *PluginUpdater) checkPlugin(ctx context.Context, server *models.Server, plugin *models.Plugin) error {
+	release, err := pu.latestRelease(ctx, server, plugin)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	plugin.LastUpdateCheck = &now
+	plugin.LatestVersion = release.Version
+	plugin.LatestFileName = release.FileName
+	plugin.LatestDownloadURL = release.DownloadURL
+	plugin.UpdateAvailable = release.DownloadURL != "" && normalizePluginVersion(release.Version) != normalizePluginVersion(plugin.Version)
+
+	return database.DB.Model(plugin).Updates(map[string]interface{}{
+		"last_update_check":   plugin.LastUpdateCheck,
+		"latest_version":      plugin.LatestVersion,
+		"latest_file_name":    plugin.LatestFileName,
+		"latest_download_url": plugin.LatestDownloadURL,
+		"update_available":    plugin.UpdateAvailable,
+	}).Error
+}
+
+func (pu *PluginUpdater) latestRelease(ctx context.Context, server *models.Server, plugin *models.Plugin) (*pluginRelease, error) {
+	switch plugin.Source {
+	case models.PluginSourceModrinth:
+		return pu.latestModrinthRelease(ctx, server, plugin.SourceID)
+	case models.PluginSourceCurseForge:
+		return pu.latestCurseForgeRelease(ctx, server, plugin.SourceID)
+	case models.PluginSourceGitHub:
+		return pu.latestGitHubRelease(ctx, plugin.SourceID)
+	default:
+		return nil, ErrPluginSourceUnsupported
+	}
+}
+
+// latestModrinthRelease returns the newest version for the server's loader and
+// Minecraft version. Modrinth lists versions newest first.
+func (pu *PluginUpdater) latestModrinthRelease(ctx context.Context, server *models.Server, projectID string) (*pluginRelease, error) {
+	query := url.Values{}
+	query.Set("loaders", fmt.Sprintf("[%q]", modrinthLoader(server.Type)))
+	if server.Version != "" && server.Version != "latest" {
+		query.Set("game_versions", fmt.Sprintf("[%q]", server.Version))
+	}
+
+	var versions []struct {
+		VersionNumber string `json:"version_number"`
+		Files         []struct {
+			URL      string `json:"url"`
+			Filename string `json:"filename"`
+			Primary  bool   `json:"primary"`
+		} `json:"files"`
+	}
+	endpoint := fmt.Sprintf("%s/project/%s/version?%s", modrinthAPIBase, url.PathEscape(projectID), query.Encode())
+	if err := pu.getJSON(ctx, endpoint, nil, &versions); err != nil {
+		return nil, err
+	}
+
+	if len(versions) == 0 || len(versions[0].Files) == 0 {
+		return nil, fmt.Errorf("no compatible Modrinth versions for project %s", projectID)
+	}
+
+	latest := versions[0]
+	file := latest.Files[0]
+	for _, f := range latest.Files {
+		if f.Primary {
+			file = f
+			break
+		}
+	}
+
+	return &pluginRelease{Version: latest.VersionNumber, FileName: file.Filename, DownloadURL: file.URL}, nil
+}
+
+func (pu *PluginUpdater) latestCurseForgeRelease(ctx context.Context, server *models.Server, modID string) (*pluginRelease, error) {
+	if pu.curseForgeAPIKey == "" {
+		return nil, fmt.Errorf("CurseForge API key not configured")
+	}
+
+	query := url.Values{}
+	query.Set("pageSize", "50")
+	if server.Version != "" && server.Version != "latest" {
+		query.Set("gameVersion", server.Version)
+	}
+
+	var response struct {
+		Data []struct {
+			DisplayName string    `json:"displayName"`
+			FileName    string    `json:"fileName"`
+			DownloadURL string    `json:"downloadUrl"`
+			FileDate    time.Time `json:"fileDate"`
+		} `json:"data"`
+	}
+	endpoint := fmt.Sprintf("%s/mods/%s/files?%s", curseForgeAPIBase, url.PathEscape(modID), query.Encode())
+	headers := map[string]string{"x-api-key": pu.curseForgeAPIKey}
+	if err := pu.getJSON(ctx, endpoint, headers, &response); err != nil {
+		return nil, err
+	}
+
+	if len(response.Data) == 0 {
+		return nil, fmt.Errorf("no compatible CurseForge files for mod %s", modID)
+	}
+
+	files := response.Data
+	sort.Slice(files, func(i, j int) bool { return files[i].FileDate.After(files[j].FileDate) })
+	latest := files[0]
+
+	return &pluginRelease{Version: latest.DisplayName, FileName: latest.FileName, DownloadURL: latest.DownloadURL}, nil
+}
+
+// latestGitHubRelease reads the latest release of an "owner/repo" and picks
+// its first jar asset
+func (pu *PluginUpdater) latestGitHubRelease(ctx context.Context, repo string) (*pluginRelease, error) {
+	var release struct {
+		TagName string `json:"tag_name"`
+		Assets  []struct {
+			Name               string `json:"name"`
+			BrowserDownloadURL string `json:"browser_download_url"`
+		} `json:"assets"`
+	}
+	endpoint := fmt.Sprintf("%s/repos/%s/releases/latest", githubAPIBase, strings.Trim(repo, "/"))
+	headers := map[string]string{"Accept": "application/vnd.github+json"}
+	if err := pu.getJSON(ctx, endpoint, headers, &release); err != nil {
+		return nil, err
+	}
+
+	for _, asset := range release.Assets {
+		if strings.HasSuffix(strings.ToLower(asset.Name), ".jar") {
+			return &pluginRelease{Version: release.TagName, FileName: asset.Name, DownloadURL: asset.BrowserDownloadURL}, nil
+		}
+	}
+
+	return &pluginRelease{Version: release.TagName}, nil
+}
+
+func (pu *PluginUpdater) getJSON(ctx context.Context, endpoint string, headers map[string]string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "playpulse-panel")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := pu.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request to %s failed: %s", req.URL.Host, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+// modrinthLoader maps a server type to its Modrinth loader name
+func modrinthLoader(serverType models.ServerType) string {
+	switch serverType {
+	case models.ServerTypeFabric:
+		return "fabric"
+	case models.ServerTypeForge:
+		return "forge"
+	case models.ServerTypeSpigot:
+		return "spigot"
+	case models.ServerTypePurpur:
+		return "purpur"
+	default:
+		return "paper"
+	}
+}
+
+// normalizePluginVersion makes "v1.2.0" and "1.2.0" compare equal
+func normalizePluginVersion(version string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(version)), "v")
+}
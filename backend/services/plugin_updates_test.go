@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+)
+
+// useTestPluginSources points the plugin updater's source APIs at a mock
+// serving mux until the test ends, and returns the mock's URL
+func useTestPluginSources(t *testing.T, mux *http.ServeMux) string {
+	t.Helper()
+
+	source := httptest.NewServer(mux)
+	t.Cleanup(source.Close)
+
+	previousUpdater := pluginUpdater
+	previousModrinth, previousCurseForge, previousGitHub := modrinthAPIBase, curseForgeAPIBase, githubAPIBase
+	pluginUpdater = &PluginUpdater{client: source.Client(), curseForgeAPIKey: "test-key"}
+	modrinthAPIBase = source.URL + "/modrinth"
+	curseForgeAPIBase = source.URL + "/curseforge"
+	githubAPIBase = source.URL + "/github"
+	t.Cleanup(func() {
+		pluginUpdater = previousUpdater
+		modrinthAPIBase, curseForgeAPIBase, githubAPIBase = previousModrinth, previousCurseForge, previousGitHub
+	})
+
+	return source.URL
+}
+
+// createTestPlugin saves plugin on server and deletes it when the test ends
+func createTestPlugin(t *testing.T, server *models.Server, plugin *models.Plugin) *models.Plugin {
+	t.Helper()
+
+	plugin.ServerID = server.ID
+	if plugin.FileName == "" {
+		plugin.FileName = plugin.Name + ".jar"
+	}
+	if plugin.FilePath == "" {
+		plugin.FilePath = filepath.Join(server.Path, "plugins", plugin.FileName)
+	}
+	plugin.InstallDate = time.Now()
+	if err := database.DB.Omit("Server").Create(plugin).Error; err != nil {
+		t.Fatalf("failed to create plugin: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Unscoped().Delete(&models.Plugin{}, "id = ?", plugin.ID) })
+	return plugin
+}
+
+func TestCheckPluginUpdatesAgainstSources(t *testing.T) {
+	testDB(t)
+
+	var modrinthQuery string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/modrinth/project/luckperms/version", func(w http.ResponseWriter, r *http.Request) {
+		modrinthQuery = r.URL.RawQuery
+		w.Write([]byte(`[
+			{"version_number": "5.4.120", "files": [
+				{"url": "https://cdn.example/sources.jar", "filename": "LuckPerms-sources.jar", "primary": false},
+				{"url": "https://cdn.example/LuckPerms-5.4.120.jar", "filename": "LuckPerms-5.4.120.jar", "primary": true}
+			]},
+			{"version_number": "5.4.100", "files": [{"url": "https://cdn.example/old.jar", "filename": "old.jar", "primary": true}]}
+		]`))
+	})
+	mux.HandleFunc("/curseforge/mods/1234/files", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "test-key" {
+			http.Error(w, "missing key", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"data": [
+			{"displayName": "WorldEdit 7.2.15", "fileName": "worldedit-7.2.15.jar", "downloadUrl": "https://cdn.example/we-15.jar", "fileDate": "2023-05-01T00:00:00Z"},
+			{"displayName": "WorldEdit 7.2.18", "fileName": "worldedit-7.2.18.jar", "downloadUrl": "https://cdn.example/we-18.jar", "fileDate": "2024-01-01T00:00:00Z"}
+		]}`))
+	})
+	mux.HandleFunc("/github/repos/EssentialsX/Essentials/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"tag_name": "v2.20.1", "assets": [{"name": "EssentialsX-2.20.1.jar", "browser_download_url": "https://cdn.example/ess.jar"}]}`))
+	})
+	useTestPluginSources(t, mux)
+
+	server := testutil.CreateServer(t, &models.Server{Version: "1.20.4"})
+	luckPerms := createTestPlugin(t, server, &models.Plugin{Name: "LuckPerms", Version: "5.4.100", Source: models.PluginSourceModrinth, SourceID: "luckperms"})
+	worldEdit := createTestPlugin(t, server, &models.Plugin{Name: "WorldEdit", Version: "WorldEdit 7.2.15", Source: models.PluginSourceCurseForge, SourceID: "1234"})
+	essentials := createTestPlugin(t, server, &models.Plugin{Name: "Essentials", Version: "2.20.1", Source: models.PluginSourceGitHub, SourceID: "EssentialsX/Essentials"})
+	// Checking this one fails; it keeps its earlier result
+	gone := createTestPlugin(t, server, &models.Plugin{Name: "Gone", Version: "1.0", Source: models.PluginSourceModrinth, SourceID: "gone",
+		UpdateAvailable: true, LatestVersion: "1.1"})
+	manual := createTestPlugin(t, server, &models.Plugin{Name: "Manual", Version: "1.0", Source: models.PluginSourceManual})
+
+	if _, err := CheckPluginUpdates(context.Background(), server); err != nil {
+		t.Fatalf("CheckPluginUpdates: %v", err)
+	}
+	if modrinthQuery == "" {
+		t.Fatal("Modrinth was not asked for versions")
+	}
+	if want := `game_versions=%5B%221.20.4%22%5D&loaders=%5B%22paper%22%5D`; modrinthQuery != want {
+		t.Errorf("Modrinth query = %s, want the server's loader and Minecraft version", modrinthQuery)
+	}
+
+	tests := []struct {
+		plugin      *models.Plugin
+		available   bool
+		latest      string
+		downloadURL string
+	}{
+		{luckPerms, true, "5.4.120", "https://cdn.example/LuckPerms-5.4.120.jar"},
+		{worldEdit, true, "WorldEdit 7.2.18", "https://cdn.example/we-18.jar"},
+		// "v2.20.1" is the installed 2.20.1
+		{essentials, false, "v2.20.1", "https://cdn.example/ess.jar"},
+		{gone, true, "1.1", ""},
+		{manual, false, "", ""},
+	}
+	for _, tt := range tests {
+		var current models.Plugin
+		database.DB.First(&current, "id = ?", tt.plugin.ID)
+		if current.UpdateAvailable != tt.available || current.LatestVersion != tt.latest || current.LatestDownloadURL != tt.downloadURL {
+			t.Errorf("%s: update available %v, latest %q from %q, want %v, %q from %q", current.Name,
+				current.UpdateAvailable, current.LatestVersion, current.LatestDownloadURL, tt.available, tt.latest, tt.downloadURL)
+		}
+	}
+}
+
+func TestUpdatePluginSwapsFile(t *testing.T) {
+	testDB(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/files/LuckPerms-5.4.120.jar", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("new jar"))
+	})
+	sourceURL := useTestPluginSources(t, mux)
+
+	server := testutil.CreateServer(t, &models.Server{})
+	plugin := createTestPlugin(t, server, &models.Plugin{
+		Name:              "LuckPerms",
+		Version:           "5.4.100",
+		Source:            models.PluginSourceModrinth,
+		SourceID:          "luckperms",
+		UpdateAvailable:   true,
+		LatestVersion:     "5.4.120",
+		LatestFileName:    "LuckPerms-5.4.120.jar",
+		LatestDownloadURL: sourceURL + "/files/LuckPerms-5.4.120.jar",
+	})
+	if err := os.MkdirAll(filepath.Dir(plugin.FilePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(plugin.FilePath, []byte("old jar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server.Status = models.ServerStatusRunning
+	if _, err := UpdatePlugin(server, plugin.ID); !errors.Is(err, ErrServerRunning) {
+		t.Fatalf("UpdatePlugin on a running server = %v, want ErrServerRunning", err)
+	}
+
+	server.Status = models.ServerStatusStopped
+	updated, err := UpdatePlugin(server, plugin.ID)
+	if err != nil {
+		t.Fatalf("UpdatePlugin: %v", err)
+	}
+	if updated.Version != "5.4.120" || updated.UpdateAvailable || updated.FileName != "LuckPerms-5.4.120.jar" {
+		t.Errorf("updated plugin = %+v, want version 5.4.120 with no update pending", updated)
+	}
+
+	if content, err := os.ReadFile(updated.FilePath); err != nil || string(content) != "new jar" {
+		t.Errorf("new plugin file = %q, %v", content, err)
+	}
+	if _, err := os.Stat(plugin.FilePath); !os.IsNotExist(err) {
+		t.Error("the old plugin file is still installed next to the new one")
+	}
+	backups, _ := filepath.Glob(filepath.Join(filepath.Dir(plugin.FilePath), ".backups", "LuckPerms.jar.*"))
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v, want the old file kept", backups)
+	}
+	if content, _ := os.ReadFile(backups[0]); string(content) != "old jar" {
+		t.Errorf("backed up file = %q, want the old jar", content)
+	}
+
+	// Nothing left to update
+	if _, err := UpdatePlugin(server, plugin.ID); !errors.Is(err, ErrNoPluginUpdate) {
+		t.Errorf("second UpdatePlugin = %v, want ErrNoPluginUpdate", err)
+	}
+}
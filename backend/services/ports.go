@@ -0,0 +1,114 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+)
+
+// ErrNoFreePort is returned when every port of the allocation range is taken
+var ErrNoFreePort = errors.New("no free port available in range")
+
+// PortAllocator hands out free server ports. Allocated ports stay reserved
+// in memory until the server record is saved, so concurrent creates never
+// receive the same port.
+type PortAllocator struct {
+	reserved map[int]int // reserved port -> first port of its allocation
+	mutex    sync.Mutex
+}
+
+var portAllocator = &PortAllocator{
+	reserved: make(map[int]int),
+}
+
+// serverPortCount is how many consecutive ports a server of the type binds:
+// Bedrock listens on its port and on server-portv6, port+1 by default
+func serverPortCount(serverType models.ServerType) int {
+	if serverType == models.ServerTypeBedrock {
+		return 2
+	}
+	return 1
+}
+
+// AllocatePort reserves the lowest port in [start, end] that, along with the
+// extra ports the server type binds, is neither used by a server nor bound
+// on this host. Call ReleasePort once the server record has been created (or
+// creation failed).
+func AllocatePort(start, end int, serverType models.ServerType) (int, error) {
+	if start < 1024 || end > 65535 || start > end {
+		return 0, fmt.Errorf("invalid port range %d-%d", start, end)
+	}
+
+	portAllocator.mutex.Lock()
+	defer portAllocator.mutex.Unlock()
+
+	// A Bedrock server just below the range still holds its range's first port
+	var servers []models.Server
+	if err := database.DB.Select("port", "type").
+		Where("port BETWEEN ? AND ?", start-1, end).
+		Find(&servers).Error; err != nil {
+		return 0, fmt.Errorf("failed to query used ports: %v", err)
+	}
+
+	used := make(map[int]bool, len(servers))
+	for _, server := range servers {
+		for i := 0; i < serverPortCount(server.Type); i++ {
+			used[server.Port+i] = true
+		}
+	}
+
+	count := serverPortCount(serverType)
+	for port := start; port+count-1 <= end; port++ {
+		free := true
+		for p := port; p < port+count; p++ {
+			if _, reserved := portAllocator.reserved[p]; used[p] || reserved || !isPortAvailable(p) {
+				free = false
+				break
+			}
+		}
+		if !free {
+			continue
+		}
+
+		for p := port; p < port+count; p++ {
+			portAllocator.reserved[p] = port
+		}
+		return port, nil
+	}
+
+	return 0, ErrNoFreePort
+}
+
+// ReleasePort drops the in-memory reservation of an allocated port and of
+// the extra ports allocated with it
+func ReleasePort(port int) {
+	portAllocator.mutex.Lock()
+	defer portAllocator.mutex.Unlock()
+
+	for p, first := range portAllocator.reserved {
+		if first == port {
+			delete(portAllocator.reserved, p)
+		}
+	}
+}
+
+// isPortAvailable checks that nothing on this host is listening on the port,
+// over TCP or UDP (Bedrock and the query protocol use UDP)
+func isPortAvailable(port int) bool {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	listener.Close()
+
+	conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
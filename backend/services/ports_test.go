@@ -0,0 +1,117 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+)
+
+func TestAllocatePortRangeExhaustion(t *testing.T) {
+	testDB(t)
+
+	// Something else on the host holds the first port of the range
+	listener, err := net.Listen("tcp", ":55000")
+	if err != nil {
+		t.Skipf("port 55000 is not free: %v", err)
+	}
+	defer listener.Close()
+
+	port, err := AllocatePort(55000, 55001, models.ServerTypePaper)
+	if err != nil {
+		t.Fatalf("AllocatePort: %v", err)
+	}
+	defer ReleasePort(port)
+	if port != 55001 {
+		t.Fatalf("allocated %d, want 55001", port)
+	}
+
+	if _, err := AllocatePort(55000, 55001, models.ServerTypePaper); !errors.Is(err, ErrNoFreePort) {
+		t.Fatalf("AllocatePort on an exhausted range = %v, want ErrNoFreePort", err)
+	}
+
+	// Releasing the reservation makes the port available again
+	ReleasePort(port)
+	again, err := AllocatePort(55000, 55001, models.ServerTypePaper)
+	if err != nil || again != 55001 {
+		t.Fatalf("AllocatePort after release = %d, %v, want 55001", again, err)
+	}
+	ReleasePort(again)
+}
+
+func TestAllocatePortSkipsSavedServers(t *testing.T) {
+	testDB(t)
+
+	testutil.CreateServer(t, &models.Server{Port: 55010, Type: models.ServerTypeBedrock})
+
+	// The Bedrock server also holds 55011 for IPv6
+	port, err := AllocatePort(55010, 55020, models.ServerTypePaper)
+	if err != nil {
+		t.Fatalf("AllocatePort: %v", err)
+	}
+	defer ReleasePort(port)
+	if port != 55012 {
+		t.Errorf("allocated %d, want 55012", port)
+	}
+}
+
+func TestAllocatePortConcurrentCreates(t *testing.T) {
+	testDB(t)
+
+	type allocation struct {
+		port  int
+		count int
+	}
+
+	const creates = 20
+	allocations := make(chan allocation, creates)
+	errs := make(chan error, creates)
+
+	var wg sync.WaitGroup
+	for i := 0; i < creates; i++ {
+		serverType := models.ServerTypePaper
+		if i%4 == 0 {
+			serverType = models.ServerTypeBedrock
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			port, err := AllocatePort(55100, 55199, serverType)
+			if err != nil {
+				errs <- err
+				return
+			}
+			allocations <- allocation{port, serverPortCount(serverType)}
+		}()
+	}
+	wg.Wait()
+	close(allocations)
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("AllocatePort: %v", err)
+	}
+
+	held := make(map[int]bool)
+	for a := range allocations {
+		defer ReleasePort(a.port)
+		for p := a.port; p < a.port+a.count; p++ {
+			if held[p] {
+				t.Errorf("port %d was handed out twice", p)
+			}
+			held[p] = true
+		}
+	}
+}
+
+func TestAllocatePortInvalidRange(t *testing.T) {
+	tests := [][2]int{{80, 90}, {1023, 2000}, {30000, 70000}, {40000, 30000}}
+	for _, r := range tests {
+		if _, err := AllocatePort(r[0], r[1], models.ServerTypePaper); err == nil {
+			t.Errorf("AllocatePort(%d, %d) succeeded", r[0], r[1])
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"playpulse-panel/models"
+)
+
+// ErrInvalidServerConfig is returned when a server's files conflict with its
+// panel settings in a way that can't be fixed automatically
+var ErrInvalidServerConfig = errors.New("invalid server configuration")
+
+// preflightServer checks the server's files and launch arguments against
+// its panel settings before it starts. A server-port that differs from the
+// server's port is rewritten, since the panel allocated that port; other
+// conflicts refuse the start.
+func preflightServer(server *models.Server, args []string) error {
+	// Proxies have no server.properties
+	if server.Type != models.ServerTypeProxy {
+		if err := reconcileServerPort(server); err != nil {
+			return err
+		}
+	}
+
+	if server.Type != models.ServerTypeBedrock && server.Type != models.ServerTypeProxy {
+		if err := checkProxyOnlineMode(server); err != nil {
+			return err
+		}
+	}
+
+	return checkHeapFitsMemoryLimit(server, args)
+}
+
+// reconcileServerPort makes server-port in server.properties match the port
+// the panel assigned, so the server never binds a port it wasn't given
+func reconcileServerPort(server *models.Server) error {
+	lines, err := readPropertiesLines(server)
+	if err != nil {
+		return fmt.Errorf("failed to read server.properties: %v", err)
+	}
+	// A missing file is created with the right port by the server jar setup
+	if lines == nil {
+		return nil
+	}
+
+	want := strconv.Itoa(server.Port)
+	found, changed := false, false
+	for i, line := range lines {
+		key, value, ok := parsePropertyLine(line)
+		if !ok || key != "server-port" {
+			continue
+		}
+		found = true
+		if value != want {
+			log.Printf("Server %s: server.properties has server-port=%s, resetting it to %s", server.Name, value, want)
+			lines[i] = "server-port=" + want
+			changed = true
+		}
+	}
+	if !found {
+		lines = append(lines, "server-port="+want)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	propertiesPath := filepath.Join(server.Path, "server.properties")
+	if err := os.WriteFile(propertiesPath, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to update server.properties: %v", err)
+	}
+	return nil
+}
+
+// checkProxyOnlineMode refuses to start a server that takes players from a
+// BungeeCord or Velocity proxy while authenticating them itself; the proxy
+// does that, and online-mode=true would turn every forwarded player away
+func checkProxyOnlineMode(server *models.Server) error {
+	properties, err := ReadServerProperties(server)
+	if err != nil {
+		return fmt.Errorf("failed to read server.properties: %v", err)
+	}
+
+	onlineMode, _ := properties["online-mode"].(bool)
+	behindProxy := serverBehindProxy(server)
+
+	switch {
+	case behindProxy && onlineMode:
+		return fmt.Errorf("%w: the server forwards players from a proxy, so online-mode must be false", ErrInvalidServerConfig)
+	case !behindProxy && properties["online-mode"] == false:
+		log.Printf("Server %s runs with online-mode=false and no proxy forwarding; players are not authenticated", server.Name)
+	}
+	return nil
+}
+
+// serverBehindProxy reports whether BungeeCord or Velocity forwarding is
+// turned on in the server's Spigot or Paper config
+func serverBehindProxy(server *models.Server) bool {
+	checks := []struct {
+		file, section, key string
+	}{
+		{"spigot.yml", "settings", "bungeecord"},
+		{filepath.Join("config", "paper-global.yml"), "velocity", "enabled"},
+		{"paper.yml", "velocity-support", "enabled"}, // before Paper 1.19
+	}
+
+	for _, check := range checks {
+		data, err := os.ReadFile(filepath.Join(server.Path, check.file))
+		if err != nil {
+			continue
+		}
+		if yamlSectionValue(string(data), check.section, check.key) == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// yamlSectionValue finds key directly under a section: line in a simple
+// YAML file and returns its value, or "" if it is not there
+func yamlSectionValue(data, section, key string) string {
+	sectionIndent := -1
+	for _, line := range strings.Split(data, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+
+		if sectionIndent >= 0 && indent <= sectionIndent {
+			// Left the section
+			sectionIndent = -1
+		}
+
+		if trimmed == section+":" {
+			sectionIndent = indent
+			continue
+		}
+
+		if sectionIndent >= 0 {
+			name, value, found := strings.Cut(trimmed, ":")
+			if found && strings.TrimSpace(name) == key {
+				return strings.Trim(strings.TrimSpace(value), `"'`)
+			}
+		}
+	}
+	return ""
+}
+
+// checkHeapFitsMemoryLimit refuses to start a JVM whose -Xmx or -Xms is
+// larger than the server's memory limit
+func checkHeapFitsMemoryLimit(server *models.Server, args []string) error {
+	if server.MemoryLimit <= 0 {
+		return nil
+	}
+
+	for _, arg := range args {
+		var flag string
+		switch {
+		case strings.HasPrefix(arg, "-Xmx"):
+			flag = "-Xmx"
+		case strings.HasPrefix(arg, "-Xms"):
+			flag = "-Xms"
+		default:
+			continue
+		}
+
+		sizeMB, err := parseJVMSizeMB(strings.TrimPrefix(arg, flag))
+		if err != nil {
+			return fmt.Errorf("%w: %s has an invalid size", ErrInvalidServerConfig, arg)
+		}
+		if sizeMB > server.MemoryLimit {
+			return fmt.Errorf("%w: %s exceeds the server's memory limit of %dM", ErrInvalidServerConfig, arg, server.MemoryLimit)
+		}
+	}
+	return nil
+}
+
+// parseJVMSizeMB parses a JVM memory size such as 4G, 2048m or 1073741824
+// into megabytes
+func parseJVMSizeMB(size string) (int64, error) {
+	if size == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+
+	multiplier := int64(1) // bytes
+	switch size[len(size)-1] {
+	case 'k', 'K':
+		multiplier = 1 << 10
+	case 'm', 'M':
+		multiplier = 1 << 20
+	case 'g', 'G':
+		multiplier = 1 << 30
+	case 't', 'T':
+		multiplier = 1 << 40
+	}
+	if multiplier != 1 {
+		size = size[:len(size)-1]
+	}
+
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	return n * multiplier / (1 << 20), nil
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"playpulse-panel/models"
+)
+
+func TestPreflightResetsMismatchedPort(t *testing.T) {
+	server := writeTestProperties(t, strings.Replace(testProperties, "server-port=25565", "server-port=25570", 1))
+	server.Type = models.ServerTypePaper
+
+	if err := preflightServer(server, nil); err != nil {
+		t.Fatalf("preflightServer: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(server.Path, "server.properties"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != testProperties {
+		t.Errorf("server.properties =\n%s\nwant only server-port reset to the server's port:\n%s", content, testProperties)
+	}
+}
+
+func TestPreflightAddsMissingPort(t *testing.T) {
+	server := writeTestProperties(t, "motd=A Minecraft Server\n")
+	server.Type = models.ServerTypePaper
+	server.Port = 25601
+
+	if err := preflightServer(server, nil); err != nil {
+		t.Fatalf("preflightServer: %v", err)
+	}
+	content, _ := os.ReadFile(filepath.Join(server.Path, "server.properties"))
+	if string(content) != "motd=A Minecraft Server\nserver-port=25601\n" {
+		t.Errorf("server.properties = %q, want server-port added", content)
+	}
+
+	// Without server.properties there is nothing to reconcile yet
+	fresh := &models.Server{Type: models.ServerTypePaper, Path: t.TempDir(), Port: 25565}
+	if err := preflightServer(fresh, nil); err != nil {
+		t.Errorf("preflightServer without server.properties: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(fresh.Path, "server.properties")); !os.IsNotExist(err) {
+		t.Error("preflight created server.properties")
+	}
+}
+
+func TestPreflightRejectsHeapOverMemoryLimit(t *testing.T) {
+	server := &models.Server{Type: models.ServerTypePaper, Path: t.TempDir(), MemoryLimit: 2048}
+
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"-Xms1G", "-Xmx2G"}, true},
+		{[]string{"-Xmx2147483648"}, true}, // exactly the limit, in bytes
+		{[]string{"-Xmx2048m", "-XX:+UseG1GC"}, true},
+		{[]string{"-Xmx4G"}, false},
+		{[]string{"-Xms1G", "-Xmx2049M"}, false},
+		{[]string{"-Xms3072m", "-Xmx2G"}, false},
+		{[]string{"-Xmx1T"}, false},
+		{[]string{"-Xmxlots"}, false},
+	}
+	for _, tt := range tests {
+		err := preflightServer(server, tt.args)
+		if tt.ok && err != nil {
+			t.Errorf("%v: %v, want it accepted", tt.args, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidServerConfig) {
+			t.Errorf("%v: err = %v, want ErrInvalidServerConfig", tt.args, err)
+		}
+	}
+
+	unlimited := &models.Server{Type: models.ServerTypePaper, Path: t.TempDir()}
+	if err := preflightServer(unlimited, []string{"-Xmx64G"}); err != nil {
+		t.Errorf("server without a memory limit: %v", err)
+	}
+}
+
+func TestPreflightProxyOnlineMode(t *testing.T) {
+	tests := []struct {
+		name       string
+		file       string
+		config     string
+		onlineMode string
+		ok         bool
+	}{
+		{"bungeecord with online mode", "spigot.yml", "settings:\n  debug: false\n  bungeecord: true\n", "true", false},
+		{"bungeecord offline", "spigot.yml", "settings:\n  bungeecord: true\n", "false", true},
+		{"bungeecord off", "spigot.yml", "settings:\n  bungeecord: false\n", "true", true},
+		{"bungeecord key in another section", "spigot.yml", "settings:\n  debug: false\nother:\n  bungeecord: true\n", "true", true},
+		{"velocity with online mode", filepath.Join("config", "paper-global.yml"), "proxies:\n  velocity:\n    enabled: true\n    online-mode: true\n", "true", false},
+		{"legacy paper velocity", "paper.yml", "settings:\n  velocity-support:\n    enabled: 'true'\n", "true", false},
+		{"no proxy", "", "", "true", true},
+	}
+	for _, tt := range tests {
+		server := writeTestProperties(t, "server-port=25565\nonline-mode="+tt.onlineMode+"\n")
+		server.Type = models.ServerTypePaper
+		if tt.file != "" {
+			path := filepath.Join(server.Path, tt.file)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err := preflightServer(server, nil)
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v, want it accepted", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidServerConfig) {
+			t.Errorf("%s: err = %v, want ErrInvalidServerConfig", tt.name, err)
+		}
+	}
+}
+
+func TestParseJVMSizeMB(t *testing.T) {
+	tests := []struct {
+		size string
+		want int64
+	}{
+		{"512m", 512},
+		{"512M", 512},
+		{"4G", 4096},
+		{"1t", 1 << 20},
+		{"1048576k", 1024},
+		{"1073741824", 1024},
+		{"1000", 0},
+	}
+	for _, tt := range tests {
+		if got, err := parseJVMSizeMB(tt.size); err != nil || got != tt.want {
+			t.Errorf("parseJVMSizeMB(%q) = %d, %v, want %d", tt.size, got, err, tt.want)
+		}
+	}
+
+	for _, size := range []string{"", "G", "-1G", "1.5G", "4GB"} {
+		if _, err := parseJVMSizeMB(size); err == nil {
+			t.Errorf("parseJVMSizeMB(%q) accepted an invalid size", size)
+		}
+	}
+}
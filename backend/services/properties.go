@@ -0,0 +1,284 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"playpulse-panel/models"
+)
+
+var (
+	// ErrInvalidProperty is returned for a property value that fails validation
+	ErrInvalidProperty = errors.New("invalid property value")
+	// ErrPropertyPortConflict is returned when a write would clash with the server's port
+	ErrPropertyPortConflict = errors.New("property conflicts with the server's port")
+)
+
+type propertyKind int
+
+const (
+	propertyString propertyKind = iota
+	propertyBool
+	propertyInt
+	propertyEnum
+)
+
+// propertySpec describes how a known server.properties key is typed and validated
+type propertySpec struct {
+	kind     propertyKind
+	min, max int
+	values   []string
+}
+
+var (
+	boolProperty = propertySpec{kind: propertyBool}
+	portProperty = propertySpec{kind: propertyInt, min: 1, max: 65535}
+)
+
+var propertySpecs = map[string]propertySpec{
+	"allow-flight":                      boolProperty,
+	"allow-nether":                      boolProperty,
+	"broadcast-console-to-ops":          boolProperty,
+	"broadcast-rcon-to-ops":             boolProperty,
+	"difficulty":                        {kind: propertyEnum, values: []string{"peaceful", "easy", "normal", "hard"}},
+	"enable-command-block":              boolProperty,
+	"enable-jmx-monitoring":             boolProperty,
+	"enable-query":                      boolProperty,
+	"enable-rcon":                       boolProperty,
+	"enable-status":                     boolProperty,
+	"enforce-secure-profile":            boolProperty,
+	"enforce-whitelist":                 boolProperty,
+	"entity-broadcast-range-percentage": {kind: propertyInt, min: 10, max: 1000},
+	"force-gamemode":                    boolProperty,
+	"function-permission-level":         {kind: propertyInt, min: 1, max: 4},
+	"gamemode":                          {kind: propertyEnum, values: []string{"survival", "creative", "adventure", "spectator"}},
+	"generate-structures":               boolProperty,
+	"hardcore":                          boolProperty,
+	"hide-online-players":               boolProperty,
+	"max-players":                       {kind: propertyInt, min: 1, max: 100000},
+	"max-tick-time":                     {kind: propertyInt, min: -1, max: 1<<31 - 1},
+	"max-world-size":                    {kind: propertyInt, min: 1, max: 29999984},
+	"network-compression-threshold":     {kind: propertyInt, min: -1, max: 65535},
+	"online-mode":                       boolProperty,
+	"op-permission-level":               {kind: propertyInt, min: 1, max: 4},
+	"player-idle-timeout":               {kind: propertyInt, min: 0, max: 1<<31 - 1},
+	"prevent-proxy-connections":         boolProperty,
+	"pvp":                               boolProperty,
+	"query.port":                        portProperty,
+	"rate-limit":                        {kind: propertyInt, min: 0, max: 1<<31 - 1},
+	"rcon.port":                         portProperty,
+	"require-resource-pack":             boolProperty,
+	"server-port":                       portProperty,
+	"server-portv6":                     portProperty, // Bedrock
+	"simulation-distance":               {kind: propertyInt, min: 2, max: 32},
+	"spawn-animals":                     boolProperty,
+	"spawn-monsters":                    boolProperty,
+	"spawn-npcs":                        boolProperty,
+	"spawn-protection":                  {kind: propertyInt, min: 0, max: 1<<31 - 1},
+	"sync-chunk-writes":                 boolProperty,
+	"use-native-transport":              boolProperty,
+	"view-distance":                     {kind: propertyInt, min: 2, max: 32},
+	"white-list":                        boolProperty,
+}
+
+// ReadServerProperties returns server.properties as a typed map. Known
+// boolean and numeric keys become bools and ints; everything else is a string.
+func ReadServerProperties(server *models.Server) (map[string]interface{}, error) {
+	lines, err := readPropertiesLines(server)
+	if err != nil {
+		return nil, err
+	}
+
+	properties := make(map[string]interface{})
+	for _, line := range lines {
+		key, value, ok := parsePropertyLine(line)
+		if !ok {
+			continue
+		}
+		properties[key] = typedPropertyValue(key, value)
+	}
+
+	return properties, nil
+}
+
+// PatchServerProperties validates and writes the given keys, keeping comments,
+// key order and keys that are not patched. server-port must stay the panel's
+// port, and rcon.port may not take it.
+func PatchServerProperties(server *models.Server, patch map[string]interface{}) (map[string]interface{}, error) {
+	overrides := make(map[string]string, len(patch))
+	for key, raw := range patch {
+		key = strings.TrimSpace(key)
+		if key == "" || strings.ContainsAny(key, "=:#!\n\r") {
+			return nil, fmt.Errorf("%w: %q is not a valid key", ErrInvalidProperty, key)
+		}
+
+		value, err := normalizePropertyValue(key, raw)
+		if err != nil {
+			return nil, err
+		}
+		overrides[key] = value
+	}
+
+	port := strconv.Itoa(server.Port)
+	if value, ok := overrides["server-port"]; ok && value != port {
+		return nil, fmt.Errorf("%w: server-port must be %s; change the port in the server settings", ErrPropertyPortConflict, port)
+	}
+	if overrides["rcon.port"] == port {
+		return nil, fmt.Errorf("%w: rcon.port cannot use the game port %s", ErrPropertyPortConflict, port)
+	}
+
+	if err := applyServerProperties(server, overrides); err != nil {
+		return nil, err
+	}
+
+	return ReadServerProperties(server)
+}
+
+// applyServerProperties merges overrides into server.properties, keeping
+// comments and the order of existing keys. server-port is managed by the
+// panel and never overridden.
+func applyServerProperties(server *models.Server, overrides map[string]string) error {
+	lines, err := readPropertiesLines(server)
+	if err != nil {
+		return err
+	}
+
+	applied := make(map[string]bool)
+	for i, line := range lines {
+		key, _, ok := parsePropertyLine(line)
+		if !ok {
+			continue
+		}
+
+		if value, ok := overrides[key]; ok && key != "server-port" {
+			lines[i] = key + "=" + value
+			applied[key] = true
+		}
+	}
+
+	// Append keys that were not in the file, in a stable order
+	var missing []string
+	for key := range overrides {
+		if !applied[key] && key != "server-port" {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	for _, key := range missing {
+		lines = append(lines, key+"="+overrides[key])
+	}
+
+	propertiesPath := filepath.Join(server.Path, "server.properties")
+	return os.WriteFile(propertiesPath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// readPropertiesLines returns the lines of server.properties, or none if it
+// does not exist yet
+func readPropertiesLines(server *models.Server) ([]string, error) {
+	file, err := os.Open(filepath.Join(server.Path, "server.properties"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// parsePropertyLine splits a key=value line, skipping blanks and comments
+func parsePropertyLine(line string) (string, string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "!") {
+		return "", "", false
+	}
+
+	key, value, found := strings.Cut(trimmed, "=")
+	if !found {
+		return "", "", false
+	}
+	return strings.TrimSpace(key), strings.TrimSpace(value), true
+}
+
+func typedPropertyValue(key, value string) interface{} {
+	switch propertySpecs[key].kind {
+	case propertyBool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case propertyInt:
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+// normalizePropertyValue validates raw against the key's spec and returns it
+// in server.properties form. Booleans accept true/false, on/off, yes/no and 1/0.
+func normalizePropertyValue(key string, raw interface{}) (string, error) {
+	var value string
+	switch v := raw.(type) {
+	case string:
+		value = strings.TrimSpace(v)
+	case bool:
+		value = strconv.FormatBool(v)
+	case float64:
+		if v != float64(int64(v)) {
+			return "", fmt.Errorf("%w: %s must be a whole number", ErrInvalidProperty, key)
+		}
+		value = strconv.FormatInt(int64(v), 10)
+	case int:
+		value = strconv.Itoa(v)
+	default:
+		return "", fmt.Errorf("%w: %s must be a string, number or boolean", ErrInvalidProperty, key)
+	}
+
+	if strings.ContainsAny(value, "\n\r") {
+		return "", fmt.Errorf("%w: %s cannot contain line breaks", ErrInvalidProperty, key)
+	}
+
+	spec, known := propertySpecs[key]
+	if !known {
+		return value, nil
+	}
+
+	switch spec.kind {
+	case propertyBool:
+		switch strings.ToLower(value) {
+		case "true", "on", "yes", "1":
+			return "true", nil
+		case "false", "off", "no", "0":
+			return "false", nil
+		}
+		return "", fmt.Errorf("%w: %s must be true or false", ErrInvalidProperty, key)
+	case propertyInt:
+		n, err := strconv.Atoi(value)
+		if err != nil || n < spec.min || n > spec.max {
+			return "", fmt.Errorf("%w: %s must be a whole number between %d and %d", ErrInvalidProperty, key, spec.min, spec.max)
+		}
+		return strconv.Itoa(n), nil
+	case propertyEnum:
+		lower := strings.ToLower(value)
+		for _, allowed := range spec.values {
+			if lower == allowed {
+				return allowed, nil
+			}
+		}
+		return "", fmt.Errorf("%w: %s must be one of %s", ErrInvalidProperty, key, strings.Join(spec.values, ", "))
+	}
+
+	return value, nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"playpulse-panel/models"
+)
+
+const testProperties = `#Minecraft server properties
+#Mon Jan 01 00:00:00 UTC 2024
+difficulty=easy
+# keep this comment
+gamemode=survival
+max-players=20
+online-mode=true
+server-port=25565
+custom-plugin-key=some value
+motd=A Minecraft Server
+`
+
+func writeTestProperties(t *testing.T, content string) *models.Server {
+	t.Helper()
+
+	server := &models.Server{Path: t.TempDir(), Port: 25565}
+	if err := os.WriteFile(filepath.Join(server.Path, "server.properties"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func TestPatchServerPropertiesRoundTrip(t *testing.T) {
+	server := writeTestProperties(t, testProperties)
+
+	properties, err := ReadServerProperties(server)
+	if err != nil {
+		t.Fatalf("ReadServerProperties: %v", err)
+	}
+	if properties["max-players"] != 20 || properties["online-mode"] != true || properties["custom-plugin-key"] != "some value" {
+		t.Errorf("properties = %v, want typed known keys and unknown keys as strings", properties)
+	}
+
+	patched, err := PatchServerProperties(server, map[string]interface{}{
+		"difficulty":  "HARD",
+		"pvp":         "off",
+		"max-players": float64(50), // JSON numbers decode as float64
+		"online-mode": false,
+	})
+	if err != nil {
+		t.Fatalf("PatchServerProperties: %v", err)
+	}
+	if patched["difficulty"] != "hard" || patched["pvp"] != false || patched["max-players"] != 50 {
+		t.Errorf("patched = %v, want the normalized values", patched)
+	}
+
+	content, err := os.ReadFile(filepath.Join(server.Path, "server.properties"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `#Minecraft server properties
+#Mon Jan 01 00:00:00 UTC 2024
+difficulty=hard
+# keep this comment
+gamemode=survival
+max-players=50
+online-mode=false
+server-port=25565
+custom-plugin-key=some value
+motd=A Minecraft Server
+pvp=false
+`
+	if string(content) != want {
+		t.Errorf("server.properties =\n%s\nwant comments, order and unknown keys kept:\n%s", content, want)
+	}
+}
+
+func TestPatchServerPropertiesRejectsInvalidValues(t *testing.T) {
+	server := writeTestProperties(t, testProperties)
+
+	for _, patch := range []map[string]interface{}{
+		{"difficulty": "nightmare"},
+		{"gamemode": "god"},
+		{"pvp": "maybe"},
+		{"max-players": float64(0)},
+		{"view-distance": float64(8.5)},
+		{"rcon.port": float64(70000)},
+		{"motd": "line one\nline two"},
+		{"bad=key": "x"},
+		{"difficulty": []interface{}{"hard"}},
+	} {
+		if _, err := PatchServerProperties(server, patch); !errors.Is(err, ErrInvalidProperty) {
+			t.Errorf("patch %v: err = %v, want ErrInvalidProperty", patch, err)
+		}
+	}
+
+	content, _ := os.ReadFile(filepath.Join(server.Path, "server.properties"))
+	if string(content) != testProperties {
+		t.Error("a rejected patch changed server.properties")
+	}
+}
+
+func TestPatchServerPropertiesPortConflicts(t *testing.T) {
+	server := writeTestProperties(t, testProperties)
+
+	if _, err := PatchServerProperties(server, map[string]interface{}{"server-port": float64(25566)}); !errors.Is(err, ErrPropertyPortConflict) {
+		t.Errorf("moving server-port: err = %v, want ErrPropertyPortConflict", err)
+	}
+	if _, err := PatchServerProperties(server, map[string]interface{}{"rcon.port": float64(25565)}); !errors.Is(err, ErrPropertyPortConflict) {
+		t.Errorf("rcon.port on the game port: err = %v, want ErrPropertyPortConflict", err)
+	}
+
+	// Restating the server's own port is fine
+	if _, err := PatchServerProperties(server, map[string]interface{}{"server-port": "25565", "rcon.port": float64(25575)}); err != nil {
+		t.Errorf("patch keeping the port: %v", err)
+	}
+}
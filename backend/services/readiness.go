@@ -0,0 +1,86 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+)
+
+// defaultStartTimeout is how long a server may take to finish loading
+// before its start is reported as stuck
+const defaultStartTimeout = 10 * time.Minute
+
+// startTimeout returns the server_start_timeout_seconds setting
+func startTimeout() time.Duration {
+	if seconds := GetInt("server_start_timeout_seconds", 0); seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultStartTimeout
+}
+
+// watchServerReady registers a watcher for the console line a server
+// prints once it has finished loading. It returns nil when the server is
+// taken as ready as soon as its process starts: when the
+// start_readiness_detection setting is off, or for a server type that
+// prints no such line. The watcher must be registered before the process
+// starts, so the line can't be missed.
+func watchServerReady(server *models.Server) *logWatcher {
+	patterns := patternsFor(server.Type)
+	if patterns.started == nil || !GetBool("start_readiness_detection", true) {
+		return nil
+	}
+	return watchServerLog(server.ID, patterns.started)
+}
+
+// awaitServerReady marks a starting server running once it reports it has
+// finished loading, or straight away without a watcher. A server that
+// hasn't finished within the start timeout is reported as stuck but keeps
+// starting, and is still marked running if it gets there. Waiting ends
+// when the process exits.
+func awaitServerReady(server *models.Server, watcher *logWatcher, exited <-chan struct{}) {
+	if watcher == nil {
+		markServerReady(server)
+		return
+	}
+	defer watcher.Close()
+
+	timeout := startTimeout()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-watcher.matched:
+			markServerReady(server)
+			return
+		case <-exited:
+			return
+		case <-timer.C:
+			log.Printf("Server %s has not finished starting after %s", server.Name, timeout)
+			BroadcastServerStatus(server.ID, models.ServerStatusStarting,
+				fmt.Sprintf("Server has not finished starting after %s, it may be stuck", timeout))
+			NotifyStuckStart(server, timeout)
+		}
+	}
+}
+
+// markServerReady moves a starting server to running. A server stopped
+// while it was loading is left alone.
+func markServerReady(server *models.Server) {
+	result := database.DB.Model(&models.Server{}).
+		Where("id = ? AND status = ?", server.ID, models.ServerStatusStarting).
+		Update("status", models.ServerStatusRunning)
+	if result.Error != nil {
+		log.Printf("Failed to mark server %s running: %v", server.Name, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+
+	BroadcastServerStatus(server.ID, models.ServerStatusRunning, "Server is ready")
+	NotifyServerStart(server)
+}
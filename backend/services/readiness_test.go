@@ -0,0 +1,163 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+)
+
+// awaitStatusMessage waits for a status broadcast of the server on the
+// client's queue, skipping other messages
+func awaitStatusMessage(t *testing.T, client *wsClient, server *models.Server) StatusMessage {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case message := <-client.send:
+			if status, ok := message.Data.(StatusMessage); ok && message.Type == "server_status" && status.ServerID == server.ID.String() {
+				return status
+			}
+		case <-timeout:
+			t.Fatal("no status broadcast for the server")
+		}
+	}
+}
+
+// startWaitingForReady creates a starting server of the type and waits for
+// it to be ready until the test ends or the returned channel is closed, as
+// if its process had exited
+func startWaitingForReady(t *testing.T, serverType models.ServerType) (*models.Server, chan struct{}) {
+	t.Helper()
+
+	server := testutil.CreateServer(t, &models.Server{Type: serverType, Status: models.ServerStatusStarting})
+	watcher := watchServerReady(server)
+	if watcher == nil {
+		t.Fatalf("no readiness watcher for a %s server", serverType)
+	}
+
+	exited := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		awaitServerReady(server, watcher, exited)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		select {
+		case <-exited:
+		default:
+			close(exited)
+		}
+		<-done
+	})
+	return server, exited
+}
+
+func TestDoneLineMarksServerReady(t *testing.T) {
+	testDB(t)
+	useTestSettings(t, models.SystemSetting{Key: "start_readiness_detection", Type: SettingTypeBoolean, Value: "true"})
+
+	tests := []struct {
+		serverType models.ServerType
+		loading    string
+		done       string
+	}{
+		{models.ServerTypePaper, `[12:00:01 INFO]: Preparing level "world"`, `[12:00:05 INFO]: Done (3.512s)! For help, type "help"`},
+		{models.ServerTypeProxy, `[12:00:01 INFO]: Loading plugins`, `[12:00:02 INFO]: Listening on /0.0.0.0:25577`},
+		// A Java server's Done line means nothing to Bedrock
+		{models.ServerTypeBedrock, `[12:00:01 INFO] Done (3.512s)! For help, type "help"`, `[2024-01-01 12:00:05:000 INFO] Server started.`},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.serverType), func(t *testing.T) {
+			client := registerTestWSClient(t, testutil.CreateUser(t, &models.User{}).ID)
+			server, _ := startWaitingForReady(t, tt.serverType)
+
+			publishServerLogLine(server.ID, tt.loading)
+			time.Sleep(100 * time.Millisecond)
+			if status := serverStatus(server.ID); status != models.ServerStatusStarting {
+				t.Fatalf("status = %s while loading, want starting", status)
+			}
+
+			publishServerLogLine(server.ID, tt.done)
+			waitForServerStatus(t, server.ID, models.ServerStatusRunning)
+			if status := awaitStatusMessage(t, client, server); status.Status != string(models.ServerStatusRunning) {
+				t.Errorf("broadcast status %q, want running", status.Status)
+			}
+		})
+	}
+}
+
+func TestStuckStartIsReported(t *testing.T) {
+	testDB(t)
+	useTestSettings(t,
+		models.SystemSetting{Key: "start_readiness_detection", Type: SettingTypeBoolean, Value: "true"},
+		models.SystemSetting{Key: "server_start_timeout_seconds", Type: SettingTypeNumber, Value: "1"},
+	)
+
+	owner := testutil.CreateUser(t, &models.User{})
+	client := registerTestWSClient(t, owner.ID)
+	server, _ := startWaitingForReady(t, models.ServerTypePaper)
+	testutil.GrantServerAccess(t, owner, server, models.ServerRoleOwner)
+
+	// Past the timeout the server is flagged, but left starting
+	status := awaitStatusMessage(t, client, server)
+	if status.Status != string(models.ServerStatusStarting) || status.Message == "" {
+		t.Errorf("broadcast %+v, want starting with a warning", status)
+	}
+	var notification models.Notification
+	if err := database.DB.Where("user_id = ? AND server_id = ?", owner.ID, server.ID).First(&notification).Error; err != nil || notification.Title != "Server start stuck" {
+		t.Errorf("owner's notification = %+v, %v, want the stuck start reported", notification, err)
+	}
+	if status := serverStatus(server.ID); status != models.ServerStatusStarting {
+		t.Errorf("status = %s after the timeout, want still starting", status)
+	}
+
+	// A server that gets there late is still marked running
+	publishServerLogLine(server.ID, `[12:20:00 INFO]: Done (1203.5s)! For help, type "help"`)
+	waitForServerStatus(t, server.ID, models.ServerStatusRunning)
+}
+
+func TestReadinessEndsWithProcess(t *testing.T) {
+	testDB(t)
+	useTestSettings(t, models.SystemSetting{Key: "start_readiness_detection", Type: SettingTypeBoolean, Value: "true"})
+
+	// Exiting before loading ends the wait without marking the server
+	server, exited := startWaitingForReady(t, models.ServerTypePaper)
+	close(exited)
+	time.Sleep(100 * time.Millisecond)
+	publishServerLogLine(server.ID, `[12:00:05 INFO]: Done (3.512s)! For help, type "help"`)
+	time.Sleep(100 * time.Millisecond)
+	if status := serverStatus(server.ID); status != models.ServerStatusStarting {
+		t.Errorf("status = %s after the process exited, want it left to the process monitor", status)
+	}
+
+	// A server stopped while loading isn't marked running by its Done line
+	stopped, _ := startWaitingForReady(t, models.ServerTypePaper)
+	database.DB.Model(stopped).Update("status", models.ServerStatusStopped)
+	publishServerLogLine(stopped.ID, `[12:00:05 INFO]: Done (3.512s)! For help, type "help"`)
+	time.Sleep(100 * time.Millisecond)
+	if status := serverStatus(stopped.ID); status != models.ServerStatusStopped {
+		t.Errorf("status = %s, want a server stopped while loading left stopped", status)
+	}
+}
+
+func TestReadinessDetectionOff(t *testing.T) {
+	testDB(t)
+	useTestSettings(t, models.SystemSetting{Key: "start_readiness_detection", Type: SettingTypeBoolean, Value: "false"})
+
+	server := testutil.CreateServer(t, &models.Server{Status: models.ServerStatusStarting})
+	watcher := watchServerReady(server)
+	if watcher != nil {
+		watcher.Close()
+		t.Fatal("watching for the Done line with readiness detection off")
+	}
+
+	// Without a watcher the server is running as soon as its process starts
+	awaitServerReady(server, nil, make(chan struct{}))
+	if status := serverStatus(server.ID); status != models.ServerStatusRunning {
+		t.Errorf("status = %s, want running straight away", status)
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"runtime"
+
+	"playpulse-panel/config"
+	"playpulse-panel/models"
+)
+
+// ErrResourceLimitsUnavailable is returned when limits are required but the
+// host cannot enforce them
+var ErrResourceLimitsUnavailable = errors.New("resource limits unavailable")
+
+const (
+	ResourceLimitsAuto     = "auto"
+	ResourceLimitsRequired = "required"
+	ResourceLimitsOff      = "off"
+
+	// cpuPeriod is the cgroup CPU accounting period in microseconds
+	cpuPeriod = 100000
+
+	// The JVM needs memory beyond its heap (metaspace, threads, direct
+	// buffers), so the cgroup ceiling sits above MemoryLimit by a quarter of
+	// the heap, and at least minMemoryOverheadMB
+	minMemoryOverheadMB = 256
+)
+
+// resourceLimits holds the enforcement state determined at startup
+var resourceLimits = struct {
+	mode      string
+	root      string
+	available bool
+	reason    string
+}{mode: ResourceLimitsOff}
+
+// InitializeResourceLimits prepares the cgroup tree locally launched servers
+// are placed in. Without cgroup support, "auto" logs a warning and runs servers
+// unlimited while "required" makes every start with limits fail.
+func InitializeResourceLimits(cfg *config.Config) {
+	mode := cfg.GameServers.ResourceLimits
+	switch mode {
+	case ResourceLimitsAuto, ResourceLimitsRequired, ResourceLimitsOff:
+	default:
+		log.Printf("Unknown RESOURCE_LIMITS %q, using %q", mode, ResourceLimitsAuto)
+		mode = ResourceLimitsAuto
+	}
+
+	resourceLimits.mode = mode
+	resourceLimits.root = cfg.GameServers.CgroupPath
+	if mode == ResourceLimitsOff {
+		return
+	}
+
+	if err := setupCgroupRoot(resourceLimits.root); err != nil {
+		resourceLimits.reason = err.Error()
+		if mode == ResourceLimitsRequired {
+			log.Printf("Resource limits are required but unavailable, servers with limits will not start: %v", err)
+		} else {
+			log.Printf("Resource limits unavailable, servers will run without CPU and memory limits: %v", err)
+		}
+		return
+	}
+
+	resourceLimits.available = true
+	log.Printf("Enforcing server resource limits with cgroups under %s", resourceLimits.root)
+}
+
+// prepareResourceLimits arranges for cmd to start inside a cgroup carrying the
+// server's CPU and memory limits. It returns nil when there is nothing to
+// enforce, or when limits are unavailable and not required.
+func prepareResourceLimits(server *models.Server, cmd *exec.Cmd) (*cgroupPlacement, error) {
+	if resourceLimits.mode == ResourceLimitsOff || (server.CPULimit <= 0 && server.MemoryLimit <= 0) {
+		return nil, nil
+	}
+
+	if !resourceLimits.available {
+		if resourceLimits.mode == ResourceLimitsRequired {
+			return nil, fmt.Errorf("%w: %s", ErrResourceLimitsUnavailable, resourceLimits.reason)
+		}
+		return nil, nil
+	}
+
+	placement, err := placeServerCgroup(resourceLimits.root, server, cmd)
+	if err != nil {
+		if resourceLimits.mode == ResourceLimitsRequired {
+			return nil, fmt.Errorf("%w: %v", ErrResourceLimitsUnavailable, err)
+		}
+		log.Printf("Failed to apply resource limits to server %s, starting without them: %v", server.Name, err)
+		return nil, nil
+	}
+
+	return placement, nil
+}
+
+// cgroupMemoryMax returns the memory.max value for a MemoryLimit in MB
+func cgroupMemoryMax(memoryMB int64) string {
+	if memoryMB <= 0 {
+		return "max"
+	}
+
+	overhead := memoryMB / 4
+	if overhead < minMemoryOverheadMB {
+		overhead = minMemoryOverheadMB
+	}
+	return fmt.Sprintf("%d", (memoryMB+overhead)*1024*1024)
+}
+
+// cpuLimitCores converts a CPULimit percentage of the whole host, where 100
+// is every core, into a number of cores
+func cpuLimitCores(percent float64) float64 {
+	return percent / 100 * float64(runtime.NumCPU())
+}
+
+// cgroupCPUMax returns the cpu.max value for a CPULimit percentage of the
+// host
+func cgroupCPUMax(percent float64) string {
+	if percent <= 0 {
+		return "max"
+	}
+
+	quota := int64(cpuLimitCores(percent) * cpuPeriod)
+	if quota < 1000 {
+		quota = 1000 // the kernel minimum
+	}
+	return fmt.Sprintf("%d %d", quota, cpuPeriod)
+}
@@ -0,0 +1,118 @@
+//go:build linux
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"playpulse-panel/models"
+)
+
+const cgroupMount = "/sys/fs/cgroup"
+
+// cgroupPlacement is the cgroup a server process runs in
+type cgroupPlacement struct {
+	path string
+	dir  *os.File
+}
+
+// setupCgroupRoot creates the panel's cgroup and enables the cpu and memory
+// controllers for the server cgroups below it
+func setupCgroupRoot(root string) error {
+	if _, err := os.Stat(filepath.Join(cgroupMount, "cgroup.controllers")); err != nil {
+		return fmt.Errorf("cgroup v2 is not mounted at %s", cgroupMount)
+	}
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return fmt.Errorf("cannot create cgroup %s: %v (the panel needs a delegated cgroup, e.g. systemd Delegate=yes)", root, err)
+	}
+
+	controllers, err := os.ReadFile(filepath.Join(root, "cgroup.controllers"))
+	if err != nil {
+		return fmt.Errorf("%s is not a cgroup: %v", root, err)
+	}
+	available := " " + strings.Join(strings.Fields(string(controllers)), " ") + " "
+	for _, controller := range []string{"cpu", "memory"} {
+		if !strings.Contains(available, " "+controller+" ") {
+			return fmt.Errorf("the %s controller is not enabled for %s", controller, root)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "cgroup.subtree_control"), []byte("+cpu +memory"), 0644); err != nil {
+		return fmt.Errorf("cannot enable controllers in %s: %v", root, err)
+	}
+
+	return nil
+}
+
+// placeServerCgroup creates the server's cgroup with its limits and sets cmd
+// to be cloned directly into it, so the limits hold from the first instruction
+func placeServerCgroup(root string, server *models.Server, cmd *exec.Cmd) (*cgroupPlacement, error) {
+	path := filepath.Join(root, "server-"+server.ID.String())
+
+	// A cgroup left over from a previous run is reused once it is empty
+	if err := os.Mkdir(path, 0755); err != nil && !os.IsExist(err) {
+		return nil, fmt.Errorf("cannot create cgroup: %v", err)
+	}
+
+	limits := map[string]string{
+		"memory.max":      cgroupMemoryMax(server.MemoryLimit),
+		"memory.swap.max": "0",
+		"cpu.max":         cgroupCPUMax(server.CPULimit),
+	}
+	for file, value := range limits {
+		if err := os.WriteFile(filepath.Join(path, file), []byte(value), 0644); err != nil {
+			// Swap accounting is often compiled out; the memory limit still holds
+			if file == "memory.swap.max" && os.IsNotExist(err) {
+				continue
+			}
+			os.Remove(path)
+			return nil, fmt.Errorf("cannot set %s: %v", file, err)
+		}
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("cannot open cgroup: %v", err)
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+
+	return &cgroupPlacement{path: path, dir: dir}, nil
+}
+
+// started releases the descriptor once the process is in the cgroup
+func (p *cgroupPlacement) started() {
+	if p == nil || p.dir == nil {
+		return
+	}
+	p.dir.Close()
+	p.dir = nil
+}
+
+// release removes the cgroup after the server process has exited. The kernel
+// may take a moment to mark it empty.
+func (p *cgroupPlacement) release() {
+	if p == nil {
+		return
+	}
+	p.started()
+
+	for i := 0; i < 10; i++ {
+		if err := os.Remove(p.path); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,70 @@
+//go:build linux
+
+package services
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// TestServerProcessPlacedInLimitedCgroup needs a delegated cgroup v2 the
+// test may create children in, named by TEST_CGROUP_ROOT
+func TestServerProcessPlacedInLimitedCgroup(t *testing.T) {
+	parent := os.Getenv("TEST_CGROUP_ROOT")
+	if parent == "" {
+		t.Skip("TEST_CGROUP_ROOT is not set")
+	}
+
+	root := filepath.Join(parent, "playpulse-test-"+uuid.NewString()[:8])
+	if err := setupCgroupRoot(root); err != nil {
+		t.Fatalf("setupCgroupRoot: %v", err)
+	}
+	t.Cleanup(func() { os.Remove(root) })
+	useResourceLimits(t, ResourceLimitsRequired, root, true)
+
+	server := &models.Server{ID: uuid.New(), MemoryLimit: 1024, CPULimit: 50}
+	cmd := exec.Command("sleep", "30")
+	placement, err := prepareResourceLimits(server, cmd)
+	if err != nil || placement == nil {
+		t.Fatalf("prepareResourceLimits = %v, %v, want a cgroup", placement, err)
+	}
+	if err := cmd.Start(); err != nil {
+		placement.release()
+		t.Fatal(err)
+	}
+	placement.started()
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		placement.release()
+		if _, err := os.Stat(placement.path); !os.IsNotExist(err) {
+			t.Errorf("cgroup %s left behind after the process exited", placement.path)
+		}
+	}()
+
+	membership, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(cmd.Process.Pid), "cgroup"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/server-" + server.ID.String(); !strings.Contains(string(membership), want) {
+		t.Errorf("process cgroup = %q, want it in %s", membership, want)
+	}
+
+	for file, want := range map[string]string{
+		"memory.max": cgroupMemoryMax(server.MemoryLimit),
+		"cpu.max":    cgroupCPUMax(server.CPULimit),
+	} {
+		content, err := os.ReadFile(filepath.Join(placement.path, file))
+		if err != nil || strings.TrimSpace(string(content)) != want {
+			t.Errorf("%s = %q, %v, want %s", file, content, err, want)
+		}
+	}
+}
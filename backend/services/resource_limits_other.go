@@ -0,0 +1,25 @@
+//go:build !linux
+
+package services
+
+import (
+	"errors"
+	"os/exec"
+
+	"playpulse-panel/models"
+)
+
+// cgroupPlacement is the cgroup a server process runs in
+type cgroupPlacement struct{}
+
+func setupCgroupRoot(root string) error {
+	return errors.New("cgroups are only supported on Linux")
+}
+
+func placeServerCgroup(root string, server *models.Server, cmd *exec.Cmd) (*cgroupPlacement, error) {
+	return nil, errors.New("cgroups are only supported on Linux")
+}
+
+func (p *cgroupPlacement) started() {}
+
+func (p *cgroupPlacement) release() {}
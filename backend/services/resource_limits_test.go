@@ -0,0 +1,72 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"testing"
+
+	"playpulse-panel/models"
+)
+
+// useResourceLimits sets the enforcement state until the test ends
+func useResourceLimits(t *testing.T, mode, root string, available bool) {
+	previous := resourceLimits
+	resourceLimits.mode = mode
+	resourceLimits.root = root
+	resourceLimits.available = available
+	resourceLimits.reason = "cgroup v2 is not mounted at /sys/fs/cgroup"
+	t.Cleanup(func() { resourceLimits = previous })
+}
+
+func TestCgroupLimitValues(t *testing.T) {
+	tests := []struct {
+		memoryMB int64
+		want     string
+	}{
+		{0, "max"},
+		{512, fmt.Sprint((512 + 256) * 1024 * 1024)},    // minimum overhead
+		{4096, fmt.Sprint((4096 + 1024) * 1024 * 1024)}, // a quarter of the heap
+	}
+	for _, tt := range tests {
+		if got := cgroupMemoryMax(tt.memoryMB); got != tt.want {
+			t.Errorf("cgroupMemoryMax(%d) = %s, want %s", tt.memoryMB, got, tt.want)
+		}
+	}
+
+	cores := runtime.NumCPU()
+	if got, want := cgroupCPUMax(100), fmt.Sprintf("%d 100000", cores*100000); got != want {
+		t.Errorf("cgroupCPUMax(100) = %s, want every core (%s)", got, want)
+	}
+	if got, want := cgroupCPUMax(50), fmt.Sprintf("%d 100000", cores*50000); got != want {
+		t.Errorf("cgroupCPUMax(50) = %s, want half the host (%s)", got, want)
+	}
+	if got := cgroupCPUMax(0.0001); got != "1000 100000" {
+		t.Errorf("cgroupCPUMax(0.0001) = %s, want the kernel minimum quota", got)
+	}
+	if got := cgroupCPUMax(0); got != "max" {
+		t.Errorf("cgroupCPUMax(0) = %s, want max", got)
+	}
+}
+
+func TestPrepareResourceLimitsFallback(t *testing.T) {
+	limited := &models.Server{MemoryLimit: 1024, CPULimit: 50}
+
+	useResourceLimits(t, ResourceLimitsRequired, "", false)
+	if _, err := prepareResourceLimits(limited, exec.Command("true")); !errors.Is(err, ErrResourceLimitsUnavailable) {
+		t.Errorf("required without cgroups: err = %v, want ErrResourceLimitsUnavailable", err)
+	}
+	// A server without limits has nothing to enforce
+	if placement, err := prepareResourceLimits(&models.Server{}, exec.Command("true")); placement != nil || err != nil {
+		t.Errorf("required, server without limits = %v, %v, want nothing to do", placement, err)
+	}
+
+	for _, mode := range []string{ResourceLimitsAuto, ResourceLimitsOff} {
+		useResourceLimits(t, mode, "", false)
+		cmd := exec.Command("true")
+		if placement, err := prepareResourceLimits(limited, cmd); placement != nil || err != nil || cmd.SysProcAttr != nil {
+			t.Errorf("%s without cgroups = %v, %v, want the server started without limits", mode, placement, err)
+		}
+	}
+}
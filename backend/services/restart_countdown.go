@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"playpulse-panel/models"
+)
+
+// DefaultRestartWarnings is when players are warned before a scheduled restart
+var DefaultRestartWarnings = []time.Duration{5 * time.Minute, time.Minute, 10 * time.Second}
+
+// countdownSleep waits for d or until ctx is done
+var countdownSleep = func(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ParseRestartWarnings parses a comma separated list of durations such as
+// "5m,1m,10s". An empty spec gives DefaultRestartWarnings and "none" gives no
+// warnings.
+func ParseRestartWarnings(spec string) ([]time.Duration, error) {
+	spec = strings.TrimSpace(spec)
+	switch strings.ToLower(spec) {
+	case "":
+		return DefaultRestartWarnings, nil
+	case "none":
+		return nil, nil
+	}
+
+	var warnings []time.Duration
+	for _, part := range strings.Split(spec, ",") {
+		warning, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil || warning <= 0 {
+			return nil, fmt.Errorf("invalid restart warning %q", part)
+		}
+		warnings = append(warnings, warning)
+	}
+
+	return warnings, nil
+}
+
+// RestartWithCountdown warns players at each warning offset before the
+// restart, then restarts the server. A stopped server skips the countdown.
+// Cancelling ctx aborts the restart.
+func RestartWithCountdown(ctx context.Context, server *models.Server, warnings []time.Duration) error {
+	refreshServerState(server)
+	if server.Status != models.ServerStatusRunning || len(warnings) == 0 {
+		return RestartServer(server)
+	}
+
+	// Longest warning first
+	offsets := append([]time.Duration(nil), warnings...)
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] > offsets[j] })
+
+	for i, offset := range offsets {
+		if i > 0 {
+			if err := countdownSleep(ctx, offsets[i-1]-offset); err != nil {
+				return err
+			}
+		}
+
+		for _, command := range restartWarningCommands(server.Type, offset) {
+			// A server that went down meanwhile is simply started again below
+			SendServerCommand(server, command)
+		}
+	}
+
+	if err := countdownSleep(ctx, offsets[len(offsets)-1]); err != nil {
+		return err
+	}
+
+	return RestartServer(server)
+}
+
+// restartWarningCommands returns the console commands announcing a restart
+// in remaining time, in the syntax of the server type
+func restartWarningCommands(serverType models.ServerType, remaining time.Duration) []string {
+	message := fmt.Sprintf("Server restarting in %s", formatCountdown(remaining))
+
+	switch serverType {
+	case models.ServerTypeProxy:
+		// BungeeCord and Waterfall broadcast with alert
+		return []string{"alert " + message}
+	case models.ServerTypeBedrock, models.ServerTypeOther:
+		return []string{"say " + message}
+	default:
+		title, _ := json.Marshal(map[string]string{"text": message, "color": "yellow"})
+		return []string{
+			"say " + message,
+			"title @a actionbar " + string(title),
+		}
+	}
+}
+
+// formatCountdown renders a warning offset as "5 minutes" or "10 seconds"
+func formatCountdown(d time.Duration) string {
+	unit := func(n int, name string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", name)
+		}
+		return fmt.Sprintf("%d %ss", n, name)
+	}
+
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return unit(int(d/time.Hour), "hour")
+	case d >= time.Minute && d%time.Minute == 0:
+		return unit(int(d/time.Minute), "minute")
+	default:
+		return unit(int(d.Round(time.Second)/time.Second), "second")
+	}
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+)
+
+// recordCountdown replaces the countdown's sleep with one that returns at
+// once, recording each wait. A sleep after cancelAfter waits returns
+// context.Canceled; zero never cancels.
+func recordCountdown(t *testing.T, cancelAfter int) func() []time.Duration {
+	var mutex sync.Mutex
+	var waits []time.Duration
+
+	previous := countdownSleep
+	countdownSleep = func(ctx context.Context, d time.Duration) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if cancelAfter > 0 && len(waits) == cancelAfter {
+			return context.Canceled
+		}
+		waits = append(waits, d)
+		return nil
+	}
+	t.Cleanup(func() { countdownSleep = previous })
+
+	return func() []time.Duration {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]time.Duration(nil), waits...)
+	}
+}
+
+// startCountdownServer starts a saved server running the fake server script
+// through StartServer, so a restart can start it again, and waits until it
+// is ready
+func startCountdownServer(t *testing.T) *models.Server {
+	t.Helper()
+
+	java := writeFakeJava(t, fakeServerScript)
+	accepted := time.Now()
+	server := testutil.CreateServer(t, &models.Server{JavaPath: java, ServerJar: "server.jar", StopTimeout: 5, EULAAcceptedAt: &accepted})
+	if err := os.WriteFile(filepath.Join(server.Path, "server.jar"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if hasProcess(server.ID) {
+			stopCopy(t, server)
+		}
+	})
+
+	if err := StartServer(server); err != nil {
+		t.Fatalf("StartServer: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		var current models.Server
+		database.DB.Select("status").First(&current, server.ID)
+		if current.Status == models.ServerStatusRunning {
+			return server
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server status = %s, want running", current.Status)
+		}
+	}
+}
+
+// consoleLines returns the console commands the fake server received, one
+// per line
+func consoleLines(server *models.Server) []string {
+	data, _ := os.ReadFile(filepath.Join(server.Path, "commands.txt"))
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestParseRestartWarnings(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []time.Duration
+	}{
+		{"", DefaultRestartWarnings},
+		{"none", nil},
+		{"NONE", nil},
+		{"5m,1m,10s", []time.Duration{5 * time.Minute, time.Minute, 10 * time.Second}},
+		{" 30s , 2m ", []time.Duration{30 * time.Second, 2 * time.Minute}},
+	}
+	for _, tt := range tests {
+		got, err := ParseRestartWarnings(tt.spec)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRestartWarnings(%q) = %v, %v, want %v", tt.spec, got, err, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"5", "5m,,1m", "-1m", "0s", "soon"} {
+		if _, err := ParseRestartWarnings(spec); err == nil {
+			t.Errorf("ParseRestartWarnings(%q) accepted an invalid spec", spec)
+		}
+	}
+}
+
+func TestRestartWarningCommands(t *testing.T) {
+	tests := []struct {
+		serverType models.ServerType
+		remaining  time.Duration
+		want       []string
+	}{
+		{models.ServerTypePaper, 5 * time.Minute, []string{
+			"say Server restarting in 5 minutes",
+			`title @a actionbar {"color":"yellow","text":"Server restarting in 5 minutes"}`,
+		}},
+		{models.ServerTypeProxy, time.Minute, []string{"alert Server restarting in 1 minute"}},
+		{models.ServerTypeBedrock, 10 * time.Second, []string{"say Server restarting in 10 seconds"}},
+		{models.ServerTypeOther, 2 * time.Hour, []string{"say Server restarting in 2 hours"}},
+		{models.ServerTypeBedrock, 90 * time.Second, []string{"say Server restarting in 90 seconds"}},
+	}
+	for _, tt := range tests {
+		if got := restartWarningCommands(tt.serverType, tt.remaining); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s, %s: commands = %q, want %q", tt.serverType, tt.remaining, got, tt.want)
+		}
+	}
+}
+
+func TestRestartCountdownWarnsBeforeStop(t *testing.T) {
+	testDB(t)
+	waits := recordCountdown(t, 0)
+	server := startCountdownServer(t)
+
+	// Unsorted on purpose; the longest warning comes first
+	if err := RestartWithCountdown(context.Background(), server, []time.Duration{10 * time.Second, 5 * time.Minute, time.Minute}); err != nil {
+		t.Fatalf("RestartWithCountdown: %v", err)
+	}
+
+	var want []string
+	for _, remaining := range []string{"5 minutes", "1 minute", "10 seconds"} {
+		message := "Server restarting in " + remaining
+		want = append(want, "say "+message, `title @a actionbar {"color":"yellow","text":"`+message+`"}`)
+	}
+	want = append(want, "save-all", "stop")
+	if got := consoleLines(server); !reflect.DeepEqual(got, want) {
+		t.Errorf("console commands = %q, want %q", got, want)
+	}
+
+	// Each wait runs to the next warning, the last one to the restart
+	if got, want := waits(), []time.Duration{4 * time.Minute, 50 * time.Second, 10 * time.Second}; !reflect.DeepEqual(got, want) {
+		t.Errorf("waits = %v, want %v", got, want)
+	}
+	if !hasProcess(server.ID) {
+		t.Error("server was not started again after the countdown")
+	}
+}
+
+func TestRestartCountdownCancelled(t *testing.T) {
+	testDB(t)
+	recordCountdown(t, 1)
+	server := startCountdownServer(t)
+	pid := server.PID
+
+	err := RestartWithCountdown(context.Background(), server, []time.Duration{5 * time.Minute, time.Minute, 10 * time.Second})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("RestartWithCountdown = %v, want context.Canceled", err)
+	}
+
+	// Let the fake server log anything still in its console pipe
+	time.Sleep(200 * time.Millisecond)
+	var got []string
+	for _, line := range consoleLines(server) {
+		if strings.HasPrefix(line, "say ") || line == "stop" {
+			got = append(got, line)
+		}
+	}
+	if want := []string{"say Server restarting in 5 minutes", "say Server restarting in 1 minute"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("console commands = %q, want the warnings so far and no stop", got)
+	}
+	if cmd, ok := manager.getProcess(server.ID); !ok || cmd.Process.Pid != pid {
+		t.Error("a cancelled countdown restarted the server")
+	}
+}
+
+func TestRestartCountdownWithoutWarningsRestartsRightAway(t *testing.T) {
+	testDB(t)
+	waits := recordCountdown(t, 0)
+	server := startCountdownServer(t)
+
+	if err := RestartWithCountdown(context.Background(), server, nil); err != nil {
+		t.Fatalf("RestartWithCountdown: %v", err)
+	}
+	if got := consoleLines(server); !reflect.DeepEqual(got, []string{"save-all", "stop"}) {
+		t.Errorf("console commands = %q, want an immediate stop", got)
+	}
+	if got := waits(); len(got) != 0 {
+		t.Errorf("waited %v before an immediate restart", got)
+	}
+}
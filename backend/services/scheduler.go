@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// schedulerInterval is how often due schedules are looked up
+const schedulerInterval = 30 * time.Second
+
+// ErrInvalidSchedule is returned when a schedule's pattern, action or options
+// can't be run
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// restartCountdowns holds the cancel function of each server's running
+// restart countdown
+var (
+	restartCountdowns      = make(map[uuid.UUID]context.CancelFunc)
+	restartCountdownsMutex sync.Mutex
+)
+
+// InitializeScheduler starts running server schedules at their cron times
+func InitializeScheduler() {
+	go func() {
+		ticker := time.NewTicker(schedulerInterval)
+		defer ticker.Stop()
+
+		for {
+			runDueSchedules(time.Now())
+			<-ticker.C
+		}
+	}()
+}
+
+// runDueSchedules runs every active schedule whose next run has passed and
+// works out the next run of new schedules
+func runDueSchedules(now time.Time) {
+	var schedules []models.Schedule
+	if err := database.DB.Where("is_active = ? AND (next_run IS NULL OR next_run <= ?)", true, now).
+		Find(&schedules).Error; err != nil {
+		log.Printf("Failed to load due schedules: %v", err)
+		return
+	}
+
+	for i := range schedules {
+		schedule := &schedules[i]
+
+		cron, err := parseCron(schedule.CronPattern)
+		if err != nil {
+			log.Printf("Schedule %s has an invalid cron pattern, disabling it: %v", schedule.Name, err)
+			database.DB.Model(schedule).Update("is_active", false)
+			continue
+		}
+
+		// A schedule without a next run was just created; it first runs at its next match
+		due := schedule.NextRun != nil
+
+		next := cron.Next(now)
+		updates := map[string]interface{}{"next_run": next}
+		if next.IsZero() {
+			updates["next_run"] = nil
+			updates["is_active"] = false
+		}
+		if due {
+			updates["last_run"] = now
+			updates["run_count"] = schedule.RunCount + 1
+		}
+		if err := database.DB.Model(schedule).Updates(updates).Error; err != nil {
+			log.Printf("Failed to update schedule %s: %v", schedule.Name, err)
+			continue
+		}
+
+		if due {
+			go runSchedule(*schedule)
+		}
+	}
+}
+
+// PrepareSchedule checks a schedule before it is saved and works out its next
+// run, so the scheduler picks it up at the first match of its pattern
+func PrepareSchedule(schedule *models.Schedule, now time.Time) error {
+	cron, err := parseCron(schedule.CronPattern)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+
+	switch schedule.Action {
+	case models.ScheduleActionRestart:
+		if _, err := ParseRestartWarnings(schedule.RestartWarnings); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+	case models.ScheduleActionCommand:
+		if strings.TrimSpace(schedule.Command) == "" {
+			return fmt.Errorf("%w: the command action needs a command", ErrInvalidSchedule)
+		}
+	case models.ScheduleActionStop, models.ScheduleActionStart, models.ScheduleActionBackup:
+	default:
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidSchedule, schedule.Action)
+	}
+
+	schedule.NextRun = nil
+	if next := cron.Next(now); !next.IsZero() {
+		schedule.NextRun = &next
+	} else if schedule.IsActive {
+		return fmt.Errorf("%w: the cron pattern never matches", ErrInvalidSchedule)
+	}
+	return nil
+}
+
+// runSchedule performs a schedule's action on its server
+func runSchedule(schedule models.Schedule) {
+	var server models.Server
+	if err := database.DB.First(&server, schedule.ServerID).Error; err != nil {
+		log.Printf("Schedule %s: server not found", schedule.Name)
+		return
+	}
+
+	var err error
+	switch schedule.Action {
+	case models.ScheduleActionRestart:
+		warnings, parseErr := ParseRestartWarnings(schedule.RestartWarnings)
+		if parseErr != nil {
+			log.Printf("Schedule %s: %v, using the default warnings", schedule.Name, parseErr)
+			warnings = DefaultRestartWarnings
+		}
+		err = StartRestartCountdown(&server, warnings)
+	case models.ScheduleActionStop:
+		err = StopServer(&server)
+	case models.ScheduleActionStart:
+		err = StartServer(&server)
+	case models.ScheduleActionCommand:
+		err = SendServerCommand(&server, schedule.Command)
+	case models.ScheduleActionBackup:
+		err = CreateBackup(&server, fmt.Sprintf("scheduled-%s", time.Now().Format("20060102-150405")))
+	default:
+		err = fmt.Errorf("unknown action %q", schedule.Action)
+	}
+
+	if err != nil {
+		log.Printf("Schedule %s on server %s failed: %v", schedule.Name, server.Name, err)
+	}
+}
+
+// StartRestartCountdown restarts the server after warning players, unless a
+// countdown for it is already running. It blocks until the restart is done
+// or the countdown is cancelled.
+func StartRestartCountdown(server *models.Server, warnings []time.Duration) error {
+	restartCountdownsMutex.Lock()
+	if _, running := restartCountdowns[server.ID]; running {
+		restartCountdownsMutex.Unlock()
+		return fmt.Errorf("a restart countdown is already running")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	restartCountdowns[server.ID] = cancel
+	restartCountdownsMutex.Unlock()
+
+	defer func() {
+		restartCountdownsMutex.Lock()
+		delete(restartCountdowns, server.ID)
+		restartCountdownsMutex.Unlock()
+		cancel()
+	}()
+
+	return RestartWithCountdown(ctx, server, warnings)
+}
+
+// CancelRestartCountdown stops a running restart countdown, e.g. when an
+// admin restarts the server right away. It reports whether one was running.
+func CancelRestartCountdown(serverID uuid.UUID) bool {
+	restartCountdownsMutex.Lock()
+	defer restartCountdownsMutex.Unlock()
+
+	cancel, running := restartCountdowns[serverID]
+	if running {
+		cancel()
+	}
+	return running
+}
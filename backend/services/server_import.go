@@ -0,0 +1,261 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+)
+
+var (
+	// ErrImportNotDirectory is returned for an import path that isn't an
+	// existing directory
+	ErrImportNotDirectory = errors.New("import path is not an existing directory")
+	// ErrImportEmptyDirectory is returned for an import directory with nothing in it
+	ErrImportEmptyDirectory = errors.New("import directory is empty")
+	// ErrImportUnrecognized is returned when no server software is found in
+	// the import directory
+	ErrImportUnrecognized = errors.New("no server software found in the directory")
+)
+
+// DetectedServer is the server software found in a directory
+type DetectedServer struct {
+	Type         models.ServerType `json:"type"`
+	Version      string            `json:"version"`
+	ServerJar    string            `json:"server_jar,omitempty"`
+	StartCommand string            `json:"start_command,omitempty"`
+	Port         int               `json:"port,omitempty"` // server-port from server.properties, if set
+}
+
+// serverJarPattern recognizes a server jar by name; the first group is the
+// version
+type serverJarPattern struct {
+	serverType models.ServerType
+	pattern    *regexp.Regexp
+}
+
+// serverJarPatterns are checked in order, so loader jars that wrap another
+// server come before the plain ones
+var serverJarPatterns = []serverJarPattern{
+	{models.ServerTypeFabric, regexp.MustCompile(`^fabric-server-mc\.(.+?)-loader\..*\.jar$`)},
+	{models.ServerTypeFabric, regexp.MustCompile(`^fabric-server-launch()\.jar$`)},
+	{models.ServerTypeForge, regexp.MustCompile(`^forge-(\d.*?)(?:-universal|-shim)?\.jar$`)},
+	{models.ServerTypePurpur, regexp.MustCompile(`^purpur-(\d[\d.]*)(?:-\d+)?\.jar$`)},
+	{models.ServerTypePaper, regexp.MustCompile(`^paper-(\d[\d.]*)(?:-\d+)?\.jar$`)},
+	{models.ServerTypeSpigot, regexp.MustCompile(`^spigot-(\d[\d.]*)\.jar$`)},
+	{models.ServerTypeVanilla, regexp.MustCompile(`^minecraft_server\.(\d[\d.]*)\.jar$`)},
+}
+
+// versionHistoryPattern finds the Minecraft version in Paper and Purpur's
+// version_history.json, e.g. "git-Paper-496 (MC: 1.20.4)"
+var versionHistoryPattern = regexp.MustCompile(`git-(\w+)-\S+ \(MC: ([^)]+)\)`)
+
+// DetectServer inspects a server directory and works out the server type,
+// version and how to launch it, from the jar names, the version.json inside
+// the jar and the files loaders leave behind
+func DetectServer(dir string) (*DetectedServer, error) {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return nil, ErrImportNotDirectory
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrImportEmptyDirectory
+	}
+
+	detected, err := detectServerSoftware(dir, entries)
+	if err != nil {
+		return nil, err
+	}
+	detected.Port = propertiesPort(dir)
+	return detected, nil
+}
+
+// detectServerSoftware finds the server software among a directory's entries
+func detectServerSoftware(dir string, entries []os.DirEntry) (*DetectedServer, error) {
+	if utils.FileExists(filepath.Join(dir, bedrockBinary)) {
+		return &DetectedServer{Type: models.ServerTypeBedrock, ServerJar: bedrockBinary}, nil
+	}
+
+	// Forge 1.17+ launches from an args file under libraries/
+	argsFiles, _ := filepath.Glob(filepath.Join(dir, "libraries", "net", "minecraftforge", "forge", "*", "unix_args.txt"))
+	if len(argsFiles) > 0 {
+		forgeVersion := filepath.Base(filepath.Dir(argsFiles[0]))
+		serverJar, startCommand, err := detectForgeLaunch(dir, forgeVersion)
+		if err != nil {
+			return nil, err
+		}
+		return &DetectedServer{Type: models.ServerTypeForge, Version: forgeVersion, ServerJar: serverJar, StartCommand: startCommand}, nil
+	}
+
+	var jars []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasSuffix(name, ".jar") && !strings.HasSuffix(name, "-installer.jar") {
+			jars = append(jars, name)
+		}
+	}
+
+	for _, candidate := range serverJarPatterns {
+		for _, jar := range jars {
+			match := candidate.pattern.FindStringSubmatch(jar)
+			if match == nil {
+				continue
+			}
+			detected := &DetectedServer{Type: candidate.serverType, Version: match[1], ServerJar: jar}
+			if detected.Version == "" {
+				// The Fabric launcher runs the vanilla jar named in its
+				// properties, which knows the version
+				detected.Version = jarVersion(filepath.Join(dir, fabricServerJar(dir)))
+			}
+			return detected, nil
+		}
+	}
+
+	// Any other jar: Paper and Purpur record what they are in
+	// version_history.json, everything else is taken to be vanilla
+	if len(jars) == 0 {
+		return nil, ErrImportUnrecognized
+	}
+	if serverType, version := versionHistory(dir); serverType != "" {
+		return &DetectedServer{Type: serverType, Version: version, ServerJar: jars[0]}, nil
+	}
+	for _, jar := range jars {
+		if version := jarVersion(filepath.Join(dir, jar)); version != "" {
+			serverType := models.ServerTypeVanilla
+			if utils.FileExists(filepath.Join(dir, ".fabric")) {
+				serverType = models.ServerTypeFabric
+			}
+			return &DetectedServer{Type: serverType, Version: version, ServerJar: jar}, nil
+		}
+	}
+
+	return nil, ErrImportUnrecognized
+}
+
+// jarVersion reads the Minecraft version from the version.json inside a
+// server jar, or returns "" if there is none
+func jarVersion(jarPath string) string {
+	reader, err := zip.OpenReader(jarPath)
+	if err != nil {
+		return ""
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if file.Name != "version.json" {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return ""
+		}
+		defer rc.Close()
+
+		var version struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(io.LimitReader(rc, 1<<20)).Decode(&version); err != nil {
+			return ""
+		}
+		if version.ID != "" {
+			return version.ID
+		}
+		return version.Name
+	}
+	return ""
+}
+
+// fabricServerJar is the vanilla jar the Fabric launcher runs
+func fabricServerJar(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "fabric-server-launcher.properties"))
+	if err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if key, value, ok := parsePropertyLine(line); ok && key == "serverJar" {
+				return value
+			}
+		}
+	}
+	return "server.jar"
+}
+
+// versionHistory reads the server type and Minecraft version from Paper or
+// Purpur's version_history.json
+func versionHistory(dir string) (models.ServerType, string) {
+	data, err := os.ReadFile(filepath.Join(dir, "version_history.json"))
+	if err != nil {
+		return "", ""
+	}
+
+	var history struct {
+		CurrentVersion string `json:"currentVersion"`
+	}
+	if err := json.Unmarshal(data, &history); err != nil {
+		return "", ""
+	}
+	match := versionHistoryPattern.FindStringSubmatch(history.CurrentVersion)
+	if match == nil {
+		return "", ""
+	}
+
+	switch strings.ToLower(match[1]) {
+	case "paper":
+		return models.ServerTypePaper, match[2]
+	case "purpur":
+		return models.ServerTypePurpur, match[2]
+	}
+	return "", ""
+}
+
+// propertiesPort returns server-port from a directory's server.properties,
+// or 0 if it isn't set
+func propertiesPort(dir string) int {
+	lines, err := readPropertiesLines(&models.Server{Path: dir})
+	if err != nil {
+		return 0
+	}
+	for _, line := range lines {
+		if key, value, ok := parsePropertyLine(line); ok && key == "server-port" {
+			port, _ := strconv.Atoi(value)
+			return port
+		}
+	}
+	return 0
+}
+
+// SetPropertiesPort writes the server's port to server-port in its
+// server.properties, which applyServerProperties leaves alone
+func SetPropertiesPort(server *models.Server) error {
+	lines, err := readPropertiesLines(server)
+	if err != nil {
+		return err
+	}
+
+	port := fmt.Sprintf("server-port=%d", server.Port)
+	found := false
+	for i, line := range lines {
+		if key, _, ok := parsePropertyLine(line); ok && key == "server-port" {
+			lines[i] = port
+			found = true
+		}
+	}
+	if !found {
+		lines = append(lines, port)
+	}
+
+	propertiesPath := filepath.Join(server.Path, "server.properties")
+	return os.WriteFile(propertiesPath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
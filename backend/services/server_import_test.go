@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"playpulse-panel/models"
+)
+
+// writeServerJar writes a jar at path whose version.json names version
+func writeServerJar(t *testing.T, path, version string) {
+	t.Helper()
+
+	jar := writeTestZip(t, map[string]string{"version.json": `{"id": "` + version + `", "name": "` + version + `"}`})
+	if err := os.Rename(jar, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDetectServer(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       []string
+		setup       func(t *testing.T, dir string)
+		wantType    models.ServerType
+		wantVersion string
+		wantJar     string
+	}{
+		{
+			name:        "paper",
+			files:       []string{"paper-1.20.4-496.jar", "server.properties", "plugins/LuckPerms.jar"},
+			wantType:    models.ServerTypePaper,
+			wantVersion: "1.20.4",
+			wantJar:     "paper-1.20.4-496.jar",
+		},
+		{
+			name:        "fabric",
+			files:       []string{"fabric-server-mc.1.20.1-loader.0.14.21-launcher.1.0.0.jar", "mods/fabric-api.jar"},
+			wantType:    models.ServerTypeFabric,
+			wantVersion: "1.20.1",
+			wantJar:     "fabric-server-mc.1.20.1-loader.0.14.21-launcher.1.0.0.jar",
+		},
+		{
+			name:  "fabric launcher",
+			files: []string{"fabric-server-launch.jar", "fabric-server-launcher.properties"},
+			setup: func(t *testing.T, dir string) {
+				os.WriteFile(filepath.Join(dir, "fabric-server-launcher.properties"), []byte("serverJar=vanilla.jar\n"), 0644)
+				writeServerJar(t, filepath.Join(dir, "vanilla.jar"), "1.19.4")
+			},
+			wantType:    models.ServerTypeFabric,
+			wantVersion: "1.19.4",
+			wantJar:     "fabric-server-launch.jar",
+		},
+		{
+			name:  "renamed paper jar",
+			files: []string{"server.jar"},
+			setup: func(t *testing.T, dir string) {
+				os.WriteFile(filepath.Join(dir, "version_history.json"),
+					[]byte(`{"currentVersion": "git-Paper-196 (MC: 1.20.2)"}`), 0644)
+			},
+			wantType:    models.ServerTypePaper,
+			wantVersion: "1.20.2",
+			wantJar:     "server.jar",
+		},
+		{
+			name: "vanilla from the jar's version.json",
+			setup: func(t *testing.T, dir string) {
+				writeServerJar(t, filepath.Join(dir, "server.jar"), "1.21")
+			},
+			wantType:    models.ServerTypeVanilla,
+			wantVersion: "1.21",
+			wantJar:     "server.jar",
+		},
+		{
+			name:     "bedrock",
+			files:    []string{bedrockBinary, "server.properties"},
+			wantType: models.ServerTypeBedrock,
+			wantJar:  bedrockBinary,
+		},
+		{
+			name:        "forge with an args file",
+			files:       []string{"libraries/net/minecraftforge/forge/1.20.1-47.2.0/unix_args.txt", "run.sh"},
+			wantType:    models.ServerTypeForge,
+			wantVersion: "1.20.1-47.2.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTestServerFiles(t, tt.files...)
+			if tt.setup != nil {
+				tt.setup(t, dir)
+			}
+
+			detected, err := DetectServer(dir)
+			if err != nil {
+				t.Fatalf("DetectServer: %v", err)
+			}
+			if detected.Type != tt.wantType || detected.Version != tt.wantVersion {
+				t.Errorf("detected %s %s, want %s %s", detected.Type, detected.Version, tt.wantType, tt.wantVersion)
+			}
+			if tt.wantJar != "" && detected.ServerJar != tt.wantJar {
+				t.Errorf("server jar = %q, want %q", detected.ServerJar, tt.wantJar)
+			}
+		})
+	}
+}
+
+func TestDetectServerRejectsDirectory(t *testing.T) {
+	notDir := filepath.Join(t.TempDir(), "server.jar")
+	os.WriteFile(notDir, nil, 0644)
+
+	tests := []struct {
+		name string
+		dir  string
+		want error
+	}{
+		{"empty directory", t.TempDir(), ErrImportEmptyDirectory},
+		{"missing directory", filepath.Join(t.TempDir(), "missing"), ErrImportNotDirectory},
+		{"file", notDir, ErrImportNotDirectory},
+		{"no server software", writeTestServerFiles(t, "world/level.dat", "server.properties"), ErrImportUnrecognized},
+		{"jar that isn't a server", writeTestServerFiles(t, "tool.jar"), ErrImportUnrecognized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DetectServer(tt.dir); !errors.Is(err, tt.want) {
+				t.Errorf("DetectServer = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectServerReadsPort(t *testing.T) {
+	dir := writeTestServerFiles(t, "paper-1.20.4-496.jar")
+	os.WriteFile(filepath.Join(dir, "server.properties"), []byte("motd=Hello\nserver-port=25570\n"), 0644)
+
+	detected, err := DetectServer(dir)
+	if err != nil {
+		t.Fatalf("DetectServer: %v", err)
+	}
+	if detected.Port != 25570 {
+		t.Errorf("port = %d, want 25570 from server.properties", detected.Port)
+	}
+
+	server := &models.Server{Path: dir, Port: 30123}
+	if err := SetPropertiesPort(server); err != nil {
+		t.Fatalf("SetPropertiesPort: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "server.properties"))
+	if !strings.Contains(string(data), "server-port=30123") || strings.Contains(string(data), "25570") ||
+		!strings.Contains(string(data), "motd=Hello") {
+		t.Errorf("server.properties = %q, want only the port changed", data)
+	}
+}
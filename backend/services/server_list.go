@@ -0,0 +1,184 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidServerList is returned for an unknown sort, status or tag
+var ErrInvalidServerList = errors.New("invalid server list query")
+
+const (
+	defaultServerPageSize = 25
+	maxServerPageSize     = 100
+	// serverStatusRefreshInterval is how often listing servers checks their
+	// processes; listings in between show the stored status
+	serverStatusRefreshInterval = 15 * time.Second
+)
+
+// serverSortColumns maps the ?sort= keys to their columns
+var serverSortColumns = map[string]string{
+	"name":       "servers.name",
+	"type":       "servers.type",
+	"status":     "servers.status",
+	"port":       "servers.port",
+	"created_at": "servers.created_at",
+	"updated_at": "servers.updated_at",
+}
+
+// ServerListOptions filters, sorts and pages a server listing. Sort is a
+// key of serverSortColumns, prefixed with - for descending order. All
+// servers are listed while Page and Limit are both 0.
+type ServerListOptions struct {
+	Tag    string
+	Status string
+	Sort   string
+	Page   int
+	Limit  int
+}
+
+// ServerPage is one page of the servers a user can access
+type ServerPage struct {
+	Servers []models.Server            `json:"servers"`
+	Groups  map[string][]models.Server `json:"groups,omitempty"`
+	Page    int                        `json:"page"`
+	Limit   int                        `json:"limit"`
+	Total   int64                      `json:"total"`
+}
+
+// statusRefreshes records when each server's status was last checked
+var statusRefreshes = struct {
+	sync.Mutex
+	checked map[uuid.UUID]time.Time
+}{checked: make(map[uuid.UUID]time.Time)}
+
+// ListServers returns the servers the user can access: all of them for
+// admins, otherwise those they are a member of
+func ListServers(user models.User, opts ServerListOptions) (*ServerPage, error) {
+	order, err := serverListOrder(opts.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	query := database.DB.Model(&models.Server{})
+	if user.Role != models.RoleAdmin {
+		query = query.Joins("JOIN user_servers ON user_servers.server_id = servers.id").
+			Where("user_servers.user_id = ?", user.ID)
+	}
+
+	if opts.Tag != "" {
+		query, err = WhereServerTag(query, opts.Tag)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidServerList, err)
+		}
+	}
+
+	if opts.Status != "" {
+		status := models.ServerStatus(strings.ToLower(opts.Status))
+		switch status {
+		case models.ServerStatusStopped, models.ServerStatusStarting, models.ServerStatusRunning,
+			models.ServerStatusStopping, models.ServerStatusCrashed, models.ServerStatusHibernating,
+			models.ServerStatusUnknown:
+		default:
+			return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidServerList, opts.Status)
+		}
+		query = query.Where("servers.status = ?", status)
+	}
+
+	result := &ServerPage{Servers: []models.Server{}}
+	if opts.Page > 0 || opts.Limit > 0 {
+		result.Page, result.Limit = opts.Page, opts.Limit
+		if result.Page < 1 {
+			result.Page = 1
+		}
+		if result.Limit < 1 {
+			result.Limit = defaultServerPageSize
+		}
+		if result.Limit > maxServerPageSize {
+			result.Limit = maxServerPageSize
+		}
+
+		if err := query.Count(&result.Total).Error; err != nil {
+			return nil, err
+		}
+		query = query.Offset((result.Page - 1) * result.Limit).Limit(result.Limit)
+	}
+
+	err = query.Preload("Users").Preload("Metrics", func(db *gorm.DB) *gorm.DB {
+		return db.Order("timestamp DESC").Limit(1)
+	}).Order(order).Find(&result.Servers).Error
+	if err != nil {
+		return nil, err
+	}
+	if result.Limit == 0 {
+		result.Total = int64(len(result.Servers))
+	}
+
+	return result, nil
+}
+
+// serverListOrder returns the ORDER BY clause for a ?sort= value. The ID
+// breaks ties so pages don't overlap.
+func serverListOrder(sort string) (string, error) {
+	direction := "ASC"
+	if strings.HasPrefix(sort, "-") {
+		direction = "DESC"
+		sort = sort[1:]
+	}
+	if sort == "" {
+		sort = "name"
+	}
+
+	column, ok := serverSortColumns[sort]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown sort %q", ErrInvalidServerList, sort)
+	}
+	return fmt.Sprintf("%s %s, servers.id %s", column, direction, direction), nil
+}
+
+// RefreshServerStatuses checks the processes of listed servers in the
+// background, so a listing isn't held up by them. Each server is checked
+// at most once per serverStatusRefreshInterval and a corrected status
+// shows in the next listing.
+func RefreshServerStatuses(servers []models.Server) {
+	now := time.Now()
+
+	statusRefreshes.Lock()
+	for id, checked := range statusRefreshes.checked {
+		if now.Sub(checked) >= serverStatusRefreshInterval {
+			delete(statusRefreshes.checked, id)
+		}
+	}
+	var due []uuid.UUID
+	for _, server := range servers {
+		if _, recent := statusRefreshes.checked[server.ID]; !recent {
+			statusRefreshes.checked[server.ID] = now
+			due = append(due, server.ID)
+		}
+	}
+	statusRefreshes.Unlock()
+
+	if len(due) == 0 {
+		return
+	}
+
+	go func() {
+		// Reloaded without associations so saving a status doesn't write them
+		var stale []models.Server
+		if err := database.DB.Where("id IN ?", due).Find(&stale).Error; err != nil {
+			return
+		}
+		for i := range stale {
+			UpdateServerStatus(&stale[i])
+		}
+	}()
+}
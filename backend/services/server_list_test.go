@@ -0,0 +1,181 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// createListedServers saves a server for each status, named in order with
+// a shared prefix, and gives a new user access to all of them. A server
+// the user can't access is saved too.
+func createListedServers(t *testing.T, statuses ...models.ServerStatus) (models.User, []*models.Server, *models.Server) {
+	t.Helper()
+
+	user := testutil.CreateUser(t, &models.User{})
+	prefix := "list-" + uuid.NewString()[:8] + "-"
+	var servers []*models.Server
+	for i, status := range statuses {
+		server := testutil.CreateServer(t, &models.Server{Name: prefix + string(rune('a'+i)), Status: status})
+		testutil.GrantServerAccess(t, user, server, models.ServerRoleMember)
+		servers = append(servers, server)
+	}
+	other := testutil.CreateServer(t, &models.Server{Name: prefix + "z", Status: models.ServerStatusRunning})
+	return *user, servers, other
+}
+
+// serverNames returns the names of listed servers
+func serverNames(servers []models.Server) string {
+	names := make([]string, len(servers))
+	for i, server := range servers {
+		names[i] = server.Name[len(server.Name)-1:]
+	}
+	return strings.Join(names, ",")
+}
+
+func TestListServersPagination(t *testing.T) {
+	testDB(t)
+	user, _, _ := createListedServers(t,
+		models.ServerStatusStopped, models.ServerStatusRunning, models.ServerStatusStopped,
+		models.ServerStatusRunning, models.ServerStatusCrashed)
+
+	tests := []struct {
+		opts      ServerListOptions
+		want      string
+		page      int
+		limit     int
+		wantTotal int64
+	}{
+		{ServerListOptions{}, "a,b,c,d,e", 0, 0, 5},
+		{ServerListOptions{Page: 1, Limit: 2}, "a,b", 1, 2, 5},
+		{ServerListOptions{Page: 3, Limit: 2}, "e", 3, 2, 5},
+		{ServerListOptions{Page: 4, Limit: 2}, "", 4, 2, 5},
+		{ServerListOptions{Limit: 5}, "a,b,c,d,e", 1, 5, 5},
+		{ServerListOptions{Page: 2}, "", 2, defaultServerPageSize, 5},
+		{ServerListOptions{Page: -1, Limit: 1000}, "a,b,c,d,e", 1, maxServerPageSize, 5},
+		{ServerListOptions{Sort: "-name", Page: 1, Limit: 2}, "e,d", 1, 2, 5},
+	}
+	for _, tt := range tests {
+		page, err := ListServers(user, tt.opts)
+		if err != nil {
+			t.Fatalf("ListServers(%+v): %v", tt.opts, err)
+		}
+		if got := serverNames(page.Servers); got != tt.want || page.Page != tt.page || page.Limit != tt.limit || page.Total != tt.wantTotal {
+			t.Errorf("ListServers(%+v) = %s page %d limit %d total %d, want %s page %d limit %d total %d",
+				tt.opts, got, page.Page, page.Limit, page.Total, tt.want, tt.page, tt.limit, tt.wantTotal)
+		}
+	}
+
+	for _, sort := range []string{"password", "-", "name;drop"} {
+		if _, err := ListServers(user, ServerListOptions{Sort: sort}); !errors.Is(err, ErrInvalidServerList) {
+			t.Errorf("ListServers with sort %q = %v, want ErrInvalidServerList", sort, err)
+		}
+	}
+}
+
+func TestListServersFiltersStatusInQuery(t *testing.T) {
+	testDB(t)
+	user, servers, _ := createListedServers(t,
+		models.ServerStatusStopped, models.ServerStatusRunning, models.ServerStatusStopped,
+		models.ServerStatusRunning, models.ServerStatusRunning)
+
+	// Record the queries on servers
+	var filtered atomic.Int32
+	name := "test:server_list_queries"
+	database.DB.Callback().Query().After("gorm:query").Register(name, func(db *gorm.DB) {
+		if db.Statement.Table == "servers" && strings.Contains(db.Statement.SQL.String(), "servers.status =") {
+			filtered.Add(1)
+		}
+	})
+	t.Cleanup(func() { database.DB.Callback().Query().Remove(name) })
+
+	// Filtering after paging would leave the second page short and count
+	// every server
+	page, err := ListServers(user, ServerListOptions{Status: "RUNNING", Page: 2, Limit: 2})
+	if err != nil {
+		t.Fatalf("ListServers: %v", err)
+	}
+	if got := serverNames(page.Servers); got != "e" || page.Total != 3 {
+		t.Errorf("running page 2 = %s of %d, want e of 3", got, page.Total)
+	}
+	if filtered.Load() == 0 {
+		t.Error("no query on servers filtered by status")
+	}
+
+	page, _ = ListServers(user, ServerListOptions{Status: "stopped"})
+	if got := serverNames(page.Servers); got != "a,c" || page.Total != 2 {
+		t.Errorf("stopped servers = %s, want a,c", got)
+	}
+	for _, server := range page.Servers {
+		if server.ID == servers[1].ID {
+			t.Error("running server listed as stopped")
+		}
+	}
+
+	if _, err := ListServers(user, ServerListOptions{Status: "exploded"}); !errors.Is(err, ErrInvalidServerList) {
+		t.Errorf("ListServers with an unknown status = %v, want ErrInvalidServerList", err)
+	}
+}
+
+func TestListServersScopesToMemberships(t *testing.T) {
+	testDB(t)
+	user, servers, other := createListedServers(t, models.ServerStatusStopped)
+	admin := testutil.CreateUser(t, &models.User{Role: models.RoleAdmin})
+
+	listed := func(user models.User, id uuid.UUID) bool {
+		page, err := ListServers(user, ServerListOptions{Status: "running"})
+		if err != nil {
+			t.Fatalf("ListServers: %v", err)
+		}
+		for _, server := range page.Servers {
+			if server.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+	if listed(user, other.ID) {
+		t.Error("user sees a server they aren't a member of")
+	}
+	if !listed(*admin, other.ID) {
+		t.Error("admin doesn't see every server")
+	}
+
+	page, _ := ListServers(user, ServerListOptions{})
+	if len(page.Servers) != 1 || page.Servers[0].ID != servers[0].ID {
+		t.Errorf("user's servers = %s, want only their own", serverNames(page.Servers))
+	}
+}
+
+func TestRefreshServerStatusesInBackground(t *testing.T) {
+	testDB(t)
+
+	// Marked running, but with no process
+	server := testutil.CreateServer(t, &models.Server{Status: models.ServerStatusRunning})
+
+	RefreshServerStatuses([]models.Server{*server})
+	waitForServerStatus(t, server.ID, models.ServerStatusStopped)
+
+	// Checked again only once the refresh interval has passed
+	database.DB.Model(server).Update("status", models.ServerStatusRunning)
+	RefreshServerStatuses([]models.Server{*server})
+	time.Sleep(200 * time.Millisecond)
+	if status := serverStatus(server.ID); status != models.ServerStatusRunning {
+		t.Errorf("status = %s, want the server left alone until the interval passed", status)
+	}
+
+	statusRefreshes.Lock()
+	statusRefreshes.checked[server.ID] = time.Now().Add(-serverStatusRefreshInterval)
+	statusRefreshes.Unlock()
+	RefreshServerStatuses([]models.Server{*server})
+	waitForServerStatus(t, server.ID, models.ServerStatusStopped)
+}
@@ -2,14 +2,17 @@ package services
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -20,15 +23,62 @@ import (
 	"github.com/google/uuid"
 )
 
-// ServerManager handles server operations
+// ServerManager handles server operations. The processes it tracks are
+// used from the start, stop and monitor goroutines, so they are only
+// accessed through its methods, which hold mutex.
 type ServerManager struct {
 	processes map[uuid.UUID]*exec.Cmd
+	stdins    map[uuid.UUID]io.WriteCloser
+	mutex     sync.RWMutex
 }
 
 var manager = &ServerManager{
 	processes: make(map[uuid.UUID]*exec.Cmd),
+	stdins:    make(map[uuid.UUID]io.WriteCloser),
 }
 
+var (
+	// ErrServerAlreadyRunning is returned when starting a server that has a process
+	ErrServerAlreadyRunning = errors.New("server is already running")
+	// ErrServerAlreadyStopped is returned when stopping a server that is not running
+	ErrServerAlreadyStopped = errors.New("server is already stopped")
+)
+
+// serverLocks holds a mutex per server ID. Start, stop and restart hold it
+// from the status check until the process is spawned or gone, so concurrent
+// requests cannot launch the same server twice. An entry is removed once no
+// caller holds or waits for it.
+var (
+	serverLocks      = make(map[uuid.UUID]*serverLock)
+	serverLocksMutex sync.Mutex
+)
+
+// serverLock is a server's operation lock and how many callers hold or wait for it
+type serverLock struct {
+	mutex sync.Mutex
+	refs  int
+}
+
+// stopOperations tracks StopServer calls in progress so shutdown can let
+// them finish saving the world. Stops are only added while stopsClosed is
+// unset, so no Add races the shutdown's Wait.
+var (
+	stopOperations sync.WaitGroup
+	stopsMutex     sync.Mutex
+	stopsClosed    bool
+)
+
+const (
+	// Default time to wait for a save or shutdown before escalating
+	defaultStopTimeout = 60 * time.Second
+
+	// Auto-restart gives up after maxCrashRestarts crashes within crashWindow.
+	// A run lasting healthyRunDuration clears the crash history.
+	maxCrashRestarts   = 3
+	crashWindow        = 10 * time.Minute
+	healthyRunDuration = 10 * time.Minute
+)
+
 // ServerStats represents current server statistics
 type ServerStats struct {
 	CPUUsage     float64 `json:"cpu_usage"`
@@ -45,11 +95,115 @@ type ServerStats struct {
 	IsOnline     bool    `json:"is_online"`
 }
 
+// lockServer acquires the server's operation lock and returns its unlock function
+func lockServer(serverID uuid.UUID) func() {
+	serverLocksMutex.Lock()
+	lock, exists := serverLocks[serverID]
+	if !exists {
+		lock = &serverLock{}
+		serverLocks[serverID] = lock
+	}
+	lock.refs++
+	serverLocksMutex.Unlock()
+
+	lock.mutex.Lock()
+	return func() {
+		lock.mutex.Unlock()
+
+		serverLocksMutex.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(serverLocks, serverID)
+		}
+		serverLocksMutex.Unlock()
+	}
+}
+
+// refreshServerState reloads the status and PID, which may have changed
+// since the caller loaded the server
+func refreshServerState(server *models.Server) {
+	var current models.Server
+	if err := database.DB.Select("status", "pid").First(&current, server.ID).Error; err == nil {
+		server.Status = current.Status
+		server.PID = current.PID
+	}
+}
+
+// setProcess tracks a server's process and the pipe to its console
+func (sm *ServerManager) setProcess(serverID uuid.UUID, cmd *exec.Cmd, stdin io.WriteCloser) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.processes[serverID] = cmd
+	sm.stdins[serverID] = stdin
+}
+
+// getProcess returns the process tracked for a server
+func (sm *ServerManager) getProcess(serverID uuid.UUID) (*exec.Cmd, bool) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	cmd, exists := sm.processes[serverID]
+	return cmd, exists
+}
+
+// getStdin returns the pipe to a server's console
+func (sm *ServerManager) getStdin(serverID uuid.UUID) (io.WriteCloser, bool) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	stdin, exists := sm.stdins[serverID]
+	return stdin, exists
+}
+
+// deleteProcess stops tracking a server's process. When cmd is set, only
+// that process is removed, so the monitor of a process that has exited
+// can't drop the one a restart has already started in its place.
+func (sm *ServerManager) deleteProcess(serverID uuid.UUID, cmd *exec.Cmd) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	if tracked, exists := sm.processes[serverID]; exists && cmd != nil && tracked != cmd {
+		return
+	}
+	delete(sm.processes, serverID)
+	delete(sm.stdins, serverID)
+}
+
+// hasProcess reports whether the panel is tracking a process for the server
+func hasProcess(serverID uuid.UUID) bool {
+	_, exists := manager.getProcess(serverID)
+	return exists
+}
+
 // StartServer starts a game server
 func StartServer(server *models.Server) error {
-	if server.Status == models.ServerStatusRunning {
-		return fmt.Errorf("server is already running")
+	unlock := lockServer(server.ID)
+	defer unlock()
+
+	return startServer(server)
+}
+
+// startServer starts the server; the caller holds its lock
+func startServer(server *models.Server) error {
+	refreshServerState(server)
+	if server.Status == models.ServerStatusRunning || hasProcess(server.ID) {
+		return ErrServerAlreadyRunning
 	}
+	if !EULAAccepted(server) {
+		return ErrEULANotAccepted
+	}
+
+	// Starting ends hibernation; the server needs its port back. If it
+	// fails to start, it goes back to sleep rather than staying stopped
+	// with nothing to wake it.
+	hibernating := server.Status == models.ServerStatusHibernating
+	releaseWakeListener(server.ID)
+	err := launchServer(server)
+	if err != nil && hibernating {
+		rearmHibernation(server)
+	}
+	return err
+}
+
+// launchServer prepares and starts the server's process
+func launchServer(server *models.Server) error {
 
 	// Update status to starting
 	server.Status = models.ServerStatusStarting
@@ -62,9 +216,26 @@ func StartServer(server *models.Server) error {
 		return fmt.Errorf("failed to create server directory: %v", err)
 	}
 
-	// Check if server jar exists
+	// Bedrock runs a native binary instead of a Java jar
+	if server.Type == models.ServerTypeBedrock {
+		if !utils.FileExists(filepath.Join(server.Path, bedrockBinary)) {
+			if err := SetupServerJar(server); err != nil {
+				server.Status = models.ServerStatusStopped
+				database.DB.Save(server)
+				return fmt.Errorf("bedrock server not found and download failed: %v", err)
+			}
+		}
+		if err := preflightServer(server, nil); err != nil {
+			server.Status = models.ServerStatusStopped
+			database.DB.Save(server)
+			return err
+		}
+		return launchServerProcess(server, bedrockCommand(server))
+	}
+
+	// Check if server jar exists (args-file launches have no jar of their own)
 	serverJarPath := filepath.Join(server.Path, server.ServerJar)
-	if !utils.FileExists(serverJarPath) {
+	if server.StartCommand == "" && (server.ServerJar == "" || !utils.FileExists(serverJarPath)) {
 		// Try to download the server jar
 		if err := SetupServerJar(server); err != nil {
 			server.Status = models.ServerStatusStopped
@@ -73,11 +244,26 @@ func StartServer(server *models.Server) error {
 		}
 	}
 
-	// Parse Java arguments
+	// Parse Java arguments, expanding the JVM preset if one is selected
 	javaArgs := utils.ParseJavaArgs(server.JavaArgs)
+	if server.JVMPreset != "" {
+		javaMajor, _ := serverJavaMajorVersion(server)
+		presetArgs, err := ExpandJVMPreset(server.JVMPreset, server.MemoryLimit, javaMajor)
+		if err != nil {
+			server.Status = models.ServerStatusStopped
+			database.DB.Save(server)
+			return err
+		}
+		javaArgs = presetArgs
+	}
 	
 	// Build command arguments
-	args := append(javaArgs, "-jar", server.ServerJar)
+	var args []string
+	if server.StartCommand != "" {
+		args = append(javaArgs, utils.ParseJavaArgs(server.StartCommand)...)
+	} else {
+		args = append(javaArgs, "-jar", server.ServerJar)
+	}
 	
 	// Add nogui if not present
 	hasNoGui := false
@@ -91,10 +277,38 @@ func StartServer(server *models.Server) error {
 		args = append(args, "nogui")
 	}
 
+	if err := preflightServer(server, args); err != nil {
+		server.Status = models.ServerStatusStopped
+		database.DB.Save(server)
+		return err
+	}
+
 	// Create command
 	cmd := exec.Command(server.JavaPath, args...)
 	cmd.Dir = server.Path
-	
+	if runsInContainers() {
+		// The image brings its own Java
+		cmd = containerCommand(server, append([]string{"java"}, args...))
+	}
+
+	return launchServerProcess(server, cmd)
+}
+
+// waitForProcessExit polls until the process is gone or the timeout elapses
+func waitForProcessExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if !utils.IsProcessRunning(pid) {
+			return true
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return !utils.IsProcessRunning(pid)
+}
+
+// launchServerProcess starts the prepared command and wires up its output,
+// input and exit monitoring
+func launchServerProcess(server *models.Server, cmd *exec.Cmd) error {
 	// Set up pipes for stdin/stdout/stderr
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -117,44 +331,106 @@ func StartServer(server *models.Server) error {
 		return fmt.Errorf("failed to create stderr pipe: %v", err)
 	}
 
+	// Apply CPU and memory limits; docker applies them to containers
+	var limits *cgroupPlacement
+	if runsInContainers() {
+		err = prepareContainer(server)
+	} else {
+		limits, err = prepareResourceLimits(server, cmd)
+	}
+	if err != nil {
+		server.Status = models.ServerStatusStopped
+		database.DB.Save(server)
+		return err
+	}
+
 	// Start the process
+	ready := watchServerReady(server)
 	if err := cmd.Start(); err != nil {
+		if ready != nil {
+			ready.Close()
+		}
+		limits.release()
 		server.Status = models.ServerStatusStopped
 		database.DB.Save(server)
 		return fmt.Errorf("failed to start server process: %v", err)
 	}
+	limits.started()
 
-	// Store process reference
-	manager.processes[server.ID] = cmd
+	// Store the process and its stdin for sending commands
+	manager.setProcess(server.ID, cmd, stdin)
 
-	// Update server with PID
+	// Update server with PID; it stays starting until it has loaded
+	now := time.Now()
 	server.PID = cmd.Process.Pid
-	server.Status = models.ServerStatusRunning
+	server.StartedAt = &now
 	database.DB.Save(server)
+	BroadcastServerStatus(server.ID, models.ServerStatusStarting, "Server process started, waiting for it to finish loading")
 
 	// Handle process output
 	go handleServerOutput(server, stdout, stderr)
-	
-	// Store stdin reference for sending commands
-	go handleServerInput(server, stdin)
 
 	// Monitor process
-	go monitorServerProcess(server, cmd)
+	exited := make(chan struct{})
+	go monitorServerProcess(server, cmd, limits, exited)
+	go awaitServerReady(server, ready, exited)
 
 	return nil
 }
 
 // StopServer stops a game server
 func StopServer(server *models.Server) error {
+	unlock := lockServer(server.ID)
+	defer unlock()
+
+	return stopServer(server)
+}
+
+// stopServer stops the server; the caller holds its lock
+func stopServer(server *models.Server) error {
+	refreshServerState(server)
 	if server.Status == models.ServerStatusStopped {
-		return fmt.Errorf("server is already stopped")
+		return ErrServerAlreadyStopped
+	}
+	// A hibernating server has no process; stopping it only stops it waking
+	if server.Status == models.ServerStatusHibernating {
+		releaseWakeListener(server.ID)
+		server.Status = models.ServerStatusStopped
+		database.DB.Save(server)
+		return nil
+	}
+
+	if trackStopOperation() {
+		defer stopOperations.Done()
 	}
 
 	// Update status
 	server.Status = models.ServerStatusStopping
 	database.DB.Save(server)
 
-	// Try graceful shutdown first
+	timeout := defaultStopTimeout
+	if server.StopTimeout > 0 {
+		timeout = time.Duration(server.StopTimeout) * time.Second
+	}
+
+	// Flush the world to disk first where the server type supports it
+	if patterns := patternsFor(server.Type); patterns.saved != nil {
+		BroadcastServerStatus(server.ID, models.ServerStatusStopping, "Saving world")
+
+		watcher := watchServerLog(server.ID, patterns.saved)
+		if err := SendServerCommand(server, "save-all"); err == nil {
+			select {
+			case <-watcher.matched:
+				BroadcastServerStatus(server.ID, models.ServerStatusStopping, "World saved")
+			case <-time.After(timeout):
+				BroadcastServerStatus(server.ID, models.ServerStatusStopping, fmt.Sprintf("Save did not complete within %s, stopping anyway", timeout))
+			}
+		}
+		watcher.Close()
+	}
+
+	// Try graceful shutdown
+	BroadcastServerStatus(server.ID, models.ServerStatusStopping, "Sending stop command")
 	if server.StopCommand != "" {
 		SendServerCommand(server, server.StopCommand)
 	} else {
@@ -162,28 +438,75 @@ func StopServer(server *models.Server) error {
 	}
 
 	// Give it time to shutdown gracefully
-	time.Sleep(10 * time.Second)
-
-	// Force kill if still running
-	if utils.IsProcessRunning(server.PID) {
-		if err := utils.KillProcess(server.PID); err != nil {
+	if !waitForProcessExit(server.PID, timeout) {
+		BroadcastServerStatus(server.ID, models.ServerStatusStopping, fmt.Sprintf("Server did not stop within %s, killing process", timeout))
+		if err := killServerProcess(server); err != nil {
 			return fmt.Errorf("failed to kill server process: %v", err)
 		}
 	}
 
 	// Clean up
-	delete(manager.processes, server.ID)
+	manager.deleteProcess(server.ID, nil)
 	server.PID = 0
 	server.Status = models.ServerStatusStopped
 	database.DB.Save(server)
 
+	NotifyServerStop(server)
+
 	return nil
 }
 
+// killServerProcess kills a server's process, or its container. Killing
+// the docker client would leave the container running.
+func killServerProcess(server *models.Server) error {
+	if runsInContainers() {
+		return killContainer(server)
+	}
+	return utils.KillProcess(server.PID)
+}
+
+// WaitForServerStops waits for server stops in progress to finish or ctx to expire
+func WaitForServerStops(ctx context.Context) error {
+	// Stops begun from here on are not waited for
+	stopsMutex.Lock()
+	stopsClosed = true
+	stopsMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		stopOperations.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// trackStopOperation adds a stop to stopOperations unless shutdown is
+// already waiting for them
+func trackStopOperation() bool {
+	stopsMutex.Lock()
+	defer stopsMutex.Unlock()
+
+	if stopsClosed {
+		return false
+	}
+	stopOperations.Add(1)
+	return true
+}
+
 // RestartServer restarts a game server
 func RestartServer(server *models.Server) error {
-	if server.Status == models.ServerStatusRunning {
-		if err := StopServer(server); err != nil {
+	unlock := lockServer(server.ID)
+	defer unlock()
+
+	refreshServerState(server)
+	if server.Status == models.ServerStatusRunning || server.Status == models.ServerStatusStarting {
+		if err := stopServer(server); err != nil {
 			return err
 		}
 		
@@ -197,22 +520,24 @@ func RestartServer(server *models.Server) error {
 		}
 	}
 
-	return StartServer(server)
+	return startServer(server)
 }
 
 // SendServerCommand sends a command to a running server
 func SendServerCommand(server *models.Server, command string) error {
-	if server.Status != models.ServerStatusRunning {
+	// Commands are accepted while the server is loading, and still while
+	// stopping so StopServer can save and stop
+	if server.Status != models.ServerStatusRunning && server.Status != models.ServerStatusStarting &&
+		server.Status != models.ServerStatusStopping {
 		return fmt.Errorf("server is not running")
 	}
 
-	cmd, exists := manager.processes[server.ID]
-	if !exists {
+	if !hasProcess(server.ID) {
 		return fmt.Errorf("server process not found")
 	}
 
-	stdin := cmd.Stdin
-	if stdin == nil {
+	stdin, exists := manager.getStdin(server.ID)
+	if !exists {
 		return fmt.Errorf("stdin not available")
 	}
 
@@ -225,7 +550,8 @@ func SendServerCommand(server *models.Server, command string) error {
 func UpdateServerStatus(server *models.Server) {
 	if server.PID > 0 {
 		if utils.IsProcessRunning(server.PID) {
-			if server.Status != models.ServerStatusRunning {
+			// A starting server is marked running once it has loaded
+			if server.Status != models.ServerStatusRunning && server.Status != models.ServerStatusStarting {
 				server.Status = models.ServerStatusRunning
 				database.DB.Save(server)
 			}
@@ -234,19 +560,20 @@ func UpdateServerStatus(server *models.Server) {
 				server.Status = models.ServerStatusStopped
 				server.PID = 0
 				database.DB.Save(server)
-				delete(manager.processes, server.ID)
+				manager.deleteProcess(server.ID, nil)
 			}
 		}
 	} else {
-		if server.Status != models.ServerStatusStopped {
+		if server.Status != models.ServerStatusStopped && server.Status != models.ServerStatusHibernating {
 			server.Status = models.ServerStatusStopped
 			database.DB.Save(server)
 		}
 	}
 }
 
-// GetServerStats returns current server statistics
-func GetServerStats(server *models.Server) (*ServerStats, error) {
+// sampleServerStats reads a server's current statistics from its process,
+// directory and console output
+func sampleServerStats(server *models.Server) *ServerStats {
 	stats := &ServerStats{
 		MemoryLimit: server.MemoryLimit,
 		DiskLimit:   server.DiskLimit,
@@ -254,14 +581,23 @@ func GetServerStats(server *models.Server) (*ServerStats, error) {
 	}
 
 	if server.PID > 0 && utils.IsProcessRunning(server.PID) {
-		// Get process statistics
-		if cpuUsage, memUsage, err := getProcessStats(server.PID); err == nil {
+		// Get process statistics; a container's come from docker, as the
+		// process is only its client
+		var cpuUsage float64
+		var memUsage int64
+		var err error
+		if runsInContainers() {
+			cpuUsage, memUsage, err = getContainerStats(server)
+		} else {
+			cpuUsage, memUsage, err = getProcessStats(server.PID)
+		}
+		if err == nil {
 			stats.CPUUsage = cpuUsage
 			stats.MemoryUsage = memUsage
 		}
 
 		// Get disk usage
-		if diskUsed, _, err := utils.GetDiskUsage(server.Path); err == nil {
+		if diskUsed, err := ServerDiskUsage(server); err == nil {
 			stats.DiskUsage = diskUsed
 		}
 
@@ -271,8 +607,13 @@ func GetServerStats(server *models.Server) (*ServerStats, error) {
 		stats.MSPT = getMSPT(server)
 	}
 
-	// Save metrics to database
-	metric := models.ServerMetric{
+	return stats
+}
+
+// persistServerStats saves a stats sample as a metric, batched with other
+// samples
+func persistServerStats(server *models.Server, stats *ServerStats) {
+	recordMetric(models.ServerMetric{
 		ServerID:    server.ID,
 		CPUUsage:    stats.CPUUsage,
 		MemoryUsage: stats.MemoryUsage,
@@ -283,77 +624,54 @@ func GetServerStats(server *models.Server) (*ServerStats, error) {
 		TPS:         stats.TPS,
 		MSPT:        stats.MSPT,
 		Timestamp:   time.Now(),
-	}
-	database.DB.Create(&metric)
-
-	return stats, nil
+	})
 }
 
 // GetServerLogs returns server console logs
 func GetServerLogs(server *models.Server, lines int) ([]string, error) {
-	logFile := filepath.Join(server.Path, "logs", "latest.log")
+	logFile := serverLogPath(server)
 	
 	if !utils.FileExists(logFile) {
 		return []string{}, nil
 	}
 
-	file, err := os.Open(logFile)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	var logLines []string
-	scanner := bufio.NewScanner(file)
-	
-	for scanner.Scan() {
-		logLines = append(logLines, scanner.Text())
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
-
-	// Return last N lines
-	if len(logLines) > lines {
-		return logLines[len(logLines)-lines:], nil
-	}
-
-	return logLines, nil
+	// Read only the tail instead of loading the whole file
+	return TailFile(logFile, lines)
 }
 
 // SetupServerJar downloads and sets up the server jar
 func SetupServerJar(server *models.Server) error {
 	var downloadURL string
 	var fileName string
+	var err error
 
 	switch server.Type {
-	case models.ServerTypePaper:
-		downloadURL = getPaperDownloadURL(server.Version)
-		fileName = fmt.Sprintf("paper-%s.jar", server.Version)
-	case models.ServerTypeSpigot:
-		downloadURL = getSpigotDownloadURL(server.Version)
-		fileName = fmt.Sprintf("spigot-%s.jar", server.Version)
-	case models.ServerTypeVanilla:
-		downloadURL = getVanillaDownloadURL(server.Version)
-		fileName = fmt.Sprintf("server-%s.jar", server.Version)
-	case models.ServerTypeFabric:
-		downloadURL = getFabricDownloadURL(server.Version)
-		fileName = fmt.Sprintf("fabric-server-%s.jar", server.Version)
 	case models.ServerTypeForge:
-		downloadURL = getForgeDownloadURL(server.Version)
-		fileName = fmt.Sprintf("forge-server-%s.jar", server.Version)
-	default:
+		// Forge ships an installer rather than a runnable jar
+		return setupForgeServer(server)
+	case models.ServerTypeBedrock:
+		// Bedrock ships a native binary in a zip archive
+		return setupBedrockServer(server)
+	}
+
+	implementation := ImplementationFor(server.Type)
+	if implementation == nil || implementation.resolveDownload == nil {
 		return fmt.Errorf("unsupported server type: %s", server.Type)
 	}
+	downloadURL, fileName, err = implementation.resolveDownload(server.Version)
+
+	if err != nil {
+		return fmt.Errorf("failed to resolve download for %s %s: %v", server.Type, server.Version, err)
+	}
 
 	if downloadURL == "" {
 		return fmt.Errorf("download URL not available for server type %s version %s", server.Type, server.Version)
 	}
 
-	// Download the jar file
+	// Download the jar file, checked against the published checksum if any
 	jarPath := filepath.Join(server.Path, fileName)
-	if err := downloadFile(downloadURL, jarPath); err != nil {
+	opts := DownloadOptions{SHA256: buildResolver.checksumFor(downloadURL)}
+	if err := downloadFileVerified(context.Background(), downloadURL, jarPath, opts); err != nil {
 		return fmt.Errorf("failed to download server jar: %v", err)
 	}
 
@@ -364,8 +682,8 @@ func SetupServerJar(server *models.Server) error {
 	// Create server.properties if it doesn't exist
 	createDefaultServerProperties(server)
 
-	// Accept EULA
-	acceptEULA(server)
+	// eula=true only once a user has accepted it
+	writeEULA(server)
 
 	return nil
 }
@@ -379,45 +697,70 @@ func handleServerOutput(server *models.Server, stdout, stderr io.ReadCloser) {
 	if err != nil {
 		return
 	}
-	defer logFile.Close()
+
+	// Close the log file once both streams are drained
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		wg.Wait()
+		logFile.Close()
+	}()
 
 	// Handle stdout
 	go func() {
+		defer wg.Done()
+		var classifier consoleClassifier
 		scanner := bufio.NewScanner(stdout)
 		for scanner.Scan() {
-			line := scanner.Text()
-			logFile.WriteString(fmt.Sprintf("[%s] %s\n", time.Now().Format("2006-01-02 15:04:05"), line))
+			// Color codes and control characters stay out of the log file
+			line := ParseConsoleLine(scanner.Text())
+			classifier.classify(&line)
+			logFile.WriteString(fmt.Sprintf("[%s] %s\n", time.Now().Format("2006-01-02 15:04:05"), line.Text))
+			publishServerLogLine(server.ID, line.Text)
+			trackPlayers(server, line.Text)
 			
 			// Broadcast to WebSocket clients
 			BroadcastServerLog(server.ID, line)
 		}
 	}()
 
-	// Handle stderr
+	// Handle stderr. Java writes more than errors here, so lines are
+	// classified like stdout rather than all taken as errors.
 	go func() {
+		defer wg.Done()
+		var classifier consoleClassifier
 		scanner := bufio.NewScanner(stderr)
 		for scanner.Scan() {
-			line := scanner.Text()
-			logFile.WriteString(fmt.Sprintf("[%s] ERROR: %s\n", time.Now().Format("2006-01-02 15:04:05"), line))
+			line := ParseConsoleLine(scanner.Text())
+			classifier.classify(&line)
+			prefix := ""
+			if line.Level == ConsoleLevelError {
+				prefix = "ERROR: "
+			}
+			logFile.WriteString(fmt.Sprintf("[%s] %s%s\n", time.Now().Format("2006-01-02 15:04:05"), prefix, line.Text))
+			publishServerLogLine(server.ID, line.Text)
 			
 			// Broadcast to WebSocket clients
-			BroadcastServerLog(server.ID, "ERROR: "+line)
+			BroadcastServerLog(server.ID, line)
 		}
 	}()
 }
 
-func handleServerInput(server *models.Server, stdin io.WriteCloser) {
-	// Store stdin reference for sending commands
-	// This would be used by SendServerCommand
-}
-
-func monitorServerProcess(server *models.Server, cmd *exec.Cmd) {
+func monitorServerProcess(server *models.Server, cmd *exec.Cmd, limits *cgroupPlacement, exited chan<- struct{}) {
 	// Wait for process to exit
 	err := cmd.Wait()
+	close(exited)
+	limits.release()
 	
 	// Clean up
-	delete(manager.processes, server.ID)
+	manager.deleteProcess(server.ID, cmd)
+	clearOnlinePlayers(server.ID)
 	server.PID = 0
+
+	// A process killed by StopServer is not a crash
+	var current models.Server
+	stopping := database.DB.Select("status").First(&current, server.ID).Error == nil &&
+		current.Status == models.ServerStatusStopping
 	
 	if err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
@@ -434,14 +777,70 @@ func monitorServerProcess(server *models.Server, cmd *exec.Cmd) {
 	} else {
 		server.Status = models.ServerStatusStopped
 	}
+
+	// Escalating a stop to a kill exits non-zero, which isn't a crash
+	if stopping {
+		server.Status = models.ServerStatusStopped
+	}
 	
-	database.DB.Save(server)
-	
-	// Auto-restart if enabled and crashed
-	if server.AutoRestart && server.Status == models.ServerStatusCrashed {
-		time.Sleep(5 * time.Second)
-		StartServer(server)
+	if server.Status == models.ServerStatusCrashed {
+		recordCrash(server)
+	}
+
+	// Only the fields the exit changes are written, and not over the
+	// status of a server HibernateServer has put to sleep in the meantime
+	database.DB.Model(server).Where("status <> ?", models.ServerStatusHibernating).
+		Select("status", "pid", "crash_count", "crash_window_at", "last_crash").Updates(server)
+
+	if server.Status != models.ServerStatusCrashed {
+		return
+	}
+
+	NotifyServerCrash(server, err, CaptureCrashReport(server, err))
+
+	// Auto-restart if enabled, unless the server is crash looping
+	if !server.AutoRestart {
+		return
+	}
+	if crashLooping(server) {
+		log.Printf("Server %s crashed %d times within %s, auto-restart disabled until it is started manually", server.Name, server.CrashCount, crashWindow)
+		BroadcastServerStatus(server.ID, models.ServerStatusCrashed, "Crash loop detected, auto-restart paused")
+		NotifyCrashLoop(server, crashWindow)
+		return
+	}
+
+	time.Sleep(5 * time.Second)
+	StartServer(server)
+}
+
+// ResetCrashCounter clears the crash history that pauses auto-restart
+func ResetCrashCounter(server *models.Server) {
+	server.CrashCount = 0
+	server.CrashWindowAt = nil
+}
+
+// recordCrash counts a crash in the server's crash window. The window is
+// reset after a healthy run or once it has elapsed.
+func recordCrash(server *models.Server) {
+	now := time.Now()
+
+	if server.StartedAt != nil && now.Sub(*server.StartedAt) >= healthyRunDuration {
+		server.CrashCount = 0
+		server.CrashWindowAt = nil
+	}
+	if server.CrashWindowAt == nil || now.Sub(*server.CrashWindowAt) > crashWindow {
+		server.CrashCount = 0
+		server.CrashWindowAt = &now
 	}
+
+	server.CrashCount++
+	server.LastCrash = &now
+}
+
+// crashLooping reports whether the server crashed too often within its
+// crash window to be restarted automatically
+func crashLooping(server *models.Server) bool {
+	return server.CrashCount > maxCrashRestarts
 }
 
 func getProcessStats(pid int) (float64, int64, error) {
@@ -474,9 +873,8 @@ func getProcessStats(pid int) (float64, int64, error) {
 }
 
 func getPlayerCount(server *models.Server) int {
-	// Parse player count from server logs or status
-	// Implementation depends on server type
-	return 0
+	// Parse player count from the captured console output
+	return countOnlinePlayers(server)
 }
 
 func getTPS(server *models.Server) float64 {
@@ -491,27 +889,6 @@ func getMSPT(server *models.Server) float64 {
 	return 50.0
 }
 
-func downloadFile(url, filepath string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download failed: %s", resp.Status)
-	}
-
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, resp.Body)
-	return err
-}
-
 func createDefaultServerProperties(server *models.Server) {
 	propertiesPath := filepath.Join(server.Path, "server.properties")
 	if utils.FileExists(propertiesPath) {
@@ -532,16 +909,21 @@ motd=A Playpulse Server
 	os.WriteFile(propertiesPath, []byte(properties), 0644)
 }
 
-func acceptEULA(server *models.Server) {
-	eulaPath := filepath.Join(server.Path, "eula.txt")
-	eula := "eula=true\n"
-	os.WriteFile(eulaPath, []byte(eula), 0644)
+// Download URL functions (implement actual API calls)
+func getPaperDownloadURL(version string) (string, string, error) {
+	build, err := buildResolver.ResolvePaper(version)
+	if err != nil {
+		return "", "", err
+	}
+	return build.URL, build.FileName, nil
 }
 
-// Download URL functions (implement actual API calls)
-func getPaperDownloadURL(version string) string {
-	// Implement Paper API call to get download URL
-	return fmt.Sprintf("https://papermc.io/api/v2/projects/paper/versions/%s/builds/latest/downloads/paper-%s-latest.jar", version, version)
+func getPurpurDownloadURL(version string) (string, string, error) {
+	build, err := buildResolver.ResolvePurpur(version)
+	if err != nil {
+		return "", "", err
+	}
+	return build.URL, build.FileName, nil
 }
 
 func getSpigotDownloadURL(version string) string {
@@ -558,8 +940,3 @@ func getFabricDownloadURL(version string) string {
 	// Implement Fabric API call
 	return fmt.Sprintf("https://meta.fabricmc.net/v2/versions/loader/%s/stable/server/jar", version)
 }
-
-func getForgeDownloadURL(version string) string {
-	// Implement Forge API call
-	return ""
-}
\ No newline at end of file
@@ -0,0 +1,406 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+)
+
+// fakeServerScript stands in for a Minecraft server. It logs every console
+// command to commands.txt, answers save-all after SAVE_DELAY seconds and
+// exits on stop unless IGNORE_STOP is set.
+const fakeServerScript = `echo 'Done (1.234s)! For help, type "help"'
+while read -r line; do
+	echo "$line" >> commands.txt
+	case "$line" in
+	save-all) (sleep "${SAVE_DELAY:-0}"; echo 'Saved the game') & ;;
+	stop) [ -n "$IGNORE_STOP" ] || exit 0 ;;
+	esac
+done
+`
+
+// startFakeServer launches the fake server for a saved server record, with
+// env added to its environment
+func startFakeServer(t *testing.T, server *models.Server, env ...string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake server is a shell script")
+	}
+
+	script := filepath.Join(t.TempDir(), "server.sh")
+	if err := os.WriteFile(script, []byte(fakeServerScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("sh", script)
+	cmd.Dir = server.Path
+	cmd.Env = append(os.Environ(), env...)
+
+	server.Status = models.ServerStatusStarting
+	if err := launchServerProcess(server, cmd); err != nil {
+		t.Fatalf("launchServerProcess: %v", err)
+	}
+	pid := server.PID
+	t.Cleanup(func() {
+		if utils.IsProcessRunning(pid) {
+			utils.KillProcess(pid)
+			waitForProcessExit(pid, 5*time.Second)
+		}
+	})
+}
+
+// serverCommands returns the console commands the fake server received
+func serverCommands(server *models.Server) []string {
+	data, _ := os.ReadFile(filepath.Join(server.Path, "commands.txt"))
+	return strings.Fields(string(data))
+}
+
+// stopCopy stops the server through a copy of its record, as the handlers
+// do, so the test doesn't share the struct the process monitor updates
+func stopCopy(t *testing.T, server *models.Server) (time.Duration, error) {
+	t.Helper()
+
+	stopping := *server
+	started := time.Now()
+	err := StopServer(&stopping)
+	return time.Since(started), err
+}
+
+func TestStopServerSavesBeforeStopping(t *testing.T) {
+	testDB(t)
+	server := testutil.CreateServer(t, &models.Server{StopTimeout: 5})
+	startFakeServer(t, server)
+
+	elapsed, err := stopCopy(t, server)
+	if err != nil {
+		t.Fatalf("StopServer: %v", err)
+	}
+
+	if got := serverCommands(server); strings.Join(got, ",") != "save-all,stop" {
+		t.Errorf("commands = %v, want save-all then stop", got)
+	}
+	if elapsed >= 5*time.Second {
+		t.Errorf("stop took %s, want it to finish without waiting out the timeout", elapsed)
+	}
+}
+
+func TestStopServerSlowSaveTimesOut(t *testing.T) {
+	testDB(t)
+	server := testutil.CreateServer(t, &models.Server{StopTimeout: 1})
+	startFakeServer(t, server, "SAVE_DELAY=10")
+
+	elapsed, err := stopCopy(t, server)
+	if err != nil {
+		t.Fatalf("StopServer: %v", err)
+	}
+
+	// The stop command follows once the save has had its timeout
+	if got := serverCommands(server); strings.Join(got, ",") != "save-all,stop" {
+		t.Errorf("commands = %v, want save-all then stop", got)
+	}
+	if elapsed < time.Second || elapsed >= 2*time.Second {
+		t.Errorf("stop took %s, want one save timeout and a prompt exit", elapsed)
+	}
+}
+
+func TestStopServerKillsUnresponsiveServer(t *testing.T) {
+	testDB(t)
+	server := testutil.CreateServer(t, &models.Server{StopTimeout: 1})
+	startFakeServer(t, server, "SAVE_DELAY=10", "IGNORE_STOP=1")
+	pid := server.PID
+
+	elapsed, err := stopCopy(t, server)
+	if err != nil {
+		t.Fatalf("StopServer: %v", err)
+	}
+
+	if got := serverCommands(server); strings.Join(got, ",") != "save-all,stop" {
+		t.Errorf("commands = %v, want save-all then stop before the kill", got)
+	}
+	if elapsed < 2*time.Second {
+		t.Errorf("stop took %s, want the save and stop timeouts to pass before the kill", elapsed)
+	}
+	if !waitForProcessExit(pid, 5*time.Second) {
+		t.Error("the unresponsive server is still running")
+	}
+}
+
+// crashAfter records a crash of a run that lasted the given duration
+func crashAfter(server *models.Server, run time.Duration) {
+	startedAt := time.Now().Add(-run)
+	server.StartedAt = &startedAt
+	recordCrash(server)
+}
+
+func TestRapidCrashesTripLoopBreaker(t *testing.T) {
+	server := &models.Server{AutoRestart: true}
+
+	for i := 1; i <= maxCrashRestarts; i++ {
+		crashAfter(server, 5*time.Second)
+		if crashLooping(server) {
+			t.Fatalf("breaker tripped after %d crashes, want it after %d", i, maxCrashRestarts+1)
+		}
+	}
+
+	crashAfter(server, 5*time.Second)
+	if !crashLooping(server) {
+		t.Fatalf("breaker not tripped after %d rapid crashes", server.CrashCount)
+	}
+
+	// Starting it manually clears the history
+	ResetCrashCounter(server)
+	crashAfter(server, 5*time.Second)
+	if crashLooping(server) || server.CrashCount != 1 {
+		t.Errorf("crash count = %d after a reset, want 1", server.CrashCount)
+	}
+}
+
+func TestSlowCrashesStayEligible(t *testing.T) {
+	server := &models.Server{AutoRestart: true}
+
+	// Each run lasts long enough to count as healthy
+	for i := 0; i < maxCrashRestarts*2; i++ {
+		crashAfter(server, healthyRunDuration+time.Minute)
+		if crashLooping(server) || server.CrashCount != 1 {
+			t.Fatalf("crash %d: count = %d, want every healthy run to start over", i+1, server.CrashCount)
+		}
+	}
+}
+
+func TestCrashWindowExpires(t *testing.T) {
+	server := &models.Server{AutoRestart: true}
+
+	for i := 0; i < maxCrashRestarts; i++ {
+		crashAfter(server, 5*time.Second)
+	}
+
+	// The last crashes happened longer ago than the window
+	windowStart := time.Now().Add(-crashWindow - time.Minute)
+	server.CrashWindowAt = &windowStart
+
+	crashAfter(server, 5*time.Second)
+	if crashLooping(server) || server.CrashCount != 1 {
+		t.Errorf("crash count = %d after the window expired, want 1", server.CrashCount)
+	}
+}
+
+func TestConcurrentStartsLaunchOnce(t *testing.T) {
+	testDB(t)
+
+	// Every launch of the fake java is logged before it runs the fake server
+	java := writeFakeJava(t, "echo launched >> launches.txt\n"+fakeServerScript)
+	accepted := time.Now()
+	server := testutil.CreateServer(t, &models.Server{JavaPath: java, ServerJar: "server.jar", StopTimeout: 5, EULAAcceptedAt: &accepted})
+	if err := os.WriteFile(filepath.Join(server.Path, "server.jar"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if hasProcess(server.ID) {
+			stopCopy(t, server)
+		}
+	})
+
+	const requests = 8
+	var wg sync.WaitGroup
+	errs := make([]error, requests)
+	start := make(chan struct{})
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Each request loads its own copy of the server, as the handlers do
+			request := *server
+			<-start
+			errs[i] = StartServer(&request)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	started := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			started++
+		case !errors.Is(err, ErrServerAlreadyRunning):
+			t.Errorf("StartServer = %v, want success or ErrServerAlreadyRunning", err)
+		}
+	}
+	if started != 1 {
+		t.Errorf("%d of %d concurrent starts succeeded, want exactly 1", started, requests)
+	}
+
+	// Give a second process, had one been spawned, time to log its launch
+	time.Sleep(500 * time.Millisecond)
+	data, _ := os.ReadFile(filepath.Join(server.Path, "launches.txt"))
+	if launches := strings.Count(string(data), "launched"); launches != 1 {
+		t.Errorf("%d server processes launched, want 1", launches)
+	}
+}
+
+func TestServerLocksSerializeAndRelease(t *testing.T) {
+	serverID := uuid.New()
+
+	var holders, overlaps int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := lockServer(serverID)
+			if atomic.AddInt32(&holders, 1) > 1 {
+				atomic.AddInt32(&overlaps, 1)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&holders, -1)
+			unlock()
+		}()
+	}
+	wg.Wait()
+
+	if overlaps != 0 {
+		t.Errorf("the server lock was held by more than one caller %d times", overlaps)
+	}
+
+	serverLocksMutex.Lock()
+	_, exists := serverLocks[serverID]
+	serverLocksMutex.Unlock()
+	if exists {
+		t.Error("the server's lock is still tracked after every caller released it")
+	}
+}
+
+func TestProcessRegistryConcurrentAccess(t *testing.T) {
+	sm := &ServerManager{
+		processes: make(map[uuid.UUID]*exec.Cmd),
+		stdins:    make(map[uuid.UUID]io.WriteCloser),
+	}
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+
+	// Run with -race: any access that skips the mutex is reported
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				id := ids[(i+j)%len(ids)]
+				cmd := exec.Command("true")
+				switch j % 4 {
+				case 0:
+					sm.setProcess(id, cmd, nil)
+				case 1:
+					sm.getProcess(id)
+				case 2:
+					sm.getStdin(id)
+				case 3:
+					sm.deleteProcess(id, cmd)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// The monitor of an exited process can't drop the one started after it
+	exited, restarted := exec.Command("true"), exec.Command("true")
+	sm.setProcess(ids[0], exited, nil)
+	sm.setProcess(ids[0], restarted, nil)
+	sm.deleteProcess(ids[0], exited)
+	if cmd, exists := sm.getProcess(ids[0]); !exists || cmd != restarted {
+		t.Fatal("deleting the exited process dropped the restarted one")
+	}
+	sm.deleteProcess(ids[0], nil)
+	if _, exists := sm.getProcess(ids[0]); exists {
+		t.Error("process still tracked after deleting it")
+	}
+}
+
+func TestConcurrentStartStopStatus(t *testing.T) {
+	testDB(t)
+
+	java := writeFakeJava(t, fakeServerScript)
+	accepted := time.Now()
+	server := testutil.CreateServer(t, &models.Server{JavaPath: java, ServerJar: "server.jar", StopTimeout: 5, EULAAcceptedAt: &accepted})
+	if err := os.WriteFile(filepath.Join(server.Path, "server.jar"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if hasProcess(server.ID) {
+			stopCopy(t, server)
+		}
+	})
+
+	// Starts, stops and status reads race each other for a few rounds, each
+	// request on its own copy of the server as the handlers have. Run with
+	// -race to check the process registry and server locks.
+	const rounds, requests = 3, 4
+	for round := 0; round < rounds; round++ {
+		var wg sync.WaitGroup
+		errs := make(chan error, 2*requests)
+		start := make(chan struct{})
+		for i := 0; i < requests; i++ {
+			wg.Add(3)
+			go func() {
+				defer wg.Done()
+				request := *server
+				<-start
+				errs <- StartServer(&request)
+			}()
+			go func() {
+				defer wg.Done()
+				request := *server
+				<-start
+				errs <- StopServer(&request)
+			}()
+			go func() {
+				defer wg.Done()
+				request := *server
+				<-start
+				for j := 0; j < 20; j++ {
+					refreshServerState(&request)
+					hasProcess(request.ID)
+					manager.getStdin(request.ID)
+					time.Sleep(time.Millisecond)
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil && !errors.Is(err, ErrServerAlreadyRunning) && !errors.Is(err, ErrServerAlreadyStopped) {
+				t.Errorf("round %d: %v, want success or already running or stopped", round+1, err)
+			}
+		}
+	}
+
+	// However the round ended, the server stops cleanly and nothing is left
+	// tracked
+	if _, err := stopCopy(t, server); err != nil && !errors.Is(err, ErrServerAlreadyStopped) {
+		t.Fatalf("StopServer: %v", err)
+	}
+	if hasProcess(server.ID) || serverStatus(server.ID) != models.ServerStatusStopped {
+		t.Errorf("after stopping: process tracked %v, status %s, want none and stopped", hasProcess(server.ID), serverStatus(server.ID))
+	}
+	serverLocksMutex.Lock()
+	_, locked := serverLocks[server.ID]
+	serverLocksMutex.Unlock()
+	if locked {
+		t.Error("the server's lock is still tracked after every operation returned")
+	}
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"gorm.io/gorm"
+)
+
+// Setting value types, as stored in SystemSetting.Type
+const (
+	SettingTypeString  = "string"
+	SettingTypeBoolean = "boolean"
+	SettingTypeNumber  = "number"
+)
+
+var (
+	// ErrSettingNotFound is returned for setting keys that don't exist
+	ErrSettingNotFound = errors.New("setting not found")
+	// ErrInvalidSettingValue is returned when a value doesn't fit the setting's type
+	ErrInvalidSettingValue = errors.New("invalid setting value")
+)
+
+// publicSettings are the settings anyone may read, such as what the login
+// page shows before the user is signed in
+var publicSettings = map[string]bool{
+	"panel_name":                 true,
+	"panel_description":          true,
+	"allow_registration":         true,
+	"require_email_verification": true,
+
+	// The password policy, so signup and password forms can show the rules
+	"password_min_length":            true,
+	"password_require_uppercase":     true,
+	"password_require_lowercase":     true,
+	"password_require_number":        true,
+	"password_require_symbol":        true,
+	"password_disallow_account_info": true,
+}
+
+// settingsCache holds every setting by key so lookups on hot paths such as
+// Register don't query the database. It is filled by LoadSettings, or on
+// first use, and updated by UpdateSetting.
+var (
+	settingsCache map[string]models.SystemSetting
+	settingsMutex sync.RWMutex
+)
+
+// LoadSettings reads all settings into the cache, replacing what it held
+func LoadSettings() error {
+	var settings []models.SystemSetting
+	if err := database.DB.Find(&settings).Error; err != nil {
+		return err
+	}
+
+	cache := make(map[string]models.SystemSetting, len(settings))
+	for _, setting := range settings {
+		cache[setting.Key] = setting
+	}
+
+	settingsMutex.Lock()
+	settingsCache = cache
+	settingsMutex.Unlock()
+	return nil
+}
+
+// InvalidateSetting reloads one setting from the database into the cache
+func InvalidateSetting(key string) {
+	// Query before locking so readers aren't blocked on the database
+	var setting models.SystemSetting
+	err := database.DB.Where("key = ?", key).First(&setting).Error
+
+	settingsMutex.Lock()
+	defer settingsMutex.Unlock()
+
+	if settingsCache == nil {
+		return
+	}
+	if err != nil {
+		delete(settingsCache, key)
+		return
+	}
+	settingsCache[key] = setting
+}
+
+// cachedSetting returns a setting from the cache, loading the cache if
+// LoadSettings hasn't run yet
+func cachedSetting(key string) (models.SystemSetting, bool) {
+	settingsMutex.RLock()
+	loaded := settingsCache != nil
+	setting, exists := settingsCache[key]
+	settingsMutex.RUnlock()
+
+	if !loaded {
+		if err := LoadSettings(); err != nil {
+			return models.SystemSetting{}, false
+		}
+		settingsMutex.RLock()
+		setting, exists = settingsCache[key]
+		settingsMutex.RUnlock()
+	}
+	return setting, exists
+}
+
+// GetBool returns a boolean setting, or defaultValue if it is missing or
+// not a boolean
+func GetBool(key string, defaultValue bool) bool {
+	setting, exists := cachedSetting(key)
+	if !exists {
+		return defaultValue
+	}
+	value, err := strconv.ParseBool(setting.Value)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// GetInt returns a number setting truncated to an int, or defaultValue if
+// it is missing or not a number
+func GetInt(key string, defaultValue int) int {
+	setting, exists := cachedSetting(key)
+	if !exists {
+		return defaultValue
+	}
+	value, err := strconv.ParseFloat(setting.Value, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return int(value)
+}
+
+// GetString returns a setting's value, or defaultValue if it is missing
+func GetString(key string, defaultValue string) string {
+	setting, exists := cachedSetting(key)
+	if !exists {
+		return defaultValue
+	}
+	return setting.Value
+}
+
+// ListSettings returns all settings, or those of one category, by key
+func ListSettings(category string) ([]models.SystemSetting, error) {
+	query := database.DB.Order("category ASC, key ASC")
+	if category != "" {
+		query = query.Where("category = ?", category)
+	}
+
+	var settings []models.SystemSetting
+	err := query.Find(&settings).Error
+	return settings, err
+}
+
+// GetSetting returns the setting with the given key
+func GetSetting(key string) (*models.SystemSetting, error) {
+	var setting models.SystemSetting
+	err := database.DB.Where("key = ?", key).First(&setting).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSettingNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &setting, nil
+}
+
+// UpdateSetting validates value against the setting's type and saves it in
+// its normalised form. The previous value is returned for auditing.
+func UpdateSetting(key, value string) (*models.SystemSetting, string, error) {
+	setting, err := GetSetting(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	normalized, err := normalizeSettingValue(setting.Type, value)
+	if err != nil {
+		return nil, "", err
+	}
+
+	previous := setting.Value
+	setting.Value = normalized
+	if err := database.DB.Model(setting).Update("value", normalized).Error; err != nil {
+		return nil, "", err
+	}
+	InvalidateSetting(key)
+
+	return setting, previous, nil
+}
+
+// PublicSettings returns the publicly readable settings with typed values
+func PublicSettings() (map[string]interface{}, error) {
+	keys := make([]string, 0, len(publicSettings))
+	for key := range publicSettings {
+		keys = append(keys, key)
+	}
+
+	var settings []models.SystemSetting
+	if err := database.DB.Where("key IN ?", keys).Find(&settings).Error; err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{}, len(settings))
+	for _, setting := range settings {
+		values[setting.Key] = SettingValue(setting)
+	}
+	return values, nil
+}
+
+// SettingValue returns a setting's value as a bool, float64 or string
+// according to its type, falling back to the raw string if it doesn't parse
+func SettingValue(setting models.SystemSetting) interface{} {
+	switch setting.Type {
+	case SettingTypeBoolean:
+		if value, err := strconv.ParseBool(setting.Value); err == nil {
+			return value
+		}
+	case SettingTypeNumber:
+		if value, err := strconv.ParseFloat(setting.Value, 64); err == nil {
+			return value
+		}
+	}
+	return setting.Value
+}
+
+// normalizeSettingValue checks a value fits a setting type and returns it
+// in the form it is stored in
+func normalizeSettingValue(settingType, value string) (string, error) {
+	switch settingType {
+	case SettingTypeBoolean:
+		parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("%w: %q is not a boolean", ErrInvalidSettingValue, value)
+		}
+		return strconv.FormatBool(parsed), nil
+	case SettingTypeNumber:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return "", fmt.Errorf("%w: %q is not a number", ErrInvalidSettingValue, value)
+		}
+		return strconv.FormatFloat(parsed, 'f', -1, 64), nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+)
+
+func TestNormalizeSettingValue(t *testing.T) {
+	tests := []struct {
+		settingType string
+		value       string
+		want        string
+		valid       bool
+	}{
+		{SettingTypeBoolean, "true", "true", true},
+		{SettingTypeBoolean, " FALSE ", "false", true},
+		{SettingTypeBoolean, "1", "true", true},
+		{SettingTypeBoolean, "yes", "", false},
+		{SettingTypeBoolean, "", "", false},
+		{SettingTypeNumber, "10", "10", true},
+		{SettingTypeNumber, " 2.50 ", "2.5", true},
+		{SettingTypeNumber, "ten", "", false},
+		{SettingTypeString, " PlayPulse ", " PlayPulse ", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeSettingValue(tt.settingType, tt.value)
+		if !tt.valid {
+			if !errors.Is(err, ErrInvalidSettingValue) {
+				t.Errorf("%s %q = %q, %v, want ErrInvalidSettingValue", tt.settingType, tt.value, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s %q = %q, %v, want %q", tt.settingType, tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestSettingValueIsTyped(t *testing.T) {
+	tests := []struct {
+		setting models.SystemSetting
+		want    interface{}
+	}{
+		{models.SystemSetting{Type: SettingTypeBoolean, Value: "true"}, true},
+		{models.SystemSetting{Type: SettingTypeNumber, Value: "7"}, float64(7)},
+		{models.SystemSetting{Type: SettingTypeNumber, Value: "seven"}, "seven"},
+		{models.SystemSetting{Type: SettingTypeString, Value: "true"}, "true"},
+	}
+	for _, tt := range tests {
+		if got := SettingValue(tt.setting); got != tt.want {
+			t.Errorf("SettingValue(%s %q) = %#v, want %#v", tt.setting.Type, tt.setting.Value, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateSettingRejectsNonBoolean(t *testing.T) {
+	testDB(t)
+	if err := LoadSettings(); err != nil {
+		t.Fatal(err)
+	}
+
+	before := GetBool("allow_registration", true)
+	if _, _, err := UpdateSetting("allow_registration", "maybe"); !errors.Is(err, ErrInvalidSettingValue) {
+		t.Fatalf("UpdateSetting with a non-boolean = %v, want ErrInvalidSettingValue", err)
+	}
+	if stored, _ := GetSetting("allow_registration"); stored == nil || stored.Value != "false" && stored.Value != "true" {
+		t.Errorf("stored value = %+v, want the boolean kept", stored)
+	}
+	if GetBool("allow_registration", !before) != before {
+		t.Error("a rejected update changed the cached value")
+	}
+
+	if _, _, err := UpdateSetting("no_such_setting", "true"); !errors.Is(err, ErrSettingNotFound) {
+		t.Errorf("UpdateSetting of an unknown key = %v, want ErrSettingNotFound", err)
+	}
+
+	// A valid update is seen through the cache straight away
+	setting, previous, err := UpdateSetting("allow_registration", strconv.FormatBool(!before))
+	if err != nil {
+		t.Fatalf("UpdateSetting: %v", err)
+	}
+	t.Cleanup(func() { UpdateSetting("allow_registration", previous) })
+	if setting.Value != strconv.FormatBool(!before) || GetBool("allow_registration", before) != !before {
+		t.Errorf("after the update the setting is %q and reads %v, want %v", setting.Value, GetBool("allow_registration", before), !before)
+	}
+}
+
+// useTestSettings fills the settings cache until the test ends
+func useTestSettings(t *testing.T, settings ...models.SystemSetting) {
+	t.Helper()
+
+	cache := make(map[string]models.SystemSetting, len(settings))
+	for _, setting := range settings {
+		cache[setting.Key] = setting
+	}
+
+	settingsMutex.Lock()
+	previous := settingsCache
+	settingsCache = cache
+	settingsMutex.Unlock()
+	t.Cleanup(func() {
+		settingsMutex.Lock()
+		settingsCache = previous
+		settingsMutex.Unlock()
+	})
+}
+
+func TestSettingGettersReadCache(t *testing.T) {
+	// With no database any lookup that missed the cache would panic
+	previousDB := database.DB
+	database.DB = nil
+	t.Cleanup(func() { database.DB = previousDB })
+
+	useTestSettings(t,
+		models.SystemSetting{Key: "allow_registration", Type: SettingTypeBoolean, Value: "true"},
+		models.SystemSetting{Key: "max_backups", Type: SettingTypeNumber, Value: "12.7"},
+		models.SystemSetting{Key: "panel_name", Type: SettingTypeString, Value: "PlayPulse"},
+		models.SystemSetting{Key: "broken_flag", Type: SettingTypeBoolean, Value: "sometimes"},
+	)
+
+	if !GetBool("allow_registration", false) {
+		t.Error("GetBool(allow_registration) = false, want the cached true")
+	}
+	if got := GetInt("max_backups", 0); got != 12 {
+		t.Errorf("GetInt(max_backups) = %d, want 12", got)
+	}
+	if got := GetString("panel_name", ""); got != "PlayPulse" {
+		t.Errorf("GetString(panel_name) = %q, want PlayPulse", got)
+	}
+
+	// Missing or unparsable values fall back to the default
+	if !GetBool("broken_flag", true) || GetBool("missing", false) {
+		t.Error("GetBool did not fall back to the default")
+	}
+	if got := GetInt("panel_name", 5); got != 5 {
+		t.Errorf("GetInt of a string setting = %d, want the default", got)
+	}
+	if got := GetString("missing", "fallback"); got != "fallback" {
+		t.Errorf("GetString(missing) = %q, want the default", got)
+	}
+}
+
+func TestSettingsCacheConcurrentAccess(t *testing.T) {
+	useTestSettings(t, models.SystemSetting{Key: "max_backups", Type: SettingTypeNumber, Value: "1"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				GetInt("max_backups", 0)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				settingsMutex.Lock()
+				settingsCache["max_backups"] = models.SystemSetting{Key: "max_backups", Type: SettingTypeNumber, Value: strconv.Itoa(i)}
+				settingsMutex.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSettingUpdateReflectedWithoutRestart(t *testing.T) {
+	testDB(t)
+	if err := LoadSettings(); err != nil {
+		t.Fatal(err)
+	}
+
+	original := GetInt("max_backup_count", -1)
+	if original < 0 {
+		t.Fatal("max_backup_count is not seeded")
+	}
+	t.Cleanup(func() { UpdateSetting("max_backup_count", strconv.Itoa(original)) })
+
+	// A change made behind the cache's back isn't seen until it is
+	// invalidated: the getters don't query the database
+	database.DB.Model(&models.SystemSetting{}).Where("key = ?", "max_backup_count").Update("value", strconv.Itoa(original+1))
+	if got := GetInt("max_backup_count", -1); got != original {
+		t.Errorf("GetInt after a direct write = %d, want the cached %d", got, original)
+	}
+	InvalidateSetting("max_backup_count")
+	if got := GetInt("max_backup_count", -1); got != original+1 {
+		t.Errorf("GetInt after invalidating = %d, want %d", got, original+1)
+	}
+
+	if _, _, err := UpdateSetting("max_backup_count", strconv.Itoa(original+2)); err != nil {
+		t.Fatalf("UpdateSetting: %v", err)
+	}
+	if got := GetInt("max_backup_count", -1); got != original+2 {
+		t.Errorf("GetInt after UpdateSetting = %d, want %d", got, original+2)
+	}
+}
@@ -0,0 +1,606 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrSFTPAuthFailed is returned for any rejected SFTP login
+var ErrSFTPAuthFailed = errors.New("sftp authentication failed")
+
+// SFTPServer serves server files over SFTP. The root directory lists one
+// directory per server the user can access, named by server ID, and each
+// maps onto that server's Path.
+type SFTPServer struct {
+	config    *config.Config
+	sshConfig *ssh.ServerConfig
+}
+
+// NewSFTPServer loads or generates the host key and prepares authentication
+func NewSFTPServer(cfg *config.Config) (*SFTPServer, error) {
+	hostKey, err := loadSFTPHostKey(cfg.Files.SFTP.HostKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load host key: %v", err)
+	}
+
+	s := &SFTPServer{config: cfg}
+	s.sshConfig = &ssh.ServerConfig{
+		PasswordCallback:  s.authenticatePassword,
+		PublicKeyCallback: s.authenticatePublicKey,
+	}
+	s.sshConfig.AddHostKey(hostKey)
+
+	return s, nil
+}
+
+// ListenAndServe accepts SFTP connections on the configured port
+func (s *SFTPServer) ListenAndServe() error {
+	listener, err := net.Listen("tcp", ":"+s.config.Files.SFTP.Port)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	log.Printf("SFTP server listening on :%s", s.config.Files.SFTP.Port)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// authenticatePassword checks panel credentials, applying the same account
+// state checks and lockout as the login endpoint
+func (s *SFTPServer) authenticatePassword(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	user, err := s.loginUser(conn.User())
+	if err != nil {
+		return nil, err
+	}
+
+	if !utils.CheckPasswordHash(string(password), user.Password) {
+		user.LoginAttempts++
+		if user.LoginAttempts >= s.config.Security.MaxLoginAttempts {
+			lockUntil := time.Now().Add(time.Duration(s.config.Security.LoginCooldownMinutes) * time.Minute)
+			user.LockedUntil = &lockUntil
+		}
+		database.DB.Save(user)
+		return nil, ErrSFTPAuthFailed
+	}
+
+	user.LoginAttempts = 0
+	user.LockedUntil = nil
+	database.DB.Save(user)
+
+	return &ssh.Permissions{
+		Extensions: map[string]string{"user_id": user.ID.String()},
+	}, nil
+}
+
+// authenticatePublicKey accepts a registered SFTP key of the user. A key bound
+// to a server limits the session to that server.
+func (s *SFTPServer) authenticatePublicKey(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	user, err := s.loginUser(conn.User())
+	if err != nil {
+		return nil, err
+	}
+
+	var sftpKey models.SFTPKey
+	if err := database.DB.Where("user_id = ? AND fingerprint = ?", user.ID, ssh.FingerprintSHA256(key)).First(&sftpKey).Error; err != nil {
+		return nil, ErrSFTPAuthFailed
+	}
+
+	now := time.Now()
+	database.DB.Model(&sftpKey).Update("last_used", now)
+
+	permissions := &ssh.Permissions{
+		Extensions: map[string]string{"user_id": user.ID.String()},
+	}
+	if sftpKey.ServerID != nil {
+		permissions.Extensions["server_id"] = sftpKey.ServerID.String()
+	}
+	return permissions, nil
+}
+
+// loginUser finds an active, unlocked and verified user by username
+func (s *SFTPServer) loginUser(username string) (*models.User, error) {
+	var user models.User
+	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, ErrSFTPAuthFailed
+	}
+
+	if !user.IsActive {
+		return nil, ErrSFTPAuthFailed
+	}
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		return nil, ErrSFTPAuthFailed
+	}
+	if !user.EmailVerified && EmailVerificationRequired() {
+		return nil, ErrSFTPAuthFailed
+	}
+
+	return &user, nil
+}
+
+func (s *SFTPServer) handleConn(conn net.Conn) {
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, s.sshConfig)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer serverConn.Close()
+	go ssh.DiscardRequests(requests)
+
+	fs, err := newSFTPFileSystem(serverConn.Permissions)
+	if err != nil {
+		log.Printf("SFTP session rejected for %s: %v", serverConn.User(), err)
+		return
+	}
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		// Only the sftp subsystem is offered; shells and exec are refused
+		go func(in <-chan *ssh.Request) {
+			for req := range in {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+			}
+		}(channelRequests)
+
+		server := sftp.NewRequestServer(channel, sftp.Handlers{
+			FileGet:  fs,
+			FilePut:  fs,
+			FileCmd:  fs,
+			FileList: fs,
+		})
+		go func() {
+			if err := server.Serve(); err != nil && err != io.EOF {
+				log.Printf("SFTP session error for %s: %v", serverConn.User(), err)
+			}
+			server.Close()
+		}()
+	}
+}
+
+// sftpFileSystem resolves SFTP paths for one authenticated user
+type sftpFileSystem struct {
+	user     models.User
+	serverID *uuid.UUID // set when the session is limited to one server
+}
+
+func newSFTPFileSystem(permissions *ssh.Permissions) (*sftpFileSystem, error) {
+	userID, err := uuid.Parse(permissions.Extensions["user_id"])
+	if err != nil {
+		return nil, ErrSFTPAuthFailed
+	}
+
+	fs := &sftpFileSystem{}
+	if err := database.DB.Where("id = ? AND is_active = ?", userID, true).First(&fs.user).Error; err != nil {
+		return nil, ErrSFTPAuthFailed
+	}
+
+	if id, ok := permissions.Extensions["server_id"]; ok {
+		serverID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, ErrSFTPAuthFailed
+		}
+		fs.serverID = &serverID
+	}
+
+	return fs, nil
+}
+
+// servers lists the servers visible in the root directory
+func (fs *sftpFileSystem) servers() ([]models.Server, error) {
+	if fs.serverID != nil {
+		server, err := GetServerWithPermission(&fs.user, *fs.serverID, models.ServerPermissionFiles)
+		if err != nil {
+			return nil, nil
+		}
+		return []models.Server{*server}, nil
+	}
+
+	servers, err := GetAccessibleServers(&fs.user)
+	if err != nil {
+		return nil, err
+	}
+	withFiles := servers[:0]
+	for _, server := range servers {
+		if HasServerPermission(&fs.user, server.ID, models.ServerPermissionFiles) {
+			withFiles = append(withFiles, server)
+		}
+	}
+	return withFiles, nil
+}
+
+// resolve maps an SFTP path to a path on disk. The first path element is
+// the server ID; the rest must stay inside that server's directory, also
+// after following symlinks. An empty result means the virtual root.
+func (fs *sftpFileSystem) resolve(sftpPath string) (string, error) {
+	target, _, err := fs.resolveServer(sftpPath)
+	return target, err
+}
+
+// resolveServer is resolve that also returns the server the path belongs to
+func (fs *sftpFileSystem) resolveServer(sftpPath string) (string, *models.Server, error) {
+	cleaned := path.Clean("/" + sftpPath)
+	if cleaned == "/" {
+		return "", nil, nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(cleaned, "/"), "/", 2)
+	serverID, err := uuid.Parse(parts[0])
+	if err != nil {
+		return "", nil, os.ErrNotExist
+	}
+	if fs.serverID != nil && *fs.serverID != serverID {
+		return "", nil, os.ErrNotExist
+	}
+
+	server, err := GetServerWithPermission(&fs.user, serverID, models.ServerPermissionFiles)
+	if err != nil {
+		// Servers the user cannot access look the same as missing ones
+		return "", nil, os.ErrNotExist
+	}
+
+	root, err := filepath.Abs(server.Path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	target := root
+	if len(parts) == 2 {
+		target = filepath.Join(root, filepath.FromSlash(parts[1]))
+	}
+
+	if err := ensureWithin(root, target); err != nil {
+		return "", nil, err
+	}
+
+	return target, server, nil
+}
+
+// ensureWithin rejects target when it, or its nearest existing parent once
+// symlinks are resolved, lies outside root
+func ensureWithin(root, target string) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+
+	existing := target
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			existing = resolved
+			break
+		}
+		if !os.IsNotExist(err) || existing == root {
+			return err
+		}
+		existing = filepath.Dir(existing)
+	}
+
+	rel, err := filepath.Rel(realRoot, existing)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return os.ErrPermission
+	}
+	return nil
+}
+
+// Fileread opens a file for download
+func (fs *sftpFileSystem) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	target, err := fs.resolve(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	if target == "" {
+		return nil, os.ErrPermission
+	}
+	return os.Open(target)
+}
+
+// Filewrite opens a file for upload. Writes that would grow the server past
+// its disk quota fail.
+func (fs *sftpFileSystem) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	target, server, err := fs.resolveServer(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	if target == "" {
+		return nil, os.ErrPermission
+	}
+	if err := CheckDiskQuota(server, 0); err != nil {
+		return nil, err
+	}
+
+	flags := os.O_WRONLY
+	var truncated int64
+	pflags := r.Pflags()
+	if pflags.Creat {
+		flags |= os.O_CREATE
+	}
+	if pflags.Trunc {
+		flags |= os.O_TRUNC
+		if info, err := os.Stat(target); err == nil && info.Mode().IsRegular() {
+			truncated = info.Size()
+		}
+	}
+	if pflags.Excl {
+		flags |= os.O_EXCL
+	}
+
+	file, err := os.OpenFile(target, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if truncated > 0 {
+		RecordDiskWrite(server, -truncated)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &quotaWriterAt{file: file, server: server, size: info.Size()}, nil
+}
+
+// quotaWriterAt checks the server's disk quota before each write that grows
+// the file and records the growth
+type quotaWriterAt struct {
+	file   *os.File
+	server *models.Server
+	size   int64
+	mutex  sync.Mutex
+}
+
+func (w *quotaWriterAt) WriteAt(p []byte, offset int64) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	growth := offset + int64(len(p)) - w.size
+	if growth > 0 {
+		if err := CheckDiskQuota(w.server, growth); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.WriteAt(p, offset)
+	if end := offset + int64(n); end > w.size {
+		RecordDiskWrite(w.server, end-w.size)
+		w.size = end
+	}
+	return n, err
+}
+
+// Close is called by the SFTP server when the handle is closed
+func (w *quotaWriterAt) Close() error {
+	return w.file.Close()
+}
+
+// Filecmd handles modifying commands. Links are refused so nothing can point
+// outside a server directory.
+func (fs *sftpFileSystem) Filecmd(r *sftp.Request) error {
+	target, err := fs.resolve(r.Filepath)
+	if err != nil {
+		return err
+	}
+	if target == "" || isServerRoot(r.Filepath) {
+		return os.ErrPermission
+	}
+
+	switch r.Method {
+	case "Setstat":
+		attrs := r.Attributes()
+		if r.AttrFlags().Size {
+			if err := fs.truncate(r.Filepath, target, int64(attrs.Size)); err != nil {
+				return err
+			}
+		}
+		if r.AttrFlags().Acmodtime {
+			return os.Chtimes(target, time.Unix(int64(attrs.Atime), 0), time.Unix(int64(attrs.Mtime), 0))
+		}
+		return nil
+	case "Rename", "PosixRename":
+		dest, err := fs.resolve(r.Target)
+		if err != nil {
+			return err
+		}
+		if dest == "" || isServerRoot(r.Target) || !sameServer(r.Filepath, r.Target) {
+			return os.ErrPermission
+		}
+		return os.Rename(target, dest)
+	case "Rmdir":
+		return os.Remove(target)
+	case "Remove":
+		return os.Remove(target)
+	case "Mkdir":
+		return os.Mkdir(target, 0755)
+	default:
+		return sftp.ErrSSHFxOpUnsupported
+	}
+}
+
+// truncate sets a file's size. Growing it counts against the server's disk
+// quota like a write does.
+func (fs *sftpFileSystem) truncate(filePath, target string, size int64) error {
+	_, server, err := fs.resolveServer(filePath)
+	if err != nil {
+		return err
+	}
+
+	var current int64
+	if info, err := os.Stat(target); err == nil && info.Mode().IsRegular() {
+		current = info.Size()
+	}
+	if size > current {
+		if err := CheckDiskQuota(server, size-current); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Truncate(target, size); err != nil {
+		return err
+	}
+	RecordDiskWrite(server, size-current)
+	return nil
+}
+
+// Filelist handles listing, stat and readlink
+func (fs *sftpFileSystem) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	target, err := fs.resolve(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	if target == "" {
+		return fs.listRoot(r.Method)
+	}
+
+	switch r.Method {
+	case "List":
+		entries, err := os.ReadDir(target)
+		if err != nil {
+			return nil, err
+		}
+		infos := make([]os.FileInfo, 0, len(entries))
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			infos = append(infos, info)
+		}
+		return sftpListerAt(infos), nil
+	case "Stat":
+		info, err := os.Lstat(target)
+		if err != nil {
+			return nil, err
+		}
+		if isServerRoot(r.Filepath) {
+			info = sftpDirInfo{name: path.Base(path.Clean("/" + r.Filepath)), modTime: info.ModTime()}
+		}
+		return sftpListerAt{info}, nil
+	default:
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+}
+
+func (fs *sftpFileSystem) listRoot(method string) (sftp.ListerAt, error) {
+	if method == "Stat" {
+		return sftpListerAt{sftpDirInfo{name: "/", modTime: time.Now()}}, nil
+	}
+	if method != "List" {
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+
+	servers, err := fs.servers()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]os.FileInfo, 0, len(servers))
+	for _, server := range servers {
+		infos = append(infos, sftpDirInfo{name: server.ID.String(), modTime: server.UpdatedAt})
+	}
+	return sftpListerAt(infos), nil
+}
+
+// isServerRoot reports whether sftpPath names a server directory itself,
+// which cannot be removed, renamed or modified
+func isServerRoot(sftpPath string) bool {
+	return !strings.Contains(strings.TrimPrefix(path.Clean("/"+sftpPath), "/"), "/")
+}
+
+// sameServer reports whether two SFTP paths lie in the same server directory
+func sameServer(a, b string) bool {
+	first := func(p string) string {
+		return strings.SplitN(strings.TrimPrefix(path.Clean("/"+p), "/"), "/", 2)[0]
+	}
+	return first(a) == first(b)
+}
+
+type sftpListerAt []os.FileInfo
+
+func (l sftpListerAt) ListAt(dst []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(dst, l[offset:])
+	if n < len(dst) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// sftpDirInfo describes the virtual root and server directories
+type sftpDirInfo struct {
+	name    string
+	modTime time.Time
+}
+
+func (d sftpDirInfo) Name() string       { return d.name }
+func (d sftpDirInfo) Size() int64        { return 0 }
+func (d sftpDirInfo) Mode() os.FileMode  { return os.ModeDir | 0755 }
+func (d sftpDirInfo) ModTime() time.Time { return d.modTime }
+func (d sftpDirInfo) IsDir() bool        { return true }
+func (d sftpDirInfo) Sys() interface{}   { return nil }
+
+func loadSFTPHostKey(keyPath string) (ssh.Signer, error) {
+	if data, err := os.ReadFile(keyPath); err == nil {
+		return ssh.ParsePrivateKey(data)
+	}
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := ssh.MarshalPrivateKey(privateKey, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, err
+	}
+
+	return ssh.NewSignerFromKey(privateKey)
+}
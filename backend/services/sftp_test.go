@@ -0,0 +1,237 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"playpulse-panel/config"
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const sftpTestPassword = "correct horse battery staple"
+
+// startTestSFTP serves SFTP on a local port until the test ends and returns
+// its address
+func startTestSFTP(t *testing.T) string {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Files.SFTP.HostKeyPath = filepath.Join(t.TempDir(), "host_key")
+	cfg.Security.MaxLoginAttempts = 5
+	cfg.Security.LoginCooldownMinutes = 15
+
+	server, err := NewSFTPServer(cfg)
+	if err != nil {
+		t.Fatalf("NewSFTPServer: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.handleConn(conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func dialSFTP(t *testing.T, addr, username string, auth ssh.AuthMethod) (*sftp.Client, error) {
+	t.Helper()
+
+	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            username,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	t.Cleanup(func() {
+		client.Close()
+		conn.Close()
+	})
+	return client, nil
+}
+
+// createSFTPUser saves a verified user who logs in with sftpTestPassword
+func createSFTPUser(t *testing.T) *models.User {
+	t.Helper()
+
+	hash, err := utils.HashPassword(sftpTestPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testutil.CreateUser(t, &models.User{Password: hash, EmailVerified: true})
+}
+
+// registerSFTPKey generates a key pair, registers its public key for user
+// and returns the signer to log in with
+func registerSFTPKey(t *testing.T, user *models.User, server *models.Server) ssh.Signer {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := models.SFTPKey{
+		UserID:      user.ID,
+		Name:        "test",
+		PublicKey:   string(ssh.MarshalAuthorizedKey(sshKey)),
+		Fingerprint: ssh.FingerprintSHA256(sshKey),
+	}
+	if server != nil {
+		key.ServerID = &server.ID
+	}
+	if err := database.DB.Create(&key).Error; err != nil {
+		t.Fatalf("failed to register key: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Delete(&key) })
+	return signer
+}
+
+func TestSFTPRejectsBadCredentials(t *testing.T) {
+	testDB(t)
+	addr := startTestSFTP(t)
+	user := createSFTPUser(t)
+
+	if _, err := dialSFTP(t, addr, user.Username, ssh.Password("wrong")); err == nil {
+		t.Error("login with a wrong password succeeded")
+	}
+	if _, err := dialSFTP(t, addr, "nobody-"+user.Username, ssh.Password(sftpTestPassword)); err == nil {
+		t.Error("login as an unknown user succeeded")
+	}
+
+	// A key that was never registered
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(privateKey)
+	if _, err := dialSFTP(t, addr, user.Username, ssh.PublicKeys(signer)); err == nil {
+		t.Error("login with an unregistered key succeeded")
+	}
+
+	var failed models.User
+	database.DB.First(&failed, "id = ?", user.ID)
+	if failed.LoginAttempts != 1 {
+		t.Errorf("login attempts = %d, want the wrong password counted", failed.LoginAttempts)
+	}
+
+	// Disabled accounts can't log in with the right password either
+	database.DB.Model(user).Update("is_active", false)
+	if _, err := dialSFTP(t, addr, user.Username, ssh.Password(sftpTestPassword)); err == nil {
+		t.Error("login to a disabled account succeeded")
+	}
+}
+
+func TestSFTPListsOnlyAccessibleServers(t *testing.T) {
+	testDB(t)
+	addr := startTestSFTP(t)
+	user := createSFTPUser(t)
+
+	own := testutil.CreateServer(t, &models.Server{})
+	testutil.GrantServerAccess(t, user, own, models.ServerRoleOwner)
+	if err := os.WriteFile(filepath.Join(own.Path, "server.properties"), []byte("motd=hi\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A member without the files permission sees the server nowhere
+	consoleOnly := testutil.CreateServer(t, &models.Server{})
+	testutil.GrantServerAccess(t, user, consoleOnly, models.ServerRoleMember, models.ServerPermissionConsole)
+
+	other := testutil.CreateServer(t, &models.Server{})
+	if err := os.WriteFile(filepath.Join(other.Path, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := dialSFTP(t, addr, user.Username, ssh.Password(sftpTestPassword))
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	entries, err := client.ReadDir("/")
+	if err != nil {
+		t.Fatalf("ReadDir(/): %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != own.ID.String() {
+		names := make([]string, len(entries))
+		for i, entry := range entries {
+			names[i] = entry.Name()
+		}
+		sort.Strings(names)
+		t.Errorf("root lists %v, want only %s", names, own.ID)
+	}
+
+	if files, err := client.ReadDir("/" + own.ID.String()); err != nil || len(files) != 1 || files[0].Name() != "server.properties" {
+		t.Errorf("own server lists %v, %v", files, err)
+	}
+
+	for _, server := range []*models.Server{other, consoleOnly} {
+		if _, err := client.ReadDir("/" + server.ID.String()); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("listing inaccessible server %s: err = %v, want not found", server.Name, err)
+		}
+	}
+	if _, err := client.Open("/" + other.ID.String() + "/secret.txt"); err == nil {
+		t.Error("read a file of a server without access")
+	}
+	if _, err := client.ReadDir("/" + own.ID.String() + "/../" + other.ID.String()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("traversal into another server: err = %v, want not found", err)
+	}
+}
+
+func TestSFTPServerBoundKey(t *testing.T) {
+	testDB(t)
+	addr := startTestSFTP(t)
+	user := createSFTPUser(t)
+
+	first := testutil.CreateServer(t, &models.Server{})
+	second := testutil.CreateServer(t, &models.Server{})
+	testutil.GrantServerAccess(t, user, first, models.ServerRoleOwner)
+	testutil.GrantServerAccess(t, user, second, models.ServerRoleOwner)
+
+	signer := registerSFTPKey(t, user, first)
+	client, err := dialSFTP(t, addr, user.Username, ssh.PublicKeys(signer))
+	if err != nil {
+		t.Fatalf("login with a registered key: %v", err)
+	}
+
+	entries, err := client.ReadDir("/")
+	if err != nil || len(entries) != 1 || entries[0].Name() != first.ID.String() {
+		t.Errorf("root lists %v, %v, want only the key's server", entries, err)
+	}
+	if _, err := client.ReadDir("/" + second.ID.String()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("listing another server with a bound key: err = %v, want not found", err)
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+// statsSampleMaxAge is how long a stats sample is reused. It is below the
+// broadcast interval so every broadcast gets a fresh sample, while the API
+// and persistence share the broadcast's.
+const statsSampleMaxAge = time.Second
+
+// statsSample is a server's latest stats and when they were read
+type statsSample struct {
+	stats     ServerStats
+	sampledAt time.Time
+}
+
+// statsSampler caches the latest stats of each server so broadcasts, the
+// stats endpoint and metric persistence don't each read the process
+var statsSampler = struct {
+	sync.Mutex
+	samples map[uuid.UUID]statsSample
+}{samples: make(map[uuid.UUID]statsSample)}
+
+// GetServerStats returns a server's current statistics, sampled at most
+// once per statsSampleMaxAge. Reading stats doesn't persist them; the
+// metrics collector does that on its own interval.
+func GetServerStats(server *models.Server) (*ServerStats, error) {
+	now := time.Now()
+
+	statsSampler.Lock()
+	sample, exists := statsSampler.samples[server.ID]
+	statsSampler.Unlock()
+
+	if exists && now.Sub(sample.sampledAt) < statsSampleMaxAge {
+		stats := sample.stats
+		return &stats, nil
+	}
+
+	stats := sampleServerStats(server)
+
+	statsSampler.Lock()
+	statsSampler.samples[server.ID] = statsSample{stats: *stats, sampledAt: now}
+	statsSampler.Unlock()
+
+	return stats, nil
+}
+
+// pruneServerStats drops the cached stats of servers no longer running
+func pruneServerStats(running map[uuid.UUID]bool) {
+	statsSampler.Lock()
+	defer statsSampler.Unlock()
+
+	for id := range statsSampler.samples {
+		if !running[id] {
+			delete(statsSampler.samples, id)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"gorm.io/gorm"
+)
+
+// maxServerTags caps how many tags a server has
+const maxServerTags = 10
+
+var (
+	// ErrInvalidTag is returned for a tag that doesn't match tagPattern
+	ErrInvalidTag = errors.New("invalid tag")
+	// ErrTooManyTags is returned when a server would have more than
+	// maxServerTags tags
+	ErrTooManyTags = errors.New("too many tags")
+)
+
+// Tags are lowercase letters, digits, dots, dashes and underscores, such as
+// "survival" or "eu-west", and start with a letter or digit
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,31}$`)
+
+// NormalizeTag trims and lowercases a tag and checks its format
+func NormalizeTag(tag string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(tag))
+	if !tagPattern.MatchString(normalized) {
+		return "", fmt.Errorf("%w: %q must be 1-32 letters, digits, dots, dashes or underscores", ErrInvalidTag, tag)
+	}
+	return normalized, nil
+}
+
+// AddServerTags adds tags to a server, ignoring ones it already has
+func AddServerTags(server *models.Server, tags []string) error {
+	merged := append([]string{}, server.Tags...)
+	for _, tag := range tags {
+		normalized, err := NormalizeTag(tag)
+		if err != nil {
+			return err
+		}
+		if !containsTag(merged, normalized) {
+			merged = append(merged, normalized)
+		}
+	}
+	if len(merged) > maxServerTags {
+		return fmt.Errorf("%w: a server can have at most %d tags", ErrTooManyTags, maxServerTags)
+	}
+
+	sort.Strings(merged)
+	return saveServerTags(server, merged)
+}
+
+// RemoveServerTag removes a tag from a server. Removing a tag the server
+// doesn't have is not an error.
+func RemoveServerTag(server *models.Server, tag string) error {
+	normalized := strings.ToLower(strings.TrimSpace(tag))
+
+	remaining := make([]string, 0, len(server.Tags))
+	for _, existing := range server.Tags {
+		if existing != normalized {
+			remaining = append(remaining, existing)
+		}
+	}
+	return saveServerTags(server, remaining)
+}
+
+// WhereServerTag limits a server query to servers with the tag
+func WhereServerTag(query *gorm.DB, tag string) (*gorm.DB, error) {
+	normalized, err := NormalizeTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	match, err := json.Marshal([]string{normalized})
+	if err != nil {
+		return nil, err
+	}
+	return query.Where("servers.tags @> ?::jsonb", string(match)), nil
+}
+
+// GroupServersByTag groups servers under each of their tags; a server with
+// several tags is in several groups. Untagged servers are left out.
+func GroupServersByTag(servers []models.Server) map[string][]models.Server {
+	groups := make(map[string][]models.Server)
+	for _, server := range servers {
+		for _, tag := range server.Tags {
+			groups[tag] = append(groups[tag], server)
+		}
+	}
+	return groups
+}
+
+func saveServerTags(server *models.Server, tags []string) error {
+	server.Tags = tags
+	return database.DB.Model(server).Select("tags").Updates(server).Error
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, existing := range tags {
+		if existing == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		tag   string
+		want  string
+		valid bool
+	}{
+		{"survival", "survival", true},
+		{"  EU-West ", "eu-west", true},
+		{"v1.20_modded", "v1.20_modded", true},
+		{"", "", false},
+		{"-leading", "", false},
+		{"has space", "", false},
+		{"emoji🎮", "", false},
+		{strings.Repeat("a", 32), strings.Repeat("a", 32), true},
+		{strings.Repeat("a", 33), "", false},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeTag(tt.tag)
+		if !tt.valid {
+			if !errors.Is(err, ErrInvalidTag) {
+				t.Errorf("NormalizeTag(%q) = %q, %v, want ErrInvalidTag", tt.tag, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeTag(%q) = %q, %v, want %q", tt.tag, got, err, tt.want)
+		}
+	}
+}
+
+func TestGroupServersByTag(t *testing.T) {
+	lobby := models.Server{Name: "lobby", Tags: []string{"eu", "network"}}
+	survival := models.Server{Name: "survival", Tags: []string{"eu"}}
+	untagged := models.Server{Name: "test"}
+
+	groups := GroupServersByTag([]models.Server{lobby, survival, untagged})
+	names := func(servers []models.Server) string {
+		var names []string
+		for _, server := range servers {
+			names = append(names, server.Name)
+		}
+		return strings.Join(names, ",")
+	}
+	if len(groups) != 2 || names(groups["eu"]) != "lobby,survival" || names(groups["network"]) != "lobby" {
+		t.Errorf("groups = %v, want eu: lobby,survival and network: lobby", groups)
+	}
+}
+
+func TestAddServerTags(t *testing.T) {
+	testDB(t)
+	server := testutil.CreateServer(t, &models.Server{})
+
+	if err := AddServerTags(server, []string{"Survival", "eu", "survival"}); err != nil {
+		t.Fatalf("AddServerTags: %v", err)
+	}
+	if got := strings.Join(server.Tags, ","); got != "eu,survival" {
+		t.Errorf("tags = %s, want eu,survival deduplicated and sorted", got)
+	}
+
+	if err := AddServerTags(server, []string{"bad tag"}); !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("AddServerTags with a bad tag = %v, want ErrInvalidTag", err)
+	}
+
+	many := []string{"t1", "t2", "t3", "t4", "t5", "t6", "t7", "t8", "t9"}
+	if err := AddServerTags(server, many); !errors.Is(err, ErrTooManyTags) {
+		t.Errorf("AddServerTags past %d tags = %v, want ErrTooManyTags", maxServerTags, err)
+	}
+	if err := AddServerTags(server, many[:8]); err != nil {
+		t.Errorf("AddServerTags up to %d tags: %v", maxServerTags, err)
+	}
+
+	if err := RemoveServerTag(server, " EU "); err != nil {
+		t.Fatalf("RemoveServerTag: %v", err)
+	}
+	if err := RemoveServerTag(server, "never-had"); err != nil {
+		t.Errorf("removing a missing tag = %v, want no error", err)
+	}
+	if containsTag(server.Tags, "eu") || len(server.Tags) != 9 {
+		t.Errorf("tags after removing eu = %v", server.Tags)
+	}
+}
+
+func TestListServersByTagRespectsAccess(t *testing.T) {
+	testDB(t)
+	user := testutil.CreateUser(t, &models.User{})
+	admin := testutil.CreateUser(t, &models.User{Role: models.RoleAdmin})
+
+	tag := "t" + uuid.NewString()[:8]
+	mine := testutil.CreateServer(t, &models.Server{Tags: []string{tag, "survival"}})
+	mineUntagged := testutil.CreateServer(t, &models.Server{Tags: []string{"survival"}})
+	theirs := testutil.CreateServer(t, &models.Server{Tags: []string{tag}})
+	testutil.GrantServerAccess(t, user, mine, models.ServerRoleOwner)
+	testutil.GrantServerAccess(t, user, mineUntagged, models.ServerRoleOwner)
+
+	ids := func(page *ServerPage) string {
+		var ids []string
+		for _, server := range page.Servers {
+			ids = append(ids, server.ID.String())
+		}
+		sort.Strings(ids)
+		return strings.Join(ids, ",")
+	}
+	both := []string{mine.ID.String(), theirs.ID.String()}
+	sort.Strings(both)
+
+	page, err := ListServers(*user, ServerListOptions{Tag: strings.ToUpper(tag)})
+	if err != nil {
+		t.Fatalf("ListServers: %v", err)
+	}
+	if got := ids(page); got != mine.ID.String() {
+		t.Errorf("user's servers tagged %s = %s, want only their own %s", tag, got, mine.ID)
+	}
+
+	page, err = ListServers(*admin, ServerListOptions{Tag: tag})
+	if err != nil {
+		t.Fatalf("ListServers: %v", err)
+	}
+	if got := ids(page); got != strings.Join(both, ",") {
+		t.Errorf("admin's servers tagged %s = %s, want %s", tag, got, strings.Join(both, ","))
+	}
+
+	if _, err := ListServers(*user, ServerListOptions{Tag: "not a tag"}); !errors.Is(err, ErrInvalidServerList) {
+		t.Errorf("ListServers with a bad tag = %v, want ErrInvalidServerList", err)
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+)
+
+// QueueTemplatePlugins records the template's plugins against a newly
+// provisioned server. The records are created up front so the plugins show as
+// queued; ProvisionFromTemplate downloads them once the server is set up.
+func QueueTemplatePlugins(server *models.Server, template *models.ServerTemplate) ([]models.Plugin, error) {
+	pluginDir := filepath.Join(server.Path, pluginDirectory(server.Type))
+
+	var plugins []models.Plugin
+	for _, tp := range template.Plugins {
+		fileName := utils.SanitizeFilename(tp.Name) + ".jar"
+		plugin := models.Plugin{
+			ServerID:    server.ID,
+			Name:        tp.Name,
+			Version:     tp.Version,
+			FileName:    fileName,
+			FilePath:    filepath.Join(pluginDir, fileName),
+			Source:      models.PluginSourceManual,
+			SourceID:    tp.DownloadURL,
+			IsEnabled:   true,
+			InstallDate: time.Now(),
+		}
+		if err := database.DB.Omit("Server").Create(&plugin).Error; err != nil {
+			return plugins, fmt.Errorf("failed to queue plugin %s: %v", tp.Name, err)
+		}
+		plugins = append(plugins, plugin)
+	}
+
+	return plugins, nil
+}
+
+// ProvisionFromTemplate installs the server software, applies the template's
+// server.properties overrides and then downloads the queued plugins
+func ProvisionFromTemplate(server *models.Server, template *models.ServerTemplate, plugins []models.Plugin) {
+	if err := SetupServerJar(server); err != nil {
+		log.Printf("Failed to set up server %s from template %s: %v", server.Name, template.Name, err)
+		return
+	}
+
+	if len(template.Properties) > 0 {
+		if err := applyServerProperties(server, template.Properties); err != nil {
+			log.Printf("Failed to apply template properties to server %s: %v", server.Name, err)
+		}
+	}
+
+	for _, plugin := range plugins {
+		if err := utils.CreateDirectory(filepath.Dir(plugin.FilePath)); err != nil {
+			log.Printf("Failed to create plugin directory for server %s: %v", server.Name, err)
+			return
+		}
+
+		if err := downloadFile(plugin.SourceID, plugin.FilePath); err != nil {
+			log.Printf("Failed to install plugin %s on server %s: %v", plugin.Name, server.Name, err)
+			continue
+		}
+
+		if size, err := utils.GetFileSize(plugin.FilePath); err == nil {
+			database.DB.Model(&models.Plugin{}).Where("id = ?", plugin.ID).Update("file_size", size)
+		}
+	}
+}
+
+// pluginDirectory returns where a server type loads plugins or mods from
+func pluginDirectory(serverType models.ServerType) string {
+	switch serverType {
+	case models.ServerTypeFabric, models.ServerTypeForge:
+		return "mods"
+	default:
+		return "plugins"
+	}
+}
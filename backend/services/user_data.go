@@ -0,0 +1,202 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrLastAdmin is returned when deleting the only active admin account
+var ErrLastAdmin = errors.New("the last active admin account cannot be deleted")
+
+// UserDataExport is everything the panel stores about a user
+type UserDataExport struct {
+	ExportedAt     time.Time               `json:"exported_at"`
+	Profile        models.User             `json:"profile"`
+	Servers        []ExportedServerAccess  `json:"servers"`
+	AuditLogs      []models.AuditLog       `json:"audit_logs"`
+	Sessions       []models.UserSession    `json:"sessions"`
+	Identities     []models.UserIdentity   `json:"identities"`
+	APIKeys        []models.APIKey         `json:"api_keys"`
+	SFTPKeys       []models.SFTPKey        `json:"sftp_keys"`
+	Notifications  []models.Notification   `json:"notifications"`
+	CommandHistory []models.CommandHistory `json:"command_history"`
+}
+
+// ExportedServerAccess is a server the user can access and their role on it
+type ExportedServerAccess struct {
+	ServerID    uuid.UUID                 `json:"server_id"`
+	Name        string                    `json:"name"`
+	Role        models.ServerRole         `json:"role"`
+	Permissions []models.ServerPermission `json:"permissions"`
+	GrantedAt   time.Time                 `json:"granted_at"`
+}
+
+// ExportUserData collects a user's data for them to download. Secrets such
+// as password and key hashes are left out, as the models never serialize
+// them.
+func ExportUserData(userID uuid.UUID) (*UserDataExport, error) {
+	export := &UserDataExport{ExportedAt: time.Now()}
+
+	if err := database.DB.First(&export.Profile, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var memberships []models.UserServer
+	if err := database.DB.Where("user_id = ?", userID).Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+	export.Servers = make([]ExportedServerAccess, 0, len(memberships))
+	for _, membership := range memberships {
+		var server models.Server
+		if err := database.DB.Select("id", "name").First(&server, membership.ServerID).Error; err != nil {
+			continue
+		}
+		export.Servers = append(export.Servers, ExportedServerAccess{
+			ServerID:    server.ID,
+			Name:        server.Name,
+			Role:        membership.Role,
+			Permissions: membership.Permissions,
+			GrantedAt:   membership.CreatedAt,
+		})
+	}
+
+	queries := []struct {
+		target interface{}
+		order  string
+	}{
+		{&export.AuditLogs, "created_at DESC"},
+		{&export.Sessions, "created_at DESC"},
+		{&export.Identities, "created_at"},
+		{&export.APIKeys, "created_at"},
+		{&export.SFTPKeys, "created_at"},
+		{&export.Notifications, "created_at DESC"},
+		{&export.CommandHistory, "created_at DESC"},
+	}
+	for _, query := range queries {
+		if err := database.DB.Where("user_id = ?", userID).Order(query.order).Find(query.target).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return export, nil
+}
+
+// DeleteUserAccount erases a user's personal data. Their credentials,
+// sessions, keys, linked logins, notifications and server memberships are
+// deleted. The user row is kept, anonymized and soft deleted, so audit logs
+// and command history still point at a row; their IP addresses and user
+// agents are cleared.
+func DeleteUserAccount(user *models.User) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if user.Role == models.RoleAdmin {
+			var admins int64
+			if err := tx.Model(&models.User{}).
+				Where("role = ? AND is_active = ? AND id != ?", models.RoleAdmin, true, user.ID).
+				Count(&admins).Error; err != nil {
+				return err
+			}
+			if admins == 0 {
+				return ErrLastAdmin
+			}
+		}
+
+		owned := []interface{}{
+			&models.UserSession{},
+			&models.PasswordResetToken{},
+			&models.VerificationToken{},
+			&models.SFTPKey{},
+			&models.APIKey{},
+			&models.UserIdentity{},
+			&models.Notification{},
+			&models.IdempotencyKey{},
+			&models.UserServer{},
+		}
+		for _, model := range owned {
+			if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		// Audit logs are kept for the record of what happened, but their
+		// details may hold request bodies with the user's personal data
+		if err := tx.Model(&models.AuditLog{}).Where("user_id = ?", user.ID).
+			Updates(map[string]interface{}{"ip_address": "", "user_agent": "", "details": ""}).Error; err != nil {
+			return err
+		}
+
+		// A random password nobody knows, so the row can never be logged in to
+		password, err := utils.GenerateRandomString(48)
+		if err != nil {
+			return err
+		}
+		hashedPassword, err := utils.HashPassword(password)
+		if err != nil {
+			return err
+		}
+
+		anonymous := "deleted-" + user.ID.String()
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"username":           anonymous,
+			"email":              anonymous + "@deleted.invalid",
+			"password":           hashedPassword,
+			"first_name":         "",
+			"last_name":          "",
+			"avatar":             "",
+			"is_active":          false,
+			"email_verified":     false,
+			"two_factor_enabled": false,
+			"two_factor_secret":  "",
+			"last_login":         nil,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&models.User{}, user.ID).Error
+	})
+}
+
+// InitializeAuditRetention deletes audit logs older than the retention
+// once a day. The retention is the audit_log_retention_days setting, or
+// CLEANUP_LOGS_DAYS while that is 0. Both are 0 unless configured, which
+// keeps logs forever.
+func InitializeAuditRetention(cfg *config.Config) {
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+
+		for {
+			days := cfg.Security.CleanupLogsDays
+			if setting := GetInt("audit_log_retention_days", 0); setting > 0 {
+				days = setting
+			}
+			if days > 0 {
+				if err := PruneAuditLogs(time.Now().AddDate(0, 0, -days)); err != nil {
+					log.Printf("Failed to prune audit logs: %v", err)
+				}
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// PruneAuditLogs deletes audit logs recorded before cutoff
+func PruneAuditLogs(cutoff time.Time) error {
+	result := database.DB.Where("created_at < ?", cutoff).Delete(&models.AuditLog{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete audit logs: %v", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Pruned %d audit logs older than %s", result.RowsAffected, cutoff.Format("2006-01-02"))
+	}
+	return nil
+}
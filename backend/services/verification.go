@@ -0,0 +1,162 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"playpulse-panel/config"
+	"playpulse-panel/database"
+	"playpulse-panel/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	verificationTokenTTL = 24 * time.Hour
+
+	// Resend limits per user
+	verificationResendCooldown = 2 * time.Minute
+	verificationHourlyLimit    = 5
+)
+
+var (
+	ErrVerificationTokenInvalid = errors.New("verification token is invalid")
+	ErrVerificationTokenExpired = errors.New("verification token has expired")
+	ErrVerificationTokenUsed    = errors.New("verification token has already been used")
+	ErrVerificationRateLimited  = errors.New("too many verification emails requested")
+)
+
+// IssueVerificationToken creates a verification token for the user's current
+// email address and sends it by email. Resends are rate limited per user.
+func IssueVerificationToken(user *models.User) error {
+	var recent int64
+	database.DB.Model(&models.VerificationToken{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-time.Hour)).
+		Count(&recent)
+	if recent >= verificationHourlyLimit {
+		return ErrVerificationRateLimited
+	}
+
+	var last models.VerificationToken
+	err := database.DB.Where("user_id = ?", user.ID).Order("created_at DESC").First(&last).Error
+	if err == nil && time.Since(last.CreatedAt) < verificationResendCooldown {
+		return ErrVerificationRateLimited
+	}
+
+	token, err := CreateVerificationToken(user)
+	if err != nil {
+		return err
+	}
+
+	SendVerificationEmail(user, token)
+	return nil
+}
+
+// CreateVerificationToken stores a new token for the user and returns its
+// signed form. Older unused tokens of the user are invalidated.
+func CreateVerificationToken(user *models.User) (string, error) {
+	now := time.Now()
+	database.DB.Model(&models.VerificationToken{}).
+		Where("user_id = ? AND used_at IS NULL", user.ID).
+		Update("expires_at", now)
+
+	record := models.VerificationToken{
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: now.Add(verificationTokenTTL),
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		return "", fmt.Errorf("failed to create verification token: %v", err)
+	}
+
+	signature, err := signVerificationToken(&record)
+	if err != nil {
+		return "", err
+	}
+
+	return record.ID.String() + "." + signature, nil
+}
+
+// ConsumeVerificationToken validates a signed token, marks it used and flags
+// the user's email as verified
+func ConsumeVerificationToken(token string) (*models.User, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return nil, ErrVerificationTokenInvalid
+	}
+
+	tokenID, err := uuid.Parse(parts[0])
+	if err != nil {
+		return nil, ErrVerificationTokenInvalid
+	}
+
+	var record models.VerificationToken
+	if err := database.DB.First(&record, tokenID).Error; err != nil {
+		return nil, ErrVerificationTokenInvalid
+	}
+
+	expected, err := signVerificationToken(&record)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(expected)) {
+		return nil, ErrVerificationTokenInvalid
+	}
+
+	if record.UsedAt != nil {
+		return nil, ErrVerificationTokenUsed
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, ErrVerificationTokenExpired
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, record.UserID).Error; err != nil {
+		return nil, ErrVerificationTokenInvalid
+	}
+
+	// The token only verifies the address it was sent to
+	if !strings.EqualFold(user.Email, record.Email) {
+		return nil, ErrVerificationTokenInvalid
+	}
+
+	// Mark the token used atomically so it can't be consumed twice
+	now := time.Now()
+	result := database.DB.Model(&models.VerificationToken{}).
+		Where("id = ? AND used_at IS NULL", record.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to consume verification token: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrVerificationTokenUsed
+	}
+
+	user.EmailVerified = true
+	if err := database.DB.Model(&user).Update("email_verified", true).Error; err != nil {
+		return nil, fmt.Errorf("failed to verify email: %v", err)
+	}
+
+	return &user, nil
+}
+
+// EmailVerificationRequired reports whether unverified users are blocked from logging in
+func EmailVerificationRequired() bool {
+	return GetBool("require_email_verification", false)
+}
+
+func signVerificationToken(record *models.VerificationToken) (string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", fmt.Errorf("failed to load configuration: %v", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(cfg.JWT.Secret))
+	fmt.Fprintf(mac, "%s|%s|%s|%d", record.ID, record.UserID, strings.ToLower(record.Email), record.CreatedAt.Unix())
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
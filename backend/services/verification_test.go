@@ -0,0 +1,99 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"playpulse-panel/database"
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+)
+
+func TestConsumeVerificationTokenIsSingleUse(t *testing.T) {
+	testDB(t)
+	user := testutil.CreateUser(t, &models.User{})
+
+	token, err := CreateVerificationToken(user)
+	if err != nil {
+		t.Fatalf("CreateVerificationToken: %v", err)
+	}
+
+	verified, err := ConsumeVerificationToken(token)
+	if err != nil {
+		t.Fatalf("ConsumeVerificationToken: %v", err)
+	}
+	if !verified.EmailVerified {
+		t.Error("user is not marked verified")
+	}
+
+	if _, err := ConsumeVerificationToken(token); !errors.Is(err, ErrVerificationTokenUsed) {
+		t.Errorf("second use = %v, want ErrVerificationTokenUsed", err)
+	}
+}
+
+func TestConsumeVerificationTokenExpiry(t *testing.T) {
+	testDB(t)
+	user := testutil.CreateUser(t, &models.User{})
+
+	token, err := CreateVerificationToken(user)
+	if err != nil {
+		t.Fatalf("CreateVerificationToken: %v", err)
+	}
+	database.DB.Model(&models.VerificationToken{}).
+		Where("user_id = ?", user.ID).
+		Update("expires_at", time.Now().Add(-time.Minute))
+
+	if _, err := ConsumeVerificationToken(token); !errors.Is(err, ErrVerificationTokenExpired) {
+		t.Fatalf("ConsumeVerificationToken = %v, want ErrVerificationTokenExpired", err)
+	}
+
+	var reloaded models.User
+	database.DB.First(&reloaded, user.ID)
+	if reloaded.EmailVerified {
+		t.Error("an expired token verified the user")
+	}
+}
+
+func TestConsumeVerificationTokenRejectsTampering(t *testing.T) {
+	testDB(t)
+	user := testutil.CreateUser(t, &models.User{})
+
+	token, err := CreateVerificationToken(user)
+	if err != nil {
+		t.Fatalf("CreateVerificationToken: %v", err)
+	}
+
+	tests := map[string]string{
+		"empty":         "",
+		"no signature":  token[:36],
+		"bad signature": token + "0",
+	}
+	for name, tampered := range tests {
+		if _, err := ConsumeVerificationToken(tampered); !errors.Is(err, ErrVerificationTokenInvalid) {
+			t.Errorf("%s: got %v, want ErrVerificationTokenInvalid", name, err)
+		}
+	}
+
+	// A newer token invalidates the previous one
+	if _, err := CreateVerificationToken(user); err != nil {
+		t.Fatalf("CreateVerificationToken: %v", err)
+	}
+	if _, err := ConsumeVerificationToken(token); !errors.Is(err, ErrVerificationTokenExpired) {
+		t.Errorf("superseded token = %v, want ErrVerificationTokenExpired", err)
+	}
+}
+
+func TestEmailVerificationRequiredFollowsSetting(t *testing.T) {
+	testDB(t)
+
+	setTestSetting(t, "require_email_verification", "true")
+	if !EmailVerificationRequired() {
+		t.Error("verification is not required after enabling the setting")
+	}
+
+	setTestSetting(t, "require_email_verification", "false")
+	if EmailVerificationRequired() {
+		t.Error("verification is still required after disabling the setting")
+	}
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mojang's list of every released Minecraft version
+var mojangManifestURL = "https://launchermeta.mojang.com/mc/game/version_manifest.json"
+
+// How long the Mojang version list is reused before fetching it again
+const versionCatalogTTL = time.Hour
+
+// mojangVersionCatalog caches the Mojang version manifest. Every version in
+// it is known, releases are what gets suggested.
+type mojangVersionCatalog struct {
+	mutex     sync.RWMutex
+	known     map[string]bool
+	releases  []string
+	fetchedAt time.Time
+}
+
+var mojangVersions = &mojangVersionCatalog{}
+
+type mojangVersionManifest struct {
+	Versions []struct {
+		ID   string `json:"id"`
+		Type string `json:"type"` // release, snapshot, old_beta, old_alpha
+	} `json:"versions"`
+}
+
+// versions returns the known versions and the releases, newest first. A
+// failed refresh keeps serving the previous list if there is one.
+func (mc *mojangVersionCatalog) versions() (map[string]bool, []string, error) {
+	mc.mutex.RLock()
+	known, releases, fetchedAt := mc.known, mc.releases, mc.fetchedAt
+	mc.mutex.RUnlock()
+
+	if known != nil && time.Since(fetchedAt) < versionCatalogTTL {
+		return known, releases, nil
+	}
+
+	var manifest mojangVersionManifest
+	if err := buildResolver.getJSON(mojangManifestURL, &manifest); err != nil {
+		if known != nil {
+			return known, releases, nil
+		}
+		return nil, nil, fmt.Errorf("failed to fetch Minecraft versions: %v", err)
+	}
+
+	known = make(map[string]bool, len(manifest.Versions))
+	releases = nil
+	for _, version := range manifest.Versions {
+		known[version.ID] = true
+		if version.Type == "release" {
+			releases = append(releases, version.ID)
+		}
+	}
+
+	mc.mutex.Lock()
+	mc.known, mc.releases, mc.fetchedAt = known, releases, time.Now()
+	mc.mutex.Unlock()
+
+	return known, releases, nil
+}
+
+// Fabric's list of the game versions its loader supports
+var fabricGameVersionsURL = "https://meta.fabricmc.net/v2/versions/game"
+
+// upstreamVersionList caches the versions a server implementation's own API
+// publishes, newest first. It shares the Mojang catalog's TTL and keeps the
+// previous list when a refresh fails.
+type upstreamVersionList struct {
+	fetch func() ([]string, error)
+
+	mutex     sync.RWMutex
+	versions  []string
+	fetchedAt time.Time
+}
+
+func newUpstreamVersionList(fetch func() ([]string, error)) *upstreamVersionList {
+	return &upstreamVersionList{fetch: fetch}
+}
+
+func (ul *upstreamVersionList) get() ([]string, error) {
+	ul.mutex.RLock()
+	versions, fetchedAt := ul.versions, ul.fetchedAt
+	ul.mutex.RUnlock()
+
+	if versions != nil && time.Since(fetchedAt) < versionCatalogTTL {
+		return versions, nil
+	}
+
+	fetched, err := ul.fetch()
+	if err != nil {
+		if versions != nil {
+			return versions, nil
+		}
+		return nil, err
+	}
+
+	ul.mutex.Lock()
+	ul.versions, ul.fetchedAt = fetched, time.Now()
+	ul.mutex.Unlock()
+
+	return fetched, nil
+}
+
+// mojangReleasesSince returns the Mojang releases from minVersion onwards
+func mojangReleasesSince(minVersion string) func() ([]string, error) {
+	return func() ([]string, error) {
+		_, releases, err := mojangVersions.versions()
+		if err != nil {
+			return nil, err
+		}
+
+		var versions []string
+		for _, release := range releases {
+			if compareMinecraftVersions(release, minVersion) >= 0 {
+				versions = append(versions, release)
+			}
+		}
+		return versions, nil
+	}
+}
+
+// fetchPaperVersions lists the versions Paper builds exist for
+func fetchPaperVersions() ([]string, error) {
+	var project struct {
+		Versions []string `json:"versions"`
+	}
+	if err := buildResolver.getJSON(paperAPIBase+"/projects/paper", &project); err != nil {
+		return nil, fmt.Errorf("failed to fetch paper versions: %v", err)
+	}
+	return newestFirst(project.Versions), nil
+}
+
+// fetchPurpurVersions lists the versions Purpur builds exist for
+func fetchPurpurVersions() ([]string, error) {
+	var project struct {
+		Versions []string `json:"versions"`
+	}
+	if err := buildResolver.getJSON(purpurAPIBase+"/purpur", &project); err != nil {
+		return nil, fmt.Errorf("failed to fetch purpur versions: %v", err)
+	}
+	return newestFirst(project.Versions), nil
+}
+
+// fetchFabricVersions lists the stable game versions the Fabric loader
+// supports
+func fetchFabricVersions() ([]string, error) {
+	var gameVersions []struct {
+		Version string `json:"version"`
+		Stable  bool   `json:"stable"`
+	}
+	if err := buildResolver.getJSON(fabricGameVersionsURL, &gameVersions); err != nil {
+		return nil, fmt.Errorf("failed to fetch fabric versions: %v", err)
+	}
+
+	var versions []string
+	for _, gameVersion := range gameVersions {
+		if gameVersion.Stable {
+			versions = append(versions, gameVersion.Version)
+		}
+	}
+	return newestFirst(versions), nil
+}
+
+// fetchForgeVersions lists the Minecraft versions Forge has promoted builds
+// for
+func fetchForgeVersions() ([]string, error) {
+	promotions, err := fetchForgePromotions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch forge versions: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	var versions []string
+	for key := range promotions {
+		version := strings.TrimSuffix(strings.TrimSuffix(key, "-recommended"), "-latest")
+		if !seen[version] {
+			seen[version] = true
+			versions = append(versions, version)
+		}
+	}
+	return newestFirst(versions), nil
+}
+
+// newestFirst sorts Minecraft versions from the newest to the oldest
+func newestFirst(versions []string) []string {
+	sorted := append([]string(nil), versions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compareMinecraftVersions(sorted[i], sorted[j]) > 0
+	})
+	return sorted
+}
+
+// compareMinecraftVersions orders two release numbers such as 1.8.9 and
+// 1.21; it returns -1, 0 or 1
+func compareMinecraftVersions(a, b string) int {
+	aMinor, aPatch := parseMinecraftVersion(a)
+	bMinor, bPatch := parseMinecraftVersion(b)
+
+	switch {
+	case aMinor != bMinor:
+		if aMinor < bMinor {
+			return -1
+		}
+		return 1
+	case aPatch != bPatch:
+		if aPatch < bPatch {
+			return -1
+		}
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"playpulse-panel/models"
+)
+
+func TestMojangVersionCatalogCaches(t *testing.T) {
+	var requests, failing atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() != 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(recordedMojangManifest))
+	}))
+	defer api.Close()
+
+	useRecordedVersions(t)
+	mojangManifestURL = api.URL
+
+	// A bogus version is rejected and a real one passes, from one fetch
+	if err := ValidateServerVersion(models.ServerTypeVanilla, "1.99.9"); err == nil {
+		t.Error("a version Mojang doesn't list was accepted")
+	}
+	for _, version := range []string{"1.20.4", "24w14a", "b1.7.3"} {
+		if err := ValidateServerVersion(models.ServerTypeVanilla, version); err != nil {
+			t.Errorf("vanilla %s: %v, want a known Mojang version accepted", version, err)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("the manifest was fetched %d times, want once", n)
+	}
+
+	// Once stale a failed refresh keeps the previous list
+	mojangVersions.fetchedAt = time.Now().Add(-2 * versionCatalogTTL)
+	failing.Store(1)
+	known, releases, err := mojangVersions.versions()
+	if err != nil || !known["1.20.4"] {
+		t.Fatalf("versions after a failed refresh = %v, %v, want the previous list", known, err)
+	}
+	if got := strings.Join(releases, ","); got != "1.20.4,1.20.1,1.8.9,1.7.10" {
+		t.Errorf("releases = %s, want the previous releases", got)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("the manifest was fetched %d times, want a refresh once stale", n)
+	}
+
+	// With nothing fetched yet a failure is reported
+	mojangVersions = &mojangVersionCatalog{}
+	if _, _, err := mojangVersions.versions(); err == nil {
+		t.Error("versions with the manifest unavailable and nothing cached succeeded")
+	}
+}
+
+func TestCompareMinecraftVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.8.9", "1.21", -1},
+		{"1.20.4", "1.20.1", 1},
+		{"1.20", "1.20.0", 0},
+		{"1.9", "1.10", -1},
+	}
+	for _, tt := range tests {
+		if got := compareMinecraftVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareMinecraftVersions(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	if got := strings.Join(newestFirst([]string{"1.9", "1.20.4", "1.10", "1.20"}), ","); got != "1.20.4,1.20,1.10,1.9" {
+		t.Errorf("newestFirst = %s, want 1.20.4,1.20,1.10,1.9", got)
+	}
+}
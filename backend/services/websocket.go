@@ -1,7 +1,7 @@
 package services
 
 import (
-	"encoding/json"
+	"context"
 	"log"
 	"sync"
 	"time"
@@ -13,14 +13,118 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	// wsSendBuffer is how many messages may queue for a client before it is
+	// considered too slow and disconnected
+	wsSendBuffer = 256
+	// wsWriteTimeout bounds a single write to a client
+	wsWriteTimeout = 10 * time.Second
+)
+
 // WebSocketManager manages WebSocket connections
 type WebSocketManager struct {
-	connections map[string]*websocket.Conn
+	connections map[string]*wsClient
 	mutex       sync.RWMutex
+	closing     bool // set by CloseWebSockets; new connections are refused
 }
 
 var wsManager = &WebSocketManager{
-	connections: make(map[string]*websocket.Conn),
+	connections: make(map[string]*wsClient),
+}
+
+// wsClient is one WebSocket connection. Messages are queued on send and
+// written by the client's own writer goroutine, so a slow client never holds
+// up broadcasts to the others.
+type wsClient struct {
+	conn      *websocket.Conn
+	userID    uuid.UUID // authenticated user of the connection
+	send      chan WebSocketMessage
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// servers whose console the connection subscribed to, each checked
+	// for the console permission when subscribing
+	subscriptions map[uuid.UUID]bool
+	subMutex      sync.RWMutex
+}
+
+func newWSClient(conn *websocket.Conn, userID uuid.UUID) *wsClient {
+	return &wsClient{
+		conn:   conn,
+		userID: userID,
+		send:   make(chan WebSocketMessage, wsSendBuffer),
+		done:   make(chan struct{}),
+
+		subscriptions: make(map[uuid.UUID]bool),
+	}
+}
+
+// subscribe adds a server to the connection's subscriptions
+func (c *wsClient) subscribe(serverID uuid.UUID) {
+	c.subMutex.Lock()
+	defer c.subMutex.Unlock()
+	c.subscriptions[serverID] = true
+}
+
+// unsubscribe removes a server from the connection's subscriptions
+func (c *wsClient) unsubscribe(serverID uuid.UUID) {
+	c.subMutex.Lock()
+	defer c.subMutex.Unlock()
+	delete(c.subscriptions, serverID)
+}
+
+// subscribed reports whether the connection subscribed to a server
+func (c *wsClient) subscribed(serverID uuid.UUID) bool {
+	c.subMutex.RLock()
+	defer c.subMutex.RUnlock()
+	return c.subscriptions[serverID]
+}
+
+// enqueue queues a message without blocking. A client whose queue is full is
+// disconnected; it reports whether the message was queued.
+func (c *wsClient) enqueue(message WebSocketMessage) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- message:
+		return true
+	default:
+		log.Printf("WebSocket client of user %s is not keeping up, disconnecting it", c.userID)
+		c.close()
+		return false
+	}
+}
+
+// writePump writes queued messages until the client is closed or a write fails
+func (c *wsClient) writePump() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case message := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := c.conn.WriteJSON(message); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+// close stops the writer and closes the connection, which also ends the
+// connection's read loop and removes it from the manager
+func (c *wsClient) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		// fasthttp only closes a hijacked connection once its handler returns,
+		// so expire the read deadline to end the read loop right away
+		c.conn.SetReadDeadline(time.Now())
+		c.conn.Close()
+	})
 }
 
 // WebSocketMessage represents a WebSocket message
@@ -31,11 +135,16 @@ type WebSocketMessage struct {
 	Timestamp string      `json:"timestamp"`
 }
 
-// ConsoleMessage represents a console log message
+// ConsoleMessage represents a console log message. Line is the plain text;
+// Spans carries its colors and formatting when structured console output is
+// enabled and the line has any. Continuation marks lines that belong to the
+// previous message's block, such as the frames of a stack trace.
 type ConsoleMessage struct {
-	Line      string `json:"line"`
-	Timestamp string `json:"timestamp"`
-	Type      string `json:"type"` // "info", "warn", "error"
+	Line         string        `json:"line"`
+	Spans        []ConsoleSpan `json:"spans,omitempty"`
+	Timestamp    string        `json:"timestamp"`
+	Type         string        `json:"type"` // "info", "warn", "error"
+	Continuation bool          `json:"continuation,omitempty"`
 }
 
 // StatsMessage represents server statistics
@@ -59,18 +168,33 @@ type StatusMessage struct {
 // HandleWebSocket handles WebSocket connections
 func HandleWebSocket(c *websocket.Conn, userID uuid.UUID) {
 	connectionID := uuid.New().String()
-	
+	client := newWSClient(c, userID)
+
 	// Store connection
 	wsManager.mutex.Lock()
-	wsManager.connections[connectionID] = c
+	if wsManager.closing {
+		wsManager.mutex.Unlock()
+		c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(time.Second))
+		c.Close()
+		return
+	}
+	wsManager.connections[connectionID] = client
 	wsManager.mutex.Unlock()
-	
+
+	go client.writePump()
+
+	// Log tails followed by this connection
+	tails := make(map[uuid.UUID]context.CancelFunc)
+
 	// Clean up on disconnect
 	defer func() {
+		for _, cancel := range tails {
+			cancel()
+		}
 		wsManager.mutex.Lock()
 		delete(wsManager.connections, connectionID)
 		wsManager.mutex.Unlock()
-		c.Close()
+		client.close()
 	}()
 
 	// Send welcome message
@@ -81,7 +205,7 @@ func HandleWebSocket(c *websocket.Conn, userID uuid.UUID) {
 			"connection_id": connectionID,
 		},
 	}
-	c.WriteJSON(welcomeMsg)
+	client.enqueue(welcomeMsg)
 
 	// Handle incoming messages
 	for {
@@ -97,31 +221,45 @@ func HandleWebSocket(c *websocket.Conn, userID uuid.UUID) {
 		// Handle different message types
 		switch msg.Type {
 		case "subscribe_server":
-			handleServerSubscription(c, userID, msg)
+			handleServerSubscription(client, userID, msg)
 		case "unsubscribe_server":
-			handleServerUnsubscription(c, userID, msg)
+			handleServerUnsubscription(client, userID, msg)
 		case "send_command":
-			handleCommandMessage(c, userID, msg)
+			handleCommandMessage(client, userID, msg)
+		case "tail_server":
+			handleTailSubscription(client, userID, msg, tails)
+		case "untail_server":
+			handleTailUnsubscription(client, msg, tails)
 		case "ping":
-			handlePingMessage(c, msg)
+			handlePingMessage(client, msg)
 		}
 	}
 }
 
-// BroadcastServerLog broadcasts server log messages to subscribed clients
-func BroadcastServerLog(serverID uuid.UUID, logLine string) {
+// BroadcastServerLog broadcasts server log messages to subscribed clients.
+// The line's spans are left out unless console_structured_output is on.
+func BroadcastServerLog(serverID uuid.UUID, logLine ConsoleLine) {
+	console := ConsoleMessage{
+		Line:         logLine.Text,
+		Timestamp:    getCurrentTimestamp(),
+		Type:         logLine.Level,
+		Continuation: logLine.Continuation,
+	}
+	if console.Type == "" {
+		console.Type = ConsoleLevelInfo
+	}
+	if GetBool("console_structured_output", true) {
+		console.Spans = logLine.Spans
+	}
+
 	message := WebSocketMessage{
-		Type:     "console_log",
-		ServerID: serverID.String(),
-		Data: ConsoleMessage{
-			Line:      logLine,
-			Timestamp: getCurrentTimestamp(),
-			Type:      "info",
-		},
+		Type:      "console_log",
+		ServerID:  serverID.String(),
+		Data:      console,
 		Timestamp: getCurrentTimestamp(),
 	}
 
-	broadcastToServerSubscribers(serverID.String(), message)
+	broadcastToConsoleSubscribers(serverID, message)
 }
 
 // BroadcastServerStats broadcasts server statistics to subscribed clients
@@ -165,16 +303,60 @@ func BroadcastToAll(message WebSocketMessage) {
 	wsManager.mutex.RLock()
 	defer wsManager.mutex.RUnlock()
 
-	for _, conn := range wsManager.connections {
-		if err := conn.WriteJSON(message); err != nil {
-			log.Printf("Error broadcasting message: %v", err)
+	for _, client := range wsManager.connections {
+		client.enqueue(message)
+	}
+}
+
+// hasWebSocketClients reports whether any client is connected
+func hasWebSocketClients() bool {
+	wsManager.mutex.RLock()
+	defer wsManager.mutex.RUnlock()
+
+	return len(wsManager.connections) > 0
+}
+
+// PushNotification sends a new notification to every connection of its user
+func PushNotification(notification *models.Notification) {
+	message := WebSocketMessage{
+		Type:      "notification",
+		Data:      notification,
+		Timestamp: getCurrentTimestamp(),
+	}
+	if notification.ServerID != nil {
+		message.ServerID = notification.ServerID.String()
+	}
+
+	wsManager.mutex.RLock()
+	defer wsManager.mutex.RUnlock()
+
+	for _, client := range wsManager.connections {
+		if client.userID == notification.UserID {
+			client.enqueue(message)
+		}
+	}
+}
+
+// CloseWebSockets sends a going-away close frame to every client and refuses
+// new connections. Clients then close their side, which ends their handlers.
+func CloseWebSockets() {
+	wsManager.mutex.Lock()
+	defer wsManager.mutex.Unlock()
+
+	wsManager.closing = true
+	closeFrame := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	deadline := time.Now().Add(time.Second)
+
+	for _, client := range wsManager.connections {
+		if err := client.conn.WriteControl(websocket.CloseMessage, closeFrame, deadline); err != nil {
+			client.close()
 		}
 	}
 }
 
 // Helper functions
 
-func handleServerSubscription(c *websocket.Conn, userID uuid.UUID, msg WebSocketMessage) {
+func handleServerSubscription(c *wsClient, userID uuid.UUID, msg WebSocketMessage) {
 	// Verify user has access to the server
 	serverIDStr, ok := msg.Data.(map[string]interface{})["server_id"].(string)
 	if !ok {
@@ -188,13 +370,13 @@ func handleServerSubscription(c *websocket.Conn, userID uuid.UUID, msg WebSocket
 		return
 	}
 
-	// Check if user has access to this server
-	if !userHasServerAccess(userID, serverID) {
+	// Check if user may see this server's console
+	if !userHasServerAccess(userID, serverID) || !userHasServerPermission(userID, serverID, models.ServerPermissionConsole) {
 		sendErrorMessage(c, "Access denied to server")
 		return
 	}
 
-	// Store subscription (you might want to track this per connection)
+	c.subscribe(serverID)
 	response := WebSocketMessage{
 		Type:     "subscribed",
 		ServerID: serverIDStr,
@@ -204,16 +386,23 @@ func handleServerSubscription(c *websocket.Conn, userID uuid.UUID, msg WebSocket
 		Timestamp: getCurrentTimestamp(),
 	}
 
-	c.WriteJSON(response)
+	c.enqueue(response)
 }
 
-func handleServerUnsubscription(c *websocket.Conn, userID uuid.UUID, msg WebSocketMessage) {
+func handleServerUnsubscription(c *wsClient, userID uuid.UUID, msg WebSocketMessage) {
 	serverIDStr, ok := msg.Data.(map[string]interface{})["server_id"].(string)
 	if !ok {
 		sendErrorMessage(c, "Invalid server ID")
 		return
 	}
 
+	serverID, err := uuid.Parse(serverIDStr)
+	if err != nil {
+		sendErrorMessage(c, "Invalid server ID format")
+		return
+	}
+	c.unsubscribe(serverID)
+
 	response := WebSocketMessage{
 		Type:     "unsubscribed",
 		ServerID: serverIDStr,
@@ -223,10 +412,10 @@ func handleServerUnsubscription(c *websocket.Conn, userID uuid.UUID, msg WebSock
 		Timestamp: getCurrentTimestamp(),
 	}
 
-	c.WriteJSON(response)
+	c.enqueue(response)
 }
 
-func handleCommandMessage(c *websocket.Conn, userID uuid.UUID, msg WebSocketMessage) {
+func handleCommandMessage(c *wsClient, userID uuid.UUID, msg WebSocketMessage) {
 	data, ok := msg.Data.(map[string]interface{})
 	if !ok {
 		sendErrorMessage(c, "Invalid command data")
@@ -251,8 +440,8 @@ func handleCommandMessage(c *websocket.Conn, userID uuid.UUID, msg WebSocketMess
 		return
 	}
 
-	// Check if user has access to this server
-	if !userHasServerAccess(userID, serverID) {
+	// Check if user may use this server's console
+	if !userHasServerAccess(userID, serverID) || !userHasServerPermission(userID, serverID, models.ServerPermissionConsole) {
 		sendErrorMessage(c, "Access denied to server")
 		return
 	}
@@ -268,6 +457,7 @@ func handleCommandMessage(c *websocket.Conn, userID uuid.UUID, msg WebSocketMess
 		sendErrorMessage(c, "Failed to send command: "+err.Error())
 		return
 	}
+	RecordCommand(server.ID, userID, command, "websocket")
 
 	// Send confirmation
 	response := WebSocketMessage{
@@ -280,10 +470,90 @@ func handleCommandMessage(c *websocket.Conn, userID uuid.UUID, msg WebSocketMess
 		Timestamp: getCurrentTimestamp(),
 	}
 
-	c.WriteJSON(response)
+	c.enqueue(response)
+}
+
+func handleTailSubscription(c *wsClient, userID uuid.UUID, msg WebSocketMessage, tails map[uuid.UUID]context.CancelFunc) {
+	data, ok := msg.Data.(map[string]interface{})
+	if !ok {
+		sendErrorMessage(c, "Invalid tail data")
+		return
+	}
+
+	serverIDStr, ok := data["server_id"].(string)
+	if !ok {
+		sendErrorMessage(c, "Invalid server ID")
+		return
+	}
+
+	serverID, err := uuid.Parse(serverIDStr)
+	if err != nil {
+		sendErrorMessage(c, "Invalid server ID format")
+		return
+	}
+
+	// Check if user may see this server's console
+	if !userHasServerAccess(userID, serverID) || !userHasServerPermission(userID, serverID, models.ServerPermissionConsole) {
+		sendErrorMessage(c, "Access denied to server")
+		return
+	}
+
+	var server models.Server
+	if err := database.DB.First(&server, serverID).Error; err != nil {
+		sendErrorMessage(c, "Server not found")
+		return
+	}
+
+	backfill := defaultTailBackfill
+	if lines, ok := data["lines"].(float64); ok && lines >= 0 {
+		backfill = int(lines)
+	}
+	if backfill > maxTailBackfill {
+		backfill = maxTailBackfill
+	}
+
+	// Replace an existing tail of the same server
+	if cancel, exists := tails[serverID]; exists {
+		cancel()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tails[serverID] = cancel
+	go followServerLog(ctx, c, &server, backfill)
+}
+
+func handleTailUnsubscription(c *wsClient, msg WebSocketMessage, tails map[uuid.UUID]context.CancelFunc) {
+	data, ok := msg.Data.(map[string]interface{})
+	if !ok {
+		sendErrorMessage(c, "Invalid tail data")
+		return
+	}
+
+	serverIDStr, _ := data["server_id"].(string)
+	serverID, err := uuid.Parse(serverIDStr)
+	if err != nil {
+		sendErrorMessage(c, "Invalid server ID format")
+		return
+	}
+
+	if cancel, exists := tails[serverID]; exists {
+		cancel()
+		delete(tails, serverID)
+	}
+
+	response := WebSocketMessage{
+		Type:     "untailed",
+		ServerID: serverIDStr,
+		Data: map[string]string{
+			"message": "Stopped following server log",
+		},
+		Timestamp: getCurrentTimestamp(),
+	}
+
+	c.enqueue(response)
 }
 
-func handlePingMessage(c *websocket.Conn, msg WebSocketMessage) {
+func handlePingMessage(c *wsClient, msg WebSocketMessage) {
 	response := WebSocketMessage{
 		Type: "pong",
 		Data: map[string]string{
@@ -292,10 +562,10 @@ func handlePingMessage(c *websocket.Conn, msg WebSocketMessage) {
 		Timestamp: getCurrentTimestamp(),
 	}
 
-	c.WriteJSON(response)
+	c.enqueue(response)
 }
 
-func sendErrorMessage(c *websocket.Conn, message string) {
+func sendErrorMessage(c *wsClient, message string) {
 	errorMsg := WebSocketMessage{
 		Type: "error",
 		Data: map[string]string{
@@ -304,7 +574,7 @@ func sendErrorMessage(c *websocket.Conn, message string) {
 		Timestamp: getCurrentTimestamp(),
 	}
 
-	c.WriteJSON(errorMsg)
+	c.enqueue(errorMsg)
 }
 
 func broadcastToServerSubscribers(serverID string, message WebSocketMessage) {
@@ -313,9 +583,20 @@ func broadcastToServerSubscribers(serverID string, message WebSocketMessage) {
 
 	// In a real implementation, you'd track which connections are subscribed to which servers
 	// For now, broadcast to all connections (they can filter on the client side)
-	for _, conn := range wsManager.connections {
-		if err := conn.WriteJSON(message); err != nil {
-			log.Printf("Error broadcasting server message: %v", err)
+	for _, client := range wsManager.connections {
+		client.enqueue(message)
+	}
+}
+
+// broadcastToConsoleSubscribers sends a server's console output only to the
+// connections subscribed to it, which needs the console permission
+func broadcastToConsoleSubscribers(serverID uuid.UUID, message WebSocketMessage) {
+	wsManager.mutex.RLock()
+	defer wsManager.mutex.RUnlock()
+
+	for _, client := range wsManager.connections {
+		if client.subscribed(serverID) {
+			client.enqueue(message)
 		}
 	}
 }
@@ -342,33 +623,14 @@ func userHasServerAccess(userID, serverID uuid.UUID) bool {
 	return false
 }
 
-func getCurrentTimestamp() string {
-	return time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+func userHasServerPermission(userID, serverID uuid.UUID, permission models.ServerPermission) bool {
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return false
+	}
+	return HasServerPermission(&user, serverID, permission)
 }
 
-// StartMetricsCollector starts the metrics collection goroutine
-func StartMetricsCollector() {
-	go func() {
-		ticker := time.NewTicker(30 * time.Second)
-		defer ticker.Stop()
-
-		for range ticker.C {
-			collectAndBroadcastMetrics()
-		}
-	}()
+func getCurrentTimestamp() string {
+	return time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
 }
-
-func collectAndBroadcastMetrics() {
-	var servers []models.Server
-	database.DB.Where("status = ?", models.ServerStatusRunning).Find(&servers)
-
-	for _, server := range servers {
-		stats, err := GetServerStats(&server)
-		if err != nil {
-			log.Printf("Error collecting stats for server %s: %v", server.Name, err)
-			continue
-		}
-
-		BroadcastServerStats(server.ID, stats)
-	}
-}
\ No newline at end of file
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	fiberws "github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+	gorillaws "github.com/gorilla/websocket"
+)
+
+// startTestWebSocketServer serves HandleWebSocket on a local port and
+// returns its URL
+func startTestWebSocketServer(t *testing.T) string {
+	t.Helper()
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/ws", fiberws.New(func(c *fiberws.Conn) {
+		HandleWebSocket(c, uuid.New())
+	}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+
+	return "ws://" + ln.Addr().String() + "/ws"
+}
+
+// dialTestWebSocket connects to the server and returns the connection with
+// the ID from its welcome message
+func dialTestWebSocket(t *testing.T, url string) (*gorillaws.Conn, string) {
+	t.Helper()
+
+	conn, _, err := gorillaws.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var welcome struct {
+		Type string `json:"type"`
+		Data struct {
+			ConnectionID string `json:"connection_id"`
+		} `json:"data"`
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&welcome); err != nil || welcome.Type != "welcome" {
+		t.Fatalf("welcome = %+v, %v", welcome, err)
+	}
+	conn.SetReadDeadline(time.Time{})
+	return conn, welcome.Data.ConnectionID
+}
+
+func wsConnected(connectionID string) bool {
+	wsManager.mutex.RLock()
+	defer wsManager.mutex.RUnlock()
+	_, ok := wsManager.connections[connectionID]
+	return ok
+}
+
+func TestStalledWebSocketClientIsDropped(t *testing.T) {
+	url := startTestWebSocketServer(t)
+	fast, fastID := dialTestWebSocket(t, url)
+	_, slowID := dialTestWebSocket(t, url) // never reads again
+
+	type broadcast struct {
+		Seq     int    `json:"seq"`
+		Padding string `json:"padding"`
+	}
+	received := make(chan int)
+	go func() {
+		for {
+			var message struct {
+				Data broadcast `json:"data"`
+			}
+			if err := fast.ReadJSON(&message); err != nil {
+				close(received)
+				return
+			}
+			received <- message.Data.Seq
+		}
+	}()
+
+	// Large messages fill the stalled client's socket buffers, after which
+	// its queue fills and it is disconnected. Each broadcast waits for the
+	// fast client, which must get every message in order meanwhile.
+	padding := strings.Repeat("x", 64<<10)
+	sent := 0
+	for ; sent < 2000 && wsConnected(slowID); sent++ {
+		BroadcastToAll(WebSocketMessage{Type: "test", Data: broadcast{Seq: sent, Padding: padding}})
+
+		select {
+		case seq, ok := <-received:
+			if !ok {
+				t.Fatalf("fast client disconnected after %d messages", sent)
+			}
+			if seq != sent {
+				t.Fatalf("fast client got message %d, want %d", seq, sent)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("fast client stopped receiving after %d messages; broadcasts blocked on the stalled client", sent)
+		}
+	}
+	if wsConnected(slowID) {
+		t.Fatalf("stalled client still connected after %d messages", sent)
+	}
+	if sent <= wsSendBuffer {
+		t.Errorf("stalled client dropped after %d messages, before its queue of %d filled", sent, wsSendBuffer)
+	}
+
+	// The fast client is unaffected
+	if !wsConnected(fastID) {
+		t.Fatal("fast client was disconnected")
+	}
+	BroadcastToAll(WebSocketMessage{Type: "test", Data: broadcast{Seq: sent}})
+	select {
+	case seq := <-received:
+		if seq != sent {
+			t.Errorf("fast client got message %d, want %d", seq, sent)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("fast client got nothing after the stalled client was dropped")
+	}
+}
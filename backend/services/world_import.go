@@ -0,0 +1,205 @@
+package services
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"playpulse-panel/models"
+	"playpulse-panel/utils"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrWorldMissingLevelDat is returned for an archive without a level.dat
+	ErrWorldMissingLevelDat = errors.New("archive does not contain a level.dat")
+	// ErrUnsafeArchivePath is returned for entries that would escape the world folder
+	ErrUnsafeArchivePath = errors.New("archive contains an unsafe path")
+	// ErrInvalidWorldName is returned for world folder names that are not plain names
+	ErrInvalidWorldName = errors.New("invalid world name")
+	// ErrWorldTooLarge is returned when the extracted world would exceed the disk limit
+	ErrWorldTooLarge = errors.New("world exceeds the server's disk limit")
+)
+
+var worldNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_\-. ]{0,63}$`)
+
+// ImportWorld replaces (or creates) the world folder worldName with the world
+// in a zip archive. The archive may hold the world at its root or in a single
+// folder; the shallowest level.dat marks the world root. The server must be
+// stopped, and a pre-import backup is taken first.
+func ImportWorld(server *models.Server, archivePath, worldName string) (*models.Backup, error) {
+	if server.Status != models.ServerStatusStopped && server.Status != models.ServerStatusCrashed {
+		return nil, ErrServerRunning
+	}
+
+	if worldName == "" {
+		worldName = "world"
+	}
+	if !worldNamePattern.MatchString(worldName) || strings.Contains(worldName, "..") {
+		return nil, ErrInvalidWorldName
+	}
+
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip archive: %v", err)
+	}
+	defer reader.Close()
+
+	root, err := validateWorldArchive(&reader.Reader, server.DiskLimit*1024*1024)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := backupService.createSnapshot(server, models.BackupTypePreImport, "pre-import",
+		fmt.Sprintf("Automatic snapshot taken before importing world %s", worldName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up server before import: %v", err)
+	}
+
+	// Extract inside the server directory so the final swap is a same-filesystem rename
+	tempDir := filepath.Join(server.Path, ".import-"+uuid.New().String())
+	if err := utils.CreateDirectory(tempDir); err != nil {
+		return snapshot, fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := extractWorld(&reader.Reader, root, tempDir); err != nil {
+		return snapshot, fmt.Errorf("failed to extract world: %v", err)
+	}
+
+	worldPath := filepath.Join(server.Path, worldName)
+	previousPath := worldPath + ".previous-" + time.Now().Format("20060102-150405")
+	hadWorld := utils.FileExists(worldPath)
+	if hadWorld {
+		if err := os.Rename(worldPath, previousPath); err != nil {
+			return snapshot, fmt.Errorf("failed to move current world: %v", err)
+		}
+	}
+
+	if err := os.Rename(tempDir, worldPath); err != nil {
+		if hadWorld {
+			os.Rename(previousPath, worldPath)
+		}
+		return snapshot, fmt.Errorf("failed to install world: %v", err)
+	}
+
+	// The pre-import snapshot holds the old world, so it can go
+	if hadWorld {
+		if err := os.RemoveAll(previousPath); err != nil {
+			return snapshot, fmt.Errorf("failed to remove previous world: %v", err)
+		}
+	}
+
+	return snapshot, nil
+}
+
+// validateWorldArchive checks every entry is a safe relative path and
+// returns the folder holding the shallowest level.dat. maxBytes of 0 skips
+// the size check.
+func validateWorldArchive(reader *zip.Reader, maxBytes int64) (string, error) {
+	root := ""
+	rootDepth := -1
+	var total uint64
+
+	for _, file := range reader.File {
+		name := file.Name
+		if strings.Contains(name, "\\") || path.IsAbs(name) || filepath.IsAbs(name) {
+			return "", fmt.Errorf("%w: %s", ErrUnsafeArchivePath, name)
+		}
+		for _, part := range strings.Split(name, "/") {
+			if part == ".." {
+				return "", fmt.Errorf("%w: %s", ErrUnsafeArchivePath, name)
+			}
+		}
+		if file.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("%w: symlink %s", ErrUnsafeArchivePath, name)
+		}
+
+		total += file.UncompressedSize64
+		if maxBytes > 0 && total > uint64(maxBytes) {
+			return "", ErrWorldTooLarge
+		}
+
+		if path.Base(name) == "level.dat" && !file.FileInfo().IsDir() {
+			depth := strings.Count(name, "/")
+			if rootDepth < 0 || depth < rootDepth {
+				root, rootDepth = path.Dir(name), depth
+			}
+		}
+	}
+
+	if rootDepth < 0 {
+		return "", ErrWorldMissingLevelDat
+	}
+	if root == "." {
+		root = ""
+	}
+	return root, nil
+}
+
+// extractWorld writes the entries under root into destDir, dropping the root prefix
+func extractWorld(reader *zip.Reader, root, destDir string) error {
+	prefix := ""
+	if root != "" {
+		prefix = root + "/"
+	}
+	cleanDest := filepath.Clean(destDir) + string(os.PathSeparator)
+
+	for _, file := range reader.File {
+		if !strings.HasPrefix(file.Name, prefix) {
+			continue
+		}
+		relative := strings.TrimPrefix(file.Name, prefix)
+		if relative == "" {
+			continue
+		}
+
+		target := filepath.Join(destDir, filepath.FromSlash(relative))
+		if !strings.HasPrefix(target, cleanDest) {
+			return fmt.Errorf("%w: %s", ErrUnsafeArchivePath, file.Name)
+		}
+
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := extractWorldFile(file, target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func extractWorldFile(file *zip.File, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	source, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	// Copy no more than the declared size so a lying header cannot fill the disk
+	_, err = io.Copy(out, io.LimitReader(source, int64(file.UncompressedSize64)))
+	return err
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"playpulse-panel/internal/testutil"
+	"playpulse-panel/models"
+)
+
+// writeTestZip writes a zip archive holding files, keyed by entry name, and
+// returns its path
+func writeTestZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	archivePath := filepath.Join(t.TempDir(), "world.zip")
+	out, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	writer := zip.NewWriter(out)
+	for name, content := range files {
+		entry, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := entry.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
+
+func TestImportWorldReplacesWorld(t *testing.T) {
+	testDB(t)
+	useTestBackupService(t)
+
+	server := testutil.CreateServer(t, &models.Server{})
+	oldWorld := filepath.Join(server.Path, "world")
+	if err := os.MkdirAll(filepath.Join(oldWorld, "region"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(oldWorld, "level.dat"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(oldWorld, "region", "r.0.0.mca"), []byte("old region"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The world sits in a folder inside the archive
+	archive := writeTestZip(t, map[string]string{
+		"Survival/level.dat":           "new",
+		"Survival/region/r.1.1.mca":    "new region",
+		"Survival/datapacks/readme.md": "hi",
+	})
+
+	snapshot, err := ImportWorld(server, archive, "")
+	if err != nil {
+		t.Fatalf("ImportWorld: %v", err)
+	}
+	if snapshot == nil || snapshot.Type != models.BackupTypePreImport || snapshot.Status != models.BackupStatusCompleted {
+		t.Errorf("snapshot = %+v, want a completed pre-import backup", snapshot)
+	}
+
+	for file, want := range map[string]string{
+		"level.dat":           "new",
+		"region/r.1.1.mca":    "new region",
+		"datapacks/readme.md": "hi",
+	} {
+		content, err := os.ReadFile(filepath.Join(oldWorld, filepath.FromSlash(file)))
+		if err != nil || string(content) != want {
+			t.Errorf("world/%s = %q, %v, want %q", file, content, err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(oldWorld, "region", "r.0.0.mca")); !os.IsNotExist(err) {
+		t.Error("a file of the replaced world is still there")
+	}
+
+	// Nothing is left behind next to the world
+	entries, _ := os.ReadDir(server.Path)
+	for _, entry := range entries {
+		if entry.Name() != "world" {
+			t.Errorf("%s left in the server directory after the import", entry.Name())
+		}
+	}
+}
+
+func TestImportWorldRejectsArchiveWithoutLevelDat(t *testing.T) {
+	server := &models.Server{Path: t.TempDir(), Status: models.ServerStatusStopped}
+	archive := writeTestZip(t, map[string]string{
+		"world/region/r.0.0.mca": "region",
+		"world/level.dat_old":    "not it",
+	})
+
+	if _, err := ImportWorld(server, archive, "world"); !errors.Is(err, ErrWorldMissingLevelDat) {
+		t.Errorf("ImportWorld = %v, want ErrWorldMissingLevelDat", err)
+	}
+	if entries, _ := os.ReadDir(server.Path); len(entries) != 0 {
+		t.Errorf("rejected import wrote %d entries to the server directory", len(entries))
+	}
+}
+
+func TestImportWorldRejectsZipSlip(t *testing.T) {
+	for _, name := range []string{
+		"../escape.txt",
+		"world/../../escape.txt",
+		"/etc/escape.txt",
+		`world\..\..\escape.txt`,
+	} {
+		parent := t.TempDir()
+		server := &models.Server{Path: filepath.Join(parent, "server"), Status: models.ServerStatusStopped}
+		if err := os.Mkdir(server.Path, 0755); err != nil {
+			t.Fatal(err)
+		}
+		archive := writeTestZip(t, map[string]string{
+			"world/level.dat": "level",
+			name:              "escaped",
+		})
+
+		if _, err := ImportWorld(server, archive, "world"); !errors.Is(err, ErrUnsafeArchivePath) {
+			t.Errorf("%s: ImportWorld = %v, want ErrUnsafeArchivePath", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(parent, "escape.txt")); !os.IsNotExist(err) {
+			t.Errorf("%s: file written outside the server directory", name)
+		}
+	}
+}
+
+func TestImportWorldChecksServerAndName(t *testing.T) {
+	archive := writeTestZip(t, map[string]string{"level.dat": "level"})
+
+	running := &models.Server{Path: t.TempDir(), Status: models.ServerStatusRunning}
+	if _, err := ImportWorld(running, archive, "world"); !errors.Is(err, ErrServerRunning) {
+		t.Errorf("import into a running server = %v, want ErrServerRunning", err)
+	}
+
+	stopped := &models.Server{Path: t.TempDir(), Status: models.ServerStatusStopped}
+	for _, name := range []string{"../world", "a/b", ".hidden", "world..old"} {
+		if _, err := ImportWorld(stopped, archive, name); !errors.Is(err, ErrInvalidWorldName) {
+			t.Errorf("world name %q: err = %v, want ErrInvalidWorldName", name, err)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package utils
+
+import "errors"
+
+// FreeDiskSpace is not supported on Windows; callers skip disk space checks
+// when it fails
+func FreeDiskSpace(path string) (uint64, error) {
+	return 0, errors.New("free disk space is not available on windows")
+}
@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"playpulse-panel/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Machine-readable error codes returned in the code field of API errors.
+// Clients should branch on these rather than on messages.
+const (
+	CodeBadRequest          = "bad_request"
+	CodeValidationFailed    = "validation_failed"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeNotFound            = "not_found"
+	CodeConflict            = "conflict"
+	CodeGone                = "gone"
+	CodePreconditionFailed  = "precondition_failed"
+	CodePaymentRequired     = "payment_required"
+	CodePayloadTooLarge     = "payload_too_large"
+	CodeIdempotencyMismatch = "idempotency_key_mismatch"
+	CodeRateLimited         = "rate_limited"
+	CodeInsufficientStorage = "insufficient_storage"
+	CodeInternal            = "internal_error"
+	CodeServiceUnavailable  = "service_unavailable"
+)
+
+// APIError is an error returned to API clients. Handlers can return one and
+// the error handler renders it; Summary is the short summary and Message the
+// detail, as in the rest of the API's error bodies.
+type APIError struct {
+	Status  int          `json:"-"`
+	Code    string       `json:"code"`
+	Summary string       `json:"error"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+	// Extra data about the error, such as the versions a server type
+	// supports when the requested one isn't among them
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// FieldError is a problem with one field of a request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// NewAPIError returns an API error with the given status and code
+func NewAPIError(status int, code, summary, message string) *APIError {
+	return &APIError{Status: status, Code: code, Summary: summary, Message: message}
+}
+
+// WithDetail adds key to the error's details and returns the error
+func (e *APIError) WithDetail(key string, value interface{}) *APIError {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
+
+// NewValidationError returns the error for a request body that failed
+// validation, listing each invalid field
+func NewValidationError(fields []FieldError) *APIError {
+	return &APIError{
+		Status:  fiber.StatusBadRequest,
+		Code:    CodeValidationFailed,
+		Summary: "Validation failed",
+		Message: "One or more fields are invalid",
+		Fields:  fields,
+	}
+}
+
+// CodeForStatus is the code used for an error that only has an HTTP status
+func CodeForStatus(status int) string {
+	switch status {
+	case fiber.StatusBadRequest, fiber.StatusUnprocessableEntity:
+		return CodeBadRequest
+	case fiber.StatusUnauthorized:
+		return CodeUnauthorized
+	case fiber.StatusForbidden:
+		return CodeForbidden
+	case fiber.StatusNotFound:
+		return CodeNotFound
+	case fiber.StatusConflict:
+		return CodeConflict
+	case fiber.StatusGone:
+		return CodeGone
+	case fiber.StatusPreconditionFailed:
+		return CodePreconditionFailed
+	case fiber.StatusPaymentRequired:
+		return CodePaymentRequired
+	case fiber.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case fiber.StatusTooManyRequests:
+		return CodeRateLimited
+	case fiber.StatusInsufficientStorage:
+		return CodeInsufficientStorage
+	case fiber.StatusServiceUnavailable:
+		return CodeServiceUnavailable
+	}
+	if status >= fiber.StatusInternalServerError {
+		return CodeInternal
+	}
+	return strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
+
+// SendAPIError writes err as the response, with the request details every
+// error body carries
+func SendAPIError(c *fiber.Ctx, err *APIError) error {
+	body := fiber.Map{
+		"error":      err.Summary,
+		"code":       err.Code,
+		"message":    err.Message,
+		"timestamp":  time.Now().UTC(),
+		"path":       c.Path(),
+		"method":     c.Method(),
+		"request_id": logger.RequestID(c),
+	}
+	if len(err.Fields) > 0 {
+		body["fields"] = err.Fields
+	}
+	if len(err.Details) > 0 {
+		body["details"] = err.Details
+	}
+	return c.Status(err.Status).JSON(body)
+}
+
+// WriteAPIError is SendAPIError for net/http handlers mounted with the
+// adaptor, which passes the request ID on as a context value
+func WriteAPIError(w http.ResponseWriter, r *http.Request, err *APIError) {
+	requestId, _ := r.Context().Value("requestId").(string)
+	body := map[string]interface{}{
+		"error":      err.Summary,
+		"code":       err.Code,
+		"message":    err.Message,
+		"timestamp":  time.Now().UTC(),
+		"path":       requestPath(r),
+		"method":     r.Method,
+		"request_id": requestId,
+	}
+	if len(err.Fields) > 0 {
+		body["fields"] = err.Fields
+	}
+	if len(err.Details) > 0 {
+		body["details"] = err.Details
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(err.Status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// WriteHTTPError writes an error with the status's standard text as its
+// summary through WriteAPIError
+func WriteHTTPError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	WriteAPIError(w, r, NewAPIError(status, CodeForStatus(status), http.StatusText(status), message))
+}
+
+// requestPath is the path the client requested. http.StripPrefix trims
+// r.URL.Path but leaves RequestURI as it was sent.
+func requestPath(r *http.Request) string {
+	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		return u.Path
+	}
+	return r.URL.Path
+}
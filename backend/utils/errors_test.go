@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestWriteAPIErrorMatchesSendAPIError(t *testing.T) {
+	apiErr := NewAPIError(fiber.StatusConflict, CodeConflict, "Port already in use", "Port 25565 is already used").
+		WithDetail("port", 25565)
+
+	app := fiber.New()
+	app.Post("/api/v1/servers", func(c *fiber.Ctx) error {
+		c.Locals("requestId", "req-1")
+		return SendAPIError(c, apiErr)
+	})
+	resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/api/v1/servers", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fiberBody map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&fiberBody); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mounted under a stripped prefix, as the marketplace routes are
+	handler := http.StripPrefix("/api/v1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteAPIError(w, r, apiErr)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/servers", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "requestId", "req-1"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != resp.StatusCode {
+		t.Errorf("status = %d, want %d", rec.Code, resp.StatusCode)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+	var httpBody map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&httpBody); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+
+	if len(httpBody) != len(fiberBody) {
+		t.Errorf("fields = %v, want those of SendAPIError %v", httpBody, fiberBody)
+	}
+	for key, want := range fiberBody {
+		if key == "timestamp" {
+			continue
+		}
+		got, _ := json.Marshal(httpBody[key])
+		wantJSON, _ := json.Marshal(want)
+		if string(got) != string(wantJSON) {
+			t.Errorf("%s = %s, want %s", key, got, wantJSON)
+		}
+	}
+}
+
+func TestWriteHTTPErrorUsesStatusCode(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteHTTPError(rec, httptest.NewRequest(http.MethodGet, "/items/x/download", nil), http.StatusPaymentRequired, "item must be purchased")
+
+	var body APIError
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusPaymentRequired || body.Code != CodePaymentRequired {
+		t.Errorf("got %d %q, want 402 %q", rec.Code, body.Code, CodePaymentRequired)
+	}
+	if body.Summary != "Payment Required" || body.Message != "item must be purchased" {
+		t.Errorf("body = %+v", body)
+	}
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// IsProcessRunning checks if a process is running
+func IsProcessRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	// Signal 0 performs the existence and permission checks without
+	// delivering a signal
+	if err := syscall.Kill(pid, 0); err != nil {
+		// EPERM means the process exists but belongs to another user
+		return errors.Is(err, syscall.EPERM)
+	}
+
+	return !isZombie(pid)
+}
+
+// isZombie reports whether the process has exited but not been reaped yet.
+// Only Linux exposes this through /proc, elsewhere it returns false.
+func isZombie(pid int) bool {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+
+	// The state follows the parenthesised command name, which may itself
+	// contain spaces or parentheses
+	stat := string(data)
+	end := strings.LastIndex(stat, ")")
+	if end == -1 || end+2 >= len(stat) {
+		return false
+	}
+
+	return stat[end+2] == 'Z'
+}
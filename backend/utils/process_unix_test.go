@@ -0,0 +1,54 @@
+//go:build !windows
+
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestIsProcessRunningFlipsOnExit(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot start sleep: %v", err)
+	}
+	pid := cmd.Process.Pid
+
+	if !IsProcessRunning(pid) {
+		t.Fatal("running child reported as not running")
+	}
+
+	if err := cmd.Process.Kill(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Until it is reaped the killed child is a zombie, which doesn't count
+	if runtime.GOOS == "linux" {
+		deadline := time.Now().Add(5 * time.Second)
+		for IsProcessRunning(pid) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if IsProcessRunning(pid) {
+			t.Error("killed but unreaped child reported as running")
+		}
+	}
+
+	cmd.Wait()
+	if IsProcessRunning(pid) {
+		t.Error("reaped child reported as running")
+	}
+}
+
+func TestIsProcessRunningInvalidPID(t *testing.T) {
+	for _, pid := range []int{0, -1} {
+		if IsProcessRunning(pid) {
+			t.Errorf("IsProcessRunning(%d) = true", pid)
+		}
+	}
+	if !IsProcessRunning(os.Getpid()) {
+		t.Error("the test process reported as not running")
+	}
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package utils
+
+import (
+	"os"
+)
+
+// IsProcessRunning checks if a process is running
+func IsProcessRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	// FindProcess opens a handle on Windows and fails for unknown PIDs
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+
+	return true
+}
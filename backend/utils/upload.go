@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// maxFormValueSize bounds the plain fields sent alongside an upload
+const maxFormValueSize = 64 << 10
+
+// ErrBodyTooLarge is returned by a streamed request body read past its cap
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// CappedBody is a streamed request body that fails reads once more than Max
+// bytes were read, so bodies without a Content-Length are capped too
+type CappedBody struct {
+	Body io.Reader
+	Max  int64
+	read int64
+}
+
+func (b *CappedBody) Read(p []byte) (int, error) {
+	n, err := b.Body.Read(p)
+	b.read += int64(n)
+	if b.read > b.Max {
+		return n, ErrBodyTooLarge
+	}
+	return n, err
+}
+
+// Close closes the underlying body
+func (b *CappedBody) Close() error {
+	if closer, ok := b.Body.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Upload is a file received by SaveUpload. Values holds the form's other
+// fields. The caller removes the file once done with it.
+type Upload struct {
+	Path     string
+	Filename string
+	Size     int64
+	Values   map[string]string
+}
+
+// SaveUpload streams the file in the multipart field to a new file in dir,
+// never holding more than a buffer of it in memory. Uploads over maxBytes
+// are refused with 413, before reading when the request declares its
+// length, and those that won't fit on the disk with 507. Errors are
+// *APIErrors for handlers to return as is.
+func SaveUpload(c *fiber.Ctx, field, dir string, maxBytes int64) (*Upload, error) {
+	length := int64(c.Request().Header.ContentLength())
+	if length > maxBytes {
+		return nil, uploadTooLarge(maxBytes)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	if err != nil || mediaType != fiber.MIMEMultipartForm || params["boundary"] == "" {
+		return nil, NewAPIError(fiber.StatusBadRequest, CodeBadRequest, "Invalid upload", "Uploads must be sent as multipart/form-data")
+	}
+
+	if err := CreateDirectory(dir); err != nil {
+		return nil, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Upload failed", "Unable to create the upload directory")
+	}
+	if err := CheckFreeSpace(dir, length); err != nil {
+		return nil, err
+	}
+
+	// Bodies are streamed when the server allows it; small ones may still
+	// have been read already
+	var body io.Reader = c.Context().RequestBodyStream()
+	if body == nil {
+		body = bytes.NewReader(c.Body())
+	}
+
+	upload := &Upload{Values: make(map[string]string)}
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, ErrBodyTooLarge) {
+			upload.remove()
+			return nil, uploadTooLarge(maxBytes)
+		}
+		if err != nil {
+			upload.remove()
+			return nil, NewAPIError(fiber.StatusBadRequest, CodeBadRequest, "Invalid upload", "The multipart body is malformed")
+		}
+
+		if part.FormName() == field && part.FileName() != "" && upload.Path == "" {
+			upload.Filename = filepath.Base(part.FileName())
+			upload.Path, upload.Size, err = writeUploadPart(part, dir, maxBytes)
+			part.Close()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if part.FileName() == "" {
+			value, _ := io.ReadAll(io.LimitReader(part, maxFormValueSize))
+			upload.Values[part.FormName()] = string(value)
+		}
+		part.Close()
+	}
+
+	if upload.Path == "" {
+		return nil, NewAPIError(fiber.StatusBadRequest, CodeBadRequest, "Missing upload",
+			fmt.Sprintf("Upload the file in the '%s' field", field))
+	}
+	return upload, nil
+}
+
+// writeUploadPart copies an uploaded file to dir, removing it again if it
+// goes over maxBytes
+func writeUploadPart(part io.Reader, dir string, maxBytes int64) (string, int64, error) {
+	path := filepath.Join(dir, "upload-"+uuid.New().String())
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", 0, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Upload failed", "Unable to store the upload")
+	}
+
+	size, err := io.Copy(file, io.LimitReader(part, maxBytes+1))
+	closeErr := file.Close()
+	switch {
+	case errors.Is(err, ErrBodyTooLarge):
+		os.Remove(path)
+		return "", 0, uploadTooLarge(maxBytes)
+	case err != nil || closeErr != nil:
+		os.Remove(path)
+		return "", 0, NewAPIError(fiber.StatusInternalServerError, CodeInternal, "Upload failed", "Unable to store the upload")
+	case size > maxBytes:
+		os.Remove(path)
+		return "", 0, uploadTooLarge(maxBytes)
+	}
+	return path, size, nil
+}
+
+// CheckFreeSpace refuses with 507 when needed bytes won't fit on the disk
+// holding path. Unknown sizes and disks whose free space can't be read pass.
+func CheckFreeSpace(path string, needed int64) error {
+	if needed <= 0 {
+		return nil
+	}
+	if free, err := FreeDiskSpace(path); err == nil && free < uint64(needed) {
+		return NewAPIError(fiber.StatusInsufficientStorage, CodeInsufficientStorage, "Not enough disk space",
+			fmt.Sprintf("The upload needs %s but only %s is free", FormatBytes(needed), FormatBytes(int64(free))))
+	}
+	return nil
+}
+
+// remove deletes a partly received upload
+func (u *Upload) remove() {
+	if u.Path != "" {
+		os.Remove(u.Path)
+	}
+}
+
+func uploadTooLarge(maxBytes int64) *APIError {
+	return NewAPIError(fiber.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Upload too large",
+		fmt.Sprintf("Uploads to this endpoint are limited to %s", FormatBytes(maxBytes)))
+}
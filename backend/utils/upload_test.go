@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newUploadApp serves SaveUpload of the "file" field into dir, capped at
+// maxBytes, answering with the upload. Request bodies are streamed, as in
+// the panel.
+func newUploadApp(dir string, maxBytes int64) *fiber.App {
+	app := fiber.New(fiber.Config{
+		BodyLimit:             1 << 20,
+		StreamRequestBody:     true,
+		DisableStartupMessage: true,
+	})
+	app.Post("/upload", func(c *fiber.Ctx) error {
+		upload, err := SaveUpload(c, "file", dir, maxBytes)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			return SendAPIError(c, apiErr)
+		}
+		if err != nil {
+			return err
+		}
+		return c.JSON(upload)
+	})
+	return app
+}
+
+// multipartBody builds a form with a file of size bytes in the "file" field
+// and the given values
+func multipartBody(t *testing.T, size int, values map[string]string) (*bytes.Buffer, string) {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range values {
+		writer.WriteField(name, value)
+	}
+	part, err := writer.CreateFormFile("file", "../../world.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(bytes.Repeat([]byte("w"), size))
+	writer.Close()
+	return &body, writer.FormDataContentType()
+}
+
+// dirEntries counts the files in dir
+func dirEntries(t *testing.T, dir string) int {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+func TestSaveUploadStoresFile(t *testing.T) {
+	dir := t.TempDir()
+	app := newUploadApp(dir, 1<<20)
+
+	body, contentType := multipartBody(t, 4096, map[string]string{"world_name": "survival"})
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set(fiber.HeaderContentType, contentType)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	var upload Upload
+	json.NewDecoder(resp.Body).Decode(&upload)
+	if upload.Filename != "world.zip" || upload.Size != 4096 || upload.Values["world_name"] != "survival" {
+		t.Errorf("upload = %+v, want world.zip of 4096 bytes with its world name", upload)
+	}
+	if info, err := os.Stat(upload.Path); err != nil || info.Size() != 4096 {
+		t.Errorf("stored upload = %v, %v, want 4096 bytes in %s", info, err, dir)
+	}
+}
+
+func TestSaveUploadRejectsOverLimit(t *testing.T) {
+	dir := t.TempDir()
+	app := newUploadApp(dir, 1024)
+
+	body, contentType := multipartBody(t, 4096, nil)
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set(fiber.HeaderContentType, contentType)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", resp.StatusCode)
+	}
+	var apiErr APIError
+	json.NewDecoder(resp.Body).Decode(&apiErr)
+	if apiErr.Code != CodePayloadTooLarge {
+		t.Errorf("code = %q, want %q", apiErr.Code, CodePayloadTooLarge)
+	}
+	if n := dirEntries(t, dir); n != 0 {
+		t.Errorf("%d files left behind by the refused upload", n)
+	}
+
+	// A form without the file field is refused too
+	body, contentType = multipartBody(t, 0, nil)
+	req = httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(bytes.ReplaceAll(body.Bytes(), []byte(`name="file"`), []byte(`name="other"`))))
+	req.Header.Set(fiber.HeaderContentType, contentType)
+	if resp, _ := app.Test(req, -1); resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("upload without the file field = %d, want 400", resp.StatusCode)
+	}
+}
+
+// listenUploadApp serves app on a real listener, since app.Test reads the
+// whole body before handling it, and returns the upload URL
+func listenUploadApp(t *testing.T, app *fiber.App) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+	return fmt.Sprintf("http://%s/upload", ln.Addr())
+}
+
+func TestSaveUploadRejectsUndeclaredOverLimit(t *testing.T) {
+	dir := t.TempDir()
+	app := newUploadApp(dir, 1024)
+	url := listenUploadApp(t, app)
+
+	// Without a length the limit is only found while writing the file
+	body, contentType := multipartBody(t, 64<<10, nil)
+	req, _ := http.NewRequest(http.MethodPost, url, io.MultiReader(body))
+	req.Header.Set(fiber.HeaderContentType, contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", resp.StatusCode)
+	}
+	if n := dirEntries(t, dir); n != 0 {
+		t.Errorf("%d files left behind by the refused upload", n)
+	}
+}
+
+func TestSaveUploadStreamsToDisk(t *testing.T) {
+	const size = 64 << 20
+	dir := t.TempDir()
+	app := newUploadApp(dir, 1<<30)
+
+	url := listenUploadApp(t, app)
+
+	// The body is written as it is sent, with no length, so neither side
+	// has to hold it
+	reader, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		part, _ := form.CreateFormFile("file", "world.zip")
+		chunk := bytes.Repeat([]byte("w"), 64<<10)
+		for written := 0; written < size; written += len(chunk) {
+			if _, err := part.Write(chunk); err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+		writer.CloseWithError(form.Close())
+	}()
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	resp, err := http.Post(url, form.FormDataContentType(), reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	runtime.ReadMemStats(&after)
+
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	var upload Upload
+	json.NewDecoder(resp.Body).Decode(&upload)
+	if info, err := os.Stat(upload.Path); err != nil || info.Size() != size {
+		t.Fatalf("stored upload = %v, %v, want %d bytes", info, err, size)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size/4 {
+		t.Errorf("allocated %s receiving a %s upload, want it streamed", FormatBytes(int64(allocated)), FormatBytes(size))
+	}
+}
@@ -2,7 +2,9 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base32"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -33,10 +35,13 @@ func CheckPasswordHash(password, hash string) bool {
 
 // GenerateJWT generates a JWT token for a user
 func GenerateJWT(userID uuid.UUID, secret string, expireHours int) (string, error) {
+	// jti keeps tokens issued in the same second distinct, so each session
+	// has its own token hash and can be revoked on its own
 	claims := jwt.MapClaims{
 		"user_id": userID.String(),
 		"exp":     time.Now().Add(time.Hour * time.Duration(expireHours)).Unix(),
 		"iat":     time.Now().Unix(),
+		"jti":     uuid.NewString(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -52,6 +57,12 @@ func GenerateRefreshToken() (string, error) {
 	return base32.StdEncoding.EncodeToString(bytes), nil
 }
 
+// HashToken returns the SHA-256 hex digest of a token for storage
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // Generate2FASecret generates a 2FA secret
 func Generate2FASecret() (string, error) {
 	bytes := make([]byte, 20)
@@ -166,22 +177,6 @@ func KillProcess(pid int) error {
 	return process.Kill()
 }
 
-// IsProcessRunning checks if a process is running
-func IsProcessRunning(pid int) bool {
-	if pid <= 0 {
-		return false
-	}
-	
-	process, err := os.FindProcess(pid)
-	if err != nil {
-		return false
-	}
-	
-	// Send signal 0 to check if process exists
-	err = process.Signal(os.Signal(nil))
-	return err == nil
-}
-
 // GetSystemMemory returns system memory information
 func GetSystemMemory() (int64, int64, error) {
 	// Read /proc/meminfo
@@ -237,15 +232,20 @@ func GetDiskUsage(path string) (int64, int64, error) {
 // FormatBytes formats bytes into human readable format
 func FormatBytes(bytes int64) string {
 	const unit = 1024
-	if bytes < unit {
+	units := []string{"K", "M", "G", "T", "P", "E"}
+
+	if bytes < unit && bytes > -unit {
 		return fmt.Sprintf("%d B", bytes)
 	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
+
+	value := float64(bytes) / unit
+	exp := 0
+	// Move up a unit once the value would round to 1024.0 in this one
+	for (value >= unit-0.05 || value <= -(unit-0.05)) && exp < len(units)-1 {
+		value /= unit
 		exp++
 	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+	return fmt.Sprintf("%.1f %sB", value, units[exp])
 }
 
 // SanitizeFilename removes dangerous characters from filename
@@ -300,40 +300,59 @@ func GenerateRandomString(length int) (string, error) {
 	return string(bytes), nil
 }
 
-// ParseJavaArgs parses Java arguments string into a slice
+// ParseJavaArgs splits a Java arguments string into a slice the way a shell
+// would: on unquoted whitespace, keeping quoted substrings together and
+// removing the quotes. A backslash escapes a quote, backslash or space,
+// except inside single quotes. -Dname="a b" becomes the argument -Dname=a b.
 func ParseJavaArgs(args string) []string {
-	if args == "" {
-		return []string{}
-	}
-	
-	// Split by spaces but preserve quoted strings
-	var result []string
+	result := []string{}
 	var current strings.Builder
-	inQuotes := false
-	
-	for i, char := range args {
-		switch char {
-		case '"':
-			inQuotes = !inQuotes
-		case ' ':
-			if !inQuotes {
-				if current.Len() > 0 {
-					result = append(result, current.String())
-					current.Reset()
-				}
-				continue
+	inToken := false // also true for an empty quoted argument like ""
+	var quote rune   // the open quote character, or 0
+	escaped := false
+
+	for _, char := range args {
+		switch {
+		case escaped:
+			// Only quotes, backslashes and whitespace are escapable so
+			// Windows paths like C:\java\bin keep their backslashes
+			if !strings.ContainsRune("\"'\\ \t", char) {
+				current.WriteRune('\\')
+			}
+			current.WriteRune(char)
+			escaped = false
+		case char == '\\' && quote != '\'':
+			escaped = true
+			inToken = true
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			} else {
+				current.WriteRune(char)
+			}
+		case char == '"' || char == '\'':
+			quote = char
+			inToken = true
+		case char == ' ' || char == '\t' || char == '\n' || char == '\r':
+			if inToken {
+				result = append(result, current.String())
+				current.Reset()
+				inToken = false
 			}
-			fallthrough
 		default:
 			current.WriteRune(char)
-		}
-		
-		// Add the last argument if we're at the end
-		if i == len(args)-1 && current.Len() > 0 {
-			result = append(result, current.String())
+			inToken = true
 		}
 	}
-	
+
+	// A trailing backslash is kept literally
+	if escaped {
+		current.WriteRune('\\')
+	}
+	if inToken {
+		result = append(result, current.String())
+	}
+
 	return result
 }
 
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseJavaArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args string
+		want []string
+	}{
+		{"empty", "", []string{}},
+		{"only whitespace", "  \t ", []string{}},
+		{"single", "-Xmx2G", []string{"-Xmx2G"}},
+		{"trailing spaces", "-Xms1G -Xmx2G   ", []string{"-Xms1G", "-Xmx2G"}},
+		{"runs of spaces", "  -Xms1G \t  -Xmx2G\n-server", []string{"-Xms1G", "-Xmx2G", "-server"}},
+		{"quoted value", `-Dname="a b" -jar`, []string{"-Dname=a b", "-jar"}},
+		{"single quotes", `-Dmotd='it''s "here"'`, []string{`-Dmotd=its "here"`}},
+		{"escaped quote", `-Dtitle=\"hi\"`, []string{`-Dtitle="hi"`}},
+		{"escaped quote inside quotes", `"-Dsay=a \"b\" c"`, []string{`-Dsay=a "b" c`}},
+		{"escaped space", `-Dpath=/srv/my\ world`, []string{"-Dpath=/srv/my world"}},
+		{"windows path", `-Djava.home=C:\java\bin`, []string{`-Djava.home=C:\java\bin`}},
+		{"backslash in single quotes", `'a\b'`, []string{`a\b`}},
+		{"empty quoted argument", `-a "" -b`, []string{"-a", "", "-b"}},
+		{"trailing backslash", `-Dx=y\`, []string{`-Dx=y\`}},
+	}
+
+	for _, tt := range tests {
+		if got := ParseJavaArgs(tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ParseJavaArgs(%q) = %q, want %q", tt.name, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		want  string
+	}{
+		{0, "0 B"},
+		{1, "1 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KB"},
+		{1536, "1.5 KB"},
+		{10 * 1024, "10.0 KB"},
+		{1023 * 1024, "1023.0 KB"},
+		{1<<20 - 1, "1.0 MB"}, // would round to 1024.0 KB
+		{1 << 20, "1.0 MB"},
+		{5<<30 + 1<<29, "5.5 GB"},
+		{1 << 40, "1.0 TB"},
+		{1 << 50, "1.0 PB"},
+		{1 << 60, "1.0 EB"},
+		{math.MaxInt64, "8.0 EB"}, // no unit past exabytes
+		{-1023, "-1023 B"},
+		{-1024, "-1.0 KB"},
+		{math.MinInt64, "-8.0 EB"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatBytes(tt.bytes); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.bytes, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// validate checks request bodies against their validate tags. Fields are
+// reported by their JSON names so errors match what the client sent.
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	// maxbytes limits a string's length in bytes rather than characters,
+	// e.g. passwords, which bcrypt truncates after 72 bytes
+	v.RegisterValidation("maxbytes", func(fl validator.FieldLevel) bool {
+		limit, err := strconv.Atoi(fl.Param())
+		return err == nil && len(fl.Field().String()) <= limit
+	})
+	return v
+}
+
+// ParseBody parses the request body into out and validates it. It returns an
+// *APIError for a malformed body or invalid fields, which handlers return
+// as is for the error handler to render.
+func ParseBody(c *fiber.Ctx, out interface{}) error {
+	if err := c.BodyParser(out); err != nil {
+		return NewAPIError(fiber.StatusBadRequest, CodeBadRequest, "Invalid request body", err.Error())
+	}
+	return ValidateStruct(out)
+}
+
+// ValidateStruct validates a struct against its validate tags, returning a
+// validation *APIError listing each invalid field
+func ValidateStruct(s interface{}) error {
+	err := validate.Struct(s)
+	if err == nil {
+		return nil
+	}
+
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return NewAPIError(fiber.StatusBadRequest, CodeBadRequest, "Invalid request body", err.Error())
+	}
+
+	fields := make([]FieldError, 0, len(invalid))
+	for _, fieldErr := range invalid {
+		fields = append(fields, FieldError{
+			Field:   fieldErr.Field(),
+			Rule:    fieldErr.Tag(),
+			Message: fieldErrorMessage(fieldErr),
+		})
+	}
+	return NewValidationError(fields)
+}
+
+// fieldErrorMessage describes a failed rule in words
+func fieldErrorMessage(fieldErr validator.FieldError) string {
+	name := fieldErr.Field()
+	isString := fieldErr.Kind() == reflect.String
+
+	switch fieldErr.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", name)
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address", name)
+	case "min":
+		if isString {
+			return fmt.Sprintf("%s must be at least %s characters", name, fieldErr.Param())
+		}
+		return fmt.Sprintf("%s must be at least %s", name, fieldErr.Param())
+	case "max":
+		if isString {
+			return fmt.Sprintf("%s must be at most %s characters", name, fieldErr.Param())
+		}
+		return fmt.Sprintf("%s must be at most %s", name, fieldErr.Param())
+	case "maxbytes":
+		return fmt.Sprintf("%s must be at most %s bytes", name, fieldErr.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", name, strings.ReplaceAll(fieldErr.Param(), " ", ", "))
+	}
+	return fmt.Sprintf("%s is invalid", name)
+}
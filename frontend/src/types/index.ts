@@ -68,6 +68,9 @@ export interface Server {
   auto_restart: boolean
   auto_start: boolean
   backup_enabled: boolean
+  backup_interval_minutes: number
+  backup_cron: string
+  backup_retention: number
   last_backup?: string
   pid: number
   created_at: string
@@ -240,10 +243,22 @@ export interface WebSocketMessage {
   timestamp: string
 }
 
+export interface ConsoleSpan {
+  text: string
+  color?: string
+  bold?: boolean
+  italic?: boolean
+  underline?: boolean
+  strikethrough?: boolean
+  obfuscated?: boolean
+}
+
 export interface ConsoleMessage {
   line: string
+  spans?: ConsoleSpan[]
   timestamp: string
   type: 'info' | 'warn' | 'error'
+  continuation?: boolean
 }
 
 export interface StatsMessage {
@@ -272,6 +287,7 @@ export interface Notification {
   type: NotificationType
   priority: NotificationPriority
   is_read: boolean
+  crash_report_id?: string
   created_at: string
   read_at?: string
 }
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -21,8 +22,10 @@ type MinecraftVersion struct {
 	Stable      bool      `json:"stable"`
 }
 
-// ServerType represents different server implementations
-type ServerType struct {
+// ServerImplementation describes a server software: the Minecraft versions
+// it is available for, the Java range it runs on and its features. Named so
+// it doesn't collide with the panel's models.ServerType enum.
+type ServerImplementation struct {
 	Name         string   `json:"name"`
 	DisplayName  string   `json:"displayName"`
 	Description  string   `json:"description"`
@@ -79,8 +82,8 @@ func (vm *VersionManager) GetAllVersions() ([]MinecraftVersion, error) {
 }
 
 // GetServerTypes returns all available server implementations
-func (vm *VersionManager) GetServerTypes() []ServerType {
-	return []ServerType{
+func (vm *VersionManager) GetServerTypes() []ServerImplementation {
+	return []ServerImplementation{
 		{
 			Name:        "vanilla",
 			DisplayName: "Vanilla",
@@ -194,6 +197,33 @@ func (vm *VersionManager) GetServerTypes() []ServerType {
 	}
 }
 
+// GetServerImplementation returns the implementation with the given name,
+// such as "paper" or "fabric"
+func (vm *VersionManager) GetServerImplementation(name string) (*ServerImplementation, error) {
+	for _, implementation := range vm.GetServerTypes() {
+		if implementation.Name == name {
+			return &implementation, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown server implementation %q", name)
+}
+
+// SupportsVersion reports whether the implementation is available for a
+// Minecraft version
+func (si *ServerImplementation) SupportsVersion(version string) bool {
+	for _, supported := range si.Versions {
+		if supported == version {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsJava reports whether the implementation runs on a Java major version
+func (si *ServerImplementation) SupportsJava(major int) bool {
+	return major >= si.JavaMin && (si.JavaMax == 0 || major <= si.JavaMax)
+}
+
 // GetLatestVersion returns the latest stable version
 func (vm *VersionManager) GetLatestVersion() (*MinecraftVersion, error) {
 	versions, err := vm.GetAllVersions()
@@ -248,23 +278,28 @@ func (vm *VersionManager) GetPopularVersions() []string {
 // getJavaVersion returns the recommended Java version for a Minecraft version
 func (vm *VersionManager) getJavaVersion(mcVersion string) int {
 	version := strings.TrimPrefix(mcVersion, "1.")
-	
-	// Parse major version number
-	if strings.Contains(version, ".") {
-		parts := strings.Split(version, ".")
-		if len(parts) > 0 {
-			switch parts[0] {
-			case "21", "20", "19", "18", "17":
-				return 17 // Java 17+ for modern versions
-			case "16", "15", "14", "13", "12":
-				return 11 // Java 11+ for these versions
-			default:
-				return 8 // Java 8 for older versions
-			}
-		}
+
+	// Parse major and patch version numbers; "1.21" has no patch
+	parts := strings.Split(version, ".")
+	minor, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 8 // Default to Java 8
+	}
+	patch := 0
+	if len(parts) > 1 {
+		patch, _ = strconv.Atoi(parts[1])
+	}
+
+	switch {
+	case minor > 20 || (minor == 20 && patch >= 5):
+		return 21 // Java 21+ from 1.20.5
+	case minor >= 17:
+		return 17 // Java 17+ for modern versions
+	case minor >= 12:
+		return 11 // Java 11+ for these versions
+	default:
+		return 8 // Java 8 for older versions
 	}
-	
-	return 8 // Default to Java 8
 }
 
 // DownloadServerJar downloads the server jar for a specific version and type
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dockerCommand builds a docker CLI invocation; a variable so it can be
+// pointed at a fake docker
+var dockerCommand = func(args ...string) *exec.Cmd {
+	return exec.Command("docker", args...)
+}
+
+// ServerStatus is the live state of a server container reported to the
+// control plane
+type ServerStatus struct {
+	ServerID     string    `json:"server_id"`
+	NodeID       string    `json:"node_id"`
+	Exists       bool      `json:"exists"`
+	Status       string    `json:"status"` // docker state: running, exited, restarting...
+	Running      bool      `json:"running"`
+	Health       string    `json:"health,omitempty"`
+	Image        string    `json:"image,omitempty"`
+	Ports        []int     `json:"ports,omitempty"`
+	StartedAt    time.Time `json:"started_at,omitempty"`
+	RestartCount int       `json:"restart_count"`
+	CPUPercent   float64   `json:"cpu_percent"`
+	MemoryUsage  int64     `json:"memory_usage"` // bytes
+	MemoryLimit  int64     `json:"memory_limit"` // bytes
+	NetworkIn    int64     `json:"network_in"`   // bytes
+	NetworkOut   int64     `json:"network_out"`  // bytes
+}
+
+// ServerUpdate changes a server container's memory limit or environment.
+// Environment entries are merged into the current ones; an empty value
+// removes the variable.
+type ServerUpdate struct {
+	ServerID    string            `json:"server_id"`
+	Memory      int64             `json:"memory"` // MB, 0 keeps the current limit
+	Environment map[string]string `json:"environment"`
+}
+
+// containerInspect is the part of docker inspect output the agent uses
+type containerInspect struct {
+	Name         string `json:"Name"`
+	RestartCount int    `json:"RestartCount"`
+	State        struct {
+		Status    string    `json:"Status"`
+		Running   bool      `json:"Running"`
+		StartedAt time.Time `json:"StartedAt"`
+		Health    *struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+	} `json:"State"`
+	Config struct {
+		Image      string   `json:"Image"`
+		Env        []string `json:"Env"`
+		Cmd        []string `json:"Cmd"`
+		Entrypoint []string `json:"Entrypoint"`
+		WorkingDir string   `json:"WorkingDir"`
+		User       string   `json:"User"`
+	} `json:"Config"`
+	HostConfig struct {
+		Memory        int64    `json:"Memory"`
+		MemorySwap    int64    `json:"MemorySwap"`
+		NanoCpus      int64    `json:"NanoCpus"`
+		CpuShares     int64    `json:"CpuShares"`
+		CpusetCpus    string   `json:"CpusetCpus"`
+		NetworkMode   string   `json:"NetworkMode"`
+		Binds         []string `json:"Binds"`
+		RestartPolicy struct {
+			Name string `json:"Name"`
+		} `json:"RestartPolicy"`
+		PortBindings map[string][]struct {
+			HostIP   string `json:"HostIp"`
+			HostPort string `json:"HostPort"`
+		} `json:"PortBindings"`
+		DeviceRequests []struct {
+			Driver    string   `json:"Driver"`
+			Count     int      `json:"Count"`
+			DeviceIDs []string `json:"DeviceIDs"`
+		} `json:"DeviceRequests"`
+	} `json:"HostConfig"`
+}
+
+// containerStats is one line of docker stats --format '{{json .}}'
+type containerStats struct {
+	Name     string `json:"Name"`
+	CPUPerc  string `json:"CPUPerc"`
+	MemUsage string `json:"MemUsage"`
+	NetIO    string `json:"NetIO"`
+}
+
+// usage parses the figures of a stats line. memoryLimit is 0 when docker
+// reports none.
+func (s containerStats) usage() (cpuPercent float64, memoryUsage, memoryLimit, networkIn, networkOut int64) {
+	cpuPercent, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s.CPUPerc), "%"), 64)
+	if used, limit, ok := strings.Cut(s.MemUsage, "/"); ok {
+		memoryUsage = parseDockerSize(used)
+		memoryLimit = parseDockerSize(limit)
+	}
+	if in, out, ok := strings.Cut(s.NetIO, "/"); ok {
+		networkIn = parseDockerSize(in)
+		networkOut = parseDockerSize(out)
+	}
+	return
+}
+
+// reportedServer is a server as listed in resource updates, in the control
+// plane's NodeServer form
+type reportedServer struct {
+	ID         string                  `json:"id"`
+	Name       string                  `json:"name"`
+	Type       string                  `json:"type"`
+	Status     string                  `json:"status"`
+	Port       int                     `json:"port"`
+	Players    int                     `json:"players"`
+	MaxPlayers int                     `json:"max_players"`
+	Resources  reportedServerResources `json:"resources"`
+	CreatedAt  time.Time               `json:"created_at"`
+}
+
+type reportedServerResources struct {
+	CPUUsage    float64 `json:"cpu_usage"`
+	MemoryUsage int64   `json:"memory_usage"`
+	MemoryLimit int64   `json:"memory_limit"`
+	NetworkIn   int64   `json:"network_in"`
+	NetworkOut  int64   `json:"network_out"`
+}
+
+func (agent *NodeAgent) getServerStatus(data interface{}) {
+	serverID := serverIDFromData(data)
+	if serverID == "" {
+		log.Printf("Invalid server ID")
+		return
+	}
+
+	status, err := inspectServer(serverID)
+	if err != nil {
+		agent.sendError("Failed to get server status", err)
+		return
+	}
+	status.NodeID = agent.ID
+
+	agent.sendMessage(Message{
+		Type:      "server_status",
+		Data:      status,
+		Timestamp: time.Now(),
+		NodeID:    agent.ID,
+	})
+}
+
+func (agent *NodeAgent) updateServer(data interface{}) {
+	var update ServerUpdate
+	if err := decodeMessageData(data, &update); err != nil || update.ServerID == "" {
+		log.Printf("Invalid server update data")
+		return
+	}
+
+	log.Printf("🔧 Updating server %s", update.ServerID)
+
+	if err := recreateServerContainer(update); err != nil {
+		agent.sendError("Failed to update server", err)
+		return
+	}
+
+	status, err := inspectServer(update.ServerID)
+	if err != nil {
+		agent.sendError("Failed to get server status", err)
+		return
+	}
+	status.NodeID = agent.ID
+
+	agent.sendMessage(Message{
+		Type:      "server_updated",
+		Data:      status,
+		Timestamp: time.Now(),
+		NodeID:    agent.ID,
+	})
+	log.Printf("✅ Server %s updated successfully", update.ServerID)
+}
+
+// inspectServer reads a container's state and, when it is running, its
+// resource usage. A missing container is reported with Exists false.
+func inspectServer(serverID string) (*ServerStatus, error) {
+	status := &ServerStatus{ServerID: serverID}
+
+	info, err := inspectContainer(serverID)
+	if err != nil {
+		if strings.Contains(err.Error(), "No such") {
+			status.Status = "missing"
+			return status, nil
+		}
+		return nil, err
+	}
+
+	status.Exists = true
+	status.Status = info.State.Status
+	status.Running = info.State.Running
+	status.Image = info.Config.Image
+	status.StartedAt = info.State.StartedAt
+	status.RestartCount = info.RestartCount
+	status.MemoryLimit = info.HostConfig.Memory
+	if info.State.Health != nil {
+		status.Health = info.State.Health.Status
+	}
+	for _, bindings := range info.HostConfig.PortBindings {
+		for _, binding := range bindings {
+			if port, err := strconv.Atoi(binding.HostPort); err == nil {
+				status.Ports = append(status.Ports, port)
+			}
+		}
+	}
+	sort.Ints(status.Ports)
+
+	if !status.Running {
+		return status, nil
+	}
+
+	output, err := dockerOutput("stats", "--no-stream", "--format", "{{json .}}", serverID)
+	if err != nil {
+		// State is still worth reporting without usage figures
+		log.Printf("Failed to read stats of %s: %v", serverID, err)
+		return status, nil
+	}
+
+	var stats containerStats
+	if err := json.Unmarshal(bytes.TrimSpace(output), &stats); err != nil {
+		log.Printf("Failed to parse stats of %s: %v", serverID, err)
+		return status, nil
+	}
+	var limit int64
+	status.CPUPercent, status.MemoryUsage, limit, status.NetworkIn, status.NetworkOut = stats.usage()
+	if limit > 0 {
+		status.MemoryLimit = limit
+	}
+
+	return status, nil
+}
+
+// listServers lists the node's game server containers with the usage of
+// the running ones, for the control plane's fleet view. Usage comes from a
+// single docker stats call for all containers.
+func listServers() ([]reportedServer, error) {
+	output, err := dockerOutput("ps", "--all", "--format", "{{.Names}}\t{{.Image}}\t{{.State}}\t{{.CreatedAt}}\t{{.Ports}}")
+	if err != nil {
+		return nil, err
+	}
+
+	servers := []reportedServer{}
+	running := false
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.SplitN(line, "\t", 5)
+		if len(fields) < 4 || !strings.HasPrefix(fields[1], serverImagePrefix) {
+			continue
+		}
+
+		server := reportedServer{
+			ID:     fields[0],
+			Name:   fields[0],
+			Type:   serverTypeFromImage(fields[1]),
+			Status: fields[2],
+		}
+		// docker prints e.g. 2024-01-02 15:04:05 +0000 UTC
+		server.CreatedAt, _ = time.Parse("2006-01-02 15:04:05 -0700 MST", fields[3])
+		if len(fields) == 5 {
+			server.Port = publishedPort(fields[4])
+		}
+		if server.Status == "running" {
+			running = true
+			if server.Port > 0 && isMinecraftType(server.Type) {
+				server.Players, server.MaxPlayers, _ = pingPlayers(server.Port)
+			}
+		}
+		servers = append(servers, server)
+	}
+
+	if !running {
+		return servers, nil
+	}
+
+	output, err = dockerOutput("stats", "--no-stream", "--format", "{{json .}}")
+	if err != nil {
+		// The list is still worth reporting without usage figures
+		log.Printf("Failed to read container stats: %v", err)
+		return servers, nil
+	}
+
+	usage := make(map[string]containerStats)
+	for _, line := range bytes.Split(bytes.TrimSpace(output), []byte("\n")) {
+		var stats containerStats
+		if err := json.Unmarshal(line, &stats); err == nil {
+			usage[stats.Name] = stats
+		}
+	}
+	for i := range servers {
+		if stats, ok := usage[servers[i].ID]; ok {
+			r := &servers[i].Resources
+			r.CPUUsage, r.MemoryUsage, r.MemoryLimit, r.NetworkIn, r.NetworkOut = stats.usage()
+		}
+	}
+
+	return servers, nil
+}
+
+// serverTypeFromImage returns the server type of an image the agent runs,
+// playpulse/minecraft-paper:latest being minecraft-paper
+func serverTypeFromImage(image string) string {
+	image = strings.TrimPrefix(image, serverImagePrefix)
+	if name, _, found := strings.Cut(image, ":"); found {
+		return name
+	}
+	return image
+}
+
+// publishedPort returns the first host port in docker ps's Ports column,
+// such as 0.0.0.0:25565->25565/tcp, or 0 when nothing is published
+func publishedPort(ports string) int {
+	for _, mapping := range strings.Split(ports, ",") {
+		host, _, found := strings.Cut(strings.TrimSpace(mapping), "->")
+		if !found {
+			continue
+		}
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			if port, err := strconv.Atoi(host[i+1:]); err == nil {
+				return port
+			}
+		}
+	}
+	return 0
+}
+
+// recreateServerContainer applies an update by creating a new container with
+// the same configuration, apart from what the update changes. The old
+// container is kept under another name until the new one exists, and
+// restored if creating it fails.
+func recreateServerContainer(update ServerUpdate) error {
+	info, err := inspectContainer(update.ServerID)
+	if err != nil {
+		return err
+	}
+
+	memory := info.HostConfig.Memory / (1024 * 1024)
+	if update.Memory > 0 {
+		memory = update.Memory
+	}
+	env := mergeEnvironment(info.Config.Env, update.Environment)
+
+	// A container left by an update that failed halfway would keep the name
+	// the old container is moved to
+	oldName := update.ServerID + "-old"
+	if _, err := dockerOutput("rm", "--force", oldName); err != nil && !strings.Contains(err.Error(), "No such container") {
+		return fmt.Errorf("failed to remove stale container %s: %v", oldName, err)
+	}
+
+	wasRunning := info.State.Running
+	if wasRunning {
+		if _, err := dockerOutput("stop", update.ServerID); err != nil {
+			return fmt.Errorf("failed to stop container: %v", err)
+		}
+	}
+
+	if _, err := dockerOutput("rename", update.ServerID, oldName); err != nil {
+		if wasRunning {
+			dockerOutput("start", update.ServerID)
+		}
+		return fmt.Errorf("failed to rename container: %v", err)
+	}
+
+	args := append([]string{"create", "--name", update.ServerID}, containerCreateArgs(info, memory, env)...)
+	if _, err := dockerOutput(args...); err != nil {
+		// Put the old container back as it was
+		dockerOutput("rename", oldName, update.ServerID)
+		if wasRunning {
+			dockerOutput("start", update.ServerID)
+		}
+		return fmt.Errorf("failed to create container: %v", err)
+	}
+
+	if wasRunning {
+		if _, err := dockerOutput("start", update.ServerID); err != nil {
+			return fmt.Errorf("failed to start updated container: %v", err)
+		}
+	}
+
+	if _, err := dockerOutput("rm", oldName); err != nil {
+		log.Printf("Failed to remove old container %s: %v", oldName, err)
+	}
+	return nil
+}
+
+// containerCreateArgs turns an inspected container back into docker create
+// arguments, with memory in MB and env replacing its own
+func containerCreateArgs(info *containerInspect, memory int64, env []string) []string {
+	var args []string
+	if memory > 0 {
+		args = append(args, "--memory", fmt.Sprintf("%dm", memory))
+		// A swap limit below the new memory limit would be rejected
+		if swap := info.HostConfig.MemorySwap; swap > 0 && swap >= memory*1024*1024 {
+			args = append(args, "--memory-swap", strconv.FormatInt(swap, 10))
+		}
+	}
+	if info.HostConfig.NanoCpus > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(float64(info.HostConfig.NanoCpus)/1e9, 'f', -1, 64))
+	}
+	if info.HostConfig.CpuShares > 0 {
+		args = append(args, "--cpu-shares", strconv.FormatInt(info.HostConfig.CpuShares, 10))
+	}
+	if info.HostConfig.CpusetCpus != "" {
+		args = append(args, "--cpuset-cpus", info.HostConfig.CpusetCpus)
+	}
+	if mode := info.HostConfig.NetworkMode; mode != "" && mode != "default" {
+		args = append(args, "--network", mode)
+	}
+	for _, request := range info.HostConfig.DeviceRequests {
+		switch {
+		case len(request.DeviceIDs) > 0:
+			args = append(args, "--gpus", fmt.Sprintf(`"device=%s"`, strings.Join(request.DeviceIDs, ",")))
+		case request.Count < 0:
+			args = append(args, "--gpus", "all")
+		case request.Count > 0:
+			args = append(args, "--gpus", strconv.Itoa(request.Count))
+		}
+	}
+	for containerPort, bindings := range info.HostConfig.PortBindings {
+		for _, binding := range bindings {
+			hostPort := binding.HostPort
+			if binding.HostIP != "" {
+				hostPort = binding.HostIP + ":" + hostPort
+			}
+			args = append(args, "-p", fmt.Sprintf("%s:%s", hostPort, containerPort))
+		}
+	}
+	for _, bind := range info.HostConfig.Binds {
+		args = append(args, "-v", bind)
+	}
+	for _, variable := range env {
+		args = append(args, "-e", variable)
+	}
+	if policy := info.HostConfig.RestartPolicy.Name; policy != "" && policy != "no" {
+		args = append(args, "--restart", policy)
+	}
+	if info.Config.WorkingDir != "" {
+		args = append(args, "-w", info.Config.WorkingDir)
+	}
+	if info.Config.User != "" {
+		args = append(args, "--user", info.Config.User)
+	}
+
+	// --entrypoint takes only the executable; its arguments go before Cmd
+	command := info.Config.Cmd
+	if len(info.Config.Entrypoint) > 0 {
+		args = append(args, "--entrypoint", info.Config.Entrypoint[0])
+		command = append(append([]string{}, info.Config.Entrypoint[1:]...), command...)
+	}
+
+	args = append(args, info.Config.Image)
+	return append(args, command...)
+}
+
+func inspectContainer(serverID string) (*containerInspect, error) {
+	output, err := dockerOutput("inspect", "--type", "container", serverID)
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []containerInspect
+	if err := json.Unmarshal(output, &containers); err != nil {
+		return nil, fmt.Errorf("failed to parse docker inspect output: %v", err)
+	}
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("No such container: %s", serverID)
+	}
+	return &containers[0], nil
+}
+
+// dockerOutput runs docker and returns its stdout, with stderr in the error
+func dockerOutput(args ...string) ([]byte, error) {
+	cmd := dockerCommand(args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("docker %s: %s", args[0], message)
+		}
+		return nil, fmt.Errorf("docker %s: %v", args[0], err)
+	}
+	return output, nil
+}
+
+// mergeEnvironment applies changes to KEY=value pairs, dropping keys set to ""
+func mergeEnvironment(current []string, changes map[string]string) []string {
+	values := make(map[string]string, len(current))
+	for _, variable := range current {
+		key, value, _ := strings.Cut(variable, "=")
+		values[key] = value
+	}
+	for key, value := range changes {
+		if value == "" {
+			delete(values, key)
+		} else {
+			values[key] = value
+		}
+	}
+
+	merged := make([]string, 0, len(values))
+	for key, value := range values {
+		merged = append(merged, key+"="+value)
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// parseDockerSize parses sizes as docker stats prints them, such as
+// "512MiB", "1.5GiB" or "3.2kB", into bytes
+func parseDockerSize(size string) int64 {
+	size = strings.TrimSpace(size)
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"kB", 1e3}, {"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"B", 1},
+	}
+
+	for _, unit := range units {
+		if strings.HasSuffix(size, unit.suffix) {
+			value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(size, unit.suffix)), 64)
+			if err != nil {
+				return 0
+			}
+			return int64(value * unit.multiplier)
+		}
+	}
+	return 0
+}
+
+// serverIDFromData accepts a bare server ID or an object with server_id
+func serverIDFromData(data interface{}) string {
+	if serverID, ok := data.(string); ok {
+		return serverID
+	}
+
+	var payload struct {
+		ServerID string `json:"server_id"`
+	}
+	if err := decodeMessageData(data, &payload); err != nil {
+		return ""
+	}
+	return payload.ServerID
+}
+
+// decodeMessageData converts a message's generically decoded data into target
+func decodeMessageData(data interface{}, target interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, target)
+}
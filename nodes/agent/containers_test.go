@@ -0,0 +1,281 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDocker answers docker commands from files in its directory: inspect
+// prints inspect.json, or fails like docker when it is missing, stats
+// prints stats.json and ps prints ps.txt. Other commands succeed unless fail-<command> exists,
+// whose content is printed as the error. Every call is logged to calls.
+const fakeDocker = `#!/bin/sh
+dir=$(dirname "$0")
+echo "$*" >> "$dir/calls"
+if [ -f "$dir/fail-$1" ]; then
+	cat "$dir/fail-$1" >&2
+	exit 1
+fi
+case "$1" in
+inspect)
+	if [ ! -f "$dir/inspect.json" ]; then
+		echo "Error: No such container: $4" >&2
+		exit 1
+	fi
+	cat "$dir/inspect.json"
+	;;
+stats)
+	cat "$dir/stats.json"
+	;;
+ps)
+	[ ! -f "$dir/ps.txt" ] || cat "$dir/ps.txt"
+	;;
+esac
+`
+
+// useFakeDocker points dockerCommand at fakeDocker and returns its directory
+func useFakeDocker(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake docker is a shell script")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "docker")
+	if err := os.WriteFile(path, []byte(fakeDocker), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := dockerCommand
+	dockerCommand = func(args ...string) *exec.Cmd { return exec.Command(path, args...) }
+	t.Cleanup(func() { dockerCommand = previous })
+	return dir
+}
+
+func writeDockerFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dockerCalls returns the docker commands run so far
+func dockerCalls(dir string) []string {
+	content, _ := os.ReadFile(filepath.Join(dir, "calls"))
+	return strings.Split(strings.TrimSpace(string(content)), "\n")
+}
+
+const runningInspect = `[{
+	"Name": "/srv-1",
+	"RestartCount": 2,
+	"State": {
+		"Status": "running",
+		"Running": true,
+		"StartedAt": "2026-03-10T12:00:00.5Z",
+		"Health": {"Status": "healthy"}
+	},
+	"Config": {
+		"Image": "playpulse/minecraft-paper:latest",
+		"Env": ["EULA=TRUE", "MEMORY=1G", "TYPE=PAPER"],
+		"Cmd": ["--nogui"],
+		"Entrypoint": ["/start", "--quiet"],
+		"WorkingDir": "/data",
+		"User": "1000"
+	},
+	"HostConfig": {
+		"Memory": 1073741824,
+		"MemorySwap": 2147483648,
+		"NanoCpus": 1500000000,
+		"NetworkMode": "playpulse",
+		"Binds": ["/srv/playpulse/srv-1:/data"],
+		"RestartPolicy": {"Name": "unless-stopped"},
+		"PortBindings": {"25565/tcp": [{"HostIp": "", "HostPort": "25570"}]},
+		"DeviceRequests": [{"Driver": "nvidia", "Count": -1}]
+	}
+}]`
+
+func TestInspectServerRunning(t *testing.T) {
+	dir := useFakeDocker(t)
+	writeDockerFile(t, dir, "inspect.json", runningInspect)
+	writeDockerFile(t, dir, "stats.json", `{"Name":"srv-1","CPUPerc":"12.50%","MemUsage":"768MiB / 1GiB","NetIO":"3.2kB / 1.5MB"}`+"\n")
+
+	status, err := inspectServer("srv-1")
+	if err != nil {
+		t.Fatalf("inspectServer: %v", err)
+	}
+
+	want := &ServerStatus{
+		ServerID:     "srv-1",
+		Exists:       true,
+		Status:       "running",
+		Running:      true,
+		Health:       "healthy",
+		Image:        "playpulse/minecraft-paper:latest",
+		Ports:        []int{25570},
+		StartedAt:    time.Date(2026, 3, 10, 12, 0, 0, 5e8, time.UTC),
+		RestartCount: 2,
+		CPUPercent:   12.5,
+		MemoryUsage:  768 << 20,
+		MemoryLimit:  1 << 30,
+		NetworkIn:    3200,
+		NetworkOut:   1500000,
+	}
+	if !status.StartedAt.Equal(want.StartedAt) {
+		t.Errorf("StartedAt = %s, want %s", status.StartedAt, want.StartedAt)
+	}
+	status.StartedAt = want.StartedAt
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("status = %+v, want %+v", status, want)
+	}
+}
+
+func TestInspectServerStoppedAndMissing(t *testing.T) {
+	dir := useFakeDocker(t)
+	writeDockerFile(t, dir, "inspect.json", `[{
+		"State": {"Status": "exited", "Running": false},
+		"Config": {"Image": "playpulse/minecraft-paper:latest"},
+		"HostConfig": {"Memory": 2147483648}
+	}]`)
+
+	status, err := inspectServer("srv-1")
+	if err != nil {
+		t.Fatalf("inspectServer: %v", err)
+	}
+	if !status.Exists || status.Running || status.Status != "exited" || status.MemoryLimit != 2<<30 || status.Health != "" {
+		t.Errorf("status = %+v, want an exited container with its configured limit", status)
+	}
+	if calls := dockerCalls(dir); len(calls) != 1 {
+		t.Errorf("docker calls = %q, want no stats for a stopped container", calls)
+	}
+
+	os.Remove(filepath.Join(dir, "inspect.json"))
+	status, err = inspectServer("srv-2")
+	if err != nil {
+		t.Fatalf("inspectServer of a missing container: %v", err)
+	}
+	if status.Exists || status.Status != "missing" {
+		t.Errorf("status = %+v, want a missing container", status)
+	}
+
+	writeDockerFile(t, dir, "fail-inspect", "Cannot connect to the Docker daemon")
+	if _, err := inspectServer("srv-1"); err == nil || !strings.Contains(err.Error(), "Cannot connect") {
+		t.Errorf("inspectServer without docker = %v, want docker's error", err)
+	}
+}
+
+func TestRecreateServerContainerAppliesUpdate(t *testing.T) {
+	dir := useFakeDocker(t)
+	writeDockerFile(t, dir, "inspect.json", runningInspect)
+
+	err := recreateServerContainer(ServerUpdate{
+		ServerID:    "srv-1",
+		Memory:      4096,
+		Environment: map[string]string{"MEMORY": "4G", "TYPE": "", "MOTD": "Hi"},
+	})
+	if err != nil {
+		t.Fatalf("recreateServerContainer: %v", err)
+	}
+
+	want := []string{
+		"inspect --type container srv-1",
+		"rm --force srv-1-old",
+		"stop srv-1",
+		"rename srv-1 srv-1-old",
+		// The 2G swap limit is under the new memory limit, so it is dropped
+		"create --name srv-1 --memory 4096m --cpus 1.5 --network playpulse --gpus all " +
+			"-p 25570:25565/tcp -v /srv/playpulse/srv-1:/data " +
+			"-e EULA=TRUE -e MEMORY=4G -e MOTD=Hi --restart unless-stopped -w /data --user 1000 " +
+			"--entrypoint /start playpulse/minecraft-paper:latest --quiet --nogui",
+		"start srv-1",
+		"rm srv-1-old",
+	}
+	if calls := dockerCalls(dir); !reflect.DeepEqual(calls, want) {
+		t.Errorf("docker calls:\n%s\nwant:\n%s", strings.Join(calls, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRecreateServerContainerRestoresOnFailure(t *testing.T) {
+	dir := useFakeDocker(t)
+	writeDockerFile(t, dir, "inspect.json", runningInspect)
+	writeDockerFile(t, dir, "fail-create", "Error: invalid memory limit")
+
+	err := recreateServerContainer(ServerUpdate{ServerID: "srv-1", Memory: 1})
+	if err == nil || !strings.Contains(err.Error(), "invalid memory limit") {
+		t.Fatalf("recreateServerContainer = %v, want the create error", err)
+	}
+
+	calls := dockerCalls(dir)
+	want := []string{"rename srv-1-old srv-1", "start srv-1"}
+	if len(calls) < 2 || !reflect.DeepEqual(calls[len(calls)-2:], want) {
+		t.Errorf("docker calls = %q, want the old container renamed back and started", calls)
+	}
+	for _, call := range calls {
+		if strings.HasPrefix(call, "rm srv-1-old") {
+			t.Error("the old container was removed after a failed update")
+		}
+	}
+}
+
+func TestRecreateServerContainerKeepsStoppedContainerStopped(t *testing.T) {
+	dir := useFakeDocker(t)
+	writeDockerFile(t, dir, "inspect.json", `[{
+		"State": {"Status": "exited"},
+		"Config": {"Image": "playpulse/minecraft-paper:latest", "Env": ["EULA=TRUE"]},
+		"HostConfig": {"Memory": 2147483648}
+	}]`)
+
+	if err := recreateServerContainer(ServerUpdate{ServerID: "srv-1", Environment: map[string]string{"EULA": "FALSE"}}); err != nil {
+		t.Fatalf("recreateServerContainer: %v", err)
+	}
+
+	want := []string{
+		"inspect --type container srv-1",
+		"rm --force srv-1-old",
+		"rename srv-1 srv-1-old",
+		"create --name srv-1 --memory 2048m -e EULA=FALSE playpulse/minecraft-paper:latest",
+		"rm srv-1-old",
+	}
+	if calls := dockerCalls(dir); !reflect.DeepEqual(calls, want) {
+		t.Errorf("docker calls:\n%s\nwant:\n%s", strings.Join(calls, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParseDockerSize(t *testing.T) {
+	tests := []struct {
+		size string
+		want int64
+	}{
+		{"512MiB", 512 << 20},
+		{" 1.5GiB ", 3 << 29},
+		{"3.2kB", 3200},
+		{"1.1MB", 1100000},
+		{"0B", 0},
+		{"12B", 12},
+		{"2TiB", 2 << 40},
+		{"", 0},
+		{"lots", 0},
+		{"xMiB", 0},
+	}
+	for _, tt := range tests {
+		if got := parseDockerSize(tt.size); got != tt.want {
+			t.Errorf("parseDockerSize(%q) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestMergeEnvironment(t *testing.T) {
+	got := mergeEnvironment(
+		[]string{"TYPE=PAPER", "MEMORY=1G", "JVM_OPTS=-Dfoo=bar"},
+		map[string]string{"MEMORY": "2G", "TYPE": "", "NEW": "1"},
+	)
+	want := []string{"JVM_OPTS=-Dfoo=bar", "MEMORY=2G", "NEW=1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeEnvironment = %q, want %q", got, want)
+	}
+}
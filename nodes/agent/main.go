@@ -7,8 +7,9 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
-	"runtime"
-	"syscall"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -31,6 +32,10 @@ type NodeAgent struct {
 	Capabilities []string  `json:"capabilities"`
 	Resources    Resources `json:"resources"`
 	conn         *websocket.Conn
+
+	// metricsInterval takes a new resource reporting interval from the
+	// control plane
+	metricsInterval chan time.Duration
 }
 
 type Resources struct {
@@ -79,11 +84,20 @@ type NetworkInterface struct {
 	Speed     uint64 `json:"speed"`
 }
 
+// resourceUpdate is the resource_update payload: the node's resources and
+// the servers on it
+type resourceUpdate struct {
+	Resources
+	Servers []reportedServer `json:"servers"`
+}
+
 type Message struct {
 	Type      string      `json:"type"`
 	Data      interface{} `json:"data"`
 	Timestamp time.Time   `json:"timestamp"`
 	NodeID    string      `json:"node_id"`
+	// CommandID is set on replies to a command
+	CommandID string `json:"command_id,omitempty"`
 }
 
 type Command struct {
@@ -99,6 +113,7 @@ type ServerDeployment struct {
 	Port        int               `json:"port"`
 	Memory      int64             `json:"memory"`
 	Environment map[string]string `json:"environment"`
+	GPU         bool              `json:"gpu"`
 }
 
 func main() {
@@ -109,6 +124,8 @@ func main() {
 		ControlPlane: getControlPlaneURL(),
 		Status:       "initializing",
 		Capabilities: getNodeCapabilities(),
+
+		metricsInterval: make(chan time.Duration, 1),
 	}
 
 	log.Printf("🚀 Playpulse Node Agent Starting")
@@ -166,10 +183,18 @@ func (agent *NodeAgent) connectToControlPlane() error {
 }
 
 func (agent *NodeAgent) startResourceMonitoring() {
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(getMetricsInterval())
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case interval := <-agent.metricsInterval:
+			log.Printf("Resource reporting interval set to %s", interval)
+			ticker.Reset(interval)
+			continue
+		case <-ticker.C:
+		}
+
 		resources, err := agent.collectResources()
 		if err != nil {
 			log.Printf("Error collecting resources: %v", err)
@@ -178,10 +203,20 @@ func (agent *NodeAgent) startResourceMonitoring() {
 
 		agent.Resources = resources
 
+		// Servers are sent along so the control plane knows what runs here;
+		// without a list it keeps the last one it was sent
+		servers, err := listServers()
+		if err != nil {
+			log.Printf("Error listing servers: %v", err)
+		}
+
 		// Send resource update to control plane
 		msg := Message{
-			Type:      "resource_update",
-			Data:      resources,
+			Type: "resource_update",
+			Data: resourceUpdate{
+				Resources: resources,
+				Servers:   servers,
+			},
 			Timestamp: time.Now(),
 			NodeID:    agent.ID,
 		}
@@ -277,8 +312,8 @@ func (agent *NodeAgent) collectResources() (Resources, error) {
 
 func (agent *NodeAgent) startCommandProcessor() {
 	for {
-		var msg Message
-		err := agent.conn.ReadJSON(&msg)
+		var cmd Command
+		err := agent.conn.ReadJSON(&cmd)
 		if err != nil {
 			log.Printf("Error reading message: %v", err)
 			// Attempt to reconnect
@@ -286,39 +321,40 @@ func (agent *NodeAgent) startCommandProcessor() {
 			continue
 		}
 
-		go agent.processCommand(msg)
+		go agent.processCommand(cmd)
 	}
 }
 
-func (agent *NodeAgent) processCommand(msg Message) {
-	switch msg.Type {
+func (agent *NodeAgent) processCommand(cmd Command) {
+	switch cmd.Type {
 	case "deploy_server":
-		agent.deployServer(msg.Data)
+		agent.deployServer(cmd.ID, cmd.Payload)
 	case "stop_server":
-		agent.stopServer(msg.Data)
+		agent.stopServer(cmd.Payload)
 	case "restart_server":
-		agent.restartServer(msg.Data)
+		agent.restartServer(cmd.Payload)
 	case "update_server":
-		agent.updateServer(msg.Data)
+		agent.updateServer(cmd.Payload)
 	case "get_server_status":
-		agent.getServerStatus(msg.Data)
+		agent.getServerStatus(cmd.Payload)
 	case "execute_command":
-		agent.executeCommand(msg.Data)
+		agent.executeCommand(cmd.Payload)
 	case "file_operation":
-		agent.handleFileOperation(msg.Data)
+		agent.handleFileOperation(cmd.Payload)
 	case "node_update":
-		agent.updateNode(msg.Data)
+		agent.updateNode(cmd.Payload)
 	case "health_check":
 		agent.respondHealthCheck()
 	default:
-		log.Printf("Unknown command type: %s", msg.Type)
+		log.Printf("Unknown command type: %s", cmd.Type)
 	}
 }
 
-func (agent *NodeAgent) deployServer(data interface{}) {
-	deployment, ok := data.(ServerDeployment)
-	if !ok {
+func (agent *NodeAgent) deployServer(commandID string, data interface{}) {
+	var deployment ServerDeployment
+	if err := decodeMessageData(data, &deployment); err != nil || deployment.ServerID == "" {
 		log.Printf("Invalid deployment data")
+		agent.sendCommandError(commandID, "Invalid deployment data", fmt.Errorf("missing server_id"))
 		return
 	}
 
@@ -327,25 +363,25 @@ func (agent *NodeAgent) deployServer(data interface{}) {
 	// Create server directory
 	serverPath := fmt.Sprintf("/opt/playpulse/servers/%s", deployment.ServerID)
 	if err := os.MkdirAll(serverPath, 0755); err != nil {
-		agent.sendError("Failed to create server directory", err)
+		agent.sendCommandError(commandID, "Failed to create server directory", err)
 		return
 	}
 
 	// Download server software based on type
 	if err := agent.downloadServerSoftware(deployment, serverPath); err != nil {
-		agent.sendError("Failed to download server software", err)
+		agent.sendCommandError(commandID, "Failed to download server software", err)
 		return
 	}
 
 	// Create Docker container for the server
 	if err := agent.createServerContainer(deployment, serverPath); err != nil {
-		agent.sendError("Failed to create server container", err)
+		agent.sendCommandError(commandID, "Failed to create server container", err)
 		return
 	}
 
 	// Start the server
 	if err := agent.startServerContainer(deployment.ServerID); err != nil {
-		agent.sendError("Failed to start server container", err)
+		agent.sendCommandError(commandID, "Failed to start server container", err)
 		return
 	}
 
@@ -359,6 +395,7 @@ func (agent *NodeAgent) deployServer(data interface{}) {
 		},
 		Timestamp: time.Now(),
 		NodeID:    agent.ID,
+		CommandID: commandID,
 	}
 
 	agent.sendMessage(response)
@@ -371,7 +408,18 @@ func (agent *NodeAgent) downloadServerSoftware(deployment ServerDeployment, serv
 
 	switch deployment.ServerType {
 	case "minecraft-paper":
-		downloadURL = fmt.Sprintf("https://papermc.io/api/v2/projects/paper/versions/%s/builds/latest/downloads/paper-%s-latest.jar", deployment.Version, deployment.Version)
+		url, err := resolvePaperDownloadURL(deployment.Version)
+		if err != nil {
+			return err
+		}
+		downloadURL = url
+		fileName = "server.jar"
+	case "minecraft-purpur":
+		url, err := resolvePurpurDownloadURL(deployment.Version)
+		if err != nil {
+			return err
+		}
+		downloadURL = url
 		fileName = "server.jar"
 	case "minecraft-fabric":
 		downloadURL = fmt.Sprintf("https://meta.fabricmc.net/v2/versions/loader/%s/stable/server/jar", deployment.Version)
@@ -398,48 +446,26 @@ func (agent *NodeAgent) downloadServerSoftware(deployment ServerDeployment, serv
 }
 
 func (agent *NodeAgent) createServerContainer(deployment ServerDeployment, serverPath string) error {
-	// Create Docker container configuration
-	containerConfig := map[string]interface{}{
-		"Image": getServerImage(deployment.ServerType),
-		"Cmd": []string{
-			"java",
-			fmt.Sprintf("-Xmx%dM", deployment.Memory),
-			"-jar",
-			"server.jar",
-			"nogui",
-		},
-		"WorkingDir": "/server",
-		"ExposedPorts": map[string]interface{}{
-			fmt.Sprintf("%d/tcp", deployment.Port): struct{}{},
-		},
-		"Env": buildEnvironmentVariables(deployment.Environment),
-		"HostConfig": map[string]interface{}{
-			"PortBindings": map[string]interface{}{
-				fmt.Sprintf("%d/tcp", deployment.Port): []map[string]interface{}{
-					{
-						"HostPort": fmt.Sprintf("%d", deployment.Port),
-					},
-				},
-			},
-			"Binds": []string{
-				fmt.Sprintf("%s:/server", serverPath),
-			},
-			"Memory":     deployment.Memory * 1024 * 1024, // Convert MB to bytes
-			"RestartPolicy": map[string]interface{}{
-				"Name": "unless-stopped",
-			},
-		},
+	// GPU images only help when this node actually has a GPU
+	useGPU := deployment.GPU && hasGPU()
+	if deployment.GPU && !useGPU {
+		log.Printf("Server %s asked for a GPU but none is available, using the standard image", deployment.ServerID)
 	}
 
-	// Create container using Docker API
-	cmd := exec.Command("docker", "create",
+	args := []string{"create",
 		"--name", deployment.ServerID,
 		"--memory", fmt.Sprintf("%dm", deployment.Memory),
 		"-p", fmt.Sprintf("%d:%d", deployment.Port, deployment.Port),
 		"-v", fmt.Sprintf("%s:/server", serverPath),
 		"--restart", "unless-stopped",
-		getServerImage(deployment.ServerType),
-	)
+	}
+	if useGPU {
+		args = append(args, "--gpus", "all")
+	}
+	args = append(args, getServerImage(deployment.ServerType, useGPU))
+
+	// Create container using Docker API
+	cmd := exec.Command("docker", args...)
 
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to create container: %v", err)
@@ -527,17 +553,8 @@ func (agent *NodeAgent) startHealthCheckServer() {
 		json.NewEncoder(w).Encode(healthStatus)
 	})
 
-	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
-		// Prometheus metrics endpoint
-		w.Header().Set("Content-Type", "text/plain")
-		fmt.Fprintf(w, "# HELP node_cpu_usage_percent CPU usage percentage\n")
-		fmt.Fprintf(w, "# TYPE node_cpu_usage_percent gauge\n")
-		fmt.Fprintf(w, "node_cpu_usage_percent{node_id=\"%s\"} %.2f\n", agent.ID, agent.Resources.CPU.UsagePercent)
-		
-		fmt.Fprintf(w, "# HELP node_memory_usage_percent Memory usage percentage\n")
-		fmt.Fprintf(w, "# TYPE node_memory_usage_percent gauge\n")
-		fmt.Fprintf(w, "node_memory_usage_percent{node_id=\"%s\"} %.2f\n", agent.ID, agent.Resources.Memory.UsagePercent)
-	})
+	// Prometheus metrics endpoint
+	http.HandleFunc("/metrics", agent.serveMetrics)
 
 	log.Printf("🏥 Health check server starting on :8090")
 	log.Fatal(http.ListenAndServe(":8090", nil))
@@ -551,6 +568,11 @@ func (agent *NodeAgent) sendMessage(msg Message) error {
 }
 
 func (agent *NodeAgent) sendError(message string, err error) {
+	agent.sendCommandError("", message, err)
+}
+
+// sendCommandError reports an error in reply to the command with the ID
+func (agent *NodeAgent) sendCommandError(commandID, message string, err error) {
 	errorMsg := Message{
 		Type: "error",
 		Data: map[string]interface{}{
@@ -559,6 +581,7 @@ func (agent *NodeAgent) sendError(message string, err error) {
 		},
 		Timestamp: time.Now(),
 		NodeID:    agent.ID,
+		CommandID: commandID,
 	}
 	agent.sendMessage(errorMsg)
 }
@@ -602,7 +625,37 @@ func getControlPlaneURL() string {
 	if url := os.Getenv("PLAYPULSE_CONTROL_PLANE"); url != "" {
 		return url
 	}
-	return "localhost:8080"
+	return "localhost:8081"
+}
+
+// getMetricsInterval is how often resources are reported, from
+// PLAYPULSE_METRICS_INTERVAL in seconds, 5 by default
+func getMetricsInterval() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("PLAYPULSE_METRICS_INTERVAL")); err == nil && seconds > 0 {
+		return clampMetricsInterval(time.Duration(seconds) * time.Second)
+	}
+	return 5 * time.Second
+}
+
+// clampMetricsInterval keeps a reporting interval between one second and an
+// hour
+func clampMetricsInterval(interval time.Duration) time.Duration {
+	if interval < time.Second {
+		return time.Second
+	}
+	if interval > time.Hour {
+		return time.Hour
+	}
+	return interval
+}
+
+// getServerHost is where the agent reaches the ports servers publish, from
+// PLAYPULSE_SERVER_HOST; an agent in a container sets it to the docker host
+func getServerHost() string {
+	if host := os.Getenv("PLAYPULSE_SERVER_HOST"); host != "" {
+		return host
+	}
+	return "127.0.0.1"
 }
 
 func getNodeToken() string {
@@ -624,23 +677,56 @@ func getNodeCapabilities() []string {
 	if _, err := exec.LookPath("python3"); err == nil {
 		capabilities = append(capabilities, "python")
 	}
+
+	if _, err := exec.LookPath("dotnet"); err == nil {
+		capabilities = append(capabilities, "dotnet")
+	}
+
+	if _, err := exec.LookPath("steamcmd"); err == nil {
+		capabilities = append(capabilities, "steamcmd")
+	}
+
+	if _, err := exec.LookPath("wine"); err == nil {
+		capabilities = append(capabilities, "wine")
+	}
+
+	if hasGPU() {
+		capabilities = append(capabilities, "gpu", "gpu-nvidia")
+	}
 	
 	return capabilities
 }
 
-func getServerImage(serverType string) string {
+// hasGPU reports whether nvidia-smi finds at least one GPU
+func hasGPU() bool {
+	if _, err := exec.LookPath("nvidia-smi"); err != nil {
+		return false
+	}
+
+	output, err := exec.Command("nvidia-smi", "-L").Output()
+	return err == nil && strings.Contains(string(output), "GPU ")
+}
+
+// getServerImage returns the container image of a server type, using its
+// GPU-enabled variant when gpu is set
+func getServerImage(serverType string, gpu bool) string {
 	images := map[string]string{
 		"minecraft-paper":  "playpulse/minecraft-paper:latest",
+		"minecraft-purpur": "playpulse/minecraft-purpur:latest",
 		"minecraft-fabric": "playpulse/minecraft-fabric:latest",
 		"minecraft-forge":  "playpulse/minecraft-forge:latest",
 		"valheim":         "playpulse/valheim:latest",
 		"rust":            "playpulse/rust:latest",
 	}
 	
-	if image, exists := images[serverType]; exists {
-		return image
+	image, exists := images[serverType]
+	if !exists {
+		image = "playpulse/generic:latest"
+	}
+	if gpu {
+		image = strings.TrimSuffix(image, ":latest") + ":latest-gpu"
 	}
-	return "playpulse/generic:latest"
+	return image
 }
 
 func buildEnvironmentVariables(env map[string]string) []string {
@@ -651,6 +737,120 @@ func buildEnvironmentVariables(env map[string]string) []string {
 	return envVars
 }
 
+// buildCacheTTL is how long a resolved download URL is reused before the
+// latest build is looked up again
+const buildCacheTTL = time.Hour
+
+// resolvedBuild is a cached download URL and when it was resolved
+type resolvedBuild struct {
+	url        string
+	resolvedAt time.Time
+}
+
+// resolvedBuilds caches concrete download URLs per project and version
+var (
+	resolvedBuilds      = make(map[string]resolvedBuild)
+	resolvedBuildsMutex sync.Mutex
+)
+
+func resolvePaperDownloadURL(version string) (string, error) {
+	return resolveBuildURL("paper:"+version, func() (string, error) {
+		var response struct {
+			Builds []struct {
+				Build     int    `json:"build"`
+				Channel   string `json:"channel"`
+				Downloads struct {
+					Application struct {
+						Name string `json:"name"`
+					} `json:"application"`
+				} `json:"downloads"`
+			} `json:"builds"`
+		}
+
+		url := fmt.Sprintf("https://api.papermc.io/v2/projects/paper/versions/%s/builds", version)
+		if err := getJSON(url, &response); err != nil {
+			return "", err
+		}
+
+		build, fileName := 0, ""
+		for _, b := range response.Builds {
+			if b.Channel != "" && b.Channel != "default" {
+				continue
+			}
+			if b.Build > build && b.Downloads.Application.Name != "" {
+				build, fileName = b.Build, b.Downloads.Application.Name
+			}
+		}
+
+		if build == 0 {
+			return "", fmt.Errorf("no stable paper build found for version %s", version)
+		}
+
+		return fmt.Sprintf("https://api.papermc.io/v2/projects/paper/versions/%s/builds/%d/downloads/%s", version, build, fileName), nil
+	})
+}
+
+func resolvePurpurDownloadURL(version string) (string, error) {
+	return resolveBuildURL("purpur:"+version, func() (string, error) {
+		var response struct {
+			Builds struct {
+				Latest string   `json:"latest"`
+				All    []string `json:"all"`
+			} `json:"builds"`
+		}
+
+		url := fmt.Sprintf("https://api.purpurmc.org/v2/purpur/%s", version)
+		if err := getJSON(url, &response); err != nil {
+			return "", err
+		}
+
+		build := 0
+		for _, candidate := range append([]string{response.Builds.Latest}, response.Builds.All...) {
+			if number, err := strconv.Atoi(candidate); err == nil && number > build {
+				build = number
+			}
+		}
+
+		if build == 0 {
+			return "", fmt.Errorf("no purpur build found for version %s", version)
+		}
+
+		return fmt.Sprintf("https://api.purpurmc.org/v2/purpur/%s/%d/download", version, build), nil
+	})
+}
+
+func resolveBuildURL(key string, resolve func() (string, error)) (string, error) {
+	resolvedBuildsMutex.Lock()
+	defer resolvedBuildsMutex.Unlock()
+
+	if cached, exists := resolvedBuilds[key]; exists && time.Since(cached.resolvedAt) < buildCacheTTL {
+		return cached.url, nil
+	}
+
+	url, err := resolve()
+	if err != nil {
+		return "", err
+	}
+
+	resolvedBuilds[key] = resolvedBuild{url: url, resolvedAt: time.Now()}
+	return url, nil
+}
+
+func getJSON(url string, target interface{}) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response from %s: %s", url, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
 func (agent *NodeAgent) downloadFile(url, filepath string) error {
 	// Implement file download logic
 	cmd := exec.Command("wget", "-O", filepath, url)
@@ -662,14 +862,6 @@ func getUptime() time.Duration {
 	return time.Duration(info.Uptime) * time.Second
 }
 
-func (agent *NodeAgent) updateServer(data interface{}) {
-	// Implement server update logic
-}
-
-func (agent *NodeAgent) getServerStatus(data interface{}) {
-	// Implement server status check
-}
-
 func (agent *NodeAgent) executeCommand(data interface{}) {
 	// Implement command execution
 }
@@ -679,7 +871,23 @@ func (agent *NodeAgent) handleFileOperation(data interface{}) {
 }
 
 func (agent *NodeAgent) updateNode(data interface{}) {
-	// Implement node update logic
+	var update struct {
+		MetricsIntervalSeconds int `json:"metrics_interval_seconds"`
+	}
+	if err := decodeMessageData(data, &update); err != nil {
+		log.Printf("Invalid node update data")
+		return
+	}
+
+	if update.MetricsIntervalSeconds > 0 {
+		interval := clampMetricsInterval(time.Duration(update.MetricsIntervalSeconds) * time.Second)
+		// Only the latest interval matters, so replace one not yet applied
+		select {
+		case <-agent.metricsInterval:
+		default:
+		}
+		agent.metricsInterval <- interval
+	}
 }
 
 func (agent *NodeAgent) respondHealthCheck() {
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetServerImage(t *testing.T) {
+	tests := []struct {
+		serverType string
+		gpu        bool
+		want       string
+	}{
+		{"minecraft-paper", false, "playpulse/minecraft-paper:latest"},
+		{"minecraft-paper", true, "playpulse/minecraft-paper:latest-gpu"},
+		{"valheim", true, "playpulse/valheim:latest-gpu"},
+		{"unknown", false, "playpulse/generic:latest"},
+		{"unknown", true, "playpulse/generic:latest-gpu"},
+	}
+	for _, tt := range tests {
+		if got := getServerImage(tt.serverType, tt.gpu); got != tt.want {
+			t.Errorf("getServerImage(%q, %v) = %q, want %q", tt.serverType, tt.gpu, got, tt.want)
+		}
+	}
+}
+
+func TestGetMetricsInterval(t *testing.T) {
+	tests := []struct {
+		env  string
+		want time.Duration
+	}{
+		{"", 5 * time.Second},
+		{"15", 15 * time.Second},
+		{"0", 5 * time.Second},
+		{"soon", 5 * time.Second},
+		{"86400", time.Hour},
+	}
+	for _, tt := range tests {
+		t.Setenv("PLAYPULSE_METRICS_INTERVAL", tt.env)
+		if got := getMetricsInterval(); got != tt.want {
+			t.Errorf("PLAYPULSE_METRICS_INTERVAL=%q: interval = %s, want %s", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateNodeSetsMetricsInterval(t *testing.T) {
+	agent := &NodeAgent{metricsInterval: make(chan time.Duration, 1)}
+
+	// An update not yet applied is replaced by the next one
+	agent.updateNode(map[string]interface{}{"metrics_interval_seconds": 30})
+	agent.updateNode(map[string]interface{}{"metrics_interval_seconds": 10})
+	select {
+	case interval := <-agent.metricsInterval:
+		if interval != 10*time.Second {
+			t.Errorf("interval = %s, want the latest 10s", interval)
+		}
+	default:
+		t.Fatal("no interval was sent to the reporting loop")
+	}
+
+	agent.updateNode(map[string]interface{}{"metrics_interval_seconds": 0})
+	agent.updateNode("not an update")
+	select {
+	case interval := <-agent.metricsInterval:
+		t.Errorf("interval %s sent for an update without one", interval)
+	default:
+	}
+}
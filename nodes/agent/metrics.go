@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// agentStartedAt is when the agent process started, for its uptime
+var agentStartedAt = time.Now()
+
+// serverImagePrefix marks the containers the agent runs for game servers
+const serverImagePrefix = "playpulse/"
+
+// promWriter writes metrics in the Prometheus text format. Every sample
+// carries the node's labels, HELP and TYPE are written once per metric and
+// samples that aren't finite are dropped, so a missing reading leaves its
+// series out instead of reporting NaN.
+type promWriter struct {
+	w       io.Writer
+	labels  []string
+	written map[string]bool
+}
+
+func newPromWriter(w io.Writer, agent *NodeAgent) *promWriter {
+	return &promWriter{
+		w: w,
+		labels: []string{
+			promLabel("node_id", agent.ID),
+			promLabel("node_name", agent.Name),
+			promLabel("location", agent.Location),
+		},
+		written: make(map[string]bool),
+	}
+}
+
+// sample writes one sample; extra labels come as name, value pairs
+func (pw *promWriter) sample(name, metricType, help string, value float64, extra ...string) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+
+	if !pw.written[name] {
+		pw.written[name] = true
+		fmt.Fprintf(pw.w, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(pw.w, "# TYPE %s %s\n", name, metricType)
+	}
+
+	labels := append([]string{}, pw.labels...)
+	for i := 0; i+1 < len(extra); i += 2 {
+		labels = append(labels, promLabel(extra[i], extra[i+1]))
+	}
+	fmt.Fprintf(pw.w, "%s{%s} %s\n", name, strings.Join(labels, ","), formatPromValue(value))
+}
+
+func (pw *promWriter) gauge(name, help string, value float64, extra ...string) {
+	pw.sample(name, "gauge", help, value, extra...)
+}
+
+func (pw *promWriter) counter(name, help string, value float64, extra ...string) {
+	pw.sample(name, "counter", help, value, extra...)
+}
+
+func promLabel(name, value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return fmt.Sprintf(`%s="%s"`, name, escaped)
+}
+
+func formatPromValue(value float64) string {
+	if value == math.Trunc(value) && math.Abs(value) < 1e15 {
+		return fmt.Sprintf("%.0f", value)
+	}
+	return fmt.Sprintf("%g", value)
+}
+
+// serveMetrics is the Prometheus scrape endpoint
+func (agent *NodeAgent) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	agent.writeMetrics(w)
+}
+
+// writeMetrics reads the node's current state and writes it as metrics.
+// Each source is read on its own, so one failing only drops its series.
+func (agent *NodeAgent) writeMetrics(w io.Writer) {
+	pw := newPromWriter(w, agent)
+
+	// CPU usage needs a sampling window, so it comes from the last resource
+	// report rather than the scrape
+	if agent.Resources.CPU.Cores > 0 {
+		pw.gauge("node_cpu_usage_percent", "CPU usage percentage", agent.Resources.CPU.UsagePercent)
+		pw.gauge("node_cpu_cores", "Number of CPU cores", float64(agent.Resources.CPU.Cores))
+	}
+
+	if avg, err := load.Avg(); err == nil {
+		pw.gauge("node_load1", "1 minute load average", avg.Load1)
+		pw.gauge("node_load5", "5 minute load average", avg.Load5)
+		pw.gauge("node_load15", "15 minute load average", avg.Load15)
+	}
+
+	if memory, err := mem.VirtualMemory(); err == nil {
+		pw.gauge("node_memory_usage_percent", "Memory usage percentage", memory.UsedPercent)
+		pw.gauge("node_memory_total_bytes", "Total memory in bytes", float64(memory.Total))
+		pw.gauge("node_memory_used_bytes", "Used memory in bytes", float64(memory.Used))
+		pw.gauge("node_memory_available_bytes", "Available memory in bytes", float64(memory.Available))
+	}
+	if swap, err := mem.SwapMemory(); err == nil && swap.Total > 0 {
+		pw.gauge("node_swap_used_bytes", "Used swap in bytes", float64(swap.Used))
+		pw.gauge("node_swap_total_bytes", "Total swap in bytes", float64(swap.Total))
+	}
+
+	if usage, err := disk.Usage("/"); err == nil {
+		pw.gauge("node_disk_usage_percent", "Root filesystem usage percentage", usage.UsedPercent, "mountpoint", "/")
+		pw.gauge("node_disk_total_bytes", "Root filesystem size in bytes", float64(usage.Total), "mountpoint", "/")
+		pw.gauge("node_disk_used_bytes", "Root filesystem used bytes", float64(usage.Used), "mountpoint", "/")
+		pw.gauge("node_disk_free_bytes", "Root filesystem free bytes", float64(usage.Free), "mountpoint", "/")
+	}
+	if counters, err := disk.IOCounters(); err == nil {
+		devices := make([]string, 0, len(counters))
+		for device := range counters {
+			devices = append(devices, device)
+		}
+		sort.Strings(devices)
+		for _, device := range devices {
+			pw.counter("node_disk_read_bytes_total", "Bytes read from the device", float64(counters[device].ReadBytes), "device", device)
+		}
+		for _, device := range devices {
+			pw.counter("node_disk_written_bytes_total", "Bytes written to the device", float64(counters[device].WriteBytes), "device", device)
+		}
+	}
+
+	if counters, err := net.IOCounters(true); err == nil {
+		sort.Slice(counters, func(i, j int) bool { return counters[i].Name < counters[j].Name })
+		for _, iface := range counters {
+			pw.counter("node_network_receive_bytes_total", "Bytes received on the interface", float64(iface.BytesRecv), "device", iface.Name)
+		}
+		for _, iface := range counters {
+			pw.counter("node_network_transmit_bytes_total", "Bytes sent on the interface", float64(iface.BytesSent), "device", iface.Name)
+		}
+	}
+
+	// Not every host exposes sensors; virtual machines usually don't
+	if sensors, err := host.SensorsTemperatures(); err == nil {
+		sort.Slice(sensors, func(i, j int) bool { return sensors[i].SensorKey < sensors[j].SensorKey })
+		for _, sensor := range sensors {
+			if sensor.Temperature > 0 {
+				pw.gauge("node_temperature_celsius", "Hardware sensor temperature", sensor.Temperature, "sensor", sensor.SensorKey)
+			}
+		}
+	}
+
+	if states, err := serverContainerStates(); err == nil {
+		names := make([]string, 0, len(states))
+		for state := range states {
+			names = append(names, state)
+		}
+		sort.Strings(names)
+		for _, state := range names {
+			pw.gauge("node_server_containers", "Game server containers by state", float64(states[state]), "state", state)
+		}
+	}
+
+	if uptime, err := host.Uptime(); err == nil {
+		pw.gauge("node_uptime_seconds", "Seconds since the node booted", float64(uptime))
+	}
+	pw.gauge("node_agent_uptime_seconds", "Seconds since the agent started", time.Since(agentStartedAt).Seconds())
+}
+
+// serverContainerStates counts the game server containers by docker state.
+// running is always present so a node with no servers reports 0.
+func serverContainerStates() (map[string]int, error) {
+	output, err := dockerOutput("ps", "--all", "--format", "{{.Image}}\t{{.State}}")
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[string]int{"running": 0}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		image, state, found := strings.Cut(line, "\t")
+		if found && strings.HasPrefix(image, serverImagePrefix) {
+			states[state]++
+		}
+	}
+	return states, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPromWriterFormat(t *testing.T) {
+	var out bytes.Buffer
+	pw := newPromWriter(&out, &NodeAgent{ID: "node-1", Name: `eu "main"`, Location: "eu-west"})
+
+	pw.gauge("node_load1", "1 minute load average", 0.75)
+	pw.counter("node_disk_read_bytes_total", "Bytes read from the device", 4096, "device", "sda")
+	pw.counter("node_disk_read_bytes_total", "Bytes read from the device", 1e15, "device", "sdb")
+	pw.gauge("node_temperature_celsius", "Hardware sensor temperature", math.NaN(), "sensor", "cpu")
+	pw.gauge("node_temperature_celsius", "Hardware sensor temperature", math.Inf(1), "sensor", "gpu")
+
+	labels := `node_id="node-1",node_name="eu \"main\"",location="eu-west"`
+	want := strings.Join([]string{
+		"# HELP node_load1 1 minute load average",
+		"# TYPE node_load1 gauge",
+		"node_load1{" + labels + "} 0.75",
+		"# HELP node_disk_read_bytes_total Bytes read from the device",
+		"# TYPE node_disk_read_bytes_total counter",
+		"node_disk_read_bytes_total{" + labels + `,device="sda"} 4096`,
+		"node_disk_read_bytes_total{" + labels + `,device="sdb"} 1e+15`,
+	}, "\n") + "\n"
+	if out.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestServeMetricsScrape(t *testing.T) {
+	dir := useFakeDocker(t)
+	writeDockerFile(t, dir, "ps.txt", strings.Join([]string{
+		"playpulse/minecraft-paper:latest\trunning",
+		"playpulse/valheim:latest\trunning",
+		"playpulse/generic:latest\texited",
+		"postgres:16\trunning",
+	}, "\n"))
+
+	agent := &NodeAgent{ID: "node-1", Name: "alpha", Location: "eu-west"}
+	agent.Resources.CPU = CPUInfo{Cores: 8, UsagePercent: 12.5}
+
+	rec := httptest.NewRecorder()
+	agent.serveMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", contentType)
+	}
+
+	samples := make(map[string]string)
+	typed := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n") {
+		if strings.HasPrefix(line, "# TYPE ") {
+			typed[strings.Fields(line)[2]] = true
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		series, value, found := strings.Cut(line, " ")
+		name, _, _ := strings.Cut(series, "{")
+		if !found || !strings.Contains(series, `node_id="node-1",node_name="alpha",location="eu-west"`) {
+			t.Errorf("sample %q does not carry the node's labels", line)
+		}
+		if !typed[name] {
+			t.Errorf("sample %q comes before its TYPE line", line)
+		}
+		samples[series] = value
+	}
+
+	labels := `{node_id="node-1",node_name="alpha",location="eu-west"`
+	for series, want := range map[string]string{
+		"node_cpu_cores" + labels + "}":                         "8",
+		"node_cpu_usage_percent" + labels + "}":                 "12.5",
+		"node_server_containers" + labels + `,state="running"}`: "2",
+		"node_server_containers" + labels + `,state="exited"}`:  "1",
+	} {
+		if got := samples[series]; got != want {
+			t.Errorf("%s = %q, want %q", series, got, want)
+		}
+	}
+	if _, found := samples["node_agent_uptime_seconds"+labels+"}"]; !found {
+		t.Error("node_agent_uptime_seconds is missing")
+	}
+}
+
+func TestServeMetricsWithoutDocker(t *testing.T) {
+	dir := useFakeDocker(t)
+	writeDockerFile(t, dir, "fail-ps", "Cannot connect to the Docker daemon")
+
+	rec := httptest.NewRecorder()
+	(&NodeAgent{ID: "node-1"}).serveMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	// The container series are left out; the rest of the scrape still works
+	body := rec.Body.String()
+	if strings.Contains(body, "node_server_containers") {
+		t.Error("container series reported without docker")
+	}
+	if !strings.Contains(body, "node_agent_uptime_seconds{") {
+		t.Error("scrape stopped at the failing source")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pingTimeout bounds a status ping of one server
+const pingTimeout = 2 * time.Second
+
+// pingPlayers asks the Minecraft server published on port for its online and
+// maximum player counts with a server list ping
+func pingPlayers(port int) (online, max int, err error) {
+	host := getServerHost()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), pingTimeout)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(pingTimeout))
+
+	// Handshake (protocol version -1 asks for the status of any version,
+	// address, port, next state 1 for status), then the status request
+	handshake := []byte{0x00}
+	handshake = binary.AppendUvarint(handshake, 0xFFFFFFFF)
+	handshake = binary.AppendUvarint(handshake, uint64(len(host)))
+	handshake = append(handshake, host...)
+	handshake = binary.BigEndian.AppendUint16(handshake, uint16(port))
+	handshake = binary.AppendUvarint(handshake, 1)
+
+	var request []byte
+	request = binary.AppendUvarint(request, uint64(len(handshake)))
+	request = append(request, handshake...)
+	request = append(request, 0x01, 0x00)
+	if _, err := conn.Write(request); err != nil {
+		return 0, 0, err
+	}
+
+	reader := bufio.NewReader(conn)
+	if _, err := binary.ReadUvarint(reader); err != nil {
+		return 0, 0, err
+	}
+	if packetID, err := binary.ReadUvarint(reader); err != nil || packetID != 0 {
+		return 0, 0, fmt.Errorf("unexpected status response")
+	}
+	length, err := binary.ReadUvarint(reader)
+	if err != nil || length > 1<<20 {
+		return 0, 0, fmt.Errorf("invalid status response")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return 0, 0, err
+	}
+
+	var status struct {
+		Players struct {
+			Online int `json:"online"`
+			Max    int `json:"max"`
+		} `json:"players"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return 0, 0, err
+	}
+	return status.Players.Online, status.Players.Max, nil
+}
+
+// isMinecraftType reports whether servers of the type answer status pings
+func isMinecraftType(serverType string) bool {
+	return strings.HasPrefix(serverType, "minecraft-")
+}